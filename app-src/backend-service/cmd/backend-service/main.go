@@ -0,0 +1,147 @@
+// Command backend-service runs the demo API. With -dry-run (or the validate
+// argument) it only validates its configuration, prints a report and exits
+// with status 1 if anything is wrong, so an init container or CI job can
+// stop a broken rollout before the pods start:
+//
+//	backend-service -dry-run -check-deps
+//
+// The migrate argument applies or reverts the database migrations built
+// into the binary instead of serving, for a Job ahead of the rollout:
+//
+//	backend-service migrate up
+//
+// The worker argument consumes the events the API publishes to the event
+// broker instead of serving the API, with its own probes and metrics on
+// PORT:
+//
+//	backend-service worker
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/logging"
+	"github.com/anasadan/gitops-demo/backend-service/internal/server"
+	"github.com/anasadan/gitops-demo/backend-service/internal/worker"
+)
+
+var (
+	// Version is set at build time via -ldflags; without them the build
+	// information embedded by the go command is used.
+	Version   string
+	BuildTime string
+	GitCommit string
+	GitBranch string
+	GitTag    string
+	// GitDirty is "true" when the tree had uncommitted changes
+	GitDirty  string
+	BuildUser string
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "validate the configuration, print a report and exit")
+	checkDeps := flag.Bool("check-deps", false, "with -dry-run, also check that the Kubernetes API and dependencies are reachable")
+	output := flag.String("output", "text", "format of the -dry-run report: text or json")
+	flag.Parse()
+	// Flags may follow the validate argument too.
+	if flag.Arg(0) == "validate" {
+		*dryRun = true
+		_ = flag.CommandLine.Parse(flag.Args()[1:])
+	}
+	migrateArgs := flag.Args()
+	if flag.Arg(0) == "migrate" {
+		migrateArgs = migrateArgs[1:]
+	} else if flag.Arg(0) == "worker" && flag.NArg() > 1 {
+		fatal("Unexpected arguments", "args", strings.Join(flag.Args()[1:], " "))
+	} else if flag.Arg(0) != "worker" && flag.NArg() > 0 {
+		fatal("Unexpected arguments", "args", strings.Join(flag.Args(), " "))
+	}
+	if *output != "text" && *output != "json" {
+		fatal("Invalid -output", "output", *output)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Invalid configuration", "error", err)
+	}
+	cfg.Build = config.ResolveBuildInfo(config.BuildInfo{
+		Version:   Version,
+		BuildTime: BuildTime,
+		GitCommit: GitCommit,
+		GitBranch: GitBranch,
+		GitTag:    GitTag,
+		GitDirty:  GitDirty == "true",
+		BuildUser: BuildUser,
+	})
+	logging.Setup(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+
+	if flag.Arg(0) == "migrate" {
+		os.Exit(runMigrate(ctx, os.Stdout, cfg, migrateArgs))
+	}
+	if flag.Arg(0) == "worker" {
+		w, err := worker.New(cfg)
+		if err != nil {
+			fatal("Failed to create worker", "error", err)
+		}
+		if err := w.Run(ctx); err != nil {
+			fatal("Worker stopped", "error", err)
+		}
+		return
+	}
+
+	if *dryRun {
+		report := server.Validate(ctx, cfg, *checkDeps)
+		if err := printReport(os.Stdout, report, *output); err != nil {
+			fatal("Error writing report", "error", err)
+		}
+		if report.Status != "pass" {
+			os.Exit(1)
+		}
+		return
+	}
+
+	srv, err := server.NewServer(cfg)
+	if err != nil {
+		fatal("Failed to create server", "error", err)
+	}
+	if err := srv.Run(ctx); err != nil {
+		fatal("Server stopped", "error", err)
+	}
+}
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+func printReport(w io.Writer, report server.SelftestResponse, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	for _, c := range report.Checks {
+		line := fmt.Sprintf("%-4s  %-12s  %7.1fms", strings.ToUpper(c.Status), c.Name, c.DurationMs)
+		if c.Message != "" {
+			line += "  " + c.Message
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "configuration %s\n", report.Status)
+	return err
+}
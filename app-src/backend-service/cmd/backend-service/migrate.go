@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/migrate"
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+)
+
+// Exit codes of the migrate command, for the Job that runs it.
+const (
+	exitOK      = 0
+	exitFailed  = 1
+	exitUsage   = 2
+	exitPending = 3
+)
+
+const migrateUsage = `usage: backend-service migrate up [N] | down [N] | status
+
+  up [N]    apply the pending migrations, or the next N
+  down [N]  revert the last applied migration, or the last N
+  status    list the migrations; exits 3 while some are pending`
+
+// runMigrate runs `backend-service migrate` with args and returns its exit
+// status: 0 on success, 1 when a migration or the database fails, 2 on a
+// usage error and 3 for status with migrations pending. Without PGHOST
+// there's no database to migrate, which is a success.
+func runMigrate(ctx context.Context, w io.Writer, cfg config.Config, args []string) int {
+	if len(args) == 0 || len(args) > 2 {
+		fmt.Fprintln(w, migrateUsage)
+		return exitUsage
+	}
+	command, n := args[0], 0
+	switch {
+	case command != "up" && command != "down" && command != "status",
+		command == "status" && len(args) == 2:
+		fmt.Fprintln(w, migrateUsage)
+		return exitUsage
+	case len(args) == 2:
+		var err error
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			fmt.Fprintln(w, migrateUsage)
+			return exitUsage
+		}
+	case command == "down":
+		n = 1
+	}
+
+	migrations, err := migrate.Embedded()
+	if err != nil {
+		slog.Error("Invalid embedded migrations", "error", err)
+		return exitFailed
+	}
+	if cfg.DatabaseHost == "" {
+		slog.Info("PGHOST is not set; no database to migrate")
+		return exitOK
+	}
+	db := postgres.Open(postgres.Config{
+		Host:            cfg.DatabaseHost,
+		Port:            cfg.DatabasePort,
+		User:            cfg.DatabaseUser,
+		Password:        cfg.DatabasePassword,
+		Database:        cfg.DatabaseName,
+		SSLMode:         cfg.DatabaseSSLMode,
+		MaxConns:        1,
+		ConnectTimeout:  10 * time.Second,
+		ApplicationName: cfg.ServiceName + "-migrate",
+	})
+	defer db.Close()
+	m := migrate.New(db, migrations)
+
+	switch command {
+	case "up":
+		done, err := m.Up(ctx, n)
+		for _, mig := range done {
+			slog.Info("Applied migration", "migration", mig.String())
+		}
+		if err != nil {
+			slog.Error("Migration failed", "error", err)
+			return exitFailed
+		}
+		if len(done) == 0 {
+			slog.Info("Database is up to date")
+		}
+	case "down":
+		done, err := m.Down(ctx, n)
+		for _, mig := range done {
+			slog.Info("Reverted migration", "migration", mig.String())
+		}
+		if err != nil {
+			slog.Error("Revert failed", "error", err)
+			return exitFailed
+		}
+		if len(done) == 0 {
+			slog.Info("No migration to revert")
+		}
+	case "status":
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			slog.Error("Reading migration status failed", "error", err)
+			return exitFailed
+		}
+		if printStatus(w, statuses) {
+			return exitPending
+		}
+	}
+	return exitOK
+}
+
+// printStatus writes a table of the migrations and reports whether some
+// are pending.
+func printStatus(w io.Writer, statuses []migrate.Status) bool {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	pending := false
+	for _, s := range statuses {
+		state := "pending"
+		switch {
+		case s.Unknown:
+			state = "applied (unknown to this build)"
+		case s.Applied:
+			state = "applied"
+		default:
+			pending = true
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, s.AppliedAt)
+	}
+	tw.Flush()
+	return pending
+}
@@ -0,0 +1,135 @@
+// Command replay re-issues requests recorded by backend-service against
+// another deployment and reports the responses that differ, e.g. to check a
+// staging candidate with production traffic before promoting it:
+//
+//	replay -target http://localhost:8081 -compare shape prod-recording.jsonl
+//
+// It exits with status 1 when any response differs and 2 on usage errors.
+// With -pushgateway (or PUSHGATEWAY_URL) it pushes the outcome of the run
+// to a Prometheus Pushgateway before exiting, so scheduled replays are
+// observable like any other workload.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/pushgateway"
+	"github.com/anasadan/gitops-demo/backend-service/internal/recording"
+)
+
+func main() {
+	target := flag.String("target", "", "base URL of the deployment to replay against (required)")
+	compare := flag.String("compare", recording.CompareShape, "what must match: status, shape or body")
+	timeout := flag.Duration("timeout", 10*time.Second, "timeout of each request")
+	pushURL := flag.String("pushgateway", os.Getenv("PUSHGATEWAY_URL"), "Pushgateway base URL to push the run's metrics to (default $PUSHGATEWAY_URL)")
+	job := flag.String("job", "replay", "job name of the pushed metrics")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -target URL [flags] recording.jsonl... (- for stdin)\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	switch *compare {
+	case recording.CompareStatus, recording.CompareShape, recording.CompareBody:
+	default:
+		log.Printf("invalid -compare %q", *compare)
+		os.Exit(2)
+	}
+	if *target == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Without compression the transport adds no Accept-Encoding, so the
+	// requests carry exactly the recorded headers.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DisableCompression = true
+	rp := &recording.Replayer{
+		Client:     &http.Client{Timeout: *timeout, Transport: transport},
+		Target:     *target,
+		AdminToken: os.Getenv("ADMIN_TOKEN"),
+		Compare:    *compare,
+	}
+	start := time.Now()
+	var replayed, skipped, failed, errored int
+	for _, path := range flag.Args() {
+		exchanges, err := readFile(path)
+		if err != nil {
+			push(*pushURL, *job, *target, start, replayed, skipped, failed, errored, err)
+			log.Fatalf("Reading %s: %v", path, err)
+		}
+		for _, ex := range exchanges {
+			if ctx.Err() != nil {
+				break
+			}
+			res := rp.Replay(ctx, ex)
+			switch {
+			case res.Skipped:
+				skipped++
+				continue
+			case res.Err != nil:
+				fmt.Printf("ERROR %s %s: %v\n", ex.Method, ex.URI, res.Err)
+				errored++
+			case res.Mismatch != "":
+				fmt.Printf("DIFF  %s %s: %s\n", ex.Method, ex.URI, res.Mismatch)
+				failed++
+			}
+			replayed++
+		}
+	}
+	fmt.Printf("replayed %d, skipped %d truncated, %d differed, %d failed\n", replayed, skipped, failed, errored)
+	var runErr error
+	if failed+errored > 0 {
+		runErr = fmt.Errorf("%d responses differed, %d requests failed", failed, errored)
+	}
+	push(*pushURL, *job, *target, start, replayed, skipped, failed, errored, runErr)
+	if runErr != nil {
+		os.Exit(1)
+	}
+}
+
+// push sends the outcome of the run to the Pushgateway, grouped by target
+// so replays against different deployments don't overwrite each other. A
+// failed push is logged but doesn't change the exit status.
+func push(gateway, job, target string, start time.Time, replayed, skipped, differed, errored int, runErr error) {
+	if gateway == "" {
+		return
+	}
+	metrics := pushgateway.JobMetrics("replay", start, time.Now(), runErr)
+	for _, r := range []struct {
+		result string
+		count  int
+	}{{"replayed", replayed}, {"skipped", skipped}, {"differed", differed}, {"failed", errored}} {
+		metrics = append(metrics, pushgateway.Metric{Name: "replay_exchanges", Help: "Recorded exchanges of the last run by result.",
+			Type: pushgateway.Gauge, Labels: map[string]string{"result": r.result}, Value: float64(r.count)})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	p := &pushgateway.Pusher{URL: gateway}
+	if err := p.Push(ctx, job, map[string]string{"target": target}, metrics); err != nil {
+		log.Printf("Pushing metrics: %v", err)
+	}
+}
+
+func readFile(path string) ([]recording.Exchange, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return recording.Read(r)
+}
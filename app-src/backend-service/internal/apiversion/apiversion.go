@@ -0,0 +1,90 @@
+// Package apiversion negotiates the response shape version of a request.
+//
+// Clients select a version with an Accept-Version header ("2" or "v2") or a
+// vendor media type (Accept: application/vnd.gitops-demo.v2+json). Requests
+// without either get version 1, the original shapes, so existing consumers
+// keep working while new shapes roll out environment by environment. The
+// served version is echoed in the API-Version response header.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+const (
+	// Default is served when the request doesn't ask for a version.
+	Default = 1
+	// Latest is the newest version this build serves.
+	Latest = 2
+
+	// Header is the response header carrying the served version.
+	Header = "API-Version"
+	// RequestHeader selects a version explicitly.
+	RequestHeader = "Accept-Version"
+	// MediaTypePrefix starts the vendor media type, e.g.
+	// "application/vnd.gitops-demo.v2+json".
+	MediaTypePrefix = "application/vnd.gitops-demo.v"
+)
+
+type contextKey struct{}
+
+// FromContext returns the negotiated version, Default outside a negotiated
+// request.
+func FromContext(ctx context.Context) int {
+	if v, ok := ctx.Value(contextKey{}).(int); ok {
+		return v
+	}
+	return Default
+}
+
+// NewContext returns ctx carrying version v.
+func NewContext(ctx context.Context, v int) context.Context {
+	return context.WithValue(ctx, contextKey{}, v)
+}
+
+// Negotiate returns the version requested by r. Accept-Version takes
+// precedence over the media type.
+func Negotiate(r *http.Request) (int, error) {
+	if raw := strings.TrimSpace(r.Header.Get(RequestHeader)); raw != "" {
+		return parse(raw)
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, _, _ := strings.Cut(strings.TrimSpace(mediaRange), ";")
+			if rest, ok := strings.CutPrefix(strings.TrimSpace(mediaType), MediaTypePrefix); ok {
+				return parse(strings.TrimSuffix(rest, "+json"))
+			}
+		}
+	}
+	return Default, nil
+}
+
+func parse(raw string) (int, error) {
+	v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(raw), "v"))
+	if err != nil || v < 1 || v > Latest {
+		return 0, fmt.Errorf("unsupported API version %q, supported versions are 1-%d", raw, Latest)
+	}
+	return v, nil
+}
+
+// Middleware negotiates the version of every request, stores it in the
+// request context and echoes it back. Unsupported versions are rejected with
+// 406 Not Acceptable.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept, "+RequestHeader)
+		v, err := Negotiate(r)
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusNotAcceptable)
+			return
+		}
+		w.Header().Set(Header, strconv.Itoa(v))
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), v)))
+	})
+}
@@ -0,0 +1,71 @@
+package apiversion
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name          string
+		acceptVersion string
+		accept        string
+		want          int
+		wantErr       bool
+	}{
+		{name: "default", want: Default},
+		{name: "plain json", accept: "application/json", want: Default},
+		{name: "accept-version", acceptVersion: "2", want: 2},
+		{name: "accept-version with prefix", acceptVersion: "V1", want: 1},
+		{name: "media type", accept: "text/html, application/vnd.gitops-demo.v2+json;q=0.9", want: 2},
+		{name: "media type without suffix", accept: "application/vnd.gitops-demo.v1", want: 1},
+		{name: "accept-version wins", acceptVersion: "1", accept: "application/vnd.gitops-demo.v2+json", want: 1},
+		{name: "too new", acceptVersion: "3", wantErr: true},
+		{name: "zero", acceptVersion: "0", wantErr: true},
+		{name: "garbage", accept: "application/vnd.gitops-demo.vX+json", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.acceptVersion != "" {
+				r.Header.Set(RequestHeader, tt.acceptVersion)
+			}
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			got, err := Negotiate(r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("version = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var seen int
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context())
+	}))
+
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(RequestHeader, "2")
+	h.ServeHTTP(rec, r)
+	if seen != 2 || rec.Header().Get(Header) != "2" {
+		t.Errorf("handler saw version %d, response header %q, want 2", seen, rec.Header().Get(Header))
+	}
+	if rec.Header().Get("Vary") == "" {
+		t.Error("response doesn't vary on the version headers")
+	}
+
+	rec = httptest.NewRecorder()
+	r.Header.Set(RequestHeader, "7")
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotAcceptable {
+		t.Errorf("status = %d, want 406 for an unsupported version", rec.Code)
+	}
+}
@@ -0,0 +1,201 @@
+// Package artifact stores uploaded files in a directory, typically a
+// PersistentVolume or the pod's emptyDir, and hands out IDs to retrieve
+// them by. Writes are streamed, so an upload never has to fit in memory.
+package artifact
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTooLarge is returned by Put when the content exceeds the store's
+	// per-artifact limit.
+	ErrTooLarge = errors.New("artifact: too large")
+	// ErrFull is returned by Put when the store holds its maximum total.
+	ErrFull = errors.New("artifact: store full")
+	// ErrDisabled is returned by Put on a store without a directory.
+	ErrDisabled = errors.New("artifact: store disabled")
+)
+
+// validID matches the IDs Put generates; anything else is rejected before
+// it can reach the file system.
+var validID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// metaExt is the extension of the metadata file stored next to each
+// artifact.
+const metaExt = ".json"
+
+// tmpPrefix names uploads in progress.
+const tmpPrefix = ".upload-"
+
+// Artifact describes a stored file.
+type Artifact struct {
+	ID          string `json:"id"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Bytes       int64  `json:"bytes"`
+	SHA256      string `json:"sha256"`
+	CreatedAt   string `json:"created_at"`
+}
+
+// Store keeps artifacts of at most maxBytes each in dir, refusing new ones
+// once the directory holds maxTotal bytes.
+type Store struct {
+	dir      string
+	maxBytes int64
+	maxTotal int64
+
+	mu    sync.Mutex
+	total int64
+}
+
+// NewStore creates dir if needed and accounts for the artifacts already
+// in it. An empty dir returns a disabled store.
+func NewStore(dir string, maxBytes, maxTotal int64) (*Store, error) {
+	if dir == "" {
+		return &Store{}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating artifact directory: %w", err)
+	}
+	st := &Store{dir: dir, maxBytes: maxBytes, maxTotal: maxTotal}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		// Left behind by a crash mid-upload
+		if strings.HasPrefix(e.Name(), tmpPrefix) {
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			st.total += info.Size()
+		}
+	}
+	return st, nil
+}
+
+// Enabled reports whether the store has a directory to keep artifacts in.
+func (st *Store) Enabled() bool {
+	return st != nil && st.dir != ""
+}
+
+// MaxBytes is the largest artifact the store accepts.
+func (st *Store) MaxBytes() int64 {
+	return st.maxBytes
+}
+
+// Put streams r into a new artifact. The content is written to a temporary
+// file first, so a failed or oversized upload never becomes visible.
+func (st *Store) Put(filename, contentType string, r io.Reader) (Artifact, error) {
+	if !st.Enabled() {
+		return Artifact{}, ErrDisabled
+	}
+	if st.full() {
+		return Artifact{}, ErrFull
+	}
+	tmp, err := os.CreateTemp(st.dir, tmpPrefix+"*")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(r, st.maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return Artifact{}, err
+	}
+	if n > st.maxBytes {
+		return Artifact{}, ErrTooLarge
+	}
+
+	art := Artifact{
+		ID:          newID(),
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+		Bytes:       n,
+		SHA256:      hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	meta, err := json.Marshal(art)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.total+n+int64(len(meta)) > st.maxTotal {
+		return Artifact{}, ErrFull
+	}
+	if err := os.WriteFile(filepath.Join(st.dir, art.ID+metaExt), meta, 0o644); err != nil {
+		return Artifact{}, err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(st.dir, art.ID)); err != nil {
+		os.Remove(filepath.Join(st.dir, art.ID+metaExt))
+		return Artifact{}, err
+	}
+	st.total += n + int64(len(meta))
+	return art, nil
+}
+
+func (st *Store) full() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.total >= st.maxTotal
+}
+
+// Open returns the artifact with the given ID and its content. Unknown and
+// malformed IDs yield an error satisfying errors.Is(err, fs.ErrNotExist).
+func (st *Store) Open(id string) (Artifact, *os.File, error) {
+	if !st.Enabled() || !validID.MatchString(id) {
+		return Artifact{}, nil, os.ErrNotExist
+	}
+	meta, err := os.ReadFile(filepath.Join(st.dir, id+metaExt))
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	var art Artifact
+	if err := json.Unmarshal(meta, &art); err != nil {
+		return Artifact{}, nil, fmt.Errorf("reading artifact %s: %w", id, err)
+	}
+	f, err := os.Open(filepath.Join(st.dir, id))
+	if err != nil {
+		return Artifact{}, nil, err
+	}
+	return art, f, nil
+}
+
+// cleanFilename keeps the last element of a client-supplied name, which
+// is only ever echoed back, never used as a path.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
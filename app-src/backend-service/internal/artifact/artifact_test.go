@@ -0,0 +1,79 @@
+package artifact
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPutOpen(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewStore(dir, 16, 1<<10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	art, err := st.Put(`C:\Users\me\notes.txt`, "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if art.Filename != "notes.txt" || art.Bytes != 5 || art.ContentType != "text/plain" ||
+		art.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Put = %+v", art)
+	}
+
+	got, f, err := st.Open(art.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(f)
+	f.Close()
+	if got != art || string(content) != "hello" {
+		t.Errorf("Open = %+v %q, want %+v \"hello\"", got, content, art)
+	}
+
+	for _, id := range []string{"missing", "../" + art.ID, strings.Repeat("0", 32)} {
+		if _, _, err := st.Open(id); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Open(%q) = %v, want not found", id, err)
+		}
+	}
+}
+
+func TestPutLimits(t *testing.T) {
+	dir := t.TempDir()
+	st, err := NewStore(dir, 8, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := st.Put("big", "text/plain", strings.NewReader("123456789")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized Put = %v, want ErrTooLarge", err)
+	}
+	// An artifact and its metadata exceed the 64 bytes in total.
+	if _, err := st.Put("a", "text/plain", strings.NewReader("12345678")); !errors.Is(err, ErrFull) {
+		t.Errorf("Put beyond the total = %v, want ErrFull", err)
+	}
+	// Neither attempt leaves a file behind.
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("directory holds %d entries after failed uploads", len(entries))
+	}
+
+	// Leftovers of an interrupted upload are removed on startup.
+	if err := os.WriteFile(filepath.Join(dir, tmpPrefix+"1"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewStore(dir, 8, 64); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("temporary file not removed")
+	}
+
+	disabled, _ := NewStore("", 8, 64)
+	if _, err := disabled.Put("a", "text/plain", strings.NewReader("x")); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Put on a disabled store = %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Package audit records who changed what and when: admin actions and
+// mutations of the API. Entries go to their own stream of JSON lines,
+// whatever the log format and level, so a log pipeline can route and keep
+// them apart from the access log, and the most recent ones stay in memory
+// to be listed.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Stream is the value of the "stream" field of every audit line.
+const Stream = "audit"
+
+// Outcomes of an audited operation.
+const (
+	OutcomeSucceeded = "succeeded"
+	// Refused: the request lacked a valid credential
+	OutcomeRefused = "refused"
+	// Failed: the request was authorized, but failed
+	OutcomeFailed = "failed"
+)
+
+// Entry is one audited operation.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Action names the operation, such as "pod.drain" or "item.delete".
+	Action string `json:"action"`
+	// Actor is who did it: the credential of the request, or the source
+	// of a change that didn't come through the API.
+	Actor string `json:"actor"`
+	// Target is what it was done to, such as the path of an item.
+	Target     string `json:"target,omitempty"`
+	Outcome    string `json:"outcome"`
+	Status     int    `json:"status,omitempty"`
+	Method     string `json:"method,omitempty"`
+	RequestID  string `json:"request_id,omitempty"`
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	// Replica is the pod that served it.
+	Replica string `json:"replica"`
+	// Detail adds what the other fields don't tell.
+	Detail string `json:"detail,omitempty"`
+}
+
+// Log writes entries to a stream and keeps the last ones in memory. It is
+// safe for concurrent use.
+type Log struct {
+	replica string
+
+	mu      sync.Mutex
+	w       io.Writer
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// New returns a Log writing to w and keeping the last capacity entries.
+func New(w io.Writer, replica string, capacity int) *Log {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Log{w: w, replica: replica, entries: make([]Entry, capacity)}
+}
+
+// Record writes e, stamped with the time and replica when they're unset.
+func (l *Log) Record(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if e.Replica == "" {
+		e.Replica = l.replica
+	}
+	line, err := json.Marshal(struct {
+		Stream string `json:"stream"`
+		Entry
+	}{Stream, e})
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	l.full = l.full || l.next == 0
+	if err == nil {
+		_, err = l.w.Write(append(line, '\n'))
+	}
+	if err != nil {
+		log.Printf("Error writing audit entry %s by %s: %v", e.Action, e.Actor, err)
+	}
+}
+
+// Recent returns up to limit of the entries in memory that match, newest
+// first; a zero limit returns all of them.
+func (l *Log) Recent(limit int, match func(Entry) bool) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+	out := []Entry{}
+	for i := 0; i < n && (limit <= 0 || len(out) < limit); i++ {
+		e := l.entries[(l.next-1-i+len(l.entries))%len(l.entries)]
+		if match == nil || match(e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	var buf bytes.Buffer
+	l := New(&buf, "pod-1", 3)
+	for _, action := range []string{"pod.drain", "item.create", "item.delete", "pod.undrain"} {
+		l.Record(Entry{Action: action, Actor: "admin-token", Outcome: OutcomeSucceeded})
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("wrote %d lines, want 4", len(lines))
+	}
+	var first map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["stream"] != Stream || first["action"] != "pod.drain" || first["replica"] != "pod-1" || first["time"] == nil {
+		t.Errorf("first line = %s", lines[0])
+	}
+
+	// The oldest entry fell out; the rest come newest first.
+	var actions []string
+	for _, e := range l.Recent(0, nil) {
+		actions = append(actions, e.Action)
+	}
+	if got := strings.Join(actions, ","); got != "pod.undrain,item.delete,item.create" {
+		t.Errorf("Recent() = %s", got)
+	}
+	items := l.Recent(1, func(e Entry) bool { return strings.HasPrefix(e.Action, "item.") })
+	if len(items) != 1 || items[0].Action != "item.delete" {
+		t.Errorf("Recent(1, items) = %+v", items)
+	}
+}
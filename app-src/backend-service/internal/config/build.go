@@ -0,0 +1,82 @@
+package config
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Placeholders for build information nothing could provide.
+const (
+	unknownVersion = "dev"
+	unknown        = "unknown"
+)
+
+// ResolveBuildInfo completes the values injected via -ldflags with the
+// module and VCS information the go command embeds in the binary, so a
+// plain `go build` or `go run` from a checkout still reports which commit
+// it runs. Injected values win; empty ones are filled in.
+func ResolveBuildInfo(injected BuildInfo) BuildInfo {
+	info, _ := debug.ReadBuildInfo()
+	return resolveBuildInfo(injected, info)
+}
+
+func resolveBuildInfo(b BuildInfo, info *debug.BuildInfo) BuildInfo {
+	b.GoVersion = runtime.Version()
+	b.Platform = runtime.GOOS + "/" + runtime.GOARCH
+	if info != nil {
+		if info.GoVersion != "" {
+			b.GoVersion = info.GoVersion
+		}
+		b.ModulePath, b.ModuleVersion, b.ModuleSum = info.Main.Path, info.Main.Version, info.Main.Sum
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs":
+				b.VCS = s.Value
+			case "vcs.revision":
+				b.VCSRevision = s.Value
+			case "vcs.time":
+				b.VCSTime = s.Value
+			case "vcs.modified":
+				b.VCSModified = s.Value == "true"
+			}
+		}
+		// The dirty flag goes with the commit it describes.
+		if b.GitCommit == "" {
+			b.GitCommit, b.GitDirty = b.VCSRevision, b.VCSModified
+		}
+		// The binary doesn't record when it was built; the commit time is
+		// the closest the VCS information gets.
+		if b.BuildTime == "" {
+			b.BuildTime = b.VCSTime
+		}
+	}
+	if b.Version == "" {
+		switch {
+		case b.ModuleVersion != "" && b.ModuleVersion != "(devel)":
+			b.Version = b.ModuleVersion
+		case b.GitTag != "":
+			b.Version = b.GitTag
+		case b.VCSRevision != "":
+			b.Version = unknownVersion + "-" + shortRevision(b.VCSRevision)
+			if b.VCSModified {
+				b.Version += "-dirty"
+			}
+		default:
+			b.Version = unknownVersion
+		}
+	}
+	if b.BuildTime == "" {
+		b.BuildTime = unknown
+	}
+	if b.GitCommit == "" {
+		b.GitCommit = unknown
+	}
+	return b
+}
+
+func shortRevision(revision string) string {
+	if len(revision) > 12 {
+		return revision[:12]
+	}
+	return revision
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"runtime"
+	"runtime/debug"
+	"testing"
+)
+
+func TestResolveBuildInfo(t *testing.T) {
+	vcs := &debug.BuildInfo{
+		GoVersion: "go1.21.5",
+		Main:      debug.Module{Path: "example.com/backend", Version: "(devel)"},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "0123456789abcdef0123"},
+			{Key: "vcs.time", Value: "2024-05-01T10:00:00Z"},
+			{Key: "vcs.modified", Value: "true"},
+		},
+	}
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	fromVCS := BuildInfo{GoVersion: "go1.21.5", Platform: platform, ModulePath: "example.com/backend", ModuleVersion: "(devel)",
+		VCS: "git", VCSRevision: "0123456789abcdef0123", VCSTime: "2024-05-01T10:00:00Z", VCSModified: true}
+	with := func(b BuildInfo, f func(*BuildInfo)) BuildInfo {
+		f(&b)
+		return b
+	}
+	tests := []struct {
+		name     string
+		injected BuildInfo
+		info     *debug.BuildInfo
+		want     BuildInfo
+	}{
+		{
+			name:     "ldflags win",
+			injected: BuildInfo{Version: "v1.2.3", BuildTime: "2024-06-01T00:00:00Z", GitCommit: "abc", GitBranch: "main", BuildUser: "ci"},
+			info:     vcs,
+			want: with(fromVCS, func(b *BuildInfo) {
+				b.Version, b.BuildTime, b.GitCommit, b.GitBranch, b.BuildUser = "v1.2.3", "2024-06-01T00:00:00Z", "abc", "main", "ci"
+			}),
+		},
+		{
+			name: "VCS fallback",
+			info: vcs,
+			want: with(fromVCS, func(b *BuildInfo) {
+				b.Version, b.BuildTime, b.GitCommit, b.GitDirty = "dev-0123456789ab-dirty", "2024-05-01T10:00:00Z", "0123456789abcdef0123", true
+			}),
+		},
+		{
+			name:     "injected tag",
+			injected: BuildInfo{GitTag: "v1.2.4"},
+			want:     BuildInfo{Version: "v1.2.4", BuildTime: "unknown", GitCommit: "unknown", GitTag: "v1.2.4", GoVersion: runtime.Version(), Platform: platform},
+		},
+		{
+			name: "module version",
+			info: &debug.BuildInfo{GoVersion: "go1.21.5", Main: debug.Module{Path: "example.com/backend", Version: "v0.0.0-20240501100000-0123456789ab", Sum: "h1:abc="}},
+			want: BuildInfo{Version: "v0.0.0-20240501100000-0123456789ab", BuildTime: "unknown", GitCommit: "unknown", GoVersion: "go1.21.5",
+				Platform: platform, ModulePath: "example.com/backend", ModuleVersion: "v0.0.0-20240501100000-0123456789ab", ModuleSum: "h1:abc="},
+		},
+		{
+			name: "nothing known",
+			want: BuildInfo{Version: "dev", BuildTime: "unknown", GitCommit: "unknown", GoVersion: runtime.Version(), Platform: platform},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveBuildInfo(tt.injected, tt.info); got != tt.want {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
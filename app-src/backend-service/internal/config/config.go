@@ -0,0 +1,804 @@
+// Package config loads the service configuration from environment variables,
+// falling back on a YAML config file, and remembers every value it read,
+// with its source, so the effective configuration can be inspected at
+// runtime.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// BuildInfo identifies the running binary; it is injected via -ldflags, or
+// read from the binary by ResolveBuildInfo.
+type BuildInfo struct {
+	Version   string
+	BuildTime string
+	GitCommit string
+	// Branch and tag of the checkout, and whether it had uncommitted
+	// changes; the go command doesn't record branches and tags, so they
+	// are only known when injected
+	GitBranch string
+	GitTag    string
+	GitDirty  bool
+	BuildUser string
+
+	// Toolchain and platform of the binary
+	GoVersion string
+	Platform  string
+
+	// Main module of the binary; the sum is only recorded by
+	// `go install module@version`
+	ModulePath    string
+	ModuleVersion string
+	ModuleSum     string
+
+	// VCS information the go command embedded, empty for builds outside a
+	// checkout (such as the Docker build, whose context has no .git)
+	VCS         string
+	VCSRevision string
+	VCSTime     string
+	VCSModified bool
+}
+
+// Config is the complete service configuration.
+type Config struct {
+	Build BuildInfo
+
+	Port        string
+	ServiceName string
+	Environment string
+	Hostname    string
+
+	// AdminPort serves profiling, runtime diagnostics, probes and metrics
+	// off the public port; empty disables it
+	AdminPort string
+	// GRPCPort serves the Info, Version and Health APIs over gRPC, with
+	// the standard health service and reflection; empty disables it
+	GRPCPort string
+
+	// TLS: HTTPS is served when both files are set, on TLSPort next to
+	// plain HTTP on Port, or on Port itself when TLSPort is empty. The files
+	// are reloaded when they change.
+	TLSCertFile string
+	TLSKeyFile  string
+	TLSPort     string
+
+	// Logging: LogFormat is "text" or "json", LogLevel one of debug, info,
+	// warn or error
+	LogFormat string
+	LogLevel  string
+
+	// Pod identity from the downward API. PodName is empty outside a pod.
+	PodName       string
+	PodNamespace  string
+	PodUID        string
+	PodIP         string
+	NodeName      string
+	ContainerName string
+	// PodLabelsFile is a downward API volume file with the pod's labels,
+	// which unlike env vars follows label changes
+	PodLabelsFile string
+	// Track is the rollout track of the pod, like stable, canary, blue or
+	// green: TRACK, else COLOR, else its TrackLabel label.
+	Track      string
+	TrackLabel string
+
+	// Kubernetes API client
+	KubeContext string
+	KubeQPS     float64
+	KubeBurst   int
+
+	// Kubernetes-aware features
+	LeaderElectionEnabled     bool
+	LeaderElectionNamespace   string
+	LeaderElectionLeaseName   string
+	DeploymentWatchEnabled    bool
+	DeploymentName            string
+	SiblingServices           []string
+	EventsEnabled             bool
+	NodeTopologyEnabled       bool
+	DisruptionTrackingEnabled bool
+	ImageDriftEnabled         bool
+	ExpectedImageDigest       string
+	NodePressureEnabled       bool
+	NodePressureMode          string
+
+	// Partitioned Git repository polling
+	WorkPartitioningEnabled bool
+	WorkPartitionGroup      string
+	GitPollRepos            []string
+	GitPollInterval         time.Duration
+
+	// Feature flags
+	FeatureFlagsConfigMap string
+	FeatureFlagsDir       string
+
+	// Localized messages. InfoMessage replaces the welcome message of
+	// /api/info in every language when set. It and the welcome messages of
+	// the catalogs are Go templates, and InfoFields are name=template pairs
+	// added to /api/info, so overlays can word them per environment.
+	DefaultLanguage   string
+	MessageCatalogDir string
+	InfoMessage       string
+	InfoFields        []string
+
+	// Readiness gates
+	SidecarReadinessURLs             []string
+	VolumeCheckPaths                 []string
+	EphemeralStorageLimitBytes       int64
+	EphemeralStorageThresholdPercent int64
+	// Downstream endpoints checked by /readyz; failures only degrade
+	// readiness unless ReadinessDependenciesCritical is set
+	ReadinessDependencyURLs       []string
+	ReadinessDependenciesCritical bool
+
+	// Declared resources from resourceFieldRef env vars
+	CPURequestMillicores int64
+	CPULimitMillicores   int64
+	MemoryRequestBytes   int64
+	MemoryLimitBytes     int64
+
+	// Service registry
+	RegistryURL          string
+	RegistryToken        string
+	RegistryHeartbeat    time.Duration
+	RegistryAdvertiseURL string
+
+	// Background jobs and autoscaling signals
+	JobWorkers         int
+	JobQueueCapacity   int
+	ScalingRPSWindow   int
+	DelayMax           time.Duration
+	RequestTimeout     time.Duration
+	StartupDelay       time.Duration
+	StartupJitter      time.Duration
+	PrestopMinWait     time.Duration
+	PrestopTimeout     time.Duration
+	AdminToken         string
+	ConfigDumpPrefixes []string
+	// Glob patterns of further keys whose values /admin/config, /admin/env
+	// and the logs mask, like *_DSN, besides those naming a token, secret,
+	// password, credential, private or API key, which always are
+	RedactPatterns []string
+
+	// Caps of the simulated load endpoints, across running loads; zero
+	// disables them
+	LoadMaxMillicores  int64
+	LoadMaxMemoryBytes int64
+	LoadMaxDuration    time.Duration
+
+	// Uploads to /api/upload, stored as artifacts in UploadDir
+	UploadDir          string
+	UploadMaxBytes     int64
+	UploadMaxTotal     int64
+	UploadAllowedTypes []string
+
+	// Traffic recording for replay; a zero percentage disables it
+	RecordingSamplePercent int64
+	RecordingDir           string
+	RecordingMaxBodyBytes  int64
+	RecordingMaxBytes      int64
+
+	// Traffic shadowing to a candidate version; an empty target or a zero
+	// percentage disables it
+	ShadowTargetURL     string
+	ShadowSamplePercent int64
+	ShadowTimeout       time.Duration
+	ShadowMaxInFlight   int
+
+	// Tracing: sampled spans are exported to TracingEndpoint with OTLP/HTTP;
+	// without one, trace context is still propagated
+	TracingEndpoint      string
+	TracingServiceName   string
+	TracingSamplePercent int64
+
+	// Self-test clock check; an empty NTPServer skips it
+	NTPServer    string
+	MaxClockSkew time.Duration
+
+	// Middleware chains of the probe, API, browser, admin and webhook route
+	// groups, outermost first; empty means the built-in chain.
+	ProbeMiddleware   []string
+	APIMiddleware     []string
+	BrowserMiddleware []string
+	AdminMiddleware   []string
+	WebhookMiddleware []string
+
+	// Token-bucket rate limits of API requests in requests per second, for
+	// the whole service and per client IP; a zero rate disables its limit
+	RateLimitRPS         int64
+	RateLimitBurst       int64
+	RateLimitClientRPS   int64
+	RateLimitClientBurst int64
+	// Proxies, as addresses or CIDR ranges, whose X-Forwarded-For and
+	// X-Real-IP name the client of a request; the headers of anyone else
+	// are ignored
+	TrustedProxies []string
+
+	// CORS of the API for browser frontends on other origins; no origins
+	// disables it
+	CORSAllowedOrigins []string
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSMaxAge         time.Duration
+
+	// Gzip of API responses of the allowed content types from
+	// CompressionMinBytes up
+	CompressionMinBytes int64
+	CompressionTypes    []string
+
+	// GET responses of the routes named in ResponseCacheRoutes are kept in
+	// memory for ResponseCacheTTL; zero caches nothing. Every GET response
+	// gets an ETag either way.
+	ResponseCacheRoutes []string
+	ResponseCacheTTL    time.Duration
+
+	// Unversioned /api paths, kept as deprecated aliases of /api/v1 until
+	// APILegacySunset, a date such as 2027-01-31
+	APILegacyPaths  bool
+	APILegacySunset string
+
+	// Fault injection: ChaosLatencyPercent of API requests are delayed by
+	// ChaosLatency, and ChaosErrorPercent fail with a 500
+	ChaosLatency        time.Duration
+	ChaosLatencyPercent int64
+	ChaosErrorPercent   int64
+
+	// Outbound calls of /api/v1/call: the service called, the timeout of
+	// each attempt, retries and their initial backoff, the consecutive
+	// failures that open a host's circuit breaker and how long it stays open
+	DownstreamURL                 string
+	DownstreamTimeout             time.Duration
+	DownstreamRetries             int
+	DownstreamRetryBackoff        time.Duration
+	DownstreamBreakerFailures     int
+	DownstreamBreakerCooldown     time.Duration
+	DownstreamMaxIdleConnsPerHost int
+
+	// Services /api/v1/chain calls in order, with the same client
+	DownstreamChainURLs []string
+
+	// PostgreSQL database of /api/v1/items, with libpq's variable names;
+	// DatabaseHost empty keeps items in memory. DatabaseSSLMode is disable,
+	// require or verify-full.
+	DatabaseHost     string
+	DatabasePort     string
+	DatabaseUser     string
+	DatabasePassword string
+	DatabaseName     string
+	DatabaseSSLMode  string
+	DatabaseMaxConns int
+
+	// Redis caching /api/info and the items list; RedisAddr (host:port)
+	// empty disables the cache. Cached responses expire after RedisCacheTTL.
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
+	RedisCacheTTL time.Duration
+
+	// CloudEvents of API activity, published to NATS (nats://host:4222) or
+	// Kafka (kafka://host:9092,...) at EventBrokerURL; empty disables them.
+	// EventTopic is the Kafka topic, or the NATS subject prefix.
+	EventBrokerURL string
+	EventTopic     string
+
+	// Worker mode (`backend-service worker`) consumes the events as
+	// WorkerGroup, in batches of up to WorkerBatchSize, spending
+	// WorkerProcessingDelay on each to simulate slow processing.
+	WorkerGroup           string
+	WorkerBatchSize       int
+	WorkerProcessingDelay time.Duration
+
+	// Concurrent /ws/stats streams a replica serves; more are refused.
+	WebSocketMaxConnections int
+
+	// JWT bearer tokens required by the routes of chains with the "jwt"
+	// middleware, signed with one of the shared secrets of JWTSecret and
+	// JWTSecretFile (one per line) or a key of JWTJWKSURL; none disables
+	// it. Paths in JWTAllowlist, or below those ending in "/", need no
+	// token.
+	JWTSecret     string
+	JWTSecretFile string
+	JWTJWKSURL    string
+	JWTIssuer     string
+	JWTAudience   string
+	JWTAllowlist  []string
+	JWTLeeway     time.Duration
+
+	// API keys of the admin endpoints, one per line in AdminAPIKeyFile (a
+	// mounted Secret), accepted besides AdminToken. Keys removed from the
+	// file stay valid for AdminAPIKeyGrace, so clients can switch over.
+	AdminAPIKeyFile  string
+	AdminAPIKeyGrace time.Duration
+
+	// OpenID Connect login of the HTML status page: browsers are sent to
+	// the provider at OIDCIssuerURL and come back to OIDCRedirectURL.
+	// Sessions are kept in a cookie encrypted with OIDCCookieSecret, or the
+	// client secret when it's unset, and refreshed with the provider's
+	// refresh token until OIDCSessionMaxAge. An empty issuer disables it.
+	OIDCIssuerURL     string
+	OIDCClientID      string
+	OIDCClientSecret  string
+	OIDCRedirectURL   string
+	OIDCScopes        []string
+	OIDCCookieSecret  string
+	OIDCSessionMaxAge time.Duration
+
+	// Values of the security headers set on every response by the
+	// "headers" middleware; an empty value leaves its header out.
+	HSTS                  string
+	ContentTypeOptions    string
+	FrameOptions          string
+	ReferrerPolicy        string
+	ContentSecurityPolicy string
+
+	// Audit log of admin actions and mutations: JSON lines appended to
+	// AuditLogFile, or written to stdout when it's unset, and the last
+	// AuditLogEntries kept in memory for /admin/audit.
+	AuditLogFile    string
+	AuditLogEntries int
+
+	// Argo CD Application managing this service, reported at
+	// /api/v1/gitops/status. ArgoCDToken is the API token of an account
+	// allowed to get it. An empty URL disables the endpoint.
+	ArgoCDURL                string
+	ArgoCDToken              string
+	ArgoCDApplication        string
+	ArgoCDInsecureSkipVerify bool
+
+	// Secret of the HMAC signatures of the Flux and Argo CD notifications
+	// posted to /webhooks/gitops; empty disables the webhook. The last
+	// DeploymentEventsMax of them are served at /api/v1/deployments.
+	GitOpsWebhookSecret string
+	DeploymentEventsMax int
+
+	// Secret of the GitHub signatures, or the GitLab token, of the push and
+	// pull request webhooks posted to /webhooks/git; empty disables the
+	// webhook. Pushes to GitWebhookBranch are compared to the running commit.
+	GitWebhookSecret string
+	GitWebhookBranch string
+
+	// Headless Service whose addresses /api/v1/peers asks for their version,
+	// on PeersPort, else Port; empty disables it. The leader also polls them
+	// every PeersPollInterval for the serving versions metric.
+	PeersService      string
+	PeersPort         string
+	PeersPollInterval time.Duration
+
+	// Manifest in the GitOps repo, like the raw URL of an overlay's
+	// kustomization.yaml, polled every GitOpsDriftInterval for the tag of
+	// GitOpsImage, which /api/v1/gitops/drift compares with the running
+	// build; empty disables it. GitOpsManifestToken is the bearer token of
+	// private repos.
+	GitOpsManifestURL   string
+	GitOpsManifestToken string
+	GitOpsImage         string
+	GitOpsDriftInterval time.Duration
+
+	// Repository /api/v1/gitops/promote opens pull requests on, as owner/repo
+	// on GitHub or the project path on GitLab, with a token allowed to push
+	// branches; either empty disables it. The manifest of an environment is
+	// GitOpsPromotePath with {environment} replaced, and only
+	// GitOpsPromoteEnvironments can be promoted. GitOpsRepoAPIURL defaults
+	// to the API of github.com or gitlab.com.
+	GitOpsRepoProvider        string
+	GitOpsRepoAPIURL          string
+	GitOpsRepo                string
+	GitOpsRepoBranch          string
+	GitOpsPromoteToken        string
+	GitOpsPromotePath         string
+	GitOpsPromoteEnvironments []string
+}
+
+// DefaultContentSecurityPolicy allows the status page, whose styles are
+// inline, and nothing from other origins.
+const DefaultContentSecurityPolicy = "default-src 'self'; style-src 'self' 'unsafe-inline'; frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+
+// Load reads the configuration from the environment and the config file. It
+// fails when the file can't be read or Validate rejects the settings;
+// values that don't parse fall back to their defaults, and are reported by
+// Invalid.
+func Load() (Config, error) {
+	if err := loadFile(); err != nil {
+		return Config{}, err
+	}
+	hostname, _ := os.Hostname()
+	cfg := Config{
+		Port:        getEnv("PORT", "8080"),
+		AdminPort:   getEnv("ADMIN_PORT", "9090"),
+		GRPCPort:    getEnv("GRPC_PORT", "9000"),
+		ServiceName: getEnv("SERVICE_NAME", "backend-service"),
+		Environment: getEnv("ENVIRONMENT", "development"),
+		Hostname:    hostname,
+
+		TLSCertFile: getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:  getEnv("TLS_KEY_FILE", ""),
+		TLSPort:     getEnv("TLS_PORT", ""),
+
+		LogFormat: getEnv("LOG_FORMAT", "text"),
+		LogLevel:  getEnv("LOG_LEVEL", "info"),
+
+		PodName:       getEnv("POD_NAME", ""),
+		PodNamespace:  getEnv("POD_NAMESPACE", "default"),
+		PodUID:        getEnv("POD_UID", ""),
+		NodeName:      getEnv("NODE_NAME", ""),
+		PodLabelsFile: getEnv("POD_LABELS_FILE", "/etc/podinfo/labels"),
+		Track:         getEnv("TRACK", getEnv("COLOR", "")),
+		TrackLabel:    getEnv("TRACK_LABEL", "track"),
+
+		KubeContext: getEnv("KUBE_CONTEXT", ""),
+		KubeQPS:     float64(getEnvInt64("K8S_CLIENT_QPS", 5)),
+		KubeBurst:   int(getEnvInt64("K8S_CLIENT_BURST", 10)),
+
+		LeaderElectionEnabled:     getEnvBool("LEADER_ELECTION_ENABLED", false),
+		DeploymentWatchEnabled:    getEnvBool("DEPLOYMENT_WATCH_ENABLED", false),
+		DeploymentName:            getEnv("DEPLOYMENT_NAME", ""),
+		SiblingServices:           getEnvList("SIBLING_SERVICES"),
+		EventsEnabled:             getEnvBool("K8S_EVENTS_ENABLED", false),
+		NodeTopologyEnabled:       getEnvBool("NODE_TOPOLOGY_ENABLED", false),
+		DisruptionTrackingEnabled: getEnvBool("DISRUPTION_TRACKING_ENABLED", false),
+		ImageDriftEnabled:         getEnvBool("IMAGE_DRIFT_ENABLED", false),
+		ExpectedImageDigest:       getEnv("EXPECTED_IMAGE_DIGEST", ""),
+		NodePressureEnabled:       getEnvBool("NODE_PRESSURE_ENABLED", false),
+		NodePressureMode:          getEnv("NODE_PRESSURE_MODE", "degraded"),
+
+		WorkPartitioningEnabled: getEnvBool("WORK_PARTITIONING_ENABLED", false),
+		GitPollRepos:            getEnvList("GIT_POLL_REPOS"),
+		GitPollInterval:         getEnvSeconds("GIT_POLL_INTERVAL_SECONDS", 60),
+
+		FeatureFlagsConfigMap: getEnv("FEATURE_FLAGS_CONFIGMAP", ""),
+		FeatureFlagsDir:       getEnv("FEATURE_FLAGS_DIR", "/etc/backend-service/flags"),
+
+		DefaultLanguage:   getEnv("DEFAULT_LANGUAGE", "en"),
+		MessageCatalogDir: getEnv("MESSAGE_CATALOG_DIR", "/etc/backend-service/i18n"),
+		InfoMessage:       getEnv("INFO_MESSAGE", ""),
+		InfoFields:        getEnvList("INFO_FIELDS"),
+
+		SidecarReadinessURLs:             getEnvList("SIDECAR_READINESS_URLS"),
+		VolumeCheckPaths:                 getEnvList("VOLUME_CHECK_PATHS"),
+		EphemeralStorageLimitBytes:       getEnvInt64("EPHEMERAL_STORAGE_LIMIT_BYTES", 0),
+		EphemeralStorageThresholdPercent: getEnvInt64("EPHEMERAL_STORAGE_THRESHOLD_PERCENT", 90),
+		ReadinessDependencyURLs:          getEnvList("READINESS_DEPENDENCY_URLS"),
+		ReadinessDependenciesCritical:    getEnvBool("READINESS_DEPENDENCIES_CRITICAL", false),
+
+		CPURequestMillicores: getEnvInt64("CPU_REQUEST_MILLICORES", 0),
+		CPULimitMillicores:   getEnvInt64("CPU_LIMIT_MILLICORES", 0),
+		MemoryRequestBytes:   getEnvInt64("MEMORY_REQUEST_BYTES", 0),
+		MemoryLimitBytes:     getEnvInt64("MEMORY_LIMIT_BYTES", 0),
+
+		RegistryURL:       getEnv("SERVICE_REGISTRY_URL", ""),
+		RegistryToken:     getEnv("SERVICE_REGISTRY_TOKEN", ""),
+		RegistryHeartbeat: getEnvSeconds("SERVICE_REGISTRY_HEARTBEAT_SECONDS", 30),
+
+		JobWorkers:         int(getEnvInt64("JOB_WORKERS", 2)),
+		JobQueueCapacity:   int(getEnvInt64("JOB_QUEUE_CAPACITY", 1000)),
+		ScalingRPSWindow:   int(getEnvInt64("SCALING_RPS_WINDOW_SECONDS", 30)),
+		DelayMax:           getEnvSeconds("DELAY_MAX_SECONDS", 30),
+		RequestTimeout:     getEnvSeconds("REQUEST_TIMEOUT_SECONDS", 10),
+		StartupDelay:       getEnvSeconds("STARTUP_DELAY_SECONDS", 2),
+		StartupJitter:      getEnvSeconds("STARTUP_JITTER_SECONDS", 0),
+		PrestopMinWait:     getEnvSeconds("PRESTOP_MIN_WAIT_SECONDS", 5),
+		PrestopTimeout:     getEnvSeconds("PRESTOP_TIMEOUT_SECONDS", 20),
+		AdminToken:         getEnv("ADMIN_TOKEN", ""),
+		ConfigDumpPrefixes: getEnvList("CONFIG_DUMP_ENV_PREFIXES"),
+		RedactPatterns:     getEnvList("CONFIG_REDACT_PATTERNS"),
+
+		LoadMaxMillicores:  getEnvInt64("LOAD_MAX_MILLICORES", 2000),
+		LoadMaxMemoryBytes: getEnvInt64("LOAD_MAX_MEMORY_MB", 256) << 20,
+		LoadMaxDuration:    getEnvSeconds("LOAD_MAX_DURATION_SECONDS", 300),
+
+		UploadDir:          getEnv("UPLOAD_DIR", "/tmp/uploads"),
+		UploadMaxBytes:     getEnvInt64("UPLOAD_MAX_BYTES", 10<<20),
+		UploadMaxTotal:     getEnvInt64("UPLOAD_STORE_MAX_BYTES", 256<<20),
+		UploadAllowedTypes: getEnvList("UPLOAD_ALLOWED_TYPES"),
+
+		RecordingSamplePercent: getEnvInt64("RECORDING_SAMPLE_PERCENT", 0),
+		RecordingDir:           getEnv("RECORDING_DIR", "/tmp/recordings"),
+		RecordingMaxBodyBytes:  getEnvInt64("RECORDING_MAX_BODY_BYTES", 64<<10),
+		RecordingMaxBytes:      getEnvInt64("RECORDING_MAX_BYTES", 32<<20),
+
+		ShadowTargetURL:     getEnv("SHADOW_TARGET_URL", ""),
+		ShadowSamplePercent: getEnvInt64("SHADOW_SAMPLE_PERCENT", 0),
+		ShadowTimeout:       getEnvSeconds("SHADOW_TIMEOUT_SECONDS", 5),
+		ShadowMaxInFlight:   int(getEnvInt64("SHADOW_MAX_IN_FLIGHT", 50)),
+
+		TracingSamplePercent: getEnvInt64("TRACE_SAMPLE_PERCENT", 100),
+
+		NTPServer:    getEnv("NTP_SERVER", "pool.ntp.org"),
+		MaxClockSkew: time.Duration(getEnvInt64("MAX_CLOCK_SKEW_MS", 1000)) * time.Millisecond,
+
+		ProbeMiddleware:   getEnvList("MIDDLEWARE_PROBES"),
+		APIMiddleware:     getEnvList("MIDDLEWARE_API"),
+		BrowserMiddleware: getEnvList("MIDDLEWARE_BROWSER"),
+		AdminMiddleware:   getEnvList("MIDDLEWARE_ADMIN"),
+		WebhookMiddleware: getEnvList("MIDDLEWARE_WEBHOOKS"),
+
+		RateLimitRPS:         getEnvInt64("RATE_LIMIT_RPS", 0),
+		RateLimitBurst:       getEnvInt64("RATE_LIMIT_BURST", 50),
+		RateLimitClientRPS:   getEnvInt64("RATE_LIMIT_PER_CLIENT_RPS", 0),
+		RateLimitClientBurst: getEnvInt64("RATE_LIMIT_PER_CLIENT_BURST", 10),
+		TrustedProxies:       getEnvList("TRUSTED_PROXIES"),
+
+		CORSAllowedOrigins: getEnvList("CORS_ALLOWED_ORIGINS"),
+		CORSAllowedMethods: getEnvList("CORS_ALLOWED_METHODS"),
+		CORSAllowedHeaders: getEnvList("CORS_ALLOWED_HEADERS"),
+		CORSMaxAge:         getEnvSeconds("CORS_MAX_AGE_SECONDS", 600),
+
+		CompressionMinBytes: getEnvInt64("COMPRESSION_MIN_BYTES", 1024),
+		CompressionTypes:    getEnvList("COMPRESSION_CONTENT_TYPES"),
+
+		ResponseCacheRoutes: getEnvList("RESPONSE_CACHE_ROUTES"),
+		ResponseCacheTTL:    getEnvSeconds("RESPONSE_CACHE_TTL_SECONDS", 5),
+
+		APILegacyPaths:  getEnvBool("API_LEGACY_PATHS_ENABLED", true),
+		APILegacySunset: getEnv("API_LEGACY_SUNSET", ""),
+
+		ChaosLatency:        time.Duration(getEnvInt64("CHAOS_LATENCY_MS", 0)) * time.Millisecond,
+		ChaosLatencyPercent: getEnvInt64("CHAOS_LATENCY_PERCENT", 0),
+		ChaosErrorPercent:   getEnvInt64("CHAOS_ERROR_PERCENT", 0),
+
+		DownstreamURL:                 getEnv("DOWNSTREAM_URL", ""),
+		DownstreamTimeout:             getEnvSeconds("DOWNSTREAM_TIMEOUT_SECONDS", 5),
+		DownstreamRetries:             int(getEnvInt64("DOWNSTREAM_RETRIES", 2)),
+		DownstreamRetryBackoff:        time.Duration(getEnvInt64("DOWNSTREAM_RETRY_BACKOFF_MS", 100)) * time.Millisecond,
+		DownstreamBreakerFailures:     int(getEnvInt64("DOWNSTREAM_BREAKER_FAILURES", 5)),
+		DownstreamBreakerCooldown:     getEnvSeconds("DOWNSTREAM_BREAKER_COOLDOWN_SECONDS", 30),
+		DownstreamMaxIdleConnsPerHost: int(getEnvInt64("DOWNSTREAM_MAX_IDLE_CONNS_PER_HOST", 10)),
+
+		DownstreamChainURLs: getEnvList("DOWNSTREAM_CHAIN_URLS"),
+
+		DatabaseHost:     getEnv("PGHOST", ""),
+		DatabasePort:     getEnv("PGPORT", "5432"),
+		DatabaseUser:     getEnv("PGUSER", "backend"),
+		DatabasePassword: getEnv("PGPASSWORD", ""),
+		DatabaseName:     getEnv("PGDATABASE", "backend"),
+		DatabaseSSLMode:  getEnv("PGSSLMODE", "disable"),
+		DatabaseMaxConns: int(getEnvInt64("DATABASE_MAX_CONNS", 5)),
+
+		RedisAddr:     getEnv("REDIS_ADDR", ""),
+		RedisPassword: getEnv("REDIS_PASSWORD", ""),
+		RedisDB:       int(getEnvInt64("REDIS_DB", 0)),
+		RedisCacheTTL: getEnvSeconds("REDIS_CACHE_TTL_SECONDS", 30),
+
+		EventBrokerURL: getEnv("EVENT_BROKER_URL", ""),
+		EventTopic:     getEnv("EVENT_TOPIC", "gitops-demo.events"),
+
+		WorkerGroup:           getEnv("WORKER_GROUP", "backend-service-worker"),
+		WorkerBatchSize:       int(getEnvInt64("WORKER_BATCH_SIZE", 100)),
+		WorkerProcessingDelay: time.Duration(getEnvInt64("WORKER_PROCESSING_DELAY_MS", 0)) * time.Millisecond,
+
+		WebSocketMaxConnections: int(getEnvInt64("WS_MAX_CONNECTIONS", 100)),
+
+		JWTSecret:     getEnv("JWT_SECRET", ""),
+		JWTSecretFile: getEnv("JWT_SECRET_FILE", ""),
+		JWTJWKSURL:    getEnv("JWT_JWKS_URL", ""),
+		JWTIssuer:     getEnv("JWT_ISSUER", ""),
+		JWTAudience:   getEnv("JWT_AUDIENCE", ""),
+		JWTAllowlist:  getEnvList("JWT_ALLOWLIST"),
+		JWTLeeway:     getEnvSeconds("JWT_LEEWAY_SECONDS", 60),
+
+		AdminAPIKeyFile:  getEnv("ADMIN_API_KEY_FILE", ""),
+		AdminAPIKeyGrace: getEnvSeconds("ADMIN_API_KEY_GRACE_SECONDS", 300),
+
+		OIDCIssuerURL:     getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:      getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:  getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:   getEnv("OIDC_REDIRECT_URL", ""),
+		OIDCScopes:        getEnvList("OIDC_SCOPES"),
+		OIDCCookieSecret:  getEnv("OIDC_COOKIE_SECRET", ""),
+		OIDCSessionMaxAge: getEnvSeconds("OIDC_SESSION_MAX_AGE_SECONDS", 8*3600),
+
+		HSTS:                  getEnv("SECURITY_HSTS", ""),
+		ContentTypeOptions:    getEnv("SECURITY_CONTENT_TYPE_OPTIONS", "nosniff"),
+		FrameOptions:          getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+		ReferrerPolicy:        getEnv("SECURITY_REFERRER_POLICY", "strict-origin-when-cross-origin"),
+		ContentSecurityPolicy: getEnv("SECURITY_CSP", DefaultContentSecurityPolicy),
+
+		AuditLogFile:    getEnv("AUDIT_LOG_FILE", ""),
+		AuditLogEntries: int(getEnvInt64("AUDIT_LOG_ENTRIES", 1000)),
+
+		ArgoCDURL:                getEnv("ARGOCD_SERVER_URL", ""),
+		ArgoCDToken:              getEnv("ARGOCD_TOKEN", ""),
+		ArgoCDApplication:        getEnv("ARGOCD_APPLICATION", ""),
+		ArgoCDInsecureSkipVerify: getEnvBool("ARGOCD_INSECURE_SKIP_VERIFY", false),
+
+		GitOpsWebhookSecret: getEnv("GITOPS_WEBHOOK_SECRET", ""),
+		DeploymentEventsMax: int(getEnvInt64("DEPLOYMENT_EVENTS_MAX", 100)),
+
+		GitWebhookSecret: getEnv("GIT_WEBHOOK_SECRET", ""),
+		GitWebhookBranch: getEnv("GIT_WEBHOOK_BRANCH", "main"),
+
+		PeersService:      getEnv("PEERS_SERVICE", ""),
+		PeersPort:         getEnv("PEERS_PORT", ""),
+		PeersPollInterval: getEnvSeconds("PEERS_POLL_INTERVAL_SECONDS", 30),
+
+		GitOpsManifestURL:   getEnv("GITOPS_MANIFEST_URL", ""),
+		GitOpsManifestToken: getEnv("GITOPS_MANIFEST_TOKEN", ""),
+		GitOpsImage:         getEnv("GITOPS_IMAGE", "ghcr.io/anasadan/gitops-demo"),
+		GitOpsDriftInterval: getEnvSeconds("GITOPS_DRIFT_INTERVAL_SECONDS", 60),
+
+		GitOpsRepoProvider:        strings.ToLower(getEnv("GITOPS_REPO_PROVIDER", "github")),
+		GitOpsRepoAPIURL:          getEnv("GITOPS_REPO_API_URL", ""),
+		GitOpsRepo:                getEnv("GITOPS_REPO", ""),
+		GitOpsRepoBranch:          getEnv("GITOPS_REPO_BRANCH", "main"),
+		GitOpsPromoteToken:        getEnv("GITOPS_PROMOTE_TOKEN", ""),
+		GitOpsPromotePath:         getEnv("GITOPS_PROMOTE_PATH", "gitops-repo/overlays/{environment}/kustomization.yaml"),
+		GitOpsPromoteEnvironments: getEnvList("GITOPS_PROMOTE_ENVIRONMENTS"),
+	}
+
+	if len(cfg.UploadAllowedTypes) == 0 {
+		cfg.UploadAllowedTypes = []string{"image/png", "image/jpeg", "image/gif", "application/pdf", "text/plain", "application/json"}
+	}
+	if len(cfg.CompressionTypes) == 0 {
+		cfg.CompressionTypes = []string{"application/json", "application/problem+json"}
+	}
+	if len(cfg.ResponseCacheRoutes) == 0 {
+		cfg.ResponseCacheRoutes = []string{"info", "flags", "api-versions", "schemas", "schema", "openapi"}
+	}
+	if len(cfg.CORSAllowedMethods) == 0 {
+		cfg.CORSAllowedMethods = []string{"GET", "HEAD", "POST"}
+	}
+	if len(cfg.CORSAllowedHeaders) == 0 {
+		cfg.CORSAllowedHeaders = []string{"Content-Type", "Accept-Language", "Accept-Version", "X-Request-ID", "Authorization"}
+	}
+	if len(cfg.JWTAllowlist) == 0 {
+		cfg.JWTAllowlist = []string{"/health", "/healthz", "/ready", "/readyz", "/startupz", "/metrics"}
+	}
+	if len(cfg.GitOpsPromoteEnvironments) == 0 {
+		cfg.GitOpsPromoteEnvironments = []string{"dev", "staging", "production"}
+	}
+	if len(cfg.OIDCScopes) == 0 {
+		cfg.OIDCScopes = []string{"openid", "profile", "email", "offline_access"}
+	}
+
+	// Defaults derived from other settings.
+	cfg.PodIP = getEnv("POD_IP", cfg.Hostname)
+	cfg.ContainerName = getEnv("CONTAINER_NAME", cfg.ServiceName)
+	cfg.LeaderElectionNamespace = getEnv("LEADER_ELECTION_NAMESPACE", "")
+	cfg.LeaderElectionLeaseName = getEnv("LEADER_ELECTION_LEASE_NAME", cfg.ServiceName)
+	cfg.WorkPartitionGroup = getEnv("WORK_PARTITION_GROUP", cfg.ServiceName)
+	cfg.RegistryAdvertiseURL = getEnv("SERVICE_REGISTRY_ADVERTISE_URL", "")
+	cfg.TracingServiceName = getEnv("OTEL_SERVICE_NAME", cfg.ServiceName)
+	// The standard OpenTelemetry variables: a traces URL, or a base URL the
+	// traces path is appended to.
+	cfg.TracingEndpoint = getEnv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if base := getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""); cfg.TracingEndpoint == "" && base != "" {
+		cfg.TracingEndpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+	setRedactPatterns(cfg.RedactPatterns)
+	return cfg, nil
+}
+
+// Validate checks what Load can't default: required settings, the intervals
+// of enabled pollers and the keys of the config file. Startup and -dry-run
+// both run it.
+func (c Config) Validate() error {
+	var errs []error
+	for _, required := range []struct{ key, value string }{
+		{"PORT", c.Port},
+		{"SERVICE_NAME", c.ServiceName},
+		{"ENVIRONMENT", c.Environment},
+	} {
+		if strings.TrimSpace(required.value) == "" {
+			errs = append(errs, fmt.Errorf("%s is required", required.key))
+		}
+	}
+	if c.OIDCEnabled() {
+		for _, required := range []struct{ key, value string }{
+			{"OIDC_CLIENT_ID", c.OIDCClientID},
+			{"OIDC_REDIRECT_URL", c.OIDCRedirectURL},
+		} {
+			if strings.TrimSpace(required.value) == "" {
+				errs = append(errs, fmt.Errorf("%s is required when OIDC_ISSUER_URL is set", required.key))
+			}
+		}
+		if c.OIDCCookieSecret == "" && c.OIDCClientSecret == "" {
+			errs = append(errs, errors.New("OIDC_COOKIE_SECRET or OIDC_CLIENT_SECRET is required when OIDC_ISSUER_URL is set"))
+		}
+	}
+	// A poller of a zero interval would panic or spin
+	for _, interval := range []struct {
+		key, enabledBy string
+		enabled        bool
+		value          time.Duration
+	}{
+		{"GIT_POLL_INTERVAL_SECONDS", "GIT_POLL_REPOS", len(c.GitPollRepos) > 0, c.GitPollInterval},
+		{"SERVICE_REGISTRY_HEARTBEAT_SECONDS", "SERVICE_REGISTRY_URL", c.RegistryURL != "", c.RegistryHeartbeat},
+		{"PEERS_POLL_INTERVAL_SECONDS", "PEERS_SERVICE", c.PeersService != "", c.PeersPollInterval},
+		{"GITOPS_DRIFT_INTERVAL_SECONDS", "GITOPS_MANIFEST_URL", c.GitOpsManifestURL != "", c.GitOpsDriftInterval},
+	} {
+		if interval.enabled && interval.value <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive when %s is set, not %d",
+				interval.key, interval.enabledBy, int64(interval.value/time.Second)))
+		}
+	}
+	if c.ArgoCDURL != "" && strings.TrimSpace(c.ArgoCDApplication) == "" {
+		errs = append(errs, errors.New("ARGOCD_APPLICATION is required when ARGOCD_SERVER_URL is set"))
+	}
+	for _, p := range c.RedactPatterns {
+		if _, err := path.Match(p, ""); err != nil {
+			errs = append(errs, fmt.Errorf("CONFIG_REDACT_PATTERNS: %q isn't a glob pattern", p))
+		}
+	}
+	for _, p := range c.TrustedProxies {
+		if _, err := parseProxy(p); err != nil {
+			errs = append(errs, fmt.Errorf("TRUSTED_PROXIES: %q isn't an address or CIDR range", p))
+		}
+	}
+	if c.GitOpsRepoProvider != "github" && c.GitOpsRepoProvider != "gitlab" {
+		errs = append(errs, fmt.Errorf("GITOPS_REPO_PROVIDER must be github or gitlab, not %q", c.GitOpsRepoProvider))
+	}
+	if c.GitOpsManifestURL != "" && strings.TrimSpace(c.GitOpsImage) == "" {
+		errs = append(errs, errors.New("GITOPS_IMAGE is required when GITOPS_MANIFEST_URL is set"))
+	}
+	for _, key := range unknownFileKeys() {
+		errs = append(errs, fmt.Errorf("config file %s: unknown setting %s", File(), key))
+	}
+	return errors.Join(errs...)
+}
+
+// Identity names this replica: the pod name in a cluster, the hostname
+// outside.
+func (c Config) Identity() string {
+	if c.PodName != "" {
+		return c.PodName
+	}
+	return c.Hostname
+}
+
+// TLSEnabled reports whether HTTPS is served.
+func (c Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// JWTEnabled reports whether API requests need a bearer token.
+func (c Config) JWTEnabled() bool {
+	return c.JWTSecret != "" || c.JWTSecretFile != "" || c.JWTJWKSURL != ""
+}
+
+// OIDCEnabled reports whether the status page needs an OpenID Connect
+// login.
+func (c Config) OIDCEnabled() bool {
+	return c.OIDCIssuerURL != ""
+}
+
+// TrustedProxyPrefixes returns the ranges of TrustedProxies.
+func (c Config) TrustedProxyPrefixes() []netip.Prefix {
+	var prefixes []netip.Prefix
+	for _, p := range c.TrustedProxies {
+		if prefix, err := parseProxy(p); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+// parseProxy parses a CIDR range, or an address as the range of itself.
+func parseProxy(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// KubeRequired reports whether an enabled feature can't work without the
+// Kubernetes API.
+func (c Config) KubeRequired() bool {
+	return c.LeaderElectionEnabled || c.DeploymentWatchEnabled || len(c.SiblingServices) > 0 ||
+		c.EventsEnabled || c.NodeTopologyEnabled || c.DisruptionTrackingEnabled || c.ImageDriftEnabled ||
+		c.WorkPartitioningEnabled || c.NodePressureEnabled
+}
@@ -0,0 +1,222 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Redacted replaces secret values in Entries.
+const Redacted = "********"
+
+// secretKey matches configuration keys whose values must never be shown.
+var secretKey = regexp.MustCompile(`(?i)(TOKEN|SECRET|PASSWORD|PASSWD|CREDENTIAL|PRIVATE|API_?KEY)`)
+
+// redactPatterns are the glob patterns of CONFIG_REDACT_PATTERNS, in upper
+// case, matching further keys to mask. They are set by Load and read while
+// loaded is locked, so they have their own lock.
+var redactPatterns atomic.Pointer[[]string]
+
+// Entry is one configuration value as loaded.
+type Entry struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Source  string `json:"source"`
+	Default string `json:"default,omitempty"`
+}
+
+// Sources of configuration values.
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDefault = "default"
+)
+
+// loaded records every value read through the getEnv helpers, together with
+// whether it came from the environment, the config file or the built-in
+// default.
+var loaded = struct {
+	sync.Mutex
+	entries  map[string]Entry
+	invalid  map[string]string
+	file     map[string]string
+	fileName string
+	loadedAt time.Time
+}{entries: make(map[string]Entry), invalid: make(map[string]string)}
+
+// lookup returns the value of key from the environment, which overrides the
+// config file, and its source.
+func lookup(key string) (value, source string, ok bool) {
+	if value, ok := os.LookupEnv(key); ok {
+		return value, SourceEnv, true
+	}
+	loaded.Lock()
+	defer loaded.Unlock()
+	if value, ok := loaded.file[key]; ok {
+		return value, SourceFile, true
+	}
+	return "", SourceDefault, false
+}
+
+func record(key, value, defaultValue, source string) {
+	entry := Entry{Key: key, Value: value, Source: source}
+	if source != SourceDefault {
+		entry.Default = defaultValue
+	}
+	loaded.Lock()
+	defer loaded.Unlock()
+	loaded.entries[key] = entry
+	if source != SourceDefault {
+		delete(loaded.invalid, key)
+	}
+	if loaded.loadedAt.IsZero() {
+		loaded.loadedAt = time.Now()
+	}
+}
+
+// Entries returns the loaded configuration sorted by key, with secrets
+// redacted.
+func Entries() []Entry {
+	loaded.Lock()
+	defer loaded.Unlock()
+	entries := make([]Entry, 0, len(loaded.entries))
+	for _, entry := range loaded.entries {
+		entry.Value = Redact(entry.Key, entry.Value)
+		entry.Default = Redact(entry.Key, entry.Default)
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+	return entries
+}
+
+// invalid records a value that didn't parse and was replaced by its default.
+func invalid(key, problem string) {
+	log.Printf("%s", problem)
+	loaded.Lock()
+	defer loaded.Unlock()
+	loaded.invalid[key] = problem
+}
+
+// Invalid returns the values that didn't parse, sorted by key. The service
+// starts with their defaults anyway; a dry run reports them as errors.
+func Invalid() []string {
+	loaded.Lock()
+	defer loaded.Unlock()
+	keys := make([]string, 0, len(loaded.invalid))
+	for key := range loaded.invalid {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	problems := make([]string, len(keys))
+	for i, key := range keys {
+		problems[i] = loaded.invalid[key]
+	}
+	return problems
+}
+
+// LoadedAt is when the configuration was first read.
+func LoadedAt() time.Time {
+	loaded.Lock()
+	defer loaded.Unlock()
+	return loaded.loadedAt
+}
+
+// setRedactPatterns replaces the patterns of CONFIG_REDACT_PATTERNS.
+func setRedactPatterns(patterns []string) {
+	upper := make([]string, len(patterns))
+	for i, p := range patterns {
+		upper[i] = strings.ToUpper(p)
+	}
+	redactPatterns.Store(&upper)
+}
+
+// IsSecret reports whether the value of key is masked: its name suggests a
+// credential, or it matches a pattern of CONFIG_REDACT_PATTERNS.
+func IsSecret(key string) bool {
+	if secretKey.MatchString(key) {
+		return true
+	}
+	if patterns := redactPatterns.Load(); patterns != nil {
+		key = strings.ToUpper(key)
+		for _, p := range *patterns {
+			if ok, _ := path.Match(p, key); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Redact masks secret values and the credentials of URLs.
+func Redact(key, value string) string {
+	if value == "" {
+		return value
+	}
+	if IsSecret(key) {
+		return Redacted
+	}
+	if u, err := url.Parse(value); err == nil && u.User != nil {
+		u.User = nil
+		return strings.Replace(u.String(), "://", "://"+Redacted+"@", 1)
+	}
+	return value
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, source, exists := lookup(key); exists {
+		record(key, value, defaultValue, source)
+		return value
+	}
+	record(key, defaultValue, defaultValue, SourceDefault)
+	return defaultValue
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	raw, source, _ := lookup(key)
+	record(key, raw, "", source)
+	var values []string
+	for _, v := range strings.Split(raw, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+func getEnvInt64(key string, defaultValue int64) int64 {
+	if value, source, exists := lookup(key); exists {
+		if parsed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			record(key, value, strconv.FormatInt(defaultValue, 10), source)
+			return parsed
+		}
+		invalid(key, fmt.Sprintf("Invalid integer for %s: %q, using default %d", key, value, defaultValue))
+	}
+	record(key, strconv.FormatInt(defaultValue, 10), "", SourceDefault)
+	return defaultValue
+}
+
+func getEnvSeconds(key string, defaultSeconds int64) time.Duration {
+	return time.Duration(getEnvInt64(key, defaultSeconds)) * time.Second
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value, source, exists := lookup(key); exists {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			record(key, strconv.FormatBool(parsed), strconv.FormatBool(defaultValue), source)
+			return parsed
+		}
+		invalid(key, fmt.Sprintf("Invalid boolean for %s: %q, using default %t", key, value, defaultValue))
+	}
+	record(key, strconv.FormatBool(defaultValue), "", SourceDefault)
+	return defaultValue
+}
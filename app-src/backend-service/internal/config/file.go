@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is where the ConfigMap with the config file is mounted. It is
+// optional; CONFIG_FILE names another one, which then must exist.
+const DefaultFile = "/etc/backend-service/config.yaml"
+
+// readFile parses a config file: a flat mapping of the environment variable
+// names, in upper or lower case, to scalars or lists of scalars. Lists are
+// read like comma-separated variables.
+//
+//	log_level: debug
+//	sibling_services: [orders, payments]
+func readFile(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]any
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", name, err)
+	}
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		upper := strings.ToUpper(key)
+		if _, dup := values[upper]; dup {
+			return nil, fmt.Errorf("%s: %s is set twice", name, upper)
+		}
+		switch value := value.(type) {
+		case nil:
+			values[upper] = ""
+		case []any:
+			items := make([]string, len(value))
+			for i, item := range value {
+				if !isScalar(item) {
+					return nil, fmt.Errorf("%s: %s must be a list of scalars", name, key)
+				}
+				items[i] = fmt.Sprint(item)
+			}
+			values[upper] = strings.Join(items, ",")
+		default:
+			if !isScalar(value) {
+				return nil, fmt.Errorf("%s: %s must be a scalar or a list", name, key)
+			}
+			values[upper] = fmt.Sprint(value)
+		}
+	}
+	return values, nil
+}
+
+func isScalar(v any) bool {
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return true
+	}
+	return false
+}
+
+// loadFile reads the config file for the getEnv helpers to fall back on.
+// The default file may be absent; a file named by CONFIG_FILE may not.
+func loadFile() error {
+	name, explicit := os.LookupEnv("CONFIG_FILE")
+	if !explicit {
+		name = DefaultFile
+	}
+	loaded.Lock()
+	loaded.file, loaded.fileName = nil, ""
+	loaded.Unlock()
+	if name == "" {
+		return nil
+	}
+	values, err := readFile(name)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	loaded.Lock()
+	loaded.file, loaded.fileName = values, name
+	loaded.Unlock()
+	return nil
+}
+
+// unknownFileKeys returns the keys of the config file that no setting read,
+// typically typos that would otherwise be ignored.
+func unknownFileKeys() []string {
+	loaded.Lock()
+	defer loaded.Unlock()
+	var unknown []string
+	for key := range loaded.file {
+		if _, ok := loaded.entries[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// File is the config file the configuration was read from, or empty.
+func File() string {
+	loaded.Lock()
+	defer loaded.Unlock()
+	return loaded.fileName
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadFile(t *testing.T) {
+	t.Setenv("CONFIG_FILE", writeFile(t, `
+log_level: debug
+JOB_WORKERS: 4
+leader_election_enabled: true
+sibling_services: [orders, payments]
+service_name: from-file
+`))
+	t.Setenv("SERVICE_NAME", "from-env")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.LogLevel != "debug" || cfg.JobWorkers != 4 || !cfg.LeaderElectionEnabled ||
+		!reflect.DeepEqual(cfg.SiblingServices, []string{"orders", "payments"}) {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.ServiceName != "from-env" {
+		t.Errorf("ServiceName = %q, want the environment to override the file", cfg.ServiceName)
+	}
+	sources := map[string]string{}
+	for _, e := range Entries() {
+		sources[e.Key] = e.Source
+	}
+	if sources["LOG_LEVEL"] != SourceFile || sources["SERVICE_NAME"] != SourceEnv || sources["PORT"] != SourceDefault {
+		t.Errorf("sources = %v", sources)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name, content, want string
+	}{
+		{"syntax", "port: [8080", "parsing"},
+		{"unknown key", "log_levle: debug", "unknown setting LOG_LEVLE"},
+		{"nested", "tracing:\n  endpoint: x", "must be a scalar or a list"},
+		{"duplicate", "port: 1\nPORT: 2", "PORT is set twice"},
+		{"required", "service_name: ''", "SERVICE_NAME is required"},
+		{"git poll interval", "git_poll_repos: [https://github.com/org/repo]\ngit_poll_interval_seconds: 0",
+			"GIT_POLL_INTERVAL_SECONDS must be positive"},
+		{"registry heartbeat", "service_registry_url: https://registry.example.com\nservice_registry_heartbeat_seconds: 0",
+			"SERVICE_REGISTRY_HEARTBEAT_SECONDS must be positive"},
+		{"peers poll interval", "peers_service: backend-service-peers\npeers_poll_interval_seconds: -5",
+			"PEERS_POLL_INTERVAL_SECONDS must be positive"},
+		{"drift interval", "gitops_manifest_url: https://example.com/kustomization.yaml\ngitops_drift_interval_seconds: 0",
+			"GITOPS_DRIFT_INTERVAL_SECONDS must be positive"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", writeFile(t, tt.content))
+			if _, err := Load(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Load() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "absent.yaml"))
+		if _, err := Load(); err == nil {
+			t.Error("a missing CONFIG_FILE was accepted")
+		}
+	})
+}
+
+func TestRedactPatterns(t *testing.T) {
+	t.Cleanup(func() { setRedactPatterns(nil) })
+	t.Setenv("CONFIG_REDACT_PATTERNS", "*_DSN,internal_*")
+	if _, err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{
+		"ADMIN_TOKEN":     true,
+		"SENTRY_DSN":      true,
+		"sentry_dsn":      true,
+		"INTERNAL_SALT":   true,
+		"DSN_HOST":        false,
+		"SERVICE_NAME":    false,
+		"DATABASE_SECRET": true,
+	} {
+		if got := IsSecret(key); got != want {
+			t.Errorf("IsSecret(%s) = %t, want %t", key, got, want)
+		}
+	}
+
+	t.Setenv("CONFIG_REDACT_PATTERNS", "*_DSN,[")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "CONFIG_REDACT_PATTERNS") {
+		t.Errorf("Load() with a malformed pattern = %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// FuzzLoad sets malformed values for typed settings; Load must fall back to
+// the defaults instead of failing, unless a required setting is blank.
+func FuzzLoad(f *testing.F) {
+	for _, seed := range []string{"", "10", "-1", "true", "yes", "1e3", "0x10", " 5", "9223372036854775808", ",,a,,b,"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, value string) {
+		if strings.ContainsRune(value, 0) {
+			t.Skip("environment values can't contain NUL")
+		}
+		for _, key := range []string{"K8S_CLIENT_QPS", "JOB_WORKERS", "DELAY_MAX_SECONDS", "LEADER_ELECTION_ENABLED", "GIT_POLL_REPOS", "PORT"} {
+			t.Setenv(key, value)
+		}
+		cfg, err := Load()
+		if blank := strings.TrimSpace(value) == ""; (err != nil) != blank {
+			t.Fatalf("Load() with PORT %q: %v", value, err)
+		}
+		if cfg.Port != value {
+			t.Errorf("Port = %q, want %q", cfg.Port, value)
+		}
+		for _, repo := range cfg.GitPollRepos {
+			if repo == "" || repo != strings.TrimSpace(repo) {
+				t.Errorf("GitPollRepos contains %q", repo)
+			}
+		}
+	})
+}
+
+// FuzzRedact checks secrets never survive redaction.
+func FuzzRedact(f *testing.F) {
+	f.Add("DATABASE_URL", "postgres://user:hunter2@db:5432/app")
+	f.Add("ADMIN_TOKEN", "hunter2")
+	f.Add("PLAIN", "https://example.com/path?q=1")
+	f.Add("URL", "://:@")
+	f.Fuzz(func(t *testing.T, key, value string) {
+		redacted := Redact(key, value)
+		if secretKey.MatchString(key) && value != "" && redacted != Redacted {
+			t.Errorf("Redact(%q, %q) = %q, want %q", key, value, redacted, Redacted)
+		}
+		if u, err := url.Parse(value); err == nil && u.User != nil && !secretKey.MatchString(key) {
+			r, err := url.Parse(redacted)
+			if err != nil {
+				t.Fatalf("Redact(%q, %q) = %q, which no longer parses: %v", key, value, redacted, err)
+			}
+			if _, hasPassword := r.User.Password(); r.User != nil && (r.User.Username() != Redacted || hasPassword) {
+				t.Errorf("Redact(%q, %q) = %q still contains credentials", key, value, redacted)
+			}
+		}
+	})
+}
@@ -0,0 +1,340 @@
+// Package downstream calls other services over HTTP the way a production
+// service should: over pooled connections, with a timeout per attempt,
+// retries with exponential backoff for idempotent requests, and a circuit
+// breaker per host that fails fast while a dependency is down instead of
+// piling up requests on it.
+package downstream
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBodyBytes bounds the response body read from a downstream service.
+const maxBodyBytes = 1 << 20
+
+// Outcomes of an attempt, as passed to Client.OnAttempt.
+const (
+	OutcomeOK          = "ok"
+	OutcomeServerError = "server_error"
+	OutcomeError       = "error"
+	OutcomeRejected    = "rejected"
+)
+
+// Config tunes a Client.
+type Config struct {
+	// Timeout of each attempt, including reading the body
+	Timeout time.Duration
+	// Attempts after the first for idempotent requests that fail
+	Retries int
+	// Wait before the first retry, doubled for each one after it
+	Backoff time.Duration
+	// Consecutive failures that open a host's breaker; 0 disables breakers
+	BreakerFailures int
+	// How long an open breaker rejects requests before letting one through
+	BreakerCooldown time.Duration
+	// Idle keep-alive connections kept per host
+	MaxIdleConnsPerHost int
+}
+
+// Request is a request to a downstream service.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+	Body   []byte
+}
+
+// Result is the last response of a call, with the attempts it took.
+type Result struct {
+	Status    int
+	Header    http.Header
+	Body      []byte
+	Truncated bool
+	Attempts  int
+	Duration  time.Duration
+}
+
+// OpenError is returned without calling a host whose breaker is open.
+type OpenError struct {
+	Host       string
+	RetryAfter time.Duration
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open", e.Host)
+}
+
+// Client calls downstream services. It's safe for concurrent use.
+type Client struct {
+	cfg  Config
+	http *http.Client
+	now  func() time.Time
+
+	// OnAttempt, if set, is called after every attempt with its outcome.
+	OnAttempt func(host, outcome string, d time.Duration)
+	// OnStateChange, if set, is called when a host's breaker changes state.
+	OnStateChange func(host string, from, to State)
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// New returns a client with its own connection pool. wrap, if not nil,
+// wraps the pooled transport, e.g. to propagate request IDs and traces.
+func New(cfg Config, wrap func(http.RoundTripper) http.RoundTripper) *Client {
+	var transport http.RoundTripper = &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   max(cfg.MaxIdleConnsPerHost, 1),
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if wrap != nil {
+		transport = wrap(transport)
+	}
+	return &Client{
+		cfg:      cfg,
+		http:     &http.Client{Transport: transport},
+		now:      time.Now,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+// Do sends req, retrying idempotent requests that fail with an error or a
+// 5xx status. A Result is returned whenever the service answered, even
+// with a 5xx after the last retry; the error is an *OpenError when the
+// host's breaker rejected the call.
+func (c *Client) Do(ctx context.Context, req Request) (Result, error) {
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	httpReq, err := http.NewRequest(method, req.URL, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	host := httpReq.URL.Host
+	retries := 0
+	if idempotent(method) {
+		retries = c.cfg.Retries
+	}
+
+	start := c.now()
+	var res Result
+	for attempt := 1; ; attempt++ {
+		if wait, ok := c.allow(host); !ok {
+			c.observe(host, OutcomeRejected, 0)
+			res.Duration = c.now().Sub(start)
+			return res, &OpenError{Host: host, RetryAfter: wait}
+		}
+		attemptStart := c.now()
+		var last Result
+		last, err = c.once(ctx, httpReq, req)
+		last.Attempts = attempt
+		outcome := OutcomeOK
+		switch {
+		case err != nil:
+			outcome = OutcomeError
+		case last.Status >= 500:
+			outcome = OutcomeServerError
+		}
+		if err == nil {
+			res = last
+		}
+		res.Attempts = attempt
+		c.observe(host, outcome, c.now().Sub(attemptStart))
+		c.record(host, outcome == OutcomeOK)
+
+		if outcome == OutcomeOK || attempt > retries || ctx.Err() != nil {
+			break
+		}
+		// Exponential backoff with up to 50% jitter, so clients that failed
+		// together don't retry together.
+		backoff := c.cfg.Backoff << (attempt - 1)
+		if backoff > 0 {
+			backoff += time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			res.Duration = c.now().Sub(start)
+			return res, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	res.Duration = c.now().Sub(start)
+	if res.Status == 0 {
+		return res, err
+	}
+	return res, nil
+}
+
+func (c *Client) once(ctx context.Context, httpReq *http.Request, req Request) (Result, error) {
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+	r := httpReq.Clone(ctx)
+	if req.Header != nil {
+		r.Header = req.Header.Clone()
+	}
+	if req.Body != nil {
+		r.Body = io.NopCloser(bytes.NewReader(req.Body))
+		r.ContentLength = int64(len(req.Body))
+	}
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes+1))
+	if err != nil {
+		return Result{}, err
+	}
+	res := Result{Status: resp.StatusCode, Header: resp.Header, Body: body}
+	if len(body) > maxBodyBytes {
+		res.Body, res.Truncated = body[:maxBodyBytes], true
+	}
+	return res, nil
+}
+
+func (c *Client) observe(host, outcome string, d time.Duration) {
+	if c.OnAttempt != nil {
+		c.OnAttempt(host, outcome, d)
+	}
+}
+
+// idempotent reports whether a request with method can be sent again.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// State is the state of a host's circuit breaker.
+type State string
+
+const (
+	// StateClosed lets every request through.
+	StateClosed State = "closed"
+	// StateOpen rejects requests until the cooldown has passed.
+	StateOpen State = "open"
+	// StateHalfOpen lets one probe through; it closes the breaker on
+	// success and opens it again on failure.
+	StateHalfOpen State = "half-open"
+)
+
+type breaker struct {
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// State returns the state of host's breaker.
+func (c *Client) State(host string) State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if b, ok := c.breakers[host]; ok {
+		return b.state
+	}
+	return StateClosed
+}
+
+// States returns the state of every host's breaker that has been used.
+func (c *Client) States() map[string]State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	states := make(map[string]State, len(c.breakers))
+	for host, b := range c.breakers {
+		states[host] = b.state
+	}
+	return states
+}
+
+// allow reports whether a request to host may be sent, and if not, how
+// long until the breaker lets a probe through.
+func (c *Client) allow(host string) (time.Duration, bool) {
+	if c.cfg.BreakerFailures <= 0 {
+		return 0, true
+	}
+	c.mu.Lock()
+	b := c.breakerLocked(host)
+	var from State
+	switch b.state {
+	case StateOpen:
+		wait := c.cfg.BreakerCooldown - c.now().Sub(b.openedAt)
+		if wait > 0 {
+			c.mu.Unlock()
+			return wait, false
+		}
+		from, b.state, b.probing = b.state, StateHalfOpen, true
+	case StateHalfOpen:
+		if b.probing {
+			c.mu.Unlock()
+			return c.cfg.BreakerCooldown, false
+		}
+		b.probing = true
+	}
+	c.mu.Unlock()
+	if from != "" {
+		c.changed(host, from, StateHalfOpen)
+	}
+	return 0, true
+}
+
+// record counts the outcome of an attempt against host's breaker.
+func (c *Client) record(host string, ok bool) {
+	if c.cfg.BreakerFailures <= 0 {
+		return
+	}
+	c.mu.Lock()
+	b := c.breakerLocked(host)
+	from := b.state
+	b.probing = false
+	switch {
+	case ok:
+		b.state, b.failures = StateClosed, 0
+	case b.state == StateHalfOpen:
+		b.state, b.openedAt = StateOpen, c.now()
+	default:
+		b.failures++
+		if b.failures >= c.cfg.BreakerFailures && b.state == StateClosed {
+			b.state, b.openedAt = StateOpen, c.now()
+		}
+	}
+	to := b.state
+	c.mu.Unlock()
+	if from != to {
+		c.changed(host, from, to)
+	}
+}
+
+func (c *Client) breakerLocked(host string) *breaker {
+	b, ok := c.breakers[host]
+	if !ok {
+		b = &breaker{state: StateClosed}
+		c.breakers[host] = b
+	}
+	return b
+}
+
+func (c *Client) changed(host string, from, to State) {
+	if c.OnStateChange != nil {
+		c.OnStateChange(host, from, to)
+	}
+}
@@ -0,0 +1,118 @@
+package downstream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flaky answers with the status codes of fail, in turn, then 200.
+func flaky(t *testing.T, fail ...int) (*httptest.Server, *atomic.Int64) {
+	t.Helper()
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if int(n) <= len(fail) {
+			w.WriteHeader(fail[n-1])
+			return
+		}
+		w.Write([]byte(`{"ok":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestRetries(t *testing.T) {
+	srv, calls := flaky(t, http.StatusBadGateway, http.StatusServiceUnavailable)
+	c := New(Config{Retries: 2, Backoff: time.Millisecond}, nil)
+	var outcomes []string
+	c.OnAttempt = func(_, outcome string, _ time.Duration) { outcomes = append(outcomes, outcome) }
+
+	res, err := c.Do(context.Background(), Request{URL: srv.URL})
+	if err != nil || res.Status != http.StatusOK || res.Attempts != 3 || string(res.Body) != `{"ok":true}` {
+		t.Fatalf("Do = %+v, %v; want 200 after 3 attempts", res, err)
+	}
+	if len(outcomes) != 3 || outcomes[0] != OutcomeServerError || outcomes[2] != OutcomeOK {
+		t.Errorf("outcomes = %v", outcomes)
+	}
+
+	// Requests that aren't idempotent are sent once.
+	srv, calls = flaky(t, http.StatusInternalServerError)
+	res, err = c.Do(context.Background(), Request{Method: http.MethodPost, URL: srv.URL, Body: []byte("{}")})
+	if err != nil || res.Status != http.StatusInternalServerError || calls.Load() != 1 {
+		t.Errorf("POST = %+v, %v after %d calls; want the 500, sent once", res, err, calls.Load())
+	}
+
+	// Errors without a response are returned after the last retry.
+	srv.Close()
+	if _, err := c.Do(context.Background(), Request{URL: srv.URL}); err == nil {
+		t.Error("Do to a closed server succeeded")
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	srv, calls := flaky(t, 500, 500, 500, 500)
+	host := mustHost(t, srv.URL)
+	now := time.Unix(1700000000, 0)
+	c := New(Config{BreakerFailures: 2, BreakerCooldown: 10 * time.Second}, nil)
+	c.now = func() time.Time { return now }
+	var changes []State
+	c.OnStateChange = func(_ string, _, to State) { changes = append(changes, to) }
+	call := func() (Result, error) { return c.Do(context.Background(), Request{URL: srv.URL}) }
+
+	// Consecutive failures open the breaker, which then fails fast.
+	call()
+	call()
+	_, err := call()
+	var open *OpenError
+	if !errors.As(err, &open) || open.RetryAfter != 10*time.Second || calls.Load() != 2 {
+		t.Fatalf("call with the breaker open = %v after %d calls; want an OpenError without a call", err, calls.Load())
+	}
+	if c.State(host) != StateOpen {
+		t.Errorf("state = %s, want open", c.State(host))
+	}
+
+	// After the cooldown one probe goes through; its failure opens the
+	// breaker again.
+	now = now.Add(10 * time.Second)
+	if res, err := call(); err != nil || res.Status != 500 {
+		t.Errorf("probe = %+v, %v; want the 500", res, err)
+	}
+	if _, err := call(); !errors.As(err, &open) {
+		t.Errorf("call after a failed probe = %v, want an OpenError", err)
+	}
+
+	// A successful probe closes it.
+	now = now.Add(10 * time.Second)
+	call() // the last 500
+	now = now.Add(10 * time.Second)
+	if res, err := call(); err != nil || res.Status != 200 {
+		t.Fatalf("probe = %+v, %v; want 200", res, err)
+	}
+	want := []State{StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateOpen, StateHalfOpen, StateClosed}
+	if len(changes) != len(want) {
+		t.Fatalf("state changes = %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("state changes = %v, want %v", changes, want)
+		}
+	}
+	if states := c.States(); states[host] != StateClosed {
+		t.Errorf("States() = %v", states)
+	}
+}
+
+func mustHost(t *testing.T, raw string) string {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
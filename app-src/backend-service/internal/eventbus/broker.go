@@ -0,0 +1,127 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/kafka"
+	"github.com/anasadan/gitops-demo/backend-service/internal/nats"
+)
+
+// dialTimeout bounds connecting to the broker.
+const dialTimeout = 5 * time.Second
+
+// natsBroker publishes each event to its type's subject and flushes, so a
+// batch is published once the server has it. The connection is dialed on
+// first use, and again after it fails.
+type natsBroker struct {
+	cfg   nats.Config
+	topic string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+func newNATSBroker(cfg Config) *natsBroker {
+	return &natsBroker{cfg: nats.Config{URL: cfg.URL, Name: cfg.ClientID, DialTimeout: dialTimeout}, topic: cfg.Topic}
+}
+
+func (b *natsBroker) connect(ctx context.Context) (*nats.Conn, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil && b.conn.Err() == nil {
+		return b.conn, nil
+	}
+	conn, err := nats.Dial(ctx, b.cfg)
+	if err != nil {
+		return nil, err
+	}
+	b.conn = conn
+	return conn, nil
+}
+
+func (b *natsBroker) publish(ctx context.Context, msgs []message) error {
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range msgs {
+		if err := conn.Publish(b.topic+"."+m.eventType, "", m.body); err != nil {
+			return err
+		}
+	}
+	return conn.Flush(ctx)
+}
+
+func (b *natsBroker) ping(ctx context.Context) error {
+	conn, err := b.connect(ctx)
+	if err != nil {
+		return err
+	}
+	return conn.Flush(ctx)
+}
+
+func (b *natsBroker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.conn != nil {
+		b.conn.Close()
+	}
+}
+
+// kafkaBroker produces the events to the topic, keyed by subject so the
+// events about one item stay in order on one partition.
+type kafkaBroker struct {
+	client *kafka.Client
+	topic  string
+}
+
+func newKafkaBroker(cfg Config) (*kafkaBroker, error) {
+	brokers, err := kafkaBrokers(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &kafkaBroker{
+		client: kafka.New(kafka.Config{Brokers: brokers, ClientID: cfg.ClientID, DialTimeout: dialTimeout}),
+		topic:  cfg.Topic,
+	}, nil
+}
+
+// kafkaBrokers returns the broker addresses of a kafka:// URL.
+func kafkaBrokers(url string) ([]string, error) {
+	var brokers []string
+	for _, addr := range strings.Split(strings.TrimPrefix(url, "kafka://"), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			brokers = append(brokers, addr)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("event broker URL %q has no brokers", url)
+	}
+	return brokers, nil
+}
+
+func (b *kafkaBroker) publish(ctx context.Context, msgs []message) error {
+	records := make([]kafka.Message, len(msgs))
+	for i, m := range msgs {
+		records[i] = kafka.Message{
+			Value:   m.body,
+			Headers: []kafka.Header{{Key: "content-type", Value: []byte("application/cloudevents+json")}},
+		}
+		if m.subject != "" {
+			records[i].Key = []byte(m.subject)
+		}
+	}
+	return b.client.Produce(ctx, b.topic, records)
+}
+
+func (b *kafkaBroker) ping(ctx context.Context) error {
+	return b.client.Ping(ctx)
+}
+
+func (b *kafkaBroker) close() {
+	b.client.Close()
+}
@@ -0,0 +1,364 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/kafka"
+	"github.com/anasadan/gitops-demo/backend-service/internal/nats"
+)
+
+// fetchWait bounds how long a fetch waits for events to arrive.
+const fetchWait = 2 * time.Second
+
+// ConsumerConfig configures a Consumer.
+type ConsumerConfig struct {
+	// URL and Topic are those the events are published with.
+	URL   string
+	Topic string
+	// Group names the consumer's position on the broker: the durable
+	// JetStream consumer, or the Kafka consumer group. Consumers of the
+	// same group share the position.
+	Group string
+	// ClientID names the connection on the broker.
+	ClientID string
+	// BatchSize bounds the events a Fetch returns; 0 means 100.
+	BatchSize int
+}
+
+// Delivery is an event received from the broker. Err is set when the
+// message isn't a CloudEvent; it must be committed all the same, or it
+// would be delivered again forever.
+type Delivery struct {
+	Event Event
+	Err   error
+	// Partition is the Kafka partition the event was read from, 0 on NATS.
+	Partition int32
+
+	body   []byte
+	offset int64
+	msg    *nats.Msg
+}
+
+// source is the consuming side of NATS JetStream or Kafka.
+type source interface {
+	fetch(ctx context.Context, batch int) ([]Delivery, error)
+	commit(ctx context.Context, ds []Delivery) error
+	lag(ctx context.Context) (map[int32]int64, error)
+	close()
+}
+
+// Consumer reads the events of a topic at least once: what a Fetch returns
+// is delivered again, to the group, unless it's committed.
+type Consumer struct {
+	cfg    ConsumerConfig
+	source source
+}
+
+// NewConsumer returns a consumer for cfg without connecting.
+func NewConsumer(cfg ConsumerConfig) (*Consumer, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("no event broker URL to consume from")
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	var src source
+	scheme, _, _ := strings.Cut(cfg.URL, "://")
+	switch scheme {
+	case "nats":
+		src = newNATSSource(cfg)
+	case "kafka":
+		brokers, err := kafkaBrokers(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		src = &kafkaSource{
+			client: kafka.New(kafka.Config{Brokers: brokers, ClientID: cfg.ClientID, DialTimeout: dialTimeout}),
+			topic:  cfg.Topic,
+			group:  cfg.Group,
+		}
+	default:
+		return nil, fmt.Errorf("event broker URL %q: want nats:// or kafka://", cfg.URL)
+	}
+	return &Consumer{cfg: cfg, source: src}, nil
+}
+
+// Broker is the broker's scheme and address, without credentials, for logs.
+func (c *Consumer) Broker() string {
+	return redactURL(c.cfg.URL)
+}
+
+// Fetch returns the next events, waiting a little for some to arrive. It
+// returns none when there are none yet.
+func (c *Consumer) Fetch(ctx context.Context) ([]Delivery, error) {
+	ds, err := c.source.fetch(ctx, c.cfg.BatchSize)
+	for i := range ds {
+		ds[i].Err = ds[i].decode()
+	}
+	return ds, err
+}
+
+// Commit records that ds were processed, so the group doesn't get them
+// again. ds must be from one Fetch, in order.
+func (c *Consumer) Commit(ctx context.Context, ds []Delivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	return c.source.commit(ctx, ds)
+}
+
+// Lag returns, by partition, the events published that the group hasn't
+// committed yet.
+func (c *Consumer) Lag(ctx context.Context) (map[int32]int64, error) {
+	return c.source.lag(ctx)
+}
+
+// Close closes the connection.
+func (c *Consumer) Close() {
+	c.source.close()
+}
+
+func (d *Delivery) decode() error {
+	if err := json.Unmarshal(d.body, &d.Event); err != nil {
+		return fmt.Errorf("invalid CloudEvent: %w", err)
+	}
+	if d.Event.SpecVersion == "" || d.Event.Type == "" {
+		return errors.New("invalid CloudEvent: no specversion or type")
+	}
+	return nil
+}
+
+// natsSource pulls the events from a durable consumer of a JetStream stream
+// holding the topic's subjects, creating both when needed. The stream only
+// keeps the events published once it exists.
+type natsSource struct {
+	cfg    nats.Config
+	stream string
+	topic  string
+	group  string
+
+	mu   sync.Mutex
+	conn *nats.Conn
+}
+
+// streamMaxAge bounds how long the stream keeps events, consumed or not.
+const streamMaxAge = 24 * time.Hour
+
+func newNATSSource(cfg ConsumerConfig) *natsSource {
+	return &natsSource{
+		cfg:    nats.Config{URL: cfg.URL, Name: cfg.ClientID, DialTimeout: dialTimeout},
+		stream: streamName(cfg.Topic),
+		topic:  cfg.Topic,
+		group:  cfg.Group,
+	}
+}
+
+// streamName derives a stream name from topic, which may hold dots and
+// dashes a name can't: gitops-demo.events is GITOPS_DEMO_EVENTS.
+func streamName(topic string) string {
+	return strings.ToUpper(strings.NewReplacer(".", "_", "-", "_", "*", "_", ">", "_").Replace(topic))
+}
+
+func (s *natsSource) connect(ctx context.Context) (*nats.Conn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil && s.conn.Err() == nil {
+		return s.conn, nil
+	}
+	conn, err := nats.Dial(ctx, s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = conn.EnsureStream(ctx, nats.StreamConfig{
+		Name:     s.stream,
+		Subjects: []string{s.topic + ".>"},
+		MaxAge:   streamMaxAge,
+		Storage:  "file",
+	})
+	if err == nil {
+		err = conn.EnsureConsumer(ctx, s.stream, nats.ConsumerConfig{
+			Durable:   s.group,
+			AckPolicy: "explicit",
+			AckWait:   30 * time.Second,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	log.Printf("Consuming stream %s (subjects %s.>) as %s", s.stream, s.topic, s.group)
+	s.conn = conn
+	return conn, nil
+}
+
+func (s *natsSource) fetch(ctx context.Context, batch int) ([]Delivery, error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := conn.Fetch(ctx, s.stream, s.group, batch, fetchWait)
+	ds := make([]Delivery, len(msgs))
+	for i, msg := range msgs {
+		ds[i] = Delivery{body: msg.Data, msg: msg}
+	}
+	return ds, err
+}
+
+func (s *natsSource) commit(ctx context.Context, ds []Delivery) error {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range ds {
+		if err := conn.Ack(d.msg); err != nil {
+			return err
+		}
+	}
+	return conn.Flush(ctx)
+}
+
+// lag of a JetStream consumer is what it hasn't delivered plus what it
+// delivered without an ack yet; a stream has no partitions.
+func (s *natsSource) lag(ctx context.Context) (map[int32]int64, error) {
+	conn, err := s.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	info, err := conn.ConsumerInfo(ctx, s.stream, s.group)
+	if err != nil {
+		return nil, err
+	}
+	return map[int32]int64{0: int64(info.NumPending) + int64(info.NumAckPending)}, nil
+}
+
+func (s *natsSource) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// kafkaSource reads all the partitions of the topic in turn, from the
+// offsets the group committed, or the earliest ones. It doesn't join the
+// group, so consumers of one group must not run concurrently: they would
+// each read every event.
+type kafkaSource struct {
+	client *kafka.Client
+	topic  string
+	group  string
+
+	mu sync.Mutex
+	// positions are the next offsets to read, by partition; nil until
+	// the committed offsets are read.
+	positions map[int32]int64
+	next      int32
+}
+
+// init reads the partitions and the offsets committed, once.
+func (s *kafkaSource) init(ctx context.Context) error {
+	if s.positions != nil {
+		return nil
+	}
+	n, err := s.client.Partitions(ctx, s.topic)
+	if err != nil {
+		return err
+	}
+	partitions := make([]int32, n)
+	for p := range partitions {
+		partitions[p] = int32(p)
+	}
+	committed, err := s.client.CommittedOffsets(ctx, s.group, s.topic, partitions)
+	if err != nil {
+		return err
+	}
+	positions := make(map[int32]int64, n)
+	for _, p := range partitions {
+		offset, ok := committed[p]
+		if !ok || offset < 0 {
+			if offset, err = s.client.ListOffset(ctx, s.topic, p, kafka.OffsetEarliest); err != nil {
+				return err
+			}
+		}
+		positions[p] = offset
+	}
+	log.Printf("Consuming topic %s (%d partitions) as group %s", s.topic, n, s.group)
+	s.positions = positions
+	return nil
+}
+
+func (s *kafkaSource) fetch(ctx context.Context, batch int) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+	if len(s.positions) == 0 {
+		return nil, fmt.Errorf("topic %s has no partitions", s.topic)
+	}
+	p := s.next
+	s.next = (s.next + 1) % int32(len(s.positions))
+	records, _, err := s.client.Fetch(ctx, s.topic, p, s.positions[p], fetchWait)
+	if errors.Is(err, kafka.ErrOffsetOutOfRange) {
+		// The records were deleted by retention before they were read.
+		offset, err := s.client.ListOffset(ctx, s.topic, p, kafka.OffsetEarliest)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Warning: offset %d of partition %d is out of range; skipping to %d", s.positions[p], p, offset)
+		s.positions[p] = offset
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(records) > batch {
+		records = records[:batch]
+	}
+	ds := make([]Delivery, len(records))
+	for i, r := range records {
+		ds[i] = Delivery{Partition: p, body: r.Value, offset: r.Offset}
+	}
+	return ds, nil
+}
+
+func (s *kafkaSource) commit(ctx context.Context, ds []Delivery) error {
+	last := ds[len(ds)-1]
+	if err := s.client.CommitOffsets(ctx, s.group, s.topic, map[int32]int64{last.Partition: last.offset + 1}); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.positions[last.Partition] = max(s.positions[last.Partition], last.offset+1)
+	return nil
+}
+
+// lag of a partition is its high watermark less the group's position.
+func (s *kafkaSource) lag(ctx context.Context) (map[int32]int64, error) {
+	s.mu.Lock()
+	positions := make(map[int32]int64, len(s.positions))
+	for p, offset := range s.positions {
+		positions[p] = offset
+	}
+	s.mu.Unlock()
+	lag := make(map[int32]int64, len(positions))
+	for p, offset := range positions {
+		latest, err := s.client.ListOffset(ctx, s.topic, p, kafka.OffsetLatest)
+		if err != nil {
+			return nil, err
+		}
+		lag[p] = max(latest-offset, 0)
+	}
+	return lag, nil
+}
+
+func (s *kafkaSource) close() {
+	s.client.Close()
+}
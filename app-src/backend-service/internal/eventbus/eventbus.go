@@ -0,0 +1,235 @@
+// Package eventbus publishes what happens in the service as CloudEvents to a
+// message broker, NATS or Kafka, for event-driven consumers. Events are
+// queued and published in batches in the background; when the broker can't
+// keep up or is down, events are dropped rather than slowing requests.
+package eventbus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// queueSize bounds the events waiting to be published.
+	queueSize = 4096
+	// batchSize and flushInterval bound how long an event waits.
+	batchSize     = 256
+	flushInterval = time.Second
+	// publishTimeout bounds publishing a batch, and the final flush.
+	publishTimeout = 5 * time.Second
+)
+
+// Outcomes of an event, reported to Config.Report.
+const (
+	OutcomePublished = "published"
+	OutcomeFailed    = "failed"
+	OutcomeDropped   = "dropped"
+)
+
+// Config configures a Publisher.
+type Config struct {
+	// URL of the broker: nats://[user:password@|token@]host:4222 or
+	// kafka://host:9092[,host:9092...]. Empty disables publishing.
+	URL string
+	// Topic of the events on Kafka. On NATS, events go to the subject
+	// Topic.<type>, e.g. gitops-demo.events.item.created, so subscribers
+	// can pick types with wildcards.
+	Topic string
+	// Source is the CloudEvents source of the events, e.g.
+	// /backend-service/production.
+	Source string
+	// ClientID names the connection on the broker.
+	ClientID string
+	// Report, when set, is called with each event's type and outcome.
+	Report func(eventType, outcome string)
+}
+
+// Event is a CloudEvent in the structured JSON encoding.
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Subject         string          `json:"subject,omitempty"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// message is an event encoded for the broker.
+type message struct {
+	eventType string
+	subject   string
+	body      []byte
+}
+
+// broker is the connection to NATS or Kafka.
+type broker interface {
+	publish(ctx context.Context, msgs []message) error
+	ping(ctx context.Context) error
+	close()
+}
+
+// Publisher publishes events in the background. A nil Publisher publishes
+// nothing.
+type Publisher struct {
+	cfg       Config
+	broker    broker
+	queue     chan message
+	dropped   atomic.Int64
+	published atomic.Int64
+}
+
+// New returns a publisher for cfg without connecting, or nil when cfg.URL
+// is empty.
+func New(cfg Config) (*Publisher, error) {
+	if cfg.URL == "" {
+		return nil, nil
+	}
+	b, err := newBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Publisher{cfg: cfg, broker: b, queue: make(chan message, queueSize)}, nil
+}
+
+func newBroker(cfg Config) (broker, error) {
+	scheme, _, _ := strings.Cut(cfg.URL, "://")
+	switch scheme {
+	case "nats":
+		return newNATSBroker(cfg), nil
+	case "kafka":
+		return newKafkaBroker(cfg)
+	}
+	return nil, fmt.Errorf("event broker URL %q: want nats:// or kafka://", cfg.URL)
+}
+
+// Broker is the broker's scheme and address, without credentials, for logs.
+func (p *Publisher) Broker() string {
+	if p == nil {
+		return ""
+	}
+	return redactURL(p.cfg.URL)
+}
+
+func redactURL(url string) string {
+	scheme, rest, _ := strings.Cut(url, "://")
+	if _, host, ok := strings.Cut(rest, "@"); ok {
+		rest = host
+	}
+	return scheme + "://" + rest
+}
+
+// Emit queues an event of eventType about subject, with data encoded as
+// JSON. It never blocks: when the queue is full, the event is dropped.
+func (p *Publisher) Emit(eventType, subject string, data any) {
+	if p == nil {
+		return
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	body, err := json.Marshal(Event{
+		SpecVersion:     "1.0",
+		ID:              newID(),
+		Source:          p.cfg.Source,
+		Type:            eventType,
+		Time:            time.Now().UTC(),
+		DataContentType: "application/json",
+		Subject:         subject,
+		Data:            raw,
+	})
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	select {
+	case p.queue <- message{eventType: eventType, subject: subject, body: body}:
+	default:
+		p.dropped.Add(1)
+		p.report(eventType, OutcomeDropped)
+	}
+}
+
+// Run publishes queued events in batches until ctx ends, then flushes what
+// is left and closes the connection.
+func (p *Publisher) Run(ctx context.Context) {
+	if p == nil {
+		return
+	}
+	log.Printf("Publishing events to %s (topic %s)", p.Broker(), p.cfg.Topic)
+	defer p.broker.close()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]message, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+		outcome := OutcomePublished
+		if err := p.broker.publish(ctx, batch); err != nil {
+			outcome = OutcomeFailed
+			p.dropped.Add(int64(len(batch)))
+			log.Printf("Error publishing %d events: %v", len(batch), err)
+		} else {
+			p.published.Add(int64(len(batch)))
+		}
+		for _, m := range batch {
+			p.report(m.eventType, outcome)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case m := <-p.queue:
+			if batch = append(batch, m); len(batch) == batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			for {
+				select {
+				case m := <-p.queue:
+					if batch = append(batch, m); len(batch) == batchSize {
+						flush(context.Background())
+					}
+				default:
+					flush(context.Background())
+					if dropped := p.dropped.Load(); dropped > 0 {
+						log.Printf("Dropped %d of %d events since startup", dropped, dropped+p.published.Load())
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+// Ping checks that the broker answers, for readiness.
+func (p *Publisher) Ping(ctx context.Context) error {
+	return p.broker.ping(ctx)
+}
+
+func (p *Publisher) report(eventType, outcome string) {
+	if p.cfg.Report != nil {
+		p.cfg.Report(eventType, outcome)
+	}
+}
+
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,160 @@
+package grpc
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Field types of descriptors.
+const (
+	TypeDouble  = 1
+	TypeInt32   = 5
+	TypeBool    = 8
+	TypeString  = 9
+	TypeMessage = 11
+	TypeBytes   = 12
+	TypeEnum    = 14
+)
+
+// File describes a .proto file, as much as server reflection needs to
+// hand it to clients like grpcurl: its messages, enums and services.
+type File struct {
+	// Name is the path of the file, like "backend/v1/backend.proto"
+	Name      string
+	Package   string
+	GoPackage string
+	Messages  []MessageType
+	Services  []Service
+}
+
+// MessageType describes a message.
+type MessageType struct {
+	Name   string
+	Fields []FieldType
+	Nested []MessageType
+	Enums  []Enum
+}
+
+// FieldType describes a field of a message.
+type FieldType struct {
+	Name   string
+	Number int
+	Type   int
+	// TypeName is the full name of message and enum types, like
+	// ".backend.v1.Topology"
+	TypeName string
+	Repeated bool
+}
+
+// Enum describes an enum; its values are numbered in order from zero.
+type Enum struct {
+	Name   string
+	Values []string
+}
+
+// Service describes a service and serves its methods.
+type Service struct {
+	Name    string
+	Methods []Method
+}
+
+// Method describes a method of a service and serves it.
+type Method struct {
+	Name string
+	// Input and Output are the full names of the request and response
+	// messages, like ".backend.v1.Info"
+	Input, Output   string
+	ClientStreaming bool
+	ServerStreaming bool
+	Handler         Handler
+}
+
+// encode returns the file as a google.protobuf.FileDescriptorProto.
+func (f File) encode() Message {
+	m := Message(nil).AppendString(1, f.Name).AppendString(2, f.Package)
+	for _, msg := range f.Messages {
+		m = m.AppendMessage(4, msg.encode())
+	}
+	for _, svc := range f.Services {
+		sm := Message(nil).AppendString(1, svc.Name)
+		for _, method := range svc.Methods {
+			sm = sm.AppendMessage(2, Message(nil).AppendString(1, method.Name).
+				AppendString(2, method.Input).AppendString(3, method.Output).
+				AppendBool(5, method.ClientStreaming).AppendBool(6, method.ServerStreaming))
+		}
+		m = m.AppendMessage(6, sm)
+	}
+	if f.GoPackage != "" {
+		m = m.AppendMessage(8, Message(nil).AppendString(11, f.GoPackage))
+	}
+	return m.AppendString(12, "proto3")
+}
+
+// encode returns the message as a google.protobuf.DescriptorProto.
+func (t MessageType) encode() Message {
+	m := Message(nil).AppendString(1, t.Name)
+	for _, f := range t.Fields {
+		label := uint64(1)
+		if f.Repeated {
+			label = 3
+		}
+		m = m.AppendMessage(2, Message(nil).AppendString(1, f.Name).AppendVarint(3, uint64(f.Number)).
+			AppendVarint(4, label).AppendVarint(5, uint64(f.Type)).AppendString(6, f.TypeName).
+			AppendString(10, jsonName(f.Name)))
+	}
+	for _, nested := range t.Nested {
+		m = m.AppendMessage(3, nested.encode())
+	}
+	for _, e := range t.Enums {
+		em := Message(nil).AppendString(1, e.Name)
+		for i, v := range e.Values {
+			em = em.AppendMessage(2, Message(nil).AppendString(1, v).AppendVarint(2, uint64(i)))
+		}
+		m = m.AppendMessage(4, em)
+	}
+	return m
+}
+
+// symbols returns the full names of what f defines: its services and
+// their methods, and its messages and enums, nested ones included.
+func (f File) symbols() []string {
+	var names []string
+	var add func(prefix string, msgs []MessageType)
+	add = func(prefix string, msgs []MessageType) {
+		for _, msg := range msgs {
+			name := prefix + "." + msg.Name
+			names = append(names, name)
+			for _, e := range msg.Enums {
+				names = append(names, name+"."+e.Name)
+			}
+			add(name, msg.Nested)
+		}
+	}
+	add(f.Package, f.Messages)
+	for _, svc := range f.Services {
+		name := f.Package + "." + svc.Name
+		names = append(names, name)
+		for _, method := range svc.Methods {
+			names = append(names, name+"."+method.Name)
+		}
+	}
+	return names
+}
+
+// jsonName is the lowerCamelCase name protoc gives a field in JSON.
+func jsonName(name string) string {
+	var b strings.Builder
+	upper := false
+	for _, r := range name {
+		switch {
+		case r == '_':
+			upper = true
+		case upper:
+			b.WriteRune(unicode.ToUpper(r))
+			upper = false
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,250 @@
+// Package grpc implements the server side of gRPC over HTTP/2, as much as
+// serving a few services takes: unary, server-streaming and bidirectional
+// calls of uncompressed protobuf messages, deadlines, status codes, the
+// standard health service (grpc.health.v1) and server reflection for tools
+// like grpcurl. Messages are encoded and decoded field by field with
+// Message and Fields; there is no code generation.
+//
+// Server is an http.Handler. Kubernetes gRPC probes and most clients speak
+// HTTP/2 without TLS, so serve it from an http.Server whose Protocols
+// allow unencrypted HTTP/2.
+package grpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Code is a gRPC status code.
+type Code int
+
+// Status codes.
+const (
+	OK                Code = 0
+	Canceled          Code = 1
+	Unknown           Code = 2
+	InvalidArgument   Code = 3
+	DeadlineExceeded  Code = 4
+	NotFound          Code = 5
+	ResourceExhausted Code = 8
+	Unimplemented     Code = 12
+	Internal          Code = 13
+	Unavailable       Code = 14
+)
+
+// maxMessageSize bounds the messages clients may send.
+const maxMessageSize = 4 << 20
+
+// Error is a call's failure, sent to the client as its status.
+type Error struct {
+	Code    Code
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("grpc: code %d: %s", e.Code, e.Message)
+}
+
+// Errorf returns an Error with code and a formatted message.
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Handler serves a call, reading the requests from stream and writing the
+// responses to it. The error it returns is the status of the call.
+type Handler func(ctx context.Context, stream *Stream) error
+
+// Unary serves a call of one request and one response with f.
+func Unary(f func(ctx context.Context, req []byte) (Message, error)) Handler {
+	return func(ctx context.Context, stream *Stream) error {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return Errorf(Internal, "no request message")
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := f(ctx, req)
+		if err != nil {
+			return err
+		}
+		return stream.Send(resp)
+	}
+}
+
+// Stream is the request and response messages of a call.
+type Stream struct {
+	body io.Reader
+	w    http.ResponseWriter
+	rc   *http.ResponseController
+}
+
+// Recv returns the next request message, or io.EOF when the client sent
+// its last.
+func (s *Stream) Recv() ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(s.body, prefix[:]); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, Errorf(Internal, "reading the request: %v", err)
+	}
+	if prefix[0] != 0 {
+		return nil, Errorf(Unimplemented, "compressed messages aren't supported")
+	}
+	size := binary.BigEndian.Uint32(prefix[1:])
+	if size > maxMessageSize {
+		return nil, Errorf(ResourceExhausted, "request message of %d bytes is over the limit of %d", size, maxMessageSize)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(s.body, msg); err != nil {
+		return nil, Errorf(Internal, "reading the request: %v", err)
+	}
+	return msg, nil
+}
+
+// Send writes a response message and flushes it to the client.
+func (s *Stream) Send(msg Message) error {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	if _, err := s.w.Write(append(frame, msg...)); err != nil {
+		return Errorf(Unavailable, "writing the response: %v", err)
+	}
+	if err := s.rc.Flush(); err != nil {
+		return Errorf(Unavailable, "writing the response: %v", err)
+	}
+	return nil
+}
+
+// Server serves the methods of the services registered with it.
+type Server struct {
+	methods  map[string]Handler
+	services []string
+	// files by name, and the name of the file defining each symbol
+	files   map[string]Message
+	symbols map[string]string
+}
+
+// NewServer returns a Server without services.
+func NewServer() *Server {
+	return &Server{methods: map[string]Handler{}, files: map[string]Message{}, symbols: map[string]string{}}
+}
+
+// Register serves the services of f, and describes f to reflection.
+func (s *Server) Register(f File) {
+	for _, svc := range f.Services {
+		name := f.Package + "." + svc.Name
+		s.services = append(s.services, name)
+		for _, method := range svc.Methods {
+			s.methods["/"+name+"/"+method.Name] = method.Handler
+		}
+	}
+	sort.Strings(s.services)
+	s.files[f.Name] = f.encode()
+	for _, symbol := range f.symbols() {
+		s.symbols[symbol] = f.Name
+	}
+}
+
+// handle serves a method that isn't described to reflection.
+func (s *Server) handle(path string, h Handler) {
+	s.methods[path] = h
+}
+
+// ServeHTTP serves a call over HTTP/2. The status goes in the trailers, so
+// it follows whatever the handler sent.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !isGRPC(r.Header.Get("Content-Type")) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		io.WriteString(w, "gRPC over HTTP/2 only\n")
+		return
+	}
+	ctx := r.Context()
+	if timeout, ok := parseTimeout(r.Header.Get("Grpc-Timeout")); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+
+	var err error
+	if handler, ok := s.methods[r.URL.Path]; ok {
+		err = handler(ctx, &Stream{body: r.Body, w: w, rc: http.NewResponseController(w)})
+	} else {
+		err = Errorf(Unimplemented, "unknown method %s", r.URL.Path)
+	}
+	status := statusOf(ctx, err)
+	if status.Code == Unknown || status.Code == Internal {
+		log.Printf("Error serving gRPC call %s: %s", r.URL.Path, status.Message)
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(int(status.Code)))
+	if status.Message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeMessage(status.Message))
+	}
+}
+
+// statusOf is the status of a call that ended with err.
+func statusOf(ctx context.Context, err error) *Error {
+	var status *Error
+	switch {
+	case err == nil:
+		return &Error{Code: OK}
+	case errors.As(err, &status):
+		return status
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return &Error{Code: DeadlineExceeded, Message: err.Error()}
+	case ctx.Err() != nil:
+		return &Error{Code: Canceled, Message: err.Error()}
+	}
+	return &Error{Code: Unknown, Message: err.Error()}
+}
+
+// isGRPC reports whether contentType is application/grpc, with the
+// protobuf codec if any.
+func isGRPC(contentType string) bool {
+	codec, ok := strings.CutPrefix(contentType, "application/grpc")
+	return ok && (codec == "" || codec == "+proto" || strings.HasPrefix(codec, ";"))
+}
+
+// parseTimeout parses a grpc-timeout header, like "1S" or "250m".
+func parseTimeout(s string) (time.Duration, bool) {
+	if len(s) < 2 || len(s) > 9 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{
+		'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond,
+	}
+	unit, ok := units[s[len(s)-1]]
+	n, err := strconv.ParseInt(s[:len(s)-1], 10, 64)
+	if !ok || err != nil || n < 0 || n > int64(math.MaxInt64/unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// encodeMessage percent-encodes a status message for the grpc-message
+// trailer.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
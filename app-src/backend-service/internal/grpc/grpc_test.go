@@ -0,0 +1,271 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestServer serves srv over HTTP/2 without TLS, as kubelet probes
+// and grpcurl -plaintext connect.
+func newTestServer(t *testing.T, srv *Server) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(srv)
+	ts.Config.Protocols = new(http.Protocols)
+	ts.Config.Protocols.SetUnencryptedHTTP2(true)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// call sends msgs to method and returns the response messages and the
+// grpc-status and grpc-message trailers.
+func call(t *testing.T, ts *httptest.Server, method string, header http.Header, msgs ...Message) ([][]byte, string, string) {
+	t.Helper()
+	var body bytes.Buffer
+	for _, msg := range msgs {
+		frame := make([]byte, 5)
+		binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+		body.Write(append(frame, msg...))
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.URL+method, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	protocols := new(http.Protocols)
+	protocols.SetUnencryptedHTTP2(true)
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/grpc" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	var out [][]byte
+	for len(raw) >= 5 {
+		size := binary.BigEndian.Uint32(raw[1:5])
+		out, raw = append(out, raw[5:5+size]), raw[5+size:]
+	}
+	return out, resp.Trailer.Get("Grpc-Status"), resp.Trailer.Get("Grpc-Message")
+}
+
+func healthRequest(service string) Message {
+	return Message(nil).AppendString(1, service)
+}
+
+func healthStatusOf(t *testing.T, msg []byte) HealthStatus {
+	t.Helper()
+	fields, err := Fields(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fields {
+		if f.Number == 1 {
+			return HealthStatus(f.Varint)
+		}
+	}
+	return StatusUnknown
+}
+
+func TestHealthCheck(t *testing.T) {
+	var ready atomic.Bool
+	srv := NewServer()
+	RegisterHealth(srv, func(_ context.Context, service string) (HealthStatus, bool) {
+		switch service {
+		case "":
+			return StatusServing, true
+		case "demo.v1.Demo":
+			if ready.Load() {
+				return StatusServing, true
+			}
+			return StatusNotServing, true
+		}
+		return StatusUnknown, false
+	})
+	ts := newTestServer(t, srv)
+
+	tests := []struct {
+		service    string
+		wantCode   string
+		wantStatus HealthStatus
+	}{
+		{"", "0", StatusServing},
+		{"demo.v1.Demo", "0", StatusNotServing},
+		{"unknown.Service", "5", StatusUnknown},
+	}
+	for _, tt := range tests {
+		msgs, code, _ := call(t, ts, "/grpc.health.v1.Health/Check", nil, healthRequest(tt.service))
+		if code != tt.wantCode {
+			t.Errorf("Check(%q) grpc-status = %s, want %s", tt.service, code, tt.wantCode)
+			continue
+		}
+		if tt.wantCode == "0" && (len(msgs) != 1 || healthStatusOf(t, msgs[0]) != tt.wantStatus) {
+			t.Errorf("Check(%q) = %v, want status %d", tt.service, msgs, tt.wantStatus)
+		}
+	}
+
+	// Watch sends the status, then its change.
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		ready.Store(true)
+	}()
+	msgs, code, _ := call(t, ts, "/grpc.health.v1.Health/Watch", http.Header{"Grpc-Timeout": {"1500m"}}, healthRequest("demo.v1.Demo"))
+	if code != "4" {
+		t.Errorf("Watch grpc-status = %s, want 4 (deadline exceeded)", code)
+	}
+	var statuses []HealthStatus
+	for _, msg := range msgs {
+		statuses = append(statuses, healthStatusOf(t, msg))
+	}
+	if len(statuses) != 2 || statuses[0] != StatusNotServing || statuses[1] != StatusServing {
+		t.Errorf("Watch statuses = %v, want NOT_SERVING then SERVING", statuses)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	ts := newTestServer(t, NewServer())
+	if _, code, msg := call(t, ts, "/demo.v1.Demo/Missing", nil, Message{}); code != "12" || !strings.Contains(msg, "unknown method") {
+		t.Errorf("grpc-status = %s %q, want 12 (unimplemented)", code, msg)
+	}
+}
+
+func TestErrorMessage(t *testing.T) {
+	srv := NewServer()
+	srv.Register(File{Name: "demo.proto", Package: "demo", Services: []Service{{Name: "Demo", Methods: []Method{{
+		Name: "Fail",
+		Handler: Unary(func(context.Context, []byte) (Message, error) {
+			return nil, Errorf(InvalidArgument, "100%% wrong: ünicode")
+		}),
+	}}}}})
+	ts := newTestServer(t, srv)
+	if _, code, msg := call(t, ts, "/demo.Demo/Fail", nil, Message{}); code != "3" || msg != "100%25 wrong: %C3%BCnicode" {
+		t.Errorf("grpc-status = %s %q, want 3 with a percent-encoded message", code, msg)
+	}
+}
+
+func TestReflection(t *testing.T) {
+	srv := NewServer()
+	srv.Register(File{
+		Name: "demo/v1/demo.proto", Package: "demo.v1",
+		Messages: []MessageType{{Name: "Ping", Fields: []FieldType{{Name: "sent_at", Number: 1, Type: TypeString}}}},
+		Services: []Service{{Name: "Demo", Methods: []Method{{Name: "Ping", Input: ".demo.v1.Ping", Output: ".demo.v1.Ping"}}}},
+	})
+	RegisterHealth(srv, func(context.Context, string) (HealthStatus, bool) { return StatusServing, true })
+	RegisterReflection(srv)
+	ts := newTestServer(t, srv)
+
+	// Answers are in the order of the requests, on one stream.
+	msgs, code, _ := call(t, ts, "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo", nil,
+		Message(nil).AppendString(7, "*"),
+		Message(nil).AppendString(4, "demo.v1.Demo.Ping"),
+		Message(nil).AppendString(3, "grpc/health/v1/health.proto"),
+		Message(nil).AppendString(4, "demo.v1.Missing"),
+	)
+	if code != "0" || len(msgs) != 4 {
+		t.Fatalf("grpc-status = %s with %d responses, want 0 with 4", code, len(msgs))
+	}
+	answer := func(msg []byte, number int) []byte {
+		fields, err := Fields(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range fields {
+			if f.Number == number {
+				return f.Bytes
+			}
+		}
+		t.Fatalf("response %x has no field %d", msg, number)
+		return nil
+	}
+	names := func(msg []byte) []string {
+		fields, err := Fields(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range fields {
+			sub, _ := Fields(f.Bytes)
+			names = append(names, string(sub[0].Bytes))
+		}
+		return names
+	}
+	if got := strings.Join(names(answer(msgs[0], 6)), ","); got != "demo.v1.Demo,grpc.health.v1.Health" {
+		t.Errorf("list_services = %s", got)
+	}
+	for i, want := range []string{"demo/v1/demo.proto", "grpc/health/v1/health.proto"} {
+		files, err := Fields(answer(msgs[i+1], 4))
+		if err != nil || len(files) != 1 {
+			t.Fatalf("file_descriptor_response = %v, %v", files, err)
+		}
+		descriptor, _ := Fields(files[0].Bytes)
+		if string(descriptor[0].Bytes) != want {
+			t.Errorf("descriptor of %s is named %q", want, descriptor[0].Bytes)
+		}
+	}
+	if errResp, _ := Fields(answer(msgs[3], 7)); errResp[0].Varint != uint64(NotFound) {
+		t.Errorf("error_response of an unknown symbol = %v, want NOT_FOUND", errResp)
+	}
+}
+
+func TestHTTP1Refused(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", nil))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("HTTP/1.1 request = %d, want 415", rec.Code)
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"1S", time.Second, true},
+		{"250m", 250 * time.Millisecond, true},
+		{"2H", 2 * time.Hour, true},
+		{"99999999H", 0, false},
+		{"S", 0, false},
+		{"10x", 0, false},
+		{"-1S", 0, false},
+	}
+	for _, tt := range tests {
+		if got, ok := parseTimeout(tt.in); got != tt.want || ok != tt.ok {
+			t.Errorf("parseTimeout(%q) = %s, %t; want %s, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFields(t *testing.T) {
+	msg := Message(nil).AppendString(1, "a").AppendVarint(2, 300).AppendDouble(3, 1.5).
+		AppendMessage(4, Message{}).AppendBool(5, false)
+	fields, err := Fields(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The double is skipped, the false bool left out.
+	if len(fields) != 3 || string(fields[0].Bytes) != "a" || fields[1].Varint != 300 || fields[2].Number != 4 {
+		t.Errorf("Fields() = %+v", fields)
+	}
+	if _, err := Fields([]byte{0x0a, 0x05, 'a'}); err == nil {
+		t.Error("Fields() of a truncated message succeeded")
+	}
+}
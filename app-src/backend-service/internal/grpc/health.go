@@ -0,0 +1,114 @@
+package grpc
+
+import (
+	"context"
+	"time"
+)
+
+// HealthStatus is the serving status of the health service.
+type HealthStatus int
+
+// Serving statuses of grpc.health.v1.HealthCheckResponse.
+const (
+	StatusUnknown        HealthStatus = 0
+	StatusServing        HealthStatus = 1
+	StatusNotServing     HealthStatus = 2
+	StatusServiceUnknown HealthStatus = 3
+)
+
+// healthPollInterval is how often Watch checks for a new status.
+const healthPollInterval = time.Second
+
+// healthFile is grpc/health/v1/health.proto.
+var healthFile = File{
+	Name:      "grpc/health/v1/health.proto",
+	Package:   "grpc.health.v1",
+	GoPackage: "google.golang.org/grpc/health/grpc_health_v1",
+	Messages: []MessageType{
+		{Name: "HealthCheckRequest", Fields: []FieldType{{Name: "service", Number: 1, Type: TypeString}}},
+		{
+			Name:   "HealthCheckResponse",
+			Fields: []FieldType{{Name: "status", Number: 1, Type: TypeEnum, TypeName: ".grpc.health.v1.HealthCheckResponse.ServingStatus"}},
+			Enums:  []Enum{{Name: "ServingStatus", Values: []string{"UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"}}},
+		},
+	},
+}
+
+// RegisterHealth serves grpc.health.v1.Health, the service Kubernetes gRPC
+// probes call. status returns the status of a service by name, "" being
+// the server as a whole; ok is false for services it doesn't know.
+func RegisterHealth(s *Server, status func(ctx context.Context, service string) (st HealthStatus, ok bool)) {
+	f := healthFile
+	f.Services = []Service{{Name: "Health", Methods: []Method{
+		{
+			Name: "Check", Input: ".grpc.health.v1.HealthCheckRequest", Output: ".grpc.health.v1.HealthCheckResponse",
+			Handler: Unary(func(ctx context.Context, req []byte) (Message, error) {
+				service, err := healthService(req)
+				if err != nil {
+					return nil, err
+				}
+				st, ok := status(ctx, service)
+				if !ok {
+					return nil, Errorf(NotFound, "unknown service %q", service)
+				}
+				return healthResponse(st), nil
+			}),
+		},
+		{
+			Name: "Watch", Input: ".grpc.health.v1.HealthCheckRequest", Output: ".grpc.health.v1.HealthCheckResponse",
+			ServerStreaming: true,
+			// Watch sends the status, then every change of it until the
+			// client goes away.
+			Handler: func(ctx context.Context, stream *Stream) error {
+				req, err := stream.Recv()
+				if err != nil {
+					return err
+				}
+				service, err := healthService(req)
+				if err != nil {
+					return err
+				}
+				ticker := time.NewTicker(healthPollInterval)
+				defer ticker.Stop()
+				last := HealthStatus(-1)
+				for {
+					st, ok := status(ctx, service)
+					if !ok {
+						st = StatusServiceUnknown
+					}
+					if st != last {
+						if err := stream.Send(healthResponse(st)); err != nil {
+							return err
+						}
+						last = st
+					}
+					select {
+					case <-ctx.Done():
+						return ctx.Err()
+					case <-ticker.C:
+					}
+				}
+			},
+		},
+	}}}
+	s.Register(f)
+}
+
+// healthService reads the service of a HealthCheckRequest.
+func healthService(req []byte) (string, error) {
+	fields, err := Fields(req)
+	if err != nil {
+		return "", Errorf(InvalidArgument, "%v", err)
+	}
+	var service string
+	for _, f := range fields {
+		if f.Number == 1 {
+			service = string(f.Bytes)
+		}
+	}
+	return service, nil
+}
+
+func healthResponse(st HealthStatus) Message {
+	return Message(nil).AppendVarint(1, uint64(st))
+}
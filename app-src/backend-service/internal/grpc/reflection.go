@@ -0,0 +1,98 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// reflectionServices are the names clients look for server reflection
+// under; grpcurl tries v1 first and falls back on v1alpha, whose messages
+// are the same.
+var reflectionServices = []string{"grpc.reflection.v1.ServerReflection", "grpc.reflection.v1alpha.ServerReflection"}
+
+// RegisterReflection serves server reflection, which describes the
+// registered services to clients that have no .proto files of their own,
+// like grpcurl. Call it once the other services are registered. The
+// reflection service isn't listed itself, so describing everything listed
+// works without its own descriptor.
+func RegisterReflection(s *Server) {
+	for _, name := range reflectionServices {
+		s.handle("/"+name+"/ServerReflectionInfo", s.reflectionInfo)
+	}
+}
+
+// reflectionInfo answers each ServerReflectionRequest the client sends
+// with a ServerReflectionResponse, until the client closes its side.
+func (s *Server) reflectionInfo(_ context.Context, stream *Stream) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		resp, err := s.reflect(req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+}
+
+// reflect answers a ServerReflectionRequest.
+func (s *Server) reflect(req []byte) (Message, error) {
+	fields, err := Fields(req)
+	if err != nil {
+		return nil, Errorf(InvalidArgument, "%v", err)
+	}
+	resp := Message(nil)
+	var answer Message
+	for _, f := range fields {
+		arg := string(f.Bytes)
+		switch f.Number {
+		case 1: // host
+			resp = resp.AppendString(1, arg)
+		case 3: // file_by_filename
+			answer = fileResponse(s.files[arg], fmt.Sprintf("file %q", arg))
+		case 4: // file_containing_symbol
+			answer = fileResponse(s.files[s.symbols[arg]], fmt.Sprintf("symbol %q", arg))
+		case 5: // file_containing_extension
+			answer = reflectionError(NotFound, "no extensions")
+		case 6: // all_extension_numbers_of_type
+			if _, ok := s.symbols[arg]; ok {
+				answer = Message(nil).AppendMessage(5, Message(nil).AppendString(1, arg))
+			} else {
+				answer = reflectionError(NotFound, "unknown type "+arg)
+			}
+		case 7: // list_services
+			list := Message(nil)
+			for _, name := range s.services {
+				list = list.AppendMessage(1, Message(nil).AppendString(1, name))
+			}
+			answer = Message(nil).AppendMessage(6, list)
+		}
+	}
+	if answer == nil {
+		answer = reflectionError(Unimplemented, "unsupported reflection request")
+	}
+	resp = resp.AppendMessage(2, Message(req))
+	return append(resp, answer...), nil
+}
+
+// fileResponse is a file_descriptor_response holding file, or an
+// error_response naming what wasn't found.
+func fileResponse(file Message, what string) Message {
+	if file == nil {
+		return reflectionError(NotFound, "unknown "+what)
+	}
+	return Message(nil).AppendMessage(4, Message(nil).AppendBytes(1, file))
+}
+
+func reflectionError(code Code, msg string) Message {
+	return Message(nil).AppendMessage(7, Message(nil).AppendVarint(1, uint64(code)).AppendString(2, msg))
+}
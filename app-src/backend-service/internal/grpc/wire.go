@@ -0,0 +1,127 @@
+package grpc
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+var errMalformed = errors.New("malformed protobuf message")
+
+// Message is an encoded protobuf message, built field by field. Fields at
+// their zero value are left out, as proto3 does.
+type Message []byte
+
+// AppendString appends a string field.
+func (m Message) AppendString(field int, s string) Message {
+	if s == "" {
+		return m
+	}
+	return m.appendLen(field, []byte(s))
+}
+
+// AppendBool appends a bool field.
+func (m Message) AppendBool(field int, b bool) Message {
+	if !b {
+		return m
+	}
+	return m.AppendVarint(field, 1)
+}
+
+// AppendVarint appends an integer or enum field.
+func (m Message) AppendVarint(field int, v uint64) Message {
+	if v == 0 {
+		return m
+	}
+	m = binary.AppendUvarint(m, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(m, v)
+}
+
+// AppendDouble appends a double field.
+func (m Message) AppendDouble(field int, f float64) Message {
+	if f == 0 {
+		return m
+	}
+	m = binary.AppendUvarint(m, uint64(field)<<3|wireI64)
+	return binary.LittleEndian.AppendUint64(m, math.Float64bits(f))
+}
+
+// AppendMessage appends an embedded message; a nil one is left out, an
+// empty one isn't.
+func (m Message) AppendMessage(field int, sub Message) Message {
+	if sub == nil {
+		return m
+	}
+	return m.appendLen(field, sub)
+}
+
+// AppendBytes appends a bytes field, or an element of a repeated one,
+// empty or not.
+func (m Message) AppendBytes(field int, b []byte) Message {
+	return m.appendLen(field, b)
+}
+
+func (m Message) appendLen(field int, b []byte) Message {
+	m = binary.AppendUvarint(m, uint64(field)<<3|wireLen)
+	m = binary.AppendUvarint(m, uint64(len(b)))
+	return append(m, b...)
+}
+
+// Field is a field of a received message: varints, enums and bools in
+// Varint, strings, bytes and embedded messages in Bytes.
+type Field struct {
+	Number int
+	Varint uint64
+	Bytes  []byte
+}
+
+// Fields decodes the fields of msg in the order they were sent; fixed-size
+// fields are skipped, as no request has any.
+func Fields(msg []byte) ([]Field, error) {
+	var fields []Field
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		if n <= 0 || tag>>3 == 0 {
+			return nil, errMalformed
+		}
+		msg = msg[n:]
+		f := Field{Number: int(tag >> 3)}
+		switch tag & 7 {
+		case wireVarint:
+			if f.Varint, n = binary.Uvarint(msg); n <= 0 {
+				return nil, errMalformed
+			}
+			msg = msg[n:]
+		case wireLen:
+			size, n := binary.Uvarint(msg)
+			if n <= 0 || size > uint64(len(msg)-n) {
+				return nil, errMalformed
+			}
+			f.Bytes, msg = msg[n:n+int(size)], msg[n+int(size):]
+		case wireI64:
+			if len(msg) < 8 {
+				return nil, errMalformed
+			}
+			msg = msg[8:]
+			continue
+		case wireI32:
+			if len(msg) < 4 {
+				return nil, errMalformed
+			}
+			msg = msg[4:]
+			continue
+		default:
+			return nil, errMalformed
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+type ConfigResponse struct {
+	Service     string            `json:"service"`
+	Version     string            `json:"version"`
+	Hostname    string            `json:"hostname"`
+	LoadedAt    string            `json:"loaded_at"`
+	Config      []config.Entry    `json:"config"`
+	Environment map[string]string `json:"environment"`
+	// Keys of the config and environment whose values are masked
+	Redacted []string `json:"redacted"`
+}
+
+// EnvResponse is the process environment, as /admin/env shows it.
+type EnvResponse struct {
+	Service     string            `json:"service"`
+	Hostname    string            `json:"hostname"`
+	Environment map[string]string `json:"environment"`
+	// Names of the variables whose values are masked
+	Redacted []string `json:"redacted"`
+}
+
+// Config serves /admin/config: every configuration value the pod loaded and
+// whether it came from the environment or the default, so operators can
+// verify what a pod picked up after a GitOps change. Besides the loaded
+// configuration it shows the environment variables matching envPrefixes.
+// Secrets are masked, and the keys masked are listed. Callers must guard it
+// with AuthorizedAdmin.
+func Config(serviceName, version, hostname string, envPrefixes []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := ConfigResponse{
+			Service:     serviceName,
+			Version:     version,
+			Hostname:    hostname,
+			LoadedAt:    config.LoadedAt().UTC().Format(time.RFC3339),
+			Config:      config.Entries(),
+			Environment: make(map[string]string),
+		}
+		redacted := map[string]bool{}
+		for _, e := range resp.Config {
+			if e.Value != "" && config.IsSecret(e.Key) {
+				redacted[e.Key] = true
+			}
+		}
+		for key, value := range environ() {
+			for _, prefix := range envPrefixes {
+				if strings.HasPrefix(key, prefix) {
+					resp.Environment[key] = config.Redact(key, value)
+					if value != "" && config.IsSecret(key) {
+						redacted[key] = true
+					}
+					break
+				}
+			}
+		}
+		resp.Redacted = sortedKeys(redacted)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding config response: %v", err)
+		}
+	}
+}
+
+// Env serves /admin/env: every environment variable of the process, with
+// the values of secret ones masked, to see what the Deployment and its
+// ConfigMaps and Secrets actually passed in. Callers must guard it with
+// AuthorizedAdmin.
+func Env(serviceName, hostname string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		resp := EnvResponse{
+			Service:     serviceName,
+			Hostname:    hostname,
+			Environment: make(map[string]string),
+		}
+		redacted := map[string]bool{}
+		for key, value := range environ() {
+			resp.Environment[key] = config.Redact(key, value)
+			if value != "" && config.IsSecret(key) {
+				redacted[key] = true
+			}
+		}
+		resp.Redacted = sortedKeys(redacted)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding env response: %v", err)
+		}
+	}
+}
+
+// environ returns the environment of the process by name.
+func environ() map[string]string {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if key, value, _ := strings.Cut(kv, "="); key != "" {
+			env[key] = value
+		}
+	}
+	return env
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// AdminKeys are the credentials admin requests may present.
+type AdminKeys interface {
+	// Enabled reports whether any credential is configured.
+	Enabled() bool
+	// Valid reports whether key is one of them.
+	Valid(key string) bool
+}
+
+// Token is a single admin token as AdminKeys.
+type Token string
+
+func (t Token) Enabled() bool { return t != "" }
+
+func (t Token) Valid(key string) bool {
+	return t != "" && subtle.ConstantTimeCompare([]byte(key), []byte(t)) == 1
+}
+
+// AdminKey returns the credential of an admin request: its X-API-Key
+// header, or else its bearer token.
+func AdminKey(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
+
+// AuthorizedAdmin checks the credential of an admin request and writes the
+// error response when it is missing or wrong. Admin endpoints are disabled
+// when no credential is configured.
+func AuthorizedAdmin(w http.ResponseWriter, r *http.Request, keys AdminKeys) bool {
+	if !keys.Enabled() {
+		problem.Error(w, r, i18n.T(r.Context(), "error.admin_disabled"), http.StatusForbidden)
+		return false
+	}
+	if key := AdminKey(r); key == "" || !keys.Valid(key) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		p := problem.New(http.StatusUnauthorized, i18n.T(r.Context(), "error.unauthorized"))
+		p.Type, p.Title = problem.TypeUnauthorized, "Admin token required"
+		problem.Write(w, r, p)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+type DelayResponse struct {
+	Requested string `json:"requested"`
+	Delayed   string `json:"delayed"`
+	Capped    bool   `json:"capped,omitempty"`
+	Hostname  string `json:"hostname"`
+}
+
+// Delay serves /api/delay/{duration}, sleeping before it responds so
+// probe failures, client timeouts and retry policies can be demonstrated.
+// The duration is a Go duration ("500ms", "2s") or a number of seconds and
+// is capped at maxDelay. A client that gives up cancels the sleep.
+func Delay(hostname string, maxDelay time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := router.Param(r, "duration")
+		requested, err := parseDelay(raw)
+		if err != nil {
+			problem.Error(w, r, i18n.T(r.Context(), "error.invalid_delay", raw), http.StatusBadRequest)
+			return
+		}
+		delay, capped := requested, false
+		if delay > maxDelay {
+			delay, capped = maxDelay, true
+		}
+
+		// The delay may outlast the server's WriteTimeout.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(delay + 5*time.Second))
+
+		start := time.Now()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			log.Printf("Delay of %s cancelled by client after %s", delay, time.Since(start).Round(time.Millisecond))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(DelayResponse{
+			Requested: requested.String(),
+			Delayed:   time.Since(start).Round(time.Millisecond).String(),
+			Capped:    capped,
+			Hostname:  hostname,
+		}); err != nil {
+			log.Printf("Error encoding delay response: %v", err)
+		}
+	}
+}
+
+func parseDelay(raw string) (time.Duration, error) {
+	if raw == "" {
+		return 0, fmt.Errorf("missing duration, e.g. /api/delay/2s")
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		seconds, serr := strconv.ParseFloat(raw, 64)
+		if serr != nil {
+			return 0, fmt.Errorf("invalid duration %q", raw)
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration must not be negative")
+	}
+	return d, nil
+}
+
+type StatusCodeResponse struct {
+	Status   int    `json:"status"`
+	Message  string `json:"message"`
+	Hostname string `json:"hostname"`
+}
+
+// StatusCode serves /api/status/{code}, answering with the requested
+// status so ingress error pages, alerting rules and error-rate based canary
+// analysis can be exercised without code changes.
+func StatusCode(hostname string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := router.Param(r, "code")
+		code, err := strconv.Atoi(raw)
+		if err != nil || code < 200 || code > 599 {
+			problem.Error(w, r, i18n.T(r.Context(), "error.invalid_status_code", raw), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		// These statuses must not carry a body.
+		if code == http.StatusNoContent || code == http.StatusNotModified {
+			return
+		}
+		message := http.StatusText(code)
+		if message == "" {
+			message = i18n.T(r.Context(), "status.custom")
+		}
+		if err := json.NewEncoder(w).Encode(StatusCodeResponse{
+			Status:   code,
+			Message:  message,
+			Hostname: hostname,
+		}); err != nil {
+			log.Printf("Error encoding status response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// maxEchoBody bounds how much of the request body is echoed back.
+const maxEchoBody = 64 << 10
+
+type EchoResponse struct {
+	Method        string              `json:"method"`
+	Path          string              `json:"path"`
+	Query         map[string][]string `json:"query"`
+	Headers       map[string][]string `json:"headers"`
+	Host          string              `json:"host"`
+	Protocol      string              `json:"protocol"`
+	ClientIP      string              `json:"client_ip"`
+	RemoteAddr    string              `json:"remote_addr"`
+	Body          string              `json:"body"`
+	BodyBase64    bool                `json:"body_base64,omitempty"`
+	BodyTruncated bool                `json:"body_truncated,omitempty"`
+	JSON          any                 `json:"json,omitempty"`
+	Hostname      string              `json:"hostname"`
+}
+
+// Echo returns the request as received, httpbin-style, which shows
+// what the ingress controller and mesh sidecars add or strip on the way in.
+func Echo(hostname string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxEchoBody+1))
+		if err != nil {
+			problem.Error(w, r, i18n.T(r.Context(), "error.read_body", err), http.StatusBadRequest)
+			return
+		}
+
+		resp := EchoResponse{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      r.URL.Query(),
+			Headers:    r.Header,
+			Host:       r.Host,
+			Protocol:   r.Proto,
+			ClientIP:   ClientIP(r),
+			RemoteAddr: r.RemoteAddr,
+			Hostname:   hostname,
+		}
+		if len(body) > maxEchoBody {
+			body, resp.BodyTruncated = body[:maxEchoBody], true
+		}
+		if utf8.Valid(body) {
+			resp.Body = string(body)
+		} else {
+			resp.Body, resp.BodyBase64 = base64.StdEncoding.EncodeToString(body), true
+		}
+		if !resp.BodyTruncated && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			var parsed any
+			if json.Unmarshal(body, &parsed) == nil {
+				resp.JSON = parsed
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding echo response: %v", err)
+		}
+	}
+}
+
+// ClientIP returns the originating client address as the request claims
+// it: the first entry of X-Forwarded-For, then X-Real-IP, then the peer
+// address. Any client can set those headers, so nothing that limits or
+// records clients should use it; see TrustedClientIP.
+func ClientIP(r *http.Request) string {
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		first, _, _ := strings.Cut(xff, ",")
+		return strings.TrimSpace(first)
+	}
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	return peerIP(r)
+}
+
+// TrustedClientIP returns the client address of r as far as the proxies
+// in trusted vouch for it. A peer that isn't a trusted proxy is the client.
+// Otherwise it's the last X-Forwarded-For entry, counting from the peer,
+// that isn't a trusted proxy itself, or else X-Real-IP; entries further
+// along were written by the client and are ignored.
+func TrustedClientIP(r *http.Request, trusted []netip.Prefix) string {
+	peer := peerIP(r)
+	if !isTrusted(peer, trusted) {
+		return peer
+	}
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	for i := len(hops) - 1; i > 0; i-- {
+		if !isTrusted(hops[i], trusted) {
+			return hops[i]
+		}
+	}
+	if len(hops) > 0 {
+		return hops[0]
+	}
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); ip != "" {
+		return ip
+	}
+	return peer
+}
+
+func isTrusted(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerIP is the host of the address the request came from.
+func peerIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+func FuzzParseDelay(f *testing.F) {
+	for _, seed := range []string{"", "2s", "500ms", "1.5", "-1s", "1e308", "NaN", "1h2m3s", "9999999999h"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		d, err := parseDelay(raw)
+		if err == nil && d < 0 {
+			t.Errorf("parseDelay(%q) = %s, want a non-negative duration", raw, d)
+		}
+	})
+}
+
+func FuzzStatusCode(f *testing.F) {
+	for _, seed := range []string{"200", "418", "599", "600", "0", "-1", "abc", "2e2", "0x1F4", " 200"} {
+		f.Add(seed)
+	}
+	h := StatusCode("fuzz")
+	f.Fuzz(func(t *testing.T, raw string) {
+		req := router.WithParams(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"code": raw})
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusBadRequest && (rec.Code < 200 || rec.Code > 599) {
+			t.Errorf("status %d for %q", rec.Code, raw)
+		}
+	})
+}
+
+// FuzzEcho checks any request body is echoed back intact as valid JSON.
+func FuzzEcho(f *testing.F) {
+	f.Add([]byte("hello"), "text/plain", "a=1")
+	f.Add([]byte(`{"a":[1,2,{"b":null}]}`), "application/json", "")
+	f.Add([]byte{0xff, 0x00, 0xfe}, "application/octet-stream", "%zz")
+	f.Add([]byte(`{"unterminated":`), "application/json; charset=utf-8", "x=&y")
+	h := Echo("fuzz")
+	f.Fuzz(func(t *testing.T, body []byte, contentType, rawQuery string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/echo", bytes.NewReader(body))
+		req.URL.RawQuery = rawQuery
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d", rec.Code)
+		}
+		var resp EchoResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response is not valid JSON: %v", err)
+		}
+		if resp.BodyTruncated {
+			return
+		}
+		echoed := []byte(resp.Body)
+		if resp.BodyBase64 {
+			var err error
+			if echoed, err = base64.StdEncoding.DecodeString(resp.Body); err != nil {
+				t.Fatalf("invalid base64 body: %v", err)
+			}
+		}
+		if !bytes.Equal(echoed, body) {
+			t.Errorf("echoed body %q, sent %q", echoed, body)
+		}
+	})
+}
+
+func FuzzClientIP(f *testing.F) {
+	f.Add("198.51.100.1, 10.0.0.1", "", "10.0.0.1:1234")
+	f.Add("", "192.0.2.7", "[::1]:80")
+	f.Add(",,,", "", "garbage")
+	f.Fuzz(func(t *testing.T, forwardedFor, realIP, remoteAddr string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set("X-Real-IP", realIP)
+		req.RemoteAddr = remoteAddr
+		_ = ClientIP(req)
+	})
+}
+
+// FuzzDelayPath checks arbitrary path segments are routed and then rejected
+// or served, never slept on past the cap.
+func FuzzDelayPath(f *testing.F) {
+	for _, seed := range []string{"1ms", "0", "1h", "%2F", "../../etc"} {
+		f.Add(seed)
+	}
+	rt := router.New()
+	rt.Handle(router.Route{Pattern: "/api/delay/{duration}", Handler: Delay("fuzz", 5*time.Millisecond)})
+	f.Fuzz(func(t *testing.T, raw string) {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.URL.Path = "/api/delay/" + raw
+		req.URL.RawPath = "/api/delay/" + url.PathEscape(raw)
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		rt.ServeHTTP(rec, req)
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("delay of %q took %s despite the 5ms cap", raw, elapsed)
+		}
+		if rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest && rec.Code != http.StatusNotFound {
+			t.Errorf("status = %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// withParam sets path parameter name to the path after prefix, as the router
+// would.
+func withParam(r *http.Request, name, prefix string) *http.Request {
+	return router.WithParams(r, map[string]string{name: strings.TrimPrefix(r.URL.Path, prefix)})
+}
+
+// decodeStrict decodes a JSON response into out, failing on fields the
+// response type doesn't declare so schema changes are caught.
+func decodeStrict(t *testing.T, rec *httptest.ResponseRecorder, out any) {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", ct)
+	}
+	dec := json.NewDecoder(rec.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		t.Fatalf("decoding %T: %v", out, err)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Health("v1.2.3")(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	var resp HealthResponse
+	decodeStrict(t, rec, &resp)
+	if resp.Status != "healthy" {
+		t.Errorf("status = %q, want healthy", resp.Status)
+	}
+	if _, err := time.Parse(time.RFC3339, resp.Timestamp); err != nil {
+		t.Errorf("timestamp %q is not RFC 3339: %v", resp.Timestamp, err)
+	}
+	start, err := time.Parse(time.RFC3339, resp.StartTime)
+	if err != nil || start.After(time.Now()) {
+		t.Errorf("start_time %q is not a past RFC 3339 time: %v", resp.StartTime, err)
+	}
+	if resp.UptimeSeconds < 0 || resp.Version != "v1.2.3" {
+		t.Errorf("uptime %v, version %q", resp.UptimeSeconds, resp.Version)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	build := config.BuildInfo{Version: "v1.2.3", BuildTime: "2024-01-01T00:00:00Z", GitCommit: "abc123",
+		GitBranch: "main", GitTag: "v1.2.3", GitDirty: true, BuildUser: "ci", GoVersion: "go1.21.5", Platform: "linux/amd64",
+		ModulePath: "example.com/backend", ModuleVersion: "(devel)"}
+	rec := httptest.NewRecorder()
+	Version(build)(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var resp VersionResponse
+	decodeStrict(t, rec, &resp)
+	want := VersionResponse{Version: "v1.2.3", BuildTime: "2024-01-01T00:00:00Z", GitCommit: "abc123",
+		GitBranch: "main", GitTag: "v1.2.3", GitDirty: true, BuildUser: "ci", GoVersion: "go1.21.5", Platform: "linux/amd64",
+		Module: &VersionModule{Path: "example.com/backend", Version: "(devel)"}}
+	if !reflect.DeepEqual(resp, want) {
+		t.Errorf("got %+v, want %+v", resp, want)
+	}
+
+	// Binaries built from a checkout report its VCS information.
+	build.VCS, build.VCSRevision, build.VCSModified = "git", "abc123def", true
+	rec = httptest.NewRecorder()
+	Version(build)(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	decodeStrict(t, rec, &resp)
+	if resp.VCS == nil || *resp.VCS != (VersionVCS{System: "git", Revision: "abc123def", Modified: true}) {
+		t.Errorf("vcs = %+v", resp.VCS)
+	}
+}
+
+func TestInfo(t *testing.T) {
+	tests := []struct {
+		name         string
+		region, zone string
+		message      string
+		extended     bool
+		pod          bool
+		fields       bool
+	}{
+		{name: "topology unknown"},
+		{name: "topology resolved", region: "eu-west-1", zone: "eu-west-1a"},
+		{name: "message overridden", message: "Hello from staging"},
+		{name: "extended", extended: true},
+		{name: "in a pod", pod: true},
+		{name: "templated fields", fields: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ic := InfoConfig{
+				ServiceName: "backend-service",
+				Environment: "staging",
+				Hostname:    "pod-1",
+				Build:       config.BuildInfo{Version: "v1.2.3", GitCommit: "abc123"},
+				Labels:      func() map[string]string { return map[string]string{"track": "canary"} },
+				Topology:    func() (string, string) { return tt.region, tt.zone },
+				Message:     func(context.Context, TemplateData) string { return tt.message },
+				Extended:    func() bool { return tt.extended },
+			}
+			if tt.fields {
+				ic.Fields = func(data TemplateData) map[string]string {
+					return map[string]string{"banner": data.Environment + " " + data.Version + " on " + data.Hostname}
+				}
+			}
+			if tt.pod {
+				ic.Pod = InfoPod{Name: "pod-1", Namespace: "staging", NodeName: "node-a", IP: "10.0.0.7"}
+			}
+			h := Info(ic)
+			rec := httptest.NewRecorder()
+			h(rec, httptest.NewRequest(http.MethodGet, "/api/info", nil))
+
+			var resp InfoResponse
+			decodeStrict(t, rec, &resp)
+			want := InfoResponse{
+				Service:     "backend-service",
+				Environment: "staging",
+				Hostname:    "pod-1",
+				Region:      tt.region,
+				Zone:        tt.zone,
+				Message:     "Welcome to the GitOps Demo API",
+			}
+			if tt.message != "" {
+				want.Message = tt.message
+			}
+			if tt.extended {
+				if resp.Build == nil || resp.Build.Version != "v1.2.3" || resp.Build.GitCommit != "abc123" {
+					t.Fatalf("build = %+v, want the build while extended", resp.Build)
+				}
+				want.Build = resp.Build
+			}
+			if tt.pod {
+				wantPod := InfoPod{Name: "pod-1", Namespace: "staging", NodeName: "node-a", IP: "10.0.0.7",
+					Labels: map[string]string{"track": "canary"}}
+				if resp.Pod == nil || !reflect.DeepEqual(*resp.Pod, wantPod) {
+					t.Fatalf("pod = %+v, want %+v", resp.Pod, wantPod)
+				}
+				want.Pod = resp.Pod
+			}
+			if tt.fields {
+				want.Fields = map[string]string{"banner": "staging v1.2.3 on pod-1"}
+			}
+			if !reflect.DeepEqual(resp, want) {
+				t.Errorf("got %+v, want %+v", resp, want)
+			}
+		})
+	}
+}
+
+func TestEcho(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		check       func(t *testing.T, resp EchoResponse)
+	}{
+		{
+			name: "text body",
+			body: []byte("hello"),
+			check: func(t *testing.T, resp EchoResponse) {
+				if resp.Body != "hello" || resp.BodyBase64 || resp.JSON != nil {
+					t.Errorf("got body %q base64=%t json=%v", resp.Body, resp.BodyBase64, resp.JSON)
+				}
+			},
+		},
+		{
+			name:        "json body is parsed",
+			contentType: "application/json",
+			body:        []byte(`{"a":1}`),
+			check: func(t *testing.T, resp EchoResponse) {
+				parsed, ok := resp.JSON.(map[string]any)
+				if !ok || parsed["a"] != float64(1) {
+					t.Errorf("json = %#v, want map with a=1", resp.JSON)
+				}
+			},
+		},
+		{
+			name: "binary body is base64 encoded",
+			body: []byte{0xff, 0xfe, 0x00},
+			check: func(t *testing.T, resp EchoResponse) {
+				if !resp.BodyBase64 || resp.Body != "//4A" {
+					t.Errorf("got body %q base64=%t", resp.Body, resp.BodyBase64)
+				}
+			},
+		},
+		{
+			name: "large body is truncated",
+			body: bytes.Repeat([]byte("x"), maxEchoBody+10),
+			check: func(t *testing.T, resp EchoResponse) {
+				if !resp.BodyTruncated || len(resp.Body) != maxEchoBody {
+					t.Errorf("got %d bytes truncated=%t", len(resp.Body), resp.BodyTruncated)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/echo?x=1&x=2", bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rec := httptest.NewRecorder()
+			Echo("pod-1")(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", rec.Code)
+			}
+			var resp EchoResponse
+			decodeStrict(t, rec, &resp)
+			if resp.Method != http.MethodPost || resp.Path != "/api/echo" || resp.Hostname != "pod-1" {
+				t.Errorf("got method %q path %q hostname %q", resp.Method, resp.Path, resp.Hostname)
+			}
+			if got := resp.Query["x"]; len(got) != 2 {
+				t.Errorf("query x = %v, want two values", got)
+			}
+			tt.check(t, resp)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{name: "peer address", remote: "10.0.0.1:1234", want: "10.0.0.1"},
+		{name: "peer without port", remote: "10.0.0.1", want: "10.0.0.1"},
+		{name: "real ip", headers: map[string]string{"X-Real-IP": "192.0.2.7"}, remote: "10.0.0.1:1234", want: "192.0.2.7"},
+		{
+			name:    "first forwarded-for entry wins",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.2", "X-Real-IP": "192.0.2.7"},
+			remote:  "10.0.0.1:1234",
+			want:    "198.51.100.1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrustedClientIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+	tests := []struct {
+		name    string
+		headers map[string]string
+		remote  string
+		want    string
+	}{
+		{name: "untrusted peer", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, remote: "192.0.2.1:1234", want: "192.0.2.1"},
+		{name: "trusted peer", headers: map[string]string{"X-Forwarded-For": "198.51.100.1"}, remote: "10.0.0.1:1234", want: "198.51.100.1"},
+		{
+			name:    "entries written by the client are skipped",
+			headers: map[string]string{"X-Forwarded-For": "203.0.113.9, 198.51.100.1, 10.0.0.2"},
+			remote:  "10.0.0.1:1234",
+			want:    "198.51.100.1",
+		},
+		{name: "only proxies", headers: map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"}, remote: "10.0.0.1:1234", want: "10.0.0.3"},
+		{name: "real ip from a trusted peer", headers: map[string]string{"X-Real-IP": "192.0.2.7"}, remote: "10.0.0.1:1234", want: "192.0.2.7"},
+		{name: "real ip from an untrusted peer", headers: map[string]string{"X-Real-IP": "192.0.2.7"}, remote: "192.0.2.1:1234", want: "192.0.2.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			if got := TrustedClientIP(req, trusted); got != tt.want {
+				t.Errorf("TrustedClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantStatus int
+		wantCapped bool
+	}{
+		{path: "/api/delay/10ms", wantStatus: http.StatusOK},
+		{path: "/api/delay/0.01", wantStatus: http.StatusOK},
+		{path: "/api/delay/1h", wantStatus: http.StatusOK, wantCapped: true},
+		{path: "/api/delay/", wantStatus: http.StatusBadRequest},
+		{path: "/api/delay/soon", wantStatus: http.StatusBadRequest},
+		{path: "/api/delay/-1s", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := withParam(httptest.NewRequest(http.MethodGet, tt.path, nil), "duration", "/api/delay/")
+			Delay("pod-1", 20*time.Millisecond)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var resp DelayResponse
+			decodeStrict(t, rec, &resp)
+			if resp.Capped != tt.wantCapped {
+				t.Errorf("capped = %t, want %t", resp.Capped, tt.wantCapped)
+			}
+		})
+	}
+}
+
+func TestDelayCancelledByClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	req := withParam(httptest.NewRequest(http.MethodGet, "/api/delay/10s", nil).WithContext(ctx), "duration", "/api/delay/")
+	rec := httptest.NewRecorder()
+
+	done := make(chan struct{})
+	go func() {
+		Delay("pod-1", time.Minute)(rec, req)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("delay did not stop when the client went away")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("cancelled delay wrote %q", rec.Body.String())
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantMessage string
+	}{
+		{path: "/api/status/200", wantStatus: 200, wantMessage: "OK"},
+		{path: "/api/status/418", wantStatus: 418, wantMessage: "I'm a teapot"},
+		{path: "/api/status/503", wantStatus: 503, wantMessage: "Service Unavailable"},
+		{path: "/api/status/299", wantStatus: 299, wantMessage: "Custom status"},
+		{path: "/api/status/204", wantStatus: 204},
+		{path: "/api/status/304", wantStatus: 304},
+		{path: "/api/status/199", wantStatus: http.StatusBadRequest},
+		{path: "/api/status/600", wantStatus: http.StatusBadRequest},
+		{path: "/api/status/teapot", wantStatus: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			StatusCode("pod-1")(rec, withParam(httptest.NewRequest(http.MethodGet, tt.path, nil), "code", "/api/status/"))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			switch {
+			case tt.wantStatus == http.StatusBadRequest:
+			case tt.wantMessage == "":
+				if rec.Body.Len() != 0 {
+					t.Errorf("status %d must not have a body, got %q", rec.Code, rec.Body.String())
+				}
+			default:
+				var resp StatusCodeResponse
+				decodeStrict(t, rec, &resp)
+				if resp.Status != tt.wantStatus || resp.Message != tt.wantMessage {
+					t.Errorf("got %+v", resp)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigAuthorization(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		header     string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "disabled without token", header: "Bearer anything", wantStatus: http.StatusForbidden},
+		{name: "missing credentials", adminToken: "s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: "s3cret", header: "Bearer nope", wantStatus: http.StatusUnauthorized},
+		{name: "wrong scheme", adminToken: "s3cret", header: "Basic s3cret", wantStatus: http.StatusUnauthorized},
+		{name: "valid token", adminToken: "s3cret", header: "Bearer s3cret", wantStatus: http.StatusOK},
+		{name: "valid API key", adminToken: "s3cret", apiKey: "s3cret", wantStatus: http.StatusOK},
+		{name: "wrong API key", adminToken: "s3cret", apiKey: "nope", header: "Bearer s3cret", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			rec := httptest.NewRecorder()
+			if AuthorizedAdmin(rec, req, Token(tt.adminToken)) {
+				Config("backend-service", "v1", "pod-1", nil)(rec, req)
+			}
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestConfigRedactsEnvironment(t *testing.T) {
+	t.Setenv("DEMO_API_TOKEN", "token-value")
+	t.Setenv("DEMO_DATABASE_URL", "postgres://app:pw@db:5432/app")
+	t.Setenv("DEMO_PLAIN", "visible")
+	t.Setenv("OTHER_SETTING", "hidden")
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	Config("backend-service", "v1", "pod-1", []string{"DEMO_"})(rec, req)
+
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	body := rec.Body.String()
+	if strings.Contains(body, "token-value") || strings.Contains(body, ":pw@") {
+		t.Error("response leaks a secret")
+	}
+	var resp ConfigResponse
+	decodeStrict(t, rec, &resp)
+	want := map[string]string{
+		"DEMO_API_TOKEN":    config.Redacted,
+		"DEMO_DATABASE_URL": "postgres://" + config.Redacted + "@db:5432/app",
+		"DEMO_PLAIN":        "visible",
+	}
+	if len(resp.Environment) != len(want) {
+		t.Errorf("environment = %v, want only DEMO_ variables", resp.Environment)
+	}
+	for k, v := range want {
+		if resp.Environment[k] != v {
+			t.Errorf("%s = %q, want %q", k, resp.Environment[k], v)
+		}
+	}
+}
+
+func TestEnvRedactsPatterns(t *testing.T) {
+	// Registered first, so it runs after the variables are restored.
+	t.Cleanup(func() { _, _ = config.Load() })
+	t.Setenv("CONFIG_REDACT_PATTERNS", "*_dsn, DEMO_SALT")
+	if _, err := config.Load(); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DEMO_API_TOKEN", "token-value")
+	t.Setenv("DEMO_SENTRY_DSN", "dsn-value")
+	t.Setenv("DEMO_SALT", "salt-value")
+	t.Setenv("DEMO_EMPTY_PASSWORD", "")
+	t.Setenv("DEMO_PLAIN", "visible")
+
+	rec := httptest.NewRecorder()
+	Env("backend-service", "pod-1")(rec, httptest.NewRequest(http.MethodGet, "/admin/env", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", got)
+	}
+	body := rec.Body.String()
+	for _, secret := range []string{"token-value", "dsn-value", "salt-value"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("response leaks %s", secret)
+		}
+	}
+	var resp EnvResponse
+	decodeStrict(t, rec, &resp)
+	if resp.Environment["DEMO_PLAIN"] != "visible" || resp.Environment["DEMO_SALT"] != config.Redacted ||
+		resp.Environment["CONFIG_REDACT_PATTERNS"] != "*_dsn, DEMO_SALT" {
+		t.Errorf("environment = %v", resp.Environment)
+	}
+	var demo []string
+	for _, key := range resp.Redacted {
+		if strings.HasPrefix(key, "DEMO_") {
+			demo = append(demo, key)
+		}
+	}
+	if want := []string{"DEMO_API_TOKEN", "DEMO_SALT", "DEMO_SENTRY_DSN"}; !reflect.DeepEqual(demo, want) {
+		t.Errorf("redacted = %v, want %v", demo, want)
+	}
+}
@@ -0,0 +1,286 @@
+// Package handlers contains the HTTP handlers that don't depend on the
+// server's background components, so they can be reused by other binaries
+// and tested in isolation.
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+)
+
+// StartTime is when the process started, as near as a package variable
+// can tell.
+var StartTime = time.Now()
+
+// HealthResponse is the body of the liveness and readiness probes. The
+// start time and version tell at a glance whether the pod just restarted or
+// was replaced by a rollout.
+type HealthResponse struct {
+	Status        string  `json:"status"`
+	Timestamp     string  `json:"timestamp"`
+	StartTime     string  `json:"start_time"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+	Version       string  `json:"version"`
+}
+
+// NewHealthResponse returns a probe response for status at the current
+// time.
+func NewHealthResponse(status, version string) HealthResponse {
+	now := time.Now()
+	return HealthResponse{
+		Status:        status,
+		Timestamp:     now.UTC().Format(time.RFC3339),
+		StartTime:     StartTime.UTC().Format(time.RFC3339),
+		UptimeSeconds: math.Round(now.Sub(StartTime).Seconds()*1000) / 1000,
+		Version:       version,
+	}
+}
+
+type VersionResponse struct {
+	Version   string `json:"version"`
+	BuildTime string `json:"build_time"`
+	GitCommit string `json:"git_commit"`
+	GitBranch string `json:"git_branch,omitempty"`
+	GitTag    string `json:"git_tag,omitempty"`
+	// GitDirty: the tree had uncommitted changes when it was built
+	GitDirty  bool   `json:"git_dirty"`
+	BuildUser string `json:"build_user,omitempty"`
+	// GoVersion is the toolchain that built the binary, like "go1.21.5"
+	GoVersion string         `json:"go_version"`
+	Platform  string         `json:"platform"`
+	Module    *VersionModule `json:"module,omitempty"`
+	// VCS is left out for binaries built outside a checkout
+	VCS *VersionVCS `json:"vcs,omitempty"`
+}
+
+// VersionModule is the main module of the binary.
+type VersionModule struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+	Sum     string `json:"sum,omitempty"`
+}
+
+// VersionVCS is the version control information the go command embedded
+// in the binary.
+type VersionVCS struct {
+	System   string `json:"system"`
+	Revision string `json:"revision"`
+	Time     string `json:"time,omitempty"`
+	Modified bool   `json:"modified"`
+}
+
+// InfoResponse is the version 1 shape of /api/info.
+type InfoResponse struct {
+	Service     string     `json:"service"`
+	Environment string     `json:"environment"`
+	Hostname    string     `json:"hostname"`
+	Track       string     `json:"track,omitempty"`
+	Region      string     `json:"region,omitempty"`
+	Zone        string     `json:"zone,omitempty"`
+	Message     string     `json:"message"`
+	Pod         *InfoPod   `json:"pod,omitempty"`
+	Build       *InfoBuild `json:"build,omitempty"`
+	// Fields rendered from the INFO_FIELDS templates
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// InfoResponseV2 groups the placement fields and always includes them.
+type InfoResponseV2 struct {
+	Service     string     `json:"service"`
+	Environment string     `json:"environment"`
+	Hostname    string     `json:"hostname"`
+	Track       string     `json:"track,omitempty"`
+	Topology    Topology   `json:"topology"`
+	Message     string     `json:"message"`
+	Pod         *InfoPod   `json:"pod,omitempty"`
+	Build       *InfoBuild `json:"build,omitempty"`
+	// Fields rendered from the INFO_FIELDS templates
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// InfoPod identifies the replica that served the request, from the
+// downward API; it is left out outside a pod.
+type InfoPod struct {
+	Name      string            `json:"name"`
+	Namespace string            `json:"namespace"`
+	NodeName  string            `json:"node_name,omitempty"`
+	IP        string            `json:"ip"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// InfoBuild is only included while the extended-info feature flag is on.
+type InfoBuild struct {
+	Version       string  `json:"version"`
+	GitCommit     string  `json:"git_commit"`
+	UptimeSeconds float64 `json:"uptime_seconds"`
+}
+
+type Topology struct {
+	Region string `json:"region"`
+	Zone   string `json:"zone"`
+}
+
+// Health is the liveness probe of the given build version.
+func Health(version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(NewHealthResponse("healthy", version)); err != nil {
+			log.Printf("Error encoding health response: %v", err)
+		}
+	}
+}
+
+// Version reports the build information of the running binary.
+func Version(build config.BuildInfo) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		resp := VersionResponse{
+			Version:   build.Version,
+			BuildTime: build.BuildTime,
+			GitCommit: build.GitCommit,
+			GitBranch: build.GitBranch,
+			GitTag:    build.GitTag,
+			GitDirty:  build.GitDirty,
+			BuildUser: build.BuildUser,
+			GoVersion: build.GoVersion,
+			Platform:  build.Platform,
+		}
+		if build.ModulePath != "" {
+			resp.Module = &VersionModule{Path: build.ModulePath, Version: build.ModuleVersion, Sum: build.ModuleSum}
+		}
+		if build.VCS != "" {
+			resp.VCS = &VersionVCS{System: build.VCS, Revision: build.VCSRevision, Time: build.VCSTime, Modified: build.VCSModified}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding version response: %v", err)
+		}
+	}
+}
+
+// InfoConfig is what Info reports. The functions are called on every
+// request, as their answers change at runtime.
+type InfoConfig struct {
+	ServiceName string
+	Environment string
+	Hostname    string
+	// Track is the rollout track, like stable or canary; left out when empty
+	Track string
+	Build config.BuildInfo
+	// Pod is reported when its name is set, with the labels of Labels.
+	Pod    InfoPod
+	Labels func() map[string]string
+	// Topology returns the node's region and zone, which are empty until
+	// resolved.
+	Topology func() (region, zone string)
+	// Message overrides the localized welcome message when it returns
+	// anything; data is what a templated message can refer to.
+	Message func(ctx context.Context, data TemplateData) string
+	// Fields returns extra fields of the response, rendered with data; they
+	// are left out when it returns none.
+	Fields func(data TemplateData) map[string]string
+	// Extended adds the build to the response.
+	Extended func() bool
+}
+
+// TemplateData is what the templates of the welcome message and of the
+// extra fields of /api/info refer to, as in {{.Environment}}.
+type TemplateData struct {
+	Service     string
+	Environment string
+	Version     string
+	GitCommit   string
+	Hostname    string
+	// Track is the rollout track, empty when unset
+	Track     string
+	Region    string
+	Zone      string
+	Pod       string
+	Namespace string
+}
+
+// TemplateData is the data of the templates for the replica c describes,
+// in its current topology.
+func (c InfoConfig) TemplateData() TemplateData {
+	region, zone := c.Topology()
+	return TemplateData{
+		Service:     c.ServiceName,
+		Environment: c.Environment,
+		Version:     c.Build.Version,
+		GitCommit:   c.Build.GitCommit,
+		Hostname:    c.Hostname,
+		Track:       c.Track,
+		Region:      region,
+		Zone:        zone,
+		Pod:         c.Pod.Name,
+		Namespace:   c.Pod.Namespace,
+	}
+}
+
+// Info describes the service.
+func Info(c InfoConfig) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := c.TemplateData()
+		msg := c.Message(r.Context(), data)
+		if msg == "" {
+			msg = i18n.T(r.Context(), "info.welcome")
+		}
+		var fields map[string]string
+		if c.Fields != nil {
+			fields = c.Fields(data)
+		}
+		var pod *InfoPod
+		if c.Pod.Name != "" {
+			p := c.Pod
+			p.Labels = c.Labels()
+			pod = &p
+		}
+		var build *InfoBuild
+		if c.Extended() {
+			build = &InfoBuild{
+				Version:       c.Build.Version,
+				GitCommit:     c.Build.GitCommit,
+				UptimeSeconds: math.Round(time.Since(StartTime).Seconds()*1000) / 1000,
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		var resp any
+		if apiversion.FromContext(r.Context()) >= 2 {
+			resp = InfoResponseV2{
+				Service:     c.ServiceName,
+				Environment: c.Environment,
+				Hostname:    c.Hostname,
+				Track:       c.Track,
+				Topology:    Topology{Region: data.Region, Zone: data.Zone},
+				Message:     msg,
+				Pod:         pod,
+				Build:       build,
+				Fields:      fields,
+			}
+		} else {
+			resp = InfoResponse{
+				Service:     c.ServiceName,
+				Environment: c.Environment,
+				Hostname:    c.Hostname,
+				Track:       c.Track,
+				Region:      data.Region,
+				Zone:        data.Zone,
+				Message:     msg,
+				Pod:         pod,
+				Build:       build,
+				Fields:      fields,
+			}
+		}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding info response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+// Package i18n localizes the user-facing messages of the API.
+//
+// A catalog is a JSON object mapping message keys to fmt format strings, one
+// file per language (en.json, de.json, ...). The catalogs compiled into the
+// binary can be extended or overridden by files in a directory, typically a
+// ConfigMap mounted by the GitOps repo, so an environment can change its
+// wording or add a language without a new image. The language of a request
+// is negotiated from Accept-Language, falling back to the configured default
+// and finally to English.
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Fallback is the language every message key is defined in.
+const Fallback = "en"
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// builtin localizes messages outside a negotiated request.
+var builtin = mustNew(Fallback, "")
+
+// Bundle holds the catalogs of every supported language.
+type Bundle struct {
+	defaultLang string
+	catalogs    map[string]map[string]string
+}
+
+// New loads the embedded catalogs, then the *.json catalogs in dir on top of
+// them, key by key. A missing dir is not an error, so the ConfigMap mount can
+// be optional. defaultLang must have a catalog.
+func New(defaultLang, dir string) (*Bundle, error) {
+	b := &Bundle{defaultLang: normalize(defaultLang), catalogs: make(map[string]map[string]string)}
+	if b.defaultLang == "" {
+		b.defaultLang = Fallback
+	}
+	if err := b.load(locales, "locales"); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		err := b.load(os.DirFS(dir), ".")
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if _, ok := b.catalogs[b.defaultLang]; !ok {
+		return nil, fmt.Errorf("no message catalog for default language %q (available: %s)",
+			b.defaultLang, strings.Join(b.Languages(), ", "))
+	}
+	return b, nil
+}
+
+func mustNew(defaultLang, dir string) *Bundle {
+	b, err := New(defaultLang, dir)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (b *Bundle) load(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		// Glob doesn't report a missing directory.
+		if _, err := fs.Stat(fsys, dir); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			return fmt.Errorf("message catalog %s: %w", file, err)
+		}
+		lang := normalize(strings.TrimSuffix(path.Base(file), ".json"))
+		if b.catalogs[lang] == nil {
+			b.catalogs[lang] = make(map[string]string, len(messages))
+		}
+		for key, msg := range messages {
+			b.catalogs[lang][key] = msg
+		}
+	}
+	return nil
+}
+
+// Default returns the language used when the client doesn't ask for one we
+// have.
+func (b *Bundle) Default() string {
+	return b.defaultLang
+}
+
+// Languages returns the languages with a catalog, sorted.
+func (b *Bundle) Languages() []string {
+	langs := make([]string, 0, len(b.catalogs))
+	for lang := range b.catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Match picks the best language for an Accept-Language header value. A tag
+// matches its own catalog or, failing that, the catalog of its primary
+// language ("de-AT" uses "de").
+func (b *Bundle) Match(acceptLanguage string) string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var ranges []weighted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag = normalize(tag); tag != "" && q > 0 {
+			ranges = append(ranges, weighted{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	for _, r := range ranges {
+		if r.tag == "*" {
+			return b.defaultLang
+		}
+		if _, ok := b.catalogs[r.tag]; ok {
+			return r.tag
+		}
+		if primary, _, ok := strings.Cut(r.tag, "-"); ok {
+			if _, ok := b.catalogs[primary]; ok {
+				return primary
+			}
+		}
+	}
+	return b.defaultLang
+}
+
+// Sprintf formats the message key in lang. Keys missing from lang fall back
+// to the default language, then to English, then to the key itself.
+func (b *Bundle) Sprintf(lang, key string, args ...any) string {
+	for _, l := range []string{lang, b.defaultLang, Fallback} {
+		if format, ok := b.catalogs[l][key]; ok {
+			return fmt.Sprintf(format, args...)
+		}
+	}
+	return key
+}
+
+type contextKey struct{}
+
+type localizer struct {
+	bundle *Bundle
+	lang   string
+}
+
+// Middleware negotiates the language of every request and stores it in the
+// request context for T.
+func (b *Bundle) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lang := b.Match(r.Header.Get("Accept-Language"))
+		w.Header().Add("Vary", "Accept-Language")
+		w.Header().Set("Content-Language", lang)
+		ctx := context.WithValue(r.Context(), contextKey{}, localizer{bundle: b, lang: lang})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// T formats the message key in the language negotiated for ctx, English
+// outside a negotiated request.
+func T(ctx context.Context, key string, args ...any) string {
+	if l, ok := ctx.Value(contextKey{}).(localizer); ok {
+		return l.bundle.Sprintf(l.lang, key, args...)
+	}
+	return builtin.Sprintf(Fallback, key, args...)
+}
+
+func normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
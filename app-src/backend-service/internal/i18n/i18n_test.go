@@ -0,0 +1,127 @@
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// TestCatalogsComplete keeps the embedded translations in step with English:
+// the same keys, taking the same verbs.
+func TestCatalogsComplete(t *testing.T) {
+	b := mustNew(Fallback, "")
+	verbs := regexp.MustCompile(`%[^%]`)
+	for _, lang := range b.Languages() {
+		for key, format := range b.catalogs[Fallback] {
+			msg, ok := b.catalogs[lang][key]
+			if !ok {
+				t.Errorf("%s: missing %q", lang, key)
+				continue
+			}
+			if got, want := verbs.FindAllString(msg, -1), verbs.FindAllString(format, -1); len(got) != len(want) {
+				t.Errorf("%s: %q has verbs %v, English has %v", lang, key, got, want)
+			}
+		}
+		for key := range b.catalogs[lang] {
+			if _, ok := b.catalogs[Fallback][key]; !ok {
+				t.Errorf("%s: %q is not an English message key", lang, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	b := mustNew("de", "")
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "de"},
+		{"es", "es"},
+		{"es-MX, en;q=0.5", "es"},
+		{"fr, en;q=0.8", "en"},
+		{"en;q=0.2, es;q=0.9", "es"},
+		{"es;q=0, en", "en"},
+		{"fr", "de"},
+		{"*", "de"},
+		{"EN_us", "en"},
+	}
+	for _, tt := range tests {
+		if got := b.Match(tt.accept); got != tt.want {
+			t.Errorf("Match(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestOverrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{"info.welcome": "Welcome to dev"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "fr.json"), []byte(`{"error.unauthorized": "non autorisé"}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b, err := New("fr", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Sprintf("en", "info.welcome"); got != "Welcome to dev" {
+		t.Errorf("overridden message = %q", got)
+	}
+	if got := b.Sprintf("en", "error.unauthorized"); got != "unauthorized" {
+		t.Errorf("message not in the override = %q, want the embedded one", got)
+	}
+	if got := b.Sprintf("fr", "error.unauthorized"); got != "non autorisé" {
+		t.Errorf("added language = %q", got)
+	}
+	// French has no welcome message: the default language is French too, so
+	// English is the last resort.
+	if got := b.Sprintf("fr", "info.welcome"); got != "Welcome to dev" {
+		t.Errorf("fallback = %q", got)
+	}
+	if got := b.Sprintf("fr", "no.such.key"); got != "no.such.key" {
+		t.Errorf("unknown key = %q", got)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	if _, err := New("en", filepath.Join(t.TempDir(), "missing")); err != nil {
+		t.Errorf("missing override directory: %v", err)
+	}
+	if _, err := New("fr", ""); err == nil {
+		t.Error("default language without a catalog accepted")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "en.json"), []byte(`{`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New("en", dir); err == nil {
+		t.Error("invalid catalog accepted")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	b := mustNew("en", "")
+	var msg string
+	h := b.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		msg = T(r.Context(), "error.invalid_status_code", "abc")
+	}))
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	h.ServeHTTP(rec, r)
+
+	if want := `ungültiger Statuscode "abc", erwartet wird 200-599`; msg != want {
+		t.Errorf("message = %q, want %q", msg, want)
+	}
+	if got := rec.Header().Get("Content-Language"); got != "de" {
+		t.Errorf("Content-Language = %q, want de", got)
+	}
+	if got := T(context.Background(), "error.unauthorized"); got != "unauthorized" {
+		t.Errorf("T outside a request = %q", got)
+	}
+}
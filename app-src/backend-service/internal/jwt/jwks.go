@@ -0,0 +1,209 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// keySetMaxAge is how long fetched keys are used before they're
+	// fetched again.
+	keySetMaxAge = 5 * time.Minute
+	// keySetMinInterval spaces fetches, so tokens naming unknown keys
+	// can't hammer the JWKS URL.
+	keySetMinInterval = 30 * time.Second
+	// keySetTimeout bounds a fetch.
+	keySetTimeout = 5 * time.Second
+	// keySetMaxBytes bounds the document read.
+	keySetMaxBytes = 1 << 20
+)
+
+// KeySet is the public keys a JWKS URL publishes (RFC 7517). They're fetched
+// on first use, again once they're older than keySetMaxAge, and as soon as a
+// token names a key the set lacks, which is how rotated keys are picked up.
+type KeySet struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	attempted time.Time
+	err       error
+}
+
+// NewKeySet returns the key set of url, fetched with client, or
+// http.DefaultClient when nil.
+func NewKeySet(url string, client *http.Client) *KeySet {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &KeySet{url: url, client: client}
+}
+
+// Key returns the key with ID kid; tokens without a kid may use a set of
+// one key.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	key, ok := ks.lookup(kid)
+	if (!ok || time.Since(ks.fetchedAt) > keySetMaxAge) && time.Since(ks.attempted) >= keySetMinInterval {
+		if err := ks.refresh(ctx); err != nil && !ok {
+			return nil, err
+		}
+		key, ok = ks.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds kid among the keys; ks.mu is held.
+func (ks *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// Refresh fetches the keys now.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return ks.refresh(ctx)
+}
+
+// Status returns the number of keys, when they were fetched and the error
+// of the last fetch.
+func (ks *KeySet) Status() (int, time.Time, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	return len(ks.keys), ks.fetchedAt, ks.err
+}
+
+// refresh fetches the keys, keeping the previous ones when it fails; ks.mu
+// is held.
+func (ks *KeySet) refresh(ctx context.Context) error {
+	ks.attempted = time.Now()
+	keys, err := ks.fetch(ctx)
+	ks.err = err
+	if err != nil {
+		return fmt.Errorf("fetching JWKS: %w", err)
+	}
+	ks.keys, ks.fetchedAt = keys, ks.attempted
+	return nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (ks *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(ctx, keySetTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, keySetMaxBytes)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(doc.Keys))
+	var errs []error
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("key %q: %w", k.Kid, err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.Join(append([]error{errors.New("no usable signing keys")}, errs...)...)
+	}
+	return keys, nil
+}
+
+var curves = map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,249 @@
+// Package jwt verifies JSON Web Tokens (RFC 7519) in compact JWS form,
+// signed with shared HMAC secrets (HS256, HS384, HS512) or with the RSA and
+// ECDSA keys a JWKS URL publishes (RS256-512, PS256-512, ES256-512).
+//
+// Several secrets can be valid at once, so a new one can be rolled out
+// before the old one is retired. Each algorithm only verifies with its own
+// kind of key: a token claiming HS256 is never checked against a public
+// key, whatever its "kid".
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors of Verify, wrapped with the details.
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid signature")
+	ErrExpired   = errors.New("token expired")
+	ErrClaims    = errors.New("invalid claims")
+)
+
+// Claims are the claims of a verified token.
+type Claims map[string]any
+
+// String returns the string claim name, empty when it isn't one.
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Subject returns the "sub" claim.
+func (c Claims) Subject() string { return c.String("sub") }
+
+// Issuer returns the "iss" claim.
+func (c Claims) Issuer() string { return c.String("iss") }
+
+// Audience returns the "aud" claim, a string or a list of them.
+func (c Claims) Audience() []string {
+	switch aud := c["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []any:
+		var out []string
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns the NumericDate claim name, and whether the token has it.
+func (c Claims) Time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	sec, frac := math.Modf(n)
+	return time.Unix(int64(sec), int64(frac*1e9)), true
+}
+
+// Config configures a Verifier.
+type Config struct {
+	// Secrets returns the shared secrets HMAC tokens may be signed with.
+	Secrets func() [][]byte
+	// Keys holds the public keys of asymmetric tokens; nil refuses them.
+	Keys *KeySet
+	// Issuer and Audience, when set, must match the "iss" claim and one
+	// of the "aud" claim.
+	Issuer   string
+	Audience string
+	// Leeway tolerates clock skew in the "exp" and "nbf" checks.
+	Leeway time.Duration
+}
+
+// Verifier checks tokens against a Config.
+type Verifier struct {
+	cfg Config
+	now func() time.Time
+}
+
+// New returns a Verifier of cfg.
+func New(cfg Config) *Verifier {
+	if cfg.Secrets == nil {
+		cfg.Secrets = func() [][]byte { return nil }
+	}
+	return &Verifier{cfg: cfg, now: time.Now}
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks the signature and the time, issuer and audience claims of
+// token, and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: want 3 parts, got %d", ErrMalformed, len(parts))
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrMalformed, err)
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrMalformed, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrMalformed, err)
+	}
+	if err := v.verifySignature(ctx, h, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// hashes maps the size in the name of an algorithm to its hash.
+var hashes = map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+
+func (v *Verifier) verifySignature(ctx context.Context, h header, input, sig []byte) error {
+	if len(h.Alg) != 5 || hashes[h.Alg[2:]] == 0 {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrSignature, h.Alg)
+	}
+	hash := hashes[h.Alg[2:]]
+	family := h.Alg[:2]
+
+	if family == "HS" {
+		secrets := v.cfg.Secrets()
+		if len(secrets) == 0 {
+			return fmt.Errorf("%w: no shared secret for %s", ErrSignature, h.Alg)
+		}
+		for _, secret := range secrets {
+			mac := hmac.New(hash.New, secret)
+			mac.Write(input)
+			if hmac.Equal(mac.Sum(nil), sig) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: no shared secret matches", ErrSignature)
+	}
+
+	if family != "RS" && family != "PS" && family != "ES" {
+		return fmt.Errorf("%w: unsupported algorithm %q", ErrSignature, h.Alg)
+	}
+	if v.cfg.Keys == nil {
+		return fmt.Errorf("%w: no JWKS for %s", ErrSignature, h.Alg)
+	}
+	key, err := v.cfg.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignature, err)
+	}
+	d := hash.New()
+	d.Write(input)
+	digest := d.Sum(nil)
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch family {
+		case "RS":
+			err = rsa.VerifyPKCS1v15(key, hash, digest, sig)
+		case "PS":
+			err = rsa.VerifyPSS(key, hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		default:
+			err = errors.New("key is RSA")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		switch {
+		case family != "ES":
+			err = errors.New("key is ECDSA")
+		case len(sig) != 2*size:
+			err = errors.New("wrong signature length")
+		case !ecdsa.Verify(key, digest, new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])):
+			err = errors.New("verification failed")
+		}
+	default:
+		err = fmt.Errorf("unsupported key %T", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %s key %q: %v", ErrSignature, h.Alg, h.Kid, err)
+	}
+	return nil
+}
+
+func (v *Verifier) checkClaims(c Claims) error {
+	now := v.now()
+	if exp, ok := c.Time("exp"); ok && !now.Before(exp.Add(v.cfg.Leeway)) {
+		return fmt.Errorf("%w at %s", ErrExpired, exp.UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := c.Time("nbf"); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return fmt.Errorf("%w: not valid before %s", ErrClaims, nbf.UTC().Format(time.RFC3339))
+	}
+	if v.cfg.Issuer != "" && c.Issuer() != v.cfg.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrClaims, c.Issuer())
+	}
+	if v.cfg.Audience != "" {
+		found := false
+		for _, aud := range c.Audience() {
+			found = found || aud == v.cfg.Audience
+		}
+		if !found {
+			return fmt.Errorf("%w: audience %q", ErrClaims, c.Audience())
+		}
+	}
+	return nil
+}
+
+type contextKey struct{}
+
+// NewContext returns ctx carrying the claims of the request's token.
+func NewContext(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, contextKey{}, c)
+}
+
+// FromContext returns the claims of the request's token, if it had one.
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(contextKey{}).(Claims)
+	return c, ok
+}
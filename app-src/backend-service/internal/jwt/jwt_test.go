@@ -0,0 +1,234 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// sign returns a token of claims signed with key: a []byte secret, an RSA
+// or an ECDSA private key.
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	input := segment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + segment(t, claims)
+	hash := hashes[alg[2:]]
+	var sig []byte
+	switch key := key.(type) {
+	case []byte:
+		mac := hmac.New(hash.New, key)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	default:
+		d := hash.New()
+		d.Write([]byte(input))
+		digest := d.Sum(nil)
+		var err error
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			if alg[:2] == "PS" {
+				sig, err = rsa.SignPSS(rand.Reader, key, hash, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+			} else {
+				sig, err = rsa.SignPKCS1v15(rand.Reader, key, hash, digest)
+			}
+		case *ecdsa.PrivateKey:
+			var r, s *big.Int
+			r, s, err = ecdsa.Sign(rand.Reader, key, digest)
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func TestVerifySecret(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secrets := [][]byte{[]byte("old"), []byte("new")}
+	v := New(Config{
+		Secrets:  func() [][]byte { return secrets },
+		Issuer:   "https://issuer.example",
+		Audience: "backend-service",
+		Leeway:   time.Minute,
+	})
+	v.now = func() time.Time { return now }
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub": "alice",
+			"iss": "https://issuer.example",
+			"aud": []string{"other", "backend-service"},
+			"exp": now.Add(time.Hour).Unix(),
+		}
+	}
+	with := func(name string, value any) map[string]any {
+		c := valid()
+		if value == nil {
+			delete(c, name)
+		} else {
+			c[name] = value
+		}
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256", sign(t, "HS256", "", []byte("new"), valid()), nil},
+		{"HS512 older secret", sign(t, "HS512", "", []byte("old"), valid()), nil},
+		{"unknown secret", sign(t, "HS256", "", []byte("other"), valid()), ErrSignature},
+		{"none", segment(t, map[string]string{"alg": "none"}) + "." + segment(t, valid()) + ".", ErrSignature},
+		{"RS256 without JWKS", segment(t, map[string]string{"alg": "RS256"}) + "." + segment(t, valid()) + ".AAAA", ErrSignature},
+		{"expired", sign(t, "HS256", "", []byte("new"), with("exp", now.Add(-2*time.Minute).Unix())), ErrExpired},
+		{"expired within leeway", sign(t, "HS256", "", []byte("new"), with("exp", now.Add(-30*time.Second).Unix())), nil},
+		{"not yet valid", sign(t, "HS256", "", []byte("new"), with("nbf", now.Add(2*time.Minute).Unix())), ErrClaims},
+		{"wrong issuer", sign(t, "HS256", "", []byte("new"), with("iss", "https://other.example")), ErrClaims},
+		{"wrong audience", sign(t, "HS256", "", []byte("new"), with("aud", "other")), ErrClaims},
+		{"audience string", sign(t, "HS256", "", []byte("new"), with("aud", "backend-service")), nil},
+		{"garbage", "not-a-token", ErrMalformed},
+	}
+	for _, tt := range tests {
+		claims, err := v.Verify(context.Background(), tt.token)
+		if !errors.Is(err, tt.want) || (err == nil) != (tt.want == nil) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err == nil && claims.Subject() != "alice" {
+			t.Errorf("%s: subject = %q", tt.name, claims.Subject())
+		}
+	}
+
+	secrets = nil
+	if _, err := v.Verify(context.Background(), sign(t, "HS256", "", []byte("new"), valid())); !errors.Is(err, ErrSignature) {
+		t.Errorf("Verify() without secrets error = %v", err)
+	}
+}
+
+func jwkOf(kid string, key crypto.PublicKey) map[string]string {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": enc(key.N.Bytes()), "e": enc(big.NewInt(int64(key.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		return map[string]string{"kty": "EC", "kid": kid, "crv": key.Curve.Params().Name, "x": enc(key.X.Bytes()), "y": enc(key.Y.Bytes())}
+	}
+	return nil
+}
+
+func TestVerifyJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fetches atomic.Int32
+	keys := []map[string]string{jwkOf("rsa-1", &rsaKey.PublicKey), jwkOf("ec-1", &ecKey.PublicKey)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	defer srv.Close()
+
+	ks := NewKeySet(srv.URL, srv.Client())
+	v := New(Config{Keys: ks, Secrets: func() [][]byte { return [][]byte{[]byte("secret")} }})
+	claims := map[string]any{"sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}
+
+	for _, tt := range []struct {
+		alg, kid string
+		key      any
+		ok       bool
+	}{
+		{"RS256", "rsa-1", rsaKey, true},
+		{"PS384", "rsa-1", rsaKey, true},
+		{"ES256", "ec-1", ecKey, true},
+		{"ES256", "rsa-1", ecKey, false},
+		{"RS256", "ec-1", rsaKey, false},
+		{"ES384", "ec-2", rotated, false},
+	} {
+		got, err := v.Verify(context.Background(), sign(t, tt.alg, tt.kid, tt.key, claims))
+		if (err == nil) != tt.ok {
+			t.Errorf("%s %s: Verify() error = %v, want ok %v", tt.alg, tt.kid, err, tt.ok)
+		}
+		if err == nil && got.Subject() != "bob" {
+			t.Errorf("%s %s: subject = %q", tt.alg, tt.kid, got.Subject())
+		}
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched %d times, want 1: unknown keys are refetched at most every %s", n, keySetMinInterval)
+	}
+
+	// A rotated key is picked up once the set may be fetched again.
+	keys = append(keys, jwkOf("ec-2", &rotated.PublicKey))
+	ks.attempted = time.Time{}
+	if _, err := v.Verify(context.Background(), sign(t, "ES384", "ec-2", rotated, claims)); err != nil {
+		t.Errorf("Verify() with rotated key error = %v", err)
+	}
+	if n, _, err := ks.Status(); n != 3 || err != nil {
+		t.Errorf("Status() = %d, %v", n, err)
+	}
+
+	// An HMAC token must not verify against the public key material.
+	if _, err := v.Verify(context.Background(), sign(t, "HS256", "rsa-1", []byte("wrong"), claims)); !errors.Is(err, ErrSignature) {
+		t.Errorf("HS256 with JWKS kid error = %v", err)
+	}
+}
+
+func TestKeySetErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"keys":[{"kty":"oct","kid":"s"},{"kty":"EC","kid":"bad","crv":"P-256","x":"AQ","y":"AQ"}]}`))
+	}))
+	defer srv.Close()
+	ks := NewKeySet(srv.URL, srv.Client())
+	if err := ks.Refresh(context.Background()); err == nil {
+		t.Error("Refresh() of a set without usable keys succeeded")
+	}
+	if _, err := ks.Key(context.Background(), "bad"); err == nil {
+		t.Error("Key() of an invalid key succeeded")
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := FromContext(context.Background()); ok {
+		t.Error("FromContext() of an empty context found claims")
+	}
+	ctx := NewContext(context.Background(), Claims{"sub": "alice", "exp": float64(1700000000.5)})
+	c, ok := FromContext(ctx)
+	if !ok || c.Subject() != "alice" {
+		t.Errorf("FromContext() = %v, %v", c, ok)
+	}
+	if exp, ok := c.Time("exp"); !ok || !exp.Equal(time.Unix(1700000000, 5e8)) {
+		t.Errorf("Time(exp) = %v, %v", exp, ok)
+	}
+}
@@ -0,0 +1,265 @@
+// Package k8sclient is a small Kubernetes API client shared by every
+// Kubernetes-aware feature of the service. It detects whether it runs inside
+// a cluster or on a workstation with a kubeconfig (e.g. against kind),
+// applies client-side QPS/burst limits, backs off when the API server
+// throttles, records per-resource latency and throttling statistics, and
+// offers plain REST calls plus shared, caching informers. It deliberately covers only what the
+// service needs, which keeps the binary free of client-go.
+package k8sclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Default client-side limits, matching client-go's defaults.
+const (
+	DefaultQPS   = 5
+	DefaultBurst = 10
+
+	// maxRetries bounds retries of requests the API server rejected with
+	// 429 Too Many Requests (API Priority and Fairness).
+	maxRetries    = 3
+	maxRetryAfter = 10 * time.Second
+)
+
+// Config controls how a Client is built.
+type Config struct {
+	// Kubeconfig is the kubeconfig path used outside a cluster. Empty means
+	// $KUBECONFIG or ~/.kube/config.
+	Kubeconfig string
+	// Context selects a kubeconfig context other than current-context.
+	Context string
+	// QPS and Burst bound the request rate to the API server.
+	QPS   float64
+	Burst int
+}
+
+// Client talks to the Kubernetes API server.
+type Client struct {
+	host       string
+	token      string
+	namespace  string
+	inCluster  bool
+	httpClient *http.Client
+	watch      *http.Client
+	limiter    *tokenBucket
+	qps        float64
+	burst      int
+	metrics    *metrics
+
+	informersMu sync.Mutex
+	informers   map[string]*Informer
+}
+
+// StatusError is returned when the API server answers with a non-2xx status.
+type StatusError struct {
+	Code    int
+	Reason  string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("kubernetes api: %d %s: %s", e.Code, e.Reason, e.Message)
+}
+
+// IsStatus reports whether err is a StatusError with the given HTTP code.
+func IsStatus(err error, code int) bool {
+	var statusErr *StatusError
+	return errors.As(err, &statusErr) && statusErr.Code == code
+}
+
+// New builds a client from the in-cluster service account when running in a
+// pod, and from the kubeconfig otherwise.
+func New(cfg Config) (*Client, error) {
+	if cfg.QPS <= 0 {
+		cfg.QPS = DefaultQPS
+	}
+	if cfg.Burst <= 0 {
+		cfg.Burst = DefaultBurst
+	}
+
+	var (
+		c   *Client
+		err error
+	)
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		c, err = inClusterClient()
+	} else {
+		c, err = kubeconfigClient(cfg.Kubeconfig, cfg.Context)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Watches are long-lived, so they bypass the client-wide timeout.
+	c.watch = &http.Client{Transport: c.httpClient.Transport}
+	c.limiter = newTokenBucket(cfg.QPS, cfg.Burst)
+	c.qps, c.burst = cfg.QPS, cfg.Burst
+	c.metrics = newMetrics()
+	c.informers = make(map[string]*Informer)
+	if ns := os.Getenv("POD_NAMESPACE"); ns != "" {
+		c.namespace = ns
+	}
+	return c, nil
+}
+
+// Namespace is the namespace the client operates in by default: the pod's
+// namespace in a cluster, or the kubeconfig context's namespace outside.
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// InCluster reports whether the client uses in-cluster credentials.
+func (c *Client) InCluster() bool {
+	return c.inCluster
+}
+
+// Host is the API server URL.
+func (c *Client) Host() string {
+	return c.host
+}
+
+// Do issues a request against the API server, encoding in as the JSON body
+// (when non-nil) and decoding the response into out (when non-nil). Requests
+// throttled by the server are retried after the advertised Retry-After.
+func (c *Client) Do(ctx context.Context, method, path string, in, out any) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryAfter, err := c.do(ctx, method, path, data, out)
+		if !IsStatus(err, http.StatusTooManyRequests) || attempt == maxRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, data []byte, out any) (time.Duration, error) {
+	var body io.Reader
+	if data != nil {
+		body = bytes.NewReader(data)
+	}
+	req, err := c.newRequest(ctx, method, path, body)
+	if err != nil {
+		return 0, err
+	}
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if err := c.wait(ctx); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.metrics.observe(method, path, time.Since(start), 0, err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = decodeStatus(resp)
+	} else if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+	}
+	c.metrics.observe(method, path, time.Since(start), resp.StatusCode, err)
+	return retryAfter(resp), err
+}
+
+// wait blocks for a client-side rate limit token and records the delay.
+func (c *Client) wait(ctx context.Context) error {
+	start := time.Now()
+	if err := c.limiter.wait(ctx); err != nil {
+		return err
+	}
+	c.metrics.observeWait(time.Since(start))
+	return nil
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 1 {
+		return time.Second
+	}
+	if d := time.Duration(seconds) * time.Second; d < maxRetryAfter {
+		return d
+	}
+	return maxRetryAfter
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+func decodeStatus(resp *http.Response) error {
+	status := struct {
+		Reason  string `json:"reason"`
+		Message string `json:"message"`
+	}{}
+	_ = json.NewDecoder(resp.Body).Decode(&status)
+	if status.Reason == "" {
+		status.Reason = http.StatusText(resp.StatusCode)
+	}
+	return &StatusError{Code: resp.StatusCode, Reason: status.Reason, Message: status.Message}
+}
+
+// tokenBucket is a minimal client-side rate limiter.
+type tokenBucket struct {
+	tokens chan struct{}
+}
+
+func newTokenBucket(qps float64, burst int) *tokenBucket {
+	tb := &tokenBucket{tokens: make(chan struct{}, burst)}
+	for i := 0; i < burst; i++ {
+		tb.tokens <- struct{}{}
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / qps))
+		defer ticker.Stop()
+		for range ticker.C {
+			select {
+			case tb.tokens <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return tb
+}
+
+func (tb *tokenBucket) wait(ctx context.Context) error {
+	select {
+	case <-tb.tokens:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
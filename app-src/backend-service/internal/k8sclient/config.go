@@ -0,0 +1,225 @@
+package k8sclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// serviceAccountDir is where the kubelet mounts the pod's service account
+// token, CA bundle and namespace.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+const requestTimeout = 30 * time.Second
+
+func inClusterClient() (*Client, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a cluster: KUBERNETES_SERVICE_HOST/PORT not set")
+	}
+
+	token, err := os.ReadFile(filepath.Join(serviceAccountDir, "token"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account token: %w", err)
+	}
+	caPEM, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("reading service account CA: %w", err)
+	}
+	tlsConfig, err := newTLSConfig(caPEM, false)
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := "default"
+	if data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace")); err == nil {
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	return &Client{
+		host:       "https://" + net.JoinHostPort(host, port),
+		token:      strings.TrimSpace(string(token)),
+		namespace:  namespace,
+		inCluster:  true,
+		httpClient: newHTTPClient(tlsConfig),
+	}, nil
+}
+
+// kubeconfig is the subset of the kubeconfig format needed to reach a
+// cluster with static credentials, which covers kind, k3d and minikube.
+type kubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Contexts       []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster   string `yaml:"cluster"`
+			User      string `yaml:"user"`
+			Namespace string `yaml:"namespace"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server                   string `yaml:"server"`
+			CertificateAuthority     string `yaml:"certificate-authority"`
+			CertificateAuthorityData string `yaml:"certificate-authority-data"`
+			InsecureSkipTLSVerify    bool   `yaml:"insecure-skip-tls-verify"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token                 string    `yaml:"token"`
+			TokenFile             string    `yaml:"tokenFile"`
+			ClientCertificate     string    `yaml:"client-certificate"`
+			ClientCertificateData string    `yaml:"client-certificate-data"`
+			ClientKey             string    `yaml:"client-key"`
+			ClientKeyData         string    `yaml:"client-key-data"`
+			Exec                  yaml.Node `yaml:"exec"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+}
+
+func kubeconfigClient(path, contextName string) (*Client, error) {
+	if path == "" {
+		path = defaultKubeconfigPath()
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("not in a cluster and no usable kubeconfig: %w", err)
+	}
+	var kc kubeconfig
+	if err := yaml.Unmarshal(data, &kc); err != nil {
+		return nil, fmt.Errorf("parsing kubeconfig %s: %w", path, err)
+	}
+	base := filepath.Dir(path)
+
+	if contextName == "" {
+		contextName = kc.CurrentContext
+	}
+	var clusterName, userName, namespace string
+	found := false
+	for _, c := range kc.Contexts {
+		if c.Name == contextName {
+			clusterName, userName, namespace = c.Context.Cluster, c.Context.User, c.Context.Namespace
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("kubeconfig %s has no context %q", path, contextName)
+	}
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	client := &Client{namespace: namespace}
+	var tlsConfig *tls.Config
+	for _, c := range kc.Clusters {
+		if c.Name != clusterName {
+			continue
+		}
+		client.host = strings.TrimSuffix(c.Cluster.Server, "/")
+		caPEM, err := readInlineOrFile(c.Cluster.CertificateAuthorityData, c.Cluster.CertificateAuthority, base)
+		if err != nil {
+			return nil, fmt.Errorf("reading cluster CA: %w", err)
+		}
+		if tlsConfig, err = newTLSConfig(caPEM, c.Cluster.InsecureSkipTLSVerify); err != nil {
+			return nil, err
+		}
+	}
+	if client.host == "" {
+		return nil, fmt.Errorf("kubeconfig %s has no cluster %q", path, clusterName)
+	}
+
+	for _, u := range kc.Users {
+		if u.Name != userName {
+			continue
+		}
+		if !u.User.Exec.IsZero() {
+			return nil, fmt.Errorf("user %q uses an exec credential plugin, which is not supported", userName)
+		}
+		client.token = u.User.Token
+		if u.User.TokenFile != "" {
+			token, err := os.ReadFile(resolvePath(u.User.TokenFile, base))
+			if err != nil {
+				return nil, fmt.Errorf("reading token file: %w", err)
+			}
+			client.token = strings.TrimSpace(string(token))
+		}
+		certPEM, err := readInlineOrFile(u.User.ClientCertificateData, u.User.ClientCertificate, base)
+		if err != nil {
+			return nil, fmt.Errorf("reading client certificate: %w", err)
+		}
+		keyPEM, err := readInlineOrFile(u.User.ClientKeyData, u.User.ClientKey, base)
+		if err != nil {
+			return nil, fmt.Errorf("reading client key: %w", err)
+		}
+		if certPEM != nil && keyPEM != nil {
+			cert, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				return nil, fmt.Errorf("loading client certificate: %w", err)
+			}
+			tlsConfig.Certificates = []tls.Certificate{cert}
+		}
+	}
+
+	client.httpClient = newHTTPClient(tlsConfig)
+	return client, nil
+}
+
+func defaultKubeconfigPath() string {
+	if env := os.Getenv("KUBECONFIG"); env != "" {
+		return filepath.SplitList(env)[0]
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".kube", "config")
+}
+
+// readInlineOrFile returns base64 inline data if set, else the file's contents.
+func readInlineOrFile(inline, path, base string) ([]byte, error) {
+	if inline != "" {
+		return base64.StdEncoding.DecodeString(inline)
+	}
+	if path != "" {
+		return os.ReadFile(resolvePath(path, base))
+	}
+	return nil, nil
+}
+
+// resolvePath resolves kubeconfig-relative paths against its directory.
+func resolvePath(path, base string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, path)
+}
+
+func newTLSConfig(caPEM []byte, insecure bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecure} //nolint:gosec // opt-in via kubeconfig
+	if caPEM != nil {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("CA bundle contains no certificates")
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+func newHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout:   requestTimeout,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig, Proxy: http.ProxyFromEnvironment},
+	}
+}
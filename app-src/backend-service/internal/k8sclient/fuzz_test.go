@@ -0,0 +1,48 @@
+package k8sclient
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const seedKubeconfig = `apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev
+  cluster:
+    server: https://127.0.0.1:6443/
+    insecure-skip-tls-verify: true
+contexts:
+- name: dev
+  context:
+    cluster: dev
+    user: dev
+    namespace: gitops-demo-dev
+users:
+- name: dev
+  user:
+    token: abc
+`
+
+// FuzzKubeconfig loads arbitrary kubeconfig files; malformed ones must be
+// reported as errors, not crash the client setup.
+func FuzzKubeconfig(f *testing.F) {
+	f.Add([]byte(seedKubeconfig), "")
+	f.Add([]byte(seedKubeconfig), "missing")
+	f.Add([]byte("current-context: x\ncontexts: [{name: x, context: {cluster: c, user: u}}]\nclusters: [{name: c, cluster: {server: h}}]\nusers: [{name: u, user: {client-certificate-data: Zm9v, client-key-data: YmFy}}]\n"), "")
+	f.Add([]byte("clusters: {}"), "")
+	f.Add([]byte("{{{"), "")
+	f.Fuzz(func(t *testing.T, data []byte, contextName string) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "config")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		client, err := kubeconfigClient(path, contextName)
+		if err == nil && (client.host == "" || client.namespace == "" || client.httpClient == nil) {
+			t.Errorf("incomplete client %+v without an error", client)
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// InformerInfo describes a shared informer for Stats.
+type InformerInfo struct {
+	Collection string `json:"collection"`
+	Selector   string `json:"selector,omitempty"`
+	Synced     bool   `json:"synced"`
+	Objects    int    `json:"objects"`
+}
+
+// Informer keeps an in-memory cache of one collection up to date with a
+// single list/watch, however many features read from it. Informers are
+// shared per collection and parameters; obtain them with Client.Informer.
+type Informer struct {
+	client     *Client
+	collection string
+	params     url.Values
+
+	once    sync.Once
+	mu      sync.RWMutex
+	synced  bool
+	objects map[string]json.RawMessage
+}
+
+// Informer returns the shared informer for collection and params, creating
+// it on first use. It starts watching when Start is first called.
+func (c *Client) Informer(collection string, params url.Values) *Informer {
+	key := collection + "?" + params.Encode()
+	c.informersMu.Lock()
+	defer c.informersMu.Unlock()
+	if inf, ok := c.informers[key]; ok {
+		return inf
+	}
+	inf := &Informer{
+		client:     c,
+		collection: collection,
+		params:     params,
+		objects:    make(map[string]json.RawMessage),
+	}
+	c.informers[key] = inf
+	return inf
+}
+
+// Start runs the list/watch in the background until ctx is cancelled. Only
+// the first call has an effect.
+func (inf *Informer) Start(ctx context.Context) {
+	inf.once.Do(func() {
+		go inf.client.ListWatch(ctx, inf.collection, inf.params, inf.sync, inf.apply)
+	})
+}
+
+func (inf *Informer) sync(items []json.RawMessage) {
+	objects := make(map[string]json.RawMessage, len(items))
+	for _, raw := range items {
+		if name, ok := objectName(raw); ok {
+			objects[name] = raw
+		}
+	}
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	inf.objects = objects
+	inf.synced = true
+}
+
+func (inf *Informer) apply(event WatchEvent) {
+	name, ok := objectName(event.Object)
+	if !ok {
+		return
+	}
+	inf.mu.Lock()
+	defer inf.mu.Unlock()
+	if event.Type == "DELETED" {
+		delete(inf.objects, name)
+		return
+	}
+	inf.objects[name] = event.Object
+}
+
+// HasSynced reports whether the initial list has completed.
+func (inf *Informer) HasSynced() bool {
+	inf.mu.RLock()
+	defer inf.mu.RUnlock()
+	return inf.synced
+}
+
+// Get decodes the cached object with the given name into out. It reports
+// false until the informer has synced or when the object doesn't exist.
+func (inf *Informer) Get(name string, out any) (bool, error) {
+	inf.mu.RLock()
+	raw, ok := inf.objects[name]
+	synced := inf.synced
+	inf.mu.RUnlock()
+	if !synced || !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, out)
+}
+
+// GetOrFetch reads the named object from the cache, falling back to a GET
+// against the API server while the informer hasn't synced (or isn't running).
+func (inf *Informer) GetOrFetch(ctx context.Context, name string, out any) error {
+	if ok, err := inf.Get(name, out); ok || err != nil {
+		return err
+	}
+	return inf.client.Do(ctx, http.MethodGet, inf.collection+"/"+name, nil, out)
+}
+
+func (inf *Informer) info() InformerInfo {
+	inf.mu.RLock()
+	defer inf.mu.RUnlock()
+	selector := inf.params.Get("labelSelector")
+	if fs := inf.params.Get("fieldSelector"); fs != "" {
+		selector = fs
+	}
+	return InformerInfo{Collection: inf.collection, Selector: selector, Synced: inf.synced, Objects: len(inf.objects)}
+}
+
+func objectName(raw json.RawMessage) (string, bool) {
+	var obj struct {
+		Metadata ObjectMeta `json:"metadata"`
+	}
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		log.Printf("Error decoding informer object: %v", err)
+		return "", false
+	}
+	return obj.Metadata.Name, obj.Metadata.Name != ""
+}
+
+// Stats returns request, throttling and informer statistics.
+func (c *Client) Stats() Stats {
+	s := c.metrics.snapshot()
+	s.QPS, s.Burst = c.qps, c.burst
+
+	c.informersMu.Lock()
+	defer c.informersMu.Unlock()
+	s.Informers = make([]InformerInfo, 0, len(c.informers))
+	for _, inf := range c.informers {
+		s.Informers = append(s.Informers, inf.info())
+	}
+	sort.Slice(s.Informers, func(i, j int) bool {
+		return s.Informers[i].Collection < s.Informers[j].Collection
+	})
+	return s
+}
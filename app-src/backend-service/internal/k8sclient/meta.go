@@ -0,0 +1,31 @@
+package k8sclient
+
+// ObjectMeta is the subset of metav1.ObjectMeta the service reads or writes.
+type ObjectMeta struct {
+	Name            string            `json:"name"`
+	Namespace       string            `json:"namespace,omitempty"`
+	UID             string            `json:"uid,omitempty"`
+	ResourceVersion string            `json:"resourceVersion,omitempty"`
+	Generation      int64             `json:"generation,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations,omitempty"`
+	OwnerReferences []OwnerReference  `json:"ownerReferences,omitempty"`
+}
+
+// OwnerReference identifies an object's owner.
+type OwnerReference struct {
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Controller bool   `json:"controller,omitempty"`
+}
+
+// ControllerOf returns the owner reference marked as controller, if any.
+func (m ObjectMeta) ControllerOf() (OwnerReference, bool) {
+	for _, ref := range m.OwnerReferences {
+		if ref.Controller {
+			return ref, true
+		}
+	}
+	return OwnerReference{}, false
+}
@@ -0,0 +1,136 @@
+package k8sclient
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttleLogThreshold mirrors client-go, which reports client-side
+// throttling once a request waited longer than this for a token.
+const throttleLogThreshold = time.Second
+
+// RequestStats aggregates the calls made for one verb and resource.
+type RequestStats struct {
+	Verb             string  `json:"verb"`
+	Resource         string  `json:"resource"`
+	Count            int64   `json:"count"`
+	Errors           int64   `json:"errors"`
+	ServerThrottled  int64   `json:"server_throttled"`
+	AvgLatencyMillis float64 `json:"avg_latency_ms"`
+	MaxLatencyMillis float64 `json:"max_latency_ms"`
+
+	totalLatency time.Duration
+	maxLatency   time.Duration
+}
+
+// Stats is a snapshot of the client's API usage.
+type Stats struct {
+	QPS                         float64        `json:"qps"`
+	Burst                       int            `json:"burst"`
+	Requests                    []RequestStats `json:"requests"`
+	ClientThrottled             int64          `json:"client_throttled"`
+	ClientThrottleWaitMillis    float64        `json:"client_throttle_wait_ms"`
+	MaxClientThrottleWaitMillis float64        `json:"max_client_throttle_wait_ms"`
+	Informers                   []InformerInfo `json:"informers"`
+}
+
+type metrics struct {
+	mu           sync.Mutex
+	requests     map[string]*RequestStats
+	throttled    int64
+	throttleWait time.Duration
+	maxWait      time.Duration
+}
+
+func newMetrics() *metrics {
+	return &metrics{requests: make(map[string]*RequestStats)}
+}
+
+func (m *metrics) observe(verb, path string, latency time.Duration, code int, err error) {
+	resource := resourceOf(path)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := verb + " " + resource
+	rs, ok := m.requests[key]
+	if !ok {
+		rs = &RequestStats{Verb: verb, Resource: resource}
+		m.requests[key] = rs
+	}
+	rs.Count++
+	rs.totalLatency += latency
+	if latency > rs.maxLatency {
+		rs.maxLatency = latency
+	}
+	if err != nil {
+		rs.Errors++
+	}
+	if code == 429 {
+		rs.ServerThrottled++
+	}
+}
+
+func (m *metrics) observeWait(wait time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.throttleWait += wait
+	if wait > m.maxWait {
+		m.maxWait = wait
+	}
+	if wait >= throttleLogThreshold {
+		m.throttled++
+	}
+}
+
+func (m *metrics) snapshot() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Stats{
+		Requests:                    make([]RequestStats, 0, len(m.requests)),
+		ClientThrottled:             m.throttled,
+		ClientThrottleWaitMillis:    millis(m.throttleWait),
+		MaxClientThrottleWaitMillis: millis(m.maxWait),
+	}
+	for _, rs := range m.requests {
+		r := *rs
+		r.AvgLatencyMillis = millis(rs.totalLatency / time.Duration(rs.Count))
+		r.MaxLatencyMillis = millis(rs.maxLatency)
+		s.Requests = append(s.Requests, r)
+	}
+	sort.Slice(s.Requests, func(i, j int) bool {
+		if s.Requests[i].Resource != s.Requests[j].Resource {
+			return s.Requests[i].Resource < s.Requests[j].Resource
+		}
+		return s.Requests[i].Verb < s.Requests[j].Verb
+	})
+	return s
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// resourceOf extracts the resource name from an API path, e.g. "pods" from
+// /api/v1/namespaces/default/pods/web-0?watch=true.
+func resourceOf(path string) string {
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segs) >= 2 && segs[0] == "api":
+		segs = segs[2:]
+	case len(segs) >= 3 && segs[0] == "apis":
+		segs = segs[3:]
+	default:
+		return path
+	}
+	if len(segs) >= 3 && segs[0] == "namespaces" {
+		segs = segs[2:]
+	}
+	if len(segs) == 0 {
+		return "unknown"
+	}
+	return segs[0]
+}
@@ -0,0 +1,115 @@
+package k8sclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// WatchEvent is a single event from a Kubernetes watch stream.
+type WatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// ListWatch behaves like a client-go informer for a single collection: it
+// lists the collection, hands the items to onSync, then streams watch events
+// to onEvent. Expired or dropped watches are re-established with a fresh list
+// until ctx is cancelled.
+func (c *Client) ListWatch(ctx context.Context, collection string, params url.Values,
+	onSync func(items []json.RawMessage), onEvent func(WatchEvent)) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		list := struct {
+			Metadata struct {
+				ResourceVersion string `json:"resourceVersion"`
+			} `json:"metadata"`
+			Items []json.RawMessage `json:"items"`
+		}{}
+		if err := c.Do(ctx, http.MethodGet, collection+"?"+params.Encode(), nil, &list); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error listing %s: %v", collection, err)
+			}
+		} else {
+			backoff = time.Second
+			onSync(list.Items)
+			if err := c.Watch(ctx, collection, params, list.Metadata.ResourceVersion, onEvent); err != nil && ctx.Err() == nil {
+				log.Printf("Watch on %s ended: %v", collection, err)
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 30*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// Watch streams events for collection starting at resourceVersion until the
+// server closes the stream, the resource version expires, or ctx is done.
+func (c *Client) Watch(ctx context.Context, collection string, params url.Values,
+	resourceVersion string, onEvent func(WatchEvent)) error {
+	query := url.Values{}
+	for k, v := range params {
+		query[k] = v
+	}
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("allowWatchBookmarks", "true")
+
+	req, err := c.newRequest(ctx, http.MethodGet, collection+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if err := c.wait(ctx); err != nil {
+		return err
+	}
+	start := time.Now()
+	resp, err := c.watch.Do(req)
+	if err != nil {
+		c.metrics.observe("WATCH", collection, time.Since(start), 0, err)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		err := decodeStatus(resp)
+		c.metrics.observe("WATCH", collection, time.Since(start), resp.StatusCode, err)
+		return err
+	}
+	// Latency of a watch is the time to establish the stream.
+	c.metrics.observe("WATCH", collection, time.Since(start), resp.StatusCode, nil)
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event WatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		switch event.Type {
+		case "BOOKMARK":
+			continue
+		case "ERROR":
+			var status struct {
+				Code    int    `json:"code"`
+				Reason  string `json:"reason"`
+				Message string `json:"message"`
+			}
+			_ = json.Unmarshal(event.Object, &status)
+			return &StatusError{Code: status.Code, Reason: status.Reason, Message: status.Message}
+		}
+		onEvent(event)
+	}
+}
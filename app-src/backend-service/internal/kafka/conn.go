@@ -0,0 +1,96 @@
+package kafka
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/netctx"
+)
+
+// maxResponseLen bounds the responses read, so a corrupt size can't
+// allocate without limit.
+const maxResponseLen = 64 << 20
+
+// conn is a connection to one broker. Requests on it take turns.
+type conn struct {
+	addr     string
+	clientID string
+
+	mu            sync.Mutex
+	nc            net.Conn
+	r             *bufio.Reader
+	correlationID int32
+}
+
+func dial(ctx context.Context, addr, clientID string, timeout time.Duration) (*conn, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{addr: addr, clientID: clientID, nc: nc, r: bufio.NewReader(nc)}, nil
+}
+
+func (c *conn) close() {
+	_ = c.nc.Close()
+}
+
+// roundTrip sends a request with a v1 header and returns the response body
+// after its correlation ID. An error leaves the connection unusable.
+func (c *conn) roundTrip(ctx context.Context, apiKey, version int16, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stop := netctx.Watch(ctx, c.nc)
+	resp, err := c.exchange(apiKey, version, body)
+	if !stop() && err != nil {
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("kafka %s: %w", c.addr, err)
+	}
+	return resp, nil
+}
+
+func (c *conn) exchange(apiKey, version int16, body []byte) ([]byte, error) {
+	c.correlationID++
+	var req encoder
+	req.int32(0) // size, filled in below
+	req.int16(apiKey)
+	req.int16(version)
+	req.int32(c.correlationID)
+	req.string(c.clientID)
+	req.b = append(req.b, body...)
+	binary.BigEndian.PutUint32(req.b, uint32(len(req.b)-4))
+	if _, err := c.nc.Write(req.b); err != nil {
+		return nil, err
+	}
+
+	var size [4]byte
+	if _, err := io.ReadFull(c.r, size[:]); err != nil {
+		return nil, err
+	}
+	n := int32(binary.BigEndian.Uint32(size[:]))
+	if n < 4 || n > maxResponseLen {
+		return nil, fmt.Errorf("invalid response size %d", n)
+	}
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(c.r, resp); err != nil {
+		return nil, err
+	}
+	if id := int32(binary.BigEndian.Uint32(resp)); id != c.correlationID {
+		return nil, errors.New("response out of order")
+	}
+	return resp[4:], nil
+}
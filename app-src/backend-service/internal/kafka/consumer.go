@@ -0,0 +1,333 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Special times of ListOffset.
+const (
+	OffsetLatest   = -1
+	OffsetEarliest = -2
+)
+
+// maxFetchBytes bounds the records a Fetch returns.
+const maxFetchBytes = 1 << 20
+
+// Record is a record fetched from a partition.
+type Record struct {
+	Offset  int64
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	Time    time.Time
+}
+
+// Partitions returns the number of partitions of topic.
+func (c *Client) Partitions(ctx context.Context, topic string) (int, error) {
+	leaders, err := c.partitions(ctx, topic)
+	return len(leaders), err
+}
+
+// Fetch returns the records of a partition from offset on, waiting up to
+// maxWait for some to arrive, and the partition's high watermark: the
+// offset the next record will get. An offset the partition doesn't hold is
+// ErrOffsetOutOfRange.
+func (c *Client) Fetch(ctx context.Context, topic string, partition int32, offset int64, maxWait time.Duration) ([]Record, int64, error) {
+	addr, err := c.leader(ctx, topic, partition)
+	if err != nil {
+		return nil, 0, err
+	}
+	var req encoder
+	req.int32(-1) // replica ID: a consumer
+	req.int32(int32(maxWait.Milliseconds()))
+	req.int32(1) // min bytes
+	req.int32(maxFetchBytes)
+	req.int8(0) // read uncommitted
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.int64(offset)
+	req.int32(maxFetchBytes)
+	resp, err := c.roundTrip(ctx, addr, apiFetch, 4, req.b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	d := decoder{b: resp}
+	d.int32() // throttle time
+	var records []Record
+	var highWatermark int64
+	code := int16(errUnknownTopicOrPartition)
+	for t := d.arrayLen(); t > 0; t-- {
+		d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			d.int32()
+			code = d.int16()
+			highWatermark = d.int64()
+			d.int64() // last stable offset
+			// Aborted transactions
+			for a := int(d.int32()); a > 0 && d.err == nil; a-- {
+				d.int64()
+				d.int64()
+			}
+			if batches := d.bytes(); code == errNone {
+				if records, err = decodeRecords(batches, offset); err != nil {
+					return nil, 0, err
+				}
+			}
+		}
+	}
+	if d.err != nil {
+		return nil, 0, d.err
+	}
+	if code != errNone {
+		c.forget(topic, Error{Code: code})
+		return nil, 0, Error{Code: code}
+	}
+	return records, highWatermark, nil
+}
+
+// ListOffset returns the offset of the first record of a partition at or
+// after at, a Unix time in milliseconds, or OffsetLatest or OffsetEarliest.
+func (c *Client) ListOffset(ctx context.Context, topic string, partition int32, at int64) (int64, error) {
+	addr, err := c.leader(ctx, topic, partition)
+	if err != nil {
+		return 0, err
+	}
+	var req encoder
+	req.int32(-1) // replica ID
+	req.int32(1)
+	req.string(topic)
+	req.int32(1)
+	req.int32(partition)
+	req.int64(at)
+	resp, err := c.roundTrip(ctx, addr, apiListOffsets, 1, req.b)
+	if err != nil {
+		return 0, err
+	}
+	d := decoder{b: resp}
+	code, offset := int16(errUnknownTopicOrPartition), int64(0)
+	for t := d.arrayLen(); t > 0; t-- {
+		d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			d.int32()
+			code = d.int16()
+			d.int64() // timestamp
+			offset = d.int64()
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	if code != errNone {
+		c.forget(topic, Error{Code: code})
+		return 0, Error{Code: code}
+	}
+	return offset, nil
+}
+
+// CommittedOffsets returns the offsets group committed for the partitions
+// of topic: the next offset to read, or -1 when it never committed one.
+func (c *Client) CommittedOffsets(ctx context.Context, group, topic string, partitions []int32) (map[int32]int64, error) {
+	var req encoder
+	req.string(group)
+	req.int32(1)
+	req.string(topic)
+	req.int32(int32(len(partitions)))
+	for _, p := range partitions {
+		req.int32(p)
+	}
+	resp, err := c.coordinated(ctx, group, apiOffsetFetch, 1, req.b)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{b: resp}
+	offsets := make(map[int32]int64, len(partitions))
+	for t := d.arrayLen(); t > 0; t-- {
+		d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			partition := d.int32()
+			offset := d.int64()
+			d.string() // metadata
+			if code := d.int16(); d.err == nil && code != errNone {
+				return nil, c.forgetCoordinator(group, Error{Code: code})
+			}
+			offsets[partition] = offset
+		}
+	}
+	return offsets, d.err
+}
+
+// CommitOffsets commits the next offsets group reads from the partitions
+// of topic. The group has no members: the offsets are kept for reading
+// back with CommittedOffsets and for monitoring.
+func (c *Client) CommitOffsets(ctx context.Context, group, topic string, offsets map[int32]int64) error {
+	var req encoder
+	req.string(group)
+	req.int32(-1) // generation ID: no membership
+	req.string("")
+	req.int64(-1) // retention time: the broker's default
+	req.int32(1)
+	req.string(topic)
+	req.int32(int32(len(offsets)))
+	for p, offset := range offsets {
+		req.int32(p)
+		req.int64(offset)
+		req.nullableString(nil)
+	}
+	resp, err := c.coordinated(ctx, group, apiOffsetCommit, 2, req.b)
+	if err != nil {
+		return err
+	}
+	d := decoder{b: resp}
+	for t := d.arrayLen(); t > 0; t-- {
+		d.string()
+		for p := d.arrayLen(); p > 0; p-- {
+			d.int32()
+			if code := d.int16(); d.err == nil && code != errNone {
+				return c.forgetCoordinator(group, Error{Code: code})
+			}
+		}
+	}
+	return d.err
+}
+
+// leader returns the address of the leader of a partition.
+func (c *Client) leader(ctx context.Context, topic string, partition int32) (string, error) {
+	leaders, err := c.partitions(ctx, topic)
+	if err != nil {
+		return "", err
+	}
+	if partition < 0 || int(partition) >= len(leaders) {
+		return "", Error{Code: errUnknownTopicOrPartition}
+	}
+	c.mu.Lock()
+	addr, ok := c.brokers[leaders[partition]]
+	c.mu.Unlock()
+	if !ok {
+		return "", Error{Code: errLeaderNotAvailable}
+	}
+	return addr, nil
+}
+
+// forget drops the cached leaders of topic when err says they moved, so
+// the next request looks them up again.
+func (c *Client) forget(topic string, err Error) {
+	if err.retriable() {
+		c.mu.Lock()
+		delete(c.leaders, topic)
+		c.mu.Unlock()
+	}
+}
+
+// coordinated sends a request to the coordinator of group, looking it up
+// first when needed.
+func (c *Client) coordinated(ctx context.Context, group string, apiKey, version int16, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	addr, ok := c.coordinators[group]
+	c.mu.Unlock()
+	if !ok {
+		var req encoder
+		req.string(group)
+		resp, err := c.anyBroker(ctx, apiFindCoordinator, 0, req.b)
+		if err != nil {
+			return nil, err
+		}
+		d := decoder{b: resp}
+		code := d.int16()
+		d.int32() // node ID
+		host := d.string()
+		port := d.int32()
+		if d.err != nil {
+			return nil, d.err
+		}
+		if code != errNone {
+			return nil, Error{Code: code}
+		}
+		addr = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		c.mu.Lock()
+		c.coordinators[group] = addr
+		c.mu.Unlock()
+	}
+	resp, err := c.roundTrip(ctx, addr, apiKey, version, body)
+	if err != nil {
+		c.mu.Lock()
+		delete(c.coordinators, group)
+		c.mu.Unlock()
+	}
+	return resp, err
+}
+
+// forgetCoordinator drops the cached coordinator of group when err says it
+// moved, and returns err.
+func (c *Client) forgetCoordinator(group string, err Error) error {
+	if err.coordinatorMoved() {
+		c.mu.Lock()
+		delete(c.coordinators, group)
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// errCompressed is returned for record batches the client can't read.
+var errCompressed = errors.New("kafka: compressed record batches aren't supported")
+
+// decodeRecords decodes the record batches of a Fetch response, skipping
+// the records before offset, control batches and the partial batch a
+// response may end with.
+func decodeRecords(batches []byte, offset int64) ([]Record, error) {
+	var records []Record
+	for len(batches) >= 12 {
+		d := decoder{b: batches}
+		baseOffset := d.int64()
+		length := int(d.int32())
+		if length > len(d.b) {
+			break // partial
+		}
+		batches = batches[12+length:]
+		d.b = d.b[:length]
+		d.int32() // partition leader epoch
+		if magic := d.int8(); magic != 2 {
+			return nil, fmt.Errorf("kafka: record batch of magic %d", magic)
+		}
+		d.int32() // CRC
+		attributes := d.int16()
+		d.int32() // last offset delta
+		firstTimestamp := d.int64()
+		d.take(8 + 8 + 2 + 4) // max timestamp, producer ID and epoch, base sequence
+		count := int(d.int32())
+		if d.err != nil {
+			return nil, d.err
+		}
+		if attributes&0x7 != 0 {
+			return nil, errCompressed
+		}
+		if attributes&0x20 != 0 {
+			continue // control batch of a transaction
+		}
+		for ; count > 0; count-- {
+			rd := decoder{b: d.take(int(d.varint()))}
+			rd.int8() // attributes
+			r := Record{Time: time.UnixMilli(firstTimestamp + rd.varint())}
+			r.Offset = baseOffset + rd.varint()
+			r.Key = rd.varbytes()
+			r.Value = rd.varbytes()
+			for h := rd.varint(); h > 0 && rd.err == nil; h-- {
+				r.Headers = append(r.Headers, Header{Key: string(rd.varbytes()), Value: rd.varbytes()})
+			}
+			if err := errors.Join(d.err, rd.err); err != nil {
+				return nil, err
+			}
+			if r.Offset >= offset {
+				records = append(records, r)
+			}
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,314 @@
+// Package kafka is a small Kafka client that speaks the wire protocol
+// directly. It looks up partition leaders with Metadata (v1), sends
+// uncompressed record batches with Produce (v3) and reads them back with
+// Fetch (v4), which every broker since 0.11 accepts, and keeps the offsets
+// of a consumer group with the group coordinator. Keyed messages are
+// partitioned like the Java client does. There's no compression, SASL or
+// TLS, no idempotent producer and no group membership: a consumer reads the
+// partitions it's given.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by requests on a closed Client.
+var ErrClosed = errors.New("kafka: client is closed")
+
+// Config describes how to reach the cluster.
+type Config struct {
+	// host:port of the brokers to bootstrap from
+	Brokers  []string
+	ClientID string
+	// 1 waits for the leader to write the records, -1 for every in-sync
+	// replica. Zero means 1.
+	RequiredAcks int16
+	// Bounds connecting to a broker
+	DialTimeout time.Duration
+}
+
+// Client talks to a cluster over one connection per broker. Partition
+// leaders are cached until a broker reports they moved. It's safe for
+// concurrent use.
+type Client struct {
+	cfg Config
+	rr  atomic.Uint32
+
+	mu      sync.Mutex
+	closed  bool
+	conns   map[string]*conn
+	brokers map[int32]string
+	// leaders of a topic's partitions, by partition
+	leaders map[string][]int32
+	// coordinator addresses, by group
+	coordinators map[string]string
+}
+
+// New returns a client for cfg without connecting.
+func New(cfg Config) *Client {
+	if cfg.RequiredAcks == 0 {
+		cfg.RequiredAcks = 1
+	}
+	return &Client{cfg: cfg, conns: make(map[string]*conn), brokers: make(map[int32]string),
+		leaders: make(map[string][]int32), coordinators: make(map[string]string)}
+}
+
+// Produce writes msgs to topic and returns once the brokers acknowledged
+// them. Messages with a key go to the partition of its murmur2 hash; the
+// others of a call go together to the next partition in turn. When a
+// leader moved, the metadata is refreshed and the call retried once.
+func (c *Client) Produce(ctx context.Context, topic string, msgs []Message) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	err := c.produce(ctx, topic, msgs)
+	var kerr Error
+	if errors.As(err, &kerr) && kerr.retriable() {
+		c.mu.Lock()
+		delete(c.leaders, topic)
+		c.mu.Unlock()
+		err = c.produce(ctx, topic, msgs)
+	}
+	return err
+}
+
+func (c *Client) produce(ctx context.Context, topic string, msgs []Message) error {
+	leaders, err := c.partitions(ctx, topic)
+	if err != nil {
+		return err
+	}
+	next := int32(c.rr.Add(1) % uint32(len(leaders)))
+	byPartition := make(map[int32][]Message)
+	for _, m := range msgs {
+		p := next
+		if m.Key != nil {
+			p = (murmur2(m.Key) & 0x7fffffff) % int32(len(leaders))
+		}
+		byPartition[p] = append(byPartition[p], m)
+	}
+	byLeader := make(map[int32][]int32)
+	for p := range byPartition {
+		if leaders[p] < 0 {
+			return Error{Code: errLeaderNotAvailable}
+		}
+		byLeader[leaders[p]] = append(byLeader[leaders[p]], p)
+	}
+
+	for leader, partitions := range byLeader {
+		var req encoder
+		req.nullableString(nil) // transactional ID
+		req.int16(c.cfg.RequiredAcks)
+		req.int32(int32(requestTimeout(ctx).Milliseconds()))
+		req.int32(1)
+		req.string(topic)
+		req.int32(int32(len(partitions)))
+		for _, p := range partitions {
+			req.int32(p)
+			req.bytes(recordBatch(byPartition[p]))
+		}
+		c.mu.Lock()
+		addr, ok := c.brokers[leader]
+		c.mu.Unlock()
+		if !ok {
+			return Error{Code: errLeaderNotAvailable}
+		}
+		resp, err := c.roundTrip(ctx, addr, apiProduce, 3, req.b)
+		if err != nil {
+			return err
+		}
+		d := decoder{b: resp}
+		for t := d.arrayLen(); t > 0; t-- {
+			d.string()
+			for p := d.arrayLen(); p > 0; p-- {
+				d.int32()
+				code := d.int16()
+				d.int64() // base offset
+				d.int64() // log append time
+				if d.err == nil && code != errNone {
+					return Error{Code: code}
+				}
+			}
+		}
+		if d.err != nil {
+			return d.err
+		}
+	}
+	return nil
+}
+
+// requestTimeout is how long brokers may wait for replicas: what's left of
+// ctx, or 30 seconds.
+func requestTimeout(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return max(time.Until(deadline), time.Millisecond)
+	}
+	return 30 * time.Second
+}
+
+// Ping checks that a broker answers a Metadata request.
+func (c *Client) Ping(ctx context.Context) error {
+	var req encoder
+	req.int32(0) // no topics
+	_, err := c.anyBroker(ctx, apiMetadata, 1, req.b)
+	return err
+}
+
+// partitions returns the leaders of topic's partitions, asking the cluster
+// when they aren't cached.
+func (c *Client) partitions(ctx context.Context, topic string) ([]int32, error) {
+	c.mu.Lock()
+	leaders, ok := c.leaders[topic]
+	c.mu.Unlock()
+	if ok {
+		return leaders, nil
+	}
+
+	var req encoder
+	req.int32(1)
+	req.string(topic)
+	resp, err := c.anyBroker(ctx, apiMetadata, 1, req.b)
+	if err != nil {
+		return nil, err
+	}
+	d := decoder{b: resp}
+	brokers := make(map[int32]string)
+	for k := d.arrayLen(); k > 0; k-- {
+		id := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.string() // rack
+		brokers[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+	}
+	d.int32() // controller ID
+	for t := d.arrayLen(); t > 0; t-- {
+		code := d.int16()
+		name := d.string()
+		d.int8() // is internal
+		n := d.arrayLen()
+		partitions := make([]int32, n)
+		for p := 0; p < n; p++ {
+			d.int16()
+			index := d.int32()
+			leader := d.int32()
+			for r := d.arrayLen(); r > 0; r-- {
+				d.int32() // replicas
+			}
+			for r := d.arrayLen(); r > 0; r-- {
+				d.int32() // in-sync replicas
+			}
+			if index >= 0 && int(index) < n {
+				partitions[index] = leader
+			}
+		}
+		if name != topic {
+			continue
+		}
+		if code != errNone {
+			return nil, Error{Code: code}
+		}
+		if n == 0 {
+			return nil, Error{Code: errUnknownTopicOrPartition}
+		}
+		leaders = partitions
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	if leaders == nil {
+		return nil, Error{Code: errUnknownTopicOrPartition}
+	}
+	c.mu.Lock()
+	for id, addr := range brokers {
+		c.brokers[id] = addr
+	}
+	c.leaders[topic] = leaders
+	c.mu.Unlock()
+	return leaders, nil
+}
+
+// anyBroker sends a request to the first broker that answers: the bootstrap
+// brokers, then the ones learned since.
+func (c *Client) anyBroker(ctx context.Context, apiKey, version int16, body []byte) ([]byte, error) {
+	addrs := append([]string(nil), c.cfg.Brokers...)
+	c.mu.Lock()
+	for _, addr := range c.brokers {
+		addrs = append(addrs, addr)
+	}
+	c.mu.Unlock()
+	err := errors.New("kafka: no brokers")
+	for _, addr := range addrs {
+		var resp []byte
+		resp, err = c.roundTrip(ctx, addr, apiKey, version, body)
+		if err == nil || ctx.Err() != nil || errors.Is(err, ErrClosed) {
+			return resp, err
+		}
+	}
+	return nil, err
+}
+
+// roundTrip sends a request to the broker at addr, connecting first when
+// needed. A connection that fails is closed and dialed again next time.
+func (c *Client) roundTrip(ctx context.Context, addr string, apiKey, version int16, body []byte) ([]byte, error) {
+	cn, err := c.conn(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := cn.roundTrip(ctx, apiKey, version, body)
+	if err != nil {
+		c.mu.Lock()
+		if c.conns[addr] == cn {
+			delete(c.conns, addr)
+		}
+		c.mu.Unlock()
+		cn.close()
+	}
+	return resp, err
+}
+
+func (c *Client) conn(ctx context.Context, addr string) (*conn, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	cn := c.conns[addr]
+	c.mu.Unlock()
+	if cn != nil {
+		return cn, nil
+	}
+	cn, err := dial(ctx, addr, c.cfg.ClientID, c.cfg.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		cn.close()
+		return nil, ErrClosed
+	}
+	if other := c.conns[addr]; other != nil {
+		// Dialed concurrently; keep the first.
+		cn.close()
+		return other, nil
+	}
+	c.conns[addr] = cn
+	return cn, nil
+}
+
+// Close closes the connections; requests in flight fail.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for addr, cn := range c.conns {
+		cn.close()
+		delete(c.conns, addr)
+	}
+	return nil
+}
@@ -0,0 +1,391 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBroker is a one-broker cluster with topic "events" of two partitions,
+// and the coordinator of every group. It decodes the record batches
+// produced, checking their CRC, and fails the first Produce with
+// NOT_LEADER_FOR_PARTITION when notLeader is set. Fetches answer the
+// records from the offset on, followed by a partial batch.
+type fakeBroker struct {
+	addr string
+
+	mu        sync.Mutex
+	notLeader bool
+	metadata  int
+	records   map[int32][]string
+	committed map[int32]int64
+	clientIDs []string
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	b := &fakeBroker{addr: ln.Addr().String(), records: make(map[int32][]string), committed: make(map[int32]int64)}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(t, nc)
+		}
+	}()
+	return b
+}
+
+func (b *fakeBroker) serve(t *testing.T, nc net.Conn) {
+	defer nc.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(nc, size[:]); err != nil {
+			return
+		}
+		req := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(nc, req); err != nil {
+			return
+		}
+		d := decoder{b: req}
+		apiKey, _, correlationID := d.int16(), d.int16(), d.int32()
+		b.mu.Lock()
+		b.clientIDs = append(b.clientIDs, d.string())
+		b.mu.Unlock()
+
+		var resp encoder
+		resp.int32(correlationID)
+		switch apiKey {
+		case apiMetadata:
+			b.mu.Lock()
+			b.metadata++
+			b.mu.Unlock()
+			host, port, _ := net.SplitHostPort(b.addr)
+			p, _ := strconv.Atoi(port)
+			resp.int32(1)
+			resp.int32(7)
+			resp.string(host)
+			resp.int32(int32(p))
+			resp.int16(-1)
+			resp.int32(7)
+			var topics []string
+			for n := d.int32(); n > 0; n-- {
+				topics = append(topics, d.string())
+			}
+			resp.int32(int32(len(topics)))
+			for _, topic := range topics {
+				if topic != "events" {
+					resp.int16(errUnknownTopicOrPartition)
+					resp.string(topic)
+					resp.int8(0)
+					resp.int32(0)
+					continue
+				}
+				resp.int16(0)
+				resp.string(topic)
+				resp.int8(0)
+				resp.int32(2)
+				for p := int32(0); p < 2; p++ {
+					resp.int16(0)
+					resp.int32(p)
+					resp.int32(7)
+					resp.int32(0)
+					resp.int32(0)
+				}
+			}
+		case apiProduce:
+			d.string() // transactional ID
+			d.int16()
+			d.int32()
+			resp.int32(1)
+			d.int32()
+			resp.string(d.string())
+			n := d.int32()
+			resp.int32(n)
+			for ; n > 0; n-- {
+				p := d.int32()
+				code := int16(0)
+				b.mu.Lock()
+				if b.notLeader {
+					b.notLeader = false
+					code = errNotLeaderForPartition
+				} else if err := b.store(p, d.bytes()); err != nil {
+					t.Errorf("decoding batch: %v", err)
+				}
+				b.mu.Unlock()
+				resp.int32(p)
+				resp.int16(code)
+				resp.int64(0)
+				resp.int64(-1)
+			}
+			resp.int32(0)
+		case apiFetch:
+			d.take(4 + 4 + 4 + 4 + 1 + 4)
+			topic := d.string()
+			d.int32()
+			p, offset := d.int32(), d.int64()
+			b.mu.Lock()
+			values := b.records[p]
+			b.mu.Unlock()
+			resp.int32(0)
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(p)
+			if offset > int64(len(values)) {
+				resp.int16(errOffsetOutOfRange)
+				resp.int64(int64(len(values)))
+				resp.int64(-1)
+				resp.int32(-1)
+				resp.bytes(nil)
+				break
+			}
+			resp.int16(0)
+			resp.int64(int64(len(values)))
+			resp.int64(int64(len(values)))
+			resp.int32(-1)
+			// The whole log in one batch, as brokers send the batch
+			// holding offset, and a partial one.
+			var msgs []Message
+			for _, v := range values {
+				msgs = append(msgs, Message{Value: []byte(v), Headers: []Header{{Key: "k", Value: []byte("v")}}})
+			}
+			var batches []byte
+			if len(msgs) > 0 {
+				batches = recordBatch(msgs)
+			}
+			batches = append(batches, recordBatch([]Message{{Value: []byte("partial")}})[:20]...)
+			resp.bytes(batches)
+		case apiListOffsets:
+			d.int32()
+			d.int32()
+			topic := d.string()
+			d.int32()
+			p, at := d.int32(), d.int64()
+			b.mu.Lock()
+			offset := int64(len(b.records[p]))
+			b.mu.Unlock()
+			if at == OffsetEarliest {
+				offset = 0
+			}
+			resp.int32(1)
+			resp.string(topic)
+			resp.int32(1)
+			resp.int32(p)
+			resp.int16(0)
+			resp.int64(-1)
+			resp.int64(offset)
+		case apiFindCoordinator:
+			host, port, _ := net.SplitHostPort(b.addr)
+			p, _ := strconv.Atoi(port)
+			resp.int16(0)
+			resp.int32(7)
+			resp.string(host)
+			resp.int32(int32(p))
+		case apiOffsetFetch:
+			d.string()
+			d.int32()
+			topic := d.string()
+			resp.int32(1)
+			resp.string(topic)
+			n := d.int32()
+			resp.int32(n)
+			for ; n > 0; n-- {
+				p := d.int32()
+				b.mu.Lock()
+				offset, ok := b.committed[p]
+				b.mu.Unlock()
+				if !ok {
+					offset = -1
+				}
+				resp.int32(p)
+				resp.int64(offset)
+				resp.string("")
+				resp.int16(0)
+			}
+		case apiOffsetCommit:
+			d.string()
+			d.int32()
+			d.string()
+			d.int64()
+			d.int32()
+			topic := d.string()
+			resp.int32(1)
+			resp.string(topic)
+			n := d.int32()
+			resp.int32(n)
+			for ; n > 0; n-- {
+				p, offset := d.int32(), d.int64()
+				d.string()
+				b.mu.Lock()
+				b.committed[p] = offset
+				b.mu.Unlock()
+				resp.int32(p)
+				resp.int16(0)
+			}
+		}
+		out := binary.BigEndian.AppendUint32(nil, uint32(len(resp.b)))
+		if _, err := nc.Write(append(out, resp.b...)); err != nil {
+			return
+		}
+	}
+}
+
+// store decodes the values of a record batch.
+func (b *fakeBroker) store(partition int32, batch []byte) error {
+	d := decoder{b: batch}
+	d.int64()
+	d.int32()
+	d.int32()
+	if magic := d.int8(); magic != 2 {
+		return Error{Code: 2}
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.b, castagnoli) != crc {
+		return Error{Code: 2}
+	}
+	d.take(2 + 4 + 8 + 8 + 8 + 2 + 4)
+	for n := d.int32(); n > 0; n-- {
+		length, k := binary.Varint(d.b)
+		r := d.take(k + int(length))[k:]
+		r = r[1:]                // attributes
+		for i := 0; i < 2; i++ { // timestamp and offset deltas
+			_, k := binary.Varint(r)
+			r = r[k:]
+		}
+		keyLen, k := binary.Varint(r)
+		r = r[k+max(int(keyLen), 0):]
+		valueLen, k := binary.Varint(r)
+		b.records[partition] = append(b.records[partition], string(r[k:k+int(valueLen)]))
+	}
+	return d.err
+}
+
+func TestProduce(t *testing.T) {
+	b := newFakeBroker(t)
+	c := New(Config{Brokers: []string{b.addr}, ClientID: "test", DialTimeout: time.Second})
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() = %v", err)
+	}
+	msgs := []Message{
+		{Value: []byte("one")},
+		{Value: []byte("two"), Headers: []Header{{Key: "ce_type", Value: []byte("item.created")}}},
+		// murmur2("foobar") is even, "abc" odd.
+		{Key: []byte("foobar"), Value: []byte("keyed to 0")},
+		{Key: []byte("abc"), Value: []byte("keyed to 1")},
+	}
+	if err := c.Produce(ctx, "events", msgs); err != nil {
+		t.Fatalf("Produce() = %v", err)
+	}
+	b.mu.Lock()
+	got := len(b.records[0]) + len(b.records[1])
+	p0, p1 := b.records[0], b.records[1]
+	b.mu.Unlock()
+	if got != 4 || !slices.Contains(p0, "keyed to 0") || !slices.Contains(p1, "keyed to 1") {
+		t.Errorf("records = %q, %q", p0, p1)
+	}
+
+	// A leader change refreshes the metadata and retries.
+	b.mu.Lock()
+	b.notLeader = true
+	before := b.metadata
+	b.mu.Unlock()
+	if err := c.Produce(ctx, "events", []Message{{Value: []byte("retried")}}); err != nil {
+		t.Fatalf("Produce() after a leader change = %v", err)
+	}
+	b.mu.Lock()
+	if b.metadata != before+1 {
+		t.Errorf("metadata requests = %d, want %d", b.metadata, before+1)
+	}
+	if b.clientIDs[0] != "test" {
+		t.Errorf("client ID = %q", b.clientIDs[0])
+	}
+	b.mu.Unlock()
+
+	if err := c.Produce(ctx, "missing", msgs); err != (Error{Code: errUnknownTopicOrPartition}) {
+		t.Errorf("Produce() to a missing topic = %v", err)
+	}
+	c.Close()
+	if err := c.Produce(ctx, "events", msgs); err != ErrClosed {
+		t.Errorf("Produce() on a closed client = %v, want ErrClosed", err)
+	}
+}
+
+// The cases of Kafka's own partitioner tests.
+func TestMurmur2(t *testing.T) {
+	for in, want := range map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	} {
+		if got := murmur2([]byte(in)); got != want {
+			t.Errorf("murmur2(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestConsume(t *testing.T) {
+	b := newFakeBroker(t)
+	c := New(Config{Brokers: []string{b.addr}, ClientID: "test", DialTimeout: time.Second})
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	keyed := func(v string) Message { return Message{Key: []byte("foobar"), Value: []byte(v)} }
+	if err := c.Produce(ctx, "events", []Message{keyed("one"), keyed("two"), keyed("three")}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := c.Partitions(ctx, "events"); n != 2 || err != nil {
+		t.Fatalf("Partitions() = %d, %v", n, err)
+	}
+	records, hw, err := c.Fetch(ctx, "events", 0, 1, 100*time.Millisecond)
+	if err != nil || hw != 3 || len(records) != 2 || records[0].Offset != 1 || string(records[0].Value) != "two" ||
+		string(records[1].Value) != "three" || records[1].Headers[0].Key != "k" {
+		t.Fatalf("Fetch() = %+v, %d, %v", records, hw, err)
+	}
+	if _, _, err := c.Fetch(ctx, "events", 0, 9, 0); err != ErrOffsetOutOfRange {
+		t.Errorf("Fetch() past the end = %v, want ErrOffsetOutOfRange", err)
+	}
+	if offset, err := c.ListOffset(ctx, "events", 0, OffsetLatest); offset != 3 || err != nil {
+		t.Errorf("ListOffset(latest) = %d, %v", offset, err)
+	}
+
+	offsets, err := c.CommittedOffsets(ctx, "workers", "events", []int32{0, 1})
+	if err != nil || offsets[0] != -1 || offsets[1] != -1 {
+		t.Fatalf("CommittedOffsets() before a commit = %v, %v", offsets, err)
+	}
+	if err := c.CommitOffsets(ctx, "workers", "events", map[int32]int64{0: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if offsets, err := c.CommittedOffsets(ctx, "workers", "events", []int32{0}); err != nil || offsets[0] != 3 {
+		t.Errorf("CommittedOffsets() = %v, %v", offsets, err)
+	}
+}
+
+func TestDecodeRecordsCompressed(t *testing.T) {
+	batch := recordBatch([]Message{{Value: []byte("x")}})
+	batch[22] |= 1 // gzip
+	if _, err := decodeRecords(batch, 0); err != errCompressed {
+		t.Errorf("decodeRecords() of a gzipped batch = %v", err)
+	}
+}
@@ -0,0 +1,312 @@
+package kafka
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"time"
+)
+
+// API keys of the requests the client sends.
+const (
+	apiProduce         = 0
+	apiFetch           = 1
+	apiListOffsets     = 2
+	apiMetadata        = 3
+	apiOffsetCommit    = 8
+	apiOffsetFetch     = 9
+	apiFindCoordinator = 10
+)
+
+// Error codes the client tells apart. The others are reported as they are.
+const (
+	errNone                    = 0
+	errOffsetOutOfRange        = 1
+	errUnknownTopicOrPartition = 3
+	errLeaderNotAvailable      = 5
+	errNotLeaderForPartition   = 6
+	errCoordinatorLoading      = 14
+	errCoordinatorNotAvailable = 15
+	errNotCoordinator          = 16
+)
+
+// ErrOffsetOutOfRange is returned by Fetch for an offset the partition no
+// longer, or doesn't yet, hold.
+var ErrOffsetOutOfRange = Error{Code: errOffsetOutOfRange}
+
+// Error is an error code of the broker.
+type Error struct {
+	Code int16
+}
+
+func (e Error) Error() string {
+	switch e.Code {
+	case errUnknownTopicOrPartition:
+		return "kafka: unknown topic or partition"
+	case errLeaderNotAvailable:
+		return "kafka: leader not available"
+	case errNotLeaderForPartition:
+		return "kafka: not the leader for the partition"
+	case errOffsetOutOfRange:
+		return "kafka: offset out of range"
+	case errCoordinatorLoading, errCoordinatorNotAvailable, errNotCoordinator:
+		return "kafka: group coordinator not available"
+	}
+	return fmt.Sprintf("kafka: error code %d", e.Code)
+}
+
+// retriable reports whether the request may succeed once the metadata is
+// refreshed, e.g. after a leader election.
+func (e Error) retriable() bool {
+	return e.Code == errUnknownTopicOrPartition || e.Code == errLeaderNotAvailable || e.Code == errNotLeaderForPartition
+}
+
+// coordinatorMoved reports whether the group coordinator must be looked up
+// again.
+func (e Error) coordinatorMoved() bool {
+	return e.Code == errCoordinatorLoading || e.Code == errCoordinatorNotAvailable || e.Code == errNotCoordinator
+}
+
+var errShortResponse = errors.New("kafka: response too short")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// encoder appends the protocol's big-endian primitives.
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8)   { e.b = append(e.b, byte(v)) }
+func (e *encoder) int16(v int16) { e.b = binary.BigEndian.AppendUint16(e.b, uint16(v)) }
+func (e *encoder) int32(v int32) { e.b = binary.BigEndian.AppendUint32(e.b, uint32(v)) }
+func (e *encoder) int64(v int64) { e.b = binary.BigEndian.AppendUint64(e.b, uint64(v)) }
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *encoder) nullableString(s *string) {
+	if s == nil {
+		e.int16(-1)
+		return
+	}
+	e.string(*s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// varint and varbytes are the zigzag-encoded fields of records.
+func (e *encoder) varint(v int64) { e.b = binary.AppendVarint(e.b, v) }
+
+func (e *encoder) varbytes(b []byte) {
+	if b == nil {
+		e.varint(-1)
+		return
+	}
+	e.varint(int64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// decoder reads the primitives of a response, remembering the first
+// error so callers check once at the end.
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortResponse
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) int8() int8 {
+	if b := d.take(1); b != nil {
+		return int8(b[0])
+	}
+	return 0
+}
+
+func (d *decoder) int16() int16 {
+	if b := d.take(2); b != nil {
+		return int16(binary.BigEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (d *decoder) int32() int32 {
+	if b := d.take(4); b != nil {
+		return int32(binary.BigEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (d *decoder) int64() int64 {
+	if b := d.take(8); b != nil {
+		return int64(binary.BigEndian.Uint64(b))
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.take(int(n)))
+}
+
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// varint and varbytes read the zigzag-encoded fields of records.
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.err = errShortResponse
+		return 0
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *decoder) varbytes() []byte {
+	n := d.varint()
+	if n < 0 {
+		return nil
+	}
+	return d.take(int(n))
+}
+
+// arrayLen reads an array's length, bounded by what's left to read so a
+// corrupt length can't allocate without limit.
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if d.err == nil && n > len(d.b) {
+		d.err = errShortResponse
+	}
+	return max(n, 0)
+}
+
+// Message is a record to produce.
+type Message struct {
+	Key     []byte
+	Value   []byte
+	Headers []Header
+	// Zero means now.
+	Time time.Time
+}
+
+// Header is a record header.
+type Header struct {
+	Key   string
+	Value []byte
+}
+
+// recordBatch encodes msgs as a record batch of magic 2, uncompressed and
+// without a producer ID.
+func recordBatch(msgs []Message) []byte {
+	now := time.Now()
+	first := msgs[0].Time
+	if first.IsZero() {
+		first = now
+	}
+	firstMs, maxMs := first.UnixMilli(), first.UnixMilli()
+	var records encoder
+	for i, m := range msgs {
+		ts := m.Time
+		if ts.IsZero() {
+			ts = now
+		}
+		maxMs = max(maxMs, ts.UnixMilli())
+		var r encoder
+		r.int8(0) // attributes
+		r.varint(ts.UnixMilli() - firstMs)
+		r.varint(int64(i))
+		r.varbytes(m.Key)
+		r.varbytes(m.Value)
+		r.varint(int64(len(m.Headers)))
+		for _, h := range m.Headers {
+			r.varbytes([]byte(h.Key))
+			r.varbytes(h.Value)
+		}
+		records.varint(int64(len(r.b)))
+		records.b = append(records.b, r.b...)
+	}
+
+	// The CRC covers everything from the attributes on.
+	var body encoder
+	body.int16(0) // attributes: no compression, create time
+	body.int32(int32(len(msgs) - 1))
+	body.int64(firstMs)
+	body.int64(maxMs)
+	body.int64(-1) // producer ID
+	body.int16(-1) // producer epoch
+	body.int32(-1) // base sequence
+	body.int32(int32(len(msgs)))
+	body.b = append(body.b, records.b...)
+
+	var batch encoder
+	batch.int64(0) // base offset, assigned by the broker
+	batch.int32(int32(4 + 1 + 4 + len(body.b)))
+	batch.int32(-1) // partition leader epoch
+	batch.int8(2)   // magic
+	batch.int32(int32(crc32.Checksum(body.b, castagnoli)))
+	batch.b = append(batch.b, body.b...)
+	return batch.b
+}
+
+// murmur2 is the hash of Kafka's default partitioner, so keyed messages go
+// to the partition the Java client would pick.
+func murmur2(data []byte) int32 {
+	const (
+		seed = 0x9747b28c
+		m    = 0x5bd1e995
+		r    = 24
+	)
+	h := uint32(seed) ^ uint32(len(data))
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+		data = data[4:]
+	}
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
@@ -0,0 +1,116 @@
+// Package logging configures the process-wide slog logger. Output of the
+// standard library's log package goes through the same handler, so code
+// that still calls log.Printf produces structured lines too.
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+)
+
+// Formats accepted by New.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// level is the minimum level of the default logger, changed at runtime by
+// SetLevel.
+var level slog.LevelVar
+
+func parseLevel(name string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: want debug, info, warn or error", name)
+	}
+	return lvl, nil
+}
+
+// New returns a logger writing to w in the given format at the given
+// minimum level.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return newLogger(w, format, lvl)
+}
+
+func newLogger(w io.Writer, format string, lvl slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case FormatText:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("invalid log format %q: want %s or %s", format, FormatText, FormatJSON)
+}
+
+// Setup makes the logger of New the default for slog and the log package.
+// Invalid settings fall back to text at info level, like other invalid
+// configuration values.
+func Setup(w io.Writer, format, lvl string) *slog.Logger {
+	err := SetLevel(lvl)
+	if err != nil {
+		level.Set(slog.LevelInfo)
+	}
+	logger, formatErr := newLogger(w, format, &level)
+	if formatErr != nil {
+		logger, _ = newLogger(w, FormatText, &level)
+		err = errors.Join(err, formatErr)
+	}
+	slog.SetDefault(logger)
+	log.SetFlags(0)
+	log.SetOutput(&logWriter{logger: logger})
+	if err != nil {
+		logger.Warn(err.Error())
+	}
+	return logger
+}
+
+// SetLevel changes the minimum level of the logger of Setup.
+func SetLevel(name string) error {
+	lvl, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.Set(lvl)
+	return nil
+}
+
+// CheckLevel reports whether SetLevel would accept name, without changing
+// the level.
+func CheckLevel(name string) error {
+	_, err := parseLevel(name)
+	return err
+}
+
+// Level is the current minimum level of the logger of Setup.
+func Level() string {
+	return strings.ToLower(level.Level().String())
+}
+
+// logWriter passes log package output to slog. The existing messages start
+// with "Error" or "Failed" when something went wrong, which decides the
+// level, so LOG_LEVEL=error still shows them.
+type logWriter struct {
+	logger *slog.Logger
+}
+
+func (lw *logWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	level := slog.LevelInfo
+	if strings.HasPrefix(msg, "Error") || strings.HasPrefix(msg, "Failed") {
+		level = slog.LevelError
+	} else if strings.HasPrefix(msg, "Invalid") || strings.HasPrefix(msg, "Warning") {
+		level = slog.LevelWarn
+	}
+	lw.logger.Log(context.Background(), level, msg)
+	return len(p), nil
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept", "status", 503)
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("%q: %v", buf.String(), err)
+	}
+	if line["msg"] != "kept" || line["level"] != "WARN" || line["status"] != float64(503) {
+		t.Errorf("logged %v", line)
+	}
+
+	for _, tt := range []struct{ format, level string }{{"xml", "info"}, {FormatText, "loud"}, {"", ""}} {
+		if _, err := New(io.Discard, tt.format, tt.level); err == nil {
+			t.Errorf("New(%q, %q) accepted", tt.format, tt.level)
+		}
+	}
+}
+
+func TestSetup(t *testing.T) {
+	prevSlog, prevOut, prevFlags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(prevSlog)
+		log.SetOutput(prevOut)
+		log.SetFlags(prevFlags)
+	})
+
+	var buf bytes.Buffer
+	Setup(&buf, FormatJSON, "error")
+	log.Printf("Starting up")
+	log.Printf("Error encoding info response: %v", io.ErrShortWrite)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], `"level":"ERROR"`) || !strings.Contains(lines[0], "Error encoding info response") {
+		t.Errorf("log output at level error = %q", buf.String())
+	}
+
+	// The level changes without a new Setup.
+	buf.Reset()
+	if err := SetLevel("loud"); err == nil {
+		t.Error("SetLevel accepted an invalid level")
+	}
+	if err := CheckLevel("debug"); err != nil || Level() != "error" {
+		t.Errorf("CheckLevel(debug) = %v, Level() = %q", err, Level())
+	}
+	if err := SetLevel("info"); err != nil || Level() != "info" {
+		t.Fatalf("SetLevel(info) = %v, Level() = %q", err, Level())
+	}
+	log.Printf("Starting up")
+	if !strings.Contains(buf.String(), "Starting up") {
+		t.Errorf("log output after SetLevel(info) = %q", buf.String())
+	}
+
+	// Invalid settings fall back to text at info level, with a warning.
+	buf.Reset()
+	Setup(&buf, "xml", "info")
+	log.Printf("Starting up")
+	if out := buf.String(); !strings.Contains(out, `level=WARN msg="invalid log format`) || !strings.Contains(out, "msg=\"Starting up\"") {
+		t.Errorf("fallback output = %q", out)
+	}
+}
@@ -0,0 +1,312 @@
+// Package metrics keeps counters, histograms and gauges in memory and
+// serves them in the Prometheus text exposition format. It covers what the
+// service exposes and nothing more, so the module needs no client library.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of latency histograms:
+// Prometheus' defaults, from 5ms to 10s.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector is a metric family that renders itself.
+type collector interface {
+	write(b *bytes.Buffer)
+}
+
+// Registry holds metric families in registration order.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (reg *Registry) register(name string, c collector) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.names[name] {
+		panic("metrics: " + name + " registered twice")
+	}
+	reg.names[name] = true
+	reg.collectors = append(reg.collectors, c)
+}
+
+// Counter registers a counter with the given label names.
+func (reg *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{family: family{name: name, help: help, labels: labels}, values: make(map[string]*counterValue)}
+	reg.register(name, c)
+	return c
+}
+
+// Histogram registers a histogram with the given bucket upper bounds,
+// which must be sorted, and label names.
+func (reg *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{family: family{name: name, help: help, labels: labels}, buckets: buckets,
+		values: make(map[string]*histogramValue)}
+	reg.register(name, h)
+	return h
+}
+
+// Gauge registers a gauge with the given label names, set by its owner.
+func (reg *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{family: family{name: name, help: help, labels: labels}, values: make(map[string]*counterValue)}
+	reg.register(name, g)
+	return g
+}
+
+// GaugeFunc registers a gauge whose value is read from fn at scrape time,
+// with constant labels.
+func (reg *Registry) GaugeFunc(name, help string, labels map[string]string, fn func() float64) {
+	reg.register(name, &gaugeFunc{name: name, help: help, labels: labels, fn: fn})
+}
+
+// Gather renders every family in the text exposition format.
+func (reg *Registry) Gather() []byte {
+	reg.mu.Lock()
+	collectors := append([]collector(nil), reg.collectors...)
+	reg.mu.Unlock()
+	var b bytes.Buffer
+	for _, c := range collectors {
+		c.write(&b)
+	}
+	return b.Bytes()
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (reg *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(reg.Gather()); err != nil {
+		log.Printf("Error writing metrics: %v", err)
+	}
+}
+
+// family is the name, help and label names shared by the vector types.
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) header(b *bytes.Buffer, typ string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, escapeHelp(f.help), f.name, typ)
+}
+
+// CounterVec is a counter partitioned by label values.
+type CounterVec struct {
+	family
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	value  float64
+}
+
+// Inc adds one to the counter of the label values.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter of the label
+// values.
+func (c *CounterVec) Add(v float64, values ...string) {
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cv, ok := c.values[key]
+	if !ok {
+		cv = &counterValue{labels: append([]string(nil), values...)}
+		c.values[key] = cv
+	}
+	cv.value += v
+}
+
+func (c *CounterVec) write(b *bytes.Buffer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(b, "counter")
+	for _, key := range sortedKeys(c.values) {
+		cv := c.values[key]
+		sample(b, c.name, c.labels, cv.labels, "", "", cv.value)
+	}
+}
+
+// GaugeVec is a gauge partitioned by label values.
+type GaugeVec struct {
+	family
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+// Set sets the gauge of the label values to v.
+func (g *GaugeVec) Set(v float64, values ...string) {
+	key := g.key(values)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gv, ok := g.values[key]
+	if !ok {
+		gv = &counterValue{labels: append([]string(nil), values...)}
+		g.values[key] = gv
+	}
+	gv.value = v
+}
+
+// Reset drops the gauges of every label value, for gauges whose label
+// values come and go.
+func (g *GaugeVec) Reset() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	clear(g.values)
+}
+
+func (g *GaugeVec) write(b *bytes.Buffer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.header(b, "gauge")
+	for _, key := range sortedKeys(g.values) {
+		gv := g.values[key]
+		sample(b, g.name, g.labels, gv.labels, "", "", gv.value)
+	}
+}
+
+// HistogramVec is a histogram partitioned by label values.
+type HistogramVec struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// Observe records v in the histogram of the label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{labels: append([]string(nil), values...), counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		hv.counts[i]++
+	}
+	hv.count++
+	hv.sum += v
+}
+
+func (h *HistogramVec) write(b *bytes.Buffer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(b, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += hv.counts[i]
+			sample(b, h.name+"_bucket", h.labels, hv.labels, "le", formatValue(upper), float64(cumulative))
+		}
+		sample(b, h.name+"_bucket", h.labels, hv.labels, "le", "+Inf", float64(hv.count))
+		sample(b, h.name+"_sum", h.labels, hv.labels, "", "", hv.sum)
+		sample(b, h.name+"_count", h.labels, hv.labels, "", "", float64(hv.count))
+	}
+}
+
+type gaugeFunc struct {
+	name   string
+	help   string
+	labels map[string]string
+	fn     func() float64
+}
+
+func (g *gaugeFunc) write(b *bytes.Buffer) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n", g.name, escapeHelp(g.help), g.name)
+	names := sortedKeys(g.labels)
+	values := make([]string, len(names))
+	for i, name := range names {
+		values[i] = g.labels[name]
+	}
+	sample(b, g.name, names, values, "", "", g.fn())
+}
+
+// sample writes one line, with an extra label such as a bucket's "le"
+// after the others when extraName is set.
+func sample(b *bytes.Buffer, name string, labels, values []string, extraName, extraValue string, v float64) {
+	b.WriteString(name)
+	if len(labels) > 0 || extraName != "" {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, label, escapeLabel(values[i]))
+		}
+		if extraName != "" {
+			if len(labels) > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, `%s="%s"`, extraName, extraValue)
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(v))
+	b.WriteByte('\n')
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
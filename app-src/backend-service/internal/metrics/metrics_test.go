@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGather(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.Counter("requests_total", "Requests served.", "route", "code")
+	latency := reg.Histogram("duration_seconds", "Request latency.", []float64{0.1, 1}, "route")
+	lag := reg.Gauge("consumer_lag", "Messages not consumed yet.", "partition")
+	reg.GaugeFunc("build_info", "Build of the running binary.", map[string]string{"version": `v1"x`}, func() float64 { return 1 })
+
+	requests.Inc("info", "200")
+	requests.Add(2, "info", "200")
+	requests.Inc("echo", "500")
+	latency.Observe(0.05, "info")
+	latency.Observe(0.1, "info")
+	latency.Observe(3, "info")
+	lag.Set(5, "1")
+	lag.Set(2, "0")
+	lag.Set(0, "1")
+
+	want := `# HELP requests_total Requests served.
+# TYPE requests_total counter
+requests_total{route="echo",code="500"} 1
+requests_total{route="info",code="200"} 3
+# HELP duration_seconds Request latency.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="info",le="0.1"} 2
+duration_seconds_bucket{route="info",le="1"} 2
+duration_seconds_bucket{route="info",le="+Inf"} 3
+duration_seconds_sum{route="info"} 3.15
+duration_seconds_count{route="info"} 3
+# HELP consumer_lag Messages not consumed yet.
+# TYPE consumer_lag gauge
+consumer_lag{partition="0"} 2
+consumer_lag{partition="1"} 0
+# HELP build_info Build of the running binary.
+# TYPE build_info gauge
+build_info{version="v1\"x"} 1
+`
+	if got := string(reg.Gather()); got != want {
+		t.Errorf("Gather =\n%s\nwant\n%s", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+}
+
+func TestGaugeReset(t *testing.T) {
+	reg := NewRegistry()
+	versions := reg.Gauge("serving", "Replicas serving each version.", "version")
+	versions.Set(2, "1.2.0")
+	versions.Reset()
+	versions.Set(3, "1.3.0")
+
+	want := `# HELP serving Replicas serving each version.
+# TYPE serving gauge
+serving{version="1.3.0"} 3
+`
+	if got := string(reg.Gather()); got != want {
+		t.Errorf("Gather =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc with too few label values did not panic")
+		}
+	}()
+	NewRegistry().Counter("c", "", "a", "b").Inc("x")
+}
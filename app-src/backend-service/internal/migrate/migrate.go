@@ -0,0 +1,250 @@
+// Package migrate applies the service's SQL migrations, embedded in the
+// binary, to its PostgreSQL database. Migrations are numbered files in
+// migrations/, NNNN_name.up.sql with an optional NNNN_name.down.sql, and
+// the versions applied are recorded in the schema_migrations table.
+//
+// Each migration runs in one transaction with its bookkeeping, so a failed
+// migration leaves nothing behind. Runners that race apply each migration
+// once: the second one waits for the first to commit, then skips it.
+package migrate
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+)
+
+//go:embed migrations/*.sql
+var embedded embed.FS
+
+// fileName matches migration files: version, name and direction.
+var fileName = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+const createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    bigint PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+// Migration is one schema change. Down is empty when it can't be reverted.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status is the state of one migration in the database.
+type Status struct {
+	Version int64
+	Name    string
+	Applied bool
+	// RFC 3339; empty when pending
+	AppliedAt string
+	// Applied by a newer build; this one has no such migration
+	Unknown bool
+}
+
+// DB runs the migrations' statements; *postgres.DB is one.
+type DB interface {
+	Query(ctx context.Context, sql string, args ...any) (*postgres.Result, error)
+	Exec(ctx context.Context, script string) error
+}
+
+// Embedded returns the migrations built into the binary.
+func Embedded() ([]Migration, error) {
+	return Load(embedded, "migrations")
+}
+
+// Load reads the migrations in dir of fsys, ordered by version. Every
+// version needs an up file, and no two files may share a version.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s: name must be NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: %w", entry.Name(), err)
+		}
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up file", m)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations on a database.
+type Migrator struct {
+	db         DB
+	migrations []Migration
+}
+
+// New returns a Migrator of migrations, ordered by version as Load returns
+// them.
+func New(db DB, migrations []Migration) *Migrator {
+	return &Migrator{db: db, migrations: migrations}
+}
+
+// Status reports every migration, applied or pending, and the applied
+// versions this build doesn't know, ordered by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := Status{Version: mig.Version, Name: mig.Name}
+		if a, ok := applied[mig.Version]; ok {
+			s.Applied, s.AppliedAt = true, a.AppliedAt
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for _, a := range applied {
+		statuses = append(statuses, a)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// Up applies the pending migrations in order, at most n of them when n is
+// positive, and returns those it applied. It stops at the first failure.
+func (m *Migrator) Up(ctx context.Context, n int) ([]Migration, error) {
+	if err := m.db.Exec(ctx, createTable); err != nil {
+		return nil, fmt.Errorf("creating schema_migrations: %w", err)
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if n > 0 && len(done) == n {
+			break
+		}
+		// The bookkeeping goes first: a concurrent runner blocks on the
+		// version's key until this transaction ends, then fails on it.
+		script := fmt.Sprintf("INSERT INTO schema_migrations (version, name) VALUES (%d, '%s');\n%s",
+			mig.Version, mig.Name, mig.Up)
+		err := m.db.Exec(ctx, script)
+		if postgres.HasCode(err, postgres.CodeUniqueViolation) {
+			continue
+		}
+		if err != nil {
+			return done, fmt.Errorf("applying %s: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// Down reverts the n most recent applied migrations, newest first, and
+// returns those it reverted. It fails on a migration without a down file
+// or one this build doesn't know.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[int64]Migration, len(m.migrations))
+	for _, mig := range m.migrations {
+		known[mig.Version] = mig
+	}
+	var done []Migration
+	for i := len(statuses) - 1; i >= 0 && len(done) < n; i-- {
+		s := statuses[i]
+		if !s.Applied {
+			continue
+		}
+		mig, ok := known[s.Version]
+		if !ok {
+			return done, fmt.Errorf("can't revert version %d: this build doesn't have it", s.Version)
+		}
+		if mig.Down == "" {
+			return done, fmt.Errorf("can't revert %s: it has no down file", mig)
+		}
+		script := fmt.Sprintf("DELETE FROM schema_migrations WHERE version = %d;\n%s", mig.Version, mig.Down)
+		if err := m.db.Exec(ctx, script); err != nil {
+			return done, fmt.Errorf("reverting %s: %w", mig, err)
+		}
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// applied returns the applied migrations by version; none before the
+// first migration created schema_migrations.
+func (m *Migrator) applied(ctx context.Context) (map[int64]Status, error) {
+	res, err := m.db.Query(ctx, "SELECT version, name, applied_at FROM schema_migrations ORDER BY version")
+	if postgres.HasCode(err, postgres.CodeUndefinedTable) {
+		return map[int64]Status{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading schema_migrations: %w", err)
+	}
+	applied := make(map[int64]Status, len(res.Rows))
+	for _, row := range res.Rows {
+		if len(row) != 3 || row[0] == nil || row[1] == nil || row[2] == nil {
+			return nil, errors.New("unexpected row in schema_migrations")
+		}
+		version, err := strconv.ParseInt(*row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("reading schema_migrations: %w", err)
+		}
+		appliedAt := *row[2]
+		if t, err := time.Parse(postgres.TimestampLayout, appliedAt); err == nil {
+			appliedAt = t.UTC().Format(time.RFC3339)
+		}
+		applied[version] = Status{Version: version, Name: *row[1], Applied: true, AppliedAt: appliedAt, Unknown: true}
+	}
+	return applied, nil
+}
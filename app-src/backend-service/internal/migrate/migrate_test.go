@@ -0,0 +1,174 @@
+package migrate
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+)
+
+// fakeDB keeps schema_migrations in memory and records the scripts it ran.
+// Scripts mentioning "broken" fail.
+type fakeDB struct {
+	table   bool
+	applied map[int64]string
+	scripts []string
+}
+
+var (
+	insertVersion = regexp.MustCompile(`^INSERT INTO schema_migrations \(version, name\) VALUES \((\d+), '(\w+)'\);`)
+	deleteVersion = regexp.MustCompile(`^DELETE FROM schema_migrations WHERE version = (\d+);`)
+)
+
+func (db *fakeDB) Query(_ context.Context, sql string, _ ...any) (*postgres.Result, error) {
+	if !db.table {
+		return nil, &postgres.Error{Severity: "ERROR", Code: postgres.CodeUndefinedTable, Message: "relation does not exist"}
+	}
+	res := &postgres.Result{Columns: []string{"version", "name", "applied_at"}}
+	for version, name := range db.applied {
+		v, n, at := strconv.FormatInt(version, 10), name, "2026-10-16 08:00:00.5+00"
+		res.Rows = append(res.Rows, []*string{&v, &n, &at})
+	}
+	return res, nil
+}
+
+func (db *fakeDB) Exec(_ context.Context, script string) error {
+	if strings.Contains(script, "broken") {
+		return &postgres.Error{Severity: "ERROR", Code: "42601", Message: "syntax error"}
+	}
+	db.scripts = append(db.scripts, script)
+	if strings.HasPrefix(script, "CREATE TABLE IF NOT EXISTS schema_migrations") {
+		db.table = true
+	}
+	if m := insertVersion.FindStringSubmatch(script); m != nil {
+		v, _ := strconv.ParseInt(m[1], 10, 64)
+		if _, ok := db.applied[v]; ok {
+			return &postgres.Error{Severity: "ERROR", Code: postgres.CodeUniqueViolation, Message: "duplicate key"}
+		}
+		db.applied[v] = m[2]
+	}
+	if m := deleteVersion.FindStringSubmatch(script); m != nil {
+		v, _ := strconv.ParseInt(m[1], 10, 64)
+		delete(db.applied, v)
+	}
+	return nil
+}
+
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	migrations, err := Load(fstest.MapFS{
+		"m/0002_add_tags.up.sql":        {Data: []byte("ALTER TABLE items ADD tags text;")},
+		"m/0001_create_items.up.sql":    {Data: []byte("CREATE TABLE items (id int);")},
+		"m/0001_create_items.down.sql":  {Data: []byte("DROP TABLE items;")},
+		"m/0003_add_index.up.sql":       {Data: []byte("CREATE INDEX ON items (name);")},
+		"m/0003_add_index.down.sql":     {Data: []byte("DROP INDEX items_name_idx;")},
+		"m/0002_add_tags.down.sql":      {Data: []byte("ALTER TABLE items DROP tags;")},
+		"m/0004_not_reverted.up.sql":    {Data: []byte("SELECT 1;")},
+		"m/subdirectory/ignored.up.sql": {Data: []byte("nope")},
+	}, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return migrations
+}
+
+func TestLoad(t *testing.T) {
+	migrations := testMigrations(t)
+	var names []string
+	for _, m := range migrations {
+		names = append(names, m.String())
+	}
+	if got := strings.Join(names, " "); got != "0001_create_items 0002_add_tags 0003_add_index 0004_not_reverted" {
+		t.Errorf("Load() = %s", got)
+	}
+	if migrations[0].Down != "DROP TABLE items;" || migrations[3].Down != "" {
+		t.Errorf("down scripts = %q, %q", migrations[0].Down, migrations[3].Down)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":    {"m/create_items.up.sql": {}},
+		"no up file":  {"m/0001_create_items.down.sql": {}},
+		"two names":   {"m/0001_a.up.sql": {}, "m/0001_b.up.sql": {}},
+		"missing dir": {},
+	} {
+		if _, err := Load(fsys, "m"); err == nil {
+			t.Errorf("%s: Load() succeeded", name)
+		}
+	}
+
+	if _, err := Embedded(); err != nil {
+		t.Errorf("Embedded() = %v", err)
+	}
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDB{applied: make(map[int64]string)}
+	m := New(db, testMigrations(t))
+
+	statuses, err := m.Status(ctx)
+	if err != nil || len(statuses) != 4 || statuses[0].Applied {
+		t.Fatalf("Status() before any migration = %+v, %v", statuses, err)
+	}
+
+	if done, err := m.Up(ctx, 2); err != nil || len(done) != 2 || done[1].Version != 2 {
+		t.Fatalf("Up(2) = %v, %v", done, err)
+	}
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 2 || done[0].Version != 3 {
+		t.Fatalf("Up(0) = %v, %v", done, err)
+	}
+	if done, err := m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Errorf("Up(0) when up to date = %v, %v", done, err)
+	}
+	statuses, _ = m.Status(ctx)
+	if !statuses[3].Applied || statuses[3].AppliedAt != "2026-10-16T08:00:00Z" {
+		t.Errorf("Status() = %+v", statuses)
+	}
+
+	// Migrations run with their bookkeeping, in one script.
+	want := "INSERT INTO schema_migrations (version, name) VALUES (4, 'not_reverted');\nSELECT 1;"
+	found := false
+	for _, script := range db.scripts {
+		found = found || script == want
+	}
+	if !found {
+		t.Errorf("scripts = %q, want one of %q", db.scripts, want)
+	}
+
+	// Version 4 has no down file.
+	if done, err := m.Down(ctx, 1); err == nil || len(done) != 0 {
+		t.Errorf("Down(1) = %v, %v; want an error", done, err)
+	}
+	delete(db.applied, 4)
+	if done, err := m.Down(ctx, 2); err != nil || len(done) != 2 || done[0].Version != 3 || done[1].Version != 2 {
+		t.Errorf("Down(2) = %v, %v", done, err)
+	}
+	if _, ok := db.applied[1]; !ok || len(db.applied) != 1 {
+		t.Errorf("applied after Down(2) = %v", db.applied)
+	}
+}
+
+func TestUpFailures(t *testing.T) {
+	ctx := context.Background()
+	migrations := testMigrations(t)
+	migrations[1].Up = "broken"
+	db := &fakeDB{applied: make(map[int64]string)}
+	done, err := New(db, migrations).Up(ctx, 0)
+	if err == nil || len(done) != 1 || !strings.Contains(err.Error(), "0002_add_tags") {
+		t.Errorf("Up() = %v, %v; want 0001 applied, then an error", done, err)
+	}
+
+	// Versions applied by a newer build are reported, and aren't reverted.
+	db.applied[9] = "from_the_future"
+	statuses, err := New(db, migrations).Status(ctx)
+	if err != nil || !statuses[len(statuses)-1].Unknown {
+		t.Errorf("Status() = %+v, %v", statuses, err)
+	}
+	if _, err := New(db, migrations).Down(ctx, 1); err == nil {
+		t.Error("Down() reverted an unknown version")
+	}
+}
@@ -0,0 +1,9 @@
+-- Items of /api/v1/items. IF NOT EXISTS adopts tables created by builds
+-- that created the table themselves.
+CREATE TABLE IF NOT EXISTS items (
+    id          bigserial PRIMARY KEY,
+    name        text NOT NULL,
+    description text NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now()
+);
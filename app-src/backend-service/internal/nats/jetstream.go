@@ -0,0 +1,171 @@
+package nats
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// JetStream error codes the client tells apart.
+const (
+	errCodeStreamNotFound = 10059
+)
+
+// APIError is an error answered by the JetStream API.
+type APIError struct {
+	Code        int    `json:"code"`
+	ErrCode     int    `json:"err_code"`
+	Description string `json:"description"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("nats: jetstream: %s (%d)", e.Description, e.ErrCode)
+}
+
+// StreamConfig is the part of a stream's configuration the client sets.
+type StreamConfig struct {
+	Name     string   `json:"name"`
+	Subjects []string `json:"subjects"`
+	// Zero keeps messages until the stream's other limits drop them.
+	MaxAge  time.Duration `json:"max_age,omitempty"`
+	Storage string        `json:"storage,omitempty"`
+}
+
+// ConsumerConfig is the part of a durable pull consumer's configuration
+// the client sets.
+type ConsumerConfig struct {
+	Durable       string        `json:"durable_name"`
+	AckPolicy     string        `json:"ack_policy"`
+	AckWait       time.Duration `json:"ack_wait,omitempty"`
+	MaxDeliver    int           `json:"max_deliver,omitempty"`
+	FilterSubject string        `json:"filter_subject,omitempty"`
+}
+
+// ConsumerInfo is the state of a consumer: NumPending messages of the
+// stream it hasn't delivered yet, NumAckPending delivered and not acked.
+type ConsumerInfo struct {
+	Stream         string `json:"stream_name"`
+	Name           string `json:"name"`
+	NumPending     uint64 `json:"num_pending"`
+	NumAckPending  int    `json:"num_ack_pending"`
+	NumRedelivered int    `json:"num_redelivered"`
+}
+
+// EnsureStream creates the stream unless it exists. An existing stream
+// keeps its configuration.
+func (c *Conn) EnsureStream(ctx context.Context, cfg StreamConfig) error {
+	err := c.jsRequest(ctx, "STREAM.INFO."+cfg.Name, nil, nil)
+	if apiErr, ok := err.(*APIError); ok && apiErr.ErrCode == errCodeStreamNotFound {
+		err = c.jsRequest(ctx, "STREAM.CREATE."+cfg.Name, cfg, nil)
+	}
+	return err
+}
+
+// EnsureConsumer creates a durable pull consumer on stream, or updates it
+// to cfg.
+func (c *Conn) EnsureConsumer(ctx context.Context, stream string, cfg ConsumerConfig) error {
+	req := struct {
+		Stream string         `json:"stream_name"`
+		Config ConsumerConfig `json:"config"`
+	}{stream, cfg}
+	return c.jsRequest(ctx, "CONSUMER.DURABLE.CREATE."+stream+"."+cfg.Durable, req, nil)
+}
+
+// ConsumerInfo returns the state of a consumer.
+func (c *Conn) ConsumerInfo(ctx context.Context, stream, consumer string) (ConsumerInfo, error) {
+	var info ConsumerInfo
+	err := c.jsRequest(ctx, "CONSUMER.INFO."+stream+"."+consumer, nil, &info)
+	return info, err
+}
+
+// Fetch pulls up to batch messages from a pull consumer, waiting up to
+// expires for them. It returns early with fewer, or none, when the
+// consumer has no more. Each message must be acked with Ack.
+func (c *Conn) Fetch(ctx context.Context, stream, consumer string, batch int, expires time.Duration) ([]*Msg, error) {
+	inbox := NewInbox()
+	sub, err := c.Subscribe(inbox, "")
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	req, err := json.Marshal(struct {
+		Batch   int           `json:"batch"`
+		Expires time.Duration `json:"expires"`
+	}{batch, expires})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Publish("$JS.API.CONSUMER.MSG.NEXT."+stream+"."+consumer, inbox, req); err != nil {
+		return nil, err
+	}
+	// The server ends the pull itself after expires; the margin covers the
+	// round trip.
+	ctx, cancel := context.WithTimeout(ctx, expires+2*time.Second)
+	defer cancel()
+	var msgs []*Msg
+	for len(msgs) < batch {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			if len(msgs) > 0 && ctx.Err() != nil {
+				return msgs, nil
+			}
+			return msgs, err
+		}
+		switch msg.Status {
+		case "":
+			msgs = append(msgs, msg)
+		case "100": // heartbeat
+		case "404", "408": // no messages, or the pull expired
+			return msgs, nil
+		case "503":
+			return msgs, fmt.Errorf("nats: no responders on %s: is JetStream enabled?", stream)
+		default:
+			return msgs, fmt.Errorf("nats: pull from %s.%s ended with status %s", stream, consumer, msg.Status)
+		}
+	}
+	return msgs, nil
+}
+
+// Ack acknowledges a message fetched from a consumer, so it isn't
+// delivered again.
+func (c *Conn) Ack(msg *Msg) error {
+	return c.Publish(msg.Reply, "", []byte("+ACK"))
+}
+
+// Nak asks for a fetched message to be delivered again.
+func (c *Conn) Nak(msg *Msg) error {
+	return c.Publish(msg.Reply, "", []byte("-NAK"))
+}
+
+// jsRequest sends a JetStream API request and decodes the answer into
+// resp, unless it's an error.
+func (c *Conn) jsRequest(ctx context.Context, subject string, req, resp any) error {
+	var data bytes.Buffer
+	if req != nil {
+		// Subjects hold wildcards such as ">", which aren't HTML here.
+		enc := json.NewEncoder(&data)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(req); err != nil {
+			return err
+		}
+	}
+	msg, err := c.Request(ctx, "$JS.API."+subject, bytes.TrimSpace(data.Bytes()))
+	if err != nil {
+		return err
+	}
+	var answer struct {
+		Error *APIError `json:"error"`
+	}
+	if err := json.Unmarshal(msg.Data, &answer); err != nil {
+		return fmt.Errorf("nats: invalid JetStream answer: %w", err)
+	}
+	if answer.Error != nil {
+		return answer.Error
+	}
+	if resp != nil {
+		return json.Unmarshal(msg.Data, resp)
+	}
+	return nil
+}
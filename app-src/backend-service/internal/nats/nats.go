@@ -0,0 +1,474 @@
+// Package nats is a small NATS client that speaks the text protocol
+// directly: publishing, subscriptions with queue groups, request/reply and
+// flushes, over one connection without TLS or reconnects. That covers the
+// service's events and the worker consuming them through the JetStream API
+// without a client dependency; callers dial again when a connection fails.
+package nats
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/netctx"
+)
+
+// DefaultPort is the client port of NATS servers.
+const DefaultPort = "4222"
+
+// subscriptionBuffer bounds the messages waiting for Next on one
+// subscription; further ones are dropped, as NATS does for slow consumers.
+const subscriptionBuffer = 4096
+
+// ErrClosed is returned by a closed Conn and its subscriptions.
+var ErrClosed = errors.New("nats: connection closed")
+
+// Config describes how to reach the server.
+type Config struct {
+	// nats://host:port, with user:password@ or token@ for authentication
+	URL string
+	// Reported in the server's connection list
+	Name string
+	// Bounds connecting and the handshake
+	DialTimeout time.Duration
+}
+
+// Msg is a message received on a subscription. Status is the status of
+// messages the server sends with one, such as "404" when a JetStream pull
+// finds no message.
+type Msg struct {
+	Subject string
+	Reply   string
+	Header  map[string][]string
+	Status  string
+	Data    []byte
+}
+
+// serverInfo is the part of the server's INFO the client uses.
+type serverInfo struct {
+	ServerID     string `json:"server_id"`
+	Version      string `json:"version"`
+	MaxPayload   int    `json:"max_payload"`
+	AuthRequired bool   `json:"auth_required"`
+}
+
+// Conn is a connection to a NATS server. It's safe for concurrent use.
+type Conn struct {
+	nc   net.Conn
+	info serverInfo
+
+	wmu sync.Mutex
+	w   *bufio.Writer
+
+	mu      sync.Mutex
+	subs    map[int64]*Subscription
+	nextSID int64
+	pongs   []chan error
+	err     error
+	done    chan struct{}
+}
+
+// Dial connects and authenticates.
+func Dial(ctx context.Context, cfg Config) (*Conn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("nats: invalid URL %q, want nats://host:port", cfg.URL)
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		addr = net.JoinHostPort(u.Hostname(), DefaultPort)
+	}
+	if cfg.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.DialTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	stop := netctx.Watch(ctx, nc)
+	c := &Conn{nc: nc, w: bufio.NewWriter(nc), subs: make(map[int64]*Subscription), done: make(chan struct{})}
+	r := bufio.NewReader(nc)
+	err = c.handshake(r, cfg, u.User)
+	if !stop() && err != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", addr, err)
+	}
+	_ = nc.SetDeadline(time.Time{})
+	go c.readLoop(r)
+	return c, nil
+}
+
+// handshake reads INFO, sends CONNECT and waits for the PONG that follows
+// a successful authentication.
+func (c *Conn) handshake(r *bufio.Reader, cfg Config, user *url.Userinfo) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("nats: expected INFO, got %q", line)
+	}
+	if err := json.Unmarshal([]byte(info), &c.info); err != nil {
+		return fmt.Errorf("nats: invalid INFO: %w", err)
+	}
+	connect := map[string]any{
+		"verbose": false, "pedantic": false, "lang": "go", "version": "0.1.0",
+		"protocol": 1, "headers": true, "no_responders": true,
+	}
+	if cfg.Name != "" {
+		connect["name"] = cfg.Name
+	}
+	if user != nil {
+		if password, ok := user.Password(); ok {
+			connect["user"], connect["pass"] = user.Username(), password
+		} else {
+			connect["auth_token"] = user.Username()
+		}
+	}
+	payload, _ := json.Marshal(connect)
+	if _, err := fmt.Fprintf(c.w, "CONNECT %s\r\nPING\r\n", payload); err != nil {
+		return err
+	}
+	if err := c.w.Flush(); err != nil {
+		return err
+	}
+	for {
+		line, err := readLine(r)
+		switch {
+		case err != nil:
+			return err
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return protocolError(line)
+		}
+	}
+}
+
+// Publish sends data to subject, with reply as the subject answers go to
+// unless it's empty.
+func (c *Conn) Publish(subject, reply string, data []byte) error {
+	if c.info.MaxPayload > 0 && len(data) > c.info.MaxPayload {
+		return fmt.Errorf("nats: payload of %d bytes exceeds the server's maximum of %d", len(data), c.info.MaxPayload)
+	}
+	cmd := "PUB " + subject + " "
+	if reply != "" {
+		cmd += reply + " "
+	}
+	return c.write(cmd+strconv.Itoa(len(data))+"\r\n", data, []byte("\r\n"))
+}
+
+// Flush waits until the server has processed everything sent before it.
+func (c *Conn) Flush(ctx context.Context) error {
+	pong := make(chan error, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.pongs = append(c.pongs, pong)
+	c.mu.Unlock()
+	if err := c.write("PING\r\n"); err != nil {
+		return err
+	}
+	select {
+	case err := <-pong:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Subscribe receives the messages of subject, which may hold wildcards. In
+// a queue group, each message goes to one of the group's subscribers.
+func (c *Conn) Subscribe(subject, queue string) (*Subscription, error) {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.nextSID++
+	sub := &Subscription{conn: c, sid: c.nextSID, ch: make(chan *Msg, subscriptionBuffer), done: make(chan struct{})}
+	c.subs[sub.sid] = sub
+	c.mu.Unlock()
+	cmd := "SUB " + subject + " "
+	if queue != "" {
+		cmd += queue + " "
+	}
+	if err := c.write(cmd + strconv.FormatInt(sub.sid, 10) + "\r\n"); err != nil {
+		sub.Unsubscribe()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Request publishes data to subject and returns the first answer. Without
+// a subscriber the server answers at once with status 503, returned as an
+// error.
+func (c *Conn) Request(ctx context.Context, subject string, data []byte) (*Msg, error) {
+	inbox := NewInbox()
+	sub, err := c.Subscribe(inbox, "")
+	if err != nil {
+		return nil, err
+	}
+	defer sub.Unsubscribe()
+	if err := c.Publish(subject, inbox, data); err != nil {
+		return nil, err
+	}
+	msg, err := sub.Next(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Status == "503" {
+		return nil, fmt.Errorf("nats: no responders on %s", subject)
+	}
+	return msg, nil
+}
+
+// Err is the error that ended the connection, nil while it's open.
+func (c *Conn) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	c.fail(ErrClosed)
+	return c.nc.Close()
+}
+
+// NewInbox returns a unique subject for answers.
+func NewInbox() string {
+	var b [12]byte
+	_, _ = rand.Read(b[:])
+	return "_INBOX." + hex.EncodeToString(b[:])
+}
+
+func (c *Conn) write(parts ...any) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.Err(); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		var err error
+		switch p := p.(type) {
+		case string:
+			_, err = c.w.WriteString(p)
+		case []byte:
+			_, err = c.w.Write(p)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return c.w.Flush()
+}
+
+// fail ends the connection with err, waking up everything waiting on it.
+func (c *Conn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	for _, pong := range c.pongs {
+		pong <- err
+	}
+	c.pongs = nil
+	for _, sub := range c.subs {
+		close(sub.done)
+	}
+	c.subs = nil
+	close(c.done)
+}
+
+func (c *Conn) readLoop(r *bufio.Reader) {
+	for {
+		if err := c.readOne(r); err != nil {
+			c.fail(err)
+			c.nc.Close()
+			return
+		}
+	}
+}
+
+func (c *Conn) readOne(r *bufio.Reader) error {
+	line, err := readLine(r)
+	if err != nil {
+		return err
+	}
+	op, args, _ := strings.Cut(line, " ")
+	switch strings.ToUpper(op) {
+	case "MSG", "HMSG":
+		return c.readMsg(r, strings.ToUpper(op) == "HMSG", strings.Fields(args))
+	case "PING":
+		return c.write("PONG\r\n")
+	case "PONG":
+		c.mu.Lock()
+		if len(c.pongs) > 0 {
+			c.pongs[0] <- nil
+			c.pongs = c.pongs[1:]
+		}
+		c.mu.Unlock()
+	case "-ERR":
+		// Permission errors leave the connection open; the server closes
+		// it after the others.
+		if !strings.Contains(strings.ToLower(args), "permissions violation") {
+			return protocolError(line)
+		}
+	case "+OK", "INFO":
+	default:
+		return fmt.Errorf("nats: unexpected %q", line)
+	}
+	return nil
+}
+
+// readMsg reads the payload of MSG (subject sid [reply] size) or HMSG
+// (subject sid [reply] header-size total-size) and delivers it.
+func (c *Conn) readMsg(r *bufio.Reader, headers bool, args []string) error {
+	sizes := 1
+	if headers {
+		sizes = 2
+	}
+	if len(args) != 2+sizes && len(args) != 3+sizes {
+		return fmt.Errorf("nats: malformed message arguments %q", args)
+	}
+	msg := &Msg{Subject: args[0]}
+	if len(args) == 3+sizes {
+		msg.Reply = args[2]
+	}
+	sid, err1 := strconv.ParseInt(args[1], 10, 64)
+	total, err2 := strconv.Atoi(args[len(args)-1])
+	headerSize := 0
+	var err3 error
+	if headers {
+		headerSize, err3 = strconv.Atoi(args[len(args)-2])
+	}
+	if err := errors.Join(err1, err2, err3); err != nil || headerSize > total || total < 0 {
+		return fmt.Errorf("nats: malformed message arguments %q", args)
+	}
+	payload := make([]byte, total+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+	msg.Data = payload[headerSize:total]
+	if headers {
+		msg.Status, msg.Header = parseHeaders(string(payload[:headerSize]))
+	}
+
+	c.mu.Lock()
+	sub := c.subs[sid]
+	c.mu.Unlock()
+	if sub != nil {
+		select {
+		case sub.ch <- msg:
+		default:
+			sub.mu.Lock()
+			sub.dropped++
+			sub.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// parseHeaders parses a header block, "NATS/1.0 [status [description]]"
+// and "Key: value" lines.
+func parseHeaders(block string) (string, map[string][]string) {
+	lines := strings.Split(strings.TrimRight(block, "\r\n"), "\r\n")
+	status := ""
+	if fields := strings.Fields(strings.TrimPrefix(lines[0], "NATS/1.0")); len(fields) > 0 {
+		status = fields[0]
+	}
+	header := make(map[string][]string)
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			header[key] = append(header[key], strings.TrimSpace(value))
+		}
+	}
+	return status, header
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func protocolError(line string) error {
+	return fmt.Errorf("nats: %s", strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+}
+
+// Subscription receives the messages of a subject.
+type Subscription struct {
+	conn *Conn
+	sid  int64
+	ch   chan *Msg
+	done chan struct{}
+
+	mu      sync.Mutex
+	dropped int64
+}
+
+// Next returns the next message, waiting for one until ctx ends. It fails
+// once the subscription or its connection is closed and no message is
+// left.
+func (s *Subscription) Next(ctx context.Context) (*Msg, error) {
+	select {
+	case msg := <-s.ch:
+		return msg, nil
+	default:
+	}
+	select {
+	case msg := <-s.ch:
+		return msg, nil
+	case <-s.done:
+		if err := s.conn.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Dropped counts the messages dropped because Next didn't keep up.
+func (s *Subscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Unsubscribe stops the subscription.
+func (s *Subscription) Unsubscribe() error {
+	c := s.conn
+	c.mu.Lock()
+	if _, ok := c.subs[s.sid]; ok {
+		delete(c.subs, s.sid)
+		close(s.done)
+	}
+	c.mu.Unlock()
+	return c.write("UNSUB " + strconv.FormatInt(s.sid, 10) + "\r\n")
+}
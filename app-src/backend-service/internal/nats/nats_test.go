@@ -0,0 +1,304 @@
+package nats
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer routes PUB and HPUB to the SUBs of exact subjects, answers
+// requests without subscribers with a 503 HMSG, and refuses clients without
+// token.
+func fakeServer(t *testing.T, token string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	type sub struct {
+		w   io.Writer
+		mu  *sync.Mutex
+		sid string
+	}
+	var mu sync.Mutex
+	subs := make(map[string][]sub)
+	serve := func(nc net.Conn) {
+		defer nc.Close()
+		var wmu sync.Mutex
+		send := func(s string) {
+			wmu.Lock()
+			defer wmu.Unlock()
+			io.WriteString(nc, s)
+		}
+		send(`INFO {"server_id":"fake","version":"2.10.0","max_payload":1024,"auth_required":true}` + "\r\n")
+		r := bufio.NewReader(nc)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			op, args, _ := strings.Cut(strings.TrimSpace(line), " ")
+			switch op {
+			case "CONNECT":
+				var opts struct {
+					AuthToken string `json:"auth_token"`
+				}
+				json.Unmarshal([]byte(args), &opts)
+				if opts.AuthToken != token {
+					send("-ERR 'Authorization Violation'\r\n")
+					return
+				}
+			case "PING":
+				send("PONG\r\n")
+			case "SUB":
+				f := strings.Fields(args)
+				mu.Lock()
+				subs[f[0]] = append(subs[f[0]], sub{nc, &wmu, f[len(f)-1]})
+				mu.Unlock()
+			case "UNSUB":
+			case "PUB":
+				f := strings.Fields(args)
+				size, _ := strconv.Atoi(f[len(f)-1])
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				reply := ""
+				if len(f) == 3 {
+					reply = f[1] + " "
+				}
+				mu.Lock()
+				targets := subs[f[0]]
+				if len(targets) == 0 && reply != "" {
+					targets = subs[f[1]]
+					mu.Unlock()
+					for _, s := range targets {
+						hdr := "NATS/1.0 503\r\n\r\n"
+						s.mu.Lock()
+						fmt.Fprintf(s.w, "HMSG %s %s %d %d\r\n%s\r\n", f[1], s.sid, len(hdr), len(hdr), hdr)
+						s.mu.Unlock()
+					}
+					continue
+				}
+				mu.Unlock()
+				for _, s := range targets {
+					s.mu.Lock()
+					fmt.Fprintf(s.w, "MSG %s %s %s%d\r\n%s", f[0], s.sid, reply, size, data)
+					s.mu.Unlock()
+				}
+			case "HPUB":
+				f := strings.Fields(args)
+				size, _ := strconv.Atoi(f[len(f)-1])
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+				mu.Lock()
+				targets := subs[f[0]]
+				mu.Unlock()
+				for _, s := range targets {
+					s.mu.Lock()
+					fmt.Fprintf(s.w, "HMSG %s %s %s\r\n%s", f[0], s.sid, strings.Join(f[1:], " "), data)
+					s.mu.Unlock()
+				}
+			}
+		}
+	}
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(nc)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	addr := fakeServer(t, "s3cret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c, err := Dial(ctx, Config{URL: "nats://s3cret@" + addr, Name: "test", DialTimeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	sub, err := c.Subscribe("events.item", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Publish("events.item", "", []byte("line one\r\nline two")); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Flush(ctx); err != nil {
+		t.Fatalf("Flush() = %v", err)
+	}
+	msg, err := sub.Next(ctx)
+	if err != nil || msg.Subject != "events.item" || string(msg.Data) != "line one\r\nline two" {
+		t.Errorf("Next() = %+v, %v", msg, err)
+	}
+
+	// A responder answers on the request's inbox.
+	go func() {
+		msg, err := sub.Next(ctx)
+		if err == nil {
+			c.Publish(msg.Reply, "", append([]byte("re: "), msg.Data...))
+		}
+	}()
+	if reply, err := c.Request(ctx, "events.item", []byte("ping")); err != nil || string(reply.Data) != "re: ping" {
+		t.Errorf("Request() = %+v, %v", reply, err)
+	}
+	if _, err := c.Request(ctx, "nobody.listens", nil); err == nil || !strings.Contains(err.Error(), "no responders") {
+		t.Errorf("Request() without responders = %v", err)
+	}
+	if err := c.Publish("events.item", "", make([]byte, 2048)); err == nil {
+		t.Error("Publish() accepted a payload over max_payload")
+	}
+
+	c.Close()
+	if _, err := sub.Next(ctx); err != ErrClosed {
+		t.Errorf("Next() on a closed connection = %v, want ErrClosed", err)
+	}
+	if err := c.Publish("events.item", "", nil); err != ErrClosed {
+		t.Errorf("Publish() on a closed connection = %v, want ErrClosed", err)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	addr := fakeServer(t, "s3cret")
+	_, err := Dial(context.Background(), Config{URL: "nats://wrong@" + addr, DialTimeout: time.Second})
+	if err == nil || !strings.Contains(err.Error(), "Authorization Violation") {
+		t.Errorf("Dial() with a wrong token = %v", err)
+	}
+	if _, err := Dial(context.Background(), Config{URL: "http://" + addr}); err == nil {
+		t.Error("Dial() accepted an http URL")
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	status, header := parseHeaders("NATS/1.0 404 No Messages\r\nNats-Pending-Messages: 3\r\n\r\n")
+	if status != "404" || header["Nats-Pending-Messages"][0] != "3" {
+		t.Errorf("parseHeaders() = %q, %v", status, header)
+	}
+}
+
+// fakeJetStream answers the JetStream API on conn for stream EVENTS and
+// consumer workers, recording the requests by subject. A pull delivers two
+// messages, then ends with a 404 status sent as HPUB over raw.
+func fakeJetStream(t *testing.T, ctx context.Context, conn *Conn, raw net.Conn) (requests func() map[string]string) {
+	t.Helper()
+	var mu sync.Mutex
+	got := make(map[string]string)
+	answers := map[string]string{
+		"STREAM.INFO.EVENTS":                     `{"error":{"code":404,"err_code":10059,"description":"stream not found"}}`,
+		"STREAM.CREATE.EVENTS":                   `{"config":{"name":"EVENTS"}}`,
+		"CONSUMER.DURABLE.CREATE.EVENTS.workers": `{"name":"workers"}`,
+		"CONSUMER.INFO.EVENTS.workers":           `{"stream_name":"EVENTS","name":"workers","num_pending":7,"num_ack_pending":1}`,
+		"CONSUMER.MSG.NEXT.EVENTS.workers":       "",
+	}
+	for subject, answer := range answers {
+		sub, err := conn.Subscribe("$JS.API."+subject, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func(subject, answer string) {
+			for {
+				msg, err := sub.Next(ctx)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				got[subject] = string(msg.Data)
+				mu.Unlock()
+				if answer != "" {
+					conn.Publish(msg.Reply, "", []byte(answer))
+					continue
+				}
+				conn.Publish(msg.Reply, "$JS.ACK.EVENTS.workers.1", []byte("first"))
+				conn.Publish(msg.Reply, "$JS.ACK.EVENTS.workers.2", []byte("second"))
+				conn.Flush(ctx)
+				hdr := "NATS/1.0 404 No Messages\r\n\r\n"
+				fmt.Fprintf(raw, "HPUB %s %d %d\r\n%s\r\n", msg.Reply, len(hdr), len(hdr), hdr)
+			}
+		}(subject, answer)
+	}
+	if err := conn.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return func() map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return maps.Clone(got)
+	}
+}
+
+func TestJetStream(t *testing.T) {
+	addr := fakeServer(t, "s3cret")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func() *Conn {
+		c, err := Dial(ctx, Config{URL: "nats://s3cret@" + addr})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	raw, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	io.WriteString(raw, `CONNECT {"auth_token":"s3cret","headers":true}`+"\r\n")
+	requests := fakeJetStream(t, ctx, dial(), raw)
+	c := dial()
+
+	if err := c.EnsureStream(ctx, StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}, MaxAge: time.Hour}); err != nil {
+		t.Fatalf("EnsureStream() = %v", err)
+	}
+	if got := requests()["STREAM.CREATE.EVENTS"]; got != `{"name":"EVENTS","subjects":["events.>"],"max_age":3600000000000}` {
+		t.Errorf("STREAM.CREATE request = %s", got)
+	}
+	if err := c.EnsureConsumer(ctx, "EVENTS", ConsumerConfig{Durable: "workers", AckPolicy: "explicit"}); err != nil {
+		t.Fatalf("EnsureConsumer() = %v", err)
+	}
+	info, err := c.ConsumerInfo(ctx, "EVENTS", "workers")
+	if err != nil || info.NumPending != 7 || info.NumAckPending != 1 {
+		t.Errorf("ConsumerInfo() = %+v, %v", info, err)
+	}
+
+	acks, err := c.Subscribe("$JS.ACK.EVENTS.workers.1", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := c.Fetch(ctx, "EVENTS", "workers", 10, time.Second)
+	if err != nil || len(msgs) != 2 || string(msgs[0].Data) != "first" {
+		t.Fatalf("Fetch() = %v, %v", msgs, err)
+	}
+	if got := requests()["CONSUMER.MSG.NEXT.EVENTS.workers"]; got != `{"batch":10,"expires":1000000000}` {
+		t.Errorf("pull request = %s", got)
+	}
+	if err := c.Ack(msgs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if ack, err := acks.Next(ctx); err != nil || string(ack.Data) != "+ACK" {
+		t.Errorf("ack = %+v, %v", ack, err)
+	}
+
+	if err := c.EnsureStream(ctx, StreamConfig{Name: "MISSING"}); err == nil || !strings.Contains(err.Error(), "no responders") {
+		t.Errorf("EnsureStream() without JetStream = %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package negotiate
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Message types of protobuf responses.
+const (
+	messageStruct = "google.protobuf.Struct"
+	messageValue  = "google.protobuf.Value"
+)
+
+// newDecoder returns a decoder of body keeping numbers as written.
+func newDecoder(body []byte) *json.Decoder {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	return dec
+}
+
+// end checks that nothing but whitespace follows the document.
+func end(dec *json.Decoder) error {
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("data after the JSON document")
+	}
+	return nil
+}
+
+// toYAML converts a JSON document to YAML, keeping the order of object
+// fields.
+func toYAML(body []byte) ([]byte, error) {
+	dec := newDecoder(body)
+	node, err := yamlNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if err := end(dec); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlNode reads the next JSON value of dec as a YAML node.
+func yamlNode(dec *json.Decoder) (*yaml.Node, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		if v == '{' {
+			node.Kind, node.Tag = yaml.MappingNode, "!!map"
+		}
+		for dec.More() {
+			if node.Kind == yaml.MappingNode {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)})
+			}
+			child, err := yamlNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, child)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(string(v), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: string(v)}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(v)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// Protobuf wire types.
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+)
+
+// toProtobuf converts a JSON document to a google.protobuf.Struct message,
+// or a google.protobuf.Value when it isn't an object, and returns the
+// message type. Numbers become doubles, as Struct has no integers.
+func toProtobuf(body []byte) ([]byte, string, error) {
+	dec := newDecoder(body)
+	value, err := protoValue(dec)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := end(dec); err != nil {
+		return nil, "", err
+	}
+	// A Value holding a Struct is field 5 of the Value; the Struct alone
+	// is its payload.
+	if fieldNum, payload, ok := lenField(value); ok && fieldNum == 5 {
+		return payload, messageStruct, nil
+	}
+	return value, messageValue, nil
+}
+
+// protoValue reads the next JSON value of dec as an encoded
+// google.protobuf.Value.
+func protoValue(dec *json.Decoder) ([]byte, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch v := tok.(type) {
+	case json.Delim:
+		var msg []byte
+		for dec.More() {
+			if v == '[' {
+				// ListValue: repeated Value values = 1
+				item, err := protoValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				msg = appendLen(msg, 1, item)
+				continue
+			}
+			// Struct: map<string, Value> fields = 1, each entry a message
+			// of key = 1 and value = 2
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			item, err := protoValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			entry := appendLen(nil, 1, []byte(key.(string)))
+			entry = appendLen(entry, 2, item)
+			msg = appendLen(msg, 1, entry)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		if v == '[' {
+			return appendLen(nil, 6, msg), nil
+		}
+		return appendLen(nil, 5, msg), nil
+	case string:
+		return appendLen(nil, 3, []byte(v)), nil
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		b := binary.AppendUvarint(nil, 2<<3|wireI64)
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(f)), nil
+	case bool:
+		n := uint64(0)
+		if v {
+			n = 1
+		}
+		return binary.AppendUvarint(binary.AppendUvarint(nil, 4<<3|wireVarint), n), nil
+	default:
+		// NullValue NULL_VALUE = 0
+		return binary.AppendUvarint(binary.AppendUvarint(nil, 1<<3|wireVarint), 0), nil
+	}
+}
+
+// appendLen appends a length-delimited field.
+func appendLen(b []byte, fieldNum uint64, payload []byte) []byte {
+	b = binary.AppendUvarint(b, fieldNum<<3|wireLen)
+	b = binary.AppendUvarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// lenField returns the number and payload of msg when it is a single
+// length-delimited field.
+func lenField(msg []byte) (uint64, []byte, bool) {
+	tag, n := binary.Uvarint(msg)
+	if n <= 0 || tag&7 != wireLen {
+		return 0, nil, false
+	}
+	size, m := binary.Uvarint(msg[n:])
+	if m <= 0 || uint64(len(msg)-n-m) != size {
+		return 0, nil, false
+	}
+	return tag >> 3, msg[n+m:], true
+}
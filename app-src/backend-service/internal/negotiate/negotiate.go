@@ -0,0 +1,195 @@
+// Package negotiate serves JSON responses as YAML or protobuf to clients
+// that prefer them.
+//
+// Clients ask with the Accept header, e.g. "Accept: application/yaml" or
+// "Accept: application/x-protobuf"; requests without either get JSON. Only
+// successful application/json responses are converted: problems stay
+// application/problem+json, and other content types and streams go through
+// as they are. Protobuf responses are google.protobuf.Struct messages (a
+// google.protobuf.Value for bodies that aren't objects), named in the
+// messageType parameter of their Content-Type, so any protobuf tooling can
+// decode them without a schema of their own.
+package negotiate
+
+import (
+	"bytes"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Media types of the formats served.
+const (
+	JSON     = "application/json"
+	YAML     = "application/yaml"
+	Protobuf = "application/x-protobuf"
+)
+
+// mediaTypes maps the media types clients ask with to the format they get.
+var mediaTypes = map[string]string{
+	"application/json":                JSON,
+	"application/yaml":                YAML,
+	"application/x-yaml":              YAML,
+	"text/yaml":                       YAML,
+	"application/x-protobuf":          Protobuf,
+	"application/protobuf":            Protobuf,
+	"application/vnd.google.protobuf": Protobuf,
+}
+
+// Format returns the format r accepts most: the one of the media range with
+// the highest quality, the first listed of those that tie. Wildcards and
+// other +json types stand for JSON, as do requests accepting none of the
+// formats.
+func Format(r *http.Request) string {
+	format, best := JSON, 0.0
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil {
+				continue
+			}
+			f, ok := mediaTypes[mediaType]
+			if !ok && (mediaType == "*/*" || mediaType == "application/*" || strings.HasSuffix(mediaType, "+json")) {
+				f, ok = JSON, true
+			}
+			if !ok {
+				continue
+			}
+			q := 1.0
+			if parsed, err := strconv.ParseFloat(params["q"], 64); err == nil {
+				q = parsed
+			}
+			if q > best {
+				format, best = f, q
+			}
+		}
+	}
+	return format
+}
+
+// Middleware converts the JSON responses of requests that prefer YAML or
+// protobuf.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		format := Format(r)
+		if format == JSON {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &convertingWriter{ResponseWriter: w, format: format}
+		next.ServeHTTP(cw, r)
+		// Not deferred: after a panic, the recover middleware writes the
+		// error response in place of the buffered body.
+		cw.close()
+	})
+}
+
+// Encode converts a JSON document to format, returning the converted body
+// and its content type.
+func Encode(body []byte, format string) ([]byte, string, error) {
+	switch format {
+	case YAML:
+		out, err := toYAML(body)
+		return out, YAML, err
+	case Protobuf:
+		out, messageType, err := toProtobuf(body)
+		return out, Protobuf + "; messageType=" + messageType, err
+	}
+	return body, JSON, nil
+}
+
+// convertingWriter holds back successful JSON responses to convert them
+// once the handler returns; other responses go through as they're written.
+// A flush sends what has been held back unconverted and passes the rest
+// through.
+type convertingWriter struct {
+	http.ResponseWriter
+	format  string
+	code    int
+	convert bool
+	buf     bytes.Buffer
+}
+
+func (cw *convertingWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.code != 0 {
+		return
+	}
+	cw.code = code
+	mediaType, _, _ := mime.ParseMediaType(cw.Header().Get("Content-Type"))
+	cw.convert = code < http.StatusMultipleChoices && code != http.StatusNoContent && mediaType == JSON
+	if !cw.convert {
+		cw.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (cw *convertingWriter) Write(b []byte) (int, error) {
+	if cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.convert {
+		return cw.buf.Write(b)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// release sends the held back response as JSON and passes the rest
+// through.
+func (cw *convertingWriter) release() error {
+	cw.convert = false
+	cw.ResponseWriter.WriteHeader(cw.code)
+	_, err := cw.ResponseWriter.Write(cw.buf.Bytes())
+	cw.buf.Reset()
+	return err
+}
+
+// FlushError sends what has been written so far; streams aren't converted.
+func (cw *convertingWriter) FlushError() error {
+	if cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.convert {
+		if err := cw.release(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *convertingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// close converts and sends the held back response. Bodies that aren't
+// valid JSON are sent as they are.
+func (cw *convertingWriter) close() {
+	if !cw.convert {
+		return
+	}
+	h := cw.Header()
+	if cw.buf.Len() == 0 {
+		// HEAD requests: the headers of the converted response.
+		_, contentType, _ := Encode([]byte("{}"), cw.format)
+		h.Set("Content-Type", contentType)
+		h.Del("Content-Length")
+		cw.ResponseWriter.WriteHeader(cw.code)
+		return
+	}
+	out, contentType, err := Encode(cw.buf.Bytes(), cw.format)
+	if err != nil {
+		log.Printf("Warning: response not converted to %s: %v", cw.format, err)
+		_ = cw.release()
+		return
+	}
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(out)))
+	cw.ResponseWriter.WriteHeader(cw.code)
+	_, _ = cw.ResponseWriter.Write(out)
+}
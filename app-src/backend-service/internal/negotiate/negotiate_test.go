@@ -0,0 +1,210 @@
+package negotiate
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", JSON},
+		{"*/*", JSON},
+		{"application/yaml", YAML},
+		{"text/yaml", YAML},
+		{"application/x-protobuf", Protobuf},
+		{"application/protobuf", Protobuf},
+		{"application/json, application/yaml", JSON},
+		{"application/yaml, */*", YAML},
+		{"application/yaml;q=0.5, application/json", JSON},
+		{"application/x-protobuf;q=0.9, application/yaml;q=0.8", Protobuf},
+		{"application/vnd.gitops-demo.v2+json", JSON},
+		{"application/xml", JSON},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		if got := Format(r); got != tt.want {
+			t.Errorf("Format(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeYAML(t *testing.T) {
+	body := `{"version":"1.0.0","replicas":3,"ratio":0.5,"ready":true,"commit":"true","labels":{"b":"2","a":"1"},"zones":["a","b"],"node":null}`
+	out, contentType, err := Encode([]byte(body), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `version: 1.0.0
+replicas: 3
+ratio: 0.5
+ready: true
+commit: "true"
+labels:
+  b: "2"
+  a: "1"
+zones:
+  - a
+  - b
+node: null
+`
+	if contentType != YAML || string(out) != want {
+		t.Errorf("Encode() = %s\n%s, want\n%s", contentType, out, want)
+	}
+	if _, _, err := Encode([]byte(`{"a":`), YAML); err == nil {
+		t.Error("invalid JSON encoded")
+	}
+}
+
+// decodeValue decodes a google.protobuf.Value the way JSON decodes into
+// any.
+func decodeValue(t *testing.T, msg []byte) any {
+	t.Helper()
+	var v any
+	readFields(t, msg, func(num uint64, payload []byte, scalar uint64) {
+		switch num {
+		case 1:
+			v = nil
+		case 2:
+			v = math.Float64frombits(scalar)
+		case 3:
+			v = string(payload)
+		case 4:
+			v = scalar == 1
+		case 5:
+			v = decodeStruct(t, payload)
+		case 6:
+			list := []any{}
+			readFields(t, payload, func(_ uint64, item []byte, _ uint64) {
+				list = append(list, decodeValue(t, item))
+			})
+			v = list
+		}
+	})
+	return v
+}
+
+func decodeStruct(t *testing.T, msg []byte) map[string]any {
+	t.Helper()
+	fields := map[string]any{}
+	readFields(t, msg, func(_ uint64, entry []byte, _ uint64) {
+		var key string
+		var value any
+		readFields(t, entry, func(num uint64, payload []byte, _ uint64) {
+			if num == 1 {
+				key = string(payload)
+			} else {
+				value = decodeValue(t, payload)
+			}
+		})
+		fields[key] = value
+	})
+	return fields
+}
+
+// readFields calls fn with each field of msg: its payload when length
+// delimited, its value otherwise.
+func readFields(t *testing.T, msg []byte, fn func(num uint64, payload []byte, scalar uint64)) {
+	t.Helper()
+	for len(msg) > 0 {
+		tag, n := binary.Uvarint(msg)
+		msg = msg[n:]
+		switch tag & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(msg)
+			msg = msg[n:]
+			fn(tag>>3, nil, v)
+		case wireI64:
+			fn(tag>>3, nil, binary.LittleEndian.Uint64(msg))
+			msg = msg[8:]
+		case wireLen:
+			size, n := binary.Uvarint(msg)
+			fn(tag>>3, msg[n:n+int(size)], 0)
+			msg = msg[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", tag&7)
+		}
+	}
+}
+
+func TestEncodeProtobuf(t *testing.T) {
+	body := `{"version":"1.0.0","replicas":3,"ready":false,"labels":{"app":"backend"},"zones":["a",1.5,null,true],"empty":{}}`
+	out, contentType, err := Encode([]byte(body), Protobuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "application/x-protobuf; messageType=google.protobuf.Struct" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+	var want any
+	if err := json.Unmarshal([]byte(body), &want); err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeStruct(t, out); !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+
+	out, contentType, err = Encode([]byte(`["a","b"]`), Protobuf)
+	if err != nil || contentType != "application/x-protobuf; messageType=google.protobuf.Value" {
+		t.Fatalf("Encode(list) = %q, %v", contentType, err)
+	}
+	if got := decodeValue(t, out); !reflect.DeepEqual(got, []any{"a", "b"}) {
+		t.Errorf("decoded %v", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/problem":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"status":404}`))
+		case "/stream":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"a":`))
+			http.NewResponseController(w).Flush()
+			w.Write([]byte(`1}`))
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Content-Length", "9")
+			w.Write([]byte(`{"a":"b"}`))
+		}
+	}))
+	serve := func(method, path, accept string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		r.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/", "application/yaml")
+	if rec.Header().Get("Content-Type") != YAML || rec.Body.String() != "a: b\n" || rec.Header().Get("Content-Length") != "5" {
+		t.Errorf("YAML response = %v %q", rec.Header(), rec.Body)
+	}
+	if rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+	}
+	if rec := serve(http.MethodGet, "/", ""); rec.Header().Get("Content-Type") != JSON || rec.Body.String() != `{"a":"b"}` {
+		t.Errorf("JSON response = %v %q", rec.Header(), rec.Body)
+	}
+	if rec := serve(http.MethodGet, "/problem", "application/yaml"); rec.Code != http.StatusNotFound || rec.Body.String() != `{"status":404}` {
+		t.Errorf("problem = %d %q, want it unconverted", rec.Code, rec.Body)
+	}
+	if rec := serve(http.MethodGet, "/stream", "application/yaml"); rec.Header().Get("Content-Type") != JSON || rec.Body.String() != `{"a":1}` {
+		t.Errorf("flushed response = %v %q, want it unconverted", rec.Header(), rec.Body)
+	}
+	rec = serve(http.MethodHead, "/", "application/x-protobuf")
+	if rec.Header().Get("Content-Type") != "application/x-protobuf; messageType=google.protobuf.Struct" {
+		t.Errorf("HEAD response = %v", rec.Header())
+	}
+}
@@ -0,0 +1,23 @@
+// Package netctx ties the I/O of a net.Conn to a context, for the
+// hand-written protocol clients, whose reads and writes block on the
+// connection rather than take a context.
+package netctx
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// Watch interrupts the I/O of nc when ctx is done, and bounds it by the
+// deadline of ctx if it has one. The returned function stops watching and
+// reports whether ctx was still live; when it wasn't, an I/O error is
+// ctx's doing, and ctx.Err() is the better one to report.
+func Watch(ctx context.Context, nc net.Conn) (stop func() bool) {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.SetDeadline(deadline)
+	} else {
+		_ = nc.SetDeadline(time.Time{})
+	}
+	return context.AfterFunc(ctx, func() { _ = nc.SetDeadline(time.Unix(1, 0)) })
+}
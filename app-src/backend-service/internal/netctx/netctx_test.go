@@ -0,0 +1,40 @@
+package netctx
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Canceling ctx interrupts a blocked read.
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := Watch(ctx, client)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("Read() after cancel = %v, want a deadline error", err)
+	}
+	if stop() {
+		t.Error("stop() = true after ctx was canceled")
+	}
+
+	// A live ctx without a deadline clears the one left behind.
+	stop = Watch(context.Background(), client)
+	go server.Write([]byte{1})
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Errorf("Read() = %v", err)
+	}
+	if !stop() {
+		t.Error("stop() = false for a live ctx")
+	}
+}
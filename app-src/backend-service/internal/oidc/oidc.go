@@ -0,0 +1,339 @@
+// Package oidc is the relying party side of the OpenID Connect
+// authorization code flow: provider discovery, the authorization URL with
+// PKCE, the code exchange, refreshes and ID token verification. It's enough
+// to log browsers in with Dex, Keycloak or any provider publishing
+// /.well-known/openid-configuration.
+//
+// ID tokens are verified with the package jwt: RS, PS and ES algorithms
+// with a key of the provider's JWKS, HS algorithms with the client secret.
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/jwt"
+)
+
+const (
+	// discoveryMaxAge is how long the provider metadata is used before it's
+	// fetched again.
+	discoveryMaxAge = time.Hour
+	// maxResponseBytes bounds the metadata and token responses read.
+	maxResponseBytes = 1 << 20
+)
+
+// ErrNonce is returned by VerifyIDToken when the ID token's nonce isn't the
+// one the authorization request sent.
+var ErrNonce = errors.New("nonce mismatch")
+
+// Config configures a Provider.
+type Config struct {
+	// IssuerURL is the issuer of the provider, where
+	// /.well-known/openid-configuration is served.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback the provider sends the browser back to.
+	RedirectURL string
+	// Scopes requested; "openid" is added when missing.
+	Scopes []string
+	// Leeway tolerates clock skew in the "exp" and "nbf" checks.
+	Leeway time.Duration
+	// HTTPClient calls the provider; nil uses http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// Metadata is the part of the provider's discovery document a relying
+// party needs.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint,omitempty"`
+}
+
+// Token is the answer of the token endpoint. Claims are those of the
+// verified ID token; refreshes may not return one, and keep them nil.
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	Expiry       time.Time
+	Claims       jwt.Claims
+}
+
+// Provider talks to one OpenID provider. The metadata is discovered on
+// first use and cached; it's safe for concurrent use.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu         sync.Mutex
+	meta       *Metadata
+	verifier   *jwt.Verifier
+	discovered time.Time
+}
+
+// New returns the Provider of cfg. Nothing is fetched until it's used.
+func New(cfg Config) *Provider {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	hasOpenID := false
+	for _, s := range cfg.Scopes {
+		hasOpenID = hasOpenID || s == "openid"
+	}
+	if !hasOpenID {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+	cfg.IssuerURL = strings.TrimSuffix(cfg.IssuerURL, "/")
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Metadata returns the discovery document, fetching it when it's missing
+// or older than an hour. A failed refetch keeps the previous one for
+// another minute.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	meta, _, err := p.discover(ctx)
+	return meta, err
+}
+
+func (p *Provider) discover(ctx context.Context) (*Metadata, *jwt.Verifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.discovered) < discoveryMaxAge {
+		return p.meta, p.verifier, nil
+	}
+	var meta Metadata
+	err := p.getJSON(ctx, p.cfg.IssuerURL+"/.well-known/openid-configuration", &meta)
+	switch {
+	case err == nil && meta.Issuer != p.cfg.IssuerURL:
+		// The issuer must match exactly, or tokens of another issuer could
+		// be accepted (OpenID Connect Discovery, section 4.3).
+		err = fmt.Errorf("issuer %q doesn't match %q", meta.Issuer, p.cfg.IssuerURL)
+	case err == nil && (meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == ""):
+		err = errors.New("authorization or token endpoint missing")
+	}
+	if err != nil {
+		if p.meta != nil {
+			// Try again in a minute rather than on every request.
+			p.discovered = time.Now().Add(time.Minute - discoveryMaxAge)
+			return p.meta, p.verifier, nil
+		}
+		return nil, nil, fmt.Errorf("discovering OpenID provider %s: %w", p.cfg.IssuerURL, err)
+	}
+	if p.meta == nil || p.meta.JWKSURI != meta.JWKSURI {
+		var keys *jwt.KeySet
+		if meta.JWKSURI != "" {
+			keys = jwt.NewKeySet(meta.JWKSURI, p.client)
+		}
+		secret := [][]byte{[]byte(p.cfg.ClientSecret)}
+		p.verifier = jwt.New(jwt.Config{
+			Secrets:  func() [][]byte { return secret },
+			Keys:     keys,
+			Issuer:   meta.Issuer,
+			Audience: p.cfg.ClientID,
+			Leeway:   p.cfg.Leeway,
+		})
+	}
+	p.meta, p.discovered = &meta, time.Now()
+	return p.meta, p.verifier, nil
+}
+
+// AuthCodeURL returns the authorization endpoint URL a browser is sent to.
+// state and nonce tie the callback and the ID token to this request;
+// verifier is the PKCE code verifier, sent as its S256 challenge.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {Challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	return withQuery(meta.AuthorizationEndpoint, q), nil
+}
+
+// EndSessionURL returns the provider's logout URL, which sends the browser
+// back to postLogoutURL, or "" when the provider has none.
+func (p *Provider) EndSessionURL(ctx context.Context, idToken, postLogoutURL string) string {
+	meta, err := p.Metadata(ctx)
+	if err != nil || meta.EndSessionEndpoint == "" {
+		return ""
+	}
+	q := url.Values{"client_id": {p.cfg.ClientID}, "post_logout_redirect_uri": {postLogoutURL}}
+	if idToken != "" {
+		q.Set("id_token_hint", idToken)
+	}
+	return withQuery(meta.EndSessionEndpoint, q)
+}
+
+// Exchange trades the code of the callback for tokens, and verifies the ID
+// token and its nonce.
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Token, error) {
+	tok, err := p.token(ctx, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("token response has no ID token")
+	}
+	if tok.Claims, err = p.VerifyIDToken(ctx, tok.IDToken, nonce); err != nil {
+		return nil, err
+	}
+	return tok, nil
+}
+
+// Refresh gets new tokens with a refresh token. Providers that rotate
+// refresh tokens return a new one; otherwise the old one is kept.
+func (p *Provider) Refresh(ctx context.Context, refreshToken string) (*Token, error) {
+	tok, err := p.token(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		tok.RefreshToken = refreshToken
+	}
+	if tok.IDToken != "" {
+		if tok.Claims, err = p.VerifyIDToken(ctx, tok.IDToken, ""); err != nil {
+			return nil, err
+		}
+	}
+	return tok, nil
+}
+
+// VerifyIDToken checks the signature, issuer, audience and time of an ID
+// token, and its nonce unless nonce is empty.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (jwt.Claims, error) {
+	_, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("ID token: %w", err)
+	}
+	if nonce != "" && claims.String("nonce") != nonce {
+		return nil, fmt.Errorf("ID token: %w", ErrNonce)
+	}
+	return claims, nil
+}
+
+// token posts a grant to the token endpoint, authenticating with the
+// client secret (client_secret_basic).
+func (p *Provider) token(ctx context.Context, form url.Values) (*Token, error) {
+	meta, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		RefreshToken     string `json:"refresh_token"`
+		IDToken          string `json:"id_token"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&body); err != nil {
+		return nil, fmt.Errorf("token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		if body.Error == "" {
+			body.Error = fmt.Sprintf("status %d", resp.StatusCode)
+		}
+		if body.ErrorDescription != "" {
+			body.Error += ": " + body.ErrorDescription
+		}
+		return nil, fmt.Errorf("token request refused: %s", body.Error)
+	}
+	tok := &Token{AccessToken: body.AccessToken, RefreshToken: body.RefreshToken, IDToken: body.IDToken}
+	if body.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return tok, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(out)
+}
+
+// withQuery adds q to the query of endpoint, keeping the parameters it
+// already has.
+func withQuery(endpoint string, q url.Values) string {
+	sep := "?"
+	if strings.Contains(endpoint, "?") {
+		sep = "&"
+	}
+	return endpoint + sep + q.Encode()
+}
+
+// RandomString returns a URL-safe random string of n bytes of entropy, for
+// states, nonces and PKCE verifiers.
+func RandomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("oidc: reading random bytes: %v", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge returns the S256 PKCE challenge of verifier (RFC 7636).
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,154 @@
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProvider is an OpenID provider issuing HS256 ID tokens signed with
+// the client secret, for one authorization code.
+type fakeProvider struct {
+	*httptest.Server
+	code      string
+	challenge string
+	nonce     string
+	refreshed int
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	fp := &fakeProvider{code: "the-code"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{
+			Issuer:                fp.URL,
+			AuthorizationEndpoint: fp.URL + "/auth?connector=local",
+			TokenEndpoint:         fp.URL + "/token",
+			EndSessionEndpoint:    fp.URL + "/logout",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if id, secret, _ := r.BasicAuth(); id != "backend" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+			return
+		}
+		switch r.PostFormValue("grant_type") {
+		case "authorization_code":
+			if r.PostFormValue("code") != fp.code || Challenge(r.PostFormValue("code_verifier")) != fp.challenge {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "bad code"})
+				return
+			}
+		case "refresh_token":
+			if r.PostFormValue("refresh_token") != "refresh-1" {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+				return
+			}
+			fp.refreshed++
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access",
+			"refresh_token": "refresh-1",
+			"expires_in":    300,
+			"id_token": fp.idToken(map[string]any{
+				"iss": fp.URL, "aud": "backend", "sub": "alice", "nonce": fp.nonce,
+				"exp": time.Now().Add(5 * time.Minute).Unix(),
+			}),
+		})
+	})
+	fp.Server = httptest.NewServer(mux)
+	t.Cleanup(fp.Close)
+	return fp
+}
+
+func (fp *fakeProvider) idToken(claims map[string]any) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	payload, _ := json.Marshal(claims)
+	input := enc([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc(payload)
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(input))
+	return input + "." + enc(mac.Sum(nil))
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	fp := newFakeProvider(t)
+	p := New(Config{
+		IssuerURL:    fp.URL + "/",
+		ClientID:     "backend",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://app.example/auth/callback",
+		Scopes:       []string{"profile", "email"},
+	})
+
+	verifier, nonce := RandomString(32), RandomString(16)
+	authURL, err := p.AuthCodeURL(ctx, "state-1", nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if u.Path != "/auth" || q.Get("connector") != "local" || q.Get("scope") != "openid profile email" ||
+		q.Get("state") != "state-1" || q.Get("code_challenge_method") != "S256" || q.Get("redirect_uri") != "https://app.example/auth/callback" {
+		t.Errorf("AuthCodeURL() = %s", authURL)
+	}
+
+	// The provider remembers the challenge and nonce of the request.
+	fp.challenge, fp.nonce = q.Get("code_challenge"), q.Get("nonce")
+	if _, err := p.Exchange(ctx, "the-code", "wrong-verifier", nonce); err == nil || !strings.Contains(err.Error(), "bad code") {
+		t.Errorf("Exchange() with a wrong verifier = %v, want invalid_grant", err)
+	}
+	if _, err := p.Exchange(ctx, "the-code", verifier, "other-nonce"); !errors.Is(err, ErrNonce) {
+		t.Errorf("Exchange() with another nonce = %v, want ErrNonce", err)
+	}
+	tok, err := p.Exchange(ctx, "the-code", verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Claims.Subject() != "alice" || tok.RefreshToken != "refresh-1" || time.Until(tok.Expiry) < 4*time.Minute {
+		t.Errorf("Exchange() = %+v", tok)
+	}
+
+	tok, err = p.Refresh(ctx, "refresh-1")
+	if err != nil || fp.refreshed != 1 || tok.Claims.Subject() != "alice" {
+		t.Errorf("Refresh() = %+v, %v", tok, err)
+	}
+	if _, err := p.Refresh(ctx, "revoked"); err == nil {
+		t.Error("Refresh() with an unknown token succeeded")
+	}
+
+	logout := p.EndSessionURL(ctx, tok.IDToken, "https://app.example/")
+	if !strings.HasPrefix(logout, fp.URL+"/logout?") || !strings.Contains(logout, "post_logout_redirect_uri=https%3A%2F%2Fapp.example%2F") {
+		t.Errorf("EndSessionURL() = %s", logout)
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	fp := newFakeProvider(t)
+	p := New(Config{IssuerURL: fp.URL + "/other", ClientID: "backend"})
+	if _, err := p.Metadata(context.Background()); err == nil {
+		t.Error("Metadata() of another issuer succeeded")
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B.
+	if got := Challenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); got != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("Challenge() = %s", got)
+	}
+}
@@ -0,0 +1,115 @@
+// Package openapi defines the parts of an OpenAPI 3.1 document the service
+// describes its API with. Schemas are JSON Schema 2020-12, the dialect
+// OpenAPI 3.1 uses, so package schema generates them.
+package openapi
+
+import (
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/schema"
+)
+
+// Version is the OpenAPI version of the documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document.
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+	Tags       []Tag               `json:"tags,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to their operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Required    bool           `json:"required,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Schema      *schema.Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body, usually a Ref to a component.
+type MediaType struct {
+	Schema any `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*schema.Schema `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	// In and Name locate the key of "apiKey" schemes.
+	In          string `json:"in,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Ref refers to a component schema.
+type Ref struct {
+	Ref string `json:"$ref"`
+}
+
+// SchemaRef returns a reference to the component schema name.
+func SchemaRef(name string) Ref {
+	return Ref{Ref: "#/components/schemas/" + name}
+}
+
+// OneOf is a schema matching exactly one of its alternatives.
+type OneOf struct {
+	OneOf []Ref `json:"oneOf"`
+}
+
+// PathParams returns the names of the "{name}" and "{name...}" segments of
+// a router pattern, which OpenAPI writes as "{name}".
+func PathParams(pattern string) (path string, params []string) {
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+		name := strings.TrimSuffix(strings.Trim(seg, "{}"), "...")
+		segments[i] = "{" + name + "}"
+		params = append(params, name)
+	}
+	return strings.Join(segments, "/"), params
+}
@@ -0,0 +1,407 @@
+package postgres
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/netctx"
+)
+
+const (
+	protocolVersion = 3 << 16
+	sslRequestCode  = 80877103
+)
+
+// Authentication requests of the server.
+const (
+	authOK           = 0
+	authCleartext    = 3
+	authMD5          = 5
+	authSASL         = 10
+	authSASLContinue = 11
+	authSASLFinal    = 12
+)
+
+// conn is one authenticated connection, ready for queries.
+type conn struct {
+	nc  net.Conn
+	r   *bufio.Reader
+	buf []byte
+	// Offset of the length of the message begun in buf
+	start int
+}
+
+func dial(ctx context.Context, cfg Config) (*conn, error) {
+	if cfg.ConnectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.ConnectTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", net.JoinHostPort(cfg.Host, cfg.Port))
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, r: bufio.NewReader(nc)}
+	stop := netctx.Watch(ctx, c.nc)
+	err = c.startup(cfg)
+	if !stop() && err != nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("connecting to %s: %w", net.JoinHostPort(cfg.Host, cfg.Port), err)
+	}
+	return c, nil
+}
+
+func (c *conn) close() {
+	// Terminate, best effort
+	_, _ = c.nc.Write([]byte{'X', 0, 0, 0, 4})
+	_ = c.nc.Close()
+}
+
+func (c *conn) startup(cfg Config) error {
+	if cfg.SSLMode != SSLDisable {
+		if err := c.startTLS(cfg); err != nil {
+			return err
+		}
+	}
+	params := []string{"user", cfg.User, "database", cfg.Database, "client_encoding", "UTF8", "DateStyle", "ISO", "TimeZone", "UTC"}
+	if cfg.ApplicationName != "" {
+		params = append(params, "application_name", cfg.ApplicationName)
+	}
+	c.begin(0)
+	c.int32(protocolVersion)
+	for _, p := range params {
+		c.string(p)
+	}
+	c.buf = append(c.buf, 0)
+	if err := c.send(); err != nil {
+		return err
+	}
+
+	var sc *scram
+	for {
+		typ, msg, err := c.receive()
+		if err != nil {
+			return err
+		}
+		switch typ {
+		case 'R':
+			code := binary.BigEndian.Uint32(msg)
+			msg = msg[4:]
+			switch code {
+			case authOK:
+			case authCleartext:
+				err = c.password(cfg.Password)
+			case authMD5:
+				err = c.password(md5Password(cfg.User, cfg.Password, msg[:4]))
+			case authSASL:
+				if !strings.Contains(string(msg), scramMechanism+"\x00") {
+					return errors.New("server offers no supported SASL mechanism")
+				}
+				sc = newSCRAM(cfg.User, cfg.Password)
+				first := sc.clientFirst()
+				c.begin('p')
+				c.string(scramMechanism)
+				c.int32(int32(len(first)))
+				c.buf = append(c.buf, first...)
+				err = c.send()
+			case authSASLContinue:
+				if sc == nil {
+					return errors.New("unexpected SASL continue")
+				}
+				var final string
+				if final, err = sc.clientFinal(string(msg)); err == nil {
+					c.begin('p')
+					c.buf = append(c.buf, final...)
+					err = c.send()
+				}
+			case authSASLFinal:
+				if sc == nil {
+					return errors.New("unexpected SASL final")
+				}
+				err = sc.verify(string(msg))
+			default:
+				return fmt.Errorf("unsupported authentication method %d", code)
+			}
+			if err != nil {
+				return err
+			}
+		case 'E':
+			return parseError(msg)
+		case 'Z':
+			return nil
+		}
+		// ParameterStatus, BackendKeyData and notices are ignored.
+	}
+}
+
+func (c *conn) startTLS(cfg Config) error {
+	c.begin(0)
+	c.int32(sslRequestCode)
+	if err := c.send(); err != nil {
+		return err
+	}
+	answer, err := c.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if answer != 'S' {
+		return errors.New("server does not support SSL")
+	}
+	tlsConfig := &tls.Config{ServerName: cfg.Host, MinVersion: tls.VersionTLS12}
+	if cfg.SSLMode == SSLRequire {
+		// Encrypted but unverified, as libpq's sslmode=require.
+		tlsConfig.InsecureSkipVerify = true
+	}
+	tc := tls.Client(c.nc, tlsConfig)
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	c.nc, c.r = tc, bufio.NewReader(tc)
+	return nil
+}
+
+func (c *conn) password(password string) error {
+	c.begin('p')
+	c.string(password)
+	return c.send()
+}
+
+// md5Password is the answer to an MD5 challenge with salt.
+func md5Password(user, password string, salt []byte) string {
+	inner := md5.Sum([]byte(password + user))
+	outer := md5.Sum(append([]byte(hex.EncodeToString(inner[:])), salt...))
+	return "md5" + hex.EncodeToString(outer[:])
+}
+
+// query runs sql with the extended query protocol, so args are never
+// interpolated into it; with simple, it sends sql as a simple query, which
+// may hold several statements but no parameters.
+func (c *conn) query(ctx context.Context, sql string, args []any, simple bool) (*Result, error) {
+	stop := netctx.Watch(ctx, c.nc)
+	var res *Result
+	var err error
+	if simple {
+		c.buf = c.buf[:0]
+		c.add('Q', func() { c.string(sql) })
+		res, err = c.results()
+	} else {
+		res, err = c.exchange(sql, args)
+	}
+	if !stop() && err != nil {
+		var pgErr *Error
+		if !errors.As(err, &pgErr) {
+			err = ctx.Err()
+		}
+	}
+	return res, err
+}
+
+func (c *conn) exchange(sql string, args []any) (*Result, error) {
+	c.buf = c.buf[:0]
+	// Parse the unnamed statement
+	c.add('P', func() {
+		c.string("")
+		c.string(sql)
+		c.int16(0)
+	})
+	// Bind all parameters in text format to the unnamed portal
+	c.add('B', func() {
+		c.string("")
+		c.string("")
+		c.int16(0)
+		c.int16(int16(len(args)))
+		for _, arg := range args {
+			value, null := encode(arg)
+			if null {
+				c.int32(-1)
+				continue
+			}
+			c.int32(int32(len(value)))
+			c.buf = append(c.buf, value...)
+		}
+		c.int16(0)
+	})
+	c.add('D', func() {
+		c.buf = append(c.buf, 'P')
+		c.string("")
+	})
+	c.add('E', func() {
+		c.string("")
+		c.int32(0)
+	})
+	c.add('S', func() {})
+	return c.results()
+}
+
+// results sends the buffered messages and reads the results up to
+// ReadyForQuery. Of several statements, the last one's rows and tag are
+// kept.
+func (c *conn) results() (*Result, error) {
+	if _, err := c.nc.Write(c.buf); err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	var queryErr error
+	for {
+		typ, msg, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case 'T':
+			res.Columns, res.Rows = nil, nil
+			n := int(binary.BigEndian.Uint16(msg))
+			msg = msg[2:]
+			for i := 0; i < n; i++ {
+				end := strings.IndexByte(string(msg), 0)
+				res.Columns = append(res.Columns, string(msg[:end]))
+				// Table OID, column, type OID, size, modifier and format
+				msg = msg[end+1+18:]
+			}
+		case 'D':
+			n := int(binary.BigEndian.Uint16(msg))
+			msg = msg[2:]
+			row := make([]*string, n)
+			for i := range row {
+				size := int32(binary.BigEndian.Uint32(msg))
+				msg = msg[4:]
+				if size < 0 {
+					continue
+				}
+				value := string(msg[:size])
+				row[i] = &value
+				msg = msg[size:]
+			}
+			res.Rows = append(res.Rows, row)
+		case 'C':
+			res.Tag = strings.TrimRight(string(msg), "\x00")
+		case 'E':
+			queryErr = parseError(msg)
+		case 'Z':
+			if queryErr != nil {
+				return nil, queryErr
+			}
+			return res, nil
+		}
+		// ParseComplete, BindComplete, NoData, EmptyQueryResponse, notices
+		// and parameter changes need no action.
+	}
+}
+
+// encode formats arg in PostgreSQL's text format.
+func encode(arg any) (string, bool) {
+	switch v := arg.(type) {
+	case nil:
+		return "", true
+	case string:
+		return v, false
+	case []byte:
+		return `\x` + hex.EncodeToString(v), false
+	case bool:
+		if v {
+			return "t", false
+		}
+		return "f", false
+	case time.Time:
+		return v.Format(time.RFC3339Nano), false
+	case *string:
+		if v == nil {
+			return "", true
+		}
+		return *v, false
+	}
+	return fmt.Sprint(arg), false
+}
+
+// parseError decodes an ErrorResponse.
+func parseError(msg []byte) error {
+	e := &Error{}
+	for len(msg) > 1 {
+		field := msg[0]
+		end := strings.IndexByte(string(msg[1:]), 0)
+		if end < 0 {
+			break
+		}
+		value := string(msg[1 : 1+end])
+		msg = msg[2+end:]
+		switch field {
+		case 'V':
+			e.Severity = value
+		case 'S':
+			if e.Severity == "" {
+				e.Severity = value
+			}
+		case 'C':
+			e.Code = value
+		case 'M':
+			e.Message = value
+		case 'D':
+			e.Detail = value
+		}
+	}
+	return e
+}
+
+// begin starts a message of type typ in the buffer; 0 for the untyped
+// startup messages.
+func (c *conn) begin(typ byte) {
+	c.buf, c.start = c.buf[:0], 0
+	if typ != 0 {
+		c.buf, c.start = append(c.buf, typ), 1
+	}
+	c.buf = append(c.buf, 0, 0, 0, 0)
+}
+
+// add appends a message of type typ whose body fill writes.
+func (c *conn) add(typ byte, fill func()) {
+	c.buf = append(c.buf, typ, 0, 0, 0, 0)
+	start := len(c.buf) - 4
+	fill()
+	binary.BigEndian.PutUint32(c.buf[start:], uint32(len(c.buf)-start))
+}
+
+// send fills in the length of the message begun with begin and writes it.
+func (c *conn) send() error {
+	binary.BigEndian.PutUint32(c.buf[c.start:], uint32(len(c.buf)-c.start))
+	_, err := c.nc.Write(c.buf)
+	return err
+}
+
+func (c *conn) int16(v int16) { c.buf = binary.BigEndian.AppendUint16(c.buf, uint16(v)) }
+func (c *conn) int32(v int32) { c.buf = binary.BigEndian.AppendUint32(c.buf, uint32(v)) }
+func (c *conn) string(s string) {
+	c.buf = append(c.buf, s...)
+	c.buf = append(c.buf, 0)
+}
+
+// receive reads one message from the server.
+func (c *conn) receive() (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	size := int(binary.BigEndian.Uint32(header[1:])) - 4
+	if size < 0 || size > 1<<30 {
+		return 0, nil, fmt.Errorf("invalid message length %d", size)
+	}
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(c.r, msg); err != nil {
+		return 0, nil, err
+	}
+	return header[0], msg, nil
+}
@@ -0,0 +1,202 @@
+// Package postgres is a small PostgreSQL client that speaks the frontend/
+// backend protocol (version 3) directly. It supports trust, password, MD5
+// and SCRAM-SHA-256 authentication, optional TLS, and parameterized queries
+// in text format over a small connection pool. That covers the service's
+// own tables without a driver dependency, not every feature of PostgreSQL.
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SQLSTATE codes the service handles.
+const (
+	CodeUniqueViolation = "23505"
+	CodeUndefinedTable  = "42P01"
+)
+
+// TimestampLayout parses the text format of timestamptz values.
+const TimestampLayout = "2006-01-02 15:04:05.999999-07"
+
+// SSL modes, with libpq's meaning.
+const (
+	SSLDisable    = "disable"
+	SSLRequire    = "require"
+	SSLVerifyFull = "verify-full"
+)
+
+// Config describes how to reach the database.
+type Config struct {
+	Host     string
+	Port     string
+	User     string
+	Password string
+	Database string
+	// SSLDisable, SSLRequire (encrypted, unverified) or SSLVerifyFull
+	SSLMode string
+	// Open connections at most; further queries wait for one
+	MaxConns int
+	// Bounds connecting and authenticating
+	ConnectTimeout time.Duration
+	// Reported in pg_stat_activity
+	ApplicationName string
+}
+
+// Error is an error reported by the server.
+type Error struct {
+	Severity string
+	Code     string
+	Message  string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("%s: %s (SQLSTATE %s): %s", e.Severity, e.Message, e.Code, e.Detail)
+	}
+	return fmt.Sprintf("%s: %s (SQLSTATE %s)", e.Severity, e.Message, e.Code)
+}
+
+// HasCode reports whether err is a server error with SQLSTATE code.
+func HasCode(err error, code string) bool {
+	var pgErr *Error
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+// ErrClosed is returned by queries on a closed DB.
+var ErrClosed = errors.New("postgres: database is closed")
+
+// Result is the outcome of a query: the rows it returned, in text format,
+// and its command tag, such as "INSERT 0 1".
+type Result struct {
+	Columns []string
+	// Values of each row, nil for NULL
+	Rows [][]*string
+	Tag  string
+}
+
+// RowsAffected is the row count of the command tag.
+func (r *Result) RowsAffected() int64 {
+	n, _ := strconv.ParseInt(r.Tag[strings.LastIndexByte(r.Tag, ' ')+1:], 10, 64)
+	return n
+}
+
+// DB is a pool of connections to one database. Connections are opened on
+// demand and kept for reuse; one that fails is discarded. It's safe for
+// concurrent use.
+type DB struct {
+	cfg   Config
+	slots chan struct{}
+	idle  chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// Open returns a pool for cfg without connecting.
+func Open(cfg Config) *DB {
+	if cfg.MaxConns < 1 {
+		cfg.MaxConns = 1
+	}
+	if cfg.Port == "" {
+		cfg.Port = "5432"
+	}
+	if cfg.SSLMode == "" {
+		cfg.SSLMode = SSLDisable
+	}
+	return &DB{cfg: cfg, slots: make(chan struct{}, cfg.MaxConns), idle: make(chan *conn, cfg.MaxConns)}
+}
+
+// Query runs sql with args bound to $1, $2 and so on. Args are sent in
+// text format: nil is NULL, time.Time is RFC 3339, anything else is
+// formatted with fmt. Sessions use the UTC time zone and ISO dates, so
+// timestamps read back as TimestampLayout.
+func (db *DB) Query(ctx context.Context, sql string, args ...any) (*Result, error) {
+	return db.run(ctx, sql, args, false)
+}
+
+// Exec runs a script of one or more statements without parameters. Unless
+// the script has its own BEGIN and COMMIT, the server runs it in one
+// transaction: a failing statement rolls back the ones before it.
+func (db *DB) Exec(ctx context.Context, script string) error {
+	_, err := db.run(ctx, script, nil, true)
+	return err
+}
+
+func (db *DB) run(ctx context.Context, sql string, args []any, simple bool) (*Result, error) {
+	c, err := db.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.query(ctx, sql, args, simple)
+	var pgErr *Error
+	db.release(c, err == nil || errors.As(err, &pgErr))
+	return res, err
+}
+
+// Ping checks that the database answers a query.
+func (db *DB) Ping(ctx context.Context) error {
+	_, err := db.Query(ctx, "SELECT 1")
+	return err
+}
+
+// Close closes the idle connections; connections in use are closed when
+// they're released.
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.closed = true
+	for {
+		select {
+		case c := <-db.idle:
+			c.close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (db *DB) acquire(ctx context.Context) (*conn, error) {
+	select {
+	case db.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	db.mu.Lock()
+	closed := db.closed
+	db.mu.Unlock()
+	if closed {
+		<-db.slots
+		return nil, ErrClosed
+	}
+	select {
+	case c := <-db.idle:
+		return c, nil
+	default:
+	}
+	c, err := dial(ctx, db.cfg)
+	if err != nil {
+		<-db.slots
+		return nil, err
+	}
+	return c, nil
+}
+
+// release returns c to the pool if it's still usable, and frees its slot.
+func (db *DB) release(c *conn, reusable bool) {
+	db.mu.Lock()
+	closed := db.closed
+	db.mu.Unlock()
+	if reusable && !closed {
+		db.idle <- c
+	} else {
+		c.close()
+	}
+	<-db.slots
+}
@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The exchange of RFC 7677, section 3.
+func TestSCRAM(t *testing.T) {
+	sc := newSCRAM("user", "pencil")
+	sc.nonce = "rOprNGfwEbeRWgbNEkqO"
+	if got := sc.clientFirst(); got != "n,,n=user,r=rOprNGfwEbeRWgbNEkqO" {
+		t.Fatalf("clientFirst() = %q", got)
+	}
+	final, err := sc.clientFinal("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	if final != want {
+		t.Errorf("clientFinal() = %q, want %q", final, want)
+	}
+	if err := sc.verify("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="); err != nil {
+		t.Errorf("verify() = %v", err)
+	}
+	if err := sc.verify("v=AAAA"); err == nil {
+		t.Error("verify() accepted a wrong signature")
+	}
+	if _, err := sc.clientFinal("r=someone-else,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"); err == nil {
+		t.Error("clientFinal() accepted a foreign nonce")
+	}
+}
+
+// fakeServer accepts connections with MD5 authentication and answers
+// queries: "SELECT 1" with a row, anything else with an error. Simple
+// queries succeed unless they mention a missing table.
+func fakeServer(t *testing.T, user, password string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(nc, user, password)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFake(nc net.Conn, user, password string) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	send := func(typ byte, body ...[]byte) {
+		msg := []byte{typ, 0, 0, 0, 0}
+		for _, b := range body {
+			msg = append(msg, b...)
+		}
+		binary.BigEndian.PutUint32(msg[1:], uint32(len(msg)-1))
+		nc.Write(msg)
+	}
+	read := func(typed bool) (byte, []byte, error) {
+		var typ byte
+		if typed {
+			var err error
+			if typ, err = r.ReadByte(); err != nil {
+				return 0, nil, err
+			}
+		}
+		var size uint32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return 0, nil, err
+		}
+		msg := make([]byte, size-4)
+		_, err := io.ReadFull(r, msg)
+		return typ, msg, err
+	}
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+	u16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+
+	if _, _, err := read(false); err != nil {
+		return
+	}
+	salt := []byte{1, 2, 3, 4}
+	send('R', u32(authMD5), salt)
+	_, msg, err := read(true)
+	if err != nil {
+		return
+	}
+	if strings.TrimRight(string(msg), "\x00") != md5Password(user, password, salt) {
+		send('E', []byte("SFATAL\x00C28P01\x00Mpassword authentication failed\x00\x00"))
+		return
+	}
+	send('R', u32(authOK))
+	send('Z', []byte("I"))
+
+	var sql string
+	for {
+		typ, msg, err := read(true)
+		if err != nil {
+			return
+		}
+		switch typ {
+		case 'P':
+			sql = string(msg[1:])
+			sql = sql[:strings.IndexByte(sql, 0)]
+		case 'S':
+			if sql == "SELECT 1" {
+				send('1')
+				send('2')
+				send('T', u16(1), []byte("one\x00"), make([]byte, 18))
+				send('D', u16(1), u32(1), []byte("1"))
+				send('C', []byte("SELECT 1\x00"))
+			} else {
+				send('E', []byte("SERROR\x00C42P01\x00Mrelation \"missing\" does not exist\x00\x00"))
+			}
+			send('Z', []byte("I"))
+		case 'Q':
+			if strings.Contains(string(msg), "missing") {
+				send('E', []byte("SERROR\x00C42P01\x00Mrelation \"missing\" does not exist\x00\x00"))
+			} else {
+				send('C', []byte("CREATE TABLE\x00"))
+				send('C', []byte("INSERT 0 1\x00"))
+			}
+			send('Z', []byte("I"))
+		case 'X':
+			return
+		}
+	}
+}
+
+func testConfig(addr string) Config {
+	host, port, _ := net.SplitHostPort(addr)
+	return Config{Host: host, Port: port, User: "app", Password: "secret", Database: "app", MaxConns: 2, ConnectTimeout: time.Second}
+}
+
+func TestQuery(t *testing.T) {
+	db := Open(testConfig(fakeServer(t, "app", "secret")))
+	defer db.Close()
+	ctx := context.Background()
+
+	res, err := db.Query(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Columns) != 1 || res.Columns[0] != "one" || len(res.Rows) != 1 || *res.Rows[0][0] != "1" || res.RowsAffected() != 1 {
+		t.Errorf("Query() = %+v", res)
+	}
+
+	// Server errors keep the connection for the next query.
+	_, err = db.Query(ctx, "SELECT * FROM missing WHERE id = $1", 7)
+	if !HasCode(err, CodeUndefinedTable) {
+		t.Errorf("Query() error = %v, want SQLSTATE %s", err, CodeUndefinedTable)
+	}
+	if err := db.Ping(ctx); err != nil {
+		t.Errorf("Ping() after a server error = %v", err)
+	}
+
+	// Scripts go as simple queries.
+	if err := db.Exec(ctx, "CREATE TABLE t (id int); INSERT INTO t VALUES (1)"); err != nil {
+		t.Errorf("Exec() = %v", err)
+	}
+	if err := db.Exec(ctx, "DROP TABLE missing"); !HasCode(err, CodeUndefinedTable) {
+		t.Errorf("Exec() error = %v, want SQLSTATE %s", err, CodeUndefinedTable)
+	}
+
+	db.Close()
+	if err := db.Ping(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Ping() on a closed DB = %v, want ErrClosed", err)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	cfg := testConfig(fakeServer(t, "app", "secret"))
+	cfg.Password = "wrong"
+	db := Open(cfg)
+	defer db.Close()
+	if err := db.Ping(context.Background()); !HasCode(err, "28P01") {
+		t.Errorf("Ping() with a wrong password = %v, want SQLSTATE 28P01", err)
+	}
+}
@@ -0,0 +1,76 @@
+// Package problem writes error responses as RFC 7807 problem details
+// (application/problem+json), so every error of the API has the same shape
+// whichever handler produced it.
+package problem
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// RequestIDHeader carries the ID of a request, set by the client or by
+// middleware on the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Problem types beyond the generic "about:blank", whose title is the status
+// text.
+const (
+	TypeInvalidRequest = "/problems/invalid-request"
+	TypeUnauthorized   = "/problems/unauthorized"
+	TypeTimeout        = "/problems/timeout"
+	TypeInternal       = "/problems/internal-error"
+)
+
+// Problem is an RFC 7807 problem details object.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	// InvalidParams lists the invalid fields of an invalid-request problem.
+	InvalidParams []InvalidParam `json:"invalid_params,omitempty"`
+}
+
+// InvalidParam names an invalid body field or query parameter and why it
+// was rejected.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// New returns a generic problem for status; its title is the status text.
+func New(status int, detail string) *Problem {
+	return &Problem{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+// Error replies to r like http.Error, with a problem body.
+func Error(w http.ResponseWriter, r *http.Request, detail string, status int) {
+	Write(w, r, New(status, detail))
+}
+
+// Write replies to r with p, filling in the instance and request ID.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = w.Header().Get(RequestIDHeader)
+	}
+	if p.RequestID == "" {
+		p.RequestID = r.Header.Get(RequestIDHeader)
+	}
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", ContentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		log.Printf("Error encoding problem response: %v", err)
+	}
+}
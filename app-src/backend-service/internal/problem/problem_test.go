@@ -0,0 +1,57 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Length", "12")
+	r := httptest.NewRequest(http.MethodGet, "/api/things/1", nil)
+	r.Header.Set(RequestIDHeader, "req-1")
+	Error(rec, r, "no thing 1", http.StatusNotFound)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+	if got := rec.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q", got)
+	}
+	if got := rec.Header().Get("Content-Length"); got != "" {
+		t.Errorf("stale Content-Length %q kept", got)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	want := Problem{Type: "about:blank", Title: "Not Found", Status: 404, Detail: "no thing 1", Instance: "/api/things/1", RequestID: "req-1"}
+	if p.Type != want.Type || p.Title != want.Title || p.Status != want.Status || p.Detail != want.Detail ||
+		p.Instance != want.Instance || p.RequestID != want.RequestID || p.InvalidParams != nil {
+		t.Errorf("problem = %+v, want %+v", p, want)
+	}
+}
+
+func TestWriteRequestID(t *testing.T) {
+	// An ID the server assigned wins over the one the client sent.
+	rec := httptest.NewRecorder()
+	rec.Header().Set(RequestIDHeader, "server-id")
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(RequestIDHeader, "client-id")
+	p := New(http.StatusBadRequest, "")
+	p.Type = TypeInvalidRequest
+	Write(rec, r, p)
+
+	var got map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["request_id"] != "server-id" || got["type"] != TypeInvalidRequest {
+		t.Errorf("problem = %v", got)
+	}
+	if _, ok := got["detail"]; ok {
+		t.Errorf("empty detail encoded: %v", got)
+	}
+}
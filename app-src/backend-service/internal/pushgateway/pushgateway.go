@@ -0,0 +1,156 @@
+// Package pushgateway pushes the metrics of short-lived jobs to a
+// Prometheus Pushgateway when they finish, since Prometheus can't scrape a
+// process that has already exited. It writes the text exposition format
+// itself, so batch binaries need no client library.
+package pushgateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metric types of the exposition format.
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Metric is one sample. Samples sharing a name must be adjacent and share
+// Help and Type.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Pusher sends metrics to one Pushgateway.
+type Pusher struct {
+	// URL is the Pushgateway's base URL, e.g. http://pushgateway:9091.
+	URL    string
+	Client *http.Client
+}
+
+// Push adds metrics to the group identified by job and the grouping
+// labels. It uses POST, which replaces only the metrics of the same names:
+// a failed run keeps the last_success timestamp of the previous successful
+// one.
+func (p *Pusher) Push(ctx context.Context, job string, grouping map[string]string, metrics []Metric) error {
+	if job == "" {
+		return fmt.Errorf("pushgateway: empty job name")
+	}
+	endpoint := strings.TrimSuffix(p.URL, "/") + "/metrics/" + pathLabel("job", job)
+	names := make([]string, 0, len(grouping))
+	for name := range grouping {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		endpoint += "/" + pathLabel(name, grouping[name])
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(Format(metrics)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	client := p.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("pushgateway: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// pathLabel encodes one label of the grouping key. Values that can't appear
+// in a path segment use the Pushgateway's base64 form.
+func pathLabel(name, value string) string {
+	if value == "" || strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// Format renders metrics in the text exposition format.
+func Format(metrics []Metric) []byte {
+	var b bytes.Buffer
+	last := ""
+	for _, m := range metrics {
+		if m.Name != last {
+			if m.Help != "" {
+				fmt.Fprintf(&b, "# HELP %s %s\n", m.Name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(m.Help))
+			}
+			if m.Type != "" {
+				fmt.Fprintf(&b, "# TYPE %s %s\n", m.Name, m.Type)
+			}
+			last = m.Name
+		}
+		b.WriteString(m.Name)
+		if len(m.Labels) > 0 {
+			names := make([]string, 0, len(m.Labels))
+			for name := range m.Labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			b.WriteByte('{')
+			for i, name := range names {
+				if i > 0 {
+					b.WriteByte(',')
+				}
+				fmt.Fprintf(&b, `%s="%s"`, name, strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(m.Labels[name]))
+			}
+			b.WriteByte('}')
+		}
+		b.WriteByte(' ')
+		b.WriteString(formatValue(m.Value))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// JobMetrics are the conventional metrics of a batch run: its duration,
+// when it last completed and, if err is nil, when it last succeeded.
+// Alerting on a stale last_success timestamp catches jobs that stopped
+// running as well as jobs that fail.
+func JobMetrics(prefix string, start, end time.Time, err error) []Metric {
+	metrics := []Metric{
+		{Name: prefix + "_duration_seconds", Help: "Duration of the last run.", Type: Gauge, Value: end.Sub(start).Seconds()},
+		{Name: prefix + "_last_completion_timestamp_seconds", Help: "Unix time the last run completed.", Type: Gauge, Value: float64(end.Unix())},
+	}
+	if err == nil {
+		metrics = append(metrics, Metric{Name: prefix + "_last_success_timestamp_seconds",
+			Help: "Unix time the last run succeeded.", Type: Gauge, Value: float64(end.Unix())})
+	}
+	return metrics
+}
@@ -0,0 +1,70 @@
+package pushgateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	got := string(Format([]Metric{
+		{Name: "runs", Help: "Runs by result.", Type: Counter, Labels: map[string]string{"result": "ok", "env": `a"b`}, Value: 3},
+		{Name: "runs", Help: "Runs by result.", Type: Counter, Labels: map[string]string{"result": "failed"}, Value: 0},
+		{Name: "duration_seconds", Type: Gauge, Value: 1.5},
+	}))
+	want := `# HELP runs Runs by result.
+# TYPE runs counter
+runs{env="a\"b",result="ok"} 3
+runs{result="failed"} 0
+# TYPE duration_seconds gauge
+duration_seconds 1.5
+`
+	if got != want {
+		t.Errorf("Format =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var method, path, body string
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.EscapedPath(), string(b)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer gateway.Close()
+
+	start := time.Unix(1700000000, 0)
+	p := &Pusher{URL: gateway.URL + "/"}
+	err := p.Push(context.Background(), "replay", map[string]string{"target": "http://staging", "env": "dev"},
+		JobMetrics("replay", start, start.Add(2*time.Second), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if method != http.MethodPost || path != "/metrics/job/replay/env/dev/target@base64/aHR0cDovL3N0YWdpbmc" {
+		t.Errorf("pushed %s %s", method, path)
+	}
+	for _, want := range []string{"replay_duration_seconds 2\n", "replay_last_success_timestamp_seconds 1.700000002e+09\n"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body lacks %q:\n%s", want, body)
+		}
+	}
+
+	failed := JobMetrics("replay", start, start, errors.New("boom"))
+	for _, m := range failed {
+		if m.Name == "replay_last_success_timestamp_seconds" {
+			t.Error("failed run reports a success timestamp")
+		}
+	}
+
+	gateway.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad metric", http.StatusBadRequest)
+	})
+	if err := p.Push(context.Background(), "replay", nil, failed); err == nil || !strings.Contains(err.Error(), "bad metric") {
+		t.Errorf("Push to a rejecting gateway = %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package ratelimit limits request rates with token buckets: one shared by
+// every request and one per client, each refilled at a steady rate up to a
+// burst.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Scopes of the limit a request exceeded.
+const (
+	ScopeGlobal = "global"
+	ScopeClient = "client"
+)
+
+// idleSweepInterval is how often buckets of clients that stopped sending
+// are dropped.
+const idleSweepInterval = time.Minute
+
+// Limits are the rates in requests per second and the bursts of the global
+// and per-client buckets. A zero rate disables its bucket; a burst below
+// one allows one request at a time.
+type Limits struct {
+	RPS         int64
+	Burst       int64
+	ClientRPS   int64
+	ClientBurst int64
+}
+
+// Enabled reports whether any limit applies.
+func (l Limits) Enabled() bool {
+	return l.RPS > 0 || l.ClientRPS > 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens earned since the last refill, up to burst. A new
+// bucket starts full.
+func (b *bucket) refill(now time.Time, rps, burst int64) {
+	capacity := float64(max(burst, 1))
+	if b.last.IsZero() {
+		b.tokens = capacity
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.last).Seconds()*float64(rps))
+	}
+	b.last = now
+}
+
+// wait is how long until the bucket holds a whole token.
+func (b *bucket) wait(rps int64) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / float64(rps) * float64(time.Second))
+}
+
+// Limiter holds the buckets. The limits are passed on every call rather
+// than fixed at construction, so a configuration reload changes them in
+// place; buckets keep their tokens across the change.
+type Limiter struct {
+	mu        sync.Mutex
+	global    bucket
+	clients   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// New returns a limiter with full buckets.
+func New() *Limiter {
+	return &Limiter{clients: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow takes a token for a request from client from both buckets. When
+// either is empty it takes none and returns the scope of the exceeded
+// limit and how long until the request would be allowed.
+func (l *Limiter) Allow(client string, limits Limits) (ok bool, scope string, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now, limits)
+
+	var global, perClient *bucket
+	if limits.RPS > 0 {
+		global = &l.global
+		global.refill(now, limits.RPS, limits.Burst)
+		if wait := global.wait(limits.RPS); wait > 0 {
+			return false, ScopeGlobal, wait
+		}
+	}
+	if limits.ClientRPS > 0 {
+		perClient = l.clients[client]
+		if perClient == nil {
+			perClient = &bucket{}
+			l.clients[client] = perClient
+		}
+		perClient.refill(now, limits.ClientRPS, limits.ClientBurst)
+		if wait := perClient.wait(limits.ClientRPS); wait > 0 {
+			return false, ScopeClient, wait
+		}
+	}
+	if global != nil {
+		global.tokens--
+	}
+	if perClient != nil {
+		perClient.tokens--
+	}
+	return true, "", 0
+}
+
+// Clients returns the number of clients with a bucket.
+func (l *Limiter) Clients() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.clients)
+}
+
+// sweep drops the buckets that have refilled completely, which would be
+// recreated identical, so the map only holds recently active clients.
+func (l *Limiter) sweep(now time.Time, limits Limits) {
+	if now.Sub(l.lastSweep) < idleSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for client, b := range l.clients {
+		b.refill(now, limits.ClientRPS, limits.ClientBurst)
+		if limits.ClientRPS <= 0 || b.tokens >= float64(max(limits.ClientBurst, 1)) {
+			delete(l.clients, client)
+		}
+	}
+}
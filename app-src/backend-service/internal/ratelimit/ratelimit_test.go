@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+	limits := Limits{RPS: 10, Burst: 3, ClientRPS: 1, ClientBurst: 2}
+
+	type want struct {
+		ok    bool
+		scope string
+		wait  time.Duration
+	}
+	check := func(step, client string, w want) {
+		t.Helper()
+		ok, scope, wait := l.Allow(client, limits)
+		if ok != w.ok || scope != w.scope || wait != w.wait {
+			t.Errorf("%s: Allow(%q) = %v, %q, %s; want %v, %q, %s", step, client, ok, scope, wait, w.ok, w.scope, w.wait)
+		}
+	}
+
+	// A client's burst is spent first, without taking from the global
+	// bucket when it's refused.
+	check("first", "a", want{ok: true})
+	check("second", "a", want{ok: true})
+	check("client burst spent", "a", want{scope: ScopeClient, wait: time.Second})
+	check("other client", "b", want{ok: true})
+	check("global burst spent", "c", want{scope: ScopeGlobal, wait: 100 * time.Millisecond})
+
+	// Tokens come back at the configured rate.
+	now = now.Add(500 * time.Millisecond)
+	check("global refilled", "c", want{ok: true})
+	check("client half refilled", "a", want{scope: ScopeClient, wait: 500 * time.Millisecond})
+
+	// New limits apply to the existing buckets.
+	limits.ClientRPS = 2
+	now = now.Add(250 * time.Millisecond)
+	check("client rate raised", "a", want{ok: true})
+
+	// Zero rates disable the limits.
+	limits = Limits{}
+	for i := 0; i < 10; i++ {
+		check("disabled", "a", want{ok: true})
+	}
+}
+
+func TestSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := New()
+	l.now = func() time.Time { return now }
+	limits := Limits{ClientRPS: 1, ClientBurst: 5}
+
+	l.Allow("idle", limits)
+	now = now.Add(idleSweepInterval - time.Second)
+	for i := 0; i < 5; i++ {
+		l.Allow("busy", limits)
+	}
+	if got := l.Clients(); got != 2 {
+		t.Fatalf("Clients() = %d, want 2", got)
+	}
+	// The idle client has refilled by the next sweep; the busy one hasn't.
+	now = now.Add(2 * time.Second)
+	l.Allow("new", limits)
+	if got := l.Clients(); got != 2 {
+		t.Errorf("Clients() after sweep = %d, want 2 (busy and new)", got)
+	}
+}
@@ -0,0 +1,291 @@
+// Package recording captures a sample of live request/response pairs as
+// JSON lines and replays them against another deployment, so a candidate
+// version can be checked with real traffic before it is promoted.
+package recording
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// Redacted replaces the values of credential headers in recordings.
+const Redacted = "********"
+
+// redactedHeaders are never written to a recording.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization", "X-Api-Key"}
+
+// fileExt is the extension of recording files.
+const fileExt = ".jsonl"
+
+// Exchange is one recorded request and the response it got.
+type Exchange struct {
+	Time   time.Time   `json:"time"`
+	Route  string      `json:"route,omitempty"`
+	Method string      `json:"method"`
+	URI    string      `json:"uri"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+	// Truncated is set when a body was cut at the recorder's limit; replays
+	// of such a request are not meaningful.
+	Truncated      bool        `json:"truncated,omitempty"`
+	Status         int         `json:"status"`
+	ResponseHeader http.Header `json:"response_header,omitempty"`
+	ResponseBody   []byte      `json:"response_body,omitempty"`
+	DurationMs     float64     `json:"duration_ms"`
+}
+
+// File describes a recording file.
+type File struct {
+	Name     string `json:"name"`
+	Bytes    int64  `json:"bytes"`
+	Modified string `json:"modified"`
+}
+
+// Recorder appends a sample of the requests it sees to files in a
+// directory, one per instance and day. It stops recording once the
+// directory holds maxTotal bytes, so it can't fill the volume.
+type Recorder struct {
+	dir      string
+	instance string
+	percent  int64
+	maxBody  int64
+	maxTotal int64
+
+	mu      sync.Mutex
+	total   int64
+	full    bool
+	sampled func() bool
+}
+
+// NewRecorder returns a recorder sampling percent of the requests into dir;
+// 0 disables it. instance names the files, so replicas sharing a volume
+// don't interleave their writes.
+func NewRecorder(dir, instance string, percent, maxBody, maxTotal int64) (*Recorder, error) {
+	rec := &Recorder{dir: dir, instance: instance, percent: percent, maxBody: maxBody, maxTotal: maxTotal}
+	rec.sampled = func() bool { return rand.Int63n(100) < rec.percent }
+	if !rec.Enabled() {
+		return rec, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating recording directory: %w", err)
+	}
+	files, err := rec.Files()
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		rec.total += f.Bytes
+	}
+	return rec, nil
+}
+
+// Enabled reports whether the recorder samples any requests.
+func (rec *Recorder) Enabled() bool {
+	return rec != nil && rec.percent > 0
+}
+
+// Middleware records a sample of the requests passing through it.
+func (rec *Recorder) Middleware(next http.Handler) http.Handler {
+	if !rec.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !rec.sampled() || rec.isFull() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ex := Exchange{
+			Time:   time.Now().UTC(),
+			Method: r.Method,
+			URI:    r.URL.RequestURI(),
+			Header: redact(r.Header),
+		}
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			ex.Route = route.Name
+		}
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(io.LimitReader(r.Body, rec.maxBody+1))
+			if err != nil {
+				log.Printf("Error reading request body for recording: %v", err)
+			}
+			// The handler still reads the whole body: what was consumed
+			// followed by the rest.
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			ex.Body, ex.Truncated = truncate(body, rec.maxBody)
+		}
+
+		cw := &capturingWriter{ResponseWriter: w, limit: rec.maxBody}
+		start := time.Now()
+		next.ServeHTTP(cw, r)
+		ex.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+		ex.Status = cw.status
+		if ex.Status == 0 {
+			ex.Status = http.StatusOK
+		}
+		ex.ResponseHeader = redact(w.Header())
+		ex.ResponseBody = cw.body.Bytes()
+		ex.Truncated = ex.Truncated || cw.truncated
+		if err := rec.write(ex); err != nil {
+			log.Printf("Error recording %s %s: %v", ex.Method, ex.URI, err)
+		}
+	})
+}
+
+func (rec *Recorder) isFull() bool {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return rec.full
+}
+
+func (rec *Recorder) write(ex Exchange) error {
+	line, err := json.Marshal(ex)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.full {
+		return nil
+	}
+	if rec.total+int64(len(line)) > rec.maxTotal {
+		rec.full = true
+		log.Printf("Recording directory %s reached %d bytes; recording stopped", rec.dir, rec.maxTotal)
+		return nil
+	}
+	name := fmt.Sprintf("%s-%s%s", rec.instance, ex.Time.Format("20060102"), fileExt)
+	f, err := os.OpenFile(filepath.Join(rec.dir, name), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(line)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		rec.total += int64(len(line))
+	}
+	return err
+}
+
+// Files lists the recording files, newest first.
+func (rec *Recorder) Files() ([]File, error) {
+	entries, err := os.ReadDir(rec.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := []File{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), fileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, File{Name: e.Name(), Bytes: info.Size(), Modified: info.ModTime().UTC().Format(time.RFC3339)})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Modified > files[j].Modified })
+	return files, nil
+}
+
+// Open opens the recording file name for reading. Names are those returned
+// by Files; anything else is rejected.
+func (rec *Recorder) Open(name string) (*os.File, error) {
+	if !rec.Enabled() || name != filepath.Base(name) || !strings.HasSuffix(name, fileExt) {
+		return nil, os.ErrNotExist
+	}
+	return os.Open(filepath.Join(rec.dir, name))
+}
+
+// Read decodes the exchanges of a recording.
+func Read(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(scanner.Bytes(), &ex); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, scanner.Err()
+}
+
+func redact(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range redactedHeaders {
+		if _, ok := h[name]; ok {
+			h[name] = []string{Redacted}
+		}
+	}
+	return h
+}
+
+func truncate(b []byte, limit int64) ([]byte, bool) {
+	if int64(len(b)) > limit {
+		return b[:limit], true
+	}
+	return b, false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// capturingWriter copies the status and up to limit bytes of the body.
+type capturingWriter struct {
+	http.ResponseWriter
+	limit     int64
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (cw *capturingWriter) WriteHeader(code int) {
+	if cw.status == 0 {
+		cw.status = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *capturingWriter) Write(b []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if room := cw.limit - int64(cw.body.Len()); room > 0 {
+		keep := b
+		if int64(len(keep)) > room {
+			keep, cw.truncated = keep[:room], true
+		}
+		cw.body.Write(keep)
+	} else if len(b) > 0 {
+		cw.truncated = true
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *capturingWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
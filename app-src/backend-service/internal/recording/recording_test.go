@@ -0,0 +1,167 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// echoJSON answers with a JSON object holding the request body.
+var echoJSON = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Set-Cookie", "session=abc")
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(`{"got":"` + string(body) + `","n":1}`))
+})
+
+func newTestRecorder(t *testing.T, maxBody, maxTotal int64) *Recorder {
+	t.Helper()
+	rec, err := NewRecorder(t.TempDir(), "pod-1", 100, maxBody, maxTotal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func recorded(t *testing.T, rec *Recorder) []Exchange {
+	t.Helper()
+	files, err := rec.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var all []Exchange
+	for _, file := range files {
+		f, err := rec.Open(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exchanges, err := Read(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, exchanges...)
+	}
+	return all
+}
+
+func TestMiddleware(t *testing.T) {
+	rec := newTestRecorder(t, 1024, 1<<20)
+	h := rec.Middleware(echoJSON)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/echo?x=1", strings.NewReader("hello"))
+	r.Header.Set("Authorization", "Bearer secret")
+	h.ServeHTTP(w, r)
+	if w.Body.String() != `{"got":"hello","n":1}` {
+		t.Fatalf("handler saw body %q", w.Body.String())
+	}
+
+	exchanges := recorded(t, rec)
+	if len(exchanges) != 1 {
+		t.Fatalf("recorded %d exchanges, want 1", len(exchanges))
+	}
+	ex := exchanges[0]
+	if ex.Method != http.MethodPost || ex.URI != "/api/echo?x=1" || string(ex.Body) != "hello" ||
+		ex.Status != http.StatusCreated || string(ex.ResponseBody) != `{"got":"hello","n":1}` || ex.Truncated {
+		t.Errorf("exchange = %+v", ex)
+	}
+	if ex.Header.Get("Authorization") != Redacted || ex.ResponseHeader.Get("Set-Cookie") != Redacted {
+		t.Errorf("credentials recorded: %v %v", ex.Header, ex.ResponseHeader)
+	}
+}
+
+func TestMiddlewareLimits(t *testing.T) {
+	rec := newTestRecorder(t, 4, 1<<20)
+	w := httptest.NewRecorder()
+	rec.Middleware(echoJSON).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long")))
+	if !strings.Contains(w.Body.String(), "too long") {
+		t.Errorf("truncation reached the handler: %q", w.Body.String())
+	}
+	if ex := recorded(t, rec)[0]; !ex.Truncated || string(ex.Body) != "too " {
+		t.Errorf("exchange = %+v, want a truncated body", ex)
+	}
+
+	// The directory cap stops recording instead of filling the volume.
+	rec = newTestRecorder(t, 1024, 100)
+	for i := 0; i < 3; i++ {
+		rec.Middleware(echoJSON).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if got := recorded(t, rec); len(got) != 0 {
+		t.Errorf("recorded %d exchanges past the cap", len(got))
+	}
+
+	disabled, err := NewRecorder("", "pod-1", 0, 0, 0)
+	if err != nil || disabled.Enabled() {
+		t.Fatalf("disabled recorder: %v", err)
+	}
+	if _, err := disabled.Open("pod-1-20240101.jsonl"); !os.IsNotExist(err) {
+		t.Errorf("Open on a disabled recorder: %v", err)
+	}
+	if _, err := rec.Open("../etc/passwd.jsonl"); !os.IsNotExist(err) {
+		t.Errorf("Open outside the directory: %v", err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	var gotAuth string
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/same":
+			_, _ = w.Write([]byte(`{"got":"other value","n":2}`))
+		case "/renamed":
+			_, _ = w.Write([]byte(`{"value":"x","n":1}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer target.Close()
+
+	recordedJSON := http.Header{"Content-Type": {"application/json"}}
+	exchange := func(uri string) Exchange {
+		return Exchange{Method: http.MethodGet, URI: uri, Header: http.Header{"Authorization": {Redacted}},
+			Status: 200, ResponseHeader: recordedJSON, ResponseBody: []byte(`{"got":"hello","n":1}`)}
+	}
+	rp := &Replayer{Target: target.URL, AdminToken: "t0k", Compare: CompareShape}
+	ctx := context.Background()
+
+	if res := rp.Replay(ctx, exchange("/same")); res.Err != nil || res.Mismatch != "" {
+		t.Errorf("same shape: %+v", res)
+	}
+	if gotAuth != "Bearer t0k" {
+		t.Errorf("Authorization = %q, want the admin token", gotAuth)
+	}
+	if res := rp.Replay(ctx, exchange("/renamed")); !strings.Contains(res.Mismatch, "JSON shape") {
+		t.Errorf("renamed field: %+v", res)
+	}
+	if res := rp.Replay(ctx, exchange("/gone")); res.Mismatch != "status 404, recorded 200" {
+		t.Errorf("status change: %+v", res)
+	}
+	rp.Compare = CompareBody
+	if res := rp.Replay(ctx, exchange("/same")); res.Mismatch != "body differs" {
+		t.Errorf("body comparison: %+v", res)
+	}
+	truncated := exchange("/same")
+	truncated.Truncated = true
+	if res := rp.Replay(ctx, truncated); !res.Skipped {
+		t.Errorf("truncated exchange replayed: %+v", res)
+	}
+}
+
+func TestRead(t *testing.T) {
+	exchanges, err := Read(bytes.NewBufferString("{\"method\":\"GET\",\"uri\":\"/\",\"status\":200}\n\n{\"method\":\"POST\",\"uri\":\"/x\",\"status\":201}\n"))
+	if err != nil || len(exchanges) != 2 || exchanges[1].URI != "/x" {
+		t.Errorf("Read = %+v, %v", exchanges, err)
+	}
+	if _, err := Read(strings.NewReader("{\n")); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("invalid line: %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Comparison modes of a replay, from the most to the least lenient.
+const (
+	// CompareStatus only compares status codes.
+	CompareStatus = "status"
+	// CompareShape also compares the structure of JSON bodies (keys and
+	// value types), ignoring values such as timestamps and hostnames that
+	// differ between any two deployments.
+	CompareShape = "shape"
+	// CompareBody also compares bodies byte for byte.
+	CompareBody = "body"
+)
+
+// hopHeaders aren't replayed; the client sets them for the new request.
+var hopHeaders = []string{"Connection", "Content-Length", "Host", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade"}
+
+// errNoTarget is returned by Replay without a target URL.
+var errNoTarget = errors.New("recording: no replay target")
+
+// Replayer re-issues recorded requests against another deployment.
+type Replayer struct {
+	Client *http.Client
+	// Target is the base URL requests are sent to.
+	Target string
+	// AdminToken replaces redacted Authorization headers, so admin
+	// requests can be replayed.
+	AdminToken string
+	// Compare is one of CompareStatus, CompareShape and CompareBody.
+	Compare string
+}
+
+// Result is the outcome of replaying one exchange. Skipped exchanges had a
+// truncated body; Mismatch describes how the response differed, empty when
+// it matched.
+type Result struct {
+	Exchange Exchange
+	Status   int
+	Skipped  bool
+	Mismatch string
+	Err      error
+}
+
+// Replay re-issues ex and compares the response with the recorded one.
+func (rp *Replayer) Replay(ctx context.Context, ex Exchange) Result {
+	res := Result{Exchange: ex}
+	if ex.Truncated {
+		res.Skipped = true
+		return res
+	}
+	if rp.Target == "" {
+		res.Err = errNoTarget
+		return res
+	}
+	req, err := http.NewRequestWithContext(ctx, ex.Method, strings.TrimSuffix(rp.Target, "/")+ex.URI, bytes.NewReader(ex.Body))
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	req.Header = ex.Header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	for _, name := range hopHeaders {
+		req.Header.Del(name)
+	}
+	for name, values := range req.Header {
+		if len(values) == 1 && values[0] == Redacted {
+			req.Header.Del(name)
+		}
+	}
+	if ex.Header.Get("Authorization") == Redacted && rp.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+rp.AdminToken)
+	}
+
+	client := rp.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Status = resp.StatusCode
+	res.Mismatch = rp.compare(ex, resp.Header, resp.StatusCode, body)
+	return res
+}
+
+func (rp *Replayer) compare(ex Exchange, header http.Header, status int, body []byte) string {
+	if status != ex.Status {
+		return fmt.Sprintf("status %d, recorded %d", status, ex.Status)
+	}
+	switch rp.Compare {
+	case CompareBody:
+		if !bytes.Equal(body, ex.ResponseBody) {
+			return "body differs"
+		}
+	case CompareShape:
+		if !isJSON(header) || !isJSON(ex.ResponseHeader) {
+			return ""
+		}
+		got, err := jsonShape(body)
+		if err != nil {
+			return "invalid JSON: " + err.Error()
+		}
+		want, err := jsonShape(ex.ResponseBody)
+		if err != nil {
+			return ""
+		}
+		if got != want {
+			return fmt.Sprintf("JSON shape %s, recorded %s", got, want)
+		}
+	}
+	return ""
+}
+
+func isJSON(h http.Header) bool {
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// jsonShape describes the structure of a JSON document: object keys with
+// the shapes of their values, the shape of the first element of arrays and
+// the type of everything else.
+func jsonShape(data []byte) (string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", err
+	}
+	return shapeOf(v), nil
+}
+
+func shapeOf(v any) string {
+	switch v := v.(type) {
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		parts := make([]string, 0, len(keys))
+		for _, k := range keys {
+			parts = append(parts, k+":"+shapeOf(v[k]))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	case []any:
+		if len(v) == 0 {
+			return "[]"
+		}
+		return "[" + shapeOf(v[0]) + "]"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	}
+	return "null"
+}
@@ -0,0 +1,167 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/netctx"
+)
+
+// maxBulkLen bounds the bulk strings read, so a corrupt length can't
+// allocate without limit.
+const maxBulkLen = 64 << 20
+
+// conn is one authenticated connection with its database selected.
+type conn struct {
+	nc  net.Conn
+	r   *bufio.Reader
+	buf []byte
+}
+
+func dial(ctx context.Context, cfg Config) (*conn, error) {
+	if cfg.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.DialTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, r: bufio.NewReader(nc)}
+	err = c.setup(ctx, cfg)
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("connecting to %s: %w", cfg.Addr, err)
+	}
+	return c, nil
+}
+
+func (c *conn) setup(ctx context.Context, cfg Config) error {
+	if cfg.Password != "" {
+		if _, err := c.do(ctx, []string{"AUTH", cfg.Password}); err != nil {
+			return err
+		}
+	}
+	if cfg.DB != 0 {
+		if _, err := c.do(ctx, []string{"SELECT", strconv.Itoa(cfg.DB)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) close() {
+	_ = c.nc.Close()
+}
+
+// do sends one command and reads its reply.
+func (c *conn) do(ctx context.Context, args []string) (any, error) {
+	stop := netctx.Watch(ctx, c.nc)
+	c.buf = c.buf[:0]
+	c.buf = append(c.buf, '*')
+	c.buf = strconv.AppendInt(c.buf, int64(len(args)), 10)
+	c.buf = append(c.buf, '\r', '\n')
+	for _, arg := range args {
+		c.buf = append(c.buf, '$')
+		c.buf = strconv.AppendInt(c.buf, int64(len(arg)), 10)
+		c.buf = append(c.buf, '\r', '\n')
+		c.buf = append(c.buf, arg...)
+		c.buf = append(c.buf, '\r', '\n')
+	}
+	_, err := c.nc.Write(c.buf)
+	var reply any
+	if err == nil {
+		reply, err = c.reply()
+	}
+	if !stop() && err != nil {
+		var replyErr Error
+		if !errors.As(err, &replyErr) && !errors.Is(err, Nil) {
+			err = ctx.Err()
+		}
+	}
+	if err == nil {
+		if e, ok := reply.(Error); ok {
+			return nil, e
+		}
+	}
+	return reply, err
+}
+
+// reply reads one reply. Error replies are returned as values, so errors
+// nested in arrays don't end the read; do turns a top-level one into an
+// error.
+func (c *conn) reply() (any, error) {
+	line, err := c.line()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+	payload := string(line[1:])
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return Error(payload), nil
+	case ':':
+		n, err := strconv.ParseInt(payload, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid integer reply %q", payload)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(payload)
+		if err != nil || n > maxBulkLen {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", payload)
+		}
+		if n < 0 {
+			return nil, Nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", payload)
+		}
+		if n < 0 {
+			return nil, Nil
+		}
+		values := make([]any, 0, min(n, 1024))
+		for i := 0; i < n; i++ {
+			v, err := c.reply()
+			if errors.Is(err, Nil) {
+				v, err = nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
+
+// line reads a line without its CRLF.
+func (c *conn) line() ([]byte, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("redis: malformed reply")
+	}
+	return line[:len(line)-2], nil
+}
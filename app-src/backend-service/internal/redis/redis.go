@@ -0,0 +1,169 @@
+// Package redis is a small Redis client that speaks RESP2 directly. It sends
+// commands as arrays of bulk strings over a small connection pool and reads
+// the replies, which covers caching with string keys and counters without a
+// driver dependency, not every feature of Redis (no pub/sub, no cluster).
+package redis
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Nil is returned for a key that doesn't exist.
+var Nil = errors.New("redis: nil")
+
+// ErrClosed is returned by commands on a closed Client.
+var ErrClosed = errors.New("redis: client is closed")
+
+// Error is an error reply of the server, such as "WRONGTYPE Operation
+// against a key holding the wrong kind of value".
+type Error string
+
+func (e Error) Error() string { return string(e) }
+
+// Config describes how to reach the server.
+type Config struct {
+	// host:port
+	Addr     string
+	Password string
+	// Database selected on every connection
+	DB int
+	// Open connections at most; further commands wait for one
+	MaxConns int
+	// Bounds connecting and authenticating
+	DialTimeout time.Duration
+}
+
+// Client is a pool of connections to one server. Connections are opened on
+// demand and kept for reuse; one that fails is discarded. It's safe for
+// concurrent use.
+type Client struct {
+	cfg   Config
+	slots chan struct{}
+	idle  chan *conn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// New returns a client for cfg without connecting.
+func New(cfg Config) *Client {
+	if cfg.MaxConns < 1 {
+		cfg.MaxConns = 1
+	}
+	return &Client{cfg: cfg, slots: make(chan struct{}, cfg.MaxConns), idle: make(chan *conn, cfg.MaxConns)}
+}
+
+// Do sends a command and returns its reply: a string for simple and bulk
+// strings, an int64 for integers and a []any for arrays. A nil bulk string
+// or array is Nil, and an error reply is an Error.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := cn.do(ctx, args)
+	var replyErr Error
+	c.release(cn, err == nil || errors.Is(err, Nil) || errors.As(err, &replyErr))
+	return reply, err
+}
+
+// Get returns the value of key, Nil when it's not set.
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	s, ok := reply.(string)
+	if !ok {
+		return "", errors.New("redis: unexpected reply to GET")
+	}
+	return s, nil
+}
+
+// Set sets key to value, expiring after ttl unless ttl is zero.
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Incr increments the counter at key and returns its new value.
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	reply, err := c.Do(ctx, "INCR", key)
+	if err != nil {
+		return 0, err
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, errors.New("redis: unexpected reply to INCR")
+	}
+	return n, nil
+}
+
+// Ping checks that the server answers a command.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections; connections in use are closed when
+// they're released.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	for {
+		select {
+		case cn := <-c.idle:
+			cn.close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (c *Client) acquire(ctx context.Context) (*conn, error) {
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		<-c.slots
+		return nil, ErrClosed
+	}
+	select {
+	case cn := <-c.idle:
+		return cn, nil
+	default:
+	}
+	cn, err := dial(ctx, c.cfg)
+	if err != nil {
+		<-c.slots
+		return nil, err
+	}
+	return cn, nil
+}
+
+// release returns cn to the pool if it's still usable, and frees its slot.
+func (c *Client) release(cn *conn, reusable bool) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if reusable && !closed {
+		c.idle <- cn
+	} else {
+		cn.close()
+	}
+	<-c.slots
+}
@@ -0,0 +1,164 @@
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers AUTH, PING, GET, SET (ignoring expiry), INCR and
+// MGET from one shared keyspace, and refuses commands of unauthenticated
+// connections when password is set.
+func fakeServer(t *testing.T, password string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	keys := make(map[string]string)
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveFake(nc, password, &mu, keys)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveFake(nc net.Conn, password string, mu *sync.Mutex, keys map[string]string) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+	authed := password == ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			data := make([]byte, size+2)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return
+			}
+			args[i] = string(data[:size])
+		}
+
+		var reply string
+		mu.Lock()
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid username-password pair\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "PING":
+			reply = "+PONG\r\n"
+		case cmd == "GET":
+			v, ok := keys[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = bulk(v)
+			}
+		case cmd == "SET":
+			keys[args[1]] = args[2]
+			reply = "+OK\r\n"
+		case cmd == "INCR":
+			v, _ := strconv.ParseInt(keys[args[1]], 10, 64)
+			keys[args[1]] = strconv.FormatInt(v+1, 10)
+			reply = ":" + keys[args[1]] + "\r\n"
+		case cmd == "MGET":
+			reply = fmt.Sprintf("*%d\r\n", len(args)-1)
+			for _, key := range args[1:] {
+				if v, ok := keys[key]; ok {
+					reply += bulk(v)
+				} else {
+					reply += "$-1\r\n"
+				}
+			}
+		default:
+			reply = "-ERR unknown command '" + args[0] + "'\r\n"
+		}
+		mu.Unlock()
+		if _, err := io.WriteString(nc, reply); err != nil {
+			return
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	c := New(Config{Addr: fakeServer(t, "secret"), Password: "secret", MaxConns: 2, DialTimeout: time.Second})
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() = %v", err)
+	}
+	if _, err := c.Get(ctx, "missing"); !errors.Is(err, Nil) {
+		t.Errorf("Get() of a missing key = %v, want Nil", err)
+	}
+	value := "line one\r\nline two"
+	if err := c.Set(ctx, "k", value, time.Minute); err != nil {
+		t.Fatalf("Set() = %v", err)
+	}
+	if got, err := c.Get(ctx, "k"); err != nil || got != value {
+		t.Errorf("Get() = %q, %v", got, err)
+	}
+	for want := int64(1); want <= 2; want++ {
+		if n, err := c.Incr(ctx, "counter"); err != nil || n != want {
+			t.Errorf("Incr() = %d, %v; want %d", n, err, want)
+		}
+	}
+	reply, err := c.Do(ctx, "MGET", "k", "missing")
+	if values, ok := reply.([]any); err != nil || !ok || len(values) != 2 || values[0] != value || values[1] != nil {
+		t.Errorf("Do(MGET) = %#v, %v", reply, err)
+	}
+
+	// Error replies keep the connection for the next command.
+	var replyErr Error
+	if _, err := c.Do(ctx, "FLUSHALL"); !errors.As(err, &replyErr) || !strings.HasPrefix(string(replyErr), "ERR unknown command") {
+		t.Errorf("Do(FLUSHALL) = %v, want an error reply", err)
+	}
+	if err := c.Ping(ctx); err != nil {
+		t.Errorf("Ping() after an error reply = %v", err)
+	}
+
+	c.Close()
+	if err := c.Ping(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Ping() on a closed client = %v, want ErrClosed", err)
+	}
+}
+
+func TestAuthFailure(t *testing.T) {
+	addr := fakeServer(t, "secret")
+	for _, password := range []string{"wrong", ""} {
+		c := New(Config{Addr: addr, Password: password, DialTimeout: time.Second})
+		var replyErr Error
+		if err := c.Ping(context.Background()); !errors.As(err, &replyErr) {
+			t.Errorf("Ping() with password %q = %v, want an error reply", password, err)
+		}
+		c.Close()
+	}
+}
@@ -0,0 +1,99 @@
+// Package requestid gives every request an ID, carried in the X-Request-ID
+// header, so the log lines of one request can be found across the services
+// it passes through.
+//
+// An ID set by the caller, such as the frontend or the ingress controller,
+// is kept; requests without one, or with one that isn't safe to log, get a
+// new ID. The ID is echoed in the response and sent on outbound calls made
+// with the request context.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// Header carries the request ID.
+const Header = problem.RequestIDHeader
+
+// maxLength bounds the IDs taken from callers.
+const maxLength = 128
+
+type contextKey struct{}
+
+// FromContext returns the ID of the request, or "" outside one.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// NewContext returns ctx carrying the request ID id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// New returns a random ID of 32 hex digits.
+func New() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// valid accepts the IDs of common generators (UUIDs, hex, base64url, ULIDs)
+// and rejects anything that could forge log fields.
+func valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '+' || c == '/' || c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware assigns the request its ID, stores it in the request context
+// and sets it on the response before the handler runs, so error responses
+// carry it too.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !valid(id) {
+			id = New()
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// Transport wraps base, http.DefaultTransport when nil, so requests made
+// with the context of a request carry its ID, unless they set one already.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := FromContext(req.Context())
+	if id == "" || req.Header.Get(Header) != "" {
+		return t.base.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, id)
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,84 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{name: "none"},
+		{name: "uuid", incoming: "0b7c3f1e-5f6a-4d8e-9c2b-1a2b3c4d5e6f", keep: true},
+		{name: "ingress style", incoming: "ab12cd34ef56:req/7=", keep: true},
+		{name: "log injection", incoming: "abc\" status=200"},
+		{name: "too long", incoming: strings.Repeat("a", maxLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = FromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				r.Header.Set(Header, tt.incoming)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if got := rec.Header().Get(Header); got != seen || seen == "" {
+				t.Fatalf("response ID %q, context ID %q, want the same non-empty ID", got, seen)
+			}
+			if tt.keep && seen != tt.incoming {
+				t.Errorf("ID = %q, want the caller's %q", seen, tt.incoming)
+			}
+			if !tt.keep && (seen == tt.incoming || len(seen) != 32) {
+				t.Errorf("ID = %q, want a new one", seen)
+			}
+		})
+	}
+}
+
+func TestTransport(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get(Header))
+	}))
+	defer srv.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	ctx := NewContext(context.Background(), "req-1")
+	for _, set := range []string{"", "explicit"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set != "" {
+			req.Header.Set(Header, set)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if set == "" && req.Header.Get(Header) != "" {
+			t.Error("Transport modified the caller's request")
+		}
+	}
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if want := []string{"req-1", "explicit", ""}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("outbound IDs = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,309 @@
+// Package router dispatches requests by method and path pattern. Unlike
+// http.ServeMux in Go 1.21 it supports path parameters, and every route
+// carries metadata (name, auth requirement, timeout) that middleware, the
+// route listing and the API docs read from the request context. The router
+// only records the metadata; enforcing it is up to the route's handler
+// chain.
+package router
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// Route describes one endpoint.
+type Route struct {
+	// Name identifies the route in logs, metrics and API docs.
+	Name string
+	// Methods the route accepts; empty accepts every method. GET routes
+	// also answer HEAD.
+	Methods []string
+	// Pattern is the request path. A "{name}" segment matches one non-empty
+	// path segment and a final "{name...}" segment the rest of the path.
+	Pattern string
+	// Group selects the middleware chain of the route.
+	Group string
+	// Auth marks routes that require the admin token.
+	Auth bool
+	// Timeout bounds the request context, enforced by the server's timeout
+	// middleware; zero means the server's default and negative no limit.
+	Timeout time.Duration
+	// Description documents the route.
+	Description string
+	// Deprecated marks an old path kept as an alias for existing clients.
+	Deprecated bool
+
+	Handler http.Handler
+
+	segments []segment
+}
+
+type segment struct {
+	literal string
+	param   string
+	rest    bool
+}
+
+// Router is an http.Handler dispatching to the registered routes.
+type Router struct {
+	routes []*Route
+
+	// NotFound serves requests no route matches; a 404 problem by default.
+	NotFound http.Handler
+	// MethodNotAllowed serves requests whose path matches but whose method
+	// doesn't. The Allow header is already set when it runs.
+	MethodNotAllowed http.Handler
+}
+
+// New returns an empty router.
+func New() *Router {
+	return &Router{}
+}
+
+// Handle registers a route. Like http.ServeMux it panics on invalid or
+// conflicting patterns, which are programming errors.
+func (rt *Router) Handle(route Route) {
+	if route.Handler == nil {
+		panic("router: nil handler for " + route.Pattern)
+	}
+	segments, err := parsePattern(route.Pattern)
+	if err != nil {
+		panic(err)
+	}
+	route.segments = segments
+	for _, other := range rt.routes {
+		if other.Pattern == route.Pattern && overlap(other.Methods, route.Methods) {
+			panic(fmt.Sprintf("router: %s %v conflicts with an existing route", route.Pattern, route.Methods))
+		}
+	}
+	rt.routes = append(rt.routes, &route)
+}
+
+// Routes returns the registered routes in registration order.
+func (rt *Router) Routes() []Route {
+	routes := make([]Route, 0, len(rt.routes))
+	for _, r := range rt.routes {
+		routes = append(routes, *r)
+	}
+	return routes
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		best      *Route
+		params    map[string]string
+		bestScore = -1
+		allowed   []string
+	)
+	segments := splitPath(r.URL.EscapedPath())
+	for _, route := range rt.routes {
+		p, score, ok := route.match(segments)
+		if !ok {
+			continue
+		}
+		if !route.allows(r.Method) {
+			allowed = append(allowed, route.Methods...)
+			continue
+		}
+		if score > bestScore {
+			best, params, bestScore = route, p, score
+		}
+	}
+
+	if best == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowHeader(allowed), ", "))
+			rt.methodNotAllowed().ServeHTTP(w, r)
+			return
+		}
+		rt.notFound().ServeHTTP(w, r)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), routeKey{}, best)
+	ctx = context.WithValue(ctx, paramsKey{}, params)
+	best.Handler.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (rt *Router) notFound() http.Handler {
+	if rt.NotFound != nil {
+		return rt.NotFound
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", r.URL.Path), http.StatusNotFound)
+	})
+}
+
+func (rt *Router) methodNotAllowed() http.Handler {
+	if rt.MethodNotAllowed != nil {
+		return rt.MethodNotAllowed
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.method_not_allowed"), http.StatusMethodNotAllowed)
+	})
+}
+
+// match reports whether the route matches the path segments, with the
+// decoded parameters and a score preferring literal segments over
+// parameters.
+func (route *Route) match(path []string) (map[string]string, int, bool) {
+	var params map[string]string
+	score := 0
+	for i, seg := range route.segments {
+		if seg.rest {
+			if i >= len(path) {
+				return nil, 0, false
+			}
+			if params == nil {
+				params = make(map[string]string)
+			}
+			rest, err := url.PathUnescape(strings.Join(path[i:], "/"))
+			if err != nil {
+				return nil, 0, false
+			}
+			params[seg.param] = rest
+			return params, score, true
+		}
+		if i >= len(path) {
+			return nil, 0, false
+		}
+		if seg.param == "" {
+			if path[i] != seg.literal {
+				return nil, 0, false
+			}
+			score++
+			continue
+		}
+		value, err := url.PathUnescape(path[i])
+		if err != nil || value == "" {
+			return nil, 0, false
+		}
+		if params == nil {
+			params = make(map[string]string)
+		}
+		params[seg.param] = value
+	}
+	if len(path) != len(route.segments) {
+		return nil, 0, false
+	}
+	return params, score, true
+}
+
+func (route *Route) allows(method string) bool {
+	if len(route.Methods) == 0 {
+		return true
+	}
+	for _, m := range route.Methods {
+		if m == method || (m == http.MethodGet && method == http.MethodHead) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePattern(pattern string) ([]segment, error) {
+	if !strings.HasPrefix(pattern, "/") {
+		return nil, fmt.Errorf("router: pattern %q must start with /", pattern)
+	}
+	parts := splitPath(pattern)
+	segments := make([]segment, 0, len(parts))
+	seen := make(map[string]bool)
+	for i, part := range parts {
+		name, ok := strings.CutPrefix(part, "{")
+		if !ok {
+			if strings.ContainsAny(part, "{}") {
+				return nil, fmt.Errorf("router: pattern %q: invalid segment %q", pattern, part)
+			}
+			segments = append(segments, segment{literal: part})
+			continue
+		}
+		name, ok = strings.CutSuffix(name, "}")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("router: pattern %q: invalid segment %q", pattern, part)
+		}
+		name, rest := strings.CutSuffix(name, "...")
+		if rest && i != len(parts)-1 {
+			return nil, fmt.Errorf("router: pattern %q: %q must be the last segment", pattern, part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("router: pattern %q: duplicate parameter %q", pattern, name)
+		}
+		seen[name] = true
+		segments = append(segments, segment{param: name, rest: rest})
+	}
+	return segments, nil
+}
+
+// splitPath splits a path into segments; "/" has none and a trailing slash
+// adds an empty one, so "/a" and "/a/" are different paths.
+func splitPath(path string) []string {
+	path = strings.TrimPrefix(path, "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func overlap(a, b []string) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return true
+	}
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func allowHeader(methods []string) []string {
+	seen := make(map[string]bool)
+	var allow []string
+	for _, m := range methods {
+		if !seen[m] {
+			seen[m] = true
+			allow = append(allow, m)
+		}
+		if m == http.MethodGet && !seen[http.MethodHead] {
+			seen[http.MethodHead] = true
+			allow = append(allow, http.MethodHead)
+		}
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+type routeKey struct{}
+
+type paramsKey struct{}
+
+// RouteFromContext returns the route serving the request of ctx.
+func RouteFromContext(ctx context.Context) (Route, bool) {
+	route, ok := ctx.Value(routeKey{}).(*Route)
+	if !ok {
+		return Route{}, false
+	}
+	return *route, true
+}
+
+// Param returns the decoded path parameter name of r, "" when it has none.
+func Param(r *http.Request, name string) string {
+	params, _ := r.Context().Value(paramsKey{}).(map[string]string)
+	return params[name]
+}
+
+// WithParams returns r carrying the given path parameters, for calling a
+// handler without routing, e.g. in tests.
+func WithParams(r *http.Request, params map[string]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), paramsKey{}, params))
+}
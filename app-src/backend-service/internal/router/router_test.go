@@ -0,0 +1,124 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// echoRoute answers with the route name and its parameters.
+func echoRoute(name string, methods []string, pattern string) Route {
+	return Route{
+		Name:    name,
+		Methods: methods,
+		Pattern: pattern,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, _ := RouteFromContext(r.Context())
+			fmt.Fprintf(w, "%s id=%s rest=%s", route.Name, Param(r, "id"), Param(r, "rest"))
+		}),
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	rt := New()
+	rt.Handle(echoRoute("root", nil, "/"))
+	rt.Handle(echoRoute("list", []string{http.MethodGet}, "/items"))
+	rt.Handle(echoRoute("create", []string{http.MethodPost}, "/items"))
+	rt.Handle(echoRoute("item", []string{http.MethodGet}, "/items/{id}"))
+	rt.Handle(echoRoute("latest", []string{http.MethodGet}, "/items/latest"))
+	rt.Handle(echoRoute("files", []string{http.MethodGet}, "/files/{rest...}"))
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantBody   string
+		wantAllow  string
+	}{
+		{method: "GET", path: "/", wantStatus: 200, wantBody: "root id= rest="},
+		{method: "GET", path: "/items", wantStatus: 200, wantBody: "list"},
+		{method: "HEAD", path: "/items", wantStatus: 200},
+		{method: "POST", path: "/items", wantStatus: 200, wantBody: "create"},
+		{method: "DELETE", path: "/items", wantStatus: 405, wantAllow: "GET, HEAD, POST"},
+		{method: "GET", path: "/items/42", wantStatus: 200, wantBody: "item id=42"},
+		{method: "GET", path: "/items/a%2Fb", wantStatus: 200, wantBody: "item id=a/b"},
+		{method: "GET", path: "/items/latest", wantStatus: 200, wantBody: "latest"},
+		{method: "GET", path: "/items/", wantStatus: 404},
+		{method: "GET", path: "/items/42/more", wantStatus: 404},
+		{method: "GET", path: "/files/a/b.txt", wantStatus: 200, wantBody: "files id= rest=a/b.txt"},
+		{method: "GET", path: "/files/", wantStatus: 200, wantBody: "files id= rest="},
+		{method: "GET", path: "/files", wantStatus: 404},
+		{method: "GET", path: "/unknown", wantStatus: 404},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			rt.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.path, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if tt.wantBody != "" && !strings.HasPrefix(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body = %q, want prefix %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get("Allow"); got != tt.wantAllow {
+				t.Errorf("Allow = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
+
+func TestCustomFallbacks(t *testing.T) {
+	rt := New()
+	rt.Handle(echoRoute("list", []string{http.MethodGet}, "/items"))
+	rt.NotFound = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	rt.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusConflict) })
+
+	rec := httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("NotFound not used: %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	rt.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/items", nil))
+	if rec.Code != http.StatusConflict || rec.Header().Get("Allow") != "GET, HEAD" {
+		t.Errorf("MethodNotAllowed not used: %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestHandlePanics(t *testing.T) {
+	for _, pattern := range []string{"items", "/items/{}", "/items/{id", "/a/{rest...}/b", "/a/{id}/{id}", "/a/b{c}"} {
+		t.Run(pattern, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("pattern %q accepted", pattern)
+				}
+			}()
+			New().Handle(echoRoute("bad", nil, pattern))
+		})
+	}
+
+	rt := New()
+	rt.Handle(echoRoute("get", []string{http.MethodGet}, "/items"))
+	rt.Handle(echoRoute("post", []string{http.MethodPost}, "/items"))
+	defer func() {
+		if recover() == nil {
+			t.Error("conflicting route accepted")
+		}
+	}()
+	rt.Handle(echoRoute("any", nil, "/items"))
+}
+
+func TestRoutes(t *testing.T) {
+	rt := New()
+	rt.Handle(echoRoute("a", nil, "/a"))
+	rt.Handle(echoRoute("b", nil, "/b/{id}"))
+	routes := rt.Routes()
+	if len(routes) != 2 || routes[0].Name != "a" || routes[1].Pattern != "/b/{id}" {
+		t.Errorf("Routes() = %+v", routes)
+	}
+	if _, ok := RouteFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); ok {
+		t.Error("RouteFromContext found a route outside the router")
+	}
+}
@@ -0,0 +1,228 @@
+// Package schema derives JSON Schemas (draft 2020-12) from the API's
+// response types and validates decoded JSON against them. Deriving the
+// schemas from the Go types keeps them in sync with what the handlers
+// actually encode.
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dialect is the JSON Schema version the generated schemas declare.
+const Dialect = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document. Only the keywords needed to describe the
+// API's responses are generated and validated.
+type Schema struct {
+	Dialect     string             `json:"$schema,omitempty"`
+	ID          string             `json:"$id,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        Types              `json:"type,omitempty"`
+	Format      string             `json:"format,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	// AdditionalProperties is false for structs, the value schema for maps
+	// and unset (anything allowed) otherwise.
+	AdditionalProperties any     `json:"additionalProperties,omitempty"`
+	Items                *Schema `json:"items,omitempty"`
+}
+
+// Types is the "type" keyword; a single type is encoded as a string.
+type Types []string
+
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var single string
+	if json.Unmarshal(data, &single) == nil {
+		*t = Types{single}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// For returns the schema of the JSON encoding of v's type.
+func For(v any) *Schema {
+	return forType(reflect.TypeOf(v))
+}
+
+func forType(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: Types{"string"}, Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := forType(t.Elem())
+		s.Type = nullable(s.Type)
+		return s
+	case reflect.Struct:
+		return forStruct(t)
+	case reflect.Map:
+		// nil maps encode as null
+		return &Schema{Type: Types{"object", "null"}, AdditionalProperties: forType(t.Elem())}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{"string"}, Format: "byte"}
+		}
+		// nil slices encode as null
+		return &Schema{Type: Types{"array", "null"}, Items: forType(t.Elem())}
+	case reflect.Array:
+		return &Schema{Type: Types{"array"}, Items: forType(t.Elem())}
+	case reflect.String:
+		return &Schema{Type: Types{"string"}}
+	case reflect.Bool:
+		return &Schema{Type: Types{"boolean"}}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: Types{"integer"}}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: Types{"number"}}
+	}
+	// interfaces: any JSON value
+	return &Schema{}
+}
+
+func forStruct(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:                 Types{"object"},
+		Properties:           make(map[string]*Schema),
+		AdditionalProperties: false,
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			embedded := forStruct(f.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = append(s.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = forType(f.Type)
+		if !strings.Contains(","+opts+",", ",omitempty,") {
+			s.Required = append(s.Required, name)
+		}
+	}
+	sort.Strings(s.Required)
+	return s
+}
+
+func nullable(types Types) Types {
+	if len(types) == 0 {
+		return types
+	}
+	for _, t := range types {
+		if t == "null" {
+			return types
+		}
+	}
+	return append(append(Types{}, types...), "null")
+}
+
+// Validate checks a decoded JSON value (as produced by json.Unmarshal into
+// an any) against the schema and returns every violation found.
+func (s *Schema) Validate(value any) []error {
+	var errs []error
+	s.validate("$", value, &errs)
+	return errs
+}
+
+func (s *Schema) validate(path string, value any, errs *[]error) {
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		*errs = append(*errs, fmt.Errorf("%s: got %s, want %s", path, jsonType(value), strings.Join(s.Type, " or ")))
+		return
+	}
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, fmt.Errorf("%s: missing required property %q", path, name))
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if prop, ok := s.Properties[k]; ok {
+				prop.validate(path+"."+k, v[k], errs)
+				continue
+			}
+			switch extra := s.AdditionalProperties.(type) {
+			case bool:
+				if !extra {
+					*errs = append(*errs, fmt.Errorf("%s: unexpected property %q", path, k))
+				}
+			case *Schema:
+				extra.validate(path+"."+k, v[k], errs)
+			}
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	}
+}
+
+func (t Types) matches(value any) bool {
+	actual := jsonType(value)
+	for _, want := range t {
+		if want == actual || (want == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonType(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
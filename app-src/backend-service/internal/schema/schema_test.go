@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+type inner struct {
+	Name string `json:"name"`
+}
+
+type sample struct {
+	ID       int64             `json:"id"`
+	Ratio    float64           `json:"ratio"`
+	Enabled  bool              `json:"enabled"`
+	Note     string            `json:"note,omitempty"`
+	Tags     []string          `json:"tags"`
+	Labels   map[string]string `json:"labels"`
+	Child    *inner            `json:"child,omitempty"`
+	At       time.Time         `json:"at"`
+	Extra    any               `json:"extra,omitempty"`
+	Ignored  string            `json:"-"`
+	internal string
+}
+
+func TestForStruct(t *testing.T) {
+	s := For(sample{internal: "not encoded"})
+
+	if got := strings.Join(s.Required, ","); got != "at,enabled,id,labels,ratio,tags" {
+		t.Errorf("required = %s", got)
+	}
+	if _, ok := s.Properties["Ignored"]; ok {
+		t.Error(`json:"-" field has a property`)
+	}
+	if _, ok := s.Properties["internal"]; ok {
+		t.Error("unexported field has a property")
+	}
+	tests := map[string]string{
+		"id":      `"integer"`,
+		"ratio":   `"number"`,
+		"enabled": `"boolean"`,
+		"tags":    `["array","null"]`,
+		"labels":  `["object","null"]`,
+		"child":   `["object","null"]`,
+		"at":      `"string"`,
+	}
+	for name, want := range tests {
+		got, _ := json.Marshal(s.Properties[name].Type)
+		if string(got) != want {
+			t.Errorf("%s type = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	s := For(sample{})
+	tests := []struct {
+		name    string
+		body    string
+		wantErr string
+	}{
+		{name: "valid", body: `{"id":1,"ratio":0.5,"enabled":true,"tags":null,"labels":{"a":"b"},"at":"2024-01-01T00:00:00Z"}`},
+		{name: "integer accepted as number", body: `{"id":1,"ratio":1,"enabled":true,"tags":[],"labels":{},"at":""}`},
+		{name: "missing required", body: `{"ratio":0.5,"enabled":true,"tags":[],"labels":{},"at":""}`, wantErr: `missing required property "id"`},
+		{name: "unknown property", body: `{"id":1,"ratio":0.5,"enabled":true,"tags":[],"labels":{},"at":"","x":1}`, wantErr: `unexpected property "x"`},
+		{name: "wrong type", body: `{"id":1.5,"ratio":0.5,"enabled":true,"tags":[],"labels":{},"at":""}`, wantErr: "$.id: got number, want integer"},
+		{name: "wrong item type", body: `{"id":1,"ratio":0.5,"enabled":true,"tags":[1],"labels":{},"at":""}`, wantErr: "$.tags[0]"},
+		{name: "wrong map value", body: `{"id":1,"ratio":0.5,"enabled":true,"tags":[],"labels":{"a":false},"at":""}`, wantErr: "$.labels.a"},
+		{name: "nested", body: `{"id":1,"ratio":0.5,"enabled":true,"tags":[],"labels":{},"at":"","child":{}}`, wantErr: `$.child: missing required property "name"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body any
+			if err := json.Unmarshal([]byte(tt.body), &body); err != nil {
+				t.Fatal(err)
+			}
+			errs := s.Validate(body)
+			if tt.wantErr == "" {
+				if len(errs) != 0 {
+					t.Errorf("unexpected errors: %v", errs)
+				}
+				return
+			}
+			if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.wantErr) {
+				t.Errorf("errors = %v, want one containing %q", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSchemaRoundTrip(t *testing.T) {
+	data, err := json.Marshal(For(sample{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"additionalProperties":false`) {
+		t.Errorf("struct schema doesn't forbid additional properties: %s", data)
+	}
+	var decoded Schema
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Type) != 1 || decoded.Type[0] != "object" || len(decoded.Properties) != 9 {
+		t.Errorf("decoded %+v", decoded)
+	}
+}
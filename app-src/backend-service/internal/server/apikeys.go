@@ -0,0 +1,178 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+)
+
+// adminKeys are the credentials of the admin endpoints: ADMIN_TOKEN and the
+// API keys of ADMIN_API_KEY_FILE, one per line. The file is a mounted Secret,
+// read again when the kubelet updates it. A key removed from it stays valid
+// for the grace period, so rotating is a single change of the Secret:
+// replace the old key with the new one, and clients have until the grace
+// period ends to switch. Listing both keys keeps both valid for as long as
+// needed.
+type adminKeys struct {
+	token string
+	file  string
+	grace time.Duration
+
+	mu       sync.RWMutex
+	keys     [][]byte
+	retiring map[string]time.Time // removed keys by the end of their grace
+	stamp    string
+	loaded   bool
+}
+
+// newAdminKeys reads the key file; it fails when the file can't be read, so
+// a missing Secret stops the pod at startup.
+func newAdminKeys(cfg config.Config) (*adminKeys, error) {
+	ak := &adminKeys{
+		token:    cfg.AdminToken,
+		file:     cfg.AdminAPIKeyFile,
+		grace:    cfg.AdminAPIKeyGrace,
+		retiring: make(map[string]time.Time),
+	}
+	if _, err := ak.reload(); err != nil {
+		return nil, err
+	}
+	return ak, nil
+}
+
+// Enabled reports whether any credential is configured. A key file enables
+// the endpoints even while it holds no key.
+func (ak *adminKeys) Enabled() bool {
+	return ak.token != "" || ak.file != ""
+}
+
+// Valid reports whether key is ADMIN_TOKEN, a key of the file or a removed
+// key within its grace period. Every candidate is compared, in constant
+// time, so timing tells nothing about which one matched.
+func (ak *adminKeys) Valid(key string) bool {
+	if key == "" {
+		return false
+	}
+	b := []byte(key)
+	match := 0
+	if ak.token != "" {
+		match |= subtle.ConstantTimeCompare(b, []byte(ak.token))
+	}
+	now := time.Now()
+	ak.mu.RLock()
+	defer ak.mu.RUnlock()
+	for _, k := range ak.keys {
+		match |= subtle.ConstantTimeCompare(b, k)
+	}
+	for k, until := range ak.retiring {
+		if now.Before(until) {
+			match |= subtle.ConstantTimeCompare(b, []byte(k))
+		}
+	}
+	return match == 1
+}
+
+// identify names a valid key for the audit log without revealing it:
+// "admin-token", or "api-key:" and its fingerprint for keys of the file. It
+// returns "" for invalid keys.
+func (ak *adminKeys) identify(key string) string {
+	if !ak.Valid(key) {
+		return ""
+	}
+	if ak.token != "" && subtle.ConstantTimeCompare([]byte(key), []byte(ak.token)) == 1 {
+		return "admin-token"
+	}
+	return "api-key:" + keyFingerprint(key)
+}
+
+// keyFingerprint is the start of the SHA-256 of key: enough to tell keys
+// apart in logs, useless to recover them.
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// reload reads the key file if it changed since the last read and reports
+// whether it did. Keys no longer in the file start their grace period. On
+// error the current keys stay in use.
+func (ak *adminKeys) reload() (bool, error) {
+	if ak.file == "" {
+		return false, nil
+	}
+	stamp := fileStamp(ak.file)
+	ak.mu.RLock()
+	unchanged := ak.loaded && stamp == ak.stamp
+	ak.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(ak.file)
+	if err != nil {
+		return false, fmt.Errorf("reading admin API key file: %w", err)
+	}
+	var keys [][]byte
+	current := make(map[string]bool)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '#' {
+			keys = append(keys, line)
+			current[string(line)] = true
+		}
+	}
+
+	now := time.Now()
+	ak.mu.Lock()
+	removed := 0
+	for _, k := range ak.keys {
+		if !current[string(k)] {
+			ak.retiring[string(k)] = now.Add(ak.grace)
+			removed++
+		}
+	}
+	for k, until := range ak.retiring {
+		if current[k] || !now.Before(until) {
+			delete(ak.retiring, k)
+		}
+	}
+	first := !ak.loaded
+	ak.keys, ak.stamp, ak.loaded = keys, stamp, true
+	ak.mu.Unlock()
+
+	switch {
+	case len(keys) == 0:
+		log.Printf("Warning: admin API key file %s holds no key", ak.file)
+	case first:
+		log.Printf("Loaded %d admin API keys", len(keys))
+	default:
+		log.Printf("Reloaded admin API keys: %d active, %d removed and valid for another %s", len(keys), removed, ak.grace)
+	}
+	return true, nil
+}
+
+// run polls the key file until ctx ends.
+func (ak *adminKeys) run(ctx context.Context) {
+	if ak.file == "" {
+		return
+	}
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := ak.reload(); err != nil {
+			log.Printf("Error reloading admin API keys, keeping the current ones: %v", err)
+		}
+	}
+}
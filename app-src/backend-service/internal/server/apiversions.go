@@ -0,0 +1,83 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// apiV1Prefix is the path prefix of version 1 of the API. Breaking changes
+// to paths would go under a new prefix; compatible changes to response
+// shapes are negotiated per request, see package apiversion.
+const apiV1Prefix = "/api/v1"
+
+// APIVersionsResponse is the /api response: what a client can ask this
+// build for.
+type APIVersionsResponse struct {
+	// Paths are the versioned path prefixes served, the current one last.
+	Paths []string `json:"paths"`
+	// ResponseVersions are the response shapes selectable with the
+	// Accept-Version header or the vendor media type.
+	ResponseVersions       []int  `json:"response_versions"`
+	DefaultResponseVersion int    `json:"default_response_version"`
+	LegacyPaths            bool   `json:"legacy_paths"`
+	LegacySunset           string `json:"legacy_sunset,omitempty"`
+}
+
+// legacySunset parses API_LEGACY_SUNSET into the HTTP date of the Sunset
+// header; it is empty when unset or invalid.
+func legacySunset(date string) time.Time {
+	if date == "" {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.DateOnly, date)
+	if err != nil {
+		log.Printf("Invalid API_LEGACY_SUNSET %q, expected a date such as 2027-01-31; sending no Sunset header", date)
+		return time.Time{}
+	}
+	return t
+}
+
+// deprecationMiddleware marks responses of deprecated paths with the
+// Deprecation header, the Sunset date when one is set, and a Link to the
+// versioned path that replaces them, and counts the requests so the
+// remaining users of the old paths show in /metrics.
+func (s *Server) deprecationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, ok := router.RouteFromContext(r.Context())
+		if ok && route.Deprecated {
+			h := w.Header()
+			h.Set("Deprecation", "true")
+			if !s.legacySunset.IsZero() {
+				h.Set("Sunset", s.legacySunset.Format(http.TimeFormat))
+			}
+			successor := apiV1Prefix + strings.TrimPrefix(r.URL.EscapedPath(), "/api")
+			h.Add("Link", "<"+successor+`>; rel="successor-version"`)
+			s.metrics.deprecated.Inc(route.Name)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) apiVersionsHandler(w http.ResponseWriter, _ *http.Request) {
+	resp := APIVersionsResponse{
+		Paths:                  []string{apiV1Prefix},
+		DefaultResponseVersion: apiversion.Default,
+		LegacyPaths:            s.cfg.APILegacyPaths,
+	}
+	for v := 1; v <= apiversion.Latest; v++ {
+		resp.ResponseVersions = append(resp.ResponseVersions, v)
+	}
+	if s.cfg.APILegacyPaths && !s.legacySunset.IsZero() {
+		resp.LegacySunset = s.legacySunset.Format(time.DateOnly)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding API versions response: %v", err)
+	}
+}
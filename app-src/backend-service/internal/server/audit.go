@@ -0,0 +1,143 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/audit"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/jwt"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// auditActions names the audited operations by route and method: the admin
+// actions that change the replica, and the mutations of the API. Requests
+// of other methods, like the GET of /admin/chaos, aren't audited.
+var auditActions = map[string]map[string]string{
+	"admin-prestop":  {http.MethodGet: "pod.prestop", http.MethodPost: "pod.prestop"},
+	"admin-drain":    {http.MethodPost: "pod.drain"},
+	"admin-undrain":  {http.MethodPost: "pod.undrain"},
+	"admin-chaos":    {http.MethodPut: "chaos.override", http.MethodDelete: "chaos.reset"},
+	"admin-loglevel": {http.MethodPut: "loglevel.override", http.MethodDelete: "loglevel.reset"},
+	"items":          {http.MethodPost: "item.create"},
+	"item":           {http.MethodPut: "item.replace", http.MethodDelete: "item.delete"},
+	"gitops-promote": {http.MethodPost: "gitops.promote"},
+}
+
+// Actors of the changes that don't come through the API.
+const (
+	actorAnonymous = "anonymous"
+	actorFlags     = "feature-flags"
+	actorConfig    = "config-reload"
+)
+
+// newAuditLog opens the stream of the audit log: AUDIT_LOG_FILE, appended
+// to, or stdout. It is apart from the logger, so LOG_LEVEL never drops an
+// entry.
+func newAuditLog(cfg config.Config) (*audit.Log, error) {
+	var w io.Writer = os.Stdout
+	if cfg.AuditLogFile != "" {
+		f, err := os.OpenFile(cfg.AuditLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+		w = f
+	}
+	return audit.New(w, cfg.Identity(), cfg.AuditLogEntries), nil
+}
+
+// audited records the requests of route whose method is one of actions,
+// once the handler answered. It wraps the admin credential check, so
+// refused attempts are recorded too.
+func (s *Server) audited(actions map[string]string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action, ok := actions[r.Method]
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		tw := &trackingWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+
+		status := tw.status()
+		outcome := audit.OutcomeSucceeded
+		switch {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			outcome = audit.OutcomeRefused
+		case status >= http.StatusBadRequest:
+			outcome = audit.OutcomeFailed
+		}
+		// Creations point at what they created
+		target := tw.Header().Get("Location")
+		if target == "" {
+			target = r.URL.Path
+		}
+		s.audit.Record(audit.Entry{
+			Action:     action,
+			Actor:      s.actor(r),
+			Target:     target,
+			Outcome:    outcome,
+			Status:     status,
+			Method:     r.Method,
+			RequestID:  requestid.FromContext(r.Context()),
+			RemoteAddr: s.clientIP(r),
+		})
+	})
+}
+
+// actor names who sent r: the admin credential it presented, else the
+// subject of its bearer token, else anonymous. Credentials are never
+// recorded, only which one it was.
+func (s *Server) actor(r *http.Request) string {
+	if key := handlers.AdminKey(r); key != "" {
+		if name := s.admin.identify(key); name != "" {
+			return name
+		}
+		if _, ok := jwt.FromContext(r.Context()); !ok {
+			return "invalid-key:" + keyFingerprint(key)
+		}
+	}
+	if claims, ok := jwt.FromContext(r.Context()); ok && claims.Subject() != "" {
+		return "jwt:" + claims.Subject()
+	}
+	return actorAnonymous
+}
+
+type AuditRequest struct {
+	Limit int `query:"limit" validate:"min=1,max=1000"`
+	// Prefix of the actions to list, such as "item." or "pod.drain"
+	Action string `query:"action"`
+}
+
+// AuditResponse is the response of /admin/audit: the most recent entries
+// of the audit log of this replica, newest first.
+type AuditResponse struct {
+	Replica string        `json:"replica"`
+	Entries []audit.Entry `json:"entries"`
+}
+
+// auditHandler serves /admin/audit.
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request) {
+	req := AuditRequest{Limit: 100}
+	if err := validate.DecodeQuery(r, &req); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	var match func(audit.Entry) bool
+	if req.Action != "" {
+		match = func(e audit.Entry) bool { return strings.HasPrefix(e.Action, req.Action) }
+	}
+	resp := AuditResponse{Replica: s.cfg.Identity(), Entries: s.audit.Recent(req.Limit, match)}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding audit response: %v", err)
+	}
+}
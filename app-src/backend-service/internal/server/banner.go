@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+)
+
+// startupSummary describes the effective configuration in a few aligned
+// lines, secrets redacted, so a pod's log can be compared with what the
+// GitOps repo declares without calling /admin/config.
+func (s *Server) startupSummary(srv, httpsSrv, adminSrv, grpcSrv *http.Server) []string {
+	cfg := s.cfg
+	var lines []string
+	add := func(label, format string, args ...any) {
+		lines = append(lines, fmt.Sprintf("  %-13s %s", label+":", fmt.Sprintf(format, args...)))
+	}
+
+	lines = append(lines, fmt.Sprintf("Starting %s %s (commit %s, built %s) in environment %s",
+		cfg.ServiceName, cfg.Build.Version, cfg.Build.GitCommit, cfg.Build.BuildTime, cfg.Environment))
+	scheme := "HTTP"
+	if srv.TLSConfig != nil {
+		scheme = "HTTPS"
+	}
+	add("Listener", "%s %s (read %s, write %s, idle %s)", scheme, srv.Addr, srv.ReadTimeout, srv.WriteTimeout, srv.IdleTimeout)
+	if httpsSrv != nil {
+		add("Listener", "HTTPS %s", httpsSrv.Addr)
+	}
+	if s.certs != nil {
+		add("Certificate", "%s, expires %s, reloaded on change", cfg.TLSCertFile, s.certs.expiry().UTC().Format(time.RFC3339))
+	}
+	if adminSrv != nil {
+		add("Diagnostics", "%s (pprof, expvar, dumps, probes, metrics)", adminSrv.Addr)
+	} else {
+		add("Diagnostics", "disabled (ADMIN_PORT not set)")
+	}
+	if grpcSrv != nil {
+		add("gRPC", "%s (BackendService, grpc.health.v1, reflection)", grpcSrv.Addr)
+	} else {
+		add("gRPC", "disabled (GRPC_PORT not set)")
+	}
+	add("Identity", "%s in namespace %s, node %s, IP %s", cfg.Identity(), cfg.PodNamespace, orNone(cfg.NodeName), cfg.PodIP)
+	add("Features", "%s", orNone(strings.Join(enabledFeatures(cfg), ", ")))
+
+	var deps []string
+	if len(cfg.SiblingServices) > 0 {
+		deps = append(deps, "services "+strings.Join(cfg.SiblingServices, ", "))
+	}
+	for _, u := range cfg.SidecarReadinessURLs {
+		deps = append(deps, "sidecar "+config.Redact("SIDECAR_READINESS_URLS", u))
+	}
+	for _, u := range cfg.ReadinessDependencyURLs {
+		deps = append(deps, "readiness "+config.Redact("READINESS_DEPENDENCY_URLS", u))
+	}
+	if cfg.RegistryURL != "" {
+		deps = append(deps, "registry "+config.Redact("SERVICE_REGISTRY_URL", cfg.RegistryURL))
+	}
+	for _, repo := range cfg.GitPollRepos {
+		deps = append(deps, "repo "+config.Redact("GIT_POLL_REPOS", repo))
+	}
+	if cfg.NTPServer != "" {
+		deps = append(deps, "ntp "+cfg.NTPServer)
+	}
+	add("Dependencies", "%s", orNone(strings.Join(deps, "; ")))
+
+	add("Limits", "request timeout %s, delay max %s, %d job workers, job queue %d, preStop %s-%s",
+		cfg.RequestTimeout, cfg.DelayMax, cfg.JobWorkers, cfg.JobQueueCapacity, cfg.PrestopMinWait, cfg.PrestopTimeout)
+	add("Startup", "%s simulated initialization (%s plus up to %s jitter)", s.startupDelay, cfg.StartupDelay, cfg.StartupJitter)
+	add("Load", "CPU %dm, memory %d bytes, for %s at most",
+		cfg.LoadMaxMillicores, cfg.LoadMaxMemoryBytes, cfg.LoadMaxDuration)
+	add("Resources", "CPU %dm/%dm, memory %d/%d bytes (request/limit, 0 = unset)",
+		cfg.CPURequestMillicores, cfg.CPULimitMillicores, cfg.MemoryRequestBytes, cfg.MemoryLimitBytes)
+	switch {
+	case cfg.AdminAPIKeyFile != "":
+		add("Admin", "protected endpoints enabled with API keys from %s (%s grace when rotated)",
+			cfg.AdminAPIKeyFile, cfg.AdminAPIKeyGrace)
+	case cfg.AdminToken != "":
+		add("Admin", "token-protected endpoints enabled")
+	default:
+		add("Admin", "token-protected endpoints disabled (ADMIN_TOKEN and ADMIN_API_KEY_FILE not set)")
+	}
+
+	// The values set in the environment and the config file are the ones
+	// the GitOps repo declares; defaults are left out to keep the banner
+	// short.
+	if file := config.File(); file != "" {
+		add("Config file", "%s", file)
+	}
+	var fromEnv, fromFile []string
+	for _, e := range config.Entries() {
+		switch e.Source {
+		case config.SourceEnv:
+			fromEnv = append(fromEnv, e.Key+"="+e.Value)
+		case config.SourceFile:
+			fromFile = append(fromFile, e.Key+"="+e.Value)
+		}
+	}
+	add("Environment", "%s", orNone(strings.Join(fromEnv, " ")))
+	if len(fromFile) > 0 {
+		add("From file", "%s", strings.Join(fromFile, " "))
+	}
+	return lines
+}
+
+func (s *Server) logStartupSummary(srv, httpsSrv, adminSrv, grpcSrv *http.Server) {
+	for _, line := range s.startupSummary(srv, httpsSrv, adminSrv, grpcSrv) {
+		log.Print(line)
+	}
+}
+
+// enabledFeatures names the optional features cfg turns on.
+func enabledFeatures(cfg config.Config) []string {
+	var features []string
+	for _, f := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"leader-election", cfg.LeaderElectionEnabled},
+		{"deployment-watch", cfg.DeploymentWatchEnabled},
+		{"events", cfg.EventsEnabled},
+		{"node-topology", cfg.NodeTopologyEnabled},
+		{"disruption-tracking", cfg.DisruptionTrackingEnabled},
+		{"image-drift", cfg.ImageDriftEnabled},
+		{"node-pressure (" + cfg.NodePressureMode + ")", cfg.NodePressureEnabled},
+		{"work-partitioning", cfg.WorkPartitioningEnabled},
+		{"feature-flags", cfg.FeatureFlagsConfigMap != ""},
+		{"service-registry", cfg.RegistryURL != ""},
+		{fmt.Sprintf("shadowing (%d%% to %s)", cfg.ShadowSamplePercent, config.Redact("SHADOW_TARGET_URL", cfg.ShadowTargetURL)),
+			cfg.ShadowTargetURL != "" && cfg.ShadowSamplePercent > 0},
+		{"downstream (" + config.Redact("DOWNSTREAM_URL", cfg.DownstreamURL) + ")", cfg.DownstreamURL != ""},
+		{"postgres (" + cfg.DatabaseHost + ")", cfg.DatabaseHost != ""},
+		{fmt.Sprintf("redis cache (%s, %s)", cfg.RedisAddr, cfg.RedisCacheTTL), cfg.RedisAddr != ""},
+		{fmt.Sprintf("event bus (%s, %s)", config.Redact("EVENT_BROKER_URL", cfg.EventBrokerURL), cfg.EventTopic), cfg.EventBrokerURL != ""},
+		{"oidc login (" + cfg.OIDCIssuerURL + ")", cfg.OIDCEnabled()},
+		{fmt.Sprintf("recording (%d%%)", cfg.RecordingSamplePercent), cfg.RecordingSamplePercent > 0},
+		{fmt.Sprintf("tracing (%d%% to %s)", cfg.TracingSamplePercent, config.Redact("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", cfg.TracingEndpoint)),
+			cfg.TracingEndpoint != ""},
+	} {
+		if f.enabled {
+			features = append(features, f.name)
+		}
+	}
+	return features
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
@@ -0,0 +1,179 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/redis"
+)
+
+// maxCachedBytes bounds the responses cached; larger ones are served
+// uncached.
+const maxCachedBytes = 1 << 20
+
+// responseCache keeps GET responses of selected routes in Redis, shared by
+// every replica, for RedisCacheTTL. Keys are grouped in namespaces with a
+// generation: invalidating a namespace increments it, so its old keys are
+// never read again and expire on their own. When Redis fails, responses are
+// served uncached. A nil cache caches nothing.
+type responseCache struct {
+	client  *redis.Client
+	ttl     time.Duration
+	prefix  string
+	metrics *httpMetrics
+}
+
+func newResponseCache(cfg config.Config, m *httpMetrics) *responseCache {
+	if cfg.RedisAddr == "" {
+		return nil
+	}
+	return &responseCache{
+		client: redis.New(redis.Config{
+			Addr:        cfg.RedisAddr,
+			Password:    cfg.RedisPassword,
+			DB:          cfg.RedisDB,
+			MaxConns:    10,
+			DialTimeout: 2 * time.Second,
+		}),
+		ttl:     cfg.RedisCacheTTL,
+		prefix:  cfg.ServiceName + ":" + cfg.Environment + ":cache:",
+		metrics: m,
+	}
+}
+
+// wrap serves GET requests of route from the cache, keyed by namespace, the
+// request URI and the negotiated API version and language, and caches the
+// 200 responses of next. Other methods go to next untouched. X-Cache tells
+// whether the response was a HIT or a MISS.
+func (c *responseCache) wrap(route string, namespace func(*http.Request) string, next http.Handler) http.Handler {
+	if c == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		key, err := c.key(ctx, namespace(r), r, w.Header().Get("Content-Language"))
+		var cached string
+		if err == nil {
+			cached, err = c.client.Get(ctx, key)
+		}
+		switch {
+		case err == nil:
+			contentType, body, _ := strings.Cut(cached, "\n")
+			c.metrics.cache.Inc(route, "hit")
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("X-Cache", "HIT")
+			_, _ = w.Write([]byte(body))
+			return
+		case errors.Is(err, redis.Nil):
+			c.metrics.cache.Inc(route, "miss")
+		default:
+			c.metrics.cache.Inc(route, "error")
+			log.Printf("Warning: response cache unavailable: %v", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("X-Cache", "MISS")
+		cw := &cacheWriter{ResponseWriter: w}
+		next.ServeHTTP(cw, r)
+		if cw.status() != http.StatusOK || cw.overflow || ctx.Err() != nil {
+			return
+		}
+		value := w.Header().Get("Content-Type") + "\n" + cw.body.String()
+		if err := c.client.Set(ctx, key, value, c.ttl); err != nil {
+			log.Printf("Warning: caching %s response failed: %v", route, err)
+		}
+	})
+}
+
+// key is the Redis key of a request's response in namespace.
+func (c *responseCache) key(ctx context.Context, namespace string, r *http.Request, lang string) (string, error) {
+	generation, err := c.client.Get(ctx, c.prefix+namespace+":generation")
+	if errors.Is(err, redis.Nil) {
+		generation, err = "0", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(r.URL.RequestURI() + "\n" + strconv.Itoa(apiversion.FromContext(ctx)) + "\n" + lang))
+	return c.prefix + namespace + ":" + generation + ":" + hex.EncodeToString(sum[:16]), nil
+}
+
+// invalidate drops the cached responses of namespace, after a write.
+func (c *responseCache) invalidate(ctx context.Context, namespace string) {
+	if c == nil {
+		return
+	}
+	if _, err := c.client.Incr(ctx, c.prefix+namespace+":generation"); err != nil {
+		log.Printf("Warning: invalidating cached %s failed: %v", namespace, err)
+	}
+}
+
+// ping checks that Redis answers, for readiness.
+func (c *responseCache) ping(ctx context.Context) error {
+	return c.client.Ping(ctx)
+}
+
+func (c *responseCache) close() {
+	if c != nil {
+		c.client.Close()
+	}
+}
+
+// cacheWriter copies the body of a response as it's written, up to
+// maxCachedBytes.
+type cacheWriter struct {
+	http.ResponseWriter
+	code     int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (cw *cacheWriter) WriteHeader(code int) {
+	if cw.code == 0 {
+		cw.code = code
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheWriter) Write(b []byte) (int, error) {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	if !cw.overflow {
+		if cw.body.Len()+len(b) > maxCachedBytes {
+			cw.overflow = true
+			cw.body.Reset()
+		} else {
+			cw.body.Write(b)
+		}
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// status is the response status, 200 when the handler wrote nothing.
+func (cw *cacheWriter) status() int {
+	if cw.code == 0 {
+		return http.StatusOK
+	}
+	return cw.code
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// ChaosHeader marks responses that had a fault injected, naming it.
+const ChaosHeader = "X-Chaos-Injected"
+
+// TypeInjectedFault is the problem type of errors injected on purpose.
+const TypeInjectedFault = "/problems/injected-fault"
+
+// chaosSettings are the faults injected into API requests, from the live
+// settings so a Git change turns them on and off without a restart.
+type chaosSettings struct {
+	latency        time.Duration
+	latencyPercent int64
+	errorPercent   int64
+}
+
+func chaosFromConfig(cfg config.Config) chaosSettings {
+	return chaosSettings{
+		latency:        cfg.ChaosLatency,
+		latencyPercent: cfg.ChaosLatencyPercent,
+		errorPercent:   cfg.ChaosErrorPercent,
+	}
+}
+
+// chaosOverride replaces the configured settings from /admin/chaos until
+// it's deleted.
+type chaosOverride struct {
+	settings chaosSettings
+	since    time.Time
+}
+
+// ChaosRequest is the body of PUT /admin/chaos. Fields left out keep their
+// current values.
+type ChaosRequest struct {
+	LatencyMs      *int64 `json:"latency_ms" validate:"min=0,max=60000"`
+	LatencyPercent *int64 `json:"latency_percent" validate:"min=0,max=100"`
+	ErrorPercent   *int64 `json:"error_percent" validate:"min=0,max=100"`
+}
+
+// ChaosResponse is the response of /admin/chaos: the faults in effect and
+// whether they come from the config or a runtime override.
+type ChaosResponse struct {
+	Source         string `json:"source"`
+	Since          string `json:"since,omitempty"`
+	LatencyMs      int64  `json:"latency_ms"`
+	LatencyPercent int64  `json:"latency_percent"`
+	ErrorPercent   int64  `json:"error_percent"`
+}
+
+// chaos returns the faults in effect: the override if there is one,
+// otherwise the live config.
+func (s *Server) chaos() chaosSettings {
+	if o := s.chaosOverride.Load(); o != nil {
+		return o.settings
+	}
+	return s.live.get().chaos
+}
+
+// chaosMiddleware delays and fails a sampled percentage of API requests, to
+// demo SLO alerts and analysis-driven rollbacks. It runs inside "timeout",
+// so a delay past the route's timeout ends in the usual 503.
+func (s *Server) chaosMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := s.chaos()
+		delay := c.latency > 0 && rand.Int63n(100) < c.latencyPercent
+		fail := rand.Int63n(100) < c.errorPercent
+		if !delay && !fail {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := unmatchedRoute
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			name = route.Name
+		}
+
+		if delay {
+			s.metrics.chaos.Inc(name, "latency")
+			w.Header().Add(ChaosHeader, "latency")
+			timer := time.NewTimer(c.latency)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if fail {
+			s.metrics.chaos.Inc(name, "error")
+			w.Header().Add(ChaosHeader, "error")
+			p := problem.New(http.StatusInternalServerError, i18n.T(r.Context(), "error.injected"))
+			p.Type, p.Title = TypeInjectedFault, "Injected fault"
+			problem.Write(w, r, p)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) chaosHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var req ChaosRequest
+		if err := validate.DecodeJSON(w, r, &req, 1<<10); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		c := s.chaos()
+		if req.LatencyMs != nil {
+			c.latency = time.Duration(*req.LatencyMs) * time.Millisecond
+		}
+		if req.LatencyPercent != nil {
+			c.latencyPercent = *req.LatencyPercent
+		}
+		if req.ErrorPercent != nil {
+			c.errorPercent = *req.ErrorPercent
+		}
+		s.chaosOverride.Store(&chaosOverride{settings: c, since: time.Now()})
+		log.Printf("Warning: chaos overridden by admin request: %s latency on %d%% of requests, errors on %d%%",
+			c.latency, c.latencyPercent, c.errorPercent)
+		s.recorder.Eventf(eventTypeWarning, reasonChaosChanged, "Chaos overridden: %s latency on %d%% of requests, errors on %d%%",
+			c.latency, c.latencyPercent, c.errorPercent)
+	case http.MethodDelete:
+		if s.chaosOverride.Swap(nil) != nil {
+			log.Printf("Chaos override removed by admin request; back to the configured settings")
+			s.recorder.Eventf(eventTypeNormal, reasonChaosChanged, "Chaos override removed; back to the configured settings")
+		}
+	}
+
+	c := s.chaos()
+	resp := ChaosResponse{
+		Source:         "config",
+		LatencyMs:      c.latency.Milliseconds(),
+		LatencyPercent: c.latencyPercent,
+		ErrorPercent:   c.errorPercent,
+	}
+	if o := s.chaosOverride.Load(); o != nil {
+		resp.Source, resp.Since = "override", o.since.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding chaos response: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// compressor gzips responses for clients that accept it, when the body
+// reaches minBytes and its content type is allowed. Smaller bodies aren't
+// worth the CPU and the gzip overhead.
+type compressor struct {
+	minBytes int
+	types    map[string]bool
+	metrics  *httpMetrics
+	writers  sync.Pool
+}
+
+func newCompressor(cfg config.Config, m *httpMetrics) *compressor {
+	c := &compressor{minBytes: int(cfg.CompressionMinBytes), types: make(map[string]bool), metrics: m}
+	for _, t := range cfg.CompressionTypes {
+		c.types[strings.ToLower(t)] = true
+	}
+	return c
+}
+
+// allows reports whether responses of contentType are compressed.
+func (c *compressor) allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && c.types[mediaType]
+}
+
+func (c *compressor) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if r.Method == http.MethodHead || !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w, c: c}
+		next.ServeHTTP(gw, r)
+		// Not deferred: after a panic, the recover middleware writes the
+		// error response in place of the buffered body.
+		gw.close(r)
+	})
+}
+
+// acceptsGzip reports whether an Accept-Encoding header accepts gzip, by
+// name or with "*", and doesn't refuse it with q=0.
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "gzip" && coding != "x-gzip" && coding != "*" {
+			continue
+		}
+		q := 1.0
+		if name, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(name) == "q" {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = parsed
+			}
+		}
+		return q > 0
+	}
+	return false
+}
+
+// gzipWriter holds back the start of the body until it knows whether to
+// compress: when minBytes have been written, the handler returns or it
+// flushes.
+type gzipWriter struct {
+	http.ResponseWriter
+	c       *compressor
+	code    int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+	in      int64
+	out     countingWriter
+}
+
+// countingWriter counts the compressed bytes on their way to the client.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
+
+func (gw *gzipWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		gw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if gw.decided || gw.code != 0 {
+		return
+	}
+	gw.code = code
+	if code == http.StatusNoContent || code == http.StatusNotModified {
+		gw.decide(false)
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if !gw.decided {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < gw.c.minBytes {
+			return len(b), nil
+		}
+		if err := gw.decide(true); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if gw.gz != nil {
+		gw.in += int64(len(b))
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// decide writes the header, compressed if the body is large enough and of
+// an allowed type, and the buffered start of the body.
+func (gw *gzipWriter) decide(large bool) error {
+	gw.decided = true
+	h := gw.ResponseWriter.Header()
+	if h.Get("Content-Type") == "" && len(gw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(gw.buf))
+	}
+	if large && h.Get("Content-Encoding") == "" && gw.c.allows(h.Get("Content-Type")) {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", "gzip")
+		gw.out.w = gw.ResponseWriter
+		if gz, ok := gw.c.writers.Get().(*gzip.Writer); ok {
+			gz.Reset(&gw.out)
+			gw.gz = gz
+		} else {
+			gw.gz = gzip.NewWriter(&gw.out)
+		}
+	}
+	if gw.code == 0 {
+		gw.code = http.StatusOK
+	}
+	gw.ResponseWriter.WriteHeader(gw.code)
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := gw.Write(buf)
+	return err
+}
+
+// close writes what's still buffered and ends the gzip stream, recording
+// the compression ratio of the response.
+func (gw *gzipWriter) close(r *http.Request) {
+	if !gw.decided {
+		if gw.code == 0 && len(gw.buf) == 0 {
+			return
+		}
+		_ = gw.decide(false)
+	}
+	if gw.gz == nil {
+		return
+	}
+	_ = gw.gz.Close()
+	gw.gz.Reset(io.Discard)
+	gw.c.writers.Put(gw.gz)
+	gw.gz = nil
+
+	name := unmatchedRoute
+	if route, ok := router.RouteFromContext(r.Context()); ok {
+		name = route.Name
+	}
+	m := gw.c.metrics
+	m.compressedIn.Add(float64(gw.in), name)
+	m.compressedOut.Add(float64(gw.out.n), name)
+	if gw.out.n > 0 {
+		m.compressionRatio.Observe(float64(gw.in)/float64(gw.out.n), name)
+	}
+}
+
+// FlushError sends what has been written so far, uncompressed if the
+// handler flushes before the compression threshold, as streams do.
+func (gw *gzipWriter) FlushError() error {
+	if !gw.decided {
+		if err := gw.decide(false); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		if err := gw.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+)
+
+// corsExposedHeaders are the response headers scripts on other origins may
+// read besides the CORS-safelisted ones.
+var corsExposedHeaders = strings.Join([]string{requestid.Header, apiversion.Header, "Retry-After", "Deprecation", "Sunset", "Link", "X-Track"}, ", ")
+
+// corsPolicy lets browser frontends served from other origins call the API
+// and the browser routes. Credentials aren't allowed, so browsers don't
+// send cookies, like the status page's session, on cross-origin calls.
+// Bearer tokens, the API's JWTs and the admin token gitops-promote takes,
+// are safe to allow: browsers never attach them on their own, so a script
+// has to hold one to send it, and an allowed origin gains nothing a caller
+// elsewhere couldn't do with the same token.
+type corsPolicy struct {
+	anyOrigin bool
+	origins   map[string]bool
+	methods   string
+	headers   string
+	maxAge    string
+}
+
+func newCORSPolicy(cfg config.Config) *corsPolicy {
+	c := &corsPolicy{
+		origins: make(map[string]bool, len(cfg.CORSAllowedOrigins)),
+		methods: strings.Join(cfg.CORSAllowedMethods, ", "),
+		headers: strings.Join(cfg.CORSAllowedHeaders, ", "),
+		maxAge:  strconv.Itoa(int(cfg.CORSMaxAge.Seconds())),
+	}
+	for _, origin := range cfg.CORSAllowedOrigins {
+		if origin == "*" {
+			c.anyOrigin = true
+		}
+		c.origins[strings.ToLower(strings.TrimSuffix(origin, "/"))] = true
+	}
+	return c
+}
+
+func (c *corsPolicy) enabled() bool {
+	return len(c.origins) > 0
+}
+
+func (c *corsPolicy) allows(origin string) bool {
+	return c.anyOrigin || c.origins[strings.ToLower(origin)]
+}
+
+// middleware adds the CORS headers to responses to allowed origins and
+// answers their preflight requests itself; no route handles OPTIONS. Other
+// origins get responses without the headers, which browsers then refuse to
+// hand to the calling script.
+func (c *corsPolicy) middleware(next http.Handler) http.Handler {
+	if !c.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" || !c.allows(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.anyOrigin {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", c.methods)
+			h.Set("Access-Control-Allow-Headers", c.headers)
+			h.Set("Access-Control-Max-Age", c.maxAge)
+			h.Del("Allow")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+		next.ServeHTTP(w, r)
+	})
+}
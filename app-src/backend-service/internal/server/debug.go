@@ -0,0 +1,77 @@
+package server
+
+import (
+	"expvar"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"time"
+)
+
+// debugHandler serves the admin listener on ADMIN_PORT: profiling and
+// runtime diagnostics that must not be reachable through the Service, plus
+// the probe and metrics endpoints so operators and Prometheus need only
+// this port. It has no token check; the port is only reachable inside the
+// cluster and isn't part of the Service.
+func (s *Server) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	for _, path := range []string{"/health", "/healthz", "/ready", "/readyz", "/startupz", "/metrics"} {
+		mux.Handle(path, s.handler)
+	}
+	// The preStop hook, which the public port refuses
+	mux.Handle("/admin/prestop", fromAdminListener(s.handler))
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.HandleFunc("/debug/goroutines", goroutineDumpHandler)
+	mux.HandleFunc("/debug/heapdump", heapDumpHandler)
+	return mux
+}
+
+// goroutineDumpHandler writes the stacks of all goroutines in the format of
+// an unrecovered panic, the quickest way to see what a stuck pod is doing.
+func goroutineDumpHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := rpprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		log.Printf("Error writing goroutine dump: %v", err)
+	}
+}
+
+// heapDumpHandler streams a full heap dump (runtime/debug.WriteHeapDump),
+// which stops the world while it is written. Unlike the sampled heap
+// profile at /debug/pprof/heap, it holds every object.
+func heapDumpHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST to take a heap dump: it pauses the process", http.StatusMethodNotAllowed)
+		return
+	}
+	f, err := os.CreateTemp("", "heapdump-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	start := time.Now()
+	debug.WriteHeapDump(f.Fd())
+	log.Printf("Wrote heap dump in %s", time.Since(start).Round(time.Millisecond))
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=heapdump-%s", start.UTC().Format("20060102T150405Z")))
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("Error sending heap dump: %v", err)
+	}
+}
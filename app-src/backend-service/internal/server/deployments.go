@@ -0,0 +1,248 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// Senders of deployment events.
+const (
+	deploymentSourceFlux   = "flux"
+	deploymentSourceArgoCD = "argocd"
+)
+
+// Severities of deployment events, as Flux names them.
+const (
+	severityInfo  = "info"
+	severityError = "error"
+)
+
+// DeploymentEvent is a notification of a GitOps controller about the
+// reconciliation of the service's manifests. IDs are unique to the replica
+// that received it.
+type DeploymentEvent struct {
+	ID int64 `json:"id"`
+	// flux or argocd
+	Source string `json:"source"`
+	// Kind/namespace/name of the reconciled object, like
+	// Kustomization/flux-system/apps or Application/argocd/dev-backend-service
+	Object   string `json:"object"`
+	Revision string `json:"revision,omitempty"`
+	// Flux's reason, like ReconciliationSucceeded, or the phase of the Argo
+	// CD sync, like Succeeded
+	Reason string `json:"reason"`
+	// info or error
+	Severity string `json:"severity"`
+	Message  string `json:"message,omitempty"`
+	// When the controller reported it, and when this replica received it
+	Time       string `json:"time"`
+	ReceivedAt string `json:"received_at"`
+}
+
+// fluxEvent is the part of a Flux notification-controller event the
+// webhook reads; the generic-hmac provider posts it signed in X-Signature.
+type fluxEvent struct {
+	InvolvedObject struct {
+		Kind      string `json:"kind"`
+		Namespace string `json:"namespace"`
+		Name      string `json:"name"`
+	} `json:"involvedObject"`
+	Severity  string            `json:"severity"`
+	Timestamp string            `json:"timestamp"`
+	Message   string            `json:"message"`
+	Reason    string            `json:"reason"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// argoNotification is the body of the Argo CD notification template the
+// README documents.
+type argoNotification struct {
+	Application  string `json:"application"`
+	Namespace    string `json:"namespace"`
+	Revision     string `json:"revision"`
+	Phase        string `json:"phase"`
+	SyncStatus   string `json:"sync_status"`
+	HealthStatus string `json:"health_status"`
+	Message      string `json:"message"`
+	FinishedAt   string `json:"finished_at"`
+}
+
+// parseDeploymentEvent reads a Flux event or an Argo CD notification.
+func parseDeploymentEvent(body []byte) (DeploymentEvent, error) {
+	var probe struct {
+		InvolvedObject *json.RawMessage `json:"involvedObject"`
+		Application    string           `json:"application"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return DeploymentEvent{}, err
+	}
+	switch {
+	case probe.InvolvedObject != nil:
+		var e fluxEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			return DeploymentEvent{}, err
+		}
+		o := e.InvolvedObject
+		if o.Kind == "" || o.Name == "" || e.Reason == "" {
+			return DeploymentEvent{}, errors.New("event without the kind and name of its involvedObject, or a reason")
+		}
+		event := DeploymentEvent{
+			Source:   deploymentSourceFlux,
+			Object:   o.Kind + "/" + o.Namespace + "/" + o.Name,
+			Revision: e.Metadata["revision"],
+			Reason:   e.Reason,
+			Severity: e.Severity,
+			Message:  e.Message,
+			Time:     e.Timestamp,
+		}
+		if event.Severity != severityError {
+			event.Severity = severityInfo
+		}
+		return event, nil
+	case probe.Application != "":
+		var n argoNotification
+		if err := json.Unmarshal(body, &n); err != nil {
+			return DeploymentEvent{}, err
+		}
+		namespace := n.Namespace
+		if namespace == "" {
+			namespace = "argocd"
+		}
+		event := DeploymentEvent{
+			Source:   deploymentSourceArgoCD,
+			Object:   "Application/" + namespace + "/" + n.Application,
+			Revision: n.Revision,
+			Reason:   n.Phase,
+			Severity: severityInfo,
+			Message:  n.Message,
+			Time:     n.FinishedAt,
+		}
+		if event.Reason == "" {
+			event.Reason = n.SyncStatus
+		}
+		if n.Phase == "Failed" || n.Phase == "Error" || n.HealthStatus == "Degraded" {
+			event.Severity = severityError
+		}
+		return event, nil
+	}
+	return DeploymentEvent{}, errors.New("neither a Flux event nor an Argo CD notification")
+}
+
+// deploymentLog keeps the last deployment events this replica received.
+// Each replica keeps its own: the Service spreads the notifications over
+// them, so a timeline should be read from the replica that receives them,
+// or from a single-replica deployment.
+type deploymentLog struct {
+	secret   string
+	capacity int
+
+	mu     sync.Mutex
+	seq    int64
+	events []DeploymentEvent
+}
+
+func newDeploymentLog(cfg config.Config) *deploymentLog {
+	capacity := cfg.DeploymentEventsMax
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &deploymentLog{secret: cfg.GitOpsWebhookSecret, capacity: capacity}
+}
+
+// add stamps e with its ID and receipt time and keeps it.
+func (d *deploymentLog) add(e DeploymentEvent) DeploymentEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.seq++
+	e.ID = d.seq
+	e.ReceivedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	if e.Time == "" {
+		e.Time = e.ReceivedAt
+	}
+	d.events = append(d.events, e)
+	if len(d.events) > d.capacity {
+		d.events = d.events[len(d.events)-d.capacity:]
+	}
+	return e
+}
+
+// recent returns up to limit events of the object, newest first; an empty
+// object matches every event.
+func (d *deploymentLog) recent(limit int, object string) []DeploymentEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	out := []DeploymentEvent{}
+	for i := len(d.events) - 1; i >= 0 && len(out) < limit; i-- {
+		if object == "" || strings.EqualFold(d.events[i].Object, object) {
+			out = append(out, d.events[i])
+		}
+	}
+	return out
+}
+
+// webhookHandler serves /webhooks/gitops: it answers 202 with the event
+// it recorded, 503 when GITOPS_WEBHOOK_SECRET isn't set.
+func (d *deploymentLog) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if d.secret == "" {
+		problem.Error(w, r, i18n.T(ctx, "error.gitops_webhook_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := readSignedWebhook(w, r, d.secret, "X-Signature")
+	if !ok {
+		return
+	}
+	event, err := parseDeploymentEvent(body)
+	if err != nil {
+		problem.Error(w, r, i18n.T(ctx, "error.webhook_payload", err), http.StatusBadRequest)
+		return
+	}
+	event = d.add(event)
+	log.Printf("Deployment event from %s: %s %s %s", event.Source, event.Object, event.Reason, event.Revision)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		log.Printf("Error encoding deployment event: %v", err)
+	}
+}
+
+type DeploymentsRequest struct {
+	Limit int `query:"limit" validate:"min=1,max=1000"`
+	// Kind/namespace/name of the object whose events to list
+	Object string `query:"object"`
+}
+
+// DeploymentsResponse is the response of /api/v1/deployments: the
+// deployment events this replica received, newest first, for a rollout
+// timeline.
+type DeploymentsResponse struct {
+	Replica string            `json:"replica"`
+	Events  []DeploymentEvent `json:"events"`
+}
+
+// handler serves /api/v1/deployments.
+func (d *deploymentLog) handler(replica string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := DeploymentsRequest{Limit: 100}
+		if err := validate.DecodeQuery(r, &req); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		resp := DeploymentsResponse{Replica: replica, Events: d.recent(req.Limit, req.Object)}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding deployments response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const serviceNameLabel = "kubernetes.io/service-name"
+
+type service struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		ClusterIP string        `json:"clusterIP"`
+		Ports     []servicePort `json:"ports"`
+	} `json:"spec"`
+}
+
+type servicePort struct {
+	Name     string `json:"name,omitempty"`
+	Port     int32  `json:"port"`
+	Protocol string `json:"protocol,omitempty"`
+}
+
+type endpointSlice struct {
+	Metadata  k8sclient.ObjectMeta `json:"metadata"`
+	Endpoints []struct {
+		Addresses  []string `json:"addresses"`
+		Conditions struct {
+			Ready *bool `json:"ready"`
+		} `json:"conditions"`
+		TargetRef *struct {
+			Name string `json:"name"`
+		} `json:"targetRef"`
+		Zone string `json:"zone"`
+	} `json:"endpoints"`
+}
+
+type ServiceEndpoint struct {
+	Address string `json:"address"`
+	Ready   bool   `json:"ready"`
+	Pod     string `json:"pod,omitempty"`
+	Zone    string `json:"zone,omitempty"`
+}
+
+type ServiceDependency struct {
+	Name           string            `json:"name"`
+	Namespace      string            `json:"namespace"`
+	Found          bool              `json:"found"`
+	URL            string            `json:"url,omitempty"`
+	ClusterIP      string            `json:"cluster_ip,omitempty"`
+	Ports          []servicePort     `json:"ports,omitempty"`
+	Endpoints      []ServiceEndpoint `json:"endpoints"`
+	ReadyEndpoints int               `json:"ready_endpoints"`
+	Ready          bool              `json:"ready"`
+}
+
+type DependenciesResponse struct {
+	Services         []ServiceDependency     `json:"services"`
+	Volumes          []VolumeStatus          `json:"volumes"`
+	EphemeralStorage *EphemeralStorageStatus `json:"ephemeral_storage,omitempty"`
+}
+
+// serviceDiscovery resolves the configured sibling Services through the
+// Kubernetes API, so their addresses don't have to be hardcoded per
+// environment. Services and their EndpointSlices are kept up to date with
+// informers.
+type serviceDiscovery struct {
+	client    *k8sclient.Client
+	namespace string
+	names     []string
+
+	mu     sync.RWMutex
+	svcs   map[string]service
+	slices map[string]endpointSlice
+}
+
+func newServiceDiscovery(client *k8sclient.Client, namespace string, names []string) *serviceDiscovery {
+	return &serviceDiscovery{
+		client:    client,
+		namespace: namespace,
+		names:     names,
+		svcs:      make(map[string]service),
+		slices:    make(map[string]endpointSlice),
+	}
+}
+
+func (sd *serviceDiscovery) run(ctx context.Context) {
+	if len(sd.names) == 0 {
+		return
+	}
+	log.Printf("Discovering sibling services in %s: %s", sd.namespace, strings.Join(sd.names, ", "))
+
+	go sd.client.ListWatch(ctx,
+		fmt.Sprintf("/api/v1/namespaces/%s/services", sd.namespace),
+		url.Values{},
+		sd.syncServices, sd.onServiceEvent)
+
+	sd.client.ListWatch(ctx,
+		fmt.Sprintf("/apis/discovery.k8s.io/v1/namespaces/%s/endpointslices", sd.namespace),
+		url.Values{"labelSelector": {fmt.Sprintf("%s in (%s)", serviceNameLabel, strings.Join(sd.names, ","))}},
+		sd.syncSlices, sd.onSliceEvent)
+}
+
+func (sd *serviceDiscovery) wanted(name string) bool {
+	for _, n := range sd.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (sd *serviceDiscovery) syncServices(items []json.RawMessage) {
+	sd.mu.Lock()
+	sd.svcs = make(map[string]service)
+	sd.mu.Unlock()
+	for _, raw := range items {
+		sd.onServiceEvent(k8sclient.WatchEvent{Type: "ADDED", Object: raw})
+	}
+}
+
+func (sd *serviceDiscovery) onServiceEvent(event k8sclient.WatchEvent) {
+	var svc service
+	if err := json.Unmarshal(event.Object, &svc); err != nil {
+		log.Printf("Error decoding service event: %v", err)
+		return
+	}
+	if !sd.wanted(svc.Metadata.Name) {
+		return
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if event.Type == "DELETED" {
+		delete(sd.svcs, svc.Metadata.Name)
+		return
+	}
+	sd.svcs[svc.Metadata.Name] = svc
+}
+
+func (sd *serviceDiscovery) syncSlices(items []json.RawMessage) {
+	sd.mu.Lock()
+	sd.slices = make(map[string]endpointSlice)
+	sd.mu.Unlock()
+	for _, raw := range items {
+		sd.onSliceEvent(k8sclient.WatchEvent{Type: "ADDED", Object: raw})
+	}
+}
+
+func (sd *serviceDiscovery) onSliceEvent(event k8sclient.WatchEvent) {
+	var slice endpointSlice
+	if err := json.Unmarshal(event.Object, &slice); err != nil {
+		log.Printf("Error decoding endpointslice event: %v", err)
+		return
+	}
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	if event.Type == "DELETED" {
+		delete(sd.slices, slice.Metadata.Name)
+		return
+	}
+	sd.slices[slice.Metadata.Name] = slice
+}
+
+// list fetches the configured Services once, for callers that need them
+// without running the informers.
+func (sd *serviceDiscovery) list(ctx context.Context) error {
+	if sd.client == nil {
+		return fmt.Errorf("no Kubernetes API access")
+	}
+	var out struct {
+		Items []json.RawMessage `json:"items"`
+	}
+	if err := sd.client.Do(ctx, http.MethodGet, fmt.Sprintf("/api/v1/namespaces/%s/services", sd.namespace), nil, &out); err != nil {
+		return err
+	}
+	sd.syncServices(out.Items)
+	return nil
+}
+
+// dependencies returns the current view of every configured sibling.
+func (sd *serviceDiscovery) dependencies() []ServiceDependency {
+	sd.mu.RLock()
+	defer sd.mu.RUnlock()
+
+	deps := make([]ServiceDependency, 0, len(sd.names))
+	for _, name := range sd.names {
+		dep := ServiceDependency{Name: name, Namespace: sd.namespace, Endpoints: []ServiceEndpoint{}}
+		if svc, ok := sd.svcs[name]; ok {
+			dep.Found = true
+			dep.ClusterIP = svc.Spec.ClusterIP
+			dep.Ports = svc.Spec.Ports
+			host := fmt.Sprintf("%s.%s.svc", name, sd.namespace)
+			if len(svc.Spec.Ports) > 0 {
+				host = net.JoinHostPort(host, strconv.Itoa(int(svc.Spec.Ports[0].Port)))
+			}
+			dep.URL = "http://" + host
+		}
+
+		for _, slice := range sd.slices {
+			if slice.Metadata.Labels[serviceNameLabel] != name {
+				continue
+			}
+			for _, ep := range slice.Endpoints {
+				// A nil ready condition means ready, per the EndpointSlice API.
+				ready := ep.Conditions.Ready == nil || *ep.Conditions.Ready
+				for _, addr := range ep.Addresses {
+					endpoint := ServiceEndpoint{Address: addr, Ready: ready, Zone: ep.Zone}
+					if ep.TargetRef != nil {
+						endpoint.Pod = ep.TargetRef.Name
+					}
+					dep.Endpoints = append(dep.Endpoints, endpoint)
+					if ready {
+						dep.ReadyEndpoints++
+					}
+				}
+			}
+		}
+		sort.Slice(dep.Endpoints, func(i, j int) bool {
+			return dep.Endpoints[i].Address < dep.Endpoints[j].Address
+		})
+		dep.Ready = dep.Found && dep.ReadyEndpoints > 0
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+func dependenciesHandler(sd *serviceDiscovery, storage *storageMonitor) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		resp := DependenciesResponse{Services: sd.dependencies()}
+		volumes, usage := storage.status()
+		resp.Volumes = volumes
+		if len(storage.paths) > 0 {
+			resp.EphemeralStorage = &usage
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding dependencies response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+// Disruption kinds, derived from the pod's DisruptionTarget condition,
+// deletion state and the node's cordon flag.
+const (
+	disruptionEviction     = "eviction"
+	disruptionPreemption   = "preemption"
+	disruptionNodeDrain    = "node-drain"
+	disruptionTaint        = "taint-eviction"
+	disruptionNodePressure = "node-pressure"
+	disruptionDeletion     = "deletion"
+	disruptionUnknown      = "unknown"
+)
+
+type podStatus struct {
+	Metadata struct {
+		DeletionTimestamp string `json:"deletionTimestamp"`
+	} `json:"metadata"`
+	Status struct {
+		Reason     string `json:"reason"`
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		ContainerStatuses []struct {
+			Name         string `json:"name"`
+			RestartCount int32  `json:"restartCount"`
+			LastState    struct {
+				Terminated *struct {
+					ExitCode   int32  `json:"exitCode"`
+					Reason     string `json:"reason"`
+					FinishedAt string `json:"finishedAt"`
+				} `json:"terminated"`
+			} `json:"lastState"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type nodeSpec struct {
+	Spec struct {
+		Unschedulable bool `json:"unschedulable"`
+	} `json:"spec"`
+}
+
+type TerminationInfo struct {
+	Reason     string `json:"reason"`
+	ExitCode   int32  `json:"exit_code"`
+	FinishedAt string `json:"finished_at,omitempty"`
+}
+
+type DisruptionInfo struct {
+	Kind      string `json:"kind"`
+	Voluntary bool   `json:"voluntary"`
+	Trigger   string `json:"trigger"`
+	Detail    string `json:"detail,omitempty"`
+	At        string `json:"at"`
+}
+
+type DisruptionsResponse struct {
+	RestartCount    int32            `json:"restart_count"`
+	LastTermination *TerminationInfo `json:"last_termination,omitempty"`
+	Current         *DisruptionInfo  `json:"current,omitempty"`
+	Counts          map[string]int64 `json:"counts"`
+}
+
+// disruptionTracker tells voluntary disruptions (evictions, drains,
+// rollouts) apart from crashes. At startup it records why the previous
+// container instance terminated; on preStop or SIGTERM it classifies the
+// pending termination from the pod and node state.
+type disruptionTracker struct {
+	client    *k8sclient.Client
+	recorder  *eventRecorder
+	namespace string
+	podName   string
+	nodeName  string
+	container string
+
+	once sync.Once
+	mu   sync.RWMutex
+	resp DisruptionsResponse
+}
+
+func newDisruptionTracker(client *k8sclient.Client, recorder *eventRecorder, namespace, podName, nodeName, container string) *disruptionTracker {
+	return &disruptionTracker{
+		client:    client,
+		recorder:  recorder,
+		namespace: namespace,
+		podName:   podName,
+		nodeName:  nodeName,
+		container: container,
+		resp:      DisruptionsResponse{Counts: map[string]int64{}},
+	}
+}
+
+// recordPreviousTermination inspects the container's lastState so restarts
+// caused by crashes or OOM kills are visible after the fact.
+func (dt *disruptionTracker) recordPreviousTermination(ctx context.Context) {
+	if dt.client == nil {
+		return
+	}
+	var p podStatus
+	if err := podInformer(dt.client, dt.namespace, dt.podName).GetOrFetch(ctx, dt.podName, &p); err != nil {
+		log.Printf("Error reading pod status: %v", err)
+		return
+	}
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name != dt.container {
+			continue
+		}
+		dt.mu.Lock()
+		dt.resp.RestartCount = cs.RestartCount
+		if t := cs.LastState.Terminated; t != nil {
+			dt.resp.LastTermination = &TerminationInfo{Reason: t.Reason, ExitCode: t.ExitCode, FinishedAt: t.FinishedAt}
+			dt.resp.Counts["restart:"+t.Reason]++
+		}
+		last := dt.resp.LastTermination
+		dt.mu.Unlock()
+
+		if last != nil {
+			log.Printf("Container restarted (restart #%d): previous instance terminated with %s, exit code %d",
+				cs.RestartCount, last.Reason, last.ExitCode)
+			dt.recorder.Eventf(eventTypeWarning, reasonContainerRestarted,
+				"Previous instance terminated with %s (exit code %d), restart #%d", last.Reason, last.ExitCode, cs.RestartCount)
+		}
+	}
+}
+
+// onTermination classifies the disruption the first time it is called, from
+// either the preStop hook or SIGTERM, and records it as an Event.
+func (dt *disruptionTracker) onTermination(ctx context.Context, trigger string) {
+	dt.once.Do(func() {
+		info := dt.classify(ctx)
+		info.Trigger = trigger
+		info.At = time.Now().UTC().Format(time.RFC3339)
+
+		dt.mu.Lock()
+		dt.resp.Current = &info
+		dt.resp.Counts[info.Kind]++
+		dt.mu.Unlock()
+
+		log.Printf("Termination via %s classified as %s (voluntary=%t): %s", trigger, info.Kind, info.Voluntary, info.Detail)
+		eventType := eventTypeNormal
+		if !info.Voluntary {
+			eventType = eventTypeWarning
+		}
+		dt.recorder.Eventf(eventType, reasonDisruptionDetected, "%s disruption (%s): %s", info.Kind, trigger, info.Detail)
+	})
+}
+
+func (dt *disruptionTracker) classify(ctx context.Context) DisruptionInfo {
+	if dt.client == nil {
+		return DisruptionInfo{Kind: disruptionUnknown, Detail: "no Kubernetes API access"}
+	}
+	// Read the pod directly: the DisruptionTarget condition is set moments
+	// before SIGTERM and may not have reached the informer cache yet.
+	var p podStatus
+	if err := dt.client.Do(ctx, http.MethodGet,
+		fmt.Sprintf("/api/v1/namespaces/%s/pods/%s", dt.namespace, dt.podName), nil, &p); err != nil {
+		return DisruptionInfo{Kind: disruptionUnknown, Detail: err.Error()}
+	}
+
+	// Set by the control plane since Kubernetes 1.26 before it deletes a pod.
+	for _, c := range p.Status.Conditions {
+		if c.Type != "DisruptionTarget" || c.Status != "True" {
+			continue
+		}
+		switch c.Reason {
+		case "EvictionByEvictionAPI":
+			if dt.nodeCordoned(ctx) {
+				return DisruptionInfo{Kind: disruptionNodeDrain, Voluntary: true, Detail: c.Message}
+			}
+			return DisruptionInfo{Kind: disruptionEviction, Voluntary: true, Detail: c.Message}
+		case "PreemptionByScheduler", "PreemptionByKubeScheduler":
+			return DisruptionInfo{Kind: disruptionPreemption, Voluntary: true, Detail: c.Message}
+		case "DeletionByTaintManager":
+			return DisruptionInfo{Kind: disruptionTaint, Detail: c.Message}
+		case "TerminationByKubelet":
+			return DisruptionInfo{Kind: disruptionNodePressure, Detail: c.Message}
+		}
+	}
+
+	if p.Metadata.DeletionTimestamp != "" {
+		if dt.nodeCordoned(ctx) {
+			return DisruptionInfo{Kind: disruptionNodeDrain, Voluntary: true, Detail: "pod deleted on cordoned node " + dt.nodeName}
+		}
+		return DisruptionInfo{Kind: disruptionDeletion, Voluntary: true, Detail: "pod deleted (rollout, scale-down or manual delete)"}
+	}
+	return DisruptionInfo{Kind: disruptionUnknown, Detail: "SIGTERM without pod deletion"}
+}
+
+func (dt *disruptionTracker) nodeCordoned(ctx context.Context) bool {
+	if dt.nodeName == "" {
+		return false
+	}
+	var n nodeSpec
+	if err := nodeInformer(dt.client, dt.nodeName).GetOrFetch(ctx, dt.nodeName, &n); err != nil {
+		return false
+	}
+	return n.Spec.Unschedulable
+}
+
+func (dt *disruptionTracker) handler(w http.ResponseWriter, _ *http.Request) {
+	dt.mu.RLock()
+	resp := dt.resp
+	counts := make(map[string]int64, len(resp.Counts))
+	for k, v := range resp.Counts {
+		counts[k] = v
+	}
+	resp.Counts = counts
+	dt.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding disruptions response: %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/downstream"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+)
+
+// CallResponse is the response of /api/v1/call: what the downstream
+// service answered and what it took to get it.
+type CallResponse struct {
+	URL       string  `json:"url"`
+	Status    int     `json:"status"`
+	Attempts  int     `json:"attempts"`
+	LatencyMs float64 `json:"latency_ms"`
+	// State of the host's circuit breaker after the call
+	Breaker       string `json:"breaker"`
+	Body          string `json:"body"`
+	BodyTruncated bool   `json:"body_truncated,omitempty"`
+	// The body, decoded, when it is JSON
+	JSON any `json:"json,omitempty"`
+}
+
+// validDownstreamURL checks an absolute http(s) URL of a downstream
+// service.
+func validDownstreamURL(raw string) error {
+	if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid downstream URL %q", raw)
+	}
+	return nil
+}
+
+// newDownstreamClient returns the client of outbound calls to other
+// services, which carry the request's ID and trace and are counted by
+// host in /metrics.
+func (s *Server) newDownstreamClient(cfg config.Config) *downstream.Client {
+	c := downstream.New(downstream.Config{
+		Timeout:             cfg.DownstreamTimeout,
+		Retries:             cfg.DownstreamRetries,
+		Backoff:             cfg.DownstreamRetryBackoff,
+		BreakerFailures:     cfg.DownstreamBreakerFailures,
+		BreakerCooldown:     cfg.DownstreamBreakerCooldown,
+		MaxIdleConnsPerHost: cfg.DownstreamMaxIdleConnsPerHost,
+	}, func(rt http.RoundTripper) http.RoundTripper {
+		return requestid.Transport(s.tracer.Transport(rt))
+	})
+	c.OnAttempt = func(host, outcome string, d time.Duration) {
+		s.metrics.downstreamRequests.Inc(host, outcome)
+		if outcome != downstream.OutcomeRejected {
+			s.metrics.downstreamDuration.Observe(d.Seconds(), host)
+		}
+	}
+	c.OnStateChange = func(host string, from, to downstream.State) {
+		s.metrics.downstreamBreaker.Inc(host, string(to))
+		if to == downstream.StateOpen {
+			log.Printf("Warning: circuit breaker for %s opened; failing fast for %s", host, cfg.DownstreamBreakerCooldown)
+		} else {
+			log.Printf("Circuit breaker for %s is %s (was %s)", host, to, from)
+		}
+	}
+	return c
+}
+
+// callHandler fetches DOWNSTREAM_URL and reports the answer. Failures
+// propagate: a downstream 5xx or an unreachable service is a 502, and an
+// open breaker a 503 with Retry-After.
+func (s *Server) callHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	target := s.cfg.DownstreamURL
+	if target == "" {
+		problem.Error(w, r, i18n.T(ctx, "error.downstream_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	resp, failure := s.call(ctx, target)
+	if failure != nil {
+		if failure.retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(failure.retryAfter.Seconds()))))
+		}
+		problem.Error(w, r, failure.detail, failure.status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding call response: %v", err)
+	}
+}
+
+// callFailure is why a downstream call failed, localized, and the status
+// to answer with.
+type callFailure struct {
+	status     int
+	detail     string
+	retryAfter time.Duration
+}
+
+// call makes a GET request to target. It fails when the host is
+// unreachable, answers 5xx after the retries, or its breaker is open.
+func (s *Server) call(ctx context.Context, target string) (CallResponse, *callFailure) {
+	res, err := s.downstream.Do(ctx, downstream.Request{URL: target, Header: http.Header{"Accept": {"application/json"}}})
+	host := target
+	if u, perr := url.Parse(target); perr == nil {
+		host = u.Host
+	}
+	resp := CallResponse{
+		URL:       config.Redact("DOWNSTREAM_URL", target),
+		Status:    res.Status,
+		Attempts:  res.Attempts,
+		LatencyMs: float64(res.Duration.Microseconds()) / 1000,
+		Breaker:   string(s.downstream.State(host)),
+	}
+	var open *downstream.OpenError
+	switch {
+	case errors.As(err, &open):
+		return resp, &callFailure{http.StatusServiceUnavailable, i18n.T(ctx, "error.circuit_open", host), open.RetryAfter}
+	case err != nil:
+		return resp, &callFailure{http.StatusBadGateway, i18n.T(ctx, "error.downstream", host, err), 0}
+	case res.Status >= 500:
+		return resp, &callFailure{http.StatusBadGateway, i18n.T(ctx, "error.downstream_status", host, res.Status), 0}
+	}
+
+	resp.Body, resp.BodyTruncated = string(res.Body), res.Truncated
+	var decoded any
+	if !res.Truncated && json.Unmarshal(res.Body, &decoded) == nil {
+		resp.JSON = decoded
+	}
+	return resp, nil
+}
+
+// ChainResponse is the response of /api/v1/chain: every hop of the chain
+// in order, with its latency, and the latency of the whole chain.
+type ChainResponse struct {
+	Hops      []ChainHop `json:"hops"`
+	LatencyMs float64    `json:"latency_ms"`
+	// Index of the hop that failed, when one did
+	FailedHop *int `json:"failed_hop,omitempty"`
+}
+
+// ChainHop is one call of a chain. Hops after a failed one are skipped.
+type ChainHop struct {
+	CallResponse
+	Error   string `json:"error,omitempty"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// chainHandler calls DOWNSTREAM_CHAIN_URLS one after the other and
+// aggregates their answers. Pointing a hop at another replica's
+// /api/v1/chain builds a deeper chain, all in one trace. The first failed
+// hop ends the chain with a 502, so a failure deep in the chain surfaces at
+// every service in front of it.
+func (s *Server) chainHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	targets := s.cfg.DownstreamChainURLs
+	if len(targets) == 0 {
+		problem.Error(w, r, i18n.T(ctx, "error.chain_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	start := time.Now()
+	resp := ChainResponse{Hops: make([]ChainHop, 0, len(targets))}
+	for i, target := range targets {
+		if resp.FailedHop != nil {
+			resp.Hops = append(resp.Hops, ChainHop{CallResponse: CallResponse{URL: config.Redact("DOWNSTREAM_CHAIN_URLS", target)}, Skipped: true})
+			continue
+		}
+		call, failure := s.call(ctx, target)
+		hop := ChainHop{CallResponse: call}
+		if failure != nil {
+			failed := i
+			hop.Error, resp.FailedHop = failure.detail, &failed
+		}
+		resp.Hops = append(resp.Hops, hop)
+	}
+	resp.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.FailedHop != nil {
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding chain response: %v", err)
+	}
+}
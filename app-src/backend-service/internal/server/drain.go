@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// PrestopRequest holds the query parameters of /admin/prestop.
+type PrestopRequest struct {
+	// Overrides PRESTOP_TIMEOUT_SECONDS
+	TimeoutSeconds *int `query:"timeout" validate:"min=0,max=3600"`
+}
+
+type PrestopResponse struct {
+	Status   string `json:"status"`
+	InFlight int64  `json:"in_flight"`
+	Waited   string `json:"waited"`
+}
+
+// DrainResponse is the response of /admin/drain and /admin/undrain.
+type DrainResponse struct {
+	Drained   bool   `json:"drained"`
+	Since     string `json:"since,omitempty"`
+	Readiness string `json:"readiness"`
+	InFlight  int64  `json:"in_flight"`
+}
+
+// adminListenerKey marks the requests of the ADMIN_PORT listener.
+type adminListenerKey struct{}
+
+// fromAdminListener marks the requests next gets as received on the
+// ADMIN_PORT listener.
+func fromAdminListener(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminListenerKey{}, true)))
+	})
+}
+
+// adminListenerOnly hides next behind a 404 unless the request came in on
+// the ADMIN_PORT listener, which the kubelet reaches and the Service
+// doesn't. The preStop hook has no credentials to present, so that's what
+// keeps other clients from draining the pod. The source address proves
+// nothing: a service mesh sidecar forwards every request from loopback.
+func adminListenerOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Context().Value(adminListenerKey{}) == nil {
+			problem.Error(w, r, i18n.T(r.Context(), "error.not_found", r.URL.Path), http.StatusNotFound)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// inFlightMiddleware counts requests in progress so a drain can wait for them.
+func (s *Server) inFlightMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// prestopHandler is called by the container's preStop lifecycle hook. It
+// fails readiness so the endpoints controller stops routing new traffic,
+// then blocks until in-flight requests complete or the deadline passes.
+// The kubelet only sends SIGTERM once this returns.
+func (s *Server) prestopHandler() http.HandlerFunc {
+	minWait, defaultTimeout := s.cfg.PrestopMinWait, s.cfg.PrestopTimeout
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req PrestopRequest
+		if err := validate.DecodeQuery(r, &req); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		timeout := defaultTimeout
+		if req.TimeoutSeconds != nil {
+			timeout = time.Duration(*req.TimeoutSeconds) * time.Second
+		}
+
+		// The drain may outlast the server's WriteTimeout.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + 5*time.Second))
+
+		start := time.Now()
+		s.disruptions.onTermination(r.Context(), "preStop")
+		if s.draining.CompareAndSwap(false, true) {
+			log.Printf("preStop: draining started (min wait %s, timeout %s)", minWait, timeout)
+			s.recorder.Eventf(eventTypeNormal, reasonDrainStarted, "preStop hook started draining %d in-flight requests", s.inFlight.Load()-1)
+		}
+
+		status := "drained"
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			// Exclude this preStop request itself from the count.
+			pending := s.inFlight.Load() - 1
+			elapsed := time.Since(start)
+			if pending <= 0 && elapsed >= minWait {
+				break
+			}
+			if elapsed >= timeout {
+				status = "timeout"
+				break
+			}
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+			}
+		}
+
+		resp := PrestopResponse{
+			Status:   status,
+			InFlight: s.inFlight.Load() - 1,
+			Waited:   time.Since(start).Round(time.Millisecond).String(),
+		}
+		log.Printf("preStop: %s after %s with %d requests in flight", resp.Status, resp.Waited, resp.InFlight)
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding prestop response: %v", err)
+		}
+	}
+}
+
+// drainHandler takes the pod out of the Service endpoints without stopping
+// it, by failing readiness until /admin/undrain; in-flight and direct
+// requests are still served. Unlike a preStop drain it can be undone.
+func (s *Server) drainHandler(w http.ResponseWriter, r *http.Request) {
+	if s.drainedAt.CompareAndSwap(0, time.Now().UnixNano()) {
+		log.Printf("Drained by admin request; failing readiness until undrained")
+		s.recorder.Eventf(eventTypeNormal, reasonManualDrain, "Pod drained by admin request with %d requests in flight", s.inFlight.Load()-1)
+	}
+	s.writeDrainResponse(w, r)
+}
+
+// undrainHandler puts a drained pod back into rotation. A pod shutting down
+// after its preStop hook stays out.
+func (s *Server) undrainHandler(w http.ResponseWriter, r *http.Request) {
+	if s.draining.Load() {
+		problem.Error(w, r, i18n.T(r.Context(), "error.shutting_down"), http.StatusConflict)
+		return
+	}
+	if s.drainedAt.Swap(0) != 0 {
+		log.Printf("Undrained by admin request")
+		s.recorder.Eventf(eventTypeNormal, reasonManualUndrain, "Pod returned to rotation by admin request")
+	}
+	s.writeDrainResponse(w, r)
+}
+
+func (s *Server) writeDrainResponse(w http.ResponseWriter, r *http.Request) {
+	resp := DrainResponse{
+		Readiness: s.readinessStatus(r.Context()),
+		InFlight:  s.inFlight.Load() - 1,
+	}
+	if at := s.drainedAt.Load(); at != 0 {
+		resp.Drained, resp.Since = true, time.Unix(0, at).UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding drain response: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const (
+	driftInSync  = "in_sync"
+	driftDrifted = "drift"
+	driftUnknown = "unknown"
+)
+
+type podImages struct {
+	Spec struct {
+		Containers []struct {
+			Name  string `json:"name"`
+			Image string `json:"image"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		ContainerStatuses []struct {
+			Name    string `json:"name"`
+			Image   string `json:"image"`
+			ImageID string `json:"imageID"`
+		} `json:"containerStatuses"`
+	} `json:"status"`
+}
+
+type DriftResponse struct {
+	Status         string `json:"status"`
+	Container      string `json:"container"`
+	Image          string `json:"image,omitempty"`
+	ImageID        string `json:"image_id,omitempty"`
+	RunningDigest  string `json:"running_digest,omitempty"`
+	ExpectedDigest string `json:"expected_digest,omitempty"`
+	ExpectedSource string `json:"expected_source,omitempty"`
+	Detail         string `json:"detail,omitempty"`
+	CheckedAt      string `json:"checked_at,omitempty"`
+}
+
+// imageDrift compares the image digest the kubelet actually pulled (from the
+// pod's containerStatuses[].imageID) with the digest recorded in the GitOps
+// repo, which catches mutable tags that were re-pushed after a sync. The
+// expected digest comes from EXPECTED_IMAGE_DIGEST (populated by the CD
+// pipeline's pod annotation) or from a digest-pinned image reference.
+type imageDrift struct {
+	client    *k8sclient.Client
+	namespace string
+	podName   string
+	container string
+	expected  string
+
+	mu   sync.RWMutex
+	resp DriftResponse
+}
+
+func newImageDrift(client *k8sclient.Client, namespace, podName, container, expected string) *imageDrift {
+	return &imageDrift{
+		client:    client,
+		namespace: namespace,
+		podName:   podName,
+		container: container,
+		expected:  expected,
+		resp:      DriftResponse{Status: driftUnknown, Container: container, Detail: "not resolved yet"},
+	}
+}
+
+// run resolves the running digest, retrying until the container status
+// reports an imageID. The digest can't change for the life of the pod.
+func (id *imageDrift) run(ctx context.Context) {
+	if id.client == nil {
+		id.set(DriftResponse{Status: driftUnknown, Container: id.container, Detail: "Kubernetes API access disabled"})
+		return
+	}
+	for {
+		resp, err := id.resolve(ctx)
+		if err == nil {
+			id.set(resp)
+			if resp.Status == driftDrifted {
+				log.Printf("Image drift: running %s but GitOps repo records %s", resp.RunningDigest, resp.ExpectedDigest)
+			}
+			return
+		}
+		log.Printf("Error resolving running image digest: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(15 * time.Second):
+		}
+	}
+}
+
+func (id *imageDrift) resolve(ctx context.Context) (DriftResponse, error) {
+	var p podImages
+	if err := podInformer(id.client, id.namespace, id.podName).GetOrFetch(ctx, id.podName, &p); err != nil {
+		return DriftResponse{}, err
+	}
+
+	resp := DriftResponse{Container: id.container, CheckedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, cs := range p.Status.ContainerStatuses {
+		if cs.Name == id.container {
+			resp.Image, resp.ImageID = cs.Image, cs.ImageID
+			resp.RunningDigest = imageDigest(cs.ImageID)
+		}
+	}
+	if resp.RunningDigest == "" {
+		return resp, fmt.Errorf("container %q has no imageID yet", id.container)
+	}
+
+	switch {
+	case id.expected != "":
+		resp.ExpectedDigest, resp.ExpectedSource = id.expected, "EXPECTED_IMAGE_DIGEST"
+	default:
+		for _, c := range p.Spec.Containers {
+			if c.Name == id.container {
+				resp.ExpectedDigest, resp.ExpectedSource = imageDigest(c.Image), "image reference"
+			}
+		}
+	}
+
+	switch {
+	case resp.ExpectedDigest == "":
+		resp.Status = driftUnknown
+		resp.Detail = "no digest recorded in the GitOps repo"
+	case resp.ExpectedDigest == resp.RunningDigest:
+		resp.Status = driftInSync
+	default:
+		resp.Status = driftDrifted
+		resp.Detail = "running image digest differs from the digest recorded in Git"
+	}
+	return resp, nil
+}
+
+func (id *imageDrift) set(resp DriftResponse) {
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	id.resp = resp
+}
+
+func (id *imageDrift) handler(w http.ResponseWriter, _ *http.Request) {
+	id.mu.RLock()
+	resp := id.resp
+	id.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == driftDrifted {
+		w.Header().Set("X-Image-Drift", "true")
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding drift response: %v", err)
+	}
+}
+
+// imageDigest extracts "sha256:..." from an image reference or imageID such
+// as "docker-pullable://ghcr.io/org/app@sha256:abc".
+func imageDigest(ref string) string {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[i+1:]
+	}
+	if strings.HasPrefix(ref, "sha256:") {
+		return ref
+	}
+	return ""
+}
@@ -0,0 +1,290 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/websocket"
+)
+
+// maxLocalCacheBytes bounds the bodies the local cache holds in total.
+const maxLocalCacheBytes = 16 << 20
+
+// localCache gives GET responses a strong ETag, the hash of the body as
+// sent, and answers 304 Not Modified when If-None-Match has it. Responses
+// of the routes in RESPONSE_CACHE_ROUTES are also kept in memory for ttl
+// and served without running the handler, like a CDN in front of the pod
+// would. Streamed responses, bodies over maxCachedBytes and handlers that
+// set their own ETag are passed through; the latter still get their 304.
+type localCache struct {
+	ttl     time.Duration
+	routes  map[string]bool
+	metrics *httpMetrics
+
+	mu      sync.Mutex
+	entries map[string]*localEntry
+	bytes   int
+}
+
+// localEntry is a cached response: the headers the middleware inside the
+// cache set, and the body.
+type localEntry struct {
+	etag    string
+	header  http.Header
+	body    []byte
+	stored  time.Time
+	expires time.Time
+}
+
+func newLocalCache(cfg config.Config, m *httpMetrics) *localCache {
+	c := &localCache{ttl: cfg.ResponseCacheTTL, routes: make(map[string]bool), metrics: m,
+		entries: make(map[string]*localEntry)}
+	for _, name := range cfg.ResponseCacheRoutes {
+		c.routes[name] = true
+	}
+	return c
+}
+
+func (c *localCache) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// WebSocket handshakes take over the connection; there's no body
+		// to tag.
+		if r.Method != http.MethodGet && r.Method != http.MethodHead || websocket.IsUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := unmatchedRoute
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			name = route.Name
+		}
+		cacheable := c.ttl > 0 && c.routes[name]
+		key := localCacheKey(r)
+		if cacheable {
+			if e := c.get(key); e != nil {
+				c.metrics.localCache.Inc(name, "hit")
+				h := w.Header()
+				for k, v := range e.header {
+					h[k] = v
+				}
+				h.Set("Age", strconv.Itoa(int(time.Since(e.stored).Seconds())))
+				h.Set("X-Cache", "HIT")
+				c.write(w, r, name, e.etag, e.body)
+				return
+			}
+			c.metrics.localCache.Inc(name, "miss")
+		}
+
+		before := w.Header().Clone()
+		ew := &etagWriter{ResponseWriter: w, r: r}
+		next.ServeHTTP(ew, r)
+		// Not deferred: after a panic, the recover middleware writes the
+		// error response in place of the buffered body.
+		if !ew.buffering() {
+			if ew.notModified {
+				c.metrics.notModified.Inc(name)
+			}
+			return
+		}
+		body := ew.buf.Bytes()
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		h := w.Header()
+		h.Set("ETag", etag)
+		if cacheable && h.Get("Cache-Control") == "" {
+			h.Set("Cache-Control", "max-age="+strconv.Itoa(int(c.ttl.Seconds())))
+		}
+		if cacheable && r.Method == http.MethodGet {
+			c.put(key, etag, changedHeaders(before, h), body)
+		}
+		c.write(w, r, name, etag, body)
+	})
+}
+
+// write answers 304 when If-None-Match has etag, or sends body.
+func (c *localCache) write(w http.ResponseWriter, r *http.Request, route, etag string, body []byte) {
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		c.metrics.notModified.Inc(route)
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(body)
+	}
+}
+
+func (c *localCache) get(key string) *localEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.entries[key]
+	if e == nil || time.Now().After(e.expires) {
+		return nil
+	}
+	return e
+}
+
+// put stores a response, first dropping the expired ones when the cache is
+// full. Responses that still don't fit aren't cached.
+func (c *localCache) put(key, etag string, header http.Header, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if old := c.entries[key]; old != nil {
+		c.bytes -= len(old.body)
+		delete(c.entries, key)
+	}
+	if c.bytes+len(body) > maxLocalCacheBytes {
+		for k, e := range c.entries {
+			if now.After(e.expires) {
+				c.bytes -= len(e.body)
+				delete(c.entries, k)
+			}
+		}
+		if c.bytes+len(body) > maxLocalCacheBytes {
+			return
+		}
+	}
+	c.entries[key] = &localEntry{etag: etag, header: header, body: slices.Clone(body), stored: now, expires: now.Add(c.ttl)}
+	c.bytes += len(body)
+}
+
+// localCacheKey identifies a representation: the request URI and the
+// request headers the middleware inside the cache negotiate on.
+func localCacheKey(r *http.Request) string {
+	return strings.Join([]string{
+		r.URL.RequestURI(),
+		r.Header.Get("Accept"),
+		r.Header.Get(apiversion.RequestHeader),
+		r.Header.Get("Accept-Language"),
+		strconv.FormatBool(acceptsGzip(r.Header.Get("Accept-Encoding"))),
+	}, "\n")
+}
+
+// changedHeaders returns the headers of after that differ from before:
+// those set while the request was inside the cache.
+func changedHeaders(before, after http.Header) http.Header {
+	changed := make(http.Header)
+	for k, v := range after {
+		if !slices.Equal(before[k], v) {
+			changed[k] = slices.Clone(v)
+		}
+	}
+	return changed
+}
+
+// etagMatches implements the weak comparison of If-None-Match: "*" or any
+// listed tag, W/ prefixes ignored, matches.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// etagWriter holds back a 200 response until the handler returns, so its
+// ETag can be computed. Other statuses, bodies over maxCachedBytes and
+// flushed streams go through as they're written. When the handler sets its
+// own ETag, the response goes through too, or becomes a 304 when
+// If-None-Match has the tag.
+type etagWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	code        int
+	buf         bytes.Buffer
+	passthrough bool
+	notModified bool
+}
+
+// buffering reports whether the response is still held back.
+func (ew *etagWriter) buffering() bool {
+	return !ew.passthrough && !ew.notModified
+}
+
+func (ew *etagWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		ew.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if ew.code != 0 {
+		return
+	}
+	ew.code = code
+	switch etag := ew.Header().Get("ETag"); {
+	case code != http.StatusOK:
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(code)
+	case etag != "" && etagMatches(ew.r.Header.Get("If-None-Match"), etag):
+		ew.notModified = true
+		ew.Header().Del("Content-Length")
+		ew.ResponseWriter.WriteHeader(http.StatusNotModified)
+	case etag != "":
+		ew.passthrough = true
+		ew.ResponseWriter.WriteHeader(code)
+	}
+}
+
+func (ew *etagWriter) Write(b []byte) (int, error) {
+	if ew.code == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case ew.notModified:
+		return len(b), nil
+	case ew.passthrough:
+		return ew.ResponseWriter.Write(b)
+	}
+	if ew.buf.Len()+len(b) > maxCachedBytes {
+		if err := ew.release(); err != nil {
+			return 0, err
+		}
+		return ew.ResponseWriter.Write(b)
+	}
+	return ew.buf.Write(b)
+}
+
+// release sends the held back response without an ETag and passes the
+// rest through.
+func (ew *etagWriter) release() error {
+	ew.passthrough = true
+	ew.ResponseWriter.WriteHeader(http.StatusOK)
+	_, err := ew.ResponseWriter.Write(ew.buf.Bytes())
+	ew.buf.Reset()
+	return err
+}
+
+// FlushError sends what has been written so far; streams aren't given an
+// ETag.
+func (ew *etagWriter) FlushError() error {
+	if ew.code == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering() {
+		if err := ew.release(); err != nil {
+			return err
+		}
+	}
+	return http.NewResponseController(ew.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (ew *etagWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/eventbus"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// Types of the CloudEvents published to the event broker.
+const (
+	eventRequestServed   = "request.served"
+	eventItemCreated     = "item.created"
+	eventItemUpdated     = "item.updated"
+	eventItemDeleted     = "item.deleted"
+	eventVersionStarted  = "version.started"
+	eventVersionsChanged = "versions.changed"
+)
+
+// requestServedEvent is the data of request.served, one per API request.
+type requestServedEvent struct {
+	Method     string  `json:"method"`
+	Path       string  `json:"path"`
+	Route      string  `json:"route"`
+	Status     int     `json:"status"`
+	DurationMs float64 `json:"duration_ms"`
+	RequestID  string  `json:"request_id,omitempty"`
+	Pod        string  `json:"pod"`
+}
+
+// itemDeletedEvent is the data of item.deleted; the other item events carry
+// the item.
+type itemDeletedEvent struct {
+	ID int64 `json:"id"`
+}
+
+// versionStartedEvent is the data of version.started, published when a
+// replica becomes ready, so consumers can follow rollouts.
+type versionStartedEvent struct {
+	Version     string `json:"version"`
+	GitCommit   string `json:"git_commit"`
+	Environment string `json:"environment"`
+	Pod         string `json:"pod"`
+	Node        string `json:"node,omitempty"`
+}
+
+// versionsChangedEvent is the data of versions.changed, published by the
+// leader when the set of versions its peers serve changes.
+type versionsChangedEvent struct {
+	Service  string           `json:"service"`
+	Versions []ServingVersion `json:"versions"`
+	Skew     bool             `json:"skew"`
+}
+
+// newEventPublisher returns the publisher of the configured broker, nil
+// when EVENT_BROKER_URL is unset. Outcomes are counted in m.
+func newEventPublisher(cfg config.Config, m *httpMetrics) (*eventbus.Publisher, error) {
+	return eventbus.New(eventbus.Config{
+		URL:      cfg.EventBrokerURL,
+		Topic:    cfg.EventTopic,
+		Source:   "/" + cfg.ServiceName + "/" + cfg.Environment,
+		ClientID: cfg.ServiceName + "-" + cfg.Identity(),
+		Report: func(eventType, outcome string) {
+			m.published.Inc(eventType, outcome)
+		},
+	})
+}
+
+// eventsMiddleware publishes a request.served event per request once it has
+// been answered. It does nothing without an event broker.
+func (s *Server) eventsMiddleware(next http.Handler) http.Handler {
+	if s.bus == nil {
+		return next
+	}
+	pod := s.cfg.Identity()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		tw := &trackingWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+
+		name := unmatchedRoute
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			name = route.Name
+		}
+		s.bus.Emit(eventRequestServed, name, requestServedEvent{
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Route:      name,
+			Status:     tw.status(),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+			RequestID:  requestid.FromContext(r.Context()),
+			Pod:        pod,
+		})
+	})
+}
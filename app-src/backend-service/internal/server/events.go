@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+// Event reasons emitted on lifecycle transitions.
+const (
+	reasonStartupCompleted   = "StartupCompleted"
+	reasonConfigReloaded     = "ConfigReloaded"
+	reasonDrainStarted       = "DrainStarted"
+	reasonManualDrain        = "ManualDrain"
+	reasonManualUndrain      = "ManualUndrain"
+	reasonContainerRestarted = "ContainerRestarted"
+	reasonDisruptionDetected = "DisruptionDetected"
+	reasonNodePressure       = "NodePressure"
+	reasonChaosChanged       = "ChaosChanged"
+	reasonLogLevelChanged    = "LogLevelChanged"
+)
+
+const (
+	eventTypeNormal  = "Normal"
+	eventTypeWarning = "Warning"
+)
+
+type kubeEvent struct {
+	APIVersion         string          `json:"apiVersion"`
+	Kind               string          `json:"kind"`
+	Metadata           eventMeta       `json:"metadata"`
+	InvolvedObject     objectReference `json:"involvedObject"`
+	Reason             string          `json:"reason"`
+	Message            string          `json:"message"`
+	Type               string          `json:"type"`
+	Source             eventSource     `json:"source"`
+	FirstTimestamp     string          `json:"firstTimestamp"`
+	LastTimestamp      string          `json:"lastTimestamp"`
+	Count              int32           `json:"count"`
+	ReportingComponent string          `json:"reportingComponent"`
+	ReportingInstance  string          `json:"reportingInstance"`
+}
+
+type eventMeta struct {
+	GenerateName string `json:"generateName"`
+	Namespace    string `json:"namespace"`
+}
+
+type objectReference struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	UID        string `json:"uid,omitempty"`
+}
+
+type eventSource struct {
+	Component string `json:"component"`
+	Host      string `json:"host,omitempty"`
+}
+
+// eventRecorder publishes Kubernetes Events on this pod so lifecycle
+// transitions show up in `kubectl describe pod`. Events are sent
+// asynchronously and dropped if the queue is full; a nil recorder is a no-op.
+type eventRecorder struct {
+	client    *k8sclient.Client
+	component string
+	pod       objectReference
+	nodeName  string
+	queue     chan kubeEvent
+}
+
+func newEventRecorder(client *k8sclient.Client, component, namespace, podName, podUID, nodeName string) *eventRecorder {
+	return &eventRecorder{
+		client:    client,
+		component: component,
+		pod: objectReference{
+			APIVersion: "v1",
+			Kind:       "Pod",
+			Name:       podName,
+			Namespace:  namespace,
+			UID:        podUID,
+		},
+		nodeName: nodeName,
+		queue:    make(chan kubeEvent, 32),
+	}
+}
+
+// run delivers queued events until ctx is cancelled, then flushes what is
+// left so shutdown-time events aren't lost.
+func (er *eventRecorder) run(ctx context.Context) {
+	if er == nil {
+		return
+	}
+	for {
+		select {
+		case event := <-er.queue:
+			er.send(ctx, event)
+		case <-ctx.Done():
+			flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case event := <-er.queue:
+					er.send(flushCtx, event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (er *eventRecorder) send(ctx context.Context, event kubeEvent) {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/events", er.pod.Namespace)
+	if err := er.client.Do(ctx, http.MethodPost, path, event, nil); err != nil {
+		log.Printf("Error emitting %s event: %v", event.Reason, err)
+	}
+}
+
+// Eventf records an event of the given type and reason on this pod.
+func (er *eventRecorder) Eventf(eventType, reason, format string, args ...any) {
+	if er == nil {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	event := kubeEvent{
+		APIVersion: "v1",
+		Kind:       "Event",
+		Metadata: eventMeta{
+			GenerateName: er.pod.Name + ".",
+			Namespace:    er.pod.Namespace,
+		},
+		InvolvedObject:     er.pod,
+		Reason:             reason,
+		Message:            fmt.Sprintf(format, args...),
+		Type:               eventType,
+		Source:             eventSource{Component: er.component, Host: er.nodeName},
+		FirstTimestamp:     now,
+		LastTimestamp:      now,
+		Count:              1,
+		ReportingComponent: er.component,
+		ReportingInstance:  er.pod.Name,
+	}
+	select {
+	case er.queue <- event:
+	default:
+		log.Printf("Event queue full, dropping %s event", reason)
+	}
+}
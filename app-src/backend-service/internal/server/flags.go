@@ -0,0 +1,264 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const flagsFilePollInterval = 5 * time.Second
+
+// flagDef is a feature flag the code checks, with its value while the
+// source doesn't set it or sets something that isn't a boolean.
+type flagDef struct {
+	name         string
+	description  string
+	defaultValue bool
+}
+
+// Feature flags. Add new ones here so /api/flags lists them.
+const flagExtendedInfo = "extended-info"
+
+var flagDefs = []flagDef{
+	{flagExtendedInfo, "Add the build version, commit and uptime to /api/info", false},
+}
+
+// FlagsResponse is the /api/flags response.
+type FlagsResponse struct {
+	Source     string      `json:"source,omitempty"`
+	Generation int64       `json:"generation"`
+	UpdatedAt  string      `json:"updated_at,omitempty"`
+	Flags      []FlagState `json:"flags"`
+	// Other keys of the source that aren't feature flags
+	Other []string `json:"other,omitempty"`
+}
+
+type FlagState struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Default     bool   `json:"default"`
+	Value       string `json:"value,omitempty"`
+	Invalid     bool   `json:"invalid,omitempty"`
+	Description string `json:"description"`
+}
+
+type configMap struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+	Data     map[string]string    `json:"data"`
+}
+
+// flagStore holds the current feature flag values. Values are kept as raw
+// strings so the same source can also carry small config settings.
+type flagStore struct {
+	mu         sync.RWMutex
+	values     map[string]string
+	source     string
+	generation int64
+	updatedAt  time.Time
+	onChange   []func(source string, generation int64)
+}
+
+func newFlagStore() *flagStore {
+	return &flagStore{values: map[string]string{}}
+}
+
+// subscribe registers fn to be called after every change to the flags.
+func (fs *flagStore) subscribe(fn func(source string, generation int64)) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.onChange = append(fs.onChange, fn)
+}
+
+// enabled reports whether the feature flag name is on.
+func (fs *flagStore) enabled(name string) bool {
+	return fs.state(name).Enabled
+}
+
+// state evaluates the defined flag name against the current values.
+func (fs *flagStore) state(name string) FlagState {
+	var def flagDef
+	for _, d := range flagDefs {
+		if d.name == name {
+			def = d
+		}
+	}
+	fs.mu.RLock()
+	value, set := fs.values[name]
+	fs.mu.RUnlock()
+
+	st := FlagState{Name: name, Enabled: def.defaultValue, Default: def.defaultValue, Value: value, Description: def.description}
+	if set {
+		if on, err := strconv.ParseBool(value); err == nil {
+			st.Enabled = on
+		} else {
+			st.Invalid = true
+		}
+	}
+	return st
+}
+
+func (fs *flagStore) handler(w http.ResponseWriter, _ *http.Request) {
+	fs.mu.RLock()
+	resp := FlagsResponse{Source: fs.source, Generation: fs.generation, Flags: make([]FlagState, 0, len(flagDefs))}
+	if !fs.updatedAt.IsZero() {
+		resp.UpdatedAt = fs.updatedAt.UTC().Format(time.RFC3339)
+	}
+	for key := range fs.values {
+		if !slices.ContainsFunc(flagDefs, func(d flagDef) bool { return d.name == key }) {
+			resp.Other = append(resp.Other, key)
+		}
+	}
+	fs.mu.RUnlock()
+	sort.Strings(resp.Other)
+	for _, def := range flagDefs {
+		resp.Flags = append(resp.Flags, fs.state(def.name))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding flags response: %v", err)
+	}
+}
+
+// replace swaps in a new set of values, returning false if nothing changed.
+func (fs *flagStore) replace(values map[string]string, source string) bool {
+	fs.mu.Lock()
+	if reflect.DeepEqual(fs.values, values) {
+		fs.mu.Unlock()
+		return false
+	}
+	fs.values = values
+	fs.source = source
+	fs.generation++
+	fs.updatedAt = time.Now()
+	subscribers := fs.onChange
+	generation := fs.generation
+	fs.mu.Unlock()
+
+	log.Printf("Feature flags updated from %s: %d flags (generation %d)", source, len(values), generation)
+	for _, fn := range subscribers {
+		fn(source, generation)
+	}
+	return true
+}
+
+// flagSource feeds a flagStore either from a ConfigMap watched through the
+// Kubernetes API, which applies changes within seconds, or from a mounted
+// ConfigMap directory, which the kubelet only refreshes every minute or so.
+// API mode falls back to file mode when the API is unavailable or forbidden.
+type flagSource struct {
+	store     *flagStore
+	client    *k8sclient.Client
+	namespace string
+	configMap string
+	dir       string
+}
+
+func (src *flagSource) run(ctx context.Context) {
+	if src.client != nil && src.configMap != "" {
+		if src.watchConfigMap(ctx) {
+			return
+		}
+		log.Printf("Falling back to feature flags from %s", src.dir)
+	}
+	if src.dir != "" {
+		src.pollDir(ctx)
+	}
+}
+
+// watchConfigMap runs an informer on the ConfigMap. It returns false without
+// blocking if the ConfigMap can't be read, so the caller can fall back.
+func (src *flagSource) watchConfigMap(ctx context.Context) bool {
+	var cm configMap
+	path := fmt.Sprintf("/api/v1/namespaces/%s/configmaps/%s", src.namespace, src.configMap)
+	if err := src.client.Do(ctx, http.MethodGet, path, nil, &cm); err != nil {
+		log.Printf("Error reading feature flag configmap %s/%s: %v", src.namespace, src.configMap, err)
+		return false
+	}
+	log.Printf("Watching feature flag configmap %s/%s", src.namespace, src.configMap)
+
+	source := "configmap/" + src.configMap
+	src.client.ListWatch(ctx,
+		fmt.Sprintf("/api/v1/namespaces/%s/configmaps", src.namespace),
+		url.Values{"fieldSelector": {"metadata.name=" + src.configMap}},
+		func(items []json.RawMessage) {
+			if len(items) == 0 {
+				return
+			}
+			src.apply(k8sclient.WatchEvent{Type: "ADDED", Object: items[0]}, source)
+		},
+		func(event k8sclient.WatchEvent) { src.apply(event, source) },
+	)
+	return true
+}
+
+func (src *flagSource) apply(event k8sclient.WatchEvent, source string) {
+	if event.Type == "DELETED" {
+		log.Printf("Feature flag configmap %s deleted, keeping last known flags", src.configMap)
+		return
+	}
+	var cm configMap
+	if err := json.Unmarshal(event.Object, &cm); err != nil {
+		log.Printf("Error decoding configmap event: %v", err)
+		return
+	}
+	values := cm.Data
+	if values == nil {
+		values = map[string]string{}
+	}
+	src.store.replace(values, source)
+}
+
+func (src *flagSource) pollDir(ctx context.Context) {
+	ticker := time.NewTicker(flagsFilePollInterval)
+	defer ticker.Stop()
+	for {
+		values, err := readFlagsDir(src.dir)
+		if err == nil {
+			src.store.replace(values, "file:"+src.dir)
+		} else if !os.IsNotExist(err) {
+			log.Printf("Error reading feature flags from %s: %v", src.dir, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// readFlagsDir reads a mounted ConfigMap directory, one file per key.
+// Kubelet bookkeeping entries (..data and friends) are skipped.
+func readFlagsDir(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			// Directories and dangling symlinks mid-update.
+			continue
+		}
+		values[entry.Name()] = strings.TrimSpace(string(data))
+	}
+	return values, nil
+}
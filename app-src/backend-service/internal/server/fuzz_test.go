@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func FuzzEnqueueJobs(f *testing.F) {
+	for _, seed := range []string{``, `{}`, `{"count":3,"duration_ms":10}`, `{"count":-1}`, `{"count":1e9}`,
+		`{"duration_ms":999999999999}`, `[1,2]`, `{"count":"3"}`, strings.Repeat(`{"count":1}`, 200)} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		s := newTestServer(t, nil)
+		rec := serve(s, http.MethodPost, "/api/v1/jobs", body, nil)
+		switch rec.Code {
+		case http.StatusAccepted, http.StatusServiceUnavailable:
+			validateResponse(t, rec, "EnqueueJobsResponse")
+		case http.StatusBadRequest:
+		default:
+			t.Errorf("status = %d for body %q", rec.Code, body)
+		}
+		if depth := s.jobs.depth(); depth > int64(s.cfg.JobQueueCapacity) {
+			t.Errorf("queue depth %d exceeds capacity %d", depth, s.cfg.JobQueueCapacity)
+		}
+	})
+}
+
+// FuzzReadPktLine feeds arbitrary info/refs responses from a Git server.
+func FuzzReadPktLine(f *testing.F) {
+	f.Add([]byte("001e# service=git-upload-pack\n0000"))
+	f.Add([]byte("003f0123456789abcdef0123456789abcdef01234567 HEAD\x00side-band\n0000"))
+	f.Add([]byte("zzzz"))
+	f.Add([]byte("0003"))
+	f.Add([]byte("ffff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		r := bufio.NewReader(bytes.NewReader(data))
+		read := 0
+		for i := 0; i < len(data); i++ {
+			line, err := readPktLine(r)
+			if err != nil {
+				return
+			}
+			read += 4 + len(line)
+			if read > len(data) {
+				t.Fatalf("read %d payload bytes from %d bytes of input", read, len(data))
+			}
+		}
+	})
+}
+
+func FuzzImageDigest(f *testing.F) {
+	for _, seed := range []string{"ghcr.io/org/app@sha256:abc", "docker-pullable://app@sha256:abc", "sha256:abc", "app:1.0", "@", ""} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, ref string) {
+		if digest := imageDigest(ref); digest != "" && !strings.HasSuffix(ref, digest) {
+			t.Errorf("imageDigest(%q) = %q, not a suffix of the reference", ref, digest)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// GitOpsDriftResponse is the response of /api/v1/gitops/drift: whether the
+// image tag the GitOps repo declares names the running build.
+type GitOpsDriftResponse struct {
+	// in_sync, drift or unknown
+	Status      string `json:"status"`
+	ManifestURL string `json:"manifest_url"`
+	Image       string `json:"image"`
+	ExpectedTag string `json:"expected_tag,omitempty"`
+	// Version and commit of the running build
+	RunningVersion string `json:"running_version"`
+	RunningCommit  string `json:"running_commit"`
+	Detail         string `json:"detail,omitempty"`
+	CheckedAt      string `json:"checked_at,omitempty"`
+}
+
+// manifestDrift polls a manifest of the GitOps repo for the tag of the
+// service's image and compares it with the running build. Unlike the digest
+// check of /api/v1/drift it needs no Kubernetes API access, and it catches
+// the window where Git moved on but the cluster hasn't synced yet. A nil
+// manifestDrift is disabled.
+type manifestDrift struct {
+	url      string
+	token    string
+	image    string
+	build    config.BuildInfo
+	interval time.Duration
+	client   *http.Client
+
+	mu   sync.RWMutex
+	resp GitOpsDriftResponse
+}
+
+func newManifestDrift(cfg config.Config) *manifestDrift {
+	if cfg.GitOpsManifestURL == "" {
+		return nil
+	}
+	md := &manifestDrift{
+		url:      cfg.GitOpsManifestURL,
+		token:    cfg.GitOpsManifestToken,
+		image:    cfg.GitOpsImage,
+		build:    cfg.Build,
+		interval: cfg.GitOpsDriftInterval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	md.resp = md.result("", driftUnknown, "not checked yet")
+	md.resp.CheckedAt = ""
+	return md
+}
+
+// run checks the manifest every interval until ctx is cancelled.
+func (md *manifestDrift) run(ctx context.Context) {
+	if md == nil {
+		return
+	}
+	for {
+		md.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(md.interval):
+		}
+	}
+}
+
+// check fetches the manifest once and records the outcome.
+func (md *manifestDrift) check(ctx context.Context) {
+	resp := md.compare(ctx)
+	md.mu.Lock()
+	changed := resp.Status != md.resp.Status || resp.ExpectedTag != md.resp.ExpectedTag
+	md.resp = resp
+	md.mu.Unlock()
+	if changed && resp.Status == driftDrifted {
+		log.Printf("GitOps drift: %s declares %s:%s but %s (%s) is running",
+			md.url, md.image, resp.ExpectedTag, md.build.Version, md.build.GitCommit)
+	}
+}
+
+func (md *manifestDrift) compare(ctx context.Context) GitOpsDriftResponse {
+	manifest, err := md.fetch(ctx)
+	if err != nil {
+		log.Printf("Error fetching GitOps manifest %s: %v", md.url, err)
+		return md.result("", driftUnknown, "fetching the manifest: "+err.Error())
+	}
+	tag, err := manifestImageTag(manifest, md.image)
+	if err != nil {
+		return md.result("", driftUnknown, err.Error())
+	}
+	switch {
+	case tagNamesBuild(tag, md.build):
+		return md.result(tag, driftInSync, "")
+	case tag == "latest" || tag == "":
+		return md.result(tag, driftUnknown, "the tag doesn't name a version or commit; /api/v1/drift compares digests")
+	}
+	return md.result(tag, driftDrifted, "the manifest declares another version than the running one")
+}
+
+func (md *manifestDrift) result(tag, status, detail string) GitOpsDriftResponse {
+	return GitOpsDriftResponse{
+		Status:         status,
+		ManifestURL:    md.url,
+		Image:          md.image,
+		ExpectedTag:    tag,
+		RunningVersion: md.build.Version,
+		RunningCommit:  md.build.GitCommit,
+		Detail:         detail,
+		CheckedAt:      time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func (md *manifestDrift) fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, md.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if md.token != "" {
+		req.Header.Set("Authorization", "Bearer "+md.token)
+	}
+	res, err := md.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", md.url, res.Status)
+	}
+	return io.ReadAll(io.LimitReader(res.Body, 1<<20))
+}
+
+// manifestImageTag returns the tag the YAML documents of manifest give
+// image: the newTag of a kustomization's images entry naming it, or the tag
+// of a container image reference to it.
+func manifestImageTag(manifest []byte, image string) (string, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var doc any
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("the manifest doesn't reference %s", image)
+		}
+		if err != nil {
+			return "", fmt.Errorf("parsing the manifest: %w", err)
+		}
+		if tag, ok := findImageTag(doc, image); ok {
+			return tag, nil
+		}
+	}
+}
+
+func findImageTag(node any, image string) (string, bool) {
+	switch n := node.(type) {
+	case map[string]any:
+		// A kustomization images entry
+		name, _ := n["name"].(string)
+		newName, _ := n["newName"].(string)
+		if newTag, ok := n["newTag"]; ok && (name == image || newName == image) {
+			return fmt.Sprint(newTag), true
+		}
+		if ref, ok := n["image"].(string); ok {
+			if repo, tag := splitImage(ref); repo == image {
+				return tag, true
+			}
+		}
+		for _, v := range n {
+			if tag, ok := findImageTag(v, image); ok {
+				return tag, true
+			}
+		}
+	case []any:
+		for _, v := range n {
+			if tag, ok := findImageTag(v, image); ok {
+				return tag, true
+			}
+		}
+	}
+	return "", false
+}
+
+// splitImage splits an image reference into repository and tag, dropping a
+// digest; a registry port isn't mistaken for a tag.
+func splitImage(ref string) (repo, tag string) {
+	ref, _, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(ref, ":"); i > strings.LastIndex(ref, "/") {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// tagNamesBuild reports whether tag names the build: its version, with or
+// without a leading v, or its commit, which CI tags images with.
+func tagNamesBuild(tag string, build config.BuildInfo) bool {
+	if tag == "" {
+		return false
+	}
+	if strings.TrimPrefix(tag, "v") == strings.TrimPrefix(build.Version, "v") {
+		return true
+	}
+	return len(tag) >= 7 && strings.HasPrefix(build.GitCommit, tag)
+}
+
+func (md *manifestDrift) status() GitOpsDriftResponse {
+	md.mu.RLock()
+	defer md.mu.RUnlock()
+	return md.resp
+}
+
+// gitopsDriftHandler serves /api/v1/gitops/drift: 503 when
+// GITOPS_MANIFEST_URL isn't set.
+func (s *Server) gitopsDriftHandler(w http.ResponseWriter, r *http.Request) {
+	if s.manifestDrift == nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.gitops_drift_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	resp := s.manifestDrift.status()
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == driftDrifted {
+		w.Header().Set("X-GitOps-Drift", "true")
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding gitops drift response: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RepoStatus struct {
+	URL      string `json:"url"`
+	Ref      string `json:"ref"`
+	Owner    string `json:"owner"`
+	Mine     bool   `json:"polled_here"`
+	Revision string `json:"revision,omitempty"`
+	PolledAt string `json:"polled_at,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+type ReposResponse struct {
+	Identity string       `json:"identity"`
+	Members  []string     `json:"members"`
+	Repos    []RepoStatus `json:"repos"`
+}
+
+type repoTarget struct {
+	url string
+	ref string
+}
+
+// repoPoller polls the head revision of the configured Git repositories over
+// the smart HTTP protocol. Repositories are partitioned between replicas via
+// the memberSet, so adding replicas spreads the polls instead of repeating
+// them; each replica only knows the revisions of the repositories it owns.
+type repoPoller struct {
+	members  *memberSet
+	targets  []repoTarget
+	interval time.Duration
+	client   *http.Client
+
+	mu     sync.RWMutex
+	status map[string]RepoStatus
+}
+
+// newRepoPoller parses entries of the form "https://host/org/repo.git" with an
+// optional "#refs/heads/main" suffix; the ref defaults to HEAD.
+func newRepoPoller(members *memberSet, repos []string, interval time.Duration) *repoPoller {
+	rp := &repoPoller{
+		members:  members,
+		interval: interval,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		status:   make(map[string]RepoStatus),
+	}
+	for _, repo := range repos {
+		target := repoTarget{url: repo, ref: "HEAD"}
+		if i := strings.LastIndex(repo, "#"); i >= 0 {
+			target.url, target.ref = repo[:i], repo[i+1:]
+		}
+		rp.targets = append(rp.targets, target)
+	}
+	return rp
+}
+
+func (rp *repoPoller) run(ctx context.Context) {
+	if len(rp.targets) == 0 {
+		return
+	}
+	ticker := time.NewTicker(rp.interval)
+	defer ticker.Stop()
+	for {
+		rp.pollOwned(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rp *repoPoller) pollOwned(ctx context.Context) {
+	for _, t := range rp.targets {
+		key := t.url + "#" + t.ref
+		if !rp.members.owns(key) {
+			rp.mu.Lock()
+			delete(rp.status, key)
+			rp.mu.Unlock()
+			continue
+		}
+		st := RepoStatus{URL: t.url, Ref: t.ref, PolledAt: time.Now().UTC().Format(time.RFC3339)}
+		rev, err := rp.resolve(ctx, t)
+		if err != nil {
+			st.Error = err.Error()
+			if ctx.Err() == nil {
+				log.Printf("Error polling %s (%s): %v", t.url, t.ref, err)
+			}
+		}
+		st.Revision = rev
+
+		rp.mu.Lock()
+		if prev, ok := rp.status[key]; ok && prev.Revision != "" && rev != "" && prev.Revision != rev {
+			log.Printf("Repository %s %s moved from %s to %s", t.url, t.ref, prev.Revision, rev)
+		}
+		rp.status[key] = st
+		rp.mu.Unlock()
+	}
+}
+
+// resolve reads the ref advertisement, the same request `git ls-remote`
+// makes, and returns the revision of the target ref.
+func (rp *repoPoller) resolve(ctx context.Context, t repoTarget) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		strings.TrimSuffix(t.url, "/")+"/info/refs?service=git-upload-pack", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := rp.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	for {
+		line, err := readPktLine(r)
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("ref %s not found", t.ref)
+		}
+		if err != nil {
+			return "", err
+		}
+		// "<sha> <ref>\x00<capabilities>" on the first ref, "<sha> <ref>" after.
+		line, _, _ = strings.Cut(strings.TrimSuffix(line, "\n"), "\x00")
+		sha, ref, ok := strings.Cut(line, " ")
+		if ok && ref == t.ref {
+			return sha, nil
+		}
+	}
+}
+
+// readPktLine returns the payload of the next pkt-line; flush packets
+// ("0000") are returned as empty lines.
+func readPktLine(r *bufio.Reader) (string, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	n, err := strconv.ParseUint(string(size[:]), 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid pkt-line length %q", size)
+	}
+	if n < 4 {
+		return "", nil
+	}
+	payload := make([]byte, n-4)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return "", err
+	}
+	return string(payload), nil
+}
+
+func (rp *repoPoller) handler(w http.ResponseWriter, _ *http.Request) {
+	resp := ReposResponse{
+		Identity: rp.members.identity,
+		Members:  rp.members.list(),
+		Repos:    make([]RepoStatus, 0, len(rp.targets)),
+	}
+	rp.mu.RLock()
+	for _, t := range rp.targets {
+		key := t.url + "#" + t.ref
+		st, ok := rp.status[key]
+		if !ok {
+			st = RepoStatus{URL: t.url, Ref: t.ref}
+		}
+		st.Owner = rp.members.owner(key)
+		st.Mine = st.Owner == rp.members.identity
+		resp.Repos = append(resp.Repos, st)
+	}
+	rp.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding repos response: %v", err)
+	}
+}
@@ -0,0 +1,413 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+const (
+	// gitEventHistory is the number of webhooks kept for /api/v1/git/commits.
+	gitEventHistory = 50
+	// gitBranchHistory is the number of commits of the branch kept to count
+	// how far the running commit is behind.
+	gitBranchHistory = 500
+)
+
+// Kinds of Git events.
+const (
+	gitEventPush        = "push"
+	gitEventPullRequest = "pull_request"
+)
+
+// Comparisons of the running commit with the latest one of the branch.
+const (
+	commitUpToDate = "up_to_date"
+	commitBehind   = "behind"
+	commitUnknown  = "unknown"
+)
+
+// GitCommit is a commit a push brought.
+type GitCommit struct {
+	SHA string `json:"sha"`
+	// First line of the commit message
+	Message string `json:"message,omitempty"`
+	Author  string `json:"author,omitempty"`
+	Time    string `json:"time,omitempty"`
+	URL     string `json:"url,omitempty"`
+}
+
+// GitEvent is a push or pull request webhook of GitHub or GitLab. IDs are
+// unique to the replica that received it.
+type GitEvent struct {
+	ID int64 `json:"id"`
+	// github or gitlab
+	Provider string `json:"provider"`
+	// push or pull_request, merge requests included
+	Kind       string `json:"kind"`
+	Repository string `json:"repository"`
+	// Branch pushed to, or the source branch of the pull request
+	Branch string `json:"branch"`
+	// Head commit after the push, or of the pull request
+	SHA string `json:"sha,omitempty"`
+	// Pull requests: their number, title, action and target branch
+	Number     int    `json:"number,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Action     string `json:"action,omitempty"`
+	BaseBranch string `json:"base_branch,omitempty"`
+	// Pushes: the head commit and how many commits came
+	HeadCommit *GitCommit `json:"head_commit,omitempty"`
+	Commits    int        `json:"commits,omitempty"`
+	Sender     string     `json:"sender,omitempty"`
+	URL        string     `json:"url,omitempty"`
+	ReceivedAt string     `json:"received_at"`
+}
+
+// RunningCommit is the commit this build was made from.
+type RunningCommit struct {
+	Version string `json:"version"`
+	SHA     string `json:"sha"`
+}
+
+// GitCommitsResponse is the response of /api/v1/git/commits: the latest
+// commit pushed to the tracked branch next to the running one, and the Git
+// webhooks this replica received, newest first.
+type GitCommitsResponse struct {
+	Branch     string        `json:"branch"`
+	Repository string        `json:"repository,omitempty"`
+	Latest     *GitCommit    `json:"latest"`
+	LatestAt   string        `json:"latest_pushed_at,omitempty"`
+	Running    RunningCommit `json:"running"`
+	// up_to_date, behind, or unknown before a push to the branch or when
+	// the build's commit is unknown
+	Status string `json:"status"`
+	// Commits of the branch after the running one; only known when the
+	// running commit came in a push this replica received
+	CommitsBehind *int       `json:"commits_behind,omitempty"`
+	Events        []GitEvent `json:"events"`
+}
+
+// webhookCommit is a commit of a push, as both GitHub and GitLab send it.
+type webhookCommit struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Author    struct {
+		Name string `json:"name"`
+	} `json:"author"`
+}
+
+// gitHubPush and gitHubPullRequest are the parts of GitHub's push and
+// pull_request webhooks the service reads.
+type gitHubRepository struct {
+	FullName string `json:"full_name"`
+	HTMLURL  string `json:"html_url"`
+}
+
+type gitHubPush struct {
+	Ref        string           `json:"ref"`
+	After      string           `json:"after"`
+	Deleted    bool             `json:"deleted"`
+	Compare    string           `json:"compare"`
+	Commits    []webhookCommit  `json:"commits"`
+	HeadCommit *webhookCommit   `json:"head_commit"`
+	Repository gitHubRepository `json:"repository"`
+	Sender     struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+type gitHubPullRequest struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+		Head    struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+	Repository gitHubRepository `json:"repository"`
+	Sender     struct {
+		Login string `json:"login"`
+	} `json:"sender"`
+}
+
+// gitLabPush and gitLabMergeRequest are the parts of GitLab's "Push Hook"
+// and "Merge Request Hook" webhooks the service reads.
+type gitLabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+type gitLabPush struct {
+	Ref      string          `json:"ref"`
+	After    string          `json:"after"`
+	UserName string          `json:"user_username"`
+	Commits  []webhookCommit `json:"commits"`
+	Project  gitLabProject   `json:"project"`
+}
+
+type gitLabMergeRequest struct {
+	User struct {
+		Username string `json:"username"`
+	} `json:"user"`
+	ObjectAttributes struct {
+		IID          int    `json:"iid"`
+		Title        string `json:"title"`
+		URL          string `json:"url"`
+		Action       string `json:"action"`
+		SourceBranch string `json:"source_branch"`
+		TargetBranch string `json:"target_branch"`
+		LastCommit   struct {
+			ID string `json:"id"`
+		} `json:"last_commit"`
+	} `json:"object_attributes"`
+	Project gitLabProject `json:"project"`
+}
+
+// errIgnoredGitEvent marks webhooks of other events, like GitHub's ping.
+var errIgnoredGitEvent = errors.New("ignored event")
+
+// zeroSHA is the "after" of a push deleting its branch.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// parseGitEvent reads a GitHub or GitLab webhook by its event header. It
+// returns the commits a push brought too, oldest first.
+func parseGitEvent(r *http.Request, body []byte) (GitEvent, []GitCommit, error) {
+	switch r.Header.Get("X-GitHub-Event") {
+	case "push":
+		var p gitHubPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return GitEvent{}, nil, err
+		}
+		e := GitEvent{Provider: "github", Kind: gitEventPush, Repository: p.Repository.FullName,
+			Sender: p.Sender.Login, URL: p.Compare}
+		return pushEvent(e, p.Ref, p.After, p.Deleted, p.HeadCommit, p.Commits)
+	case "pull_request":
+		var p gitHubPullRequest
+		if err := json.Unmarshal(body, &p); err != nil {
+			return GitEvent{}, nil, err
+		}
+		pr := p.PullRequest
+		action := p.Action
+		if action == "closed" && pr.Merged {
+			action = "merged"
+		}
+		return GitEvent{Provider: "github", Kind: gitEventPullRequest, Repository: p.Repository.FullName,
+			Branch: pr.Head.Ref, SHA: pr.Head.SHA, Number: p.Number, Title: pr.Title, Action: action,
+			BaseBranch: pr.Base.Ref, Sender: p.Sender.Login, URL: pr.HTMLURL}, nil, nil
+	case "":
+	default:
+		return GitEvent{}, nil, errIgnoredGitEvent
+	}
+
+	switch r.Header.Get("X-Gitlab-Event") {
+	case "Push Hook":
+		var p gitLabPush
+		if err := json.Unmarshal(body, &p); err != nil {
+			return GitEvent{}, nil, err
+		}
+		e := GitEvent{Provider: "gitlab", Kind: gitEventPush, Repository: p.Project.PathWithNamespace,
+			Sender: p.UserName, URL: p.Project.WebURL}
+		// GitLab lists the commits oldest first; the last is the head.
+		var head *webhookCommit
+		if n := len(p.Commits); n > 0 && p.Commits[n-1].ID == p.After {
+			head = &p.Commits[n-1]
+		}
+		return pushEvent(e, p.Ref, p.After, p.After == zeroSHA, head, p.Commits)
+	case "Merge Request Hook":
+		var p gitLabMergeRequest
+		if err := json.Unmarshal(body, &p); err != nil {
+			return GitEvent{}, nil, err
+		}
+		mr := p.ObjectAttributes
+		return GitEvent{Provider: "gitlab", Kind: gitEventPullRequest, Repository: p.Project.PathWithNamespace,
+			Branch: mr.SourceBranch, SHA: mr.LastCommit.ID, Number: mr.IID, Title: mr.Title, Action: mr.Action,
+			BaseBranch: mr.TargetBranch, Sender: p.User.Username, URL: mr.URL}, nil, nil
+	case "":
+		return GitEvent{}, nil, errors.New("neither X-GitHub-Event nor X-Gitlab-Event is set")
+	}
+	return GitEvent{}, nil, errIgnoredGitEvent
+}
+
+// pushEvent completes the event of a push to ref. Tags and deleted
+// branches bring no commits to the branch.
+func pushEvent(e GitEvent, ref, after string, deleted bool, head *webhookCommit, commits []webhookCommit) (GitEvent, []GitCommit, error) {
+	branch, ok := strings.CutPrefix(ref, "refs/heads/")
+	if !ok {
+		return GitEvent{}, nil, errIgnoredGitEvent
+	}
+	e.Branch, e.Commits = branch, len(commits)
+	if deleted {
+		e.Action = "deleted"
+		return e, nil, nil
+	}
+	e.SHA = after
+	if head != nil {
+		c := gitCommit(*head)
+		e.HeadCommit = &c
+	}
+	pushed := make([]GitCommit, 0, len(commits))
+	for _, c := range commits {
+		pushed = append(pushed, gitCommit(c))
+	}
+	return e, pushed, nil
+}
+
+func gitCommit(c webhookCommit) GitCommit {
+	message, _, _ := strings.Cut(c.Message, "\n")
+	return GitCommit{SHA: c.ID, Message: message, Author: c.Author.Name, Time: c.Timestamp, URL: c.URL}
+}
+
+// gitLog keeps the Git webhooks this replica received and the commits
+// pushed to the tracked branch. Like deploymentLog, each replica keeps its
+// own.
+type gitLog struct {
+	secret  string
+	branch  string
+	running RunningCommit
+
+	mu       sync.Mutex
+	seq      int64
+	events   []GitEvent
+	latest   *GitCommit
+	latestAt string
+	repo     string
+	// SHAs pushed to the branch, oldest first
+	branchSHAs []string
+}
+
+func newGitLog(cfg config.Config) *gitLog {
+	return &gitLog{
+		secret:  cfg.GitWebhookSecret,
+		branch:  cfg.GitWebhookBranch,
+		running: RunningCommit{Version: cfg.Build.Version, SHA: cfg.Build.GitCommit},
+	}
+}
+
+// add keeps e, and the commits of a push to the tracked branch.
+func (g *gitLog) add(e GitEvent, pushed []GitCommit) GitEvent {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.seq++
+	e.ID = g.seq
+	e.ReceivedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	g.events = append(g.events, e)
+	if len(g.events) > gitEventHistory {
+		g.events = g.events[len(g.events)-gitEventHistory:]
+	}
+
+	if e.Kind != gitEventPush || e.Branch != g.branch || e.SHA == "" {
+		return e
+	}
+	latest := GitCommit{SHA: e.SHA}
+	if e.HeadCommit != nil {
+		latest = *e.HeadCommit
+	}
+	g.latest, g.latestAt, g.repo = &latest, e.ReceivedAt, e.Repository
+	for _, c := range pushed {
+		g.branchSHAs = append(g.branchSHAs, c.SHA)
+	}
+	if len(pushed) == 0 || pushed[len(pushed)-1].SHA != e.SHA {
+		// Force pushes and merges may not list the head
+		g.branchSHAs = append(g.branchSHAs, e.SHA)
+	}
+	if len(g.branchSHAs) > gitBranchHistory {
+		g.branchSHAs = g.branchSHAs[len(g.branchSHAs)-gitBranchHistory:]
+	}
+	return e
+}
+
+// sameCommit reports whether sha is the commit running, which may be
+// abbreviated. Short or unset commits, like "unknown", match nothing.
+func sameCommit(sha, running string) bool {
+	return len(running) >= 7 && sha != "" && strings.HasPrefix(sha, running)
+}
+
+// commits compares the latest commit of the branch with the running one.
+func (g *gitLog) commits() GitCommitsResponse {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	resp := GitCommitsResponse{
+		Branch:     g.branch,
+		Repository: g.repo,
+		Latest:     g.latest,
+		LatestAt:   g.latestAt,
+		Running:    g.running,
+		Status:     commitUnknown,
+		Events:     make([]GitEvent, 0, len(g.events)),
+	}
+	for i := len(g.events) - 1; i >= 0; i-- {
+		resp.Events = append(resp.Events, g.events[i])
+	}
+	if g.latest == nil || len(g.running.SHA) < 7 {
+		return resp
+	}
+	resp.Status = commitBehind
+	for i := len(g.branchSHAs) - 1; i >= 0; i-- {
+		if sameCommit(g.branchSHAs[i], g.running.SHA) {
+			behind := len(g.branchSHAs) - 1 - i
+			resp.CommitsBehind = &behind
+			break
+		}
+	}
+	if sameCommit(g.latest.SHA, g.running.SHA) {
+		resp.Status = commitUpToDate
+	}
+	return resp
+}
+
+// webhookHandler serves /webhooks/git: it answers 202 with the event it
+// recorded, 204 to the events it ignores, like GitHub's ping, and 503 when
+// GIT_WEBHOOK_SECRET isn't set.
+func (g *gitLog) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if g.secret == "" {
+		problem.Error(w, r, i18n.T(ctx, "error.git_webhook_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	body, ok := readSignedWebhook(w, r, g.secret, "X-Hub-Signature-256")
+	if !ok {
+		return
+	}
+	event, pushed, err := parseGitEvent(r, body)
+	if errors.Is(err, errIgnoredGitEvent) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, i18n.T(ctx, "error.webhook_payload", err), http.StatusBadRequest)
+		return
+	}
+	event = g.add(event, pushed)
+	log.Printf("Git %s from %s: %s %s %s", event.Kind, event.Provider, event.Repository, event.Branch, event.SHA)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(event); err != nil {
+		log.Printf("Error encoding git event: %v", err)
+	}
+}
+
+// handler serves /api/v1/git/commits.
+func (g *gitLog) handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(g.commits()); err != nil {
+		log.Printf("Error encoding git commits response: %v", err)
+	}
+}
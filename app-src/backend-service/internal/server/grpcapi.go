@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/grpc"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+)
+
+// grpcServiceName is the full name of the service of backend.proto. Its
+// health is the replica's readiness; the health of "" is its liveness.
+const grpcServiceName = "backend.v1.BackendService"
+
+// backendProto describes api/proto/backend/v1/backend.proto to server
+// reflection; keep them in step.
+var backendProto = grpc.File{
+	Name:      "backend/v1/backend.proto",
+	Package:   "backend.v1",
+	GoPackage: "github.com/anasadan/gitops-demo/backend-service/api/proto/backend/v1;backendv1",
+	Messages: []grpc.MessageType{
+		{Name: "GetInfoRequest"},
+		{Name: "Info", Fields: []grpc.FieldType{
+			{Name: "service", Number: 1, Type: grpc.TypeString},
+			{Name: "environment", Number: 2, Type: grpc.TypeString},
+			{Name: "hostname", Number: 3, Type: grpc.TypeString},
+			{Name: "topology", Number: 4, Type: grpc.TypeMessage, TypeName: ".backend.v1.Topology"},
+			{Name: "message", Number: 5, Type: grpc.TypeString},
+		}},
+		{Name: "Topology", Fields: []grpc.FieldType{
+			{Name: "region", Number: 1, Type: grpc.TypeString},
+			{Name: "zone", Number: 2, Type: grpc.TypeString},
+		}},
+		{Name: "GetVersionRequest"},
+		{
+			Name: "Version",
+			Fields: []grpc.FieldType{
+				{Name: "version", Number: 1, Type: grpc.TypeString},
+				{Name: "build_time", Number: 2, Type: grpc.TypeString},
+				{Name: "git_commit", Number: 3, Type: grpc.TypeString},
+				{Name: "go_version", Number: 4, Type: grpc.TypeString},
+				{Name: "git_branch", Number: 5, Type: grpc.TypeString},
+				{Name: "git_tag", Number: 6, Type: grpc.TypeString},
+				{Name: "git_dirty", Number: 7, Type: grpc.TypeBool},
+				{Name: "build_user", Number: 8, Type: grpc.TypeString},
+				{Name: "platform", Number: 9, Type: grpc.TypeString},
+				{Name: "module", Number: 10, Type: grpc.TypeMessage, TypeName: ".backend.v1.Version.Module"},
+				{Name: "vcs", Number: 11, Type: grpc.TypeMessage, TypeName: ".backend.v1.Version.VCS"},
+			},
+			Nested: []grpc.MessageType{
+				{Name: "Module", Fields: []grpc.FieldType{
+					{Name: "path", Number: 1, Type: grpc.TypeString},
+					{Name: "version", Number: 2, Type: grpc.TypeString},
+					{Name: "sum", Number: 3, Type: grpc.TypeString},
+				}},
+				{Name: "VCS", Fields: []grpc.FieldType{
+					{Name: "system", Number: 1, Type: grpc.TypeString},
+					{Name: "revision", Number: 2, Type: grpc.TypeString},
+					{Name: "time", Number: 3, Type: grpc.TypeString},
+					{Name: "modified", Number: 4, Type: grpc.TypeBool},
+				}},
+			},
+		},
+		{Name: "GetHealthRequest"},
+		{Name: "Health", Fields: []grpc.FieldType{
+			{Name: "status", Number: 1, Type: grpc.TypeString},
+			{Name: "timestamp", Number: 2, Type: grpc.TypeString},
+			{Name: "start_time", Number: 3, Type: grpc.TypeString},
+			{Name: "uptime_seconds", Number: 4, Type: grpc.TypeDouble},
+			{Name: "version", Number: 5, Type: grpc.TypeString},
+		}},
+	},
+}
+
+// newGRPCHandler serves BackendService, the health service and reflection.
+// Requests pass through the i18n middleware, so the welcome message
+// follows an accept-language metadata entry.
+func (s *Server) newGRPCHandler() http.Handler {
+	srv := grpc.NewServer()
+	f := backendProto
+	f.Services = []grpc.Service{{Name: "BackendService", Methods: []grpc.Method{
+		{Name: "GetInfo", Input: ".backend.v1.GetInfoRequest", Output: ".backend.v1.Info", Handler: grpc.Unary(s.grpcInfo)},
+		{Name: "GetVersion", Input: ".backend.v1.GetVersionRequest", Output: ".backend.v1.Version", Handler: grpc.Unary(s.grpcVersion)},
+		{Name: "GetHealth", Input: ".backend.v1.GetHealthRequest", Output: ".backend.v1.Health", Handler: grpc.Unary(s.grpcHealth)},
+	}}}
+	srv.Register(f)
+	grpc.RegisterHealth(srv, s.grpcHealthStatus)
+	grpc.RegisterReflection(srv)
+	return s.messages.Middleware(srv)
+}
+
+// newGRPCServer returns the listener of GRPC_PORT: HTTP/2 without TLS,
+// which is what kubelet gRPC probes and grpcurl -plaintext speak. Calls
+// are canceled when ctx is, so Watch streams don't hold up the shutdown.
+func (s *Server) newGRPCServer(ctx context.Context) *http.Server {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Server{
+		Addr:              ":" + s.cfg.GRPCPort,
+		Handler:           s.newGRPCHandler(),
+		Protocols:         &protocols,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return ctx },
+	}
+}
+
+func (s *Server) grpcInfo(ctx context.Context, _ []byte) (grpc.Message, error) {
+	data := s.infoConfig().TemplateData()
+	topology := grpc.Message{}.AppendString(1, data.Region).AppendString(2, data.Zone)
+	return grpc.Message(nil).
+		AppendString(1, s.cfg.ServiceName).
+		AppendString(2, s.cfg.Environment).
+		AppendString(3, s.cfg.Hostname).
+		AppendMessage(4, topology).
+		AppendString(5, s.welcomeMessage(ctx, data)), nil
+}
+
+func (s *Server) grpcVersion(context.Context, []byte) (grpc.Message, error) {
+	build := s.cfg.Build
+	m := grpc.Message(nil).
+		AppendString(1, build.Version).
+		AppendString(2, build.BuildTime).
+		AppendString(3, build.GitCommit).
+		AppendString(4, build.GoVersion).
+		AppendString(5, build.GitBranch).
+		AppendString(6, build.GitTag).
+		AppendBool(7, build.GitDirty).
+		AppendString(8, build.BuildUser).
+		AppendString(9, build.Platform)
+	if build.ModulePath != "" {
+		m = m.AppendMessage(10, grpc.Message{}.AppendString(1, build.ModulePath).
+			AppendString(2, build.ModuleVersion).AppendString(3, build.ModuleSum))
+	}
+	if build.VCS != "" {
+		m = m.AppendMessage(11, grpc.Message{}.AppendString(1, build.VCS).
+			AppendString(2, build.VCSRevision).AppendString(3, build.VCSTime).AppendBool(4, build.VCSModified))
+	}
+	return m, nil
+}
+
+func (s *Server) grpcHealth(context.Context, []byte) (grpc.Message, error) {
+	h := handlers.NewHealthResponse("healthy", s.cfg.Build.Version)
+	return grpc.Message(nil).
+		AppendString(1, h.Status).
+		AppendString(2, h.Timestamp).
+		AppendString(3, h.StartTime).
+		AppendDouble(4, h.UptimeSeconds).
+		AppendString(5, h.Version), nil
+}
+
+// grpcHealthStatus answers the health service: "" is serving while the
+// process runs, like /healthz, and BackendService while /readyz passes.
+func (s *Server) grpcHealthStatus(ctx context.Context, service string) (grpc.HealthStatus, bool) {
+	switch service {
+	case "":
+		return grpc.StatusServing, true
+	case grpcServiceName:
+		if status := s.readinessStatus(ctx); status == "ready" || status == "degraded" {
+			return grpc.StatusServing, true
+		}
+		return grpc.StatusNotServing, true
+	}
+	return grpc.StatusUnknown, false
+}
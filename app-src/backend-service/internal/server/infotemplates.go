@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+)
+
+// templateFuncs are the functions response templates can call besides the
+// builtins of text/template.
+var templateFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	// default returns value, or fallback when it's empty:
+	// {{default "stable" .Track}}
+	"default": func(fallback, value string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	},
+}
+
+// sampleTemplateData is rendered when a template is parsed, so a field
+// that doesn't exist fails the config rather than requests.
+var sampleTemplateData = handlers.TemplateData{
+	Service: "backend-service", Environment: "development", Version: "v1.0.0", GitCommit: "4f1c2a9",
+	Hostname: "backend-service-0", Track: "stable", Region: "eu-west-1", Zone: "eu-west-1a",
+	Pod: "backend-service-0", Namespace: "gitops-demo-dev",
+}
+
+// infoFieldName is the syntax of the names of INFO_FIELDS.
+var infoFieldName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// infoTemplates are the parsed INFO_MESSAGE and INFO_FIELDS.
+type infoTemplates struct {
+	// message is nil when INFO_MESSAGE is empty
+	message *template.Template
+	// fields are named after their field, in the configured order
+	fields []*template.Template
+}
+
+func parseInfoTemplates(message string, fields []string) (infoTemplates, error) {
+	var t infoTemplates
+	if message != "" {
+		tmpl, err := parseResponseTemplate("INFO_MESSAGE", strings.TrimSpace(message))
+		if err != nil {
+			return t, err
+		}
+		t.message = tmpl
+	}
+	seen := make(map[string]bool, len(fields))
+	for _, field := range fields {
+		name, text, ok := strings.Cut(field, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !infoFieldName.MatchString(name) {
+			return t, fmt.Errorf("INFO_FIELDS: %q isn't name=template", field)
+		}
+		if seen[name] {
+			return t, fmt.Errorf("INFO_FIELDS: %s is set twice", name)
+		}
+		seen[name] = true
+		tmpl, err := parseResponseTemplate(name, strings.TrimSpace(text))
+		if err != nil {
+			return t, fmt.Errorf("INFO_FIELDS: %w", err)
+		}
+		t.fields = append(t.fields, tmpl)
+	}
+	return t, nil
+}
+
+func parseResponseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, sampleTemplateData); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// infoConfig describes the replica to /api/v1/info, the status page and
+// the gRPC GetInfo, which render the templates with its TemplateData.
+func (s *Server) infoConfig() handlers.InfoConfig {
+	return handlers.InfoConfig{
+		ServiceName: s.cfg.ServiceName,
+		Environment: s.cfg.Environment,
+		Hostname:    s.cfg.Hostname,
+		Track:       s.track,
+		Build:       s.cfg.Build,
+		Topology:    s.topology.get,
+		Message:     s.welcomeMessage,
+		Fields:      s.infoFields,
+		Extended:    func() bool { return s.flags.enabled(flagExtendedInfo) },
+		Labels:      podLabels(s.cfg.PodLabelsFile),
+		Pod: handlers.InfoPod{
+			Name:      s.cfg.PodName,
+			Namespace: s.cfg.PodNamespace,
+			NodeName:  s.cfg.NodeName,
+			IP:        s.cfg.PodIP,
+		},
+	}
+}
+
+// renderTemplate renders tmpl with data; a failure is logged and renders
+// nothing.
+func renderTemplate(tmpl *template.Template, data handlers.TemplateData) string {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		log.Printf("Error rendering template %s: %v", tmpl.Name(), err)
+		return ""
+	}
+	return b.String()
+}
+
+// catalogTemplates caches the welcome messages of the catalogs that are
+// templates, by their text; one that doesn't parse is kept as nil and
+// shown as it is.
+var catalogTemplates sync.Map
+
+// welcomeMessage is INFO_MESSAGE, else the welcome message of the
+// request's language, rendered with data.
+func (s *Server) welcomeMessage(ctx context.Context, data handlers.TemplateData) string {
+	if tmpl := s.live.get().templates.message; tmpl != nil {
+		return renderTemplate(tmpl, data)
+	}
+	msg := i18n.T(ctx, "info.welcome")
+	if !strings.Contains(msg, "{{") {
+		return msg
+	}
+	cached, ok := catalogTemplates.Load(msg)
+	if !ok {
+		tmpl, err := parseResponseTemplate("info.welcome", msg)
+		if err != nil {
+			log.Printf("Error parsing the welcome message %q: %v", msg, err)
+		}
+		cached, _ = catalogTemplates.LoadOrStore(msg, tmpl)
+	}
+	if tmpl := cached.(*template.Template); tmpl != nil {
+		return renderTemplate(tmpl, data)
+	}
+	return msg
+}
+
+// infoFields renders INFO_FIELDS with data; nil when there are none.
+func (s *Server) infoFields(data handlers.TemplateData) map[string]string {
+	templates := s.live.get().templates.fields
+	if len(templates) == 0 {
+		return nil
+	}
+	fields := make(map[string]string, len(templates))
+	for _, tmpl := range templates {
+		fields[tmpl.Name()] = renderTemplate(tmpl, data)
+	}
+	return fields
+}
@@ -0,0 +1,303 @@
+//go:build integration
+
+// Integration tests run the server on a real listener against real (or
+// containerised) dependencies. They are excluded from the default test run;
+// use `make test-integration` or `go test -tags integration ./...`.
+//
+// The PostgreSQL, Redis and NATS tests start the real server in a throwaway
+// container per test, as testcontainers does, through the docker CLI so the
+// module takes no dependency for it. They are skipped where docker isn't on
+// the PATH.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/migrate"
+	"github.com/anasadan/gitops-demo/backend-service/internal/nats"
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+)
+
+// fakeRegistry records the registry calls made by the server.
+type fakeRegistry struct {
+	mu       sync.Mutex
+	requests []string
+	instance InstanceRegistration
+}
+
+func (fr *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	fr.requests = append(fr.requests, r.Method+" "+r.URL.Path)
+	if r.Method == http.MethodPut {
+		_ = json.NewDecoder(r.Body).Decode(&fr.instance)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fr *fakeRegistry) calls() []string {
+	fr.mu.Lock()
+	defer fr.mu.Unlock()
+	return append([]string(nil), fr.requests...)
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	return port
+}
+
+func TestServerLifecycle(t *testing.T) {
+	registry := &fakeRegistry{}
+	registrySrv := httptest.NewServer(registry)
+	defer registrySrv.Close()
+
+	port := freePort(t)
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.Port = port
+		cfg.RegistryURL = registrySrv.URL
+		cfg.RegistryHeartbeat = time.Hour
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- s.Run(ctx) }()
+
+	base := "http://127.0.0.1:" + port
+	readiness := func() string {
+		resp, err := http.Get(base + "/readyz")
+		if err != nil {
+			return ""
+		}
+		defer resp.Body.Close()
+		var body handlers.HealthResponse
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return body.Status
+	}
+
+	// Not ready during the simulated startup, ready after it.
+	deadline := time.Now().Add(s.startupDelay + 3*time.Second)
+	for status := readiness(); status != "ready"; status = readiness() {
+		if time.Now().After(deadline) {
+			t.Fatalf("server not ready after %s, last status %q", s.startupDelay+3*time.Second, status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	if calls := registry.calls(); len(calls) == 0 || calls[0] != "PUT /instances/test-host" {
+		t.Errorf("registry calls = %v, want a PUT registration first", calls)
+	}
+	if got, want := registry.instance.URL, "http://127.0.0.1:"+port; got != want {
+		t.Errorf("registered URL = %q, want %q", got, want)
+	}
+
+	cancel()
+	select {
+	case err := <-runErr:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	calls := registry.calls()
+	if calls[len(calls)-1] != "DELETE /instances/test-host" {
+		t.Errorf("registry calls = %v, want a DELETE deregistration last", calls)
+	}
+	if _, err := http.Get(base + "/healthz"); err == nil {
+		t.Error("server still accepting connections after shutdown")
+	}
+}
+
+func TestServerFailsOnPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Port = port })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.Run(ctx); err == nil {
+		t.Fatal("Run succeeded on a port that is already in use")
+	}
+}
+
+// startContainer runs image with env until the test ends and returns the
+// host:port its port is published on.
+func startContainer(t *testing.T, image, port string, env ...string) string {
+	t.Helper()
+	docker, err := exec.LookPath("docker")
+	if err != nil {
+		t.Skip("docker not found; skipping container test")
+	}
+	args := []string{"run", "--detach", "--rm", "--publish", "127.0.0.1::" + port}
+	for _, e := range env {
+		args = append(args, "--env", e)
+	}
+	out, err := exec.Command(docker, append(args, image)...).Output()
+	if err != nil {
+		t.Fatalf("docker run %s: %v", image, err)
+	}
+	id := strings.TrimSpace(string(out))
+	t.Cleanup(func() { _ = exec.Command(docker, "rm", "--force", id).Run() })
+	out, err = exec.Command(docker, "port", id, port+"/tcp").Output()
+	if err != nil {
+		t.Fatalf("docker port %s: %v", image, err)
+	}
+	addr, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return addr
+}
+
+// waitUntilUp retries check until it succeeds, failing the test after a
+// minute.
+func waitUntilUp(t *testing.T, what string, check func(ctx context.Context) error) {
+	t.Helper()
+	deadline := time.Now().Add(time.Minute)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := check(ctx)
+		cancel()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not up after a minute: %v", what, err)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func TestItemsInPostgres(t *testing.T) {
+	addr := startContainer(t, "postgres:16-alpine", "5432",
+		"POSTGRES_USER=backend", "POSTGRES_PASSWORD=s3cret", "POSTGRES_DB=backend")
+	host, port, _ := net.SplitHostPort(addr)
+
+	db := postgres.Open(postgres.Config{Host: host, Port: port, User: "backend", Password: "s3cret", Database: "backend"})
+	defer db.Close()
+	waitUntilUp(t, "postgres", func(ctx context.Context) error {
+		_, err := db.Query(ctx, "SELECT 1")
+		return err
+	})
+	migrations, err := migrate.Embedded()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrate.New(db, migrations).Up(context.Background(), 0); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.DatabaseHost, cfg.DatabasePort = host, port
+		cfg.DatabaseUser, cfg.DatabasePassword, cfg.DatabaseName = "backend", "s3cret", "backend"
+	})
+	defer s.db.Close()
+
+	rec := serve(s, http.MethodPost, "/api/v1/items", []byte(`{"name":"widget","description":"blue"}`), nil)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /api/v1/items = %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	rec = serve(s, http.MethodPut, location, []byte(`{"name":"widget","description":"red"}`), nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT %s = %d: %s", location, rec.Code, rec.Body)
+	}
+	var list ItemsResponse
+	rec = serve(s, http.MethodGet, "/api/v1/items", nil, nil)
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Storage != itemStoragePostgres || len(list.Items) != 1 || list.Items[0].Description != "red" {
+		t.Errorf("GET /api/v1/items = %+v, want the updated item from postgres", list)
+	}
+	if rec := serve(s, http.MethodDelete, location, nil, nil); rec.Code != http.StatusNoContent {
+		t.Errorf("DELETE %s = %d", location, rec.Code)
+	}
+	if rec := serve(s, http.MethodGet, location, nil, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s after DELETE = %d, want 404", location, rec.Code)
+	}
+}
+
+func TestResponseCacheInRedis(t *testing.T) {
+	addr := startContainer(t, "redis:7-alpine", "6379")
+	s := newTestServer(t, func(cfg *config.Config) { cfg.RedisAddr = addr })
+	defer s.cache.close()
+	waitUntilUp(t, "redis", s.cache.ping)
+
+	cacheStatus := func() string {
+		rec := serve(s, http.MethodGet, "/api/v1/items", nil, nil)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /api/v1/items = %d: %s", rec.Code, rec.Body)
+		}
+		return rec.Header().Get("X-Cache")
+	}
+	if got := cacheStatus(); got != "MISS" {
+		t.Errorf("first GET X-Cache = %q, want MISS", got)
+	}
+	if got := cacheStatus(); got != "HIT" {
+		t.Errorf("second GET X-Cache = %q, want HIT", got)
+	}
+	// Creating an item invalidates the cached list.
+	serve(s, http.MethodPost, "/api/v1/items", []byte(`{"name":"widget"}`), nil)
+	if got := cacheStatus(); got != "MISS" {
+		t.Errorf("GET after POST X-Cache = %q, want MISS", got)
+	}
+}
+
+func TestEventsOnNATS(t *testing.T) {
+	addr := startContainer(t, "nats:2.10-alpine", "4222")
+	var conn *nats.Conn
+	waitUntilUp(t, "nats", func(ctx context.Context) (err error) {
+		conn, err = nats.Dial(ctx, nats.Config{URL: "nats://" + addr})
+		return err
+	})
+	defer conn.Close()
+	sub, err := conn.Subscribe("demo.events.item.created", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	s := newTestServer(t, func(cfg *config.Config) {
+		cfg.EventBrokerURL, cfg.EventTopic = "nats://"+addr, "demo.events"
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.bus.Run(ctx)
+
+	serve(s, http.MethodPost, "/api/v1/items", []byte(`{"name":"widget"}`), nil)
+	waitCtx, waitCancel := context.WithTimeout(ctx, 10*time.Second)
+	defer waitCancel()
+	msg, err := sub.Next(waitCtx)
+	if err != nil {
+		t.Fatalf("no item.created event: %v", err)
+	}
+	var event struct {
+		Type string          `json:"type"`
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(msg.Data, &event); err != nil || event.Type != eventItemCreated || !strings.Contains(string(event.Data), `"widget"`) {
+		t.Errorf("event = %s (%v), want an item.created CloudEvent of the widget", msg.Data, err)
+	}
+}
@@ -0,0 +1,337 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// Where items are kept, as reported by ItemsResponse.
+const (
+	itemStoragePostgres = "postgres"
+	itemStorageMemory   = "memory"
+)
+
+type ItemRequest struct {
+	Name        string `json:"name" validate:"required,max=200"`
+	Description string `json:"description" validate:"max=2000"`
+}
+
+type ItemResponse struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	CreatedAt   string `json:"created_at"`
+	UpdatedAt   string `json:"updated_at"`
+}
+
+type ListItemsRequest struct {
+	Limit  int `query:"limit" validate:"min=1,max=1000"`
+	Offset int `query:"offset" validate:"min=0"`
+}
+
+// ItemsResponse is one page of items, ordered by ID.
+type ItemsResponse struct {
+	Items  []ItemResponse `json:"items"`
+	Limit  int            `json:"limit"`
+	Offset int            `json:"offset"`
+	// "postgres", or "memory" when no database is configured
+	Storage string `json:"storage"`
+}
+
+// errItemNotFound is returned for an ID no item has.
+var errItemNotFound = errors.New("item not found")
+
+// itemStore keeps the items of /api/v1/items.
+type itemStore interface {
+	list(ctx context.Context, limit, offset int) ([]ItemResponse, error)
+	get(ctx context.Context, id int64) (ItemResponse, error)
+	create(ctx context.Context, req ItemRequest) (ItemResponse, error)
+	update(ctx context.Context, id int64, req ItemRequest) (ItemResponse, error)
+	delete(ctx context.Context, id int64) error
+	storage() string
+}
+
+const itemColumns = "id, name, description, created_at, updated_at"
+
+// pgItems keeps items in PostgreSQL, shared by every replica. The table is
+// created by `backend-service migrate up`.
+type pgItems struct {
+	db *postgres.DB
+}
+
+func (p *pgItems) storage() string { return itemStoragePostgres }
+
+// query runs sql and returns its rows as items.
+func (p *pgItems) query(ctx context.Context, sql string, args ...any) ([]ItemResponse, *postgres.Result, error) {
+	res, err := p.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	items := make([]ItemResponse, 0, len(res.Rows))
+	for _, row := range res.Rows {
+		if len(row) != 5 || row[0] == nil || row[1] == nil || row[2] == nil || row[3] == nil || row[4] == nil {
+			return nil, nil, errors.New("unexpected row in items")
+		}
+		id, err := strconv.ParseInt(*row[0], 10, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, ItemResponse{
+			ID:          id,
+			Name:        *row[1],
+			Description: *row[2],
+			CreatedAt:   pgTimestamp(*row[3]),
+			UpdatedAt:   pgTimestamp(*row[4]),
+		})
+	}
+	return items, res, nil
+}
+
+// one returns the single item of a query, errItemNotFound without one.
+func (p *pgItems) one(ctx context.Context, sql string, args ...any) (ItemResponse, error) {
+	items, _, err := p.query(ctx, sql, args...)
+	if err != nil {
+		return ItemResponse{}, err
+	}
+	if len(items) == 0 {
+		return ItemResponse{}, errItemNotFound
+	}
+	return items[0], nil
+}
+
+func (p *pgItems) list(ctx context.Context, limit, offset int) ([]ItemResponse, error) {
+	items, _, err := p.query(ctx, "SELECT "+itemColumns+" FROM items ORDER BY id LIMIT $1 OFFSET $2", limit, offset)
+	return items, err
+}
+
+func (p *pgItems) get(ctx context.Context, id int64) (ItemResponse, error) {
+	return p.one(ctx, "SELECT "+itemColumns+" FROM items WHERE id = $1", id)
+}
+
+func (p *pgItems) create(ctx context.Context, req ItemRequest) (ItemResponse, error) {
+	return p.one(ctx, "INSERT INTO items (name, description) VALUES ($1, $2) RETURNING "+itemColumns,
+		req.Name, req.Description)
+}
+
+func (p *pgItems) update(ctx context.Context, id int64, req ItemRequest) (ItemResponse, error) {
+	return p.one(ctx, "UPDATE items SET name = $2, description = $3, updated_at = now() WHERE id = $1 RETURNING "+itemColumns,
+		id, req.Name, req.Description)
+}
+
+func (p *pgItems) delete(ctx context.Context, id int64) error {
+	_, res, err := p.query(ctx, "DELETE FROM items WHERE id = $1", id)
+	if err == nil && res.RowsAffected() == 0 {
+		err = errItemNotFound
+	}
+	return err
+}
+
+// pgTimestamp converts a timestamptz to RFC 3339, leaving values that don't
+// parse as they are.
+func pgTimestamp(value string) string {
+	t, err := time.Parse(postgres.TimestampLayout, value)
+	if err != nil {
+		return value
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// memItems keeps items in memory when no database is configured, so the
+// API works on a laptop; each replica has its own items, lost on restart.
+type memItems struct {
+	mu     sync.Mutex
+	items  map[int64]ItemResponse
+	lastID int64
+}
+
+func newMemItems() *memItems {
+	return &memItems{items: make(map[int64]ItemResponse)}
+}
+
+func (m *memItems) storage() string { return itemStorageMemory }
+
+func (m *memItems) list(_ context.Context, limit, offset int) ([]ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	items := make([]ItemResponse, 0, len(m.items))
+	for _, item := range m.items {
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	if offset >= len(items) {
+		return []ItemResponse{}, nil
+	}
+	return items[offset:min(offset+limit, len(items))], nil
+}
+
+func (m *memItems) get(_ context.Context, id int64) (ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[id]
+	if !ok {
+		return ItemResponse{}, errItemNotFound
+	}
+	return item, nil
+}
+
+func (m *memItems) create(_ context.Context, req ItemRequest) (ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastID++
+	now := time.Now().UTC().Format(time.RFC3339Nano)
+	item := ItemResponse{ID: m.lastID, Name: req.Name, Description: req.Description, CreatedAt: now, UpdatedAt: now}
+	m.items[item.ID] = item
+	return item, nil
+}
+
+func (m *memItems) update(_ context.Context, id int64, req ItemRequest) (ItemResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.items[id]
+	if !ok {
+		return ItemResponse{}, errItemNotFound
+	}
+	item.Name, item.Description = req.Name, req.Description
+	item.UpdatedAt = time.Now().UTC().Format(time.RFC3339Nano)
+	m.items[id] = item
+	return item, nil
+}
+
+func (m *memItems) delete(_ context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.items[id]; !ok {
+		return errItemNotFound
+	}
+	delete(m.items, id)
+	return nil
+}
+
+// itemsHandler lists items with GET ?limit=&offset=, and creates one with
+// POST {"name": "...", "description": "..."}, answering 201 with its URL
+// in Location.
+func (s *Server) itemsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if r.Method == http.MethodPost {
+		var req ItemRequest
+		if err := validate.DecodeJSON(w, r, &req, 16<<10); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		item, err := s.items.create(ctx, req)
+		if err != nil {
+			s.itemError(w, r, "", err)
+			return
+		}
+		s.cache.invalidate(ctx, s.itemsCacheNamespace(r))
+		s.bus.Emit(eventItemCreated, strconv.FormatInt(item.ID, 10), item)
+		w.Header().Set("Location", apiV1Prefix+"/items/"+strconv.FormatInt(item.ID, 10))
+		writeItem(w, http.StatusCreated, item)
+		return
+	}
+
+	req := ListItemsRequest{Limit: 100}
+	if err := validate.DecodeQuery(r, &req); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	items, err := s.items.list(ctx, req.Limit, req.Offset)
+	if err != nil {
+		s.itemError(w, r, "", err)
+		return
+	}
+	resp := ItemsResponse{Items: items, Limit: req.Limit, Offset: req.Offset, Storage: s.items.storage()}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding items response: %v", err)
+	}
+}
+
+// itemHandler reads an item with GET, replaces it with PUT and deletes it
+// with DELETE, which answers 204.
+func (s *Server) itemHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	raw := router.Param(r, "id")
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil {
+		s.itemError(w, r, raw, errItemNotFound)
+		return
+	}
+	var item ItemResponse
+	switch r.Method {
+	case http.MethodPut:
+		var req ItemRequest
+		if err := validate.DecodeJSON(w, r, &req, 16<<10); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		item, err = s.items.update(ctx, id, req)
+		if err == nil {
+			s.cache.invalidate(ctx, s.itemsCacheNamespace(r))
+			s.bus.Emit(eventItemUpdated, raw, item)
+		}
+	case http.MethodDelete:
+		if err := s.items.delete(ctx, id); err != nil {
+			s.itemError(w, r, raw, err)
+			return
+		}
+		s.cache.invalidate(ctx, s.itemsCacheNamespace(r))
+		s.bus.Emit(eventItemDeleted, raw, itemDeletedEvent{ID: id})
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		item, err = s.items.get(ctx, id)
+	}
+	if err != nil {
+		s.itemError(w, r, raw, err)
+		return
+	}
+	writeItem(w, http.StatusOK, item)
+}
+
+// itemsCacheNamespace groups the cached item lists, invalidated by every
+// write. Items kept in memory differ between replicas, so each caches its
+// own.
+func (s *Server) itemsCacheNamespace(*http.Request) string {
+	if s.items.storage() == itemStorageMemory {
+		return "items:" + s.cfg.Hostname
+	}
+	return "items"
+}
+
+// itemError answers 404 for a missing item and 503 when the database
+// fails.
+func (s *Server) itemError(w http.ResponseWriter, r *http.Request, id string, err error) {
+	ctx := r.Context()
+	if errors.Is(err, errItemNotFound) {
+		problem.Error(w, r, i18n.T(ctx, "error.not_found", "item "+id), http.StatusNotFound)
+		return
+	}
+	if postgres.HasCode(err, postgres.CodeUndefinedTable) {
+		log.Printf("Error querying items: %v; run `backend-service migrate up`", err)
+	} else {
+		log.Printf("Error querying items: %v", err)
+	}
+	problem.Error(w, r, i18n.T(ctx, "error.database"), http.StatusServiceUnavailable)
+}
+
+func writeItem(w http.ResponseWriter, status int, item ItemResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(item); err != nil {
+		log.Printf("Error encoding item response: %v", err)
+	}
+}
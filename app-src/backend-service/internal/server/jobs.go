@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+type job struct {
+	duration   time.Duration
+	enqueuedAt time.Time
+	// Optional hooks of tracked jobs (tasks). finished gets ctx.Err() when
+	// the job was interrupted or dropped on shutdown.
+	started  func()
+	finished func(error)
+}
+
+type EnqueueJobsRequest struct {
+	Count int `json:"count" validate:"min=1"`
+	// Simulated work per job, at most a minute
+	DurationMs int64 `json:"duration_ms" validate:"min=0,max=60000"`
+}
+
+type EnqueueJobsResponse struct {
+	Enqueued   int   `json:"enqueued"`
+	QueueDepth int64 `json:"queue_depth"`
+}
+
+// QueueMetricsResponse is shaped for KEDA's metrics-api scaler, whose
+// valueLocation points at queue_depth (or backlog_per_worker).
+type QueueMetricsResponse struct {
+	QueueDepth           int64   `json:"queue_depth"`
+	InProgress           int64   `json:"in_progress"`
+	Workers              int     `json:"workers"`
+	BacklogPerWorker     float64 `json:"backlog_per_worker"`
+	OldestPendingSeconds float64 `json:"oldest_pending_seconds"`
+	Completed            int64   `json:"completed"`
+	Capacity             int     `json:"capacity"`
+	Timestamp            string  `json:"timestamp"`
+}
+
+// jobQueue is an in-memory FIFO of simulated background jobs processed by a
+// fixed pool of workers. Its backlog is the signal the worker Deployment is
+// autoscaled on in the demos.
+type jobQueue struct {
+	workers  int
+	capacity int
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	pending    []job
+	closed     bool
+	inProgress int64
+	completed  int64
+}
+
+func newJobQueue(workers, capacity int) *jobQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	jq := &jobQueue{workers: workers, capacity: capacity}
+	jq.cond = sync.NewCond(&jq.mu)
+	return jq
+}
+
+func (jq *jobQueue) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < jq.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jq.work(ctx)
+		}()
+	}
+	<-ctx.Done()
+
+	jq.mu.Lock()
+	jq.closed = true
+	dropped := jq.pending
+	jq.pending = nil
+	jq.mu.Unlock()
+	jq.cond.Broadcast()
+	wg.Wait()
+	for _, j := range dropped {
+		if j.finished != nil {
+			j.finished(ctx.Err())
+		}
+	}
+	if len(dropped) > 0 {
+		log.Printf("Dropped %d pending jobs on shutdown", len(dropped))
+	}
+}
+
+func (jq *jobQueue) work(ctx context.Context) {
+	for {
+		jq.mu.Lock()
+		for len(jq.pending) == 0 && !jq.closed {
+			jq.cond.Wait()
+		}
+		if jq.closed {
+			jq.mu.Unlock()
+			return
+		}
+		j := jq.pending[0]
+		jq.pending = jq.pending[1:]
+		jq.inProgress++
+		jq.mu.Unlock()
+
+		if j.started != nil {
+			j.started()
+		}
+		var err error
+		select {
+		case <-time.After(j.duration):
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if j.finished != nil {
+			j.finished(err)
+		}
+
+		jq.mu.Lock()
+		jq.inProgress--
+		jq.completed++
+		jq.mu.Unlock()
+	}
+}
+
+// enqueue adds up to count jobs and returns how many fit in the queue.
+func (jq *jobQueue) enqueue(count int, duration time.Duration) int {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	if jq.closed {
+		return 0
+	}
+	if free := jq.capacity - len(jq.pending); count > free {
+		count = free
+	}
+	now := time.Now()
+	for i := 0; i < count; i++ {
+		jq.pending = append(jq.pending, job{duration: duration, enqueuedAt: now})
+	}
+	jq.cond.Broadcast()
+	return count
+}
+
+// submit adds one job with the given hooks, failing when the queue is full.
+func (jq *jobQueue) submit(j job) bool {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	if jq.closed || len(jq.pending) >= jq.capacity {
+		return false
+	}
+	j.enqueuedAt = time.Now()
+	jq.pending = append(jq.pending, j)
+	jq.cond.Broadcast()
+	return true
+}
+
+// depth is the number of jobs waiting for a worker.
+func (jq *jobQueue) depth() int64 {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	return int64(len(jq.pending))
+}
+
+func (jq *jobQueue) metrics(now time.Time) QueueMetricsResponse {
+	jq.mu.Lock()
+	defer jq.mu.Unlock()
+	resp := QueueMetricsResponse{
+		QueueDepth:       int64(len(jq.pending)),
+		InProgress:       jq.inProgress,
+		Workers:          jq.workers,
+		BacklogPerWorker: math.Round(float64(len(jq.pending))/float64(jq.workers)*100) / 100,
+		Completed:        jq.completed,
+		Capacity:         jq.capacity,
+		Timestamp:        now.UTC().Format(time.RFC3339),
+	}
+	if len(jq.pending) > 0 {
+		resp.OldestPendingSeconds = math.Round(now.Sub(jq.pending[0].enqueuedAt).Seconds()*10) / 10
+	}
+	return resp
+}
+
+// enqueueHandler accepts POST {"count": 10, "duration_ms": 500} to simulate
+// a burst of background work.
+func (jq *jobQueue) enqueueHandler(w http.ResponseWriter, r *http.Request) {
+	req := EnqueueJobsRequest{Count: 1, DurationMs: 1000}
+	if err := validate.DecodeJSON(w, r, &req, 1<<10); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+
+	enqueued := jq.enqueue(req.Count, time.Duration(req.DurationMs)*time.Millisecond)
+	w.Header().Set("Content-Type", "application/json")
+	if enqueued < req.Count {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	if err := json.NewEncoder(w).Encode(EnqueueJobsResponse{
+		Enqueued:   enqueued,
+		QueueDepth: jq.depth(),
+	}); err != nil {
+		log.Printf("Error encoding enqueue response: %v", err)
+	}
+}
+
+func (jq *jobQueue) metricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(jq.metrics(time.Now())); err != nil {
+		log.Printf("Error encoding queue metrics response: %v", err)
+	}
+}
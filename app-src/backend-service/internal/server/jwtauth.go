@@ -0,0 +1,254 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/jwt"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// jwksTimeout bounds a fetch of the JWKS URL.
+const jwksTimeout = 10 * time.Second
+
+// jwtAuth requires a valid JWT bearer token on the routes of chains with the
+// "jwt" middleware, and hands its claims to the handlers. The shared secrets
+// are JWT_SECRET and the lines of JWT_SECRET_FILE, a mounted Secret that's
+// read again when the kubelet updates it, so a new secret can be added next
+// to the old one and the old one dropped later, without a restart. Keys of
+// a JWKS URL are refetched on their own when tokens name new ones.
+type jwtAuth struct {
+	verifier  *jwt.Verifier
+	keys      *jwt.KeySet
+	secret    []byte
+	file      string
+	allowlist []string
+	metrics   *httpMetrics
+
+	mu      sync.RWMutex
+	secrets [][]byte
+	stamp   string
+}
+
+// newJWTAuth returns nil when no secret or JWKS URL is configured. It fails
+// when the secret file can't be read, so a missing Secret stops the pod at
+// startup rather than refusing every request.
+func newJWTAuth(cfg config.Config, m *httpMetrics) (*jwtAuth, error) {
+	if !cfg.JWTEnabled() {
+		return nil, nil
+	}
+	a := &jwtAuth{
+		secret:    []byte(cfg.JWTSecret),
+		file:      cfg.JWTSecretFile,
+		allowlist: cfg.JWTAllowlist,
+		metrics:   m,
+	}
+	if cfg.JWTJWKSURL != "" {
+		a.keys = jwt.NewKeySet(cfg.JWTJWKSURL, &http.Client{Timeout: jwksTimeout})
+	}
+	if _, err := a.reload(); err != nil {
+		return nil, err
+	}
+	a.verifier = jwt.New(jwt.Config{
+		Secrets:  a.currentSecrets,
+		Keys:     a.keys,
+		Issuer:   cfg.JWTIssuer,
+		Audience: cfg.JWTAudience,
+		Leeway:   cfg.JWTLeeway,
+	})
+	return a, nil
+}
+
+func (a *jwtAuth) currentSecrets() [][]byte {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.secrets
+}
+
+// reload reads the secret file if it changed since the last read and
+// reports whether it did. On error the current secrets stay in use.
+func (a *jwtAuth) reload() (bool, error) {
+	stamp := fileStamp(a.file)
+	a.mu.RLock()
+	unchanged := a.secrets != nil && stamp == a.stamp
+	a.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	var secrets [][]byte
+	if len(a.secret) > 0 {
+		secrets = append(secrets, a.secret)
+	}
+	if a.file != "" {
+		data, err := os.ReadFile(a.file)
+		if err != nil {
+			return false, fmt.Errorf("reading JWT secret file: %w", err)
+		}
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			if line = bytes.TrimSpace(line); len(line) > 0 && line[0] != '#' {
+				secrets = append(secrets, line)
+			}
+		}
+	}
+	if secrets == nil {
+		secrets = [][]byte{}
+	}
+	a.mu.Lock()
+	a.secrets, a.stamp = secrets, stamp
+	a.mu.Unlock()
+	if a.file != "" {
+		log.Printf("Loaded %d JWT shared secrets", len(secrets))
+	}
+	return true, nil
+}
+
+// run fetches the JWKS once, so the first requests don't wait for it, and
+// polls the secret file until ctx ends.
+func (a *jwtAuth) run(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	if a.keys != nil {
+		if err := a.keys.Refresh(ctx); err != nil {
+			log.Printf("Warning: %v; retrying when a token needs a key", err)
+		}
+	}
+	if a.file == "" {
+		return
+	}
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := a.reload(); err != nil {
+			log.Printf("Error reloading JWT secrets, keeping the current ones: %v", err)
+		}
+	}
+}
+
+// allowed reports whether path needs no token: it's in the allowlist, or
+// below an entry ending in "/".
+func (a *jwtAuth) allowed(path string) bool {
+	for _, p := range a.allowlist {
+		if path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(path, p)) {
+			return true
+		}
+	}
+	return false
+}
+
+// middleware refuses requests without a valid token with 401, and puts the
+// claims of valid ones in the request context. CORS preflights carry no
+// credentials, so they always pass.
+func (a *jwtAuth) middleware(next http.Handler) http.Handler {
+	if a == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || a.allowed(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			a.refuse(w, r, "missing", i18n.T(r.Context(), "error.token_required"))
+			return
+		}
+		claims, err := a.verifier.Verify(r.Context(), token)
+		if err != nil {
+			a.refuse(w, r, failureReason(err), i18n.T(r.Context(), "error.token_invalid", err))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(jwt.NewContext(r.Context(), claims)))
+	})
+}
+
+// failureReason labels the refusals of invalid tokens.
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrExpired):
+		return "expired"
+	case errors.Is(err, jwt.ErrClaims):
+		return "claims"
+	case errors.Is(err, jwt.ErrSignature):
+		return "signature"
+	}
+	return "malformed"
+}
+
+// refuse answers 401 with the challenge of RFC 6750: tokens that were sent
+// but are invalid get error="invalid_token".
+func (a *jwtAuth) refuse(w http.ResponseWriter, r *http.Request, reason, detail string) {
+	name := unmatchedRoute
+	if route, ok := router.RouteFromContext(r.Context()); ok {
+		name = route.Name
+	}
+	a.metrics.unauthed.Inc(name, reason)
+	challenge, title := `Bearer realm="api"`, "Bearer token required"
+	if reason != "missing" {
+		challenge += `, error="invalid_token"`
+		title = "Invalid bearer token"
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	p := problem.New(http.StatusUnauthorized, detail)
+	p.Type, p.Title = problem.TypeUnauthorized, title
+	problem.Write(w, r, p)
+}
+
+// ClaimsResponse is the response of /api/v1/me: the claims of the request's
+// token.
+type ClaimsResponse struct {
+	Subject   string         `json:"subject"`
+	Issuer    string         `json:"issuer,omitempty"`
+	Audience  []string       `json:"audience,omitempty"`
+	ExpiresAt string         `json:"expires_at,omitempty"`
+	Claims    map[string]any `json:"claims"`
+}
+
+// meHandler shows the claims of the request's token, the way handlers
+// behind the "jwt" middleware see them.
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := jwt.FromContext(r.Context())
+	if !ok {
+		if s.auth == nil {
+			problem.Error(w, r, i18n.T(r.Context(), "error.jwt_disabled"), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		p := problem.New(http.StatusUnauthorized, i18n.T(r.Context(), "error.token_required"))
+		p.Type, p.Title = problem.TypeUnauthorized, "Bearer token required"
+		problem.Write(w, r, p)
+		return
+	}
+	resp := ClaimsResponse{
+		Subject:  claims.Subject(),
+		Issuer:   claims.Issuer(),
+		Audience: claims.Audience(),
+		Claims:   claims,
+	}
+	if exp, ok := claims.Time("exp"); ok {
+		resp.ExpiresAt = exp.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding claims response: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+type KubernetesClientResponse struct {
+	Connected bool             `json:"connected"`
+	Host      string           `json:"host,omitempty"`
+	InCluster bool             `json:"in_cluster"`
+	Namespace string           `json:"namespace,omitempty"`
+	Stats     *k8sclient.Stats `json:"stats,omitempty"`
+}
+
+// podInformer returns the shared informer caching this pod. The rollout
+// watcher, drift check and disruption tracker all read the pod's own object;
+// with the informer running they read it from one watch instead of polling.
+func podInformer(client *k8sclient.Client, namespace, podName string) *k8sclient.Informer {
+	return client.Informer(fmt.Sprintf("/api/v1/namespaces/%s/pods", namespace),
+		url.Values{"fieldSelector": {"metadata.name=" + podName}})
+}
+
+// nodeInformer returns the shared informer caching the node this pod runs on.
+func nodeInformer(client *k8sclient.Client, nodeName string) *k8sclient.Informer {
+	return client.Informer("/api/v1/nodes", url.Values{"fieldSelector": {"metadata.name=" + nodeName}})
+}
+
+func kubernetesClientHandler(client *k8sclient.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		resp := KubernetesClientResponse{}
+		if client != nil {
+			stats := client.Stats()
+			resp.Connected = true
+			resp.Host = client.Host()
+			resp.InCluster = client.InCluster()
+			resp.Namespace = client.Namespace()
+			resp.Stats = &stats
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding kubernetes client response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+
+	// microTimeFormat matches metav1.MicroTime's RFC3339 serialization.
+	microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+type lease struct {
+	APIVersion string               `json:"apiVersion"`
+	Kind       string               `json:"kind"`
+	Metadata   k8sclient.ObjectMeta `json:"metadata"`
+	Spec       leaseSpec            `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int32  `json:"leaseTransitions,omitempty"`
+}
+
+type LeaderResponse struct {
+	Enabled     bool   `json:"enabled"`
+	Identity    string `json:"identity"`
+	Leader      string `json:"leader"`
+	IsLeader    bool   `json:"is_leader"`
+	Lease       string `json:"lease,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	LeaderSince string `json:"leader_since,omitempty"`
+	// Background tasks only the leader runs
+	Tasks []string `json:"tasks"`
+}
+
+// leaderElector implements Lease-based leader election against
+// coordination.k8s.io/v1. Singleton background tasks are registered with
+// runWhenLeader and only run on the replica currently holding the lease.
+// When election is disabled every replica considers itself the leader.
+type leaderElector struct {
+	enabled   bool
+	client    *k8sclient.Client
+	namespace string
+	name      string
+	identity  string
+
+	mu          sync.RWMutex
+	leader      string
+	isLeader    bool
+	leaderSince time.Time
+	tasks       []leaderTask
+}
+
+// leaderTask is a background task run only by the leader.
+type leaderTask struct {
+	name string
+	run  func(context.Context)
+}
+
+func newLeaderElector(enabled bool, client *k8sclient.Client, namespace, name, identity string) *leaderElector {
+	return &leaderElector{
+		enabled:   enabled,
+		client:    client,
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+	}
+}
+
+// runWhenLeader registers a task that is started with a leadership-scoped
+// context each time this replica becomes leader. Must be called before run.
+func (le *leaderElector) runWhenLeader(name string, task func(ctx context.Context)) {
+	le.tasks = append(le.tasks, leaderTask{name: name, run: task})
+}
+
+// run blocks until ctx is cancelled, acquiring and renewing the lease and
+// starting or stopping the registered tasks as leadership changes.
+func (le *leaderElector) run(ctx context.Context) {
+	if !le.enabled {
+		le.setLeader(le.identity, true)
+		le.startTasks(ctx)
+		<-ctx.Done()
+		return
+	}
+
+	for ctx.Err() == nil {
+		if !le.acquire(ctx) {
+			return
+		}
+		log.Printf("Acquired leadership of lease %s/%s", le.namespace, le.name)
+
+		leaderCtx, cancel := context.WithCancel(ctx)
+		le.startTasks(leaderCtx)
+		le.renew(leaderCtx)
+		cancel()
+		le.setLeader("", false)
+
+		if ctx.Err() != nil {
+			le.release()
+			return
+		}
+		log.Printf("Lost leadership of lease %s/%s", le.namespace, le.name)
+	}
+}
+
+// acquire retries until the lease is held by this replica or ctx is done.
+func (le *leaderElector) acquire(ctx context.Context) bool {
+	ticker := time.NewTicker(retryPeriod)
+	defer ticker.Stop()
+	for {
+		if le.tryAcquireOrRenew(ctx) {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew keeps the lease fresh until a renewal fails for longer than
+// renewDeadline or ctx is cancelled.
+func (le *leaderElector) renew(ctx context.Context) {
+	ticker := time.NewTicker(retryPeriod)
+	defer ticker.Stop()
+	lastRenew := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if le.tryAcquireOrRenew(ctx) {
+			lastRenew = time.Now()
+			continue
+		}
+		if time.Since(lastRenew) > renewDeadline {
+			return
+		}
+	}
+}
+
+func (le *leaderElector) tryAcquireOrRenew(ctx context.Context) bool {
+	now := time.Now()
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", le.namespace, le.name)
+
+	var current lease
+	err := le.client.Do(ctx, http.MethodGet, path, nil, &current)
+	if k8sclient.IsStatus(err, http.StatusNotFound) {
+		created := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   k8sclient.ObjectMeta{Name: le.name, Namespace: le.namespace},
+			Spec: leaseSpec{
+				HolderIdentity:       le.identity,
+				LeaseDurationSeconds: int32(leaseDuration / time.Second),
+				AcquireTime:          now.UTC().Format(microTimeFormat),
+				RenewTime:            now.UTC().Format(microTimeFormat),
+			},
+		}
+		collection := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", le.namespace)
+		if err := le.client.Do(ctx, http.MethodPost, collection, created, nil); err != nil {
+			log.Printf("Error creating lease %s/%s: %v", le.namespace, le.name, err)
+			return false
+		}
+		le.setLeader(le.identity, true)
+		return true
+	}
+	if err != nil {
+		log.Printf("Error getting lease %s/%s: %v", le.namespace, le.name, err)
+		return false
+	}
+
+	holder := current.Spec.HolderIdentity
+	if holder != "" && holder != le.identity && !leaseExpired(current.Spec, now) {
+		le.setLeader(holder, false)
+		return false
+	}
+
+	if holder != le.identity {
+		current.Spec.AcquireTime = now.UTC().Format(microTimeFormat)
+		current.Spec.LeaseTransitions++
+	}
+	current.Spec.HolderIdentity = le.identity
+	current.Spec.LeaseDurationSeconds = int32(leaseDuration / time.Second)
+	current.Spec.RenewTime = now.UTC().Format(microTimeFormat)
+
+	if err := le.client.Do(ctx, http.MethodPut, path, current, nil); err != nil {
+		if !k8sclient.IsStatus(err, http.StatusConflict) {
+			log.Printf("Error updating lease %s/%s: %v", le.namespace, le.name, err)
+		}
+		return false
+	}
+	le.setLeader(le.identity, true)
+	return true
+}
+
+// release clears the holder so another replica can take over immediately
+// instead of waiting for the lease to expire.
+func (le *leaderElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", le.namespace, le.name)
+	var current lease
+	if err := le.client.Do(ctx, http.MethodGet, path, nil, &current); err != nil {
+		log.Printf("Error releasing lease %s/%s: %v", le.namespace, le.name, err)
+		return
+	}
+	if current.Spec.HolderIdentity != le.identity {
+		return
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = time.Now().UTC().Format(microTimeFormat)
+	if err := le.client.Do(ctx, http.MethodPut, path, current, nil); err != nil {
+		log.Printf("Error releasing lease %s/%s: %v", le.namespace, le.name, err)
+		return
+	}
+	log.Printf("Released lease %s/%s", le.namespace, le.name)
+}
+
+func leaseExpired(spec leaseSpec, now time.Time) bool {
+	renewed, err := time.Parse(time.RFC3339Nano, spec.RenewTime)
+	if err != nil {
+		return true
+	}
+	return renewed.Add(time.Duration(spec.LeaseDurationSeconds) * time.Second).Before(now)
+}
+
+func (le *leaderElector) startTasks(ctx context.Context) {
+	for _, task := range le.tasks {
+		go task.run(ctx)
+	}
+}
+
+func (le *leaderElector) setLeader(leader string, isLeader bool) {
+	le.mu.Lock()
+	defer le.mu.Unlock()
+	if isLeader && !le.isLeader {
+		le.leaderSince = time.Now()
+	}
+	le.leader = leader
+	le.isLeader = isLeader
+}
+
+// IsLeader reports whether this replica currently holds the lease.
+func (le *leaderElector) IsLeader() bool {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	return le.isLeader
+}
+
+func (le *leaderElector) status() LeaderResponse {
+	le.mu.RLock()
+	defer le.mu.RUnlock()
+	resp := LeaderResponse{
+		Enabled:  le.enabled,
+		Identity: le.identity,
+		Leader:   le.leader,
+		IsLeader: le.isLeader,
+		Tasks:    []string{},
+	}
+	for _, task := range le.tasks {
+		resp.Tasks = append(resp.Tasks, task.name)
+	}
+	if le.enabled {
+		resp.Lease = le.name
+		resp.Namespace = le.namespace
+	}
+	if le.isLeader {
+		resp.LeaderSince = le.leaderSince.UTC().Format(time.RFC3339)
+	}
+	return resp
+}
+
+func (le *leaderElector) handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(le.status()); err != nil {
+		log.Printf("Error encoding leader response: %v", err)
+	}
+}
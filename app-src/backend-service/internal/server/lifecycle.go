@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Types of lifecycle events.
+const (
+	lifecycleStarted   = "started"
+	lifecycleReadiness = "readiness"
+	lifecycleConfig    = "config"
+)
+
+const (
+	// lifecycleHistory is the number of events kept for /events to replay.
+	lifecycleHistory = 100
+	// lifecyclePollInterval is how often readiness is evaluated while
+	// streams are open; probes report it too, but only every few seconds.
+	lifecyclePollInterval = 2 * time.Second
+)
+
+// LifecycleEvent is a change in the life of a replica. IDs are unique to
+// the replica that sent them.
+type LifecycleEvent struct {
+	ID        string `json:"id"`
+	Type      string `json:"type"`
+	Time      string `json:"time"`
+	Pod       string `json:"pod"`
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	// ready, degraded or the reason the replica doesn't get traffic
+	Readiness string `json:"readiness"`
+	Message   string `json:"message"`
+}
+
+// LifecycleEventsResponse is the /events response to clients that don't
+// accept text/event-stream: the replica's recent events, oldest first.
+type LifecycleEventsResponse struct {
+	Pod    string           `json:"pod"`
+	Events []LifecycleEvent `json:"events"`
+}
+
+// lifecycleFeed records when the replica starts, its readiness changes and
+// its configuration reloads, and streams them at /events. Watching it
+// through the Service during a sync shows the rollout: new versions start,
+// old ones drain, and each reconnect lands on whichever replica is left.
+type lifecycleFeed struct {
+	s *Server
+
+	mu        sync.Mutex
+	seq       int64
+	events    []LifecycleEvent
+	readiness string
+	// changed is closed and replaced on every event, waking streams.
+	changed chan struct{}
+
+	streams   atomic.Int64
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+func newLifecycleFeed(s *Server) *lifecycleFeed {
+	return &lifecycleFeed{s: s, readiness: "not_ready", changed: make(chan struct{}), closing: make(chan struct{})}
+}
+
+// record adds an event of the given type.
+func (lf *lifecycleFeed) record(eventType, format string, args ...any) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	lf.add(eventType, fmt.Sprintf(format, args...))
+}
+
+// add appends an event; lf.mu is held.
+func (lf *lifecycleFeed) add(eventType, message string) {
+	cfg := lf.s.cfg
+	lf.seq++
+	lf.events = append(lf.events, LifecycleEvent{
+		ID:        cfg.Identity() + "-" + strconv.FormatInt(lf.seq, 10),
+		Type:      eventType,
+		Time:      time.Now().UTC().Format(time.RFC3339Nano),
+		Pod:       cfg.Identity(),
+		Version:   cfg.Build.Version,
+		GitCommit: cfg.Build.GitCommit,
+		Readiness: lf.readiness,
+		Message:   message,
+	})
+	if len(lf.events) > lifecycleHistory {
+		lf.events = lf.events[len(lf.events)-lifecycleHistory:]
+	}
+	close(lf.changed)
+	lf.changed = make(chan struct{})
+}
+
+// observeReadiness records a readiness event when status differs from the
+// last one seen.
+func (lf *lifecycleFeed) observeReadiness(status string) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if status == lf.readiness {
+		return
+	}
+	prev := lf.readiness
+	lf.readiness = status
+	lf.add(lifecycleReadiness, fmt.Sprintf("Readiness changed from %s to %s", prev, status))
+}
+
+// since returns the events after the one with ID lastID, all of them when
+// the ID isn't known, and the channel closed on the next event.
+func (lf *lifecycleFeed) since(lastID string) ([]LifecycleEvent, <-chan struct{}) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	start := 0
+	for i, e := range lf.events {
+		if e.ID == lastID {
+			start = i + 1
+		}
+	}
+	return append([]LifecycleEvent(nil), lf.events[start:]...), lf.changed
+}
+
+// run evaluates readiness while streams are open, until ctx ends.
+func (lf *lifecycleFeed) run(ctx context.Context) {
+	ticker := time.NewTicker(lifecyclePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if lf.streams.Load() > 0 {
+				lf.observeReadiness(lf.s.readinessStatus(ctx))
+			}
+		}
+	}
+}
+
+// close ends the open streams, which would otherwise hold up the server's
+// shutdown.
+func (lf *lifecycleFeed) close() {
+	lf.closeOnce.Do(func() { close(lf.closing) })
+}
+
+// handler streams the events as Server-Sent Events: the recent ones, or
+// those after Last-Event-ID when it names one of this replica's, then each
+// new one. Clients that don't accept text/event-stream get the recent
+// events as JSON.
+func (lf *lifecycleFeed) handler(w http.ResponseWriter, r *http.Request) {
+	if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		events, _ := lf.since("")
+		w.Header().Set("Content-Type", "application/json")
+		resp := LifecycleEventsResponse{Pod: lf.s.cfg.Identity(), Events: events}
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding lifecycle events response: %v", err)
+		}
+		return
+	}
+	lf.streams.Add(1)
+	defer lf.streams.Add(-1)
+	rc := http.NewResponseController(w)
+	// The stream lasts as long as the client stays, past the server's
+	// WriteTimeout.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// Reconnect quickly, to the next replica when this one is gone.
+	if _, err := fmt.Fprint(w, "retry: 1000\n\n"); err != nil {
+		return
+	}
+	_ = rc.Flush()
+
+	lastID := r.Header.Get("Last-Event-ID")
+	heartbeat := time.NewTicker(taskHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		events, changed := lf.since(lastID)
+		for _, e := range events {
+			data, err := json.Marshal(e)
+			if err != nil {
+				log.Printf("Error encoding lifecycle event: %v", err)
+				return
+			}
+			if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+				return
+			}
+			lastID = e.ID
+		}
+		_ = rc.Flush()
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-lf.closing:
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				_ = rc.Flush()
+			case <-changed:
+				break wait
+			}
+		}
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// Kinds of simulated load.
+const (
+	loadCPU    = "cpu"
+	loadMemory = "memory"
+)
+
+// cpuLoadPeriod is the interval within which each CPU load goroutine spins
+// for its share and sleeps for the rest.
+const cpuLoadPeriod = 100 * time.Millisecond
+
+// CPULoadRequest is the body of /api/v1/load/cpu. The query parameters
+// millicores and seconds can set the same fields, so a plain
+// `curl -X POST '...?seconds=120'` works; the body wins over them.
+type CPULoadRequest struct {
+	// One core is 1000 millicores
+	Millicores      int64 `json:"millicores" query:"millicores" validate:"min=1,max=64000"`
+	DurationSeconds int64 `json:"duration_seconds" query:"seconds" validate:"min=1,max=3600"`
+}
+
+// MemoryLoadRequest is the body of /api/v1/load/memory, or the query
+// parameters mb and seconds.
+type MemoryLoadRequest struct {
+	Megabytes       int64 `json:"megabytes" query:"mb" validate:"min=1,max=65536"`
+	DurationSeconds int64 `json:"duration_seconds" query:"seconds" validate:"min=1,max=3600"`
+}
+
+// LoadResponse describes one simulated load. Capped is set when less than
+// requested was granted because of the LOAD_MAX_* limits.
+type LoadResponse struct {
+	ID              int64   `json:"id"`
+	Kind            string  `json:"kind"`
+	Millicores      int64   `json:"millicores,omitempty"`
+	Bytes           int64   `json:"bytes,omitempty"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	EndsAt          string  `json:"ends_at"`
+	Capped          bool    `json:"capped"`
+	Hostname        string  `json:"hostname"`
+}
+
+type LoadStatusResponse struct {
+	CPUMillicores      int64          `json:"cpu_millicores"`
+	MemoryBytes        int64          `json:"memory_bytes"`
+	MaxCPUMillicores   int64          `json:"max_cpu_millicores"`
+	MaxMemoryBytes     int64          `json:"max_memory_bytes"`
+	MaxDurationSeconds float64        `json:"max_duration_seconds"`
+	Loads              []LoadResponse `json:"loads"`
+	Hostname           string         `json:"hostname"`
+}
+
+// loadGenerator burns CPU and holds memory on demand, so HPA and VPA
+// reactions can be shown without an external load tester. Loads run in the
+// background after the request returns. The totals across running loads
+// are capped, so repeated requests can't push the pod past what the
+// environment allows; shutdown stops every load.
+type loadGenerator struct {
+	hostname      string
+	maxMillicores int64
+	maxBytes      int64
+	maxDuration   time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	nextID int64
+	active map[int64]LoadResponse
+}
+
+func newLoadGenerator(hostname string, maxMillicores, maxBytes int64, maxDuration time.Duration) *loadGenerator {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &loadGenerator{
+		hostname:      hostname,
+		maxMillicores: maxMillicores,
+		maxBytes:      maxBytes,
+		maxDuration:   maxDuration,
+		ctx:           ctx,
+		cancel:        cancel,
+		active:        make(map[int64]LoadResponse),
+	}
+}
+
+// run stops the running loads once ctx is done.
+func (lg *loadGenerator) run(ctx context.Context) {
+	<-ctx.Done()
+	lg.cancel()
+	lg.wg.Wait()
+}
+
+// start grants as much of amount (millicores or bytes) as the limit of kind
+// leaves and runs the load in the background. It fails when nothing is
+// left.
+func (lg *loadGenerator) start(kind string, amount int64, duration time.Duration) (LoadResponse, bool) {
+	limit := lg.maxMillicores
+	if kind == loadMemory {
+		limit = lg.maxBytes
+	}
+
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	if lg.ctx.Err() != nil {
+		return LoadResponse{}, false
+	}
+	free := limit - lg.totalLocked(kind)
+	if free <= 0 || lg.maxDuration <= 0 {
+		return LoadResponse{}, false
+	}
+	capped := false
+	if amount > free {
+		amount, capped = free, true
+	}
+	if duration > lg.maxDuration {
+		duration, capped = lg.maxDuration, true
+	}
+
+	lg.nextID++
+	load := LoadResponse{
+		ID:              lg.nextID,
+		Kind:            kind,
+		DurationSeconds: duration.Seconds(),
+		EndsAt:          time.Now().Add(duration).UTC().Format(time.RFC3339),
+		Capped:          capped,
+		Hostname:        lg.hostname,
+	}
+	if kind == loadCPU {
+		load.Millicores = amount
+	} else {
+		load.Bytes = amount
+	}
+	lg.active[load.ID] = load
+
+	ctx, cancel := context.WithTimeout(lg.ctx, duration)
+	lg.wg.Add(1)
+	go func() {
+		defer lg.wg.Done()
+		defer cancel()
+		log.Printf("Simulated %s load %d started: %d for %s", kind, load.ID, amount, duration)
+		if kind == loadCPU {
+			burnCPU(ctx, amount)
+		} else {
+			holdMemory(ctx, amount)
+		}
+		lg.mu.Lock()
+		delete(lg.active, load.ID)
+		lg.mu.Unlock()
+		log.Printf("Simulated %s load %d ended", kind, load.ID)
+	}()
+	return load, true
+}
+
+func (lg *loadGenerator) totalLocked(kind string) int64 {
+	var total int64
+	for _, l := range lg.active {
+		if l.Kind == kind {
+			total += l.Millicores + l.Bytes
+		}
+	}
+	return total
+}
+
+// retryAfter is the time until the first running load of kind ends.
+func (lg *loadGenerator) retryAfter(kind string) time.Duration {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	var first time.Duration
+	for _, l := range lg.active {
+		endsAt, err := time.Parse(time.RFC3339, l.EndsAt)
+		if l.Kind != kind || err != nil {
+			continue
+		}
+		if d := time.Until(endsAt); first == 0 || d < first {
+			first = d
+		}
+	}
+	return first
+}
+
+func (lg *loadGenerator) status() LoadStatusResponse {
+	lg.mu.Lock()
+	defer lg.mu.Unlock()
+	resp := LoadStatusResponse{
+		CPUMillicores:      lg.totalLocked(loadCPU),
+		MemoryBytes:        lg.totalLocked(loadMemory),
+		MaxCPUMillicores:   lg.maxMillicores,
+		MaxMemoryBytes:     lg.maxBytes,
+		MaxDurationSeconds: lg.maxDuration.Seconds(),
+		Loads:              make([]LoadResponse, 0, len(lg.active)),
+		Hostname:           lg.hostname,
+	}
+	for _, l := range lg.active {
+		resp.Loads = append(resp.Loads, l)
+	}
+	sort.Slice(resp.Loads, func(i, j int) bool { return resp.Loads[i].ID < resp.Loads[j].ID })
+	return resp
+}
+
+// burnCPU keeps about millicores/1000 cores busy until ctx is done, with
+// one goroutine per started core each spinning for its share of every
+// cpuLoadPeriod.
+func burnCPU(ctx context.Context, millicores int64) {
+	workers := (millicores + 999) / 1000
+	busy := time.Duration(float64(cpuLoadPeriod) * float64(millicores) / float64(workers*1000))
+	var wg sync.WaitGroup
+	for i := int64(0); i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				for time.Since(start) < busy {
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(cpuLoadPeriod - busy):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// holdMemory allocates size bytes and touches every page, so they count
+// towards the container's working set, until ctx is done.
+func holdMemory(ctx context.Context, size int64) {
+	buf := make([]byte, size)
+	for i := 0; i < len(buf); i += 4096 {
+		buf[i] = 1
+	}
+	<-ctx.Done()
+	runtime.KeepAlive(buf)
+	debug.FreeOSMemory()
+}
+
+// cpuHandler accepts POST {"millicores": 1500, "duration_seconds": 60} or
+// POST ?millicores=1500&seconds=60.
+func (lg *loadGenerator) cpuHandler(w http.ResponseWriter, r *http.Request) {
+	req := CPULoadRequest{Millicores: 1000, DurationSeconds: 60}
+	if err := decodeLoadRequest(w, r, &req); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	lg.respond(w, r, loadCPU, req.Millicores, req.DurationSeconds)
+}
+
+// memoryHandler accepts POST {"megabytes": 128, "duration_seconds": 60} or
+// POST ?mb=128&seconds=60.
+func (lg *loadGenerator) memoryHandler(w http.ResponseWriter, r *http.Request) {
+	req := MemoryLoadRequest{Megabytes: 64, DurationSeconds: 60}
+	if err := decodeLoadRequest(w, r, &req); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	lg.respond(w, r, loadMemory, req.Megabytes<<20, req.DurationSeconds)
+}
+
+// decodeLoadRequest sets req from the query parameters, then from the JSON
+// body, which overrides them.
+func decodeLoadRequest(w http.ResponseWriter, r *http.Request, req any) error {
+	if err := validate.DecodeQuery(r, req); err != nil {
+		return err
+	}
+	return validate.DecodeJSON(w, r, req, 1<<10)
+}
+
+func (lg *loadGenerator) respond(w http.ResponseWriter, r *http.Request, kind string, amount, seconds int64) {
+	load, ok := lg.start(kind, amount, time.Duration(seconds)*time.Second)
+	if !ok {
+		if wait := lg.retryAfter(kind); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		}
+		problem.Error(w, r, i18n.T(r.Context(), "error.load_limit", kind), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(load); err != nil {
+		log.Printf("Error encoding load response: %v", err)
+	}
+}
+
+func (lg *loadGenerator) statusHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(lg.status()); err != nil {
+		log.Printf("Error encoding load status response: %v", err)
+	}
+}
@@ -0,0 +1,376 @@
+package server
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/jwt"
+	"github.com/anasadan/gitops-demo/backend-service/internal/oidc"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+const (
+	// sessionCookie holds the encrypted session of a logged in browser;
+	// loginCookie the state of a login in progress.
+	sessionCookie = "backend_session"
+	loginCookie   = "backend_login"
+	// loginTimeout is how long a browser has to come back from the provider.
+	loginTimeout = 10 * time.Minute
+	// refreshMargin refreshes tokens this long before they expire.
+	refreshMargin = 30 * time.Second
+	// providerTimeout bounds the calls to the OpenID provider.
+	providerTimeout = 10 * time.Second
+)
+
+// Paths of the login flow.
+const (
+	loginPath    = "/auth/login"
+	callbackPath = "/auth/callback"
+	logoutPath   = "/auth/logout"
+)
+
+// statusLogin puts the HTML status page behind an OpenID Connect login, so
+// Dex or Keycloak deployed from the same GitOps repo can be tried out with
+// a browser. Sessions live in a cookie encrypted with AES-GCM rather than
+// in the pod, so any replica serves any browser; when the provider's tokens
+// expire, the refresh token in the cookie renews them without sending the
+// browser back to the provider. JSON clients of "/" aren't affected.
+type statusLogin struct {
+	provider *oidc.Provider
+	aead     cipher.AEAD
+	secure   bool
+	maxAge   time.Duration
+	// Where the provider sends the browser after logging out
+	afterLogout string
+	metrics     *httpMetrics
+}
+
+// session is the content of the session cookie.
+type session struct {
+	Subject string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+	// Refresh token of the provider; empty when it issues none, and the
+	// session ends with the tokens
+	RefreshToken string `json:"rt,omitempty"`
+	// When the tokens expire, and when the user logged in, in Unix seconds
+	Expiry  int64 `json:"exp"`
+	LoginAt int64 `json:"iat"`
+}
+
+// user names the logged in user on the status page.
+func (sess *session) user() string {
+	switch {
+	case sess.Name != "" && sess.Email != "":
+		return sess.Name + " <" + sess.Email + ">"
+	case sess.Name != "":
+		return sess.Name
+	case sess.Email != "":
+		return sess.Email
+	}
+	return sess.Subject
+}
+
+// loginState is the content of the login cookie: what the callback checks
+// the provider's answer against, and where to go after it.
+type loginState struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Return   string `json:"return"`
+}
+
+// newStatusLogin returns nil when OIDC_ISSUER_URL is unset.
+func newStatusLogin(cfg config.Config, m *httpMetrics) (*statusLogin, error) {
+	if !cfg.OIDCEnabled() {
+		return nil, nil
+	}
+	redirect, err := url.Parse(cfg.OIDCRedirectURL)
+	if err != nil || redirect.Scheme == "" || redirect.Host == "" {
+		return nil, errors.New("OIDC_REDIRECT_URL must be an absolute URL")
+	}
+	secret := cfg.OIDCCookieSecret
+	if secret == "" {
+		secret = cfg.OIDCClientSecret
+	}
+	key := sha256.Sum256([]byte("backend-service session cookie\x00" + secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &statusLogin{
+		provider: oidc.New(oidc.Config{
+			IssuerURL:    cfg.OIDCIssuerURL,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+			Leeway:       cfg.JWTLeeway,
+			HTTPClient:   &http.Client{Timeout: providerTimeout},
+		}),
+		aead:        aead,
+		secure:      redirect.Scheme == "https",
+		maxAge:      cfg.OIDCSessionMaxAge,
+		afterLogout: redirect.Scheme + "://" + redirect.Host + "/",
+		metrics:     m,
+	}, nil
+}
+
+// run discovers the provider once, so the first login doesn't wait for it.
+func (l *statusLogin) run(ctx context.Context) {
+	if l == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, providerTimeout)
+	defer cancel()
+	if _, err := l.provider.Metadata(ctx); err != nil {
+		log.Printf("Warning: %v; retrying at the first login", err)
+	}
+}
+
+// authenticate returns the session of the request, refreshing its tokens
+// when they expired. Without a valid session it redirects the browser to
+// the login and returns false. With login disabled every request passes,
+// without a session.
+func (l *statusLogin) authenticate(w http.ResponseWriter, r *http.Request) (*session, bool) {
+	if l == nil {
+		return nil, true
+	}
+	var sess session
+	if !l.readCookie(r, sessionCookie, &sess) {
+		l.redirectToLogin(w, r)
+		return nil, false
+	}
+	now := time.Now()
+	if l.maxAge > 0 && now.After(time.Unix(sess.LoginAt, 0).Add(l.maxAge)) {
+		l.redirectToLogin(w, r)
+		return nil, false
+	}
+	if now.Add(refreshMargin).Before(time.Unix(sess.Expiry, 0)) {
+		return &sess, true
+	}
+	if sess.RefreshToken == "" {
+		l.redirectToLogin(w, r)
+		return nil, false
+	}
+	tok, err := l.provider.Refresh(r.Context(), sess.RefreshToken)
+	if err != nil {
+		log.Printf("Refreshing the session of %s failed, logging in again: %v", sess.Subject, err)
+		l.metrics.logins.Inc("refresh_failed")
+		l.redirectToLogin(w, r)
+		return nil, false
+	}
+	l.metrics.logins.Inc("refreshed")
+	sess.RefreshToken = tok.RefreshToken
+	sess.Expiry = tokenExpiry(tok)
+	if tok.Claims != nil {
+		sess.Name, sess.Email = tok.Claims.String("name"), tok.Claims.String("email")
+	}
+	l.setCookie(w, sessionCookie, &sess, l.cookieMaxAge(sess))
+	return &sess, true
+}
+
+// redirectToLogin sends the browser to the login, which brings it back to
+// the page it asked for.
+func (l *statusLogin) redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	l.clearCookie(w, sessionCookie)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, loginPath+"?"+url.Values{"return": {r.URL.RequestURI()}}.Encode(), http.StatusFound)
+}
+
+// loginHandler starts a login: it remembers a fresh state, nonce and PKCE
+// verifier in the login cookie and sends the browser to the provider.
+func (l *statusLogin) loginHandler(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.login_disabled"), http.StatusNotFound)
+		return
+	}
+	st := loginState{
+		State:    oidc.RandomString(16),
+		Nonce:    oidc.RandomString(16),
+		Verifier: oidc.RandomString(32),
+		Return:   localPath(r.URL.Query().Get("return")),
+	}
+	authURL, err := l.provider.AuthCodeURL(r.Context(), st.State, st.Nonce, st.Verifier)
+	if err != nil {
+		log.Printf("Error starting a login: %v", err)
+		problem.Error(w, r, i18n.T(r.Context(), "error.oidc_provider", err), http.StatusBadGateway)
+		return
+	}
+	l.setCookie(w, loginCookie, &st, loginTimeout)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// callbackHandler finishes a login: it checks the state, trades the code
+// for tokens and sets the session cookie.
+func (l *statusLogin) callbackHandler(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.login_disabled"), http.StatusNotFound)
+		return
+	}
+	fail := func(status int, reason string) {
+		l.metrics.logins.Inc("failed")
+		log.Printf("Login failed: %s", reason)
+		problem.Error(w, r, i18n.T(r.Context(), "error.login_failed", reason), status)
+	}
+	q := r.URL.Query()
+	var st loginState
+	if !l.readCookie(r, loginCookie, &st) {
+		fail(http.StatusBadRequest, "no login in progress, or it took too long")
+		return
+	}
+	l.clearCookie(w, loginCookie)
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(st.State)) != 1 {
+		fail(http.StatusBadRequest, "state mismatch")
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		if d := q.Get("error_description"); d != "" {
+			e += ": " + d
+		}
+		fail(http.StatusUnauthorized, "the provider refused: "+e)
+		return
+	}
+	tok, err := l.provider.Exchange(r.Context(), q.Get("code"), st.Verifier, st.Nonce)
+	if err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, jwt.ErrSignature) || errors.Is(err, jwt.ErrClaims) || errors.Is(err, jwt.ErrExpired) || errors.Is(err, oidc.ErrNonce) {
+			status = http.StatusUnauthorized
+		}
+		fail(status, err.Error())
+		return
+	}
+
+	sess := session{
+		Subject:      tok.Claims.Subject(),
+		Name:         tok.Claims.String("name"),
+		Email:        tok.Claims.String("email"),
+		RefreshToken: tok.RefreshToken,
+		Expiry:       tokenExpiry(tok),
+		LoginAt:      time.Now().Unix(),
+	}
+	l.setCookie(w, sessionCookie, &sess, l.cookieMaxAge(sess))
+	l.metrics.logins.Inc("succeeded")
+	log.Printf("%s logged in to the status page", sess.Subject)
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, st.Return, http.StatusFound)
+}
+
+// logoutHandler ends the session, and the provider's too when it has an
+// end-session endpoint.
+func (l *statusLogin) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if l == nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.login_disabled"), http.StatusNotFound)
+		return
+	}
+	l.clearCookie(w, sessionCookie)
+	target := l.provider.EndSessionURL(r.Context(), "", l.afterLogout)
+	if target == "" {
+		target = "/"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// tokenExpiry is when the tokens of tok expire: the ID token's "exp", or
+// the access token's lifetime when it's shorter.
+func tokenExpiry(tok *oidc.Token) int64 {
+	var exp time.Time
+	if tok.Claims != nil {
+		exp, _ = tok.Claims.Time("exp")
+	}
+	if !tok.Expiry.IsZero() && (exp.IsZero() || tok.Expiry.Before(exp)) {
+		exp = tok.Expiry
+	}
+	if exp.IsZero() {
+		exp = time.Now().Add(5 * time.Minute)
+	}
+	return exp.Unix()
+}
+
+// cookieMaxAge keeps the session cookie until the session ends: the login
+// expires, or the tokens do when they can't be refreshed.
+func (l *statusLogin) cookieMaxAge(sess session) time.Duration {
+	end := time.Unix(sess.LoginAt, 0).Add(l.maxAge)
+	if sess.RefreshToken == "" || l.maxAge <= 0 {
+		end = time.Unix(sess.Expiry, 0)
+	}
+	return time.Until(end)
+}
+
+// setCookie sets cookie name to v, encrypted and authenticated. The name is
+// authenticated along, so one cookie can't stand in for the other.
+func (l *statusLogin) setCookie(w http.ResponseWriter, name string, v any, maxAge time.Duration) {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Error encoding the %s cookie: %v", name, err)
+		return
+	}
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		log.Printf("Error encrypting the %s cookie: %v", name, err)
+		return
+	}
+	sealed := l.aead.Seal(nonce, nonce, plain, []byte(name))
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(sealed),
+		Path:     "/",
+		MaxAge:   max(int(maxAge.Seconds()), 1),
+		Secure:   l.secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// readCookie decrypts cookie name into v, and reports whether the request
+// had it and it was intact.
+func (l *statusLogin) readCookie(r *http.Request, name string, v any) bool {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return false
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(sealed) < l.aead.NonceSize() {
+		return false
+	}
+	nonce, ciphertext := sealed[:l.aead.NonceSize()], sealed[l.aead.NonceSize():]
+	plain, err := l.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(plain, v) == nil
+}
+
+func (l *statusLogin) clearCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{Name: name, Path: "/", MaxAge: -1, Secure: l.secure, HttpOnly: true,
+		SameSite: http.SameSiteLaxMode})
+}
+
+// localPath returns p when it's a path of this service, and "/" otherwise,
+// so the login can't be used to redirect browsers elsewhere.
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/logging"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// logLevelOverride is a log level set at runtime, for debug logs during an
+// incident without a restart or a Git change.
+type logLevelOverride struct {
+	level string
+	since time.Time
+}
+
+// LogLevelRequest is the body of PUT /admin/loglevel.
+type LogLevelRequest struct {
+	Level string `json:"level" validate:"required,oneof=debug info warn error"`
+}
+
+// LogLevelResponse is the response of /admin/loglevel: the level in
+// effect, and whether it comes from the config or a runtime override.
+type LogLevelResponse struct {
+	Level      string `json:"level"`
+	Source     string `json:"source"`
+	Since      string `json:"since,omitempty"`
+	Configured string `json:"configured"`
+}
+
+// applyLogLevel sets the configured level unless an override is in effect;
+// either way an invalid level is an error. Callers hold lc.mu.
+func (lc *liveConfig) applyLogLevel(level string) error {
+	if lc.logLevel.Load() != nil {
+		return logging.CheckLevel(level)
+	}
+	return logging.SetLevel(level)
+}
+
+// overrideLogLevel sets level until resetLogLevel; reloads of the config
+// leave it alone.
+func (lc *liveConfig) overrideLogLevel(level string) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if err := logging.SetLevel(level); err != nil {
+		return err
+	}
+	lc.logLevel.Store(&logLevelOverride{level: level, since: time.Now()})
+	return nil
+}
+
+// resetLogLevel returns to the configured level and reports whether there
+// was an override.
+func (lc *liveConfig) resetLogLevel() bool {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	if lc.logLevel.Swap(nil) == nil {
+		return false
+	}
+	// The configured level was checked when it was loaded.
+	_ = logging.SetLevel(lc.get().logLevel)
+	return true
+}
+
+// logLevelHandler serves /admin/loglevel: PUT overrides the configured
+// level, DELETE reverts to it.
+func (s *Server) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPut:
+		var req LogLevelRequest
+		if err := validate.DecodeJSON(w, r, &req, 1<<10); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		if err := s.live.overrideLogLevel(req.Level); err != nil {
+			validate.WriteError(w, r, err)
+			return
+		}
+		log.Printf("Warning: log level overridden by admin request: %s", req.Level)
+		s.recorder.Eventf(eventTypeNormal, reasonLogLevelChanged, "Log level overridden: %s", req.Level)
+	case http.MethodDelete:
+		if s.live.resetLogLevel() {
+			log.Printf("Log level override removed by admin request; back to %s", s.live.get().logLevel)
+			s.recorder.Eventf(eventTypeNormal, reasonLogLevelChanged, "Log level override removed; back to %s", s.live.get().logLevel)
+		}
+	}
+
+	resp := LogLevelResponse{
+		Level:      logging.Level(),
+		Source:     "config",
+		Configured: s.live.get().logLevel,
+	}
+	if o := s.live.logLevel.Load(); o != nil {
+		resp.Source, resp.Since = "override", o.since.UTC().Format(time.RFC3339)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding log level response: %v", err)
+	}
+}
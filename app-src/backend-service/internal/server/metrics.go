@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/metrics"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// unmatchedRoute labels requests no route matched, so scanners probing
+// random paths can't create a series per path.
+const unmatchedRoute = "unmatched"
+
+// httpMetrics is what the "metrics" middleware measures: the request rate
+// behind the scaling signals, and per-route request counts and latency
+// served at /metrics alongside gauges read at scrape time.
+type httpMetrics struct {
+	registry *metrics.Registry
+	// Rollout track labeling the request metrics, so traffic splits between
+	// stable and canary pods show in one query
+	track    string
+	rates    *rateCounter
+	requests *metrics.CounterVec
+	duration *metrics.HistogramVec
+	panics   *metrics.CounterVec
+	limited  *metrics.CounterVec
+	unauthed *metrics.CounterVec
+
+	compressedIn     *metrics.CounterVec
+	compressedOut    *metrics.CounterVec
+	compressionRatio *metrics.HistogramVec
+	deprecated       *metrics.CounterVec
+	chaos            *metrics.CounterVec
+	cache            *metrics.CounterVec
+	localCache       *metrics.CounterVec
+	notModified      *metrics.CounterVec
+	published        *metrics.CounterVec
+	logins           *metrics.CounterVec
+	servingReplicas  *metrics.GaugeVec
+
+	downstreamRequests *metrics.CounterVec
+	downstreamDuration *metrics.HistogramVec
+	downstreamBreaker  *metrics.CounterVec
+}
+
+func newHTTPMetrics(build config.BuildInfo, track string, rates *rateCounter, inFlight, queueDepth func() int64) *httpMetrics {
+	reg := metrics.NewRegistry()
+	m := &httpMetrics{
+		registry: reg,
+		track:    track,
+		rates:    rates,
+		requests: reg.Counter("http_requests_total", "HTTP requests served, by route name, method, status code and rollout track.",
+			"route", "method", "code", "track"),
+		duration: reg.Histogram("http_request_duration_seconds", "Latency of HTTP requests, by route name, method and rollout track.",
+			metrics.DefaultBuckets, "route", "method", "track"),
+		panics: reg.Counter("http_panics_total", "Handler panics recovered into 500 responses, by route name.",
+			"route"),
+		limited: reg.Counter("http_rate_limited_total", "API requests refused with 429, by route name and the limit exceeded (global or client).",
+			"route", "scope"),
+		unauthed: reg.Counter("http_unauthorized_total", "API requests refused with 401 for a missing or invalid JWT, by route name and reason.",
+			"route", "reason"),
+		compressedIn: reg.Counter("http_response_compression_input_bytes_total", "Bytes of gzipped response bodies before compression, by route name.",
+			"route"),
+		compressedOut: reg.Counter("http_response_compression_output_bytes_total", "Bytes of gzipped response bodies after compression, by route name.",
+			"route"),
+		compressionRatio: reg.Histogram("http_response_compression_ratio", "Uncompressed to compressed size of gzipped responses, by route name.",
+			[]float64{1, 1.5, 2, 3, 4, 6, 8, 12, 16}, "route"),
+		deprecated: reg.Counter("http_deprecated_requests_total", "Requests to deprecated API paths, by route name.",
+			"route"),
+		chaos: reg.Counter("http_chaos_injected_total", "Faults injected into API requests, by route name and fault.",
+			"route", "fault"),
+		cache: reg.Counter("http_response_cache_requests_total", "GET requests of cached routes, by route name and result (hit, miss or error).",
+			"route", "result"),
+		localCache: reg.Counter("http_local_cache_requests_total", "GET requests of routes in the in-process cache, by route name and result (hit or miss).",
+			"route", "result"),
+		notModified: reg.Counter("http_not_modified_total", "Conditional GET requests answered 304 Not Modified, by route name.",
+			"route"),
+		published: reg.Counter("events_published_total", "CloudEvents sent to the event broker, by type and outcome (published, failed or dropped).",
+			"type", "outcome"),
+		logins: reg.Counter("status_page_logins_total", "OpenID Connect logins of the status page, by outcome (succeeded, failed, refreshed or refresh_failed).",
+			"outcome"),
+		servingReplicas: reg.Gauge("backend_service_serving_replicas", "Replicas behind PEERS_SERVICE serving each version, reported by the leader only.",
+			"version", "git_commit"),
+		downstreamRequests: reg.Counter("downstream_requests_total", "Attempted calls to downstream services, by host and outcome.",
+			"host", "outcome"),
+		downstreamDuration: reg.Histogram("downstream_request_duration_seconds", "Latency of calls to downstream services, by host.",
+			metrics.DefaultBuckets, "host"),
+		downstreamBreaker: reg.Counter("downstream_circuit_breaker_transitions_total", "Circuit breaker state changes, by host and new state.",
+			"host", "state"),
+	}
+	reg.GaugeFunc("http_requests_in_flight", "HTTP requests currently being served.", nil,
+		func() float64 { return float64(inFlight()) })
+	reg.GaugeFunc("backend_service_job_queue_depth", "Background jobs waiting or running.", nil,
+		func() float64 { return float64(queueDepth()) })
+	reg.GaugeFunc("backend_service_build_info", "Always 1, labeled with the build of the running binary.",
+		map[string]string{"version": build.Version, "git_commit": build.GitCommit, "go_version": runtime.Version(), "track": track},
+		func() float64 { return 1 })
+	return m
+}
+
+func (m *httpMetrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.rates.inc(start)
+		tw := &trackingWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+
+		name := unmatchedRoute
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			name = route.Name
+		}
+		m.requests.Inc(name, r.Method, strconv.Itoa(tw.status()), m.track)
+		m.duration.Observe(time.Since(start).Seconds(), name, r.Method, m.track)
+	})
+}
@@ -0,0 +1,295 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/negotiate"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/tracing"
+)
+
+// middleware wraps a handler.
+type middleware func(http.Handler) http.Handler
+
+// groupChain is the composed middleware of a route group and the names it
+// was built from, for the route listing.
+type groupChain struct {
+	names []string
+	wrap  middleware
+}
+
+// Route groups. Each group has its own middleware chain, so probes can skip
+// what only API traffic needs.
+const (
+	groupProbes   = "probes"
+	groupAPI      = "api"
+	groupBrowser  = "browser"
+	groupAdmin    = "admin"
+	groupWebhooks = "webhooks"
+)
+
+// defaultChains lists the middleware of each route group, outermost first.
+// MIDDLEWARE_PROBES, MIDDLEWARE_API, MIDDLEWARE_BROWSER, MIDDLEWARE_ADMIN
+// and MIDDLEWARE_WEBHOOKS override them; "none" configures an empty chain.
+// By position:
+//
+//   - "requestid" and "headers" come first, so every response carries the
+//     request ID and the security headers, refusals and panics included.
+//   - "trace" precedes "log", so access logs carry the trace ID; probes
+//     aren't traced, as they'd drown out real requests.
+//   - "events" publishes a request.served event when EVENT_BROKER_URL is set.
+//   - "cors" precedes "ratelimit", so preflights aren't limited and refusals
+//     carry the headers that let the frontend read them.
+//   - "recover" follows "metrics" and "events", so panics are logged,
+//     counted and published as 500s.
+//   - "ratelimit" is left out of probes and admin: throttling probes would
+//     restart or unready the pod under load. On webhooks it bounds how fast
+//     signatures can be tried.
+//   - "jwt" follows "ratelimit", so tokens can't be guessed faster than the
+//     limits allow, and precedes "etag", so cached responses only go to
+//     authorized requests. Browsers send no bearer token and webhooks are
+//     signed instead, so neither group has it.
+//   - "etag" follows "ratelimit", so cache hits are limited and counted, and
+//     precedes "gzip", so each encoding gets its own ETag.
+//   - "gzip" follows "log", so the access log shows the bytes sent.
+//   - "negotiate" follows "gzip", so ETags and compression apply to the YAML
+//     or protobuf sent.
+//   - "inflight" counts the requests a drain waits for; the admin chain
+//     needs it, as the preStop hook counts itself.
+//   - "shadow" and "record" follow "gzip" and "negotiate", so they see the
+//     uncompressed JSON; each does nothing until SHADOW_TARGET_URL or
+//     RECORDING_SAMPLE_PERCENT is set.
+//   - "chaos" comes last, so injected delays count against the route's
+//     timeout like a slow handler.
+var defaultChains = map[string][]string{
+	groupProbes:   {"requestid", "headers", "log", "metrics", "recover", "inflight", "timeout"},
+	groupAPI:      {"requestid", "headers", "trace", "log", "metrics", "events", "cors", "deprecated", "recover", "ratelimit", "jwt", "etag", "gzip", "negotiate", "inflight", "shadow", "record", "apiversion", "i18n", "timeout", "chaos"},
+	groupBrowser:  {"requestid", "headers", "trace", "log", "metrics", "events", "cors", "deprecated", "recover", "ratelimit", "etag", "gzip", "negotiate", "inflight", "shadow", "record", "apiversion", "i18n", "timeout", "chaos"},
+	groupAdmin:    {"requestid", "headers", "trace", "log", "metrics", "recover", "inflight", "i18n", "timeout"},
+	groupWebhooks: {"requestid", "headers", "trace", "log", "metrics", "recover", "ratelimit", "inflight", "i18n", "timeout"},
+}
+
+// middlewareRegistry returns the middleware chains can be built from, by
+// name.
+func (s *Server) middlewareRegistry() map[string]middleware {
+	return map[string]middleware{
+		"requestid":  requestid.Middleware,
+		"headers":    newSecurityHeaders(s.cfg, s.track).middleware,
+		"trace":      s.traceMiddleware,
+		"log":        loggingMiddleware,
+		"metrics":    s.metrics.middleware,
+		"events":     s.eventsMiddleware,
+		"cors":       s.cors.middleware,
+		"deprecated": s.deprecationMiddleware,
+		"recover":    s.recoverMiddleware,
+		"jwt":        s.auth.middleware,
+		"ratelimit":  s.rateLimitMiddleware,
+		"etag":       s.local.middleware,
+		"gzip":       s.compressor.middleware,
+		"negotiate":  negotiate.Middleware,
+		"inflight":   s.inFlightMiddleware,
+		"shadow":     s.shadow.middleware,
+		"record":     s.recordings.Middleware,
+		"apiversion": apiversion.Middleware,
+		"i18n":       s.messages.Middleware,
+		"timeout":    timeoutMiddleware(s.defaultTimeout),
+		"chaos":      s.chaosMiddleware,
+	}
+}
+
+// buildChains composes the middleware chain of every route group from the
+// configuration, falling back to defaultChains.
+func (s *Server) buildChains() (map[string]groupChain, error) {
+	configured := map[string][]string{
+		groupProbes:   s.cfg.ProbeMiddleware,
+		groupAPI:      s.cfg.APIMiddleware,
+		groupBrowser:  s.cfg.BrowserMiddleware,
+		groupAdmin:    s.cfg.AdminMiddleware,
+		groupWebhooks: s.cfg.WebhookMiddleware,
+	}
+	registry := s.middlewareRegistry()
+	chains := make(map[string]groupChain, len(defaultChains))
+	for group, names := range defaultChains {
+		if len(configured[group]) > 0 {
+			names = configured[group]
+		}
+		mw, err := chain(registry, names)
+		if err != nil {
+			return nil, fmt.Errorf("%s middleware: %w", group, err)
+		}
+		if len(names) == 1 && names[0] == "none" {
+			names = nil
+		}
+		chains[group] = groupChain{names: names, wrap: mw}
+	}
+	return chains, nil
+}
+
+// chain composes the named middleware; the first name is the outermost.
+func chain(registry map[string]middleware, names []string) (middleware, error) {
+	if len(names) == 1 && names[0] == "none" {
+		names = nil
+	}
+	mws := make([]middleware, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		mw, ok := registry[name]
+		if !ok {
+			available := make([]string, 0, len(registry))
+			for n := range registry {
+				available = append(available, n)
+			}
+			sort.Strings(available)
+			return nil, fmt.Errorf("unknown middleware %q (available: %s)", name, strings.Join(available, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("middleware %q listed twice", name)
+		}
+		seen[name] = true
+		mws = append(mws, mw)
+	}
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
+		}
+		return h
+	}, nil
+}
+
+// loggingMiddleware logs every request with its outcome as structured
+// fields, which log pipelines can index without parsing the message.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		tw := &trackingWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r)
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", tw.status()),
+			slog.Int64("bytes", tw.bytes),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			attrs = append(attrs, slog.String("route", route.Name))
+		}
+		if id := requestid.FromContext(r.Context()); id != "" {
+			attrs = append(attrs, slog.String("request_id", id))
+		}
+		if span := tracing.SpanFromContext(r.Context()); span != nil {
+			sc := span.Context()
+			attrs = append(attrs, slog.String("trace_id", hex.EncodeToString(sc.TraceID[:])),
+				slog.String("span_id", hex.EncodeToString(sc.SpanID[:])))
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	})
+}
+
+// requireAdmin guards routes marked Auth with the admin token or an API
+// key. It isn't in the registry: routes that need it can't be configured
+// out of it.
+func requireAdmin(keys handlers.AdminKeys, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handlers.AuthorizedAdmin(w, r, keys) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// timeoutMiddleware bounds the request context by the route's timeout, or
+// by defaultTimeout for routes with a zero timeout; -1 means no limit.
+// Handlers that give up at the deadline without responding get a 503.
+func timeoutMiddleware(defaultTimeout func() time.Duration) middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, ok := router.RouteFromContext(r.Context())
+			timeout := routeTimeout(route, defaultTimeout)
+			if !ok || timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			tw := &trackingWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+			if !tw.written && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				p := problem.New(http.StatusServiceUnavailable, i18n.T(r.Context(), "error.timeout"))
+				p.Type, p.Title = problem.TypeTimeout, "Request timed out"
+				problem.Write(w, r, p)
+			}
+		})
+	}
+}
+
+// routeTimeout is the timeout in effect for route; routes that don't set
+// one use the default, which a config reload can change.
+func routeTimeout(route router.Route, defaultTimeout func() time.Duration) time.Duration {
+	if route.Timeout == 0 {
+		return defaultTimeout()
+	}
+	return route.Timeout
+}
+
+// trackingWriter records whether the handler started a response, its
+// status and how many body bytes it wrote.
+type trackingWriter struct {
+	http.ResponseWriter
+	written bool
+	code    int
+	bytes   int64
+}
+
+func (tw *trackingWriter) WriteHeader(code int) {
+	if !tw.written {
+		tw.written, tw.code = true, code
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *trackingWriter) Write(b []byte) (int, error) {
+	if !tw.written {
+		tw.written, tw.code = true, http.StatusOK
+	}
+	n, err := tw.ResponseWriter.Write(b)
+	tw.bytes += int64(n)
+	return n, err
+}
+
+// Hijack takes over the connection, as WebSocket handshakes do, recording
+// the switch of protocols as the status.
+func (tw *trackingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := http.NewResponseController(tw.ResponseWriter).Hijack()
+	if err == nil && !tw.written {
+		tw.written, tw.code = true, http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// status is the response status, 200 when the handler wrote nothing.
+func (tw *trackingWriter) status() int {
+	if tw.code == 0 {
+		return http.StatusOK
+	}
+	return tw.code
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (tw *trackingWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/negotiate"
+	"github.com/anasadan/gitops-demo/backend-service/internal/openapi"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/schema"
+)
+
+//go:embed docs.html
+var docsHTML []byte
+
+// requestBodies are the JSON request bodies by route name. Add new ones
+// here so /openapi.json documents them.
+var requestBodies = map[string]any{
+	"jobs":           EnqueueJobsRequest{},
+	"tasks":          CreateTaskRequest{},
+	"load-cpu":       CPULoadRequest{},
+	"load-memory":    MemoryLoadRequest{},
+	"admin-chaos":    ChaosRequest{},
+	"items":          ItemRequest{},
+	"item":           ItemRequest{},
+	"gitops-promote": PromoteRequest{},
+}
+
+// anyMethods are documented for routes that accept every method.
+var anyMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+var groupDescriptions = map[string]string{
+	groupProbes:   "Kubernetes probes and Prometheus metrics",
+	groupAPI:      "The demo API",
+	groupBrowser:  "The status page, its login, the API docs and the live streams, served without a JWT",
+	groupAdmin:    "Operations; most need the admin token",
+	groupWebhooks: "Notifications of GitOps controllers and Git hosts, signed with a shared secret",
+}
+
+// openAPIDocument describes the routes of rt with the response types of
+// responseSchemas. Routes and types are read from the code that serves
+// them, so the document can't drift from the API.
+func openAPIDocument(rt *router.Router, version string) *openapi.Document {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:   "backend-service",
+			Version: version,
+			Description: "API of the GitOps demo backend. Errors are RFC 7807 problems. " +
+				"Response shapes are negotiated with the Accept-Version header; see GET /api.",
+		},
+		Paths: make(map[string]openapi.PathItem),
+		Components: openapi.Components{
+			Schemas: make(map[string]*schema.Schema),
+			SecuritySchemes: map[string]openapi.SecurityScheme{
+				"adminToken": {Type: "http", Scheme: "bearer", Description: "The ADMIN_TOKEN of the deployment, or an admin API key"},
+				"adminAPIKey": {Type: "apiKey", In: "header", Name: "X-API-Key",
+					Description: "An admin API key of ADMIN_API_KEY_FILE, or the ADMIN_TOKEN"},
+				"jwt": {Type: "http", Scheme: "bearer", BearerFormat: "JWT",
+					Description: "Required on the API when JWT_SECRET, JWT_SECRET_FILE or JWT_JWKS_URL is set"},
+			},
+		},
+	}
+	for _, group := range []string{groupProbes, groupAPI, groupBrowser, groupAdmin, groupWebhooks} {
+		doc.Tags = append(doc.Tags, openapi.Tag{Name: group, Description: groupDescriptions[group]})
+	}
+
+	// Response types by the pattern of the endpoint they document, with
+	// version 2 shapes as alternatives.
+	responses := make(map[string][]openapi.Ref)
+	for _, rs := range responseSchemas {
+		doc.Components.Schemas[rs.name] = schema.For(rs.value)
+		for _, endpoint := range rs.endpoints {
+			pattern := strings.TrimSuffix(endpoint, " (API version 2)")
+			if strings.Contains(pattern, " ") {
+				continue
+			}
+			responses[pattern] = append(responses[pattern], openapi.SchemaRef(rs.name))
+		}
+	}
+	problemBody := map[string]openapi.MediaType{problem.ContentType: {Schema: openapi.SchemaRef("Problem")}}
+
+	for _, route := range rt.Routes() {
+		path, params := openapi.PathParams(route.Pattern)
+		item := doc.Paths[path]
+		if item == nil {
+			item = make(openapi.PathItem)
+			doc.Paths[path] = item
+		}
+		// Deprecated aliases answer like their successors.
+		documented := route.Pattern
+		if route.Deprecated {
+			documented = apiV1Prefix + strings.TrimPrefix(route.Pattern, "/api")
+		}
+		success := openapi.Response{Description: "Success"}
+		var body any
+		switch refs := responses[documented]; len(refs) {
+		case 0:
+		case 1:
+			body = refs[0]
+		default:
+			body = openapi.OneOf{OneOf: refs}
+		}
+		if body != nil {
+			success.Content = map[string]openapi.MediaType{"application/json": {Schema: body}}
+			// API responses come as YAML too, when asked for.
+			if route.Group == groupAPI || route.Group == groupBrowser {
+				success.Content[negotiate.YAML] = openapi.MediaType{Schema: body}
+			}
+		}
+
+		methods := route.Methods
+		if len(methods) == 0 {
+			methods = anyMethods
+		}
+		for _, method := range methods {
+			op := &openapi.Operation{
+				OperationID: route.Name,
+				Summary:     route.Description,
+				Tags:        []string{route.Group},
+				Deprecated:  route.Deprecated,
+				Responses: map[string]openapi.Response{
+					"2XX":     success,
+					"default": {Description: "Error", Content: problemBody},
+				},
+			}
+			if len(methods) > 1 {
+				op.OperationID += "-" + strings.ToLower(method)
+			}
+			if route.Deprecated {
+				op.OperationID += "-deprecated"
+			}
+			for _, name := range params {
+				op.Parameters = append(op.Parameters, openapi.Parameter{
+					Name: name, In: "path", Required: true, Schema: &schema.Schema{Type: schema.Types{"string"}},
+				})
+			}
+			if body, ok := requestBodies[route.Name]; ok && method != http.MethodGet && method != http.MethodDelete {
+				s := schema.For(body)
+				// Fields left out take their defaults.
+				s.Required = nil
+				op.RequestBody = &openapi.RequestBody{Content: map[string]openapi.MediaType{"application/json": {Schema: s}}}
+			}
+			if route.Auth {
+				op.Security = []map[string][]string{{"adminToken": {}}, {"adminAPIKey": {}}}
+			}
+			item[strings.ToLower(method)] = op
+		}
+	}
+	return doc
+}
+
+// openAPIHandler serves /openapi.json, the OpenAPI document of every
+// registered route.
+func openAPIHandler(rt *router.Router, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(openAPIDocument(rt, version)); err != nil {
+			log.Printf("Error encoding OpenAPI document: %v", err)
+		}
+	}
+}
+
+// docsCSP is the Content-Security-Policy of /docs, which loads Swagger UI
+// from its CDN and starts it with an inline script.
+const docsCSP = "default-src 'self'; script-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net; " +
+	"style-src 'self' https://cdn.jsdelivr.net; img-src 'self' data:; frame-ancestors 'none'"
+
+// docsHandler serves /docs, Swagger UI for /openapi.json. The UI's assets
+// load from a CDN, so the page needs internet access in the browser; when
+// the "headers" middleware set a Content-Security-Policy, it's widened to
+// allow them.
+func docsHandler(w http.ResponseWriter, _ *http.Request) {
+	if w.Header().Get("Content-Security-Policy") != "" {
+		w.Header().Set("Content-Security-Policy", docsCSP)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if _, err := w.Write(docsHTML); err != nil {
+		log.Printf("Error writing docs page: %v", err)
+	}
+}
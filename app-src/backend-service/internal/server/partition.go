@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const (
+	memberGroupLabel  = "gitops-demo.io/member-of"
+	memberHeartbeat   = 5 * time.Second
+	memberLeaseExpiry = 15 * time.Second
+)
+
+type leaseList struct {
+	Items []lease `json:"items"`
+}
+
+// memberSet tracks the live replicas of the service so partitioned work can
+// be split between them. Each replica keeps its own Lease (labelled with the
+// group) renewed; a replica is live while its Lease hasn't expired. Work items
+// are assigned with rendezvous hashing, so when a replica joins or leaves
+// only the items it owned or takes over move.
+//
+// Without a client (partitioning disabled) the set only contains this
+// replica, which then owns every item.
+type memberSet struct {
+	client    *k8sclient.Client
+	namespace string
+	group     string
+	identity  string
+
+	mu      sync.RWMutex
+	members []string
+}
+
+func newMemberSet(client *k8sclient.Client, namespace, group, identity string) *memberSet {
+	return &memberSet{
+		client:    client,
+		namespace: namespace,
+		group:     group,
+		identity:  identity,
+		members:   []string{identity},
+	}
+}
+
+func (ms *memberSet) run(ctx context.Context) {
+	if ms.client == nil {
+		return
+	}
+	log.Printf("Joining work partition group %s as %s", ms.group, ms.identity)
+	ticker := time.NewTicker(memberHeartbeat)
+	defer ticker.Stop()
+	for {
+		if err := ms.heartbeat(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error renewing membership lease: %v", err)
+		}
+		if err := ms.refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Error listing group members: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			ms.leave()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (ms *memberSet) leaseName() string {
+	return fmt.Sprintf("%s-member-%s", ms.group, ms.identity)
+}
+
+func (ms *memberSet) heartbeat(ctx context.Context) error {
+	now := time.Now().UTC().Format(microTimeFormat)
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", ms.namespace, ms.leaseName())
+
+	var current lease
+	err := ms.client.Do(ctx, http.MethodGet, path, nil, &current)
+	if k8sclient.IsStatus(err, http.StatusNotFound) {
+		created := lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata: k8sclient.ObjectMeta{
+				Name:      ms.leaseName(),
+				Namespace: ms.namespace,
+				Labels:    map[string]string{memberGroupLabel: ms.group},
+			},
+			Spec: leaseSpec{
+				HolderIdentity:       ms.identity,
+				LeaseDurationSeconds: int32(memberLeaseExpiry / time.Second),
+				AcquireTime:          now,
+				RenewTime:            now,
+			},
+		}
+		return ms.client.Do(ctx, http.MethodPost,
+			fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", ms.namespace), created, nil)
+	}
+	if err != nil {
+		return err
+	}
+	current.Spec.RenewTime = now
+	return ms.client.Do(ctx, http.MethodPut, path, current, nil)
+}
+
+func (ms *memberSet) refresh(ctx context.Context) error {
+	var list leaseList
+	if err := ms.client.Do(ctx, http.MethodGet,
+		fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases?%s", ms.namespace,
+			url.Values{"labelSelector": {memberGroupLabel + "=" + ms.group}}.Encode()), nil, &list); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	members := []string{ms.identity}
+	for _, l := range list.Items {
+		if l.Spec.HolderIdentity != "" && l.Spec.HolderIdentity != ms.identity && !leaseExpired(l.Spec, now) {
+			members = append(members, l.Spec.HolderIdentity)
+		}
+	}
+	sort.Strings(members)
+
+	ms.mu.Lock()
+	changed := fmt.Sprint(ms.members) != fmt.Sprint(members)
+	ms.members = members
+	ms.mu.Unlock()
+	if changed {
+		log.Printf("Work partition group %s now has %d members: %v", ms.group, len(members), members)
+	}
+	return nil
+}
+
+// leave deletes this replica's Lease so its items are reassigned right away.
+func (ms *memberSet) leave() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	path := fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases/%s", ms.namespace, ms.leaseName())
+	if err := ms.client.Do(ctx, http.MethodDelete, path, nil, nil); err != nil && !k8sclient.IsStatus(err, http.StatusNotFound) {
+		log.Printf("Error deleting membership lease: %v", err)
+	}
+}
+
+func (ms *memberSet) list() []string {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+	return append([]string(nil), ms.members...)
+}
+
+// owner returns the member responsible for key.
+func (ms *memberSet) owner(key string) string {
+	var best string
+	var bestScore uint64
+	for _, m := range ms.list() {
+		h := fnv.New64a()
+		h.Write([]byte(m))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best, bestScore = m, score
+		}
+	}
+	return best
+}
+
+// owns reports whether this replica is responsible for key.
+func (ms *memberSet) owns(key string) bool {
+	return ms.owner(key) == ms.identity
+}
@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// peerTimeout bounds the /version call to each peer, so a replica that
+// hangs only leaves its own entry empty.
+const peerTimeout = 2 * time.Second
+
+// Peer is the version a replica behind the headless Service reported, or
+// why it didn't.
+type Peer struct {
+	Address string `json:"address"`
+	// Self is the replica that answered /api/v1/peers
+	Self      bool   `json:"self,omitempty"`
+	Version   string `json:"version,omitempty"`
+	GitCommit string `json:"git_commit,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// ServingVersion is a version and the number of replicas serving it.
+type ServingVersion struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"git_commit"`
+	Replicas  int    `json:"replicas"`
+}
+
+// PeersResponse is the response of /api/v1/peers: the versions the ready
+// replicas of the service are serving, so the skew of a rollout in progress
+// can be seen.
+type PeersResponse struct {
+	Service string `json:"service"`
+	Peers   []Peer `json:"peers"`
+	// Most replicas first
+	Versions []ServingVersion `json:"versions"`
+	// More than one version is serving
+	Skew      bool   `json:"skew"`
+	CheckedAt string `json:"checked_at"`
+}
+
+// peerSet asks the replicas behind a headless Service for their version.
+// The Service's DNS name resolves to the addresses of its ready pods, so no
+// access to the Kubernetes API is needed. A nil peerSet is disabled.
+type peerSet struct {
+	service  string
+	port     string
+	self     string
+	interval time.Duration
+	client   *http.Client
+	lookup   func(ctx context.Context, host string) ([]string, error)
+}
+
+func newPeerSet(cfg config.Config) *peerSet {
+	if cfg.PeersService == "" {
+		return nil
+	}
+	port := cfg.PeersPort
+	if port == "" {
+		port = cfg.Port
+	}
+	return &peerSet{
+		service:  cfg.PeersService,
+		port:     port,
+		self:     cfg.PodIP,
+		interval: cfg.PeersPollInterval,
+		client:   &http.Client{Timeout: peerTimeout},
+		lookup:   net.DefaultResolver.LookupHost,
+	}
+}
+
+// versions resolves the Service and calls /version on every address at
+// once. The caller's credentials are passed on, so peers behind JWT
+// authentication answer too.
+func (ps *peerSet) versions(ctx context.Context, authorization string) (PeersResponse, error) {
+	addrs, err := ps.lookup(ctx, ps.service)
+	if err != nil {
+		return PeersResponse{}, err
+	}
+	sort.Strings(addrs)
+	peers := make([]Peer, len(addrs))
+	var wg sync.WaitGroup
+	for i, addr := range addrs {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			peers[i] = ps.version(ctx, addr, authorization)
+		}(i, addr)
+	}
+	wg.Wait()
+
+	resp := PeersResponse{Service: ps.service, Peers: peers, Versions: servingVersions(peers),
+		CheckedAt: time.Now().UTC().Format(time.RFC3339)}
+	resp.Skew = len(resp.Versions) > 1
+	return resp, nil
+}
+
+func (ps *peerSet) version(ctx context.Context, addr, authorization string) Peer {
+	peer := Peer{Address: addr, Self: addr == ps.self}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+net.JoinHostPort(addr, ps.port)+"/version", nil)
+	if err != nil {
+		peer.Error = err.Error()
+		return peer
+	}
+	req.Header.Set("Accept", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		peer.Error = err.Error()
+		return peer
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		peer.Error = res.Status
+		return peer
+	}
+	var v handlers.VersionResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&v); err != nil {
+		peer.Error = fmt.Sprintf("decoding version: %v", err)
+		return peer
+	}
+	peer.Version, peer.GitCommit = v.Version, v.GitCommit
+	return peer
+}
+
+// servingVersions counts the replicas of each version the peers reported,
+// most replicas first.
+func servingVersions(peers []Peer) []ServingVersion {
+	counts := map[ServingVersion]int{}
+	for _, p := range peers {
+		if p.Error == "" {
+			counts[ServingVersion{Version: p.Version, GitCommit: p.GitCommit}]++
+		}
+	}
+	out := make([]ServingVersion, 0, len(counts))
+	for v, n := range counts {
+		v.Replicas = n
+		out = append(out, v)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Replicas != out[j].Replicas {
+			return out[i].Replicas > out[j].Replicas
+		}
+		return out[i].Version+out[i].GitCommit < out[j].Version+out[j].GitCommit
+	})
+	return out
+}
+
+// pollPeers runs on the leader only: every interval it asks the peers for
+// their version, sets backend_service_serving_replicas and publishes
+// versions.changed when the versions serving change, so the rollout is
+// reported once rather than by every replica. The gauge is cleared when
+// leadership is lost, leaving it to the next leader.
+func (s *Server) pollPeers(ctx context.Context) {
+	defer s.metrics.servingReplicas.Reset()
+	var last string
+	for {
+		if resp, err := s.peers.versions(ctx, ""); err != nil {
+			log.Printf("Error resolving peers %s: %v", s.peers.service, err)
+		} else {
+			s.metrics.servingReplicas.Reset()
+			key := ""
+			for _, v := range resp.Versions {
+				s.metrics.servingReplicas.Set(float64(v.Replicas), v.Version, v.GitCommit)
+				key += fmt.Sprintf("%s/%s=%d,", v.Version, v.GitCommit, v.Replicas)
+			}
+			if key != last {
+				last = key
+				s.bus.Emit(eventVersionsChanged, s.peers.service, versionsChangedEvent{
+					Service: resp.Service, Versions: resp.Versions, Skew: resp.Skew,
+				})
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.peers.interval):
+		}
+	}
+}
+
+// peersHandler serves /api/v1/peers: 503 when PEERS_SERVICE isn't set, 502
+// when it doesn't resolve.
+func (s *Server) peersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.peers == nil {
+		problem.Error(w, r, i18n.T(ctx, "error.peers_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	resp, err := s.peers.versions(ctx, r.Header.Get("Authorization"))
+	if err != nil {
+		log.Printf("Error resolving peers %s: %v", s.peers.service, err)
+		problem.Error(w, r, i18n.T(ctx, "error.peers_lookup", s.peers.service, err), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding peers response: %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+)
+
+// parseDownwardMap parses a downward API volume file holding a map, such as
+// metadata.labels: one key="value" pair per line, the value quoted as a Go
+// string.
+func parseDownwardMap(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, quoted, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %q is not key=value", line)
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return nil, fmt.Errorf("value of %s: %w", key, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// podLabels reads the labels from the downward API file on every call:
+// labels can change while the pod runs, and the kubelet rewrites the file
+// when they do, while env vars would keep the values the pod started with.
+// Without the volume, as outside Kubernetes, there are no labels.
+func podLabels(name string) func() map[string]string {
+	return func() map[string]string {
+		if name == "" {
+			return nil
+		}
+		data, err := os.ReadFile(name)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Error reading pod labels: %v", err)
+			return nil
+		}
+		labels, err := parseDownwardMap(data)
+		if err != nil {
+			log.Printf("Error parsing pod labels in %s: %v", name, err)
+			return nil
+		}
+		return labels
+	}
+}
+
+// resolveTrack returns the rollout track of the pod: TRACK or COLOR, else
+// the value of its TRACK_LABEL label when it started. The track labels
+// metrics, so it doesn't follow later label changes.
+func resolveTrack(cfg config.Config) string {
+	if cfg.Track != "" {
+		return cfg.Track
+	}
+	if cfg.TrackLabel == "" {
+		return ""
+	}
+	return podLabels(cfg.PodLabelsFile)()[cfg.TrackLabel]
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const (
+	pressureCheckInterval = 5 * time.Second
+
+	// pressureModeDegraded keeps the pod in the Service but reports
+	// "degraded"; pressureModeUnready takes it out until the pressure clears.
+	pressureModeDegraded = "degraded"
+	pressureModeUnready  = "unready"
+)
+
+var pressureConditions = map[string]bool{
+	"MemoryPressure": true,
+	"DiskPressure":   true,
+	"PIDPressure":    true,
+}
+
+type nodeConditions struct {
+	Status struct {
+		Conditions []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// nodePressure follows the pressure conditions of the local node through the
+// shared node informer and reflects them in readiness, so a demo can show the
+// pod backing off gracefully before the kubelet starts evicting.
+type nodePressure struct {
+	client   *k8sclient.Client
+	recorder *eventRecorder
+	nodeName string
+	mode     string
+
+	mu         sync.RWMutex
+	conditions []string
+}
+
+func newNodePressure(client *k8sclient.Client, recorder *eventRecorder, nodeName, mode string) *nodePressure {
+	if mode != pressureModeUnready {
+		mode = pressureModeDegraded
+	}
+	return &nodePressure{client: client, recorder: recorder, nodeName: nodeName, mode: mode}
+}
+
+func (np *nodePressure) run(ctx context.Context) {
+	if np.client == nil || np.nodeName == "" {
+		return
+	}
+	log.Printf("Watching node %s for resource pressure (mode: %s)", np.nodeName, np.mode)
+	ticker := time.NewTicker(pressureCheckInterval)
+	defer ticker.Stop()
+	for {
+		np.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (np *nodePressure) check(ctx context.Context) {
+	var n nodeConditions
+	if err := nodeInformer(np.client, np.nodeName).GetOrFetch(ctx, np.nodeName, &n); err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Error reading node %s conditions: %v", np.nodeName, err)
+		}
+		return
+	}
+	var active []string
+	for _, c := range n.Status.Conditions {
+		if pressureConditions[c.Type] && c.Status == "True" {
+			active = append(active, c.Type)
+		}
+	}
+	sort.Strings(active)
+
+	np.mu.Lock()
+	previous := np.conditions
+	np.conditions = active
+	np.mu.Unlock()
+
+	switch {
+	case len(active) > 0 && strings.Join(active, ",") != strings.Join(previous, ","):
+		log.Printf("Node %s under pressure: %s", np.nodeName, strings.Join(active, ", "))
+		np.recorder.Eventf(eventTypeWarning, reasonNodePressure,
+			"Node %s reports %s; pod is now %s", np.nodeName, strings.Join(active, ", "), np.mode)
+	case len(active) == 0 && len(previous) > 0:
+		log.Printf("Node %s pressure cleared", np.nodeName)
+		np.recorder.Eventf(eventTypeNormal, reasonNodePressure, "Node %s pressure cleared", np.nodeName)
+	}
+}
+
+// active returns the pressure conditions currently reported by the node.
+func (np *nodePressure) active() []string {
+	np.mu.RLock()
+	defer np.mu.RUnlock()
+	return np.conditions
+}
@@ -0,0 +1,524 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// promoteTimeout bounds a promotion, which takes several calls to the Git
+// host's API, past the server's WriteTimeout.
+const promoteTimeout = 30 * time.Second
+
+// imageTagPattern is the syntax of a container image tag.
+var imageTagPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+
+var (
+	errAlreadyPromoted = errors.New("the environment already declares the tag")
+	errBranchExists    = errors.New("the promotion branch already exists")
+)
+
+// PromoteRequest is the body of POST /api/v1/gitops/promote.
+type PromoteRequest struct {
+	Environment string `json:"environment" validate:"required"`
+	Tag         string `json:"tag" validate:"required,max=128"`
+}
+
+// PromoteResponse is the response of /api/v1/gitops/promote: the pull
+// request (a merge request on GitLab) that sets the environment's image tag.
+// The environment is promoted once it's merged and synced.
+type PromoteResponse struct {
+	Environment string `json:"environment"`
+	Image       string `json:"image"`
+	Tag         string `json:"tag"`
+	PreviousTag string `json:"previous_tag"`
+	Repository  string `json:"repository"`
+	File        string `json:"file"`
+	Branch      string `json:"branch"`
+	PullRequest int    `json:"pull_request"`
+	URL         string `json:"url"`
+}
+
+// gitHost is the API of the GitHub or GitLab repository holding the
+// manifests. version is what the host needs to update a file it read, if
+// anything.
+type gitHost interface {
+	readFile(ctx context.Context, branch, path string) (content []byte, version string, err error)
+	createBranch(ctx context.Context, name, from string) error
+	deleteBranch(ctx context.Context, name string) error
+	writeFile(ctx context.Context, branch, path string, content []byte, version, message string) error
+	openPullRequest(ctx context.Context, branch, base, title, body string) (number int, url string, err error)
+}
+
+// promoter opens the pull requests that bump an environment's image tag,
+// so promotions go through review and Git like any other change. A nil
+// promoter is disabled.
+type promoter struct {
+	host         gitHost
+	repo         string
+	base         string
+	image        string
+	path         string
+	environments []string
+	client       *http.Client
+}
+
+func newPromoter(cfg config.Config) *promoter {
+	if cfg.GitOpsRepo == "" || cfg.GitOpsPromoteToken == "" {
+		return nil
+	}
+	p := &promoter{
+		repo:         cfg.GitOpsRepo,
+		base:         cfg.GitOpsRepoBranch,
+		image:        cfg.GitOpsImage,
+		path:         cfg.GitOpsPromotePath,
+		environments: cfg.GitOpsPromoteEnvironments,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+	api := repoAPI{baseURL: strings.TrimRight(cfg.GitOpsRepoAPIURL, "/"), client: p.client}
+	if cfg.GitOpsRepoProvider == "gitlab" {
+		if api.baseURL == "" {
+			api.baseURL = "https://gitlab.com/api/v4"
+		}
+		api.header = http.Header{"Private-Token": {cfg.GitOpsPromoteToken}}
+		p.host = &gitlabHost{api: api, project: url.PathEscape(cfg.GitOpsRepo)}
+	} else {
+		if api.baseURL == "" {
+			api.baseURL = "https://api.github.com"
+		}
+		api.header = http.Header{
+			"Authorization":        {"Bearer " + cfg.GitOpsPromoteToken},
+			"Accept":               {"application/vnd.github+json"},
+			"X-Github-Api-Version": {"2022-11-28"},
+		}
+		p.host = &githubHost{api: api, repo: cfg.GitOpsRepo}
+	}
+	return p
+}
+
+// promote commits the new tag to a branch and opens its pull request.
+func (p *promoter) promote(ctx context.Context, req PromoteRequest, actor string) (PromoteResponse, error) {
+	resp := PromoteResponse{
+		Environment: req.Environment,
+		Image:       p.image,
+		Tag:         req.Tag,
+		Repository:  p.repo,
+		File:        strings.ReplaceAll(p.path, "{environment}", req.Environment),
+		Branch:      "promote/" + req.Environment + "-" + req.Tag,
+	}
+	manifest, version, err := p.host.readFile(ctx, p.base, resp.File)
+	if err != nil {
+		return resp, fmt.Errorf("reading %s: %w", resp.File, err)
+	}
+	updated, previous, err := setImageTag(manifest, p.image, req.Tag)
+	if err != nil {
+		return resp, fmt.Errorf("%s: %w", resp.File, err)
+	}
+	resp.PreviousTag = previous
+	if previous == req.Tag {
+		return resp, errAlreadyPromoted
+	}
+	if err := p.host.createBranch(ctx, resp.Branch, p.base); err != nil {
+		return resp, err
+	}
+	title := fmt.Sprintf("Promote %s to %s:%s", req.Environment, p.image, req.Tag)
+	if err := p.host.writeFile(ctx, resp.Branch, resp.File, updated, version, title); err != nil {
+		p.abandon(ctx, resp.Branch)
+		return resp, fmt.Errorf("committing %s: %w", resp.File, err)
+	}
+	body := fmt.Sprintf("Sets the image tag of %s in `%s` from `%s` to `%s`.\n\nRequested by %s through /api/v1/gitops/promote.",
+		req.Environment, resp.File, previous, req.Tag, actor)
+	if resp.PullRequest, resp.URL, err = p.host.openPullRequest(ctx, resp.Branch, p.base, title, body); err != nil {
+		p.abandon(ctx, resp.Branch)
+		return resp, fmt.Errorf("opening the pull request: %w", err)
+	}
+	return resp, nil
+}
+
+// abandon deletes the branch of a promotion that failed after creating it,
+// so retrying doesn't find the branch taken. It runs past ctx, which may
+// be what ended the promotion.
+func (p *promoter) abandon(ctx context.Context, branch string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	if err := p.host.deleteBranch(ctx, branch); err != nil {
+		log.Printf("Error deleting branch %s of a failed promotion: %v", branch, err)
+	}
+}
+
+// setImageTag sets the tag image has in the YAML documents of manifest and
+// returns the manifest and the tag it had. It changes the tag where it is
+// written and nothing else, so comments and formatting survive. The tag is
+// the newTag of a kustomization's images entry, the tag next to the
+// repository of Helm values, or part of a container image reference.
+func setImageTag(manifest []byte, image, tag string) ([]byte, string, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(manifest))
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			return nil, "", fmt.Errorf("no tag of %s found", image)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("parsing the manifest: %w", err)
+		}
+		node, isRef := imageTagNode(&doc, image)
+		if node == nil {
+			continue
+		}
+		previous, value := node.Value, tag
+		if isRef {
+			_, previous = splitImage(node.Value)
+			value = image + ":" + tag
+		}
+		updated, err := replaceScalar(manifest, node, value)
+		return updated, previous, err
+	}
+}
+
+// imageTagNode finds the scalar holding the tag of image; isRef reports an
+// image reference, whose whole value is replaced.
+func imageTagNode(node *yaml.Node, image string) (tag *yaml.Node, isRef bool) {
+	switch node.Kind {
+	case yaml.DocumentNode, yaml.SequenceNode:
+		for _, n := range node.Content {
+			if tag, isRef := imageTagNode(n, image); tag != nil {
+				return tag, isRef
+			}
+		}
+	case yaml.MappingNode:
+		values := map[string]*yaml.Node{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			values[node.Content[i].Value] = node.Content[i+1]
+		}
+		is := func(key string) bool {
+			return values[key] != nil && values[key].Kind == yaml.ScalarNode && values[key].Value == image
+		}
+		switch {
+		case values["newTag"] != nil && (is("name") || is("newName")):
+			return values["newTag"], false
+		case values["tag"] != nil && is("repository"):
+			return values["tag"], false
+		}
+		if ref := values["image"]; ref != nil && ref.Kind == yaml.ScalarNode {
+			if repo, _ := splitImage(ref.Value); repo == image {
+				return ref, true
+			}
+		}
+		for i := 1; i < len(node.Content); i += 2 {
+			if tag, isRef := imageTagNode(node.Content[i], image); tag != nil {
+				return tag, isRef
+			}
+		}
+	}
+	return nil, false
+}
+
+// replaceScalar replaces the source text of the single-line scalar node in
+// manifest with value, quoted like it was, or when YAML would read it as
+// something other than a string.
+func replaceScalar(manifest []byte, node *yaml.Node, value string) ([]byte, error) {
+	lines := bytes.SplitAfter(manifest, []byte("\n"))
+	if node.Line < 1 || node.Line > len(lines) {
+		return nil, errors.New("tag out of the manifest")
+	}
+	line := lines[node.Line-1]
+	start := 0
+	for col := 1; col < node.Column && start < len(line); col++ {
+		_, size := utf8.DecodeRune(line[start:])
+		start += size
+	}
+	quote := ""
+	switch node.Style {
+	case 0:
+		var v any
+		if yaml.Unmarshal([]byte(value), &v) != nil || fmt.Sprint(v) != value || !isString(v) {
+			quote = `"`
+		}
+	case yaml.DoubleQuotedStyle:
+		quote = `"`
+	case yaml.SingleQuotedStyle:
+		quote = `'`
+	default:
+		return nil, errors.New("the tag is a block scalar")
+	}
+	old := node.Value
+	if node.Style != 0 {
+		old = quote + old + quote
+	}
+	width := len(old)
+	if !bytes.HasPrefix(line[start:], []byte(old)) {
+		return nil, errors.New("the tag isn't written as a single-line scalar")
+	}
+	var out bytes.Buffer
+	for i, l := range lines {
+		if i != node.Line-1 {
+			out.Write(l)
+			continue
+		}
+		out.Write(l[:start])
+		out.WriteString(quote + value + quote)
+		out.Write(l[start+width:])
+	}
+	return out.Bytes(), nil
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// repoAPI calls the JSON API of a Git host.
+type repoAPI struct {
+	baseURL string
+	header  http.Header
+	client  *http.Client
+}
+
+// repoAPIError is an answer of the Git host other than 2xx.
+type repoAPIError struct {
+	Status  int
+	Message string
+	call    string
+}
+
+func (e *repoAPIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("%s: %d %s", e.call, e.Status, http.StatusText(e.Status))
+	}
+	return fmt.Sprintf("%s: %d %s: %s", e.call, e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// do sends in as JSON and decodes the answer into out, which may be a
+// *[]byte for the raw body.
+func (a repoAPI) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, a.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	for k, v := range a.header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(res.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode/100 != 2 {
+		apiErr := &repoAPIError{Status: res.StatusCode, call: method + " " + strings.SplitN(path, "?", 2)[0]}
+		var e struct {
+			Message any `json:"message"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Message != nil {
+			apiErr.Message = fmt.Sprint(e.Message)
+		}
+		return apiErr
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw = data
+		return nil
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// githubHost is a GitHub repository, named owner/repo.
+type githubHost struct {
+	api  repoAPI
+	repo string
+}
+
+func (g *githubHost) readFile(ctx context.Context, branch, path string) ([]byte, string, error) {
+	var file struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+		SHA      string `json:"sha"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, "/repos/"+g.repo+"/contents/"+path+"?ref="+url.QueryEscape(branch), nil, &file); err != nil {
+		return nil, "", err
+	}
+	if file.Encoding != "base64" {
+		return nil, "", fmt.Errorf("unexpected %q encoding of the file", file.Encoding)
+	}
+	content, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(file.Content, "\n", ""))
+	return content, file.SHA, err
+}
+
+func (g *githubHost) createBranch(ctx context.Context, name, from string) error {
+	var ref struct {
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+	}
+	if err := g.api.do(ctx, http.MethodGet, "/repos/"+g.repo+"/git/ref/heads/"+from, nil, &ref); err != nil {
+		return err
+	}
+	err := g.api.do(ctx, http.MethodPost, "/repos/"+g.repo+"/git/refs",
+		map[string]string{"ref": "refs/heads/" + name, "sha": ref.Object.SHA}, nil)
+	var apiErr *repoAPIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusUnprocessableEntity {
+		return errBranchExists
+	}
+	return err
+}
+
+func (g *githubHost) deleteBranch(ctx context.Context, name string) error {
+	return g.api.do(ctx, http.MethodDelete, "/repos/"+g.repo+"/git/refs/heads/"+name, nil, nil)
+}
+
+func (g *githubHost) writeFile(ctx context.Context, branch, path string, content []byte, version, message string) error {
+	return g.api.do(ctx, http.MethodPut, "/repos/"+g.repo+"/contents/"+path, map[string]string{
+		"message": message,
+		"content": base64.StdEncoding.EncodeToString(content),
+		"sha":     version,
+		"branch":  branch,
+	}, nil)
+}
+
+func (g *githubHost) openPullRequest(ctx context.Context, branch, base, title, body string) (int, string, error) {
+	var pr struct {
+		Number  int    `json:"number"`
+		HTMLURL string `json:"html_url"`
+	}
+	err := g.api.do(ctx, http.MethodPost, "/repos/"+g.repo+"/pulls",
+		map[string]string{"title": title, "head": branch, "base": base, "body": body}, &pr)
+	return pr.Number, pr.HTMLURL, err
+}
+
+// gitlabHost is a GitLab project, identified by its escaped path.
+type gitlabHost struct {
+	api     repoAPI
+	project string
+}
+
+func (g *gitlabHost) readFile(ctx context.Context, branch, path string) ([]byte, string, error) {
+	var content []byte
+	err := g.api.do(ctx, http.MethodGet,
+		"/projects/"+g.project+"/repository/files/"+url.PathEscape(path)+"/raw?ref="+url.QueryEscape(branch), nil, &content)
+	return content, "", err
+}
+
+func (g *gitlabHost) createBranch(ctx context.Context, name, from string) error {
+	err := g.api.do(ctx, http.MethodPost, "/projects/"+g.project+"/repository/branches",
+		map[string]string{"branch": name, "ref": from}, nil)
+	var apiErr *repoAPIError
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusBadRequest && strings.Contains(apiErr.Message, "already exists") {
+		return errBranchExists
+	}
+	return err
+}
+
+func (g *gitlabHost) deleteBranch(ctx context.Context, name string) error {
+	return g.api.do(ctx, http.MethodDelete, "/projects/"+g.project+"/repository/branches/"+url.PathEscape(name), nil, nil)
+}
+
+func (g *gitlabHost) writeFile(ctx context.Context, branch, path string, content []byte, _, message string) error {
+	return g.api.do(ctx, http.MethodPut, "/projects/"+g.project+"/repository/files/"+url.PathEscape(path), map[string]string{
+		"branch":         branch,
+		"content":        string(content),
+		"commit_message": message,
+	}, nil)
+}
+
+func (g *gitlabHost) openPullRequest(ctx context.Context, branch, base, title, body string) (int, string, error) {
+	var mr struct {
+		IID    int    `json:"iid"`
+		WebURL string `json:"web_url"`
+	}
+	err := g.api.do(ctx, http.MethodPost, "/projects/"+g.project+"/merge_requests", map[string]any{
+		"source_branch":        branch,
+		"target_branch":        base,
+		"title":                title,
+		"description":          body,
+		"remove_source_branch": true,
+	}, &mr)
+	return mr.IID, mr.WebURL, err
+}
+
+// promoteHandler serves POST /api/v1/gitops/promote: 201 with the pull
+// request, 409 when the environment already declares the tag or its branch
+// exists, 502 when the Git host fails, 503 when GITOPS_REPO or
+// GITOPS_PROMOTE_TOKEN isn't set.
+func (s *Server) promoteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if s.promoter == nil {
+		problem.Error(w, r, i18n.T(ctx, "error.promote_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	var req PromoteRequest
+	if err := validate.DecodeJSON(w, r, &req, 4<<10); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	var fields []validate.FieldError
+	if !slices.Contains(s.promoter.environments, req.Environment) {
+		fields = append(fields, validate.FieldError{Field: "environment",
+			Message: i18n.T(ctx, "validation.oneof", strings.Join(s.promoter.environments, ", "))})
+	}
+	if !imageTagPattern.MatchString(req.Tag) {
+		fields = append(fields, validate.FieldError{Field: "tag", Message: i18n.T(ctx, "validation.image_tag")})
+	}
+	if len(fields) > 0 {
+		validate.WriteError(w, r, &validate.Error{Fields: fields})
+		return
+	}
+
+	// The calls to the Git host may outlast the server's WriteTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(promoteTimeout + 5*time.Second))
+	resp, err := s.promoter.promote(ctx, req, s.actor(r))
+	switch {
+	case errors.Is(err, errAlreadyPromoted):
+		problem.Error(w, r, i18n.T(ctx, "error.promote_unchanged", req.Environment, req.Tag), http.StatusConflict)
+		return
+	case errors.Is(err, errBranchExists):
+		problem.Error(w, r, i18n.T(ctx, "error.promote_branch_exists", resp.Branch), http.StatusConflict)
+		return
+	case err != nil:
+		log.Printf("Error promoting %s to %s: %v", req.Environment, req.Tag, err)
+		problem.Error(w, r, i18n.T(ctx, "error.promote_failed", err), http.StatusBadGateway)
+		return
+	}
+	log.Printf("Opened %s to promote %s from %s to %s", resp.URL, req.Environment, resp.PreviousTag, req.Tag)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", resp.URL)
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding promote response: %v", err)
+	}
+}
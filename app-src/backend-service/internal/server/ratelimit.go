@@ -0,0 +1,55 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/ratelimit"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+func rateLimits(cfg config.Config) ratelimit.Limits {
+	return ratelimit.Limits{
+		RPS:         cfg.RateLimitRPS,
+		Burst:       cfg.RateLimitBurst,
+		ClientRPS:   cfg.RateLimitClientRPS,
+		ClientBurst: cfg.RateLimitClientBurst,
+	}
+}
+
+// rateLimitMiddleware refuses requests over the global or per-client rate
+// limit with 429 and a Retry-After. The limits are read from the live
+// settings, so a synced ConfigMap change applies without a restart.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limits := s.live.get().rateLimits
+		if !limits.Enabled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, scope, wait := s.limiter.Allow(s.clientIP(r), limits)
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		name := unmatchedRoute
+		if route, ok := router.RouteFromContext(r.Context()); ok {
+			name = route.Name
+		}
+		s.metrics.limited.Inc(name, scope)
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		problem.Error(w, r, i18n.T(r.Context(), "error.rate_limited", scope), http.StatusTooManyRequests)
+	})
+}
+
+// clientIP names the client of r for rate limits and the audit log; only
+// the forwarded headers of TRUSTED_PROXIES are believed, so a client can't
+// pose as another, or as a new one per request.
+func (s *Server) clientIP(r *http.Request) string {
+	return handlers.TrustedClientIP(r, s.trustedProxies)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+)
+
+// readinessCheckTimeout bounds a whole /readyz evaluation, below the probe's
+// timeoutSeconds so a slow dependency fails the check rather than the probe.
+const readinessCheckTimeout = 2 * time.Second
+
+// readinessCheck is one condition of readiness. A failing critical check
+// takes the pod out of the Service and sets the readiness status to its
+// reason; a failing non-critical check only reports the pod degraded.
+type readinessCheck struct {
+	name     string
+	reason   string
+	critical bool
+	check    func(ctx context.Context) error
+}
+
+// ReadinessCheck is the result of one check. Error and duration are only
+// reported with ?verbose=1, since errors can name internal hosts.
+type ReadinessCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Critical   bool    `json:"critical"`
+	Error      string  `json:"error,omitempty"`
+	DurationMs float64 `json:"duration_ms,omitempty"`
+}
+
+// ReadinessResponse is the body of /ready and /readyz: the probe response
+// with the result of every registered check.
+type ReadinessResponse struct {
+	handlers.HealthResponse
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// readinessChecks is the registry of readiness checks. Components and
+// dependencies such as databases, caches and downstream services register
+// theirs when they are built; checks run concurrently on every probe.
+type readinessChecks struct {
+	mu     sync.RWMutex
+	checks []readinessCheck
+}
+
+func (rc *readinessChecks) register(c readinessCheck) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.checks = append(rc.checks, c)
+}
+
+// evaluate runs every check and returns the readiness status with the
+// results in registration order. The status is the reason of the first
+// failing critical check, "degraded" when only non-critical checks fail, or
+// "ready".
+func (rc *readinessChecks) evaluate(ctx context.Context) (string, []ReadinessCheck) {
+	rc.mu.RLock()
+	checks := append([]readinessCheck{}, rc.checks...)
+	rc.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+	defer cancel()
+	results := make([]ReadinessCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c readinessCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.check(ctx)
+			result := ReadinessCheck{
+				Name:       c.name,
+				Status:     "ok",
+				Critical:   c.critical,
+				DurationMs: math.Round(float64(time.Since(start).Microseconds())) / 1000,
+			}
+			if err != nil {
+				result.Status, result.Error = "failed", err.Error()
+			}
+			results[i] = result
+		}(i, c)
+	}
+	wg.Wait()
+
+	status := "ready"
+	for i, c := range checks {
+		if results[i].Status == "ok" {
+			continue
+		}
+		if c.critical {
+			return c.reason, results
+		}
+		status = "degraded"
+	}
+	return status, results
+}
+
+// registerReadinessChecks registers the checks of the server's own
+// components, in the order their reasons take precedence.
+func (s *Server) registerReadinessChecks() {
+	cfg := s.cfg
+	s.checks.register(readinessCheck{name: "drain", reason: "draining", critical: true,
+		check: func(context.Context) error {
+			if s.draining.Load() {
+				return errors.New("draining for shutdown")
+			}
+			return nil
+		}})
+	s.checks.register(readinessCheck{name: "admin-drain", reason: "drained", critical: true,
+		check: func(context.Context) error {
+			if s.drainedAt.Load() != 0 {
+				return errors.New("drained by admin request")
+			}
+			return nil
+		}})
+	s.checks.register(readinessCheck{name: "startup", reason: "not_ready", critical: true,
+		check: func(context.Context) error {
+			if !s.ready.Load() {
+				return errors.New("still starting")
+			}
+			return nil
+		}})
+	if len(cfg.SidecarReadinessURLs) > 0 {
+		s.checks.register(readinessCheck{name: "sidecars", reason: "waiting_for_sidecars", critical: true,
+			check: func(context.Context) error {
+				if !s.sidecars.ready() {
+					return errors.New("not every sidecar is ready")
+				}
+				return nil
+			}})
+	}
+	if len(cfg.VolumeCheckPaths) > 0 {
+		s.checks.register(readinessCheck{name: "storage", reason: "storage_unhealthy", critical: true,
+			check: func(context.Context) error { return s.storage.err() }})
+	}
+	if cfg.NodePressureEnabled {
+		s.checks.register(readinessCheck{name: "node-pressure", reason: "node_pressure",
+			critical: s.pressure.mode == pressureModeUnready,
+			check: func(context.Context) error {
+				if active := s.pressure.active(); len(active) > 0 {
+					return fmt.Errorf("node %s reports %s", cfg.NodeName, strings.Join(active, ", "))
+				}
+				return nil
+			}})
+	}
+	if s.db != nil {
+		s.checks.register(readinessCheck{name: "postgres", reason: "database_unavailable", critical: true,
+			check: s.db.Ping})
+	}
+	// The cache is an optimization: without Redis, responses are served
+	// uncached.
+	if s.cache != nil {
+		s.checks.register(readinessCheck{name: "redis", reason: "cache_unavailable", check: s.cache.ping})
+	}
+	// Events are dropped while the broker is down; serving goes on.
+	if s.bus != nil {
+		s.checks.register(readinessCheck{name: "event-broker", reason: "broker_unavailable", check: s.bus.Ping})
+	}
+	client := &http.Client{Transport: requestid.Transport(nil)}
+	for _, raw := range cfg.ReadinessDependencyURLs {
+		name := raw
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			name = u.Host
+		}
+		target := raw
+		s.checks.register(readinessCheck{name: "http:" + name, reason: "dependency_unavailable",
+			critical: cfg.ReadinessDependenciesCritical,
+			check:    func(ctx context.Context) error { return checkHTTP(ctx, client, target) }})
+	}
+}
+
+// checkHTTP expects a 2xx answer from a downstream endpoint.
+func checkHTTP(ctx context.Context, client *http.Client, target string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// readinessStatus returns "ready", "degraded" (ready, but a non-critical
+// check fails) or the reason the pod shouldn't receive traffic.
+func (s *Server) readinessStatus(ctx context.Context) string {
+	status, _ := s.checks.evaluate(ctx)
+	return status
+}
+
+// startupHandler answers the startup probe: "starting" until the simulated
+// initialization is done, then "started" for the life of the process, so a
+// later readiness failure doesn't restart the container.
+func (s *Server) startupHandler(w http.ResponseWriter, _ *http.Request) {
+	status, code := "started", http.StatusOK
+	if !s.ready.Load() {
+		status, code = "starting", http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(handlers.NewHealthResponse(status, s.cfg.Build.Version)); err != nil {
+		log.Printf("Error encoding startup response: %v", err)
+	}
+}
+
+func (s *Server) readinessHandler(w http.ResponseWriter, r *http.Request) {
+	status, checks := s.checks.evaluate(r.Context())
+	s.lifecycle.observeReadiness(status)
+	if verbose := r.URL.Query().Get("verbose"); verbose == "" || verbose == "0" || verbose == "false" {
+		for i := range checks {
+			checks[i].Error, checks[i].DurationMs = "", 0
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if status == "ready" || status == "degraded" {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	resp := ReadinessResponse{HealthResponse: handlers.NewHealthResponse(status, s.cfg.Build.Version), Checks: checks}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding readiness response: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/recording"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+type RecordingsResponse struct {
+	Enabled       bool             `json:"enabled"`
+	SamplePercent int64            `json:"sample_percent"`
+	Files         []recording.File `json:"files"`
+}
+
+// recordingsHandler serves /admin/recordings, the files of recorded traffic
+// to download and feed to cmd/replay.
+func (s *Server) recordingsHandler(w http.ResponseWriter, r *http.Request) {
+	resp := RecordingsResponse{
+		Enabled:       s.recordings.Enabled(),
+		SamplePercent: s.cfg.RecordingSamplePercent,
+		Files:         []recording.File{},
+	}
+	if resp.Enabled {
+		files, err := s.recordings.Files()
+		if err != nil {
+			problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp.Files = files
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding recordings response: %v", err)
+	}
+}
+
+// recordingHandler serves one recording file as JSON lines.
+func (s *Server) recordingHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Param(r, "name")
+	f, err := s.recordings.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", name), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	// A large file on a slow link takes longer than the server's
+	// WriteTimeout; the route has no timeout of its own either.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("Error sending recording %s: %v", name, err)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// recoverMiddleware turns a panicking handler into a 500 problem response
+// and an error log entry with the stack, where net/http would only log the
+// panic and drop the connection. It sits inside "log" and "metrics" so the
+// failed request is still logged and counted as a 500.
+func (s *Server) recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := &trackingWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			// ErrAbortHandler deliberately aborts the response, e.g. from
+			// httputil.ReverseProxy; let net/http handle it quietly.
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+			name := unmatchedRoute
+			if route, ok := router.RouteFromContext(r.Context()); ok {
+				name = route.Name
+			}
+			s.metrics.panics.Inc(name)
+			log.Printf("Error: panic serving %s %s (route %s, request %s): %v\n%s",
+				r.Method, r.URL.Path, name, requestid.FromContext(r.Context()), v, debug.Stack())
+			if tw.written {
+				// Too late for an error response; the client gets a
+				// truncated body.
+				return
+			}
+			p := problem.New(http.StatusInternalServerError, i18n.T(r.Context(), "error.internal"))
+			p.Type, p.Title = problem.TypeInternal, "Internal server error"
+			problem.Write(w, r, p)
+		}()
+		next.ServeHTTP(tw, r)
+	})
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// InstanceRegistration is the payload sent to the service registry.
+type InstanceRegistration struct {
+	ID          string            `json:"id"`
+	Service     string            `json:"service"`
+	Version     string            `json:"version"`
+	GitCommit   string            `json:"git_commit"`
+	Environment string            `json:"environment"`
+	Namespace   string            `json:"namespace,omitempty"`
+	URL         string            `json:"url"`
+	Endpoints   map[string]string `json:"endpoints"`
+	StartedAt   string            `json:"started_at"`
+}
+
+// registryClient registers this instance with an external registry (the
+// dashboard/config service) on startup, re-registers on an interval as a
+// heartbeat and deregisters on shutdown, so cross-environment views work
+// without access to every cluster's Kubernetes API.
+//
+// The registry is expected to accept PUT {base}/instances/{id} and
+// DELETE {base}/instances/{id}. A nil registryClient is a no-op.
+type registryClient struct {
+	baseURL  string
+	token    string
+	interval time.Duration
+	client   *http.Client
+	instance InstanceRegistration
+}
+
+func newRegistryClient(baseURL, token string, interval time.Duration, instance InstanceRegistration) *registryClient {
+	if baseURL == "" {
+		return nil
+	}
+	return &registryClient{
+		baseURL:  strings.TrimRight(baseURL, "/"),
+		token:    token,
+		interval: interval,
+		client:   &http.Client{Timeout: 5 * time.Second},
+		instance: instance,
+	}
+}
+
+// run registers and keeps the registration fresh until ctx is cancelled,
+// then deregisters.
+func (rc *registryClient) run(ctx context.Context) {
+	if rc == nil {
+		return
+	}
+	registered := false
+	ticker := time.NewTicker(rc.interval)
+	defer ticker.Stop()
+	for {
+		if err := rc.register(ctx); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("Error registering with service registry %s: %v", rc.baseURL, err)
+			}
+		} else if !registered {
+			registered = true
+			log.Printf("Registered instance %s with service registry %s", rc.instance.ID, rc.baseURL)
+		}
+		select {
+		case <-ctx.Done():
+			if registered {
+				rc.deregister()
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rc *registryClient) register(ctx context.Context) error {
+	body, err := json.Marshal(rc.instance)
+	if err != nil {
+		return err
+	}
+	return rc.do(ctx, http.MethodPut, body)
+}
+
+func (rc *registryClient) deregister() {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := rc.do(ctx, http.MethodDelete, nil); err != nil {
+		log.Printf("Error deregistering from service registry %s: %v", rc.baseURL, err)
+		return
+	}
+	log.Printf("Deregistered instance %s from service registry", rc.instance.ID)
+}
+
+func (rc *registryClient) do(ctx context.Context, method string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method,
+		fmt.Sprintf("%s/instances/%s", rc.baseURL, url.PathEscape(rc.instance.ID)), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// A missing registration on delete is already the desired state.
+	if resp.StatusCode >= 300 && !(method == http.MethodDelete && resp.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/ratelimit"
+)
+
+const configFilePollInterval = 5 * time.Second
+
+// tunableKeys are the settings a reload applies; changes to any other
+// setting are reported as needing a restart.
+var tunableKeys = map[string]bool{
+	"LOG_LEVEL":               true,
+	"INFO_MESSAGE":            true,
+	"INFO_FIELDS":             true,
+	"REQUEST_TIMEOUT_SECONDS": true,
+	"CONFIG_REDACT_PATTERNS":  true,
+
+	"RATE_LIMIT_RPS":              true,
+	"RATE_LIMIT_BURST":            true,
+	"RATE_LIMIT_PER_CLIENT_RPS":   true,
+	"RATE_LIMIT_PER_CLIENT_BURST": true,
+
+	"CHAOS_LATENCY_MS":      true,
+	"CHAOS_LATENCY_PERCENT": true,
+	"CHAOS_ERROR_PERCENT":   true,
+}
+
+// tunables are the settings that change without a restart.
+type tunables struct {
+	generation     int64
+	loadedAt       time.Time
+	trigger        string
+	logLevel       string
+	infoMessage    string
+	infoFields     []string
+	templates      infoTemplates
+	requestTimeout time.Duration
+	redactPatterns []string
+	rateLimits     ratelimit.Limits
+	chaos          chaosSettings
+}
+
+// LiveConfigResponse is the /api/config response.
+type LiveConfigResponse struct {
+	Generation            int64    `json:"generation"`
+	LoadedAt              string   `json:"loaded_at"`
+	Trigger               string   `json:"trigger"`
+	File                  string   `json:"file,omitempty"`
+	LogLevel              string   `json:"log_level"`
+	InfoMessage           string   `json:"info_message,omitempty"`
+	InfoFields            []string `json:"info_fields,omitempty"`
+	RequestTimeoutSeconds float64  `json:"request_timeout_seconds"`
+	RedactPatterns        []string `json:"redact_patterns,omitempty"`
+	RestartRequired       []string `json:"restart_required"`
+	LastError             string   `json:"last_error,omitempty"`
+	LastErrorAt           string   `json:"last_error_at,omitempty"`
+
+	// Rate limits of API requests; zero rates are disabled
+	RateLimitRPS            int64 `json:"rate_limit_rps"`
+	RateLimitBurst          int64 `json:"rate_limit_burst"`
+	RateLimitPerClientRPS   int64 `json:"rate_limit_per_client_rps"`
+	RateLimitPerClientBurst int64 `json:"rate_limit_per_client_burst"`
+
+	// Faults injected into API requests
+	ChaosLatencyMs      int64 `json:"chaos_latency_ms"`
+	ChaosLatencyPercent int64 `json:"chaos_latency_percent"`
+	ChaosErrorPercent   int64 `json:"chaos_error_percent"`
+}
+
+// liveConfig reloads the configuration when the config file changes or the
+// process gets SIGHUP, and swaps in the tunable settings atomically. The
+// kubelet updates a mounted ConfigMap within a minute or so of a sync.
+type liveConfig struct {
+	file    string
+	current atomic.Pointer[tunables]
+
+	// mu serializes reloads and guards the fields below.
+	mu          sync.Mutex
+	stamp       string
+	startup     map[string]string
+	restart     []string
+	lastError   string
+	lastErrorAt time.Time
+	onApply     []func(generation int64, trigger string)
+
+	// logLevel replaces the configured log level from /admin/loglevel
+	// until it's deleted.
+	logLevel atomic.Pointer[logLevelOverride]
+}
+
+func newLiveConfig(cfg config.Config) (*liveConfig, error) {
+	templates, err := parseInfoTemplates(cfg.InfoMessage, cfg.InfoFields)
+	if err != nil {
+		return nil, err
+	}
+	lc := &liveConfig{file: config.File(), startup: entryValues()}
+	lc.stamp = fileStamp(lc.file)
+	lc.current.Store(&tunables{
+		generation:     1,
+		loadedAt:       time.Now(),
+		trigger:        "startup",
+		logLevel:       cfg.LogLevel,
+		infoMessage:    cfg.InfoMessage,
+		infoFields:     cfg.InfoFields,
+		templates:      templates,
+		requestTimeout: cfg.RequestTimeout,
+		redactPatterns: cfg.RedactPatterns,
+		rateLimits:     rateLimits(cfg),
+		chaos:          chaosFromConfig(cfg),
+	})
+	return lc, nil
+}
+
+// subscribe registers fn to be called after every reload that changes the
+// settings.
+func (lc *liveConfig) subscribe(fn func(generation int64, trigger string)) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	lc.onApply = append(lc.onApply, fn)
+}
+
+// get returns the settings in effect.
+func (lc *liveConfig) get() *tunables {
+	return lc.current.Load()
+}
+
+// defaultTimeout is the timeout of routes that don't set their own.
+func (s *Server) defaultTimeout() time.Duration {
+	return s.live.get().requestTimeout
+}
+
+// entryValues snapshots the loaded configuration by key.
+func entryValues() map[string]string {
+	values := make(map[string]string)
+	for _, e := range config.Entries() {
+		values[e.Key] = e.Value
+	}
+	return values
+}
+
+// fileStamp changes whenever the file is replaced, including through the
+// ..data symlink the kubelet swaps; it is empty without a file.
+func fileStamp(name string) string {
+	if name == "" {
+		return ""
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// reload loads the configuration again and applies its tunable settings. A
+// configuration that fails to load, has an invalid log level or templates
+// that don't parse is rejected whole; other values that don't parse fall
+// back to their defaults, as they do at startup.
+func (lc *liveConfig) reload(trigger string) error {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	fail := func(err error) error {
+		lc.lastError, lc.lastErrorAt = err.Error(), time.Now()
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fail(err)
+	}
+	templates, err := parseInfoTemplates(cfg.InfoMessage, cfg.InfoFields)
+	if err != nil {
+		return fail(err)
+	}
+	if err := lc.applyLogLevel(cfg.LogLevel); err != nil {
+		return fail(err)
+	}
+	lc.lastError, lc.lastErrorAt = "", time.Time{}
+
+	lc.restart = nil
+	for key, value := range entryValues() {
+		if !tunableKeys[key] && lc.startup[key] != value {
+			lc.restart = append(lc.restart, key)
+		}
+	}
+	sort.Strings(lc.restart)
+	if len(lc.restart) > 0 {
+		log.Printf("Warning: changed settings need a restart to apply: %v", lc.restart)
+	}
+
+	prev := lc.get()
+	next := &tunables{
+		generation:     prev.generation,
+		loadedAt:       prev.loadedAt,
+		trigger:        prev.trigger,
+		logLevel:       cfg.LogLevel,
+		infoMessage:    cfg.InfoMessage,
+		infoFields:     cfg.InfoFields,
+		templates:      templates,
+		requestTimeout: cfg.RequestTimeout,
+		redactPatterns: cfg.RedactPatterns,
+		rateLimits:     rateLimits(cfg),
+		chaos:          chaosFromConfig(cfg),
+	}
+	if next.logLevel == prev.logLevel && next.infoMessage == prev.infoMessage && slices.Equal(next.infoFields, prev.infoFields) &&
+		next.requestTimeout == prev.requestTimeout && slices.Equal(next.redactPatterns, prev.redactPatterns) &&
+		next.rateLimits == prev.rateLimits && next.chaos == prev.chaos {
+		return nil
+	}
+	next.generation++
+	next.loadedAt, next.trigger = time.Now(), trigger
+	lc.current.Store(next)
+	log.Printf("Configuration generation %d applied (%s): log level %s, request timeout %s",
+		next.generation, trigger, next.logLevel, next.requestTimeout)
+	for _, fn := range lc.onApply {
+		fn(next.generation, trigger)
+	}
+	return nil
+}
+
+// run reloads on SIGHUP and when the config file changes, until ctx ends.
+func (lc *liveConfig) run(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(configFilePollInterval)
+	defer ticker.Stop()
+	for {
+		trigger := ""
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			trigger = "signal"
+		case <-ticker.C:
+			lc.mu.Lock()
+			stamp := fileStamp(lc.file)
+			changed := stamp != lc.stamp
+			lc.stamp = stamp
+			lc.mu.Unlock()
+			if !changed {
+				continue
+			}
+			trigger = "file"
+		}
+		if err := lc.reload(trigger); err != nil {
+			log.Printf("Error reloading configuration, keeping generation %d: %v", lc.get().generation, err)
+		}
+	}
+}
+
+func (lc *liveConfig) handler(w http.ResponseWriter, _ *http.Request) {
+	t := lc.get()
+	lc.mu.Lock()
+	resp := LiveConfigResponse{
+		Generation:            t.generation,
+		LoadedAt:              t.loadedAt.UTC().Format(time.RFC3339),
+		Trigger:               t.trigger,
+		File:                  lc.file,
+		LogLevel:              t.logLevel,
+		InfoMessage:           t.infoMessage,
+		InfoFields:            t.infoFields,
+		RequestTimeoutSeconds: t.requestTimeout.Seconds(),
+		RedactPatterns:        t.redactPatterns,
+		RestartRequired:       append([]string{}, lc.restart...),
+		LastError:             lc.lastError,
+
+		RateLimitRPS:            t.rateLimits.RPS,
+		RateLimitBurst:          t.rateLimits.Burst,
+		RateLimitPerClientRPS:   t.rateLimits.ClientRPS,
+		RateLimitPerClientBurst: t.rateLimits.ClientBurst,
+
+		ChaosLatencyMs:      t.chaos.latency.Milliseconds(),
+		ChaosLatencyPercent: t.chaos.latencyPercent,
+		ChaosErrorPercent:   t.chaos.errorPercent,
+	}
+	if !lc.lastErrorAt.IsZero() {
+		resp.LastErrorAt = lc.lastErrorAt.UTC().Format(time.RFC3339)
+	}
+	lc.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding config response: %v", err)
+	}
+}
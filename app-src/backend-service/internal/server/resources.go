@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cgroupRoot        = "/sys/fs/cgroup"
+	cpuSampleInterval = 5 * time.Second
+)
+
+type CPUResources struct {
+	RequestMillicores  int64    `json:"request_millicores,omitempty"`
+	LimitMillicores    int64    `json:"limit_millicores,omitempty"`
+	UsageMillicores    float64  `json:"usage_millicores"`
+	RequestUtilization *float64 `json:"request_utilization,omitempty"`
+	LimitUtilization   *float64 `json:"limit_utilization,omitempty"`
+	ThrottledPeriods   int64    `json:"throttled_periods"`
+}
+
+type MemoryResources struct {
+	RequestBytes       int64    `json:"request_bytes,omitempty"`
+	LimitBytes         int64    `json:"limit_bytes,omitempty"`
+	UsageBytes         int64    `json:"usage_bytes"`
+	RequestUtilization *float64 `json:"request_utilization,omitempty"`
+	LimitUtilization   *float64 `json:"limit_utilization,omitempty"`
+}
+
+type RuntimeResources struct {
+	Goroutines     int    `json:"goroutines"`
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	GOMAXPROCS     int    `json:"gomaxprocs"`
+}
+
+type ResourcesResponse struct {
+	CgroupVersion int              `json:"cgroup_version"`
+	CPU           CPUResources     `json:"cpu"`
+	Memory        MemoryResources  `json:"memory"`
+	Runtime       RuntimeResources `json:"runtime"`
+	SampledAt     string           `json:"sampled_at,omitempty"`
+}
+
+// resourceMonitor compares the pod's declared requests/limits (injected via
+// downward-API resourceFieldRef env vars) with live cgroup usage, which makes
+// right-sizing and HPA behaviour visible from the app itself.
+type resourceMonitor struct {
+	cgroupVersion int
+
+	cpuRequest, cpuLimit int64
+	memRequest, memLimit int64
+
+	mu          sync.RWMutex
+	lastUsage   time.Duration
+	lastSample  time.Time
+	cpuRate     float64
+	sampledAt   time.Time
+	initialized bool
+}
+
+func newResourceMonitor(cpuRequest, cpuLimit, memRequest, memLimit int64) *resourceMonitor {
+	rm := &resourceMonitor{
+		cpuRequest: cpuRequest,
+		cpuLimit:   cpuLimit,
+		memRequest: memRequest,
+		memLimit:   memLimit,
+	}
+	switch {
+	case fileExists(filepath.Join(cgroupRoot, "cgroup.controllers")):
+		rm.cgroupVersion = 2
+	case fileExists(filepath.Join(cgroupRoot, "memory")):
+		rm.cgroupVersion = 1
+	}
+	return rm
+}
+
+// run samples cumulative CPU time periodically to derive a usage rate.
+func (rm *resourceMonitor) run(ctx context.Context) {
+	if rm.cgroupVersion == 0 {
+		log.Println("No cgroup filesystem found, live resource usage unavailable")
+		return
+	}
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+	for {
+		rm.sampleCPU()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (rm *resourceMonitor) sampleCPU() {
+	usage, ok := rm.cpuUsage()
+	if !ok {
+		return
+	}
+	now := time.Now()
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if rm.initialized {
+		elapsed := now.Sub(rm.lastSample)
+		if elapsed > 0 {
+			rm.cpuRate = float64(usage-rm.lastUsage) / float64(elapsed) * 1000
+			rm.sampledAt = now
+		}
+	}
+	rm.lastUsage, rm.lastSample, rm.initialized = usage, now, true
+}
+
+// cpuUsage returns the cumulative CPU time consumed by the container.
+func (rm *resourceMonitor) cpuUsage() (time.Duration, bool) {
+	if rm.cgroupVersion == 2 {
+		stats := readKeyValues(filepath.Join(cgroupRoot, "cpu.stat"))
+		usec, ok := stats["usage_usec"]
+		return time.Duration(usec) * time.Microsecond, ok
+	}
+	nsec, ok := readInt64(filepath.Join(cgroupRoot, "cpuacct", "cpuacct.usage"))
+	return time.Duration(nsec), ok
+}
+
+func (rm *resourceMonitor) throttledPeriods() int64 {
+	if rm.cgroupVersion == 2 {
+		return readKeyValues(filepath.Join(cgroupRoot, "cpu.stat"))["nr_throttled"]
+	}
+	return readKeyValues(filepath.Join(cgroupRoot, "cpu", "cpu.stat"))["nr_throttled"]
+}
+
+func (rm *resourceMonitor) memoryUsage() int64 {
+	if rm.cgroupVersion == 2 {
+		usage, _ := readInt64(filepath.Join(cgroupRoot, "memory.current"))
+		return usage
+	}
+	usage, _ := readInt64(filepath.Join(cgroupRoot, "memory", "memory.usage_in_bytes"))
+	return usage
+}
+
+func (rm *resourceMonitor) snapshot() ResourcesResponse {
+	rm.mu.RLock()
+	cpuRate, sampledAt := rm.cpuRate, rm.sampledAt
+	rm.mu.RUnlock()
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	resp := ResourcesResponse{
+		CgroupVersion: rm.cgroupVersion,
+		CPU: CPUResources{
+			RequestMillicores: rm.cpuRequest,
+			LimitMillicores:   rm.cpuLimit,
+			UsageMillicores:   math.Round(cpuRate*10) / 10,
+		},
+		Memory: MemoryResources{
+			RequestBytes: rm.memRequest,
+			LimitBytes:   rm.memLimit,
+		},
+		Runtime: RuntimeResources{
+			Goroutines:     runtime.NumGoroutine(),
+			HeapAllocBytes: mem.HeapAlloc,
+			SysBytes:       mem.Sys,
+			GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		},
+	}
+	if rm.cgroupVersion != 0 {
+		resp.CPU.ThrottledPeriods = rm.throttledPeriods()
+		resp.Memory.UsageBytes = rm.memoryUsage()
+	}
+	if !sampledAt.IsZero() {
+		resp.SampledAt = sampledAt.UTC().Format(time.RFC3339)
+	}
+
+	resp.CPU.RequestUtilization = ratio(resp.CPU.UsageMillicores, float64(rm.cpuRequest))
+	resp.CPU.LimitUtilization = ratio(resp.CPU.UsageMillicores, float64(rm.cpuLimit))
+	resp.Memory.RequestUtilization = ratio(float64(resp.Memory.UsageBytes), float64(rm.memRequest))
+	resp.Memory.LimitUtilization = ratio(float64(resp.Memory.UsageBytes), float64(rm.memLimit))
+	return resp
+}
+
+func (rm *resourceMonitor) handler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(rm.snapshot()); err != nil {
+		log.Printf("Error encoding resources response: %v", err)
+	}
+}
+
+func ratio(value, of float64) *float64 {
+	if of <= 0 {
+		return nil
+	}
+	r := math.Round(value/of*1000) / 1000
+	return &r
+}
+
+func readInt64(path string) (int64, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return v, err == nil
+}
+
+// readKeyValues parses flat-keyed cgroup files such as cpu.stat.
+func readKeyValues(path string) map[string]int64 {
+	values := make(map[string]int64)
+	f, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+const revisionAnnotation = "deployment.kubernetes.io/revision"
+
+type deployment struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int32 `json:"replicas"`
+		Selector struct {
+			MatchLabels map[string]string `json:"matchLabels"`
+		} `json:"selector"`
+	} `json:"spec"`
+	Status struct {
+		ObservedGeneration  int64                 `json:"observedGeneration"`
+		Replicas            int32                 `json:"replicas"`
+		UpdatedReplicas     int32                 `json:"updatedReplicas"`
+		ReadyReplicas       int32                 `json:"readyReplicas"`
+		AvailableReplicas   int32                 `json:"availableReplicas"`
+		UnavailableReplicas int32                 `json:"unavailableReplicas"`
+		Conditions          []DeploymentCondition `json:"conditions"`
+	} `json:"status"`
+}
+
+type replicaSet struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+	Spec     struct {
+		Replicas *int32 `json:"replicas"`
+	} `json:"spec"`
+	Status struct {
+		Replicas          int32 `json:"replicas"`
+		ReadyReplicas     int32 `json:"readyReplicas"`
+		AvailableReplicas int32 `json:"availableReplicas"`
+	} `json:"status"`
+}
+
+type pod struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+}
+
+type DeploymentCondition struct {
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	Reason         string `json:"reason,omitempty"`
+	Message        string `json:"message,omitempty"`
+	LastUpdateTime string `json:"lastUpdateTime,omitempty"`
+}
+
+type ReplicaSetStatus struct {
+	Name      string `json:"name"`
+	Revision  string `json:"revision"`
+	Desired   int32  `json:"desired"`
+	Current   int32  `json:"current"`
+	Ready     int32  `json:"ready"`
+	Available int32  `json:"available"`
+	ServingMe bool   `json:"serving_this_pod"`
+}
+
+type DeploymentStatusResponse struct {
+	Enabled             bool                  `json:"enabled"`
+	Synced              bool                  `json:"synced"`
+	Name                string                `json:"name,omitempty"`
+	Namespace           string                `json:"namespace,omitempty"`
+	Generation          int64                 `json:"generation,omitempty"`
+	ObservedGeneration  int64                 `json:"observed_generation,omitempty"`
+	DesiredReplicas     int32                 `json:"desired_replicas"`
+	UpdatedReplicas     int32                 `json:"updated_replicas"`
+	ReadyReplicas       int32                 `json:"ready_replicas"`
+	AvailableReplicas   int32                 `json:"available_replicas"`
+	UnavailableReplicas int32                 `json:"unavailable_replicas"`
+	RolloutComplete     bool                  `json:"rollout_complete"`
+	Conditions          []DeploymentCondition `json:"conditions,omitempty"`
+	ReplicaSets         []ReplicaSetStatus    `json:"replica_sets,omitempty"`
+	LastUpdated         string                `json:"last_updated,omitempty"`
+}
+
+// deploymentWatcher keeps a live view of the Deployment that owns this pod
+// and its ReplicaSets, so a GitOps sync can be followed from inside the app.
+type deploymentWatcher struct {
+	enabled   bool
+	client    *k8sclient.Client
+	namespace string
+	podName   string
+	name      string
+
+	mu          sync.RWMutex
+	synced      bool
+	deployment  deployment
+	replicaSets map[string]replicaSet
+	podRS       string
+	lastUpdated time.Time
+}
+
+func newDeploymentWatcher(enabled bool, client *k8sclient.Client, namespace, podName, name string) *deploymentWatcher {
+	return &deploymentWatcher{
+		enabled:     enabled,
+		client:      client,
+		namespace:   namespace,
+		podName:     podName,
+		name:        name,
+		replicaSets: make(map[string]replicaSet),
+	}
+}
+
+// run resolves the owning Deployment and keeps informers on it and its
+// ReplicaSets until ctx is cancelled.
+func (dw *deploymentWatcher) run(ctx context.Context) {
+	if !dw.enabled {
+		return
+	}
+
+	var selector map[string]string
+	for {
+		d, err := dw.resolve(ctx)
+		if err == nil {
+			dw.name, selector = d.Metadata.Name, d.Spec.Selector.MatchLabels
+			break
+		}
+		log.Printf("Error resolving owning deployment: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+		}
+	}
+	log.Printf("Watching deployment %s/%s", dw.namespace, dw.name)
+
+	go dw.client.ListWatch(ctx,
+		fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets", dw.namespace),
+		url.Values{"labelSelector": {labelSelector(selector)}},
+		dw.syncReplicaSets, dw.onReplicaSetEvent)
+
+	dw.client.ListWatch(ctx,
+		fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments", dw.namespace),
+		url.Values{"fieldSelector": {"metadata.name=" + dw.name}},
+		dw.syncDeployments, dw.onDeploymentEvent)
+}
+
+// resolve finds the Deployment either by the configured name or by walking
+// the pod's ownerReferences (Pod -> ReplicaSet -> Deployment).
+func (dw *deploymentWatcher) resolve(ctx context.Context) (deployment, error) {
+	var d deployment
+	name := dw.name
+	if dw.podName != "" {
+		var p pod
+		if err := podInformer(dw.client, dw.namespace, dw.podName).GetOrFetch(ctx, dw.podName, &p); err != nil {
+			return d, fmt.Errorf("getting pod %s: %w", dw.podName, err)
+		}
+		if owner, ok := p.Metadata.ControllerOf(); ok && owner.Kind == "ReplicaSet" {
+			dw.mu.Lock()
+			dw.podRS = owner.Name
+			dw.mu.Unlock()
+			if name == "" {
+				var rs replicaSet
+				if err := dw.client.Do(ctx, http.MethodGet,
+					fmt.Sprintf("/apis/apps/v1/namespaces/%s/replicasets/%s", dw.namespace, owner.Name), nil, &rs); err != nil {
+					return d, fmt.Errorf("getting replicaset %s: %w", owner.Name, err)
+				}
+				if rsOwner, ok := rs.Metadata.ControllerOf(); ok && rsOwner.Kind == "Deployment" {
+					name = rsOwner.Name
+				}
+			}
+		}
+	}
+	if name == "" {
+		return d, errors.New("pod is not owned by a Deployment; set DEPLOYMENT_NAME")
+	}
+
+	err := dw.client.Do(ctx, http.MethodGet,
+		fmt.Sprintf("/apis/apps/v1/namespaces/%s/deployments/%s", dw.namespace, name), nil, &d)
+	return d, err
+}
+
+func (dw *deploymentWatcher) syncDeployments(items []json.RawMessage) {
+	for _, raw := range items {
+		dw.onDeploymentEvent(k8sclient.WatchEvent{Type: "ADDED", Object: raw})
+	}
+}
+
+func (dw *deploymentWatcher) onDeploymentEvent(event k8sclient.WatchEvent) {
+	var d deployment
+	if err := json.Unmarshal(event.Object, &d); err != nil {
+		log.Printf("Error decoding deployment event: %v", err)
+		return
+	}
+
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if event.Type == "DELETED" {
+		dw.synced = false
+		return
+	}
+	dw.deployment = d
+	dw.synced = true
+	dw.lastUpdated = time.Now()
+}
+
+func (dw *deploymentWatcher) syncReplicaSets(items []json.RawMessage) {
+	dw.mu.Lock()
+	dw.replicaSets = make(map[string]replicaSet, len(items))
+	dw.mu.Unlock()
+	for _, raw := range items {
+		dw.onReplicaSetEvent(k8sclient.WatchEvent{Type: "ADDED", Object: raw})
+	}
+}
+
+func (dw *deploymentWatcher) onReplicaSetEvent(event k8sclient.WatchEvent) {
+	var rs replicaSet
+	if err := json.Unmarshal(event.Object, &rs); err != nil {
+		log.Printf("Error decoding replicaset event: %v", err)
+		return
+	}
+	if owner, ok := rs.Metadata.ControllerOf(); !ok || owner.Kind != "Deployment" || owner.Name != dw.name {
+		return
+	}
+
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if event.Type == "DELETED" {
+		delete(dw.replicaSets, rs.Metadata.Name)
+	} else {
+		dw.replicaSets[rs.Metadata.Name] = rs
+	}
+	dw.lastUpdated = time.Now()
+}
+
+func (dw *deploymentWatcher) status() DeploymentStatusResponse {
+	dw.mu.RLock()
+	defer dw.mu.RUnlock()
+
+	resp := DeploymentStatusResponse{Enabled: dw.enabled, Synced: dw.synced}
+	if !dw.synced {
+		return resp
+	}
+
+	d := dw.deployment
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+	resp.Name = d.Metadata.Name
+	resp.Namespace = d.Metadata.Namespace
+	resp.Generation = d.Metadata.Generation
+	resp.ObservedGeneration = d.Status.ObservedGeneration
+	resp.DesiredReplicas = desired
+	resp.UpdatedReplicas = d.Status.UpdatedReplicas
+	resp.ReadyReplicas = d.Status.ReadyReplicas
+	resp.AvailableReplicas = d.Status.AvailableReplicas
+	resp.UnavailableReplicas = d.Status.UnavailableReplicas
+	resp.Conditions = d.Status.Conditions
+	resp.LastUpdated = dw.lastUpdated.UTC().Format(time.RFC3339)
+	// Same completion criteria as `kubectl rollout status`.
+	resp.RolloutComplete = d.Status.ObservedGeneration >= d.Metadata.Generation &&
+		d.Status.UpdatedReplicas == desired &&
+		d.Status.Replicas == desired &&
+		d.Status.AvailableReplicas == desired
+
+	for name, rs := range dw.replicaSets {
+		var rsDesired int32
+		if rs.Spec.Replicas != nil {
+			rsDesired = *rs.Spec.Replicas
+		}
+		resp.ReplicaSets = append(resp.ReplicaSets, ReplicaSetStatus{
+			Name:      name,
+			Revision:  rs.Metadata.Annotations[revisionAnnotation],
+			Desired:   rsDesired,
+			Current:   rs.Status.Replicas,
+			Ready:     rs.Status.ReadyReplicas,
+			Available: rs.Status.AvailableReplicas,
+			ServingMe: name == dw.podRS,
+		})
+	}
+	// Newest revision first.
+	sort.Slice(resp.ReplicaSets, func(i, j int) bool {
+		ri, _ := strconv.Atoi(resp.ReplicaSets[i].Revision)
+		rj, _ := strconv.Atoi(resp.ReplicaSets[j].Revision)
+		return ri > rj
+	})
+	return resp
+}
+
+func (dw *deploymentWatcher) handler(w http.ResponseWriter, _ *http.Request) {
+	resp := dw.status()
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Enabled && !resp.Synced {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding deployment response: %v", err)
+	}
+}
+
+// labelSelector renders matchLabels in the API's labelSelector query syntax.
+func labelSelector(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
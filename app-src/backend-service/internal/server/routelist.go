@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+type RouteInfo struct {
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+	Pattern string   `json:"pattern"`
+	Group   string   `json:"group"`
+	Auth    bool     `json:"auth"`
+	// TimeoutSeconds is 0 for routes without a timeout.
+	TimeoutSeconds float64  `json:"timeout_seconds"`
+	Middleware     []string `json:"middleware"`
+	Description    string   `json:"description"`
+	Deprecated     bool     `json:"deprecated,omitempty"`
+}
+
+type RoutesResponse struct {
+	Routes []RouteInfo `json:"routes"`
+}
+
+// routesHandler serves /admin/routes, the route registry as the router sees
+// it, so the API surface and what guards each route can be reviewed without
+// reading the code. Routes without a timeout of their own list
+// defaultTimeout.
+func routesHandler(rt *router.Router, chains map[string]groupChain, defaultTimeout func() time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		routes := rt.Routes()
+		resp := RoutesResponse{Routes: make([]RouteInfo, 0, len(routes))}
+		for _, route := range routes {
+			methods := route.Methods
+			if len(methods) == 0 {
+				methods = []string{"*"}
+			}
+			middleware := chains[route.Group].names
+			if middleware == nil {
+				middleware = []string{}
+			}
+			info := RouteInfo{
+				Name:        route.Name,
+				Methods:     methods,
+				Pattern:     route.Pattern,
+				Group:       route.Group,
+				Auth:        route.Auth,
+				Middleware:  middleware,
+				Description: route.Description,
+				Deprecated:  route.Deprecated,
+			}
+			if timeout := routeTimeout(route, defaultTimeout); timeout > 0 {
+				info.TimeoutSeconds = timeout.Seconds()
+			}
+			resp.Routes = append(resp.Routes, info)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding routes response: %v", err)
+		}
+	}
+}
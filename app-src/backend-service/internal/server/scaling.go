@@ -0,0 +1,89 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxRateWindow bounds the sliding window used for requests-per-second.
+const maxRateWindow = 60
+
+type ScalingMetricsResponse struct {
+	InFlightRequests  int64   `json:"in_flight_requests"`
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	QueueDepth        int64   `json:"queue_depth"`
+	WindowSeconds     int     `json:"window_seconds"`
+	Region            string  `json:"region,omitempty"`
+	Zone              string  `json:"zone,omitempty"`
+	Timestamp         string  `json:"timestamp"`
+}
+
+// rateCounter counts requests in one-second buckets over a sliding window.
+type rateCounter struct {
+	mu      sync.Mutex
+	counts  [maxRateWindow]int64
+	seconds [maxRateWindow]int64
+}
+
+func (rc *rateCounter) inc(now time.Time) {
+	sec := now.Unix()
+	i := sec % maxRateWindow
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.seconds[i] != sec {
+		rc.seconds[i], rc.counts[i] = sec, 0
+	}
+	rc.counts[i]++
+}
+
+// rate returns the average requests per second over the last window seconds,
+// excluding the current, still incomplete, second.
+func (rc *rateCounter) rate(now time.Time, window int) float64 {
+	if window <= 0 || window > maxRateWindow-1 {
+		window = maxRateWindow - 1
+	}
+	current := now.Unix()
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	var total int64
+	for i := range rc.seconds {
+		if age := current - rc.seconds[i]; age >= 1 && age <= int64(window) {
+			total += rc.counts[i]
+		}
+	}
+	return float64(total) / float64(window)
+}
+
+// scalingMetricsHandler exposes application-level autoscaling signals as flat
+// JSON, which KEDA's metrics-api scaler (valueLocation) and custom-metrics
+// adapters can consume directly.
+func (s *Server) scalingMetricsHandler() http.HandlerFunc {
+	window := s.cfg.ScalingRPSWindow
+	if window <= 0 || window > maxRateWindow-1 {
+		window = maxRateWindow - 1
+	}
+	return func(w http.ResponseWriter, _ *http.Request) {
+		now := time.Now()
+		region, zone := s.topology.get()
+		resp := ScalingMetricsResponse{
+			// Exclude this request itself.
+			InFlightRequests:  s.inFlight.Load() - 1,
+			RequestsPerSecond: math.Round(s.rates.rate(now, window)*100) / 100,
+			QueueDepth:        s.jobs.depth(),
+			WindowSeconds:     window,
+			Region:            region,
+			Zone:              zone,
+			Timestamp:         now.UTC().Format(time.RFC3339),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding scaling metrics response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/schema"
+)
+
+// responseSchema documents the JSON body of one or more endpoints.
+type responseSchema struct {
+	name      string
+	endpoints []string
+	value     any
+}
+
+// responseSchemas lists every JSON response type the API returns. Add new
+// response types here so /api/schemas and the contract tests cover them.
+var responseSchemas = []responseSchema{
+	{"HealthResponse", []string{"/health", "/healthz", "/startupz"}, handlers.HealthResponse{}},
+	{"ReadinessResponse", []string{"/ready", "/readyz"}, ReadinessResponse{}},
+	{"VersionResponse", []string{"/version"}, handlers.VersionResponse{}},
+	{"InfoResponse", []string{"/", "/api/v1/info"}, handlers.InfoResponse{}},
+	{"InfoResponseV2", []string{"/ (API version 2)", "/api/v1/info (API version 2)"}, handlers.InfoResponseV2{}},
+	{"LiveConfigResponse", []string{"/api/v1/config"}, LiveConfigResponse{}},
+	{"FlagsResponse", []string{"/api/v1/flags"}, FlagsResponse{}},
+	{"ClaimsResponse", []string{"/api/v1/me"}, ClaimsResponse{}},
+	{"EchoResponse", []string{"/api/v1/echo", "/api/v1/echo/{path...}"}, handlers.EchoResponse{}},
+	{"DelayResponse", []string{"/api/v1/delay/{duration}"}, handlers.DelayResponse{}},
+	{"StatusCodeResponse", []string{"/api/v1/status/{code}"}, handlers.StatusCodeResponse{}},
+	{"LeaderResponse", []string{"/api/v1/leader"}, LeaderResponse{}},
+	{"DeploymentStatusResponse", []string{"/api/v1/deployment"}, DeploymentStatusResponse{}},
+	{"DependenciesResponse", []string{"/api/v1/dependencies"}, DependenciesResponse{}},
+	{"ResourcesResponse", []string{"/api/v1/resources"}, ResourcesResponse{}},
+	{"DisruptionsResponse", []string{"/api/v1/disruptions"}, DisruptionsResponse{}},
+	{"DriftResponse", []string{"/api/v1/drift"}, DriftResponse{}},
+	{"GitOpsStatusResponse", []string{"/api/v1/gitops/status"}, GitOpsStatusResponse{}},
+	{"DeploymentsResponse", []string{"/api/v1/deployments"}, DeploymentsResponse{}},
+	{"DeploymentEvent", []string{"/webhooks/gitops"}, DeploymentEvent{}},
+	{"GitCommitsResponse", []string{"/api/v1/git/commits"}, GitCommitsResponse{}},
+	{"PeersResponse", []string{"/api/v1/peers"}, PeersResponse{}},
+	{"GitOpsDriftResponse", []string{"/api/v1/gitops/drift"}, GitOpsDriftResponse{}},
+	{"PromoteResponse", []string{"/api/v1/gitops/promote"}, PromoteResponse{}},
+	{"GitEvent", []string{"/webhooks/git"}, GitEvent{}},
+	{"KubernetesClientResponse", []string{"/api/v1/kubernetes"}, KubernetesClientResponse{}},
+	{"ReposResponse", []string{"/api/v1/repos"}, ReposResponse{}},
+	{"ScalingMetricsResponse", []string{"/api/v1/metrics/scaling"}, ScalingMetricsResponse{}},
+	{"QueueMetricsResponse", []string{"/api/v1/metrics/queue"}, QueueMetricsResponse{}},
+	{"StatsFrame", []string{"/ws/stats", "/ws/stats (each WebSocket message)"}, StatsFrame{}},
+	{"LifecycleEventsResponse", []string{"/events", "/events (data of each event is one of its events)"}, LifecycleEventsResponse{}},
+	{"EnqueueJobsResponse", []string{"/api/v1/jobs"}, EnqueueJobsResponse{}},
+	{"TaskResponse", []string{"/api/v1/tasks", "/api/v1/tasks/{id}", "/api/v1/tasks/{id}/events (data of each event)"}, TaskResponse{}},
+	{"UploadResponse", []string{"/api/v1/upload"}, UploadResponse{}},
+	{"LoadResponse", []string{"/api/v1/load/cpu", "/api/v1/load/memory"}, LoadResponse{}},
+	{"LoadStatusResponse", []string{"/api/v1/load"}, LoadStatusResponse{}},
+	{"APIVersionsResponse", []string{"/api"}, APIVersionsResponse{}},
+	{"SchemaIndexResponse", []string{"/api/v1/schemas"}, SchemaIndexResponse{}},
+	{"ConfigResponse", []string{"/admin/config"}, handlers.ConfigResponse{}},
+	{"EnvResponse", []string{"/admin/env"}, handlers.EnvResponse{}},
+	{"PrestopResponse", []string{"/admin/prestop"}, PrestopResponse{}},
+	{"DrainResponse", []string{"/admin/drain", "/admin/undrain"}, DrainResponse{}},
+	{"ChaosResponse", []string{"/admin/chaos"}, ChaosResponse{}},
+	{"LogLevelResponse", []string{"/admin/loglevel"}, LogLevelResponse{}},
+	{"CallResponse", []string{"/api/v1/call"}, CallResponse{}},
+	{"ChainResponse", []string{"/api/v1/chain"}, ChainResponse{}},
+	{"ItemsResponse", []string{"/api/v1/items"}, ItemsResponse{}},
+	{"ItemResponse", []string{"/api/v1/items", "/api/v1/items/{id}"}, ItemResponse{}},
+	{"RoutesResponse", []string{"/admin/routes"}, RoutesResponse{}},
+	{"SelftestResponse", []string{"/admin/selftest"}, SelftestResponse{}},
+	{"RecordingsResponse", []string{"/admin/recordings"}, RecordingsResponse{}},
+	{"AuditResponse", []string{"/admin/audit"}, AuditResponse{}},
+	{"Problem", []string{"every error response (application/problem+json)"}, problem.Problem{}},
+}
+
+type SchemaInfo struct {
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Endpoints []string `json:"endpoints"`
+}
+
+type SchemaIndexResponse struct {
+	Dialect string       `json:"dialect"`
+	Schemas []SchemaInfo `json:"schemas"`
+}
+
+// responseSchemaDocument returns the standalone schema document of a
+// response type, or nil if there is no such type.
+func responseSchemaDocument(name string) *schema.Schema {
+	for _, rs := range responseSchemas {
+		if rs.name != name {
+			continue
+		}
+		doc := schema.For(rs.value)
+		doc.Dialect = schema.Dialect
+		doc.ID = "/api/v1/schemas/" + rs.name
+		doc.Title = rs.name
+		doc.Description = "Response body of " + strings.Join(rs.endpoints, ", ")
+		return doc
+	}
+	return nil
+}
+
+// schemaIndexHandler serves /api/schemas, the index of response schemas, so
+// consumers can contract-test against the backend.
+func schemaIndexHandler(w http.ResponseWriter, _ *http.Request) {
+	resp := SchemaIndexResponse{Dialect: schema.Dialect, Schemas: make([]SchemaInfo, 0, len(responseSchemas))}
+	for _, rs := range responseSchemas {
+		resp.Schemas = append(resp.Schemas, SchemaInfo{
+			Name:      rs.name,
+			URL:       "/api/v1/schemas/" + rs.name,
+			Endpoints: rs.endpoints,
+		})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding schema index response: %v", err)
+	}
+}
+
+// schemaHandler serves /api/schemas/{name}, a single schema.
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	name := router.Param(r, "name")
+	doc := responseSchemaDocument(name)
+	if doc == nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.unknown_schema", name), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	if err := json.NewEncoder(w).Encode(doc); err != nil {
+		log.Printf("Error encoding schema response: %v", err)
+	}
+}
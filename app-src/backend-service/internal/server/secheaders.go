@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+)
+
+// securityHeaders are the headers the "headers" middleware sets on every
+// response, with the values of the environment's configuration, and
+// X-Track naming the rollout track that served it. Handlers may replace
+// them: /docs widens the Content-Security-Policy to load Swagger UI from
+// its CDN.
+type securityHeaders [][2]string
+
+func newSecurityHeaders(cfg config.Config, track string) securityHeaders {
+	var h securityHeaders
+	for _, header := range [][2]string{
+		{"Strict-Transport-Security", cfg.HSTS},
+		{"X-Content-Type-Options", cfg.ContentTypeOptions},
+		{"X-Frame-Options", cfg.FrameOptions},
+		{"Referrer-Policy", cfg.ReferrerPolicy},
+		{"Content-Security-Policy", cfg.ContentSecurityPolicy},
+		{"X-Track", track},
+	} {
+		if header[1] != "" {
+			h = append(h, header)
+		}
+	}
+	return h
+}
+
+// middleware sets the headers before the handler runs, so error responses
+// of the middleware inside it carry them too. Browsers ignore
+// Strict-Transport-Security on plain HTTP, so it's safe to send behind an
+// ingress terminating TLS.
+func (h securityHeaders) middleware(next http.Handler) http.Handler {
+	if len(h) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := w.Header()
+		for _, kv := range h {
+			header.Set(kv[0], kv[1])
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,322 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/logging"
+)
+
+// Self-test check outcomes. Skipped checks don't fail the report.
+const (
+	checkPass = "pass"
+	checkFail = "fail"
+	checkSkip = "skip"
+)
+
+// selftestDialTimeout bounds each dependency dial and the NTP query.
+const selftestDialTimeout = 2 * time.Second
+
+type SelftestCheck struct {
+	Name       string  `json:"name"`
+	Status     string  `json:"status"`
+	Message    string  `json:"message,omitempty"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+type SelftestResponse struct {
+	Status    string          `json:"status"`
+	Checks    []SelftestCheck `json:"checks"`
+	Timestamp string          `json:"timestamp"`
+}
+
+// selftest runs diagnostics on demand that the probes can't afford to run
+// continuously. It answers 503 when a check fails, so an ArgoCD PostSync
+// hook can fail the sync of a release that deployed but doesn't work.
+type selftest struct {
+	cfg       config.Config
+	discovery *serviceDiscovery
+}
+
+// check is one named diagnostic returning its status and a message.
+type check struct {
+	name string
+	run  func(context.Context) (string, string)
+}
+
+func (st *selftest) handler(w http.ResponseWriter, r *http.Request) {
+	resp := runChecks(r.Context(), []check{
+		{"config", st.checkConfig},
+		{"dependencies", st.checkDependencies},
+		{"clock", st.checkClock},
+		{"temp-dir", checkTempDir},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status == checkFail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding selftest response: %v", err)
+	}
+}
+
+// runChecks runs checks in order; the report fails if any of them does.
+func runChecks(ctx context.Context, checks []check) SelftestResponse {
+	resp := SelftestResponse{Status: checkPass, Checks: make([]SelftestCheck, 0, len(checks))}
+	for _, c := range checks {
+		start := time.Now()
+		status, msg := c.run(ctx)
+		resp.Checks = append(resp.Checks, SelftestCheck{
+			Name:       c.name,
+			Status:     status,
+			Message:    msg,
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		})
+		if status == checkFail {
+			resp.Status = checkFail
+			log.Printf("Self-test %s failed: %s", c.name, msg)
+		}
+	}
+	resp.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	return resp
+}
+
+// checkConfig catches settings that load fine but can't work together.
+func (st *selftest) checkConfig(context.Context) (string, string) {
+	cfg := st.cfg
+	var problems []string
+	if err := cfg.Validate(); err != nil {
+		problems = append(problems, strings.Split(err.Error(), "\n")...)
+	}
+	if port, err := strconv.Atoi(cfg.Port); err != nil || port < 0 || port > 65535 {
+		problems = append(problems, fmt.Sprintf("PORT %q is not a port number", cfg.Port))
+	}
+	if cfg.AdminPort != "" {
+		if port, err := strconv.Atoi(cfg.AdminPort); err != nil || port < 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("ADMIN_PORT %q is not a port number", cfg.AdminPort))
+		} else if cfg.AdminPort == cfg.Port {
+			problems = append(problems, "ADMIN_PORT must differ from PORT")
+		}
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		problems = append(problems, "TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if cfg.TLSPort != "" {
+		if port, err := strconv.Atoi(cfg.TLSPort); err != nil || port < 0 || port > 65535 {
+			problems = append(problems, fmt.Sprintf("TLS_PORT %q is not a port number", cfg.TLSPort))
+		} else if cfg.TLSPort == cfg.Port || cfg.TLSPort == cfg.AdminPort {
+			problems = append(problems, "TLS_PORT must differ from PORT and ADMIN_PORT")
+		} else if !cfg.TLSEnabled() {
+			problems = append(problems, "TLS_PORT is set but TLS_CERT_FILE and TLS_KEY_FILE are not")
+		}
+	}
+	if cfg.JobWorkers < 1 {
+		problems = append(problems, "JOB_WORKERS must be at least 1")
+	}
+	if cfg.JobQueueCapacity < 1 {
+		problems = append(problems, "JOB_QUEUE_CAPACITY must be at least 1")
+	}
+	if cfg.PrestopMinWait > cfg.PrestopTimeout {
+		problems = append(problems, "PRESTOP_MIN_WAIT_SECONDS exceeds PRESTOP_TIMEOUT_SECONDS")
+	}
+	if cfg.EphemeralStorageThresholdPercent < 0 || cfg.EphemeralStorageThresholdPercent > 100 {
+		problems = append(problems, "EPHEMERAL_STORAGE_THRESHOLD_PERCENT must be between 0 and 100")
+	}
+	if _, err := logging.New(io.Discard, cfg.LogFormat, cfg.LogLevel); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if cfg.LeaderElectionEnabled && cfg.PodName == "" {
+		problems = append(problems, "leader election is enabled but POD_NAME is not set")
+	}
+	if cfg.ImageDriftEnabled && cfg.ExpectedImageDigest == "" {
+		problems = append(problems, "image drift is enabled but EXPECTED_IMAGE_DIGEST is not set")
+	}
+	if len(problems) > 0 {
+		return checkFail, strings.Join(problems, "; ")
+	}
+	return checkPass, ""
+}
+
+// checkDependencies dials every sibling Service, sidecar and the service
+// registry, so a NetworkPolicy or DNS mistake shows up right after a sync.
+func (st *selftest) checkDependencies(ctx context.Context) (string, string) {
+	targets := make(map[string]string)
+	for _, dep := range st.discovery.dependencies() {
+		if !dep.Found {
+			return checkFail, fmt.Sprintf("service %s not found in %s", dep.Name, dep.Namespace)
+		}
+		targets["service "+dep.Name] = dep.URL
+	}
+	for _, u := range st.cfg.SidecarReadinessURLs {
+		targets["sidecar "+u] = u
+	}
+	for _, u := range st.cfg.ReadinessDependencyURLs {
+		targets["readiness dependency "+u] = u
+	}
+	if st.cfg.RegistryURL != "" {
+		targets["registry"] = st.cfg.RegistryURL
+	}
+	if len(targets) == 0 {
+		return checkSkip, "no dependencies configured"
+	}
+
+	var failed []string
+	dialer := net.Dialer{Timeout: selftestDialTimeout}
+	for name, raw := range targets {
+		addr, err := dialAddress(raw)
+		if err == nil {
+			var conn net.Conn
+			if conn, err = dialer.DialContext(ctx, "tcp", addr); err == nil {
+				conn.Close()
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	if len(failed) > 0 {
+		return checkFail, strings.Join(failed, "; ")
+	}
+	return checkPass, fmt.Sprintf("%d reachable", len(targets))
+}
+
+// dialAddress returns the host:port of a URL, with the scheme's default
+// port when it has none.
+func dialAddress(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("no host in %q", raw)
+	}
+	if u.Port() != "" {
+		return u.Host, nil
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// checkClock compares the local clock to NTP_SERVER. Skew breaks token
+// expiry, lease renewal and log correlation long before anything else
+// notices it.
+func (st *selftest) checkClock(ctx context.Context) (string, string) {
+	if st.cfg.NTPServer == "" {
+		return checkSkip, "NTP_SERVER not set"
+	}
+	offset, err := ntpOffset(ctx, st.cfg.NTPServer)
+	if err != nil {
+		return checkFail, fmt.Sprintf("querying %s: %v", st.cfg.NTPServer, err)
+	}
+	msg := fmt.Sprintf("offset %s from %s", offset.Round(time.Millisecond), st.cfg.NTPServer)
+	if offset.Abs() > st.cfg.MaxClockSkew {
+		return checkFail, msg + ", more than " + st.cfg.MaxClockSkew.String()
+	}
+	return checkPass, msg
+}
+
+// ntpEpochOffset is the number of seconds from 1900, the NTP epoch, to 1970.
+const ntpEpochOffset = 2208988800
+
+// ntpOffset returns how far the local clock is behind server, an NTP
+// host[:port], with a single SNTP (RFC 4330) exchange.
+func ntpOffset(ctx context.Context, server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	ctx, cancel := context.WithTimeout(ctx, selftestDialTimeout)
+	defer cancel()
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", server)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return 0, err
+	}
+
+	req := make([]byte, 48)
+	req[0] = 0x23 // leap indicator 0, version 4, client mode
+	sent := time.Now()
+	binary.BigEndian.PutUint64(req[40:], toNTPTime(sent))
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return 0, err
+	}
+	if n < 48 {
+		return 0, errors.New("short NTP response")
+	}
+	if resp[0]&0x07 != 4 || resp[1] == 0 {
+		return 0, errors.New("not a valid NTP server response")
+	}
+	// The server echoes our transmit time; a mismatch is a stray packet.
+	if !bytes.Equal(resp[24:32], req[40:48]) {
+		return 0, errors.New("NTP response does not match the request")
+	}
+	serverReceive := fromNTPTime(binary.BigEndian.Uint64(resp[32:]))
+	serverTransmit := fromNTPTime(binary.BigEndian.Uint64(resp[40:]))
+	return (serverReceive.Sub(sent) + serverTransmit.Sub(received)) / 2, nil
+}
+
+func toNTPTime(t time.Time) uint64 {
+	secs := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / 1e9
+	return secs<<32 | frac
+}
+
+func fromNTPTime(v uint64) time.Time {
+	secs := int64(v>>32) - ntpEpochOffset
+	nanos := int64(math.Round(float64(v&0xffffffff) * 1e9 / (1 << 32)))
+	return time.Unix(secs, nanos)
+}
+
+// checkTempDir writes, reads back and removes a file in the temp dir, which
+// is an emptyDir under a read-only root filesystem.
+func checkTempDir(context.Context) (string, string) {
+	f, err := os.CreateTemp("", "selftest-*")
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	defer os.Remove(f.Name())
+	want := []byte("backend-service self-test")
+	_, err = f.Write(want)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	got, err := os.ReadFile(f.Name())
+	if err != nil {
+		return checkFail, err.Error()
+	}
+	if !bytes.Equal(got, want) {
+		return checkFail, "read back different content from " + f.Name()
+	}
+	return checkPass, os.TempDir()
+}
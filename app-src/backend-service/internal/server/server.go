@@ -0,0 +1,918 @@
+// Package server wires the HTTP API to the service's background components:
+// leader election, Kubernetes watchers, readiness gates, job workers and the
+// service registry.
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/artifact"
+	"github.com/anasadan/gitops-demo/backend-service/internal/audit"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/downstream"
+	"github.com/anasadan/gitops-demo/backend-service/internal/eventbus"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+	"github.com/anasadan/gitops-demo/backend-service/internal/postgres"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/ratelimit"
+	"github.com/anasadan/gitops-demo/backend-service/internal/recording"
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/tracing"
+)
+
+// Server is one replica of the service. NewServer builds it from a Config;
+// Handler exposes the HTTP API without listening, and Run serves it until the
+// context is cancelled.
+type Server struct {
+	cfg       config.Config
+	kube      *k8sclient.Client
+	namespace string
+	// Rollout track of the pod, like stable or canary; empty when unset
+	track string
+
+	// Simulated initialization time, jitter included; ready is set after it
+	startupDelay time.Duration
+	ready        atomic.Bool
+	draining     atomic.Bool
+	checks       readinessChecks
+	// Requests currently being served, including the caller's own request
+	inFlight atomic.Int64
+	// When an admin drained the pod, in Unix nanoseconds; zero when serving
+	drainedAt atomic.Int64
+
+	recorder      *eventRecorder
+	elector       *leaderElector
+	deployWatcher *deploymentWatcher
+	members       *memberSet
+	repos         *repoPoller
+	discovery     *serviceDiscovery
+	flags         *flagStore
+	flagSrc       *flagSource
+	topology      *nodeTopology
+	disruptions   *disruptionTracker
+	drift         *imageDrift
+	rates         *rateCounter
+	metrics       *httpMetrics
+	jobs          *jobQueue
+	load          *loadGenerator
+	tasks         *taskStore
+	resources     *resourceMonitor
+	sidecars      *sidecarGate
+	registry      *registryClient
+	pressure      *nodePressure
+	storage       *storageMonitor
+	messages      *i18n.Bundle
+	recordings    *recording.Recorder
+	shadow        *trafficShadow
+	tracer        *tracing.Tracer
+	uploads       *artifact.Store
+	certs         *certReloader
+	live          *liveConfig
+	limiter       *ratelimit.Limiter
+	cors          *corsPolicy
+	admin         *adminKeys
+	stats         *statsStream
+	lifecycle     *lifecycleFeed
+	compressor    *compressor
+	local         *localCache
+	downstream    *downstream.Client
+	// Nil when PGHOST is unset and items are kept in memory
+	db    *postgres.DB
+	items itemStore
+	// Nil when REDIS_ADDR is unset
+	cache *responseCache
+	// Nil when EVENT_BROKER_URL is unset
+	bus *eventbus.Publisher
+	// Nil when no JWT secret or JWKS URL is configured
+	auth *jwtAuth
+	// Nil when OIDC_ISSUER_URL is unset and the status page is public
+	login *statusLogin
+	// Admin actions and mutations, served at /admin/audit
+	audit *audit.Log
+	// Argo CD Application of this service; nil unless ARGOCD_SERVER_URL is set
+	argo *argoStatus
+	// Flux and Argo CD notifications received at /webhooks/gitops
+	deployments *deploymentLog
+	// GitHub and GitLab webhooks received at /webhooks/git
+	git *gitLog
+	// Replicas behind the headless Service; nil unless PEERS_SERVICE is set
+	peers *peerSet
+	// Image tag in the GitOps repo; nil unless GITOPS_MANIFEST_URL is set
+	manifestDrift *manifestDrift
+	// Opens the pull requests of /api/v1/gitops/promote; nil unless
+	// GITOPS_REPO and GITOPS_PROMOTE_TOKEN are set
+	promoter *promoter
+	// Set by /admin/chaos, replacing the configured faults
+	chaosOverride atomic.Pointer[chaosOverride]
+	// When the deprecated unversioned API paths go away; zero when unset
+	legacySunset time.Time
+	// Proxies whose X-Forwarded-For names the client
+	trustedProxies []netip.Prefix
+
+	handler http.Handler
+}
+
+// NewServer creates the server and its components. Nothing is started until
+// Run is called. It fails when an enabled feature needs the Kubernetes API and
+// no client can be configured.
+func NewServer(cfg config.Config) (*Server, error) {
+	s := &Server{cfg: cfg, namespace: cfg.PodNamespace, track: resolveTrack(cfg)}
+	identity := cfg.Identity()
+
+	// Shared Kubernetes client: in-cluster config in a pod, kubeconfig on a laptop
+	if cfg.KubeRequired() || cfg.FeatureFlagsConfigMap != "" {
+		kube, err := k8sclient.New(k8sclient.Config{
+			Context: cfg.KubeContext,
+			QPS:     cfg.KubeQPS,
+			Burst:   cfg.KubeBurst,
+		})
+		switch {
+		case err != nil && cfg.KubeRequired():
+			return nil, fmt.Errorf("kubernetes features require API access: %w", err)
+		case err != nil:
+			log.Printf("Kubernetes API unavailable: %v", err)
+		default:
+			log.Printf("Using Kubernetes API at %s (in-cluster: %t, namespace: %s)", kube.Host(), kube.InCluster(), kube.Namespace())
+			s.kube = kube
+			s.namespace = kube.Namespace()
+		}
+	}
+
+	// Kubernetes Events on lifecycle transitions
+	if cfg.EventsEnabled {
+		s.recorder = newEventRecorder(s.kube, cfg.ServiceName, s.namespace, identity, cfg.PodUID, cfg.NodeName)
+	}
+	// Starts, readiness changes and reloads streamed at /events
+	s.lifecycle = newLifecycleFeed(s)
+
+	// Leader election gates singleton background tasks across replicas
+	leaseNamespace := cfg.LeaderElectionNamespace
+	if leaseNamespace == "" {
+		leaseNamespace = s.namespace
+	}
+	s.elector = newLeaderElector(cfg.LeaderElectionEnabled, s.kube, leaseNamespace, cfg.LeaderElectionLeaseName, identity)
+
+	// Live view of the owning Deployment's rollout
+	s.deployWatcher = newDeploymentWatcher(cfg.DeploymentWatchEnabled, s.kube, s.namespace, cfg.PodName, cfg.DeploymentName)
+
+	// Replicas split partitioned work (Git repo polling) between them
+	s.members = newMemberSet(s.clientIf(cfg.WorkPartitioningEnabled), s.namespace, cfg.WorkPartitionGroup, identity)
+	s.repos = newRepoPoller(s.members, cfg.GitPollRepos, cfg.GitPollInterval)
+
+	// Sibling services reported at /api/dependencies
+	s.discovery = newServiceDiscovery(s.kube, s.namespace, cfg.SiblingServices)
+
+	// Who changed what and when, in a stream of its own
+	auditLog, err := newAuditLog(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.audit = auditLog
+
+	// Feature flags from a watched ConfigMap, falling back to the mounted directory
+	s.flags = newFlagStore()
+	s.flags.subscribe(func(source string, generation int64) {
+		if generation > 1 {
+			s.audit.Record(audit.Entry{Action: "flags.reload", Actor: actorFlags, Target: source,
+				Outcome: audit.OutcomeSucceeded, Detail: fmt.Sprintf("generation %d", generation)})
+			s.recorder.Eventf(eventTypeNormal, reasonConfigReloaded, "Feature flags reloaded from %s (generation %d)", source, generation)
+			s.lifecycle.record(lifecycleConfig, "Feature flags reloaded from %s (generation %d)", source, generation)
+		}
+	})
+	s.flagSrc = &flagSource{
+		store:     s.flags,
+		client:    s.kube,
+		namespace: s.namespace,
+		configMap: cfg.FeatureFlagsConfigMap,
+		dir:       cfg.FeatureFlagsDir,
+	}
+
+	// Region/zone of the node this pod is scheduled on
+	s.topology = newNodeTopology(s.clientIf(cfg.NodeTopologyEnabled), cfg.NodeName)
+
+	// Voluntary disruption vs crash classification
+	s.disruptions = newDisruptionTracker(s.clientIf(cfg.DisruptionTrackingEnabled), s.recorder, s.namespace, identity,
+		cfg.NodeName, cfg.ContainerName)
+
+	// Running image digest vs the digest recorded in the GitOps repo
+	s.drift = newImageDrift(s.clientIf(cfg.ImageDriftEnabled), s.namespace, identity, cfg.ContainerName, cfg.ExpectedImageDigest)
+
+	// Request rate for the autoscaling signals endpoint
+	s.rates = &rateCounter{}
+
+	// Simulated background jobs; their backlog drives KEDA autoscaling
+	s.jobs = newJobQueue(cfg.JobWorkers, cfg.JobQueueCapacity)
+	// Prometheus metrics of the HTTP API, served at /metrics
+	s.metrics = newHTTPMetrics(cfg.Build, s.track, s.rates, s.inFlight.Load, s.jobs.depth)
+	// Serving certificate, reloaded when cert-manager rotates it
+	if cfg.TLSEnabled() {
+		certs, err := newCertReloader(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.certs = certs
+		s.metrics.registry.GaugeFunc("backend_service_tls_certificate_expiry_timestamp_seconds",
+			"Expiry of the serving certificate in use, as a Unix timestamp.", nil,
+			func() float64 { return float64(certs.expiry().Unix()) })
+	}
+	// Asynchronous tasks run by the same workers
+	s.tasks = newTaskStore(cfg.Hostname, s.jobs)
+	// Simulated CPU and memory load for HPA and VPA demos
+	s.load = newLoadGenerator(cfg.Hostname, cfg.LoadMaxMillicores, cfg.LoadMaxMemoryBytes, cfg.LoadMaxDuration)
+
+	// Declared requests/limits vs live cgroup usage
+	s.resources = newResourceMonitor(cfg.CPURequestMillicores, cfg.CPULimitMillicores,
+		cfg.MemoryRequestBytes, cfg.MemoryLimitBytes)
+
+	// Sidecars (e.g. istio-proxy) that must be ready before this pod is
+	s.sidecars = newSidecarGate(cfg.SidecarReadinessURLs)
+
+	// Self-registration with the dashboard/config service
+	advertiseURL := cfg.RegistryAdvertiseURL
+	if advertiseURL == "" {
+		advertiseURL = "http://" + net.JoinHostPort(cfg.PodIP, cfg.Port)
+	}
+	s.registry = newRegistryClient(cfg.RegistryURL, cfg.RegistryToken, cfg.RegistryHeartbeat, InstanceRegistration{
+		ID:          identity,
+		Service:     cfg.ServiceName,
+		Version:     cfg.Build.Version,
+		GitCommit:   cfg.Build.GitCommit,
+		Environment: cfg.Environment,
+		Namespace:   s.namespace,
+		URL:         advertiseURL,
+		Endpoints: map[string]string{
+			"health":  "/healthz",
+			"ready":   "/readyz",
+			"version": "/version",
+			"info":    "/api/info",
+		},
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	})
+
+	// MemoryPressure/DiskPressure/PIDPressure on the local node
+	s.pressure = newNodePressure(s.clientIf(cfg.NodePressureEnabled), s.recorder, cfg.NodeName, cfg.NodePressureMode)
+
+	// Writable volumes and ephemeral storage usage gate readiness
+	s.storage = newStorageMonitor(cfg.VolumeCheckPaths, cfg.EphemeralStorageLimitBytes, cfg.EphemeralStorageThresholdPercent)
+
+	// Message catalogs, with per-environment overrides from the mounted ConfigMap
+	messages, err := i18n.New(cfg.DefaultLanguage, cfg.MessageCatalogDir)
+	if err != nil {
+		return nil, fmt.Errorf("loading message catalogs: %w", err)
+	}
+	s.messages = messages
+
+	recordings, err := recording.NewRecorder(cfg.RecordingDir, cfg.Identity(),
+		cfg.RecordingSamplePercent, cfg.RecordingMaxBodyBytes, cfg.RecordingMaxBytes)
+	if err != nil {
+		return nil, err
+	}
+	s.recordings = recordings
+
+	uploads, err := artifact.NewStore(cfg.UploadDir, cfg.UploadMaxBytes, cfg.UploadMaxTotal)
+	if err != nil {
+		return nil, err
+	}
+	s.uploads = uploads
+
+	// Request spans, exported to an OpenTelemetry collector when configured
+	s.tracer = tracing.NewTracer(tracing.Config{
+		Endpoint:       cfg.TracingEndpoint,
+		ServiceName:    cfg.TracingServiceName,
+		ServiceVersion: cfg.Build.Version,
+		Attributes: map[string]string{
+			"deployment.environment": cfg.Environment,
+			"k8s.namespace.name":     s.namespace,
+			"k8s.pod.name":           identity,
+		},
+		SamplePercent: cfg.TracingSamplePercent,
+	})
+
+	shadow, err := newTrafficShadow(cfg.ShadowTargetURL, cfg.ShadowSamplePercent, cfg.ShadowTimeout, cfg.ShadowMaxInFlight)
+	if err != nil {
+		return nil, err
+	}
+	shadow.client.Transport = requestid.Transport(s.tracer.Transport(nil))
+	s.shadow = shadow
+
+	s.deployments = newDeploymentLog(cfg)
+	s.git = newGitLog(cfg)
+
+	// Sync status of the Argo CD Application managing this service
+	s.argo = newArgoStatus(cfg)
+	if s.argo != nil {
+		s.argo.client.Transport = requestid.Transport(s.tracer.Transport(s.argo.client.Transport))
+	}
+
+	// Versions of the other replicas, for /api/v1/peers
+	s.peers = newPeerSet(cfg)
+	if s.peers != nil {
+		s.peers.client.Transport = requestid.Transport(s.tracer.Transport(nil))
+		s.elector.runWhenLeader("peers-poll", s.pollPeers)
+	}
+
+	// The running build compared to the image tag in the GitOps repo
+	s.manifestDrift = newManifestDrift(cfg)
+	if s.manifestDrift != nil {
+		s.manifestDrift.client.Transport = requestid.Transport(s.tracer.Transport(nil))
+		s.metrics.registry.GaugeFunc("backend_service_gitops_drift",
+			"1 while the image tag in GITOPS_MANIFEST_URL names another build than the running one, else 0.", nil,
+			func() float64 {
+				if s.manifestDrift.status().Status == driftDrifted {
+					return 1
+				}
+				return 0
+			})
+	}
+
+	// Pull requests promoting an environment to another image tag
+	s.promoter = newPromoter(cfg)
+	if s.promoter != nil {
+		s.promoter.client.Transport = requestid.Transport(s.tracer.Transport(nil))
+	}
+
+	// Calls to other services, for /api/v1/call and /api/v1/chain
+	for _, target := range append([]string{cfg.DownstreamURL}, cfg.DownstreamChainURLs...) {
+		if err := validDownstreamURL(target); target != "" && err != nil {
+			return nil, err
+		}
+	}
+	s.downstream = s.newDownstreamClient(cfg)
+
+	// Items of /api/v1/items, in PostgreSQL when configured
+	s.items = newMemItems()
+	if cfg.DatabaseHost != "" {
+		s.db = postgres.Open(postgres.Config{
+			Host:            cfg.DatabaseHost,
+			Port:            cfg.DatabasePort,
+			User:            cfg.DatabaseUser,
+			Password:        cfg.DatabasePassword,
+			Database:        cfg.DatabaseName,
+			SSLMode:         cfg.DatabaseSSLMode,
+			MaxConns:        cfg.DatabaseMaxConns,
+			ConnectTimeout:  5 * time.Second,
+			ApplicationName: cfg.ServiceName,
+		})
+		s.items = &pgItems{db: s.db}
+	}
+	// Responses of /api/v1/info and the items list, cached in Redis when configured
+	s.cache = newResponseCache(cfg, s.metrics)
+	// CloudEvents of API activity, published to NATS or Kafka when configured
+	bus, err := newEventPublisher(cfg, s.metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.bus = bus
+
+	// Settings reloaded from the config file without a restart
+	if s.live, err = newLiveConfig(cfg); err != nil {
+		return nil, err
+	}
+	s.live.subscribe(func(generation int64, trigger string) {
+		s.audit.Record(audit.Entry{Action: "config.reload", Actor: actorConfig, Target: config.File(),
+			Outcome: audit.OutcomeSucceeded, Detail: fmt.Sprintf("generation %d (%s)", generation, trigger)})
+		s.lifecycle.record(lifecycleConfig, "Configuration generation %d applied (%s)", generation, trigger)
+	})
+	// Rate limits of the API, read from the live settings on every request
+	s.limiter = ratelimit.New()
+	s.trustedProxies = cfg.TrustedProxyPrefixes()
+	// Cross-origin access of the API from browser frontends
+	s.cors = newCORSPolicy(cfg)
+	// Bearer tokens required on the API, their claims handed to handlers
+	auth, err := newJWTAuth(cfg, s.metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.auth = auth
+	// Admin token and API keys of the admin endpoints
+	admin, err := newAdminKeys(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.admin = admin
+	// OpenID Connect login in front of the HTML status page
+	login, err := newStatusLogin(cfg, s.metrics)
+	if err != nil {
+		return nil, err
+	}
+	s.login = login
+	// Live stats pushed over WebSocket to dashboards
+	s.stats = newStatsStream(s)
+	s.metrics.registry.GaugeFunc("backend_service_websocket_connections", "Open /ws/stats streams.", nil,
+		func() float64 { return float64(s.stats.connections()) })
+	// Gzip of large JSON responses
+	s.compressor = newCompressor(cfg, s.metrics)
+	// ETags of GET responses, and responses of the cached routes in memory
+	s.local = newLocalCache(cfg, s.metrics)
+	s.legacySunset = legacySunset(cfg.APILegacySunset)
+
+	// Simulated initialization, jittered so replicas don't all start at once
+	s.startupDelay = cfg.StartupDelay
+	if cfg.StartupJitter > 0 {
+		s.startupDelay += time.Duration(rand.Int63n(int64(cfg.StartupJitter)))
+	}
+
+	// Conditions of readiness, aggregated by /readyz
+	s.registerReadinessChecks()
+
+	// Middleware chains of the route groups
+	chains, err := s.buildChains()
+	if err != nil {
+		return nil, err
+	}
+	s.handler = s.routes(chains)
+	return s, nil
+}
+
+// clientIf returns the shared Kubernetes client when a feature is enabled, so
+// the feature's component sees a nil client and stays disabled otherwise.
+func (s *Server) clientIf(enabled bool) *k8sclient.Client {
+	if enabled {
+		return s.kube
+	}
+	return nil
+}
+
+// routes registers every endpoint, wrapped in the middleware chain of its
+// group.
+func (s *Server) routes(chains map[string]groupChain) *router.Router {
+	cfg := s.cfg
+	rt := router.New()
+	handle := func(route router.Route) {
+		if route.Auth {
+			route.Handler = requireAdmin(s.admin, route.Handler)
+		}
+		if actions, ok := auditActions[route.Name]; ok {
+			route.Handler = s.audited(actions, route.Handler)
+		}
+		route.Handler = chains[route.Group].wrap(route.Handler)
+		rt.Handle(route)
+	}
+	get := []string{http.MethodGet}
+
+	// Health check endpoint (liveness probe)
+	health := handlers.Health(cfg.Build.Version)
+	handle(router.Route{Name: "health", Methods: get, Pattern: "/health", Group: groupProbes, Handler: health,
+		Description: "Liveness probe"})
+	handle(router.Route{Name: "healthz", Methods: get, Pattern: "/healthz", Group: groupProbes, Handler: health,
+		Description: "Liveness probe"})
+
+	// Readiness probe endpoint
+	ready := http.HandlerFunc(s.readinessHandler)
+	handle(router.Route{Name: "ready", Methods: get, Pattern: "/ready", Group: groupProbes, Handler: ready,
+		Description: "Readiness probe"})
+	handle(router.Route{Name: "readyz", Methods: get, Pattern: "/readyz", Group: groupProbes, Handler: ready,
+		Description: "Readiness probe"})
+
+	// Startup probe endpoint: passes once initialization is done, whatever
+	// readiness says later
+	handle(router.Route{Name: "startupz", Methods: get, Pattern: "/startupz", Group: groupProbes,
+		Handler: http.HandlerFunc(s.startupHandler), Description: "Startup probe"})
+
+	// Prometheus scrape endpoint; probe chain, so scrapes skip the API middleware
+	handle(router.Route{Name: "metrics", Methods: get, Pattern: "/metrics", Group: groupProbes, Handler: s.metrics.registry,
+		Description: "Prometheus metrics: request counts and latency by route, in-flight requests, build info"})
+
+	// Version endpoint
+	handle(router.Route{Name: "version", Methods: get, Pattern: "/version", Group: groupAPI,
+		Handler: handlers.Version(cfg.Build), Description: "Version information"})
+
+	// Main API endpoint; browsers get the HTML status page, behind a login
+	// when OIDC_ISSUER_URL is set
+	info := handlers.Info(s.infoConfig())
+	// The page is in the browser group, whose chain checks no JWT; the
+	// information it's an alternative to still needs one.
+	apiInfo := s.auth.middleware(info)
+	handle(router.Route{Name: "index", Methods: get, Pattern: "/", Group: groupBrowser,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if acceptsHTML(r) {
+				if sess, ok := s.login.authenticate(w, r); ok {
+					s.statusPageHandler(w, r, sess)
+				}
+				return
+			}
+			apiInfo.ServeHTTP(w, r)
+		}),
+		Description: "HTML status page for browsers, service information otherwise"})
+
+	// OpenID Connect login of the status page; 404 when it's disabled
+	handle(router.Route{Name: "login", Methods: get, Pattern: loginPath, Group: groupBrowser,
+		Handler:     http.HandlerFunc(s.login.loginHandler),
+		Description: "Start an OpenID Connect login of the status page; redirects to the provider"})
+	handle(router.Route{Name: "login-callback", Methods: get, Pattern: callbackPath, Group: groupBrowser,
+		Handler:     http.HandlerFunc(s.login.callbackHandler),
+		Description: "Redirect target of the OpenID provider; sets the session cookie"})
+	handle(router.Route{Name: "logout", Methods: []string{http.MethodGet, http.MethodPost}, Pattern: logoutPath, Group: groupBrowser,
+		Handler:     http.HandlerFunc(s.login.logoutHandler),
+		Description: "End the status page session, at the provider too when it supports it"})
+
+	// Live stats for dashboards: a WebSocket pushing a frame every second,
+	// open as long as the client keeps it
+	handle(router.Route{Name: "ws-stats", Methods: get, Pattern: "/ws/stats", Group: groupBrowser, Timeout: -1,
+		Handler:     http.HandlerFunc(s.stats.handler),
+		Description: "WebSocket pushing request rate, goroutines, memory and version every second; the current stats to plain GETs"})
+
+	// Lifecycle events of the replica; streams stay open as long as the
+	// client keeps them
+	handle(router.Route{Name: "lifecycle-events", Methods: get, Pattern: "/events", Group: groupBrowser, Timeout: -1,
+		Handler:     http.HandlerFunc(s.lifecycle.handler),
+		Description: "Server-Sent Events when the replica starts, its readiness changes or its config reloads; recent events as JSON otherwise"})
+
+	// API endpoints, under /api/v1. Unless API_LEGACY_PATHS_ENABLED is
+	// false, each is also served at its unversioned path, marked deprecated.
+	v1 := func(route router.Route) {
+		pattern := route.Pattern
+		route.Pattern = apiV1Prefix + pattern
+		handle(route)
+		if cfg.APILegacyPaths {
+			route.Pattern, route.Deprecated = "/api"+pattern, true
+			handle(route)
+		}
+	}
+	handle(router.Route{Name: "api-versions", Methods: get, Pattern: "/api", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.apiVersionsHandler),
+		Description: "API path and response versions this build serves, and the sunset of unversioned paths"})
+	v1(router.Route{Name: "info", Methods: get, Pattern: "/info", Group: groupAPI,
+		Handler:     s.cache.wrap("info", func(*http.Request) string { return "info:" + cfg.Hostname }, info),
+		Description: "Service information"})
+	v1(router.Route{Name: "config", Methods: get, Pattern: "/config", Group: groupAPI, Handler: http.HandlerFunc(s.live.handler),
+		Description: "Generation and values of the settings reloaded without a restart"})
+	v1(router.Route{Name: "flags", Methods: get, Pattern: "/flags", Group: groupAPI, Handler: http.HandlerFunc(s.flags.handler),
+		Description: "Feature flags, their values and where they were read from"})
+	v1(router.Route{Name: "me", Methods: get, Pattern: "/me", Group: groupAPI, Handler: http.HandlerFunc(s.meHandler),
+		Description: "Claims of the request's JWT bearer token"})
+	v1(router.Route{Name: "echo", Pattern: "/echo", Group: groupAPI, Handler: handlers.Echo(cfg.Hostname),
+		Description: "Method, headers, query, body and client IP of the request as received"})
+	// Any path below /echo too, so ingress rewrites and prefix routing can
+	// be seen in the echoed path.
+	v1(router.Route{Name: "echo-path", Pattern: "/echo/{path...}", Group: groupAPI, Handler: handlers.Echo(cfg.Hostname),
+		Description: "Like /echo, for any path below it"})
+	v1(router.Route{Name: "delay", Methods: get, Pattern: "/delay/{duration}", Group: groupAPI,
+		Handler: handlers.Delay(cfg.Hostname, cfg.DelayMax), Timeout: cfg.DelayMax + cfg.RequestTimeout,
+		Description: "Respond after the given duration"})
+	v1(router.Route{Name: "status", Pattern: "/status/{code}", Group: groupAPI,
+		Handler: handlers.StatusCode(cfg.Hostname), Description: "Respond with the given HTTP status"})
+	v1(router.Route{Name: "leader", Methods: get, Pattern: "/leader", Group: groupAPI,
+		Handler: http.HandlerFunc(s.elector.handler), Description: "Current Lease holder"})
+	v1(router.Route{Name: "deployment", Methods: get, Pattern: "/deployment", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.deployWatcher.handler),
+		Description: "Live desired/ready replicas and rollout conditions of the owning Deployment"})
+	v1(router.Route{Name: "dependencies", Methods: get, Pattern: "/dependencies", Group: groupAPI,
+		Handler:     dependenciesHandler(s.discovery, s.storage),
+		Description: "Sibling Services and volume health"})
+	v1(router.Route{Name: "resources", Methods: get, Pattern: "/resources", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.resources.handler),
+		Description: "Declared CPU/memory requests and limits vs live cgroup usage"})
+	v1(router.Route{Name: "disruptions", Methods: get, Pattern: "/disruptions", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.disruptions.handler),
+		Description: "Previous container termination and the cause of the current shutdown"})
+	v1(router.Route{Name: "gitops-status", Methods: get, Pattern: "/gitops/status", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.gitopsStatusHandler),
+		Description: "Sync status, health and target revision of the Argo CD Application managing this service"})
+	v1(router.Route{Name: "deployments", Methods: get, Pattern: "/deployments", Group: groupAPI,
+		Handler:     s.deployments.handler(cfg.Identity()),
+		Description: "Flux and Argo CD deployment events this replica received, newest first; ?object= filters by Kind/namespace/name"})
+	v1(router.Route{Name: "git-commits", Methods: get, Pattern: "/git/commits", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.git.handler),
+		Description: "Latest commit pushed to GIT_WEBHOOK_BRANCH next to the running commit, and recent Git webhooks"})
+	v1(router.Route{Name: "peers", Methods: get, Pattern: "/peers", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.peersHandler),
+		Description: "Versions served by the replicas behind PEERS_SERVICE, to see the skew of a rollout"})
+	v1(router.Route{Name: "drift", Methods: get, Pattern: "/drift", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.drift.handler),
+		Description: "Running image digest compared to the GitOps repo"})
+	v1(router.Route{Name: "gitops-drift", Methods: get, Pattern: "/gitops/drift", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.gitopsDriftHandler),
+		Description: "Image tag declared by the GitOps manifest compared to the running version and commit"})
+	v1(router.Route{Name: "gitops-promote", Methods: []string{http.MethodPost}, Pattern: "/gitops/promote", Group: groupAPI,
+		Auth: true, Handler: http.HandlerFunc(s.promoteHandler), Timeout: promoteTimeout,
+		Description: "Open a pull request setting an environment's image tag in GITOPS_REPO; needs the admin token"})
+	v1(router.Route{Name: "kubernetes", Methods: get, Pattern: "/kubernetes", Group: groupAPI,
+		Handler:     kubernetesClientHandler(s.kube),
+		Description: "Kubernetes API client latency, throttling and informer state"})
+	v1(router.Route{Name: "repos", Methods: get, Pattern: "/repos", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.repos.handler),
+		Description: "Head revisions of the polled Git repos"})
+	v1(router.Route{Name: "scaling-metrics", Methods: get, Pattern: "/metrics/scaling", Group: groupAPI,
+		Handler:     s.scalingMetricsHandler(),
+		Description: "In-flight requests, RPS and queue depth for autoscaling"})
+	v1(router.Route{Name: "queue-metrics", Methods: get, Pattern: "/metrics/queue", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.jobs.metricsHandler),
+		Description: "Background job backlog for KEDA"})
+	v1(router.Route{Name: "jobs", Methods: []string{http.MethodPost}, Pattern: "/jobs", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.jobs.enqueueHandler),
+		Description: "Enqueue simulated background jobs"})
+	v1(router.Route{Name: "tasks", Methods: []string{http.MethodPost}, Pattern: "/tasks", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.tasks.createHandler),
+		Description: "Start a long-running task; answers 202 with its ID"})
+	v1(router.Route{Name: "task", Methods: get, Pattern: "/tasks/{id}", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.tasks.getHandler),
+		Description: "Status of one task"})
+	v1(router.Route{Name: "task-events", Methods: get, Pattern: "/tasks/{id}/events", Group: groupAPI,
+		Handler: http.HandlerFunc(s.tasks.eventsHandler), Timeout: -1,
+		Description: "Server-Sent Events for one task until it finishes"})
+	v1(router.Route{Name: "upload", Methods: []string{http.MethodPost}, Pattern: "/upload", Group: groupAPI,
+		Handler: http.HandlerFunc(s.uploadHandler), Timeout: uploadTimeout,
+		Description: "Store a multipart file upload; answers 201 with its URL"})
+	v1(router.Route{Name: "uploaded", Methods: get, Pattern: "/upload/{id}", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.uploadedHandler),
+		Description: "Download an uploaded file"})
+	v1(router.Route{Name: "load", Methods: get, Pattern: "/load", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.load.statusHandler),
+		Description: "Running simulated loads and their limits"})
+	v1(router.Route{Name: "load-cpu", Methods: []string{http.MethodPost}, Pattern: "/load/cpu", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.load.cpuHandler),
+		Description: "Burn the given millicores of CPU for a duration"})
+	v1(router.Route{Name: "load-memory", Methods: []string{http.MethodPost}, Pattern: "/load/memory", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.load.memoryHandler),
+		Description: "Hold the given megabytes of memory for a duration"})
+	v1(router.Route{Name: "call", Methods: get, Pattern: "/call", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.callHandler),
+		Description: "Fetch DOWNSTREAM_URL with retries and a circuit breaker, and report the answer"})
+	v1(router.Route{Name: "chain", Methods: get, Pattern: "/chain", Group: groupAPI,
+		Handler:     http.HandlerFunc(s.chainHandler),
+		Description: "Call DOWNSTREAM_CHAIN_URLS in order and aggregate their answers and latencies"})
+	v1(router.Route{Name: "items", Methods: []string{http.MethodGet, http.MethodPost}, Pattern: "/items", Group: groupAPI,
+		Handler:     s.cache.wrap("items", s.itemsCacheNamespace, http.HandlerFunc(s.itemsHandler)),
+		Description: "List items, or create one; answers 201 with its URL"})
+	v1(router.Route{Name: "item", Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete}, Pattern: "/items/{id}",
+		Group: groupAPI, Handler: http.HandlerFunc(s.itemHandler),
+		Description: "Read, replace or delete one item"})
+	v1(router.Route{Name: "schemas", Methods: get, Pattern: "/schemas", Group: groupAPI,
+		Handler:     http.HandlerFunc(schemaIndexHandler),
+		Description: "Index of the JSON Schemas of every response type"})
+	v1(router.Route{Name: "schema", Methods: get, Pattern: "/schemas/{name}", Group: groupAPI,
+		Handler:     http.HandlerFunc(schemaHandler),
+		Description: "JSON Schema of one response type"})
+
+	// API contract, generated from the routes and response types
+	handle(router.Route{Name: "openapi", Methods: get, Pattern: "/openapi.json", Group: groupBrowser,
+		Handler:     openAPIHandler(rt, cfg.Build.Version),
+		Description: "OpenAPI 3.1 document of every route"})
+	handle(router.Route{Name: "docs", Methods: get, Pattern: "/docs", Group: groupBrowser,
+		Handler:     http.HandlerFunc(docsHandler),
+		Description: "Swagger UI for /openapi.json"})
+
+	// Admin endpoints
+	handle(router.Route{Name: "admin-config", Methods: get, Pattern: "/admin/config", Group: groupAdmin, Auth: true,
+		Handler:     handlers.Config(cfg.ServiceName, cfg.Build.Version, cfg.Hostname, cfg.ConfigDumpPrefixes),
+		Description: "Effective configuration and selected env vars, secrets masked"})
+	handle(router.Route{Name: "admin-env", Methods: get, Pattern: "/admin/env", Group: groupAdmin, Auth: true,
+		Handler:     handlers.Env(cfg.ServiceName, cfg.Hostname),
+		Description: "Environment variables of the process, secrets masked"})
+	// The kubelet calls the preStop hook without credentials, on the admin
+	// port, and the drain bounds its own duration.
+	handle(router.Route{Name: "admin-prestop", Methods: []string{http.MethodGet, http.MethodPost},
+		Pattern: "/admin/prestop", Group: groupAdmin, Timeout: -1, Handler: adminListenerOnly(s.prestopHandler()),
+		Description: "preStop hook: fail readiness and wait for in-flight requests to drain"})
+	post := []string{http.MethodPost}
+	handle(router.Route{Name: "admin-drain", Methods: post, Pattern: "/admin/drain", Group: groupAdmin, Auth: true,
+		Handler:     http.HandlerFunc(s.drainHandler),
+		Description: "Fail readiness so the pod leaves the Service endpoints, without stopping it"})
+	handle(router.Route{Name: "admin-undrain", Methods: post, Pattern: "/admin/undrain", Group: groupAdmin, Auth: true,
+		Handler:     http.HandlerFunc(s.undrainHandler),
+		Description: "Undo /admin/drain; 409 while shutting down"})
+	st := &selftest{cfg: cfg, discovery: s.discovery}
+	handle(router.Route{Name: "admin-selftest", Methods: get, Pattern: "/admin/selftest", Group: groupAdmin, Auth: true,
+		Handler:     http.HandlerFunc(st.handler),
+		Description: "Run config, dependency, clock and temp dir diagnostics; 503 when one fails"})
+	handle(router.Route{Name: "admin-recordings", Methods: get, Pattern: "/admin/recordings", Group: groupAdmin, Auth: true,
+		Handler:     http.HandlerFunc(s.recordingsHandler),
+		Description: "Recorded traffic files for replay"})
+	handle(router.Route{Name: "admin-recording", Methods: get, Pattern: "/admin/recordings/{name}", Group: groupAdmin, Auth: true,
+		Handler: http.HandlerFunc(s.recordingHandler), Timeout: -1,
+		Description: "Download one recorded traffic file as JSON lines"})
+	handle(router.Route{Name: "admin-chaos", Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete},
+		Pattern: "/admin/chaos", Group: groupAdmin, Auth: true, Handler: http.HandlerFunc(s.chaosHandler),
+		Description: "Show the injected faults; PUT overrides the configured ones, DELETE reverts to them"})
+	handle(router.Route{Name: "admin-loglevel", Methods: []string{http.MethodGet, http.MethodPut, http.MethodDelete},
+		Pattern: "/admin/loglevel", Group: groupAdmin, Auth: true, Handler: http.HandlerFunc(s.logLevelHandler),
+		Description: "Show the log level; PUT overrides the configured one, DELETE reverts to it"})
+	handle(router.Route{Name: "admin-audit", Methods: get, Pattern: "/admin/audit", Group: groupAdmin, Auth: true,
+		Handler:     http.HandlerFunc(s.auditHandler),
+		Description: "Recent admin actions and API mutations of this replica, newest first; ?action= filters by prefix"})
+	handle(router.Route{Name: "admin-routes", Methods: get, Pattern: "/admin/routes", Group: groupAdmin, Auth: true,
+		Handler:     routesHandler(rt, chains, s.defaultTimeout),
+		Description: "Every registered route with its methods, auth, timeout and middleware"})
+
+	// Webhooks of GitOps controllers and Git hosts, signed with a shared
+	// secret rather than authorized by the admin token or a JWT
+	handle(router.Route{Name: "webhook-gitops", Methods: post, Pattern: "/webhooks/gitops", Group: groupWebhooks,
+		Handler:     http.HandlerFunc(s.deployments.webhookHandler),
+		Description: "Record a Flux notification-controller event or Argo CD notification, signed in X-Signature"})
+	handle(router.Route{Name: "webhook-git", Methods: post, Pattern: "/webhooks/git", Group: groupWebhooks,
+		Handler:     http.HandlerFunc(s.git.webhookHandler),
+		Description: "Record a GitHub push or pull request, signed in X-Hub-Signature-256, or a GitLab push or merge request"})
+
+	// Unrouted requests go through the API chain so they are logged and
+	// counted like any other.
+	rt.NotFound = chains[groupAPI].wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", r.URL.Path), http.StatusNotFound)
+	}))
+	rt.MethodNotAllowed = chains[groupAPI].wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.method_not_allowed"), http.StatusMethodNotAllowed)
+	}))
+	return rt
+}
+
+// Handler returns the server's HTTP API with its middleware.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Run starts the background components and serves HTTP until ctx is
+// cancelled, then drains in-flight requests and stops the components.
+func (s *Server) Run(ctx context.Context) error {
+	cfg := s.cfg
+	identity := cfg.Identity()
+
+	// Shared caches of this pod and its node, read by several features
+	if s.kube != nil && (cfg.DeploymentWatchEnabled || cfg.DisruptionTrackingEnabled || cfg.ImageDriftEnabled) {
+		podInformer(s.kube, s.namespace, identity).Start(ctx)
+	}
+	if s.kube != nil && cfg.NodeName != "" && (cfg.NodeTopologyEnabled || cfg.DisruptionTrackingEnabled || cfg.NodePressureEnabled) {
+		nodeInformer(s.kube, cfg.NodeName).Start(ctx)
+	}
+
+	// Background goroutines that must finish cleanly before exit
+	var background sync.WaitGroup
+	tracked := func(ctx context.Context, run func(context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			run(ctx)
+		}()
+	}
+
+	// Run past ctx so events recorded and spans ended during shutdown are
+	// still delivered
+	recorderCtx, stopRecorder := context.WithCancel(context.Background())
+	tracked(recorderCtx, s.recorder.run)
+	tracked(recorderCtx, s.tracer.Run)
+	tracked(recorderCtx, s.bus.Run)
+	tracked(ctx, s.elector.run)
+	tracked(ctx, s.members.run)
+	tracked(ctx, s.jobs.run)
+	tracked(ctx, s.load.run)
+	tracked(ctx, s.registry.run)
+
+	go s.deployWatcher.run(ctx)
+	go s.repos.run(ctx)
+	go s.discovery.run(ctx)
+	go s.flagSrc.run(ctx)
+	go s.topology.run(ctx)
+	go s.disruptions.recordPreviousTermination(ctx)
+	go s.drift.run(ctx)
+	go s.manifestDrift.run(ctx)
+	go s.resources.run(ctx)
+	go s.sidecars.run(ctx)
+	go s.pressure.run(ctx)
+	go s.storage.run(ctx)
+	go s.certs.run(ctx)
+	go s.live.run(ctx)
+	go s.lifecycle.run(ctx)
+	go s.auth.run(ctx)
+	go s.admin.run(ctx)
+	go s.login.run(ctx)
+
+	go func() {
+		select {
+		case <-time.After(s.startupDelay):
+		case <-ctx.Done():
+			return
+		}
+		s.ready.Store(true)
+		log.Printf("Service started after %s and is ready to accept traffic", s.startupDelay)
+		s.recorder.Eventf(eventTypeNormal, reasonStartupCompleted, "%s %s is ready to accept traffic", cfg.ServiceName, cfg.Build.Version)
+		s.lifecycle.record(lifecycleStarted, "%s %s (%s) started after %s", cfg.ServiceName, cfg.Build.Version, cfg.Build.GitCommit, s.startupDelay)
+		s.lifecycle.observeReadiness(s.readinessStatus(ctx))
+		s.bus.Emit(eventVersionStarted, identity, versionStartedEvent{
+			Version:     cfg.Build.Version,
+			GitCommit:   cfg.Build.GitCommit,
+			Environment: cfg.Environment,
+			Pod:         identity,
+			Node:        cfg.NodeName,
+		})
+	}()
+
+	server := &http.Server{
+		Addr:         ":" + cfg.Port,
+		Handler:      s.handler,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+
+	// HTTPS on its own listener next to HTTP, or in place of it
+	var httpsServer *http.Server
+	if s.certs != nil {
+		if cfg.TLSPort == "" {
+			server.TLSConfig = s.certs.tlsConfig()
+		} else {
+			httpsServer = &http.Server{
+				Addr:         ":" + cfg.TLSPort,
+				Handler:      s.handler,
+				TLSConfig:    s.certs.tlsConfig(),
+				ReadTimeout:  server.ReadTimeout,
+				WriteTimeout: server.WriteTimeout,
+				IdleTimeout:  server.IdleTimeout,
+			}
+		}
+	}
+
+	// Diagnostics listener; profiles and traces take longer than the
+	// public WriteTimeout allows.
+	var adminServer *http.Server
+	if cfg.AdminPort != "" {
+		adminServer = &http.Server{
+			Addr:              ":" + cfg.AdminPort,
+			Handler:           s.debugHandler(),
+			ReadHeaderTimeout: 10 * time.Second,
+			IdleTimeout:       60 * time.Second,
+		}
+	}
+
+	// gRPC listener of the Info, Version and Health APIs
+	var grpcServer *http.Server
+	if cfg.GRPCPort != "" {
+		grpcServer = s.newGRPCServer(ctx)
+	}
+
+	s.logStartupSummary(server, httpsServer, adminServer, grpcServer)
+
+	serveErr := make(chan error, 4)
+	for _, srv := range []*http.Server{server, httpsServer, adminServer, grpcServer} {
+		if srv == nil {
+			continue
+		}
+		go func(srv *http.Server) {
+			var err error
+			if srv.TLSConfig != nil {
+				// The certificate comes from TLSConfig.GetCertificate.
+				err = srv.ListenAndServeTLS("", "")
+			} else {
+				err = srv.ListenAndServe()
+			}
+			if err != nil && err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}(srv)
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Println("Shutting down server...")
+		s.stats.close()
+		s.lifecycle.close()
+	case err = <-serveErr:
+		err = fmt.Errorf("server failed to start: %w", err)
+	}
+
+	classifyCtx, cancelClassify := context.WithTimeout(context.Background(), 3*time.Second)
+	s.disruptions.onTermination(classifyCtx, "SIGTERM")
+	cancelClassify()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	if shutdownErr := server.Shutdown(shutdownCtx); shutdownErr != nil {
+		log.Printf("Error during server shutdown: %v", shutdownErr)
+	}
+	if httpsServer != nil {
+		if shutdownErr := httpsServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Printf("Error during HTTPS server shutdown: %v", shutdownErr)
+		}
+	}
+	if grpcServer != nil {
+		if shutdownErr := grpcServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			log.Printf("Error during gRPC server shutdown: %v", shutdownErr)
+		}
+	}
+	if adminServer != nil {
+		// In-flight profiles would hold up the exit; cut them off.
+		if err := adminServer.Close(); err != nil {
+			log.Printf("Error closing admin listener: %v", err)
+		}
+	}
+	if s.db != nil {
+		s.db.Close()
+	}
+	s.cache.close()
+	stopRecorder()
+	if err == nil {
+		background.Wait()
+	}
+	return err
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/tracing"
+)
+
+// ShadowHeader marks mirrored requests, so the candidate can tell them from
+// real traffic and never mirrors them again.
+const ShadowHeader = "X-Shadow-Request"
+
+// shadowMaxBody is the largest request body that is mirrored; bigger
+// requests are only served.
+const shadowMaxBody = 1 << 20
+
+// trafficShadow mirrors a share of live requests to a candidate version in
+// the background and discards its responses, so the candidate sees
+// production traffic before cutover without affecting clients. Mirroring
+// never delays the real request: when maxInFlight mirrors are pending, new
+// ones are dropped.
+type trafficShadow struct {
+	target      string
+	percent     int64
+	timeout     time.Duration
+	client      *http.Client
+	slots       chan struct{}
+	sampled     func() bool
+	mirrored    atomic.Int64
+	dropped     atomic.Int64
+	failed      atomic.Int64
+	lastErrorAt atomic.Int64
+}
+
+// newTrafficShadow returns a shadow mirroring percent of the requests to
+// the base URL target; an empty target or 0 disables it.
+func newTrafficShadow(target string, percent int64, timeout time.Duration, maxInFlight int) (*trafficShadow, error) {
+	if target != "" {
+		if u, err := url.Parse(target); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid shadow target URL %q", target)
+		}
+	}
+	ts := &trafficShadow{
+		target:  strings.TrimSuffix(target, "/"),
+		percent: percent,
+		timeout: timeout,
+		client:  &http.Client{Timeout: timeout},
+		slots:   make(chan struct{}, max(maxInFlight, 1)),
+	}
+	ts.sampled = func() bool { return rand.Int63n(100) < ts.percent }
+	return ts, nil
+}
+
+func (ts *trafficShadow) enabled() bool {
+	return ts != nil && ts.target != "" && ts.percent > 0
+}
+
+func (ts *trafficShadow) middleware(next http.Handler) http.Handler {
+	if !ts.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(ShadowHeader) == "" && ts.sampled() {
+			ts.mirror(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mirror copies r and sends the copy to the target in the background. The
+// body is read up front and handed back to r, so the handler sees it
+// unchanged.
+func (ts *trafficShadow) mirror(r *http.Request) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, shadowMaxBody+1))
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || len(body) > shadowMaxBody {
+			ts.dropped.Add(1)
+			return
+		}
+	}
+	select {
+	case ts.slots <- struct{}{}:
+	default:
+		ts.dropped.Add(1)
+		return
+	}
+
+	// The copy must outlive r, whose context ends with the response, but
+	// belongs to the same trace.
+	ctx := context.Background()
+	if span := tracing.SpanFromContext(r.Context()); span != nil {
+		ctx = tracing.ContextWithSpan(ctx, span)
+	}
+	ctx, cancel := context.WithTimeout(ctx, ts.timeout)
+	req, err := http.NewRequestWithContext(ctx, r.Method, ts.target+r.URL.RequestURI(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		<-ts.slots
+		ts.failed.Add(1)
+		return
+	}
+	req.Header = r.Header.Clone()
+	for _, h := range []string{"Connection", "Keep-Alive", "Te", "Trailer", "Transfer-Encoding", "Upgrade"} {
+		req.Header.Del(h)
+	}
+	req.Header.Set(ShadowHeader, "1")
+	// Like a proxy, append the peer's address to the chain it forwarded.
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+		client = strings.Join(prior, ", ") + ", " + client
+	}
+	req.Header.Set("X-Forwarded-For", client)
+
+	go func() {
+		defer func() { <-ts.slots }()
+		defer cancel()
+		resp, err := ts.client.Do(req)
+		if err != nil {
+			ts.failed.Add(1)
+			ts.logError(err)
+			return
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		ts.mirrored.Add(1)
+	}()
+}
+
+// logError logs at most one mirroring error a minute: an unreachable
+// candidate would otherwise log once per sampled request.
+func (ts *trafficShadow) logError(err error) {
+	now := time.Now().Unix()
+	last := ts.lastErrorAt.Load()
+	if now-last < 60 || !ts.lastErrorAt.CompareAndSwap(last, now) {
+		return
+	}
+	log.Printf("Error mirroring to shadow target %s (%d failed, %d mirrored so far): %v",
+		ts.target, ts.failed.Load(), ts.mirrored.Load(), err)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
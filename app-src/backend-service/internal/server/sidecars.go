@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const sidecarCheckInterval = 2 * time.Second
+
+// sidecarGate polls the readiness endpoints of co-located sidecars, such as
+// istio-proxy's http://localhost:15021/healthz/ready, and holds readiness
+// back until all of them answer 2xx. This avoids the mesh startup race where
+// the app receives traffic before its proxy can carry outbound calls.
+type sidecarGate struct {
+	urls     []string
+	client   *http.Client
+	allReady int32
+}
+
+func newSidecarGate(urls []string) *sidecarGate {
+	sg := &sidecarGate{
+		urls:   urls,
+		client: &http.Client{Timeout: time.Second},
+	}
+	if len(urls) == 0 {
+		sg.allReady = 1
+	}
+	return sg
+}
+
+func (sg *sidecarGate) run(ctx context.Context) {
+	if len(sg.urls) == 0 {
+		return
+	}
+	log.Printf("Waiting for sidecars before reporting ready: %s", strings.Join(sg.urls, ", "))
+	ticker := time.NewTicker(sidecarCheckInterval)
+	defer ticker.Stop()
+	for {
+		sg.check(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (sg *sidecarGate) check(ctx context.Context) {
+	ready := int32(1)
+	for _, url := range sg.urls {
+		if err := sg.probe(ctx, url); err != nil {
+			if atomic.LoadInt32(&sg.allReady) == 1 {
+				log.Printf("Sidecar %s not ready: %v", url, err)
+			}
+			ready = 0
+			break
+		}
+	}
+	if atomic.SwapInt32(&sg.allReady, ready) != ready && ready == 1 {
+		log.Println("All sidecars are ready")
+	}
+}
+
+func (sg *sidecarGate) probe(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sg.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (sg *sidecarGate) ready() bool {
+	return atomic.LoadInt32(&sg.allReady) == 1
+}
@@ -0,0 +1,145 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/websocket"
+)
+
+const (
+	// statsInterval is how often /ws/stats pushes a frame.
+	statsInterval = time.Second
+	// statsRateWindow is the seconds the request rate of a frame averages,
+	// short so the dashboard follows load as it changes.
+	statsRateWindow = 5
+)
+
+// StatsFrame is a message of /ws/stats: a snapshot of the replica for live
+// dashboards.
+type StatsFrame struct {
+	Timestamp string `json:"timestamp"`
+	Pod       string `json:"pod"`
+	Version   string `json:"version"`
+	// Averaged over the last 5 seconds
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	InFlightRequests  int64   `json:"in_flight_requests"`
+	Goroutines        int     `json:"goroutines"`
+	HeapAllocBytes    uint64  `json:"heap_alloc_bytes"`
+	SysBytes          uint64  `json:"sys_bytes"`
+	UptimeSeconds     float64 `json:"uptime_seconds"`
+}
+
+// statsStream serves /ws/stats: a WebSocket pushing a StatsFrame every
+// second, or the current frame once to plain GET requests. Streams end
+// with a "going away" close when the pod drains or shuts down.
+type statsStream struct {
+	s    *Server
+	max  int64
+	open atomic.Int64
+
+	closeOnce sync.Once
+	closing   chan struct{}
+}
+
+func newStatsStream(s *Server) *statsStream {
+	return &statsStream{s: s, max: int64(s.cfg.WebSocketMaxConnections), closing: make(chan struct{})}
+}
+
+// frame returns the current stats, excluding the caller's own request from
+// those in flight.
+func (ss *statsStream) frame() StatsFrame {
+	s := ss.s
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	now := time.Now()
+	return StatsFrame{
+		Timestamp:         now.UTC().Format(time.RFC3339),
+		Pod:               s.cfg.Identity(),
+		Version:           s.cfg.Build.Version,
+		RequestsPerSecond: math.Round(s.rates.rate(now, statsRateWindow)*100) / 100,
+		InFlightRequests:  s.inFlight.Load() - 1,
+		Goroutines:        runtime.NumGoroutine(),
+		HeapAllocBytes:    mem.HeapAlloc,
+		SysBytes:          mem.Sys,
+		UptimeSeconds:     math.Round(now.Sub(handlers.StartTime).Seconds()*1000) / 1000,
+	}
+}
+
+func (ss *statsStream) handler(w http.ResponseWriter, r *http.Request) {
+	if !websocket.IsUpgrade(r) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(ss.frame()); err != nil {
+			log.Printf("Error encoding stats response: %v", err)
+		}
+		return
+	}
+	// Browsers send WebSocket handshakes to any origin; only the API's own
+	// and those CORS allows may open one.
+	if origin := r.Header.Get("Origin"); origin != "" && !sameOrigin(origin, r.Host) && !ss.s.cors.allows(origin) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.origin_not_allowed", origin), http.StatusForbidden)
+		return
+	}
+	if ss.open.Add(1) > ss.max {
+		ss.open.Add(-1)
+		w.Header().Set("Retry-After", "5")
+		problem.Error(w, r, i18n.T(r.Context(), "error.websocket_full"), http.StatusServiceUnavailable)
+		return
+	}
+	defer ss.open.Add(-1)
+	conn, err := websocket.Upgrade(w, r)
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		if ss.s.draining.Load() {
+			_ = conn.Close(websocket.CloseGoingAway, "draining")
+			return
+		}
+		if err := conn.WriteJSON(ss.frame()); err != nil {
+			_ = conn.Close(websocket.CloseGoingAway, "")
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-conn.Done():
+			return
+		case <-ss.closing:
+			_ = conn.Close(websocket.CloseGoingAway, "shutting down")
+			return
+		}
+	}
+}
+
+// close ends the open streams; the server doesn't track hijacked
+// connections, so its shutdown won't.
+func (ss *statsStream) close() {
+	ss.closeOnce.Do(func() { close(ss.closing) })
+}
+
+// connections returns the number of open streams.
+func (ss *statsStream) connections() int64 {
+	return ss.open.Load()
+}
+
+// sameOrigin reports whether origin names the host the request was sent
+// to.
+func sameOrigin(origin, host string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+//go:embed statuspage.html
+var statusPageHTML string
+
+var statusPageTemplate = template.Must(template.New("status").Parse(statusPageHTML))
+
+type statusPage struct {
+	Service     string
+	Environment string
+	Message     string
+	// Fields rendered from INFO_FIELDS
+	Fields     map[string]string
+	Language   string
+	Build      config.BuildInfo
+	Readiness  string
+	Pod        string
+	Namespace  string
+	PodIP      string
+	Node       string
+	Region     string
+	Zone       string
+	Deployment DeploymentStatusResponse
+	// Logged in user and the logout path; empty without a login
+	User       string
+	LogoutPath string
+}
+
+// statusPageHandler renders a status page for browsers, so a demo can be
+// followed without a separate frontend. It shows the same data as /api/info,
+// /readyz and /api/deployment. sess is the logged in user's session, nil
+// when the page needs no login.
+func (s *Server) statusPageHandler(w http.ResponseWriter, r *http.Request, sess *session) {
+	data := s.infoConfig().TemplateData()
+	page := statusPage{
+		Service:     s.cfg.ServiceName,
+		Environment: s.cfg.Environment,
+		Message:     s.welcomeMessage(r.Context(), data),
+		Fields:      s.infoFields(data),
+		Language:    w.Header().Get("Content-Language"),
+		Build:       s.cfg.Build,
+		Readiness:   s.readinessStatus(r.Context()),
+		Pod:         s.cfg.Identity(),
+		Namespace:   s.namespace,
+		PodIP:       s.cfg.PodIP,
+		Node:        s.cfg.NodeName,
+		Region:      data.Region,
+		Zone:        data.Zone,
+		Deployment:  s.deployWatcher.status(),
+	}
+	if sess != nil {
+		page.User, page.LogoutPath = sess.user(), logoutPath
+	}
+
+	// Render first so a template error doesn't leave a half-written page.
+	var buf bytes.Buffer
+	if err := statusPageTemplate.Execute(&buf, page); err != nil {
+		log.Printf("Error rendering status page: %v", err)
+		problem.Error(w, r, "error rendering status page", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if sess != nil {
+		// The page is the user's own; shared caches must not keep it.
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		log.Printf("Error writing status page: %v", err)
+	}
+}
+
+// acceptsHTML reports whether the client explicitly asks for HTML, as
+// browsers do. Clients sending */* or nothing, like curl, keep getting JSON.
+func acceptsHTML(r *http.Request) bool {
+	for _, accept := range r.Header.Values("Accept") {
+		for _, mediaRange := range strings.Split(accept, ",") {
+			mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+			if err != nil || mediaType != "text/html" {
+				continue
+			}
+			if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+				continue
+			}
+			return true
+		}
+	}
+	return false
+}
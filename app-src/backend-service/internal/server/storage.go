@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const storageCheckInterval = 15 * time.Second
+
+type VolumeStatus struct {
+	Path      string `json:"path"`
+	Writable  bool   `json:"writable"`
+	UsedBytes int64  `json:"used_bytes"`
+	FreeBytes uint64 `json:"free_bytes,omitempty"`
+	Healthy   bool   `json:"healthy"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt string `json:"checked_at"`
+}
+
+type EphemeralStorageStatus struct {
+	UsedBytes        int64    `json:"used_bytes"`
+	LimitBytes       int64    `json:"limit_bytes,omitempty"`
+	ThresholdPercent int64    `json:"threshold_percent"`
+	Utilization      *float64 `json:"utilization,omitempty"`
+	Healthy          bool     `json:"healthy"`
+}
+
+// storageMonitor verifies that the configured volumes (typically emptyDir
+// mounts, since the root filesystem is read-only) are writable, and that
+// their combined usage stays under a percentage of the container's
+// ephemeral-storage limit, so the pod leaves the Service before the kubelet
+// evicts it for exceeding the limit.
+type storageMonitor struct {
+	paths      []string
+	limitBytes int64
+	threshold  int64
+
+	mu      sync.RWMutex
+	volumes []VolumeStatus
+	usage   EphemeralStorageStatus
+	healthy bool
+}
+
+func newStorageMonitor(paths []string, limitBytes, thresholdPercent int64) *storageMonitor {
+	return &storageMonitor{
+		paths:      paths,
+		limitBytes: limitBytes,
+		threshold:  thresholdPercent,
+		volumes:    []VolumeStatus{},
+		healthy:    true,
+	}
+}
+
+func (sm *storageMonitor) run(ctx context.Context) {
+	if len(sm.paths) == 0 {
+		return
+	}
+	log.Printf("Checking volumes: %s", strings.Join(sm.paths, ", "))
+	ticker := time.NewTicker(storageCheckInterval)
+	defer ticker.Stop()
+	for {
+		sm.check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (sm *storageMonitor) check() {
+	now := time.Now().UTC().Format(time.RFC3339)
+	volumes := make([]VolumeStatus, 0, len(sm.paths))
+	healthy := true
+	var used int64
+	for _, path := range sm.paths {
+		vs := checkVolume(path)
+		vs.CheckedAt = now
+		if !vs.Healthy {
+			healthy = false
+		}
+		used += vs.UsedBytes
+		volumes = append(volumes, vs)
+	}
+
+	usage := EphemeralStorageStatus{UsedBytes: used, LimitBytes: sm.limitBytes, ThresholdPercent: sm.threshold, Healthy: true}
+	if sm.limitBytes > 0 {
+		usage.Utilization = ratio(float64(used), float64(sm.limitBytes))
+		if used*100 >= sm.limitBytes*sm.threshold {
+			usage.Healthy = false
+			healthy = false
+		}
+	}
+
+	sm.mu.Lock()
+	wasHealthy := sm.healthy
+	sm.volumes, sm.usage, sm.healthy = volumes, usage, healthy
+	sm.mu.Unlock()
+
+	switch {
+	case wasHealthy && !healthy:
+		log.Printf("Storage unhealthy: %d bytes used of %d limit, volumes: %+v", used, sm.limitBytes, volumes)
+	case !wasHealthy && healthy:
+		log.Println("Storage healthy again")
+	}
+}
+
+// checkVolume writes and removes a probe file and sums the size of the
+// files below path.
+func checkVolume(path string) VolumeStatus {
+	vs := VolumeStatus{Path: path}
+	probe, err := os.CreateTemp(path, ".write-check-*")
+	if err != nil {
+		vs.Error = err.Error()
+		return vs
+	}
+	_, werr := probe.WriteString("ok")
+	cerr := probe.Close()
+	os.Remove(probe.Name())
+	if werr != nil || cerr != nil {
+		vs.Error = "write failed"
+		return vs
+	}
+	vs.Writable = true
+
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err == nil {
+		vs.FreeBytes = uint64(st.Bavail) * uint64(st.Bsize)
+	}
+	vs.UsedBytes = diskUsage(path)
+	vs.Healthy = true
+	return vs
+}
+
+func diskUsage(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// ready reports whether every volume is writable and usage is under the threshold.
+func (sm *storageMonitor) ready() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.healthy
+}
+
+// err describes why storage is unhealthy, or is nil.
+func (sm *storageMonitor) err() error {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	if sm.healthy {
+		return nil
+	}
+	var problems []string
+	for _, vs := range sm.volumes {
+		if !vs.Healthy {
+			problems = append(problems, fmt.Sprintf("volume %s: %s", vs.Path, vs.Error))
+		}
+	}
+	if !sm.usage.Healthy {
+		problems = append(problems, fmt.Sprintf("%d bytes used, over %d%% of the %d byte limit",
+			sm.usage.UsedBytes, sm.threshold, sm.limitBytes))
+	}
+	if len(problems) == 0 {
+		return errors.New("storage unhealthy")
+	}
+	return errors.New(strings.Join(problems, "; "))
+}
+
+func (sm *storageMonitor) status() ([]VolumeStatus, EphemeralStorageStatus) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return append([]VolumeStatus{}, sm.volumes...), sm.usage
+}
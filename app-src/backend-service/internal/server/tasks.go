@@ -0,0 +1,245 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/validate"
+)
+
+// Task states. Succeeded, failed and cancelled are final.
+const (
+	taskQueued    = "queued"
+	taskRunning   = "running"
+	taskSucceeded = "succeeded"
+	taskFailed    = "failed"
+	taskCancelled = "cancelled"
+)
+
+// taskRetention is the number of finished tasks kept for polling.
+const taskRetention = 1000
+
+// taskHeartbeat is how often an idle event stream gets a comment line, so
+// proxies don't close it.
+const taskHeartbeat = 15 * time.Second
+
+type CreateTaskRequest struct {
+	// Simulated work, at most a minute
+	DurationMs int64 `json:"duration_ms" validate:"min=0,max=60000"`
+	// Fail makes the task end as failed, to demonstrate error handling
+	Fail bool `json:"fail"`
+}
+
+type TaskResponse struct {
+	ID         string `json:"id"`
+	Status     string `json:"status"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	StartedAt  string `json:"started_at,omitempty"`
+	FinishedAt string `json:"finished_at,omitempty"`
+	// Tasks only exist on the instance that accepted them
+	Hostname string `json:"hostname"`
+}
+
+func (t TaskResponse) done() bool {
+	return t.Status == taskSucceeded || t.Status == taskFailed || t.Status == taskCancelled
+}
+
+// taskStore tracks long-running tasks executed by the job workers, so
+// clients can submit work, get an ID back at once and poll or subscribe
+// for the outcome. Tasks live in memory on one instance; the oldest
+// finished ones are forgotten after taskRetention.
+type taskStore struct {
+	hostname string
+	jobs     *jobQueue
+
+	mu       sync.Mutex
+	tasks    map[string]*taskEntry
+	finished []string
+}
+
+type taskEntry struct {
+	task TaskResponse
+	// changed is closed and replaced on every update, waking subscribers.
+	changed chan struct{}
+}
+
+func newTaskStore(hostname string, jobs *jobQueue) *taskStore {
+	return &taskStore{hostname: hostname, jobs: jobs, tasks: make(map[string]*taskEntry)}
+}
+
+// create queues a task, failing when the job queue is full.
+func (ts *taskStore) create(req CreateTaskRequest) (TaskResponse, bool) {
+	task := TaskResponse{
+		ID:         newTaskID(),
+		Status:     taskQueued,
+		DurationMs: req.DurationMs,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339Nano),
+		Hostname:   ts.hostname,
+	}
+	ts.mu.Lock()
+	ts.tasks[task.ID] = &taskEntry{task: task, changed: make(chan struct{})}
+	ts.mu.Unlock()
+
+	ok := ts.jobs.submit(job{
+		duration: time.Duration(req.DurationMs) * time.Millisecond,
+		started: func() {
+			ts.update(task.ID, func(t *TaskResponse) {
+				t.Status, t.StartedAt = taskRunning, time.Now().UTC().Format(time.RFC3339Nano)
+			})
+		},
+		finished: func(err error) {
+			ts.update(task.ID, func(t *TaskResponse) {
+				t.FinishedAt = time.Now().UTC().Format(time.RFC3339Nano)
+				switch {
+				case err != nil:
+					t.Status, t.Error = taskCancelled, "interrupted by shutdown"
+				case req.Fail:
+					t.Status, t.Error = taskFailed, "simulated failure"
+				default:
+					t.Status = taskSucceeded
+				}
+			})
+		},
+	})
+	if !ok {
+		ts.mu.Lock()
+		delete(ts.tasks, task.ID)
+		ts.mu.Unlock()
+	}
+	return task, ok
+}
+
+func (ts *taskStore) update(id string, fn func(*TaskResponse)) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	e, ok := ts.tasks[id]
+	if !ok {
+		return
+	}
+	fn(&e.task)
+	close(e.changed)
+	e.changed = make(chan struct{})
+	if !e.task.done() {
+		return
+	}
+	ts.finished = append(ts.finished, id)
+	if len(ts.finished) > taskRetention {
+		delete(ts.tasks, ts.finished[0])
+		ts.finished = ts.finished[1:]
+	}
+}
+
+// get returns the task and a channel closed on its next change.
+func (ts *taskStore) get(id string) (TaskResponse, <-chan struct{}, bool) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	e, ok := ts.tasks[id]
+	if !ok {
+		return TaskResponse{}, nil, false
+	}
+	return e.task, e.changed, true
+}
+
+func newTaskID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// createHandler accepts POST {"duration_ms": 5000} and answers 202 with
+// the queued task and its URL in Location.
+func (ts *taskStore) createHandler(w http.ResponseWriter, r *http.Request) {
+	req := CreateTaskRequest{DurationMs: 5000}
+	if err := validate.DecodeJSON(w, r, &req, 1<<10); err != nil {
+		validate.WriteError(w, r, err)
+		return
+	}
+	task, ok := ts.create(req)
+	if !ok {
+		problem.Error(w, r, i18n.T(r.Context(), "error.queue_full"), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Location", apiV1Prefix+"/tasks/"+task.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(task); err != nil {
+		log.Printf("Error encoding task response: %v", err)
+	}
+}
+
+func (ts *taskStore) getHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	task, _, ok := ts.get(id)
+	if !ok {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", "task "+id), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(task); err != nil {
+		log.Printf("Error encoding task response: %v", err)
+	}
+}
+
+// eventsHandler streams the task as Server-Sent Events: one "task" event
+// with its current state, one per change, and the stream ends once the
+// task is finished.
+func (ts *taskStore) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	task, changed, ok := ts.get(id)
+	if !ok {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", "task "+id), http.StatusNotFound)
+		return
+	}
+	rc := http.NewResponseController(w)
+	// The stream lasts as long as the task, past the server's WriteTimeout.
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	heartbeat := time.NewTicker(taskHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		data, err := json.Marshal(task)
+		if err != nil {
+			log.Printf("Error encoding task event: %v", err)
+			return
+		}
+		if _, err := fmt.Fprintf(w, "event: task\ndata: %s\n\n", data); err != nil {
+			return
+		}
+		_ = rc.Flush()
+		if task.done() {
+			return
+		}
+	wait:
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+				_ = rc.Flush()
+			case <-changed:
+				break wait
+			}
+		}
+		if task, changed, ok = ts.get(id); !ok {
+			return
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// certPollInterval is how often the certificate files are checked. The
+// kubelet refreshes a mounted Secret within a minute or so of cert-manager
+// renewing it, so a poll is quick enough and needs no inotify.
+const certPollInterval = 10 * time.Second
+
+// certReloader serves the certificate and key in certFile and keyFile, and
+// swaps in a new pair when the files change, so a rotated certificate is
+// used for new connections without a restart.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	notAfter time.Time
+	stamp    string
+}
+
+// newCertReloader loads the pair once; it fails when the files are missing
+// or don't match, so a broken Secret stops the pod at startup.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	cr := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := cr.reload(); err != nil {
+		return nil, err
+	}
+	return cr, nil
+}
+
+// fileStamp changes whenever either file is replaced. Stat follows the
+// ..data symlink the kubelet swaps atomically on a Secret update.
+func (cr *certReloader) fileStamp() (string, error) {
+	var stamp string
+	for _, name := range []string{cr.certFile, cr.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp, nil
+}
+
+// reload loads the pair if the files changed since the last load and
+// reports whether it did. On error the current certificate stays in use.
+func (cr *certReloader) reload() (bool, error) {
+	stamp, err := cr.fileStamp()
+	if err != nil {
+		return false, err
+	}
+	cr.mu.RLock()
+	unchanged := stamp == cr.stamp
+	cr.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("loading certificate %s: %w", cr.certFile, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("parsing certificate %s: %w", cr.certFile, err)
+	}
+	cr.mu.Lock()
+	cr.cert, cr.notAfter, cr.stamp = &cert, leaf.NotAfter, stamp
+	cr.mu.Unlock()
+	log.Printf("Loaded TLS certificate for %v, valid until %s", leaf.DNSNames, leaf.NotAfter.UTC().Format(time.RFC3339))
+	return true, nil
+}
+
+// getCertificate is the tls.Config callback, so every handshake picks up the
+// latest certificate.
+func (cr *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// expiry is when the certificate in use expires.
+func (cr *certReloader) expiry() time.Time {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.notAfter
+}
+
+func (cr *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: cr.getCertificate}
+}
+
+// run polls the files until ctx ends. A half-written pair fails to load and
+// is retried on the next tick.
+func (cr *certReloader) run(ctx context.Context) {
+	if cr == nil {
+		return
+	}
+	ticker := time.NewTicker(certPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := cr.reload(); err != nil {
+			log.Printf("Error reloading TLS certificate, keeping the current one: %v", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+)
+
+// Well-known node labels, with the pre-1.17 beta labels as fallback.
+var (
+	regionLabels = []string{"topology.kubernetes.io/region", "failure-domain.beta.kubernetes.io/region"}
+	zoneLabels   = []string{"topology.kubernetes.io/zone", "failure-domain.beta.kubernetes.io/zone"}
+)
+
+type node struct {
+	Metadata k8sclient.ObjectMeta `json:"metadata"`
+}
+
+// nodeTopology caches the region and zone of the node this pod runs on, so
+// traffic distribution across zones can be shown during multi-zone rollouts.
+type nodeTopology struct {
+	client   *k8sclient.Client
+	nodeName string
+
+	mu     sync.RWMutex
+	region string
+	zone   string
+}
+
+func newNodeTopology(client *k8sclient.Client, nodeName string) *nodeTopology {
+	return &nodeTopology{client: client, nodeName: nodeName}
+}
+
+// run fetches the node labels, retrying until it succeeds or ctx is done.
+// Topology labels don't change while a pod is scheduled, so one read is enough.
+func (nt *nodeTopology) run(ctx context.Context) {
+	if nt.client == nil || nt.nodeName == "" {
+		return
+	}
+	for {
+		var n node
+		err := nodeInformer(nt.client, nt.nodeName).GetOrFetch(ctx, nt.nodeName, &n)
+		if err == nil {
+			nt.mu.Lock()
+			nt.region = firstLabel(n.Metadata.Labels, regionLabels)
+			nt.zone = firstLabel(n.Metadata.Labels, zoneLabels)
+			nt.mu.Unlock()
+			log.Printf("Node %s topology: region=%q zone=%q", nt.nodeName, nt.region, nt.zone)
+			return
+		}
+		log.Printf("Error getting node %s: %v", nt.nodeName, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+// get returns the cached region and zone; both are empty until resolved.
+func (nt *nodeTopology) get() (region, zone string) {
+	nt.mu.RLock()
+	defer nt.mu.RUnlock()
+	return nt.region, nt.zone
+}
+
+func firstLabel(labels map[string]string, keys []string) string {
+	for _, key := range keys {
+		if v := labels[key]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
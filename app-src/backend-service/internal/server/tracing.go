@@ -0,0 +1,39 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/requestid"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+	"github.com/anasadan/gitops-demo/backend-service/internal/tracing"
+)
+
+// traceMiddleware serves each request in a server span, continuing the
+// caller's trace when the request carries a traceparent header. Outbound
+// calls made with the request context join the same trace.
+func (s *Server) traceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote, _ := tracing.Extract(r.Header)
+		ctx, span := s.tracer.Start(r.Context(), r.Method, tracing.KindServer, remote)
+		defer span.End()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("client.address", r.RemoteAddr)
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttribute("http.request.header.x-request-id", id)
+		}
+		if route, ok := router.RouteFromContext(ctx); ok {
+			// Span names use the route pattern, not the path, to keep
+			// their number bounded.
+			span.SetName(r.Method + " " + route.Pattern)
+			span.SetAttribute("http.route", route.Pattern)
+		}
+
+		tw := &trackingWriter{ResponseWriter: w}
+		next.ServeHTTP(tw, r.WithContext(ctx))
+		span.SetAttribute("http.response.status_code", tw.status())
+		if tw.status() >= 500 {
+			span.SetError(http.StatusText(tw.status()))
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/artifact"
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/router"
+)
+
+// uploadField is the multipart form field holding the file.
+const uploadField = "file"
+
+// uploadOverhead is the room left for multipart headers and other form
+// fields on top of the file size limit.
+const uploadOverhead = 64 << 10
+
+// uploadTimeout bounds an upload, past the server's ReadTimeout and
+// WriteTimeout: large files on slow links take longer than ordinary
+// requests, and the response is only written once the file is read.
+const uploadTimeout = time.Minute
+
+// UploadResponse is the stored artifact and the URL it is retrieved from.
+type UploadResponse struct {
+	artifact.Artifact
+	URL string `json:"url"`
+}
+
+// uploadHandler accepts a multipart/form-data POST with the file in the
+// "file" field and streams it into the artifact store part by part, so
+// memory use doesn't grow with the file. It answers 201 with the artifact
+// and its URL in Location.
+func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if !s.uploads.Enabled() {
+		problem.Error(w, r, i18n.T(ctx, "error.upload_disabled"), http.StatusServiceUnavailable)
+		return
+	}
+	maxBytes := s.uploads.MaxBytes()
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Now().Add(uploadTimeout))
+	// A little longer, so the answer of a timed-out upload still gets out.
+	_ = rc.SetWriteDeadline(time.Now().Add(uploadTimeout + 5*time.Second))
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes+uploadOverhead)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		problem.Error(w, r, i18n.T(ctx, "error.upload_multipart", uploadField), http.StatusUnsupportedMediaType)
+		return
+	}
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			problem.Error(w, r, i18n.T(ctx, "error.upload_multipart", uploadField), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.uploadError(w, r, err)
+			return
+		}
+		if part.FormName() != uploadField || part.FileName() == "" {
+			continue
+		}
+
+		mediaType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		if !slices.Contains(s.cfg.UploadAllowedTypes, mediaType) {
+			problem.Error(w, r, i18n.T(ctx, "error.upload_type", mediaType, strings.Join(s.cfg.UploadAllowedTypes, ", ")),
+				http.StatusUnsupportedMediaType)
+			return
+		}
+		art, err := s.uploads.Put(part.FileName(), mediaType, part)
+		if err != nil {
+			s.uploadError(w, r, err)
+			return
+		}
+		log.Printf("Stored upload %s (%s, %d bytes)", art.ID, mediaType, art.Bytes)
+
+		resp := UploadResponse{Artifact: art, URL: apiV1Prefix + "/upload/" + art.ID}
+		w.Header().Set("Location", resp.URL)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding upload response: %v", err)
+		}
+		return
+	}
+}
+
+func (s *Server) uploadError(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, artifact.ErrTooLarge), errors.As(err, &tooLarge):
+		problem.Error(w, r, i18n.T(ctx, "error.upload_too_large", s.uploads.MaxBytes()), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, artifact.ErrFull):
+		problem.Error(w, r, i18n.T(ctx, "error.upload_full"), http.StatusInsufficientStorage)
+	default:
+		log.Printf("Error storing upload: %v", err)
+		problem.Error(w, r, i18n.T(ctx, "error.read_body", err), http.StatusBadRequest)
+	}
+}
+
+// uploadedHandler serves a stored artifact. It is always sent as an
+// attachment with its stored type, never sniffed, so an uploaded HTML file
+// can't run as a page of this origin.
+func (s *Server) uploadedHandler(w http.ResponseWriter, r *http.Request) {
+	id := router.Param(r, "id")
+	art, f, err := s.uploads.Open(id)
+	if errors.Is(err, fs.ErrNotExist) {
+		problem.Error(w, r, i18n.T(r.Context(), "error.not_found", "upload "+id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		problem.Error(w, r, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", art.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(art.Bytes, 10))
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": art.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+art.SHA256+`"`)
+	if _, err := io.Copy(w, f); err != nil {
+		log.Printf("Error sending upload %s: %v", id, err)
+	}
+}
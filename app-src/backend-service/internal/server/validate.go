@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+)
+
+// Validate checks cfg the way startup would, without listening or starting
+// any background work, for `backend-service -dry-run` in an init container
+// or a CI job. Values that didn't parse fail the report here, although the
+// service itself starts with their defaults. With checkDeps it also reaches
+// out to the Kubernetes API, the sibling Services, sidecars, the registry
+// and the NTP server.
+func Validate(ctx context.Context, cfg config.Config, checkDeps bool) SelftestResponse {
+	st := &selftest{cfg: cfg}
+	var s *Server
+	checks := []check{
+		{"environment", checkEnvironment},
+		{"config", st.checkConfig},
+		{"components", func(context.Context) (string, string) {
+			var err error
+			if s, err = NewServer(cfg); err != nil {
+				return checkFail, err.Error()
+			}
+			return checkPass, ""
+		}},
+		{"temp-dir", checkTempDir},
+	}
+	if checkDeps {
+		checks = append(checks,
+			check{"kubernetes", func(ctx context.Context) (string, string) {
+				if s == nil {
+					return checkSkip, "components failed"
+				}
+				return checkKubernetes(ctx, s)
+			}},
+			check{"dependencies", func(ctx context.Context) (string, string) {
+				if s == nil {
+					return checkSkip, "components failed"
+				}
+				if len(cfg.SiblingServices) > 0 {
+					if err := s.discovery.list(ctx); err != nil {
+						return checkFail, fmt.Sprintf("listing services: %v", err)
+					}
+				}
+				st.discovery = s.discovery
+				return st.checkDependencies(ctx)
+			}},
+			check{"clock", st.checkClock},
+		)
+	}
+	return runChecks(ctx, checks)
+}
+
+// checkEnvironment reports variables that were set but didn't parse.
+func checkEnvironment(context.Context) (string, string) {
+	if invalid := config.Invalid(); len(invalid) > 0 {
+		return checkFail, strings.Join(invalid, "; ")
+	}
+	return checkPass, ""
+}
+
+// checkKubernetes asks the API server for its version, which any
+// authenticated client may do.
+func checkKubernetes(ctx context.Context, s *Server) (string, string) {
+	if s.kube == nil {
+		return checkSkip, "no Kubernetes features enabled"
+	}
+	var version struct {
+		GitVersion string `json:"gitVersion"`
+	}
+	if err := s.kube.Do(ctx, http.MethodGet, "/version", nil, &version); err != nil {
+		return checkFail, err.Error()
+	}
+	return checkPass, fmt.Sprintf("%s at %s", version.GitVersion, s.kube.Host())
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// webhookMaxBytes bounds the bodies of webhooks; notifications are small.
+const webhookMaxBytes = 1 << 20
+
+// signatureHashes are the hash functions signatures may name, as in
+// "sha256=<hex>".
+var signatureHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// validSignature reports whether signature, of the form "sha256=<hex>", is
+// the HMAC of body with secret.
+func validSignature(secret, signature string, body []byte) bool {
+	algorithm, digest, ok := strings.Cut(signature, "=")
+	newHash := signatureHashes[strings.ToLower(algorithm)]
+	if !ok || newHash == nil {
+		return false
+	}
+	want, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(newHash, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), want)
+}
+
+// readSignedWebhook reads the body of a webhook signed with secret in the
+// given header and writes the error response when the signature is missing
+// or wrong. Senders that can't sign, like Argo CD's notifications and
+// GitLab, may send the secret itself instead, as a bearer token or in
+// X-Gitlab-Token.
+func readSignedWebhook(w http.ResponseWriter, r *http.Request, secret, header string) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, webhookMaxBytes))
+	if err != nil {
+		problem.Error(w, r, i18n.T(r.Context(), "error.webhook_payload", err), http.StatusBadRequest)
+		return nil, false
+	}
+	if signature := r.Header.Get(header); signature != "" {
+		if validSignature(secret, signature, body) {
+			return body, true
+		}
+	} else if token := webhookToken(r); token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(secret)) == 1 {
+		return body, true
+	}
+	p := problem.New(http.StatusUnauthorized, i18n.T(r.Context(), "error.webhook_signature"))
+	p.Type, p.Title = problem.TypeUnauthorized, "Webhook signature required"
+	problem.Write(w, r, p)
+	return nil, false
+}
+
+// webhookToken returns the secret a request sent in place of a signature.
+func webhookToken(r *http.Request) string {
+	if token := r.Header.Get("X-Gitlab-Token"); token != "" {
+		return token
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token
+	}
+	return ""
+}
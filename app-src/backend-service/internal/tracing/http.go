@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Extract returns the span context of an incoming traceparent header.
+func Extract(h http.Header) (SpanContext, bool) {
+	return ParseTraceparent(h.Get(TraceparentHeader))
+}
+
+// Inject sets the traceparent header to sc.
+func Inject(h http.Header, sc SpanContext) {
+	h.Set(TraceparentHeader, sc.Traceparent())
+}
+
+// Transport wraps base, http.DefaultTransport when nil, so requests made
+// with a context carrying a span get a client span and a traceparent
+// header. Requests without one, such as background polling, pass through
+// untouched rather than starting traces of their own.
+func (t *Tracer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{tracer: t, base: base}
+}
+
+type transport struct {
+	tracer *Tracer
+	base   http.RoundTripper
+}
+
+func (tr *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if SpanFromContext(req.Context()) == nil {
+		return tr.base.RoundTrip(req)
+	}
+	ctx, span := tr.tracer.Start(req.Context(), req.Method, KindClient, SpanContext{})
+	defer span.End()
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.Redacted())
+	span.SetAttribute("server.address", req.URL.Hostname())
+
+	// RoundTrippers must not modify the caller's request.
+	req = req.Clone(ctx)
+	Inject(req.Header, span.Context())
+	resp, err := tr.base.RoundTrip(req)
+	if err != nil {
+		span.SetError(err.Error())
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 400 {
+		span.SetError(resp.Status)
+	}
+	return resp, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
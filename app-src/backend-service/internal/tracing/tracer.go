@@ -0,0 +1,272 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// queueSize bounds the spans waiting for export; when the collector
+	// can't keep up, new spans are dropped rather than slowing requests.
+	queueSize = 2048
+	// batchSize and flushInterval bound how long a span waits for export.
+	batchSize     = 512
+	flushInterval = 5 * time.Second
+	// shutdownTimeout bounds the final flush.
+	shutdownTimeout = 5 * time.Second
+)
+
+// Config configures a Tracer.
+type Config struct {
+	// Endpoint is the OTLP/HTTP traces URL, e.g.
+	// http://otel-collector:4318/v1/traces. Empty disables export, while
+	// trace context is still propagated.
+	Endpoint       string
+	ServiceName    string
+	ServiceVersion string
+	// Attributes describe the resource, e.g. the pod and namespace.
+	Attributes map[string]string
+	// SamplePercent of the traces that start here are exported. Incoming
+	// trace context keeps the caller's decision.
+	SamplePercent int64
+	Client        *http.Client
+}
+
+// Tracer starts spans and exports the sampled ones in the background.
+type Tracer struct {
+	cfg      Config
+	queue    chan *Span
+	dropped  atomic.Int64
+	exported atomic.Int64
+}
+
+func NewTracer(cfg Config) *Tracer {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &Tracer{cfg: cfg, queue: make(chan *Span, queueSize)}
+}
+
+// Enabled reports whether spans are exported.
+func (t *Tracer) Enabled() bool {
+	return t.cfg.Endpoint != ""
+}
+
+// Start starts a span that is a child of the span in ctx, or of remote
+// when ctx has none and remote is valid, and a new trace otherwise. The
+// returned context carries the span.
+func (t *Tracer) Start(ctx context.Context, name string, kind Kind, remote SpanContext) (context.Context, *Span) {
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	switch parent := SpanFromContext(ctx); {
+	case parent != nil:
+		span.sc.TraceID, span.sc.Sampled, span.parent = parent.sc.TraceID, parent.sc.Sampled, parent.sc.SpanID
+	case remote.IsValid():
+		span.sc.TraceID, span.sc.Sampled, span.parent = remote.TraceID, remote.Sampled, remote.SpanID
+	default:
+		span.sc.TraceID = newTraceID()
+		span.sc.Sampled = sampledID(span.sc.TraceID, t.cfg.SamplePercent)
+	}
+	span.sc.SpanID = newSpanID()
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	if !t.Enabled() {
+		return
+	}
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// Run exports queued spans in batches until ctx ends, then flushes what is
+// left.
+func (t *Tracer) Run(ctx context.Context) {
+	if !t.Enabled() {
+		return
+	}
+	log.Printf("Exporting %d%% of new traces to %s", t.cfg.SamplePercent, t.cfg.Endpoint)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	batch := make([]*Span, 0, batchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.export(ctx, batch); err != nil {
+			t.dropped.Add(int64(len(batch)))
+			log.Printf("Error exporting %d spans: %v", len(batch), err)
+		} else {
+			t.exported.Add(int64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span := <-t.queue:
+			if batch = append(batch, span); len(batch) == batchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			defer cancel()
+			for {
+				select {
+				case span := <-t.queue:
+					if batch = append(batch, span); len(batch) == batchSize {
+						flush(shutdownCtx)
+					}
+				default:
+					flush(shutdownCtx)
+					if dropped := t.dropped.Load(); dropped > 0 {
+						log.Printf("Dropped %d spans since startup", dropped)
+					}
+					return
+				}
+			}
+		}
+	}
+}
+
+func (t *Tracer) export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(t.payload(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.cfg.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("collector answered %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// OTLP JSON encoding of an ExportTraceServiceRequest. IDs are hex strings
+// and 64-bit integers decimal strings, as the OTLP/HTTP spec requires.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+)
+
+// statusError is the OTLP STATUS_CODE_ERROR.
+const statusError = 2
+
+func (t *Tracer) payload(spans []*Span) otlpRequest {
+	resource := []otlpAttribute{
+		attr("service.name", t.cfg.ServiceName),
+		attr("service.version", t.cfg.ServiceVersion),
+	}
+	for _, key := range sortedKeys(t.cfg.Attributes) {
+		resource = append(resource, attr(key, t.cfg.Attributes[key]))
+	}
+	out := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+		}
+		if s.parent != (SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parent[:])
+		}
+		for _, a := range s.attrs {
+			span.Attributes = append(span.Attributes, attr(a.key, a.value))
+		}
+		if s.failed {
+			span.Status = otlpStatus{Code: statusError, Message: s.errorMsg}
+		}
+		out[i] = span
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: resource},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: t.cfg.ServiceName}, Spans: out}},
+	}}}
+}
+
+func attr(key string, value any) otlpAttribute {
+	var v otlpValue
+	switch value := value.(type) {
+	case string:
+		v.StringValue = &value
+	case bool:
+		v.BoolValue = &value
+	case int:
+		s := strconv.Itoa(value)
+		v.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(value, 10)
+		v.IntValue = &s
+	case float64:
+		v.DoubleValue = &value
+	default:
+		s := fmt.Sprint(value)
+		v.StringValue = &s
+	}
+	return otlpAttribute{Key: key, Value: v}
+}
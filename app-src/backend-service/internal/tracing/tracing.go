@@ -0,0 +1,168 @@
+// Package tracing records spans of the requests the service serves and the
+// calls it makes, propagates them in W3C traceparent headers and exports
+// sampled spans to an OpenTelemetry collector with OTLP over HTTP, in its
+// JSON encoding. Like the pushgateway package it speaks the wire format
+// itself, so the module needs no SDK.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// TraceparentHeader carries the span context between services.
+const TraceparentHeader = "traceparent"
+
+// Kind is the OTLP span kind.
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+// SpanContext identifies a span across process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether neither ID is all zeros, which the W3C spec
+// forbids.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// Traceparent formats sc as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceparent parses a traceparent header value. Versions after 00 are
+// read as 00, as the spec asks, and may append fields.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || !isHex(parts[0], 2) || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) ||
+		!isHex(parts[1], 32) || !isHex(parts[2], 16) || !isHex(parts[3], 2) {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	_, _ = hex.Decode(sc.TraceID[:], []byte(parts[1]))
+	_, _ = hex.Decode(sc.SpanID[:], []byte(parts[2]))
+	flags, _ := hex.DecodeString(parts[3])
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// isHex reports whether s is n lowercase hex digits.
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// Span is one timed operation. It isn't safe for concurrent use; the
+// goroutine that started it sets its attributes and ends it.
+type Span struct {
+	tracer   *Tracer
+	sc       SpanContext
+	parent   SpanID
+	name     string
+	kind     Kind
+	start    time.Time
+	end      time.Time
+	attrs    []attribute
+	errorMsg string
+	failed   bool
+}
+
+type attribute struct {
+	key   string
+	value any
+}
+
+// Context is the span's identity, for propagation.
+func (s *Span) Context() SpanContext {
+	return s.sc
+}
+
+// SetName renames the span, e.g. once the route of a request is known.
+func (s *Span) SetName(name string) {
+	s.name = name
+}
+
+// SetAttribute records a string, bool, int, int64 or float64 attribute.
+func (s *Span) SetAttribute(key string, value any) {
+	s.attrs = append(s.attrs, attribute{key, value})
+}
+
+// SetError marks the span as failed.
+func (s *Span) SetError(msg string) {
+	s.failed, s.errorMsg = true, msg
+}
+
+// End records the span's end time and queues it for export if it was
+// sampled.
+func (s *Span) End() {
+	s.end = time.Now()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns ctx carrying span as the parent of spans started
+// from it.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the current span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// sampledID decides a root span's sampling from its trace ID, so every
+// service with the same percentage agrees on the same traces.
+func sampledID(id TraceID, percent int64) bool {
+	return binary.BigEndian.Uint64(id[8:])%100 < uint64(percent)
+}
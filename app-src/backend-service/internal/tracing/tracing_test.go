@@ -0,0 +1,110 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	const valid = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(valid)
+	if !ok || !sc.Sampled || sc.Traceparent() != valid {
+		t.Errorf("ParseTraceparent(%q) = %+v, %t", valid, sc, ok)
+	}
+	if sc, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future"); !ok || sc.Sampled {
+		t.Errorf("a later version with extra fields = %+v, %t", sc, ok)
+	}
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		if _, ok := ParseTraceparent(invalid); ok {
+			t.Errorf("ParseTraceparent(%q) accepted", invalid)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpRequest
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" ||
+			json.NewDecoder(r.Body).Decode(&req) != nil {
+			http.Error(w, "bad export", http.StatusBadRequest)
+		}
+		received <- req
+	}))
+	defer collector.Close()
+
+	// The callee sees the caller's trace and span as its parent.
+	var gotHeader string
+	callee := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Get(TraceparentHeader)
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer callee.Close()
+
+	tracer := NewTracer(Config{Endpoint: collector.URL + "/v1/traces", ServiceName: "svc", SamplePercent: 0})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracer.Run(ctx)
+		close(done)
+	}()
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	reqCtx, server := tracer.Start(context.Background(), "GET /x", KindServer, remote)
+	client := &http.Client{Transport: tracer.Transport(nil)}
+	req, _ := http.NewRequestWithContext(reqCtx, http.MethodGet, callee.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	server.SetAttribute("http.response.status_code", 200)
+	server.End()
+
+	// A new trace at 0% is not exported.
+	_, unsampled := tracer.Start(context.Background(), "GET /y", KindServer, SpanContext{})
+	unsampled.End()
+	cancel()
+	<-done
+
+	sent, ok := ParseTraceparent(gotHeader)
+	if !ok || sent.TraceID != remote.TraceID || !sent.Sampled || sent.SpanID == server.Context().SpanID {
+		t.Errorf("callee got traceparent %q", gotHeader)
+	}
+
+	var export otlpRequest
+	select {
+	case export = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("nothing exported on shutdown")
+	}
+	spans := export.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("exported %d spans, want the client and server spans: %+v", len(spans), spans)
+	}
+	clientSpan, serverSpan := spans[0], spans[1]
+	if serverSpan.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || serverSpan.ParentSpanID != "00f067aa0ba902b7" ||
+		serverSpan.Kind != KindServer || serverSpan.Name != "GET /x" {
+		t.Errorf("server span = %+v", serverSpan)
+	}
+	if clientSpan.ParentSpanID != serverSpan.SpanID || clientSpan.Kind != KindClient || clientSpan.Status.Code != statusError {
+		t.Errorf("client span = %+v", clientSpan)
+	}
+	if res := export.ResourceSpans[0].Resource.Attributes; res[0].Key != "service.name" || *res[0].Value.StringValue != "svc" {
+		t.Errorf("resource = %+v", res)
+	}
+}
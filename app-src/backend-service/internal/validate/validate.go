@@ -0,0 +1,284 @@
+// Package validate decodes JSON bodies and query parameters into typed
+// request structs and checks them against their `validate` struct tags,
+// reporting every invalid field at once.
+//
+// Supported rules, comma-separated:
+//
+//	required   the field must not be the zero value (or nil)
+//	min=N      numbers at least N; strings, slices and maps at least N long
+//	max=N      numbers at most N; strings, slices and maps at most N long
+//	oneof=a b  the value must be one of the space-separated options
+//
+// Nil pointers skip every rule but required. Query parameters are mapped
+// with a `query:"name"` tag.
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/i18n"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+// FieldError describes one invalid field. Field is the JSON (or query)
+// name, dotted for nested fields; "body" for a body that isn't valid JSON.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error lists the invalid fields of a request.
+type Error struct {
+	Fields []FieldError
+}
+
+func (e *Error) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		parts = append(parts, f.Field+": "+f.Message)
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// Struct checks v, a struct or pointer to one, against its tags. Messages
+// are localized for ctx.
+func Struct(ctx context.Context, v any) error {
+	var fields []FieldError
+	checkStruct(ctx, reflect.Indirect(reflect.ValueOf(v)), "", &fields)
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return nil
+}
+
+// DecodeJSON decodes the JSON body of r into dst, reading at most maxBytes,
+// and validates it. An empty body leaves dst as it is, so callers can
+// prefill defaults.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any, maxBytes int64) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBytes))
+	if err := dec.Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+		ctx := r.Context()
+		var typeErr *json.UnmarshalTypeError
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return &Error{Fields: []FieldError{{Field: typeErr.Field, Message: typeMessage(ctx, typeErr.Type)}}}
+		case errors.As(err, &tooLarge):
+			return &Error{Fields: []FieldError{{Field: "body", Message: i18n.T(ctx, "validation.too_large", tooLarge.Limit)}}}
+		default:
+			return &Error{Fields: []FieldError{{Field: "body", Message: i18n.T(ctx, "validation.json", err)}}}
+		}
+	}
+	return Struct(r.Context(), dst)
+}
+
+// DecodeQuery sets the fields of dst, a pointer to a struct, from the query
+// parameters named by their `query` tags, and validates it. Parameters that
+// are absent leave their field as it is.
+func DecodeQuery(r *http.Request, dst any) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	var fields []FieldError
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("query")
+		if name == "" || !query.Has(name) {
+			continue
+		}
+		if err := setString(v.Field(i), query.Get(name)); err != nil {
+			fields = append(fields, FieldError{Field: name, Message: typeMessage(ctx, v.Field(i).Type())})
+		}
+	}
+	if len(fields) > 0 {
+		return &Error{Fields: fields}
+	}
+	return Struct(ctx, dst)
+}
+
+// WriteError answers an invalid request with a 400 invalid-request problem
+// listing the field errors. Errors other than *Error are reported as a
+// whole.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	fields := []FieldError{{Field: "body", Message: err.Error()}}
+	var verr *Error
+	if errors.As(err, &verr) {
+		fields = verr.Fields
+	}
+	p := problem.New(http.StatusBadRequest, i18n.T(r.Context(), "error.validation"))
+	p.Type, p.Title = problem.TypeInvalidRequest, "Invalid request"
+	for _, f := range fields {
+		p.InvalidParams = append(p.InvalidParams, problem.InvalidParam{Name: f.Field, Reason: f.Message})
+	}
+	problem.Write(w, r, p)
+}
+
+func checkStruct(ctx context.Context, v reflect.Value, prefix string, fields *[]FieldError) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		name := fieldName(sf)
+		if name == "-" {
+			continue
+		}
+		path := prefix + name
+		fv := v.Field(i)
+		if msg := checkField(ctx, fv, sf.Tag.Get("validate")); msg != "" {
+			*fields = append(*fields, FieldError{Field: path, Message: msg})
+			continue
+		}
+		if inner := reflect.Indirect(fv); inner.Kind() == reflect.Struct {
+			checkStruct(ctx, inner, path+".", fields)
+		}
+	}
+}
+
+// checkField returns the message of the first rule v breaks, "" if none.
+func checkField(ctx context.Context, v reflect.Value, tag string) string {
+	if tag == "" {
+		return ""
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		if name == "required" {
+			if v.IsZero() {
+				return i18n.T(ctx, "validation.required")
+			}
+			continue
+		}
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return ""
+			}
+			v = v.Elem()
+		}
+		switch name {
+		case "min", "max":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic(fmt.Sprintf("validate: invalid %s rule %q", name, rule))
+			}
+			value, isLength := measure(v)
+			if (name == "min" && value < limit) || (name == "max" && value > limit) {
+				key := "validation." + name
+				if isLength {
+					key += "_length"
+				}
+				return i18n.T(ctx, key, arg)
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			value := fmt.Sprint(v.Interface())
+			found := false
+			for _, o := range options {
+				found = found || o == value
+			}
+			if !found {
+				return i18n.T(ctx, "validation.oneof", strings.Join(options, ", "))
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q", rule))
+		}
+	}
+	return ""
+}
+
+// measure returns the number min and max compare: the value of a number,
+// the length of anything else.
+func measure(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), false
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint()), false
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), false
+	case reflect.String:
+		return float64(len([]rune(v.String()))), true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(v.Len()), true
+	}
+	panic(fmt.Sprintf("validate: min/max on %s", v.Kind()))
+}
+
+func setString(v reflect.Value, raw string) error {
+	if v.Kind() == reflect.Pointer {
+		elem := reflect.New(v.Type().Elem())
+		if err := setString(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(raw, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	default:
+		panic(fmt.Sprintf("validate: unsupported query field type %s", v.Type()))
+	}
+	return nil
+}
+
+// typeMessage describes the values a field of type t accepts.
+func typeMessage(ctx context.Context, t reflect.Type) string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return i18n.T(ctx, "validation.integer")
+	case reflect.Float32, reflect.Float64:
+		return i18n.T(ctx, "validation.number")
+	case reflect.Bool:
+		return i18n.T(ctx, "validation.boolean")
+	case reflect.String:
+		return i18n.T(ctx, "validation.string")
+	}
+	return i18n.T(ctx, "validation.type", t.Kind().String())
+}
+
+func fieldName(sf reflect.StructField) string {
+	if name := sf.Tag.Get("query"); name != "" {
+		return name
+	}
+	if name, _, _ := strings.Cut(sf.Tag.Get("json"), ","); name != "" {
+		return name
+	}
+	return sf.Name
+}
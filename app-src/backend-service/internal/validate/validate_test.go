@@ -0,0 +1,151 @@
+package validate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type createRequest struct {
+	Name     string   `json:"name" validate:"required,max=8"`
+	Replicas int      `json:"replicas" validate:"min=1,max=10"`
+	Ratio    *float64 `json:"ratio,omitempty" validate:"min=0,max=1"`
+	Tier     string   `json:"tier" validate:"oneof=dev staging prod"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Address  *address `json:"address"`
+	Billing  address  `json:"billing"`
+	internal string   // unexported, skipped
+	Skipped  int      `json:"-" validate:"min=5"`
+}
+
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var verr *Error
+	if !errors.As(err, &verr) {
+		t.Fatalf("err = %v, want *Error", err)
+	}
+	got := make(map[string]string)
+	for _, f := range verr.Fields {
+		got[f.Field] = f.Message
+	}
+	return got
+}
+
+func TestStruct(t *testing.T) {
+	ratio := 1.5
+	req := createRequest{
+		Name:     "far-too-long",
+		Replicas: 0,
+		Ratio:    &ratio,
+		Tier:     "qa",
+		Tags:     []string{"a", "b", "c"},
+		Address:  &address{},
+		internal: "x",
+	}
+	got := fieldErrors(t, Struct(context.Background(), &req))
+	want := map[string]string{
+		"name":         "must have a length of at most 8",
+		"replicas":     "must be at least 1",
+		"ratio":        "must be at most 1",
+		"tier":         "must be one of dev, staging, prod",
+		"tags":         "must have a length of at most 2",
+		"address.city": "is required",
+		"billing.city": "is required",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("field errors = %v, want %v", got, want)
+	}
+
+	valid := createRequest{Name: "web", Replicas: 3, Tier: "prod", Billing: address{City: "Berlin"}}
+	if err := Struct(context.Background(), valid); err != nil {
+		t.Errorf("valid request: %v", err)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantField string
+		wantMsg   string
+	}{
+		{name: "valid", body: `{"name":"web","replicas":2,"tier":"dev","billing":{"city":"Oslo"}}`},
+		{name: "empty body keeps defaults", body: ``},
+		{name: "wrong type", body: `{"replicas":"two"}`, wantField: "replicas", wantMsg: "must be an integer"},
+		{name: "syntax", body: `{"name":`, wantField: "body", wantMsg: "invalid JSON"},
+		{name: "too large", body: `{"name":"` + strings.Repeat("x", 300) + `"}`, wantField: "body", wantMsg: "must not exceed 256 bytes"},
+		{name: "rules", body: `{"name":"web","replicas":20,"tier":"dev","billing":{"city":"Oslo"}}`, wantField: "replicas", wantMsg: "must be at most 10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := createRequest{Name: "default", Replicas: 1, Tier: "dev", Billing: address{City: "Rome"}}
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			err := DecodeJSON(httptest.NewRecorder(), r, &req, 256)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("err = %v", err)
+				}
+				return
+			}
+			if msg := fieldErrors(t, err)[tt.wantField]; !strings.HasPrefix(msg, tt.wantMsg) {
+				t.Errorf("%s: message = %q, want prefix %q", tt.wantField, msg, tt.wantMsg)
+			}
+		})
+	}
+}
+
+type listQuery struct {
+	Limit  *int   `query:"limit" validate:"min=1,max=100"`
+	Sort   string `query:"sort" validate:"oneof=name age"`
+	Expand bool   `query:"expand"`
+}
+
+func TestDecodeQuery(t *testing.T) {
+	q := listQuery{Sort: "name"}
+	if err := DecodeQuery(httptest.NewRequest(http.MethodGet, "/?limit=5&expand=true", nil), &q); err != nil {
+		t.Fatal(err)
+	}
+	if q.Limit == nil || *q.Limit != 5 || !q.Expand || q.Sort != "name" {
+		t.Errorf("decoded %+v", q)
+	}
+
+	q = listQuery{Sort: "name"}
+	err := DecodeQuery(httptest.NewRequest(http.MethodGet, "/?limit=many&expand=maybe", nil), &q)
+	got := fieldErrors(t, err)
+	if got["limit"] != "must be an integer" || got["expand"] != "must be true or false" {
+		t.Errorf("field errors = %v", got)
+	}
+
+	q = listQuery{}
+	got = fieldErrors(t, DecodeQuery(httptest.NewRequest(http.MethodGet, "/?limit=0&sort=size", nil), &q))
+	if got["limit"] != "must be at least 1" || got["sort"] != "must be one of name, age" {
+		t.Errorf("field errors = %v", got)
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteError(rec, httptest.NewRequest(http.MethodPost, "/", nil), &Error{Fields: []FieldError{{Field: "count", Message: "is required"}}})
+	if rec.Code != http.StatusBadRequest || rec.Header().Get("Content-Type") != problem.ContentType {
+		t.Fatalf("status %d, Content-Type %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	var resp problem.Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Type != problem.TypeInvalidRequest || resp.Detail != "invalid request" ||
+		len(resp.InvalidParams) != 1 || resp.InvalidParams[0] != (problem.InvalidParam{Name: "count", Reason: "is required"}) {
+		t.Errorf("response = %+v", resp)
+	}
+}
@@ -0,0 +1,273 @@
+// Package websocket implements the server side of WebSocket (RFC 6455), as
+// much as pushing messages to browsers takes: the opening handshake, text
+// frames, answering pings and the closing handshake. Messages the client
+// sends are read and discarded.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Close codes of the closing handshake.
+const (
+	CloseNormal        = 1000
+	CloseGoingAway     = 1001
+	CloseProtocolError = 1002
+	CloseTooBig        = 1009
+)
+
+// Opcodes of frames.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+const (
+	// acceptGUID is hashed with the client's key to accept the handshake.
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	// writeTimeout bounds writing a frame to a client that stopped reading.
+	writeTimeout = 10 * time.Second
+	// maxMessageSize bounds the frames clients may send.
+	maxMessageSize = 64 << 10
+)
+
+// ErrBadHandshake is returned by Upgrade for requests that aren't a valid
+// opening handshake; nothing has been written to the response yet.
+var ErrBadHandshake = errors.New("websocket: bad handshake")
+
+// IsUpgrade reports whether r asks to switch to WebSocket.
+func IsUpgrade(r *http.Request) bool {
+	return headerContains(r.Header, "Connection", "upgrade") && headerContains(r.Header, "Upgrade", "websocket")
+}
+
+// headerContains reports whether a comma-separated header lists token.
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Upgrade completes the opening handshake of r and takes over its
+// connection. The connection is read in the background until the client
+// closes it; Done tells when.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if r.Method != http.MethodGet || !IsUpgrade(r) {
+		return nil, fmt.Errorf("%w: not a GET request with Upgrade: websocket", ErrBadHandshake)
+	}
+	if v := r.Header.Get("Sec-WebSocket-Version"); v != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrBadHandshake, v)
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if nonce, err := base64.StdEncoding.DecodeString(key); err != nil || len(nonce) != 16 {
+		return nil, fmt.Errorf("%w: invalid Sec-WebSocket-Key", ErrBadHandshake)
+	}
+
+	nc, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, err
+	}
+	// The server's read and write timeouts don't apply past the handshake.
+	_ = nc.SetDeadline(time.Time{})
+	_ = nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", AcceptKey(key))
+	if err := brw.Flush(); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	c := &Conn{nc: nc, r: brw.Reader, done: make(chan struct{})}
+	go c.readLoop()
+	return c, nil
+}
+
+// AcceptKey is the Sec-WebSocket-Accept answering a Sec-WebSocket-Key.
+func AcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Conn is a server-side WebSocket connection. Its write methods may be
+// called concurrently.
+type Conn struct {
+	nc net.Conn
+	r  *bufio.Reader
+
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+// WriteText sends a text message.
+func (c *Conn) WriteText(msg []byte) error {
+	return c.writeFrame(opText, msg)
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (c *Conn) WriteJSON(v any) error {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteText(msg)
+}
+
+// Done is closed once the client closed the connection, or it failed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close starts the closing handshake with code and reason, and closes the
+// connection. It may be called more than once.
+func (c *Conn) Close(code int, reason string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	err := c.write(opClose, closePayload(code, reason))
+	return errors.Join(err, c.nc.Close())
+}
+
+func closePayload(code int, reason string) []byte {
+	// Control frames hold at most 125 bytes.
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	return append(binary.BigEndian.AppendUint16(nil, uint16(code)), reason...)
+}
+
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return net.ErrClosed
+	}
+	return c.write(opcode, payload)
+}
+
+// write writes an unfragmented, unmasked frame; c.mu is held.
+func (c *Conn) write(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_ = c.nc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := (&net.Buffers{header, payload}).WriteTo(c.nc)
+	return err
+}
+
+// readLoop reads the client's frames, answering pings and the closing
+// handshake, until the connection ends.
+func (c *Conn) readLoop() {
+	defer close(c.done)
+	for {
+		opcode, payload, err := c.readFrame()
+		var frameErr *frameError
+		switch {
+		case errors.As(err, &frameErr):
+			_ = c.Close(frameErr.code, frameErr.msg)
+			return
+		case err != nil:
+			c.mu.Lock()
+			c.closed = true
+			c.mu.Unlock()
+			c.nc.Close()
+			return
+		}
+		switch opcode {
+		case opPing:
+			_ = c.writeFrame(opPong, payload)
+		case opClose:
+			code := CloseNormal
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			_ = c.Close(code, "")
+			return
+		}
+	}
+}
+
+// frameError is a client frame breaking the protocol, which closes the
+// connection with code.
+type frameError struct {
+	code int
+	msg  string
+}
+
+func (e *frameError) Error() string { return "websocket: " + e.msg }
+
+// readFrame reads a frame and returns its opcode and unmasked payload.
+func (c *Conn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	fin, opcode := header[0]&0x80 != 0, header[0]&0x0f
+	masked, n := header[1]&0x80 != 0, uint64(header[1]&0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	switch {
+	case !masked:
+		return 0, nil, &frameError{CloseProtocolError, "unmasked client frame"}
+	case opcode > opBinary && opcode < opClose || opcode > opPong:
+		return 0, nil, &frameError{CloseProtocolError, fmt.Sprintf("unknown opcode %d", opcode)}
+	case opcode >= opClose && (!fin || n > 125):
+		return 0, nil, &frameError{CloseProtocolError, "invalid control frame"}
+	case n > maxMessageSize:
+		return 0, nil, &frameError{CloseTooBig, "message too big"}
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return opcode, payload, nil
+}
@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "dGhlIHNhbXBsZSBub25jZQ=="
+
+func TestAcceptKey(t *testing.T) {
+	// The example of RFC 6455, section 1.3.
+	if got := AcceptKey(testKey); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("AcceptKey() = %q", got)
+	}
+}
+
+// dial opens a WebSocket to srv and returns the connection and its reader.
+func dial(t *testing.T, srv *httptest.Server) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	nc, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	_ = nc.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET / HTTP/1.1\r\nHost: example\r\nConnection: keep-alive, Upgrade\r\nUpgrade: websocket\r\n" +
+		"Sec-WebSocket-Version: 13\r\nSec-WebSocket-Key: " + testKey + "\r\n\r\n"
+	if _, err := io.WriteString(nc, req); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != AcceptKey(testKey) {
+		t.Fatalf("handshake answered %s, %v", resp.Status, resp.Header)
+	}
+	return nc, r
+}
+
+// send writes a client frame, masked unless told otherwise.
+func send(t *testing.T, nc net.Conn, opcode byte, payload []byte, masked bool) {
+	t.Helper()
+	frame := []byte{0x80 | opcode, byte(len(payload))}
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := nc.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads a server frame.
+func receive(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	t.Helper()
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+	n := int(header[1] & 0x7f)
+	if n == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			t.Fatal(err)
+		}
+		n = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+	return header[0] & 0x0f, payload
+}
+
+func TestConn(t *testing.T) {
+	conns := make(chan *Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		conns <- c
+	}))
+	defer srv.Close()
+
+	nc, r := dial(t, srv)
+	c := <-conns
+	if err := c.WriteJSON(map[string]int{"goroutines": 12}); err != nil {
+		t.Fatal(err)
+	}
+	if op, msg := receive(t, r); op != opText || string(msg) != `{"goroutines":12}` {
+		t.Errorf("received opcode %d %q", op, msg)
+	}
+	long := strings.Repeat("x", 300)
+	if err := c.WriteText([]byte(long)); err != nil {
+		t.Fatal(err)
+	}
+	if _, msg := receive(t, r); string(msg) != long {
+		t.Errorf("received %d bytes, want 300", len(msg))
+	}
+
+	send(t, nc, opText, []byte("ignored"), true)
+	send(t, nc, opPing, []byte("hi"), true)
+	if op, msg := receive(t, r); op != opPong || string(msg) != "hi" {
+		t.Errorf("ping answered with opcode %d %q", op, msg)
+	}
+	send(t, nc, opClose, binary.BigEndian.AppendUint16(nil, CloseGoingAway), true)
+	if op, msg := receive(t, r); op != opClose || binary.BigEndian.Uint16(msg) != CloseGoingAway {
+		t.Errorf("close answered with opcode %d %v", op, msg)
+	}
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Done not closed after the closing handshake")
+	}
+	if err := c.WriteText([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("WriteText after close = %v", err)
+	}
+}
+
+func TestConnProtocolError(t *testing.T) {
+	conns := make(chan *Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := Upgrade(w, r)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- c
+	}))
+	defer srv.Close()
+
+	nc, r := dial(t, srv)
+	c := <-conns
+	send(t, nc, opText, []byte("unmasked"), false)
+	if op, msg := receive(t, r); op != opClose || binary.BigEndian.Uint16(msg) != CloseProtocolError {
+		t.Errorf("unmasked frame answered with opcode %d %v", op, msg)
+	}
+	<-c.Done()
+}
+
+func TestUpgradeBadHandshake(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+	}{
+		{"no upgrade", map[string]string{}},
+		{"old version", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "8", "Sec-WebSocket-Key": testKey}},
+		{"invalid key", map[string]string{"Connection": "Upgrade", "Upgrade": "websocket", "Sec-WebSocket-Version": "13", "Sec-WebSocket-Key": "short"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			if _, err := Upgrade(httptest.NewRecorder(), r); !errors.Is(err, ErrBadHandshake) {
+				t.Errorf("Upgrade() = %v, want ErrBadHandshake", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,400 @@
+// Package worker is the `backend-service worker` run mode: it consumes the
+// CloudEvents the API publishes to the event broker, keeps statistics of
+// the activity they describe, and serves its own probes and metrics, with
+// the consumer lag, so it can be deployed, scaled and alerted on like any
+// other Deployment.
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/eventbus"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/metrics"
+)
+
+const (
+	// lagInterval is how often the consumer lag is read from the broker.
+	lagInterval = 15 * time.Second
+	// retryBackoff is the pause after the broker fails.
+	retryBackoff = 2 * time.Second
+	// commitTimeout bounds committing what was processed at shutdown.
+	commitTimeout = 5 * time.Second
+)
+
+// Outcomes of a consumed event.
+const (
+	outcomeProcessed = "processed"
+	outcomeInvalid   = "invalid"
+)
+
+// consumer is what the worker needs of *eventbus.Consumer.
+type consumer interface {
+	Fetch(ctx context.Context) ([]eventbus.Delivery, error)
+	Commit(ctx context.Context, ds []eventbus.Delivery) error
+	Lag(ctx context.Context) (map[int32]int64, error)
+	Broker() string
+	Close()
+}
+
+// Worker consumes events until its context ends.
+type Worker struct {
+	cfg      config.Config
+	consumer consumer
+	registry *metrics.Registry
+	consumed *metrics.CounterVec
+	duration *metrics.HistogramVec
+	lag      *metrics.GaugeVec
+	failures *metrics.CounterVec
+
+	mu    sync.Mutex
+	stats Stats
+	// items are the IDs of the items created and not deleted since the
+	// worker started.
+	items     map[string]bool
+	lastEvent time.Time
+	// brokerErr is the last error of the broker, nil once it answers.
+	brokerErr error
+	connected bool
+}
+
+// Stats is what the worker has seen since it started, served at /stats.
+type Stats struct {
+	Broker   string `json:"broker"`
+	Topic    string `json:"topic"`
+	Group    string `json:"group"`
+	Consumed int64  `json:"consumed"`
+	Invalid  int64  `json:"invalid"`
+	// ByType counts the events consumed by type.
+	ByType map[string]int64 `json:"by_type"`
+	// Requests counts the request.served events by route, ServerErrors
+	// those answered 5xx.
+	Requests     map[string]int64 `json:"requests"`
+	ServerErrors int64            `json:"server_errors"`
+	// LiveItems is the number of items created and not deleted since the
+	// worker started.
+	LiveItems int `json:"live_items"`
+	// Versions is the version each pod last started with.
+	Versions  map[string]string `json:"versions"`
+	LastEvent string            `json:"last_event,omitempty"`
+	// Lag is the number of events not consumed yet, by partition.
+	Lag map[string]int64 `json:"lag"`
+}
+
+// New returns a worker consuming the events of cfg.EventBrokerURL.
+func New(cfg config.Config) (*Worker, error) {
+	if cfg.EventBrokerURL == "" {
+		return nil, errors.New("EVENT_BROKER_URL is required in worker mode")
+	}
+	c, err := eventbus.NewConsumer(eventbus.ConsumerConfig{
+		URL:       cfg.EventBrokerURL,
+		Topic:     cfg.EventTopic,
+		Group:     cfg.WorkerGroup,
+		ClientID:  cfg.WorkerGroup + "-" + cfg.Identity(),
+		BatchSize: cfg.WorkerBatchSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newWorker(cfg, c), nil
+}
+
+func newWorker(cfg config.Config, c consumer) *Worker {
+	reg := metrics.NewRegistry()
+	w := &Worker{
+		cfg:      cfg,
+		consumer: c,
+		registry: reg,
+		consumed: reg.Counter("worker_events_consumed_total", "CloudEvents consumed from the event broker, by type and outcome (processed or invalid).",
+			"type", "outcome"),
+		duration: reg.Histogram("worker_event_processing_duration_seconds", "Time spent processing an event, by type.",
+			metrics.DefaultBuckets, "type"),
+		lag: reg.Gauge("worker_consumer_lag", "Events published and not consumed yet by the worker's group, by partition.",
+			"partition"),
+		failures: reg.Counter("worker_broker_errors_total", "Failed calls to the event broker, by operation (fetch, commit or lag).",
+			"operation"),
+		stats: Stats{
+			Broker:   c.Broker(),
+			Topic:    cfg.EventTopic,
+			Group:    cfg.WorkerGroup,
+			ByType:   make(map[string]int64),
+			Requests: make(map[string]int64),
+			Versions: make(map[string]string),
+			Lag:      make(map[string]int64),
+		},
+		items: make(map[string]bool),
+	}
+	reg.GaugeFunc("worker_last_event_timestamp_seconds", "Unix time of the last event consumed, 0 before the first.", nil,
+		func() float64 {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.lastEvent.IsZero() {
+				return 0
+			}
+			return float64(w.lastEvent.UnixMilli()) / 1000
+		})
+	reg.GaugeFunc("backend_service_build_info", "Always 1, labeled with the build of the running binary.",
+		map[string]string{"version": cfg.Build.Version, "git_commit": cfg.Build.GitCommit, "go_version": runtime.Version()},
+		func() float64 { return 1 })
+	return w
+}
+
+// Handler serves the probes, the metrics and the statistics.
+func (w *Worker) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handlers.Health(w.cfg.Build.Version))
+	mux.HandleFunc("/readyz", w.readiness)
+	mux.Handle("/metrics", w.registry)
+	mux.HandleFunc("/stats", w.serveStats)
+	return mux
+}
+
+// readiness is ready once the broker answered, and as long as it does.
+func (w *Worker) readiness(rw http.ResponseWriter, _ *http.Request) {
+	w.mu.Lock()
+	ready := w.connected && w.brokerErr == nil
+	w.mu.Unlock()
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	if err := json.NewEncoder(rw).Encode(handlers.NewHealthResponse(status, w.cfg.Build.Version)); err != nil {
+		log.Printf("Error encoding readiness response: %v", err)
+	}
+}
+
+func (w *Worker) serveStats(rw http.ResponseWriter, _ *http.Request) {
+	rw.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(rw).Encode(w.Stats()); err != nil {
+		log.Printf("Error encoding stats response: %v", err)
+	}
+}
+
+// Stats returns a copy of the statistics.
+func (w *Worker) Stats() Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	s := w.stats
+	s.ByType = copyMap(s.ByType)
+	s.Requests = copyMap(s.Requests)
+	s.Versions = copyMap(s.Versions)
+	s.Lag = copyMap(s.Lag)
+	s.LiveItems = len(w.items)
+	if !w.lastEvent.IsZero() {
+		s.LastEvent = w.lastEvent.UTC().Format(time.RFC3339)
+	}
+	return s
+}
+
+func copyMap[V any](m map[string]V) map[string]V {
+	c := make(map[string]V, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Run serves HTTP on cfg.Port and consumes events until ctx ends, then
+// commits what it processed and closes the connection.
+func (w *Worker) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              ":" + w.cfg.Port,
+		Handler:           w.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			serverErr <- err
+		}
+	}()
+	log.Printf("Worker consuming %s from %s as %s, serving on :%s",
+		w.cfg.EventTopic, w.consumer.Broker(), w.cfg.WorkerGroup, w.cfg.Port)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		w.pollLag(ctx)
+	}()
+	go func() {
+		select {
+		case err := <-serverErr:
+			log.Printf("Error serving HTTP: %v", err)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	w.consume(ctx)
+	cancel()
+	wg.Wait()
+	w.consumer.Close()
+
+	shutdownCtx, stop := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stop()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	select {
+	case err := <-serverErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// consume fetches, processes and commits batches of events until ctx ends.
+func (w *Worker) consume(ctx context.Context) {
+	for ctx.Err() == nil {
+		ds, err := w.consumer.Fetch(ctx)
+		if err != nil && ctx.Err() == nil {
+			w.brokerFailed("fetch", err)
+			sleep(ctx, retryBackoff)
+		} else if err == nil {
+			w.brokerAnswered()
+		}
+		processed := 0
+		for _, d := range ds {
+			if !w.process(ctx, d) {
+				break
+			}
+			processed++
+		}
+		if processed == 0 {
+			continue
+		}
+		// What was processed is committed even once ctx ends, so it isn't
+		// processed again after a restart.
+		commitCtx, stop := context.WithTimeout(context.WithoutCancel(ctx), commitTimeout)
+		if err := w.consumer.Commit(commitCtx, ds[:processed]); err != nil {
+			w.brokerFailed("commit", err)
+		}
+		stop()
+	}
+}
+
+// process handles one event and reports whether it did, which it doesn't
+// when ctx ends during the processing delay.
+func (w *Worker) process(ctx context.Context, d eventbus.Delivery) bool {
+	start := time.Now()
+	if d.Err != nil {
+		log.Printf("Warning: skipping event of partition %d: %v", d.Partition, d.Err)
+		w.consumed.Inc("", outcomeInvalid)
+		w.mu.Lock()
+		w.stats.Invalid++
+		w.mu.Unlock()
+		return true
+	}
+	if w.cfg.WorkerProcessingDelay > 0 && !sleep(ctx, w.cfg.WorkerProcessingDelay) {
+		return false
+	}
+	e := d.Event
+	w.mu.Lock()
+	w.stats.Consumed++
+	w.stats.ByType[e.Type]++
+	w.lastEvent = e.Time
+	switch e.Type {
+	case "request.served":
+		var data struct {
+			Route  string `json:"route"`
+			Status int    `json:"status"`
+		}
+		if json.Unmarshal(e.Data, &data) == nil {
+			w.stats.Requests[data.Route]++
+			if data.Status >= 500 {
+				w.stats.ServerErrors++
+			}
+		}
+	case "item.created":
+		w.items[e.Subject] = true
+	case "item.deleted":
+		delete(w.items, e.Subject)
+	case "version.started":
+		var data struct {
+			Version string `json:"version"`
+		}
+		if json.Unmarshal(e.Data, &data) == nil {
+			w.stats.Versions[e.Subject] = data.Version
+		}
+	}
+	w.mu.Unlock()
+	w.consumed.Inc(e.Type, outcomeProcessed)
+	w.duration.Observe(time.Since(start).Seconds(), e.Type)
+	return true
+}
+
+// pollLag reads the consumer lag every lagInterval until ctx ends.
+func (w *Worker) pollLag(ctx context.Context) {
+	ticker := time.NewTicker(lagInterval)
+	defer ticker.Stop()
+	for {
+		w.updateLag(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (w *Worker) updateLag(ctx context.Context) {
+	lag, err := w.consumer.Lag(ctx)
+	if err != nil {
+		if ctx.Err() == nil {
+			w.brokerFailed("lag", err)
+		}
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for p, n := range lag {
+		partition := strconv.Itoa(int(p))
+		w.lag.Set(float64(n), partition)
+		w.stats.Lag[partition] = n
+	}
+}
+
+func (w *Worker) brokerFailed(operation string, err error) {
+	w.failures.Inc(operation)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.brokerErr == nil {
+		log.Printf("Error consuming from %s: %s: %v", w.stats.Broker, operation, err)
+	}
+	w.brokerErr = err
+}
+
+func (w *Worker) brokerAnswered() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.brokerErr != nil {
+		log.Printf("Event broker %s answers again", w.stats.Broker)
+	}
+	w.brokerErr, w.connected = nil, true
+}
+
+// sleep waits for d, or until ctx ends, and reports whether it waited.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
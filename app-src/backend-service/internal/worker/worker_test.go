@@ -0,0 +1,164 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/eventbus"
+)
+
+// fakeConsumer hands out its batches one per Fetch, then blocks until the
+// context ends, recording what is committed.
+type fakeConsumer struct {
+	mu        sync.Mutex
+	batches   [][]eventbus.Delivery
+	fail      error
+	committed []eventbus.Delivery
+	closed    bool
+}
+
+func (c *fakeConsumer) Fetch(ctx context.Context) ([]eventbus.Delivery, error) {
+	c.mu.Lock()
+	if c.fail != nil {
+		defer c.mu.Unlock()
+		return nil, c.fail
+	}
+	if len(c.batches) > 0 {
+		defer c.mu.Unlock()
+		ds := c.batches[0]
+		c.batches = c.batches[1:]
+		return ds, nil
+	}
+	c.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (c *fakeConsumer) Commit(_ context.Context, ds []eventbus.Delivery) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.committed = append(c.committed, ds...)
+	return nil
+}
+
+func (c *fakeConsumer) Lag(context.Context) (map[int32]int64, error) {
+	return map[int32]int64{0: 3, 1: 0}, nil
+}
+
+func (c *fakeConsumer) Broker() string { return "nats://nats:4222" }
+
+func (c *fakeConsumer) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+}
+
+func delivery(eventType, subject, data string) eventbus.Delivery {
+	return eventbus.Delivery{Event: eventbus.Event{
+		SpecVersion: "1.0",
+		Type:        eventType,
+		Subject:     subject,
+		Time:        time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data:        json.RawMessage(data),
+	}}
+}
+
+func TestWorker(t *testing.T) {
+	c := &fakeConsumer{batches: [][]eventbus.Delivery{{
+		delivery("item.created", "1", `{"id":1}`),
+		delivery("item.created", "2", `{"id":2}`),
+		delivery("request.served", "items", `{"route":"items","status":201}`),
+		{Err: errors.New("invalid CloudEvent")},
+	}, {
+		delivery("item.deleted", "1", `{"id":1}`),
+		delivery("request.served", "info", `{"route":"info","status":503}`),
+		delivery("version.started", "backend-service-abc", `{"version":"1.2.0"}`),
+	}}}
+	w := newWorker(config.Config{EventTopic: "events", WorkerGroup: "workers", Port: "0"}, c)
+	h := w.Handler()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz before the broker answered = %d", rec.Code)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.consume(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Stats().Consumed < 6 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.updateLag(ctx)
+	cancel()
+	<-done
+
+	if len(c.committed) != 7 {
+		t.Errorf("committed %d events, want 7", len(c.committed))
+	}
+	s := w.Stats()
+	if s.Consumed != 6 || s.Invalid != 1 || s.ByType["item.created"] != 2 || s.LiveItems != 1 ||
+		s.Requests["items"] != 1 || s.ServerErrors != 1 || s.Versions["backend-service-abc"] != "1.2.0" ||
+		s.LastEvent != "2024-05-01T12:00:00Z" || s.Lag["0"] != 3 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/readyz = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, want := range []string{
+		`worker_events_consumed_total{type="item.created",outcome="processed"} 2`,
+		`worker_events_consumed_total{type="",outcome="invalid"} 1`,
+		`worker_consumer_lag{partition="0"} 3`,
+		`worker_consumer_lag{partition="1"} 0`,
+		`worker_last_event_timestamp_seconds 1.7145648e+09`,
+	} {
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("/metrics lacks %s:\n%s", want, rec.Body)
+		}
+	}
+}
+
+func TestWorkerBrokerDown(t *testing.T) {
+	c := &fakeConsumer{fail: errors.New("connection refused")}
+	w := newWorker(config.Config{}, c)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w.consume(ctx)
+
+	rec := httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("/readyz with the broker down = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	w.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if want := `worker_broker_errors_total{operation="fetch"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("/metrics lacks %s:\n%s", want, rec.Body)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(config.Config{}); err == nil {
+		t.Error("New() without EVENT_BROKER_URL succeeded")
+	}
+	if _, err := New(config.Config{EventBrokerURL: "kafka://kafka:9092", EventTopic: "events", WorkerGroup: "workers"}); err != nil {
+		t.Error(err)
+	}
+}
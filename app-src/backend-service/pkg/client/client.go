@@ -0,0 +1,853 @@
+// Package client is a typed Go client for the backend-service HTTP API, for
+// use by CLIs, BFFs and smoke tests.
+//
+// Every method takes a context. Idempotent requests are retried with
+// exponential backoff on connection errors and 502/503/504 responses; the
+// readiness and status-code endpoints return their body for any status since
+// a non-2xx answer is their expected result.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/apiversion"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+)
+
+const (
+	defaultRetries = 2
+	defaultBackoff = 200 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+// Error is returned for unexpected response statuses. Problem is set when
+// the server answered with a problem+json body.
+type Error struct {
+	StatusCode int
+	Body       string
+	Problem    *Problem
+}
+
+func (e *Error) Error() string {
+	if e.Problem != nil && e.Problem.Detail != "" {
+		return fmt.Sprintf("backend-service: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Problem.Detail)
+	}
+	if e.Body == "" {
+		return fmt.Sprintf("backend-service: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("backend-service: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
+
+// Client calls one backend-service instance or Service. It is safe for
+// concurrent use.
+type Client struct {
+	baseURL     string
+	httpClient  *http.Client
+	adminToken  string
+	bearerToken string
+	userAgent   string
+	retries     int
+	backoff     time.Duration
+	apiVersion  int
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithAdminToken sets the bearer token sent to the /admin endpoints: the
+// ADMIN_TOKEN or an admin API key.
+func WithAdminToken(token string) Option {
+	return func(c *Client) { c.adminToken = token }
+}
+
+// WithBearerToken sets the JWT sent to the API when the service requires
+// one (JWT_SECRET, JWT_SECRET_FILE or JWT_JWKS_URL is set).
+func WithBearerToken(token string) Option {
+	return func(c *Client) { c.bearerToken = token }
+}
+
+// WithUserAgent sets the User-Agent header.
+func WithUserAgent(ua string) Option {
+	return func(c *Client) { c.userAgent = ua }
+}
+
+// WithRetries sets how often idempotent requests are retried and the
+// initial backoff, which doubles on every attempt. Zero retries disables
+// retrying.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) { c.retries, c.backoff = retries, backoff }
+}
+
+// WithAPIVersion requests response shapes of API version v via
+// Accept-Version. Methods returning a version-specific type, such as InfoV2,
+// override it.
+func WithAPIVersion(v int) Option {
+	return func(c *Client) { c.apiVersion = v }
+}
+
+// New returns a client for the service at baseURL, e.g.
+// "http://dev-backend-service.gitops-demo-dev".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		userAgent:  "backend-service-client",
+		retries:    defaultRetries,
+		backoff:    defaultBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Health calls the liveness endpoint.
+func (c *Client) Health(ctx context.Context) (*HealthResponse, error) {
+	return get[HealthResponse](ctx, c, "/healthz")
+}
+
+// Ready calls the readiness endpoint. A pod that isn't ready answers 503;
+// its status and checks explain why and are returned without an error.
+func (c *Client) Ready(ctx context.Context) (*ReadinessResponse, error) {
+	var out ReadinessResponse
+	if err := c.do(ctx, request{path: "/readyz", idempotent: true, anyStatus: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Version returns the build information of the serving replica.
+func (c *Client) Version(ctx context.Context) (*VersionResponse, error) {
+	return get[VersionResponse](ctx, c, "/version")
+}
+
+// Info returns the service description.
+func (c *Client) Info(ctx context.Context) (*InfoResponse, error) {
+	return get[InfoResponse](ctx, c, "/api/v1/info")
+}
+
+// InfoV2 returns the service description in its API version 2 shape.
+func (c *Client) InfoV2(ctx context.Context) (*InfoResponseV2, error) {
+	var out InfoResponseV2
+	if err := c.do(ctx, request{path: "/api/v1/info", idempotent: true, apiVersion: 2}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Echo sends body with the given method and content type and returns the
+// request as the service received it.
+func (c *Client) Echo(ctx context.Context, method, contentType string, body []byte) (*EchoResponse, error) {
+	var out EchoResponse
+	err := c.do(ctx, request{
+		method:      method,
+		path:        "/api/v1/echo",
+		body:        body,
+		contentType: contentType,
+		idempotent:  method == "" || method == http.MethodGet || method == http.MethodHead,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Delay asks the service to wait d before answering. It is never retried.
+func (c *Client) Delay(ctx context.Context, d time.Duration) (*DelayResponse, error) {
+	var out DelayResponse
+	if err := c.do(ctx, request{path: "/api/v1/delay/" + d.String()}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// StatusCode asks the service to answer with code. The response is returned
+// for any code; 204 and 304 have no body and return only the status.
+func (c *Client) StatusCode(ctx context.Context, code int) (*StatusCodeResponse, error) {
+	out := StatusCodeResponse{Status: code}
+	if err := c.do(ctx, request{path: "/api/v1/status/" + strconv.Itoa(code), anyStatus: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Leader returns the leader election state.
+func (c *Client) Leader(ctx context.Context) (*LeaderResponse, error) {
+	return get[LeaderResponse](ctx, c, "/api/v1/leader")
+}
+
+// Deployment returns the rollout state of the owning Deployment.
+func (c *Client) Deployment(ctx context.Context) (*DeploymentStatusResponse, error) {
+	return get[DeploymentStatusResponse](ctx, c, "/api/v1/deployment")
+}
+
+// Dependencies returns sibling services and volume health.
+func (c *Client) Dependencies(ctx context.Context) (*DependenciesResponse, error) {
+	return get[DependenciesResponse](ctx, c, "/api/v1/dependencies")
+}
+
+// Resources returns declared resources and live usage.
+func (c *Client) Resources(ctx context.Context) (*ResourcesResponse, error) {
+	return get[ResourcesResponse](ctx, c, "/api/v1/resources")
+}
+
+// Disruptions returns the previous termination and the current shutdown
+// classification.
+func (c *Client) Disruptions(ctx context.Context) (*DisruptionsResponse, error) {
+	return get[DisruptionsResponse](ctx, c, "/api/v1/disruptions")
+}
+
+// Drift compares the running image digest to the expected one.
+func (c *Client) Drift(ctx context.Context) (*DriftResponse, error) {
+	return get[DriftResponse](ctx, c, "/api/v1/drift")
+}
+
+// GitOpsStatus returns the Argo CD sync status and health of the service.
+func (c *Client) GitOpsStatus(ctx context.Context) (*GitOpsStatusResponse, error) {
+	return get[GitOpsStatusResponse](ctx, c, "/api/v1/gitops/status")
+}
+
+// Deployments lists the Flux and Argo CD deployment events the answering
+// replica received, newest first, of the object (Kind/namespace/name) when
+// it's set; a limit of 0 takes the server's default.
+func (c *Client) Deployments(ctx context.Context, object string, limit int) (*DeploymentsResponse, error) {
+	query := url.Values{}
+	if object != "" {
+		query.Set("object", object)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	return get[DeploymentsResponse](ctx, c, "/api/v1/deployments?"+query.Encode())
+}
+
+// GitCommits compares the latest commit pushed to the tracked branch with
+// the running one, and lists the Git webhooks the answering replica received.
+func (c *Client) GitCommits(ctx context.Context) (*GitCommitsResponse, error) {
+	return get[GitCommitsResponse](ctx, c, "/api/v1/git/commits")
+}
+
+// Peers returns the versions the replicas of the service are serving.
+func (c *Client) Peers(ctx context.Context) (*PeersResponse, error) {
+	return get[PeersResponse](ctx, c, "/api/v1/peers")
+}
+
+// GitOpsDrift compares the image tag declared in the GitOps repo with the
+// running version and commit.
+func (c *Client) GitOpsDrift(ctx context.Context) (*GitOpsDriftResponse, error) {
+	return get[GitOpsDriftResponse](ctx, c, "/api/v1/gitops/drift")
+}
+
+// Promote opens a pull request setting the image tag of an environment in
+// the GitOps repo. It requires an admin token and is never retried, since
+// a second attempt fails with 409 Conflict on the branch the first created.
+func (c *Client) Promote(ctx context.Context, req PromoteRequest) (*PromoteResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out PromoteResponse
+	err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/api/v1/gitops/promote",
+		body:        body,
+		contentType: "application/json",
+		admin:       true,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Kubernetes returns the service's Kubernetes API client statistics.
+func (c *Client) Kubernetes(ctx context.Context) (*KubernetesClientResponse, error) {
+	return get[KubernetesClientResponse](ctx, c, "/api/v1/kubernetes")
+}
+
+// Repos returns the polled Git repositories.
+func (c *Client) Repos(ctx context.Context) (*ReposResponse, error) {
+	return get[ReposResponse](ctx, c, "/api/v1/repos")
+}
+
+// LiveConfig returns the generation and values of the settings reloaded
+// without a restart.
+func (c *Client) LiveConfig(ctx context.Context) (*LiveConfigResponse, error) {
+	return get[LiveConfigResponse](ctx, c, "/api/v1/config")
+}
+
+// Flags returns the feature flags.
+func (c *Client) Flags(ctx context.Context) (*FlagsResponse, error) {
+	return get[FlagsResponse](ctx, c, "/api/v1/flags")
+}
+
+// Me returns the claims of the bearer token as the service verified them;
+// it fails with 403 when the service doesn't require tokens.
+func (c *Client) Me(ctx context.Context) (*ClaimsResponse, error) {
+	return get[ClaimsResponse](ctx, c, "/api/v1/me")
+}
+
+// ScalingMetrics returns the autoscaling signals.
+func (c *Client) ScalingMetrics(ctx context.Context) (*ScalingMetricsResponse, error) {
+	return get[ScalingMetricsResponse](ctx, c, "/api/v1/metrics/scaling")
+}
+
+// QueueMetrics returns the background job backlog.
+func (c *Client) QueueMetrics(ctx context.Context) (*QueueMetricsResponse, error) {
+	return get[QueueMetricsResponse](ctx, c, "/api/v1/metrics/queue")
+}
+
+// Stats returns the live stats /ws/stats streams, once.
+func (c *Client) Stats(ctx context.Context) (*StatsFrame, error) {
+	return get[StatsFrame](ctx, c, "/ws/stats")
+}
+
+// LifecycleEvents returns the recent lifecycle events of the replica that
+// answers; /events streams them to clients accepting text/event-stream.
+func (c *Client) LifecycleEvents(ctx context.Context) (*LifecycleEventsResponse, error) {
+	return get[LifecycleEventsResponse](ctx, c, "/events")
+}
+
+// EnqueueJobs enqueues simulated background jobs. A full queue answers 503
+// with the number of jobs that were accepted; that response is returned
+// together with an *Error. It is never retried.
+func (c *Client) EnqueueJobs(ctx context.Context, req EnqueueJobsRequest) (*EnqueueJobsResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out EnqueueJobsResponse
+	err = c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/api/v1/jobs",
+		body:        body,
+		contentType: "application/json",
+		// A full queue answers 503 with the partial result.
+		alsoOK: http.StatusServiceUnavailable,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Enqueued < req.Count {
+		return &out, &Error{StatusCode: http.StatusServiceUnavailable, Body: "job queue full"}
+	}
+	return &out, nil
+}
+
+// CreateTask starts a long-running task. It is never retried, so the task
+// isn't started twice. Tasks exist only on the instance that accepted them:
+// poll through the same instance, e.g. a port-forward to one pod.
+func (c *Client) CreateTask(ctx context.Context, req CreateTaskRequest) (*TaskResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out TaskResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/tasks", body: body, contentType: "application/json"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Task returns the state of a task.
+func (c *Client) Task(ctx context.Context, id string) (*TaskResponse, error) {
+	return get[TaskResponse](ctx, c, "/api/v1/tasks/"+url.PathEscape(id))
+}
+
+// WaitTask polls a task every interval until it is finished or ctx is done,
+// and returns its final state. A failed or cancelled task is not an error.
+func (c *Client) WaitTask(ctx context.Context, id string, interval time.Duration) (*TaskResponse, error) {
+	for {
+		task, err := c.Task(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		switch task.Status {
+		case "succeeded", "failed", "cancelled":
+			return task, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Upload stores the content of r as a file of the given name and type and
+// returns its reference; the file is downloaded from the returned URL. The
+// multipart body is built in memory, so it suits files up to the server's
+// UPLOAD_MAX_BYTES. It is never retried.
+func (c *Client) Upload(ctx context.Context, filename, contentType string, r io.Reader) (*UploadResponse, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", mime.FormatMediaType("form-data", map[string]string{"name": "file", "filename": filename}))
+	header.Set("Content-Type", contentType)
+	part, err := mw.CreatePart(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, r); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	var out UploadResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/upload", body: body.Bytes(), contentType: mw.FormDataContentType()}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadCPU starts burning CPU on the instance that serves the request. It
+// is never retried, so a load isn't started twice.
+func (c *Client) LoadCPU(ctx context.Context, req CPULoadRequest) (*LoadResponse, error) {
+	return c.startLoad(ctx, "/api/v1/load/cpu", req)
+}
+
+// LoadMemory starts holding memory on the instance that serves the
+// request. It is never retried.
+func (c *Client) LoadMemory(ctx context.Context, req MemoryLoadRequest) (*LoadResponse, error) {
+	return c.startLoad(ctx, "/api/v1/load/memory", req)
+}
+
+func (c *Client) startLoad(ctx context.Context, path string, req any) (*LoadResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	var out LoadResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, body: body, contentType: "application/json"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LoadStatus lists the simulated loads running on the instance that
+// serves the request.
+func (c *Client) LoadStatus(ctx context.Context) (*LoadStatusResponse, error) {
+	return get[LoadStatusResponse](ctx, c, "/api/v1/load")
+}
+
+// Call has the server fetch its configured downstream service and returns
+// what it answered. The server retries the downstream call itself, so a
+// 502 or a 503 from an open circuit breaker isn't worth retrying here.
+func (c *Client) Call(ctx context.Context) (*CallResponse, error) {
+	var out CallResponse
+	if err := c.do(ctx, request{path: "/api/v1/call"}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Chain has the server call its configured chain of downstream services
+// and returns every hop. When a hop fails the server answers 502 with the
+// hops so far, which Chain returns without an error; FailedHop tells.
+func (c *Client) Chain(ctx context.Context) (*ChainResponse, error) {
+	var out ChainResponse
+	if err := c.do(ctx, request{path: "/api/v1/chain", alsoOK: http.StatusBadGateway}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Items returns a page of items, ordered by ID; a limit of 0 takes the
+// server's default.
+func (c *Client) Items(ctx context.Context, limit, offset int) (*ItemsResponse, error) {
+	query := url.Values{"offset": {strconv.Itoa(offset)}}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	return get[ItemsResponse](ctx, c, "/api/v1/items?"+query.Encode())
+}
+
+// Item returns one item.
+func (c *Client) Item(ctx context.Context, id int64) (*ItemResponse, error) {
+	return get[ItemResponse](ctx, c, "/api/v1/items/"+strconv.FormatInt(id, 10))
+}
+
+// CreateItem stores a new item and returns it with its ID.
+func (c *Client) CreateItem(ctx context.Context, req ItemRequest) (*ItemResponse, error) {
+	return c.item(ctx, http.MethodPost, "/api/v1/items", req)
+}
+
+// UpdateItem replaces the name and description of an item.
+func (c *Client) UpdateItem(ctx context.Context, id int64, req ItemRequest) (*ItemResponse, error) {
+	return c.item(ctx, http.MethodPut, "/api/v1/items/"+strconv.FormatInt(id, 10), req)
+}
+
+// DeleteItem deletes an item.
+func (c *Client) DeleteItem(ctx context.Context, id int64) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/v1/items/" + strconv.FormatInt(id, 10), idempotent: true}, nil)
+}
+
+func (c *Client) item(ctx context.Context, method, path string, req ItemRequest) (*ItemResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	// A retried POST could create the item twice; PUT is safe to repeat.
+	r := request{method: method, path: path, body: body, contentType: "application/json", idempotent: method == http.MethodPut}
+	var out ItemResponse
+	if err := c.do(ctx, r, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// APIVersions returns the API path and response versions the server
+// serves.
+func (c *Client) APIVersions(ctx context.Context) (*APIVersionsResponse, error) {
+	return get[APIVersionsResponse](ctx, c, "/api")
+}
+
+// Schemas lists the JSON Schemas of the API's responses.
+func (c *Client) Schemas(ctx context.Context) (*SchemaIndexResponse, error) {
+	return get[SchemaIndexResponse](ctx, c, "/api/v1/schemas")
+}
+
+// Schema returns the JSON Schema document of one response type.
+func (c *Client) Schema(ctx context.Context, name string) (json.RawMessage, error) {
+	var out json.RawMessage
+	if err := c.do(ctx, request{path: "/api/v1/schemas/" + url.PathEscape(name), idempotent: true}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OpenAPI returns the OpenAPI document of the API.
+func (c *Client) OpenAPI(ctx context.Context) (json.RawMessage, error) {
+	var out json.RawMessage
+	if err := c.do(ctx, request{path: "/openapi.json", idempotent: true}, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminConfig returns the effective configuration. It requires an admin
+// token.
+func (c *Client) AdminConfig(ctx context.Context) (*ConfigResponse, error) {
+	var out ConfigResponse
+	if err := c.do(ctx, request{path: "/admin/config", idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminEnv returns the environment variables of the process, secrets
+// masked. It requires an admin token.
+func (c *Client) AdminEnv(ctx context.Context) (*EnvResponse, error) {
+	var out EnvResponse
+	if err := c.do(ctx, request{path: "/admin/env", idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminRoutes lists the registered routes. It requires an admin token.
+func (c *Client) AdminRoutes(ctx context.Context) (*RoutesResponse, error) {
+	var out RoutesResponse
+	if err := c.do(ctx, request{path: "/admin/routes", idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// AdminAudit lists the most recent entries of the audit log, newest first,
+// of the actions starting with action when it's set; a limit of 0 takes the
+// server's default. It requires an admin token.
+func (c *Client) AdminAudit(ctx context.Context, action string, limit int) (*AuditResponse, error) {
+	query := url.Values{}
+	if action != "" {
+		query.Set("action", action)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var out AuditResponse
+	if err := c.do(ctx, request{path: "/admin/audit?" + query.Encode(), idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Selftest runs the server's diagnostics. A failed check is returned as
+// the report together with an *Error for the 503. It requires an admin
+// token.
+func (c *Client) Selftest(ctx context.Context) (*SelftestResponse, error) {
+	var out SelftestResponse
+	err := c.do(ctx, request{
+		path:       "/admin/selftest",
+		idempotent: true,
+		admin:      true,
+		// A failed check answers 503 with the report.
+		alsoOK: http.StatusServiceUnavailable,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Status != "pass" {
+		return &out, &Error{StatusCode: http.StatusServiceUnavailable, Body: "self-test failed"}
+	}
+	return &out, nil
+}
+
+// Recordings lists the recorded traffic files. It requires an admin token.
+func (c *Client) Recordings(ctx context.Context) (*RecordingsResponse, error) {
+	var out RecordingsResponse
+	if err := c.do(ctx, request{path: "/admin/recordings", idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Prestop starts draining the replica and waits up to timeout for in-flight
+// requests; a zero timeout uses the server's default. It is never retried.
+func (c *Client) Prestop(ctx context.Context, timeout time.Duration) (*PrestopResponse, error) {
+	path := "/admin/prestop"
+	if timeout > 0 {
+		path += "?timeout=" + strconv.Itoa(int(timeout.Seconds()))
+	}
+	var out PrestopResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Drain takes the replica out of the Service endpoints by failing its
+// readiness, without stopping it. It requires an admin token.
+func (c *Client) Drain(ctx context.Context) (*DrainResponse, error) {
+	return c.drain(ctx, "/admin/drain")
+}
+
+// Undrain returns a drained replica to the Service endpoints. It requires an
+// admin token and fails with 409 Conflict once the replica is shutting down.
+func (c *Client) Undrain(ctx context.Context) (*DrainResponse, error) {
+	return c.drain(ctx, "/admin/undrain")
+}
+
+func (c *Client) drain(ctx context.Context, path string) (*DrainResponse, error) {
+	// Both set a state rather than toggle it, so they are safe to retry.
+	var out DrainResponse
+	if err := c.do(ctx, request{method: http.MethodPost, path: path, idempotent: true, admin: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// Chaos returns the faults the replica injects into API requests. It
+// requires an admin token.
+func (c *Client) Chaos(ctx context.Context) (*ChaosResponse, error) {
+	return c.chaos(ctx, http.MethodGet, nil)
+}
+
+// SetChaos overrides the configured faults until ResetChaos; fields left
+// nil keep their current values. It requires an admin token.
+func (c *Client) SetChaos(ctx context.Context, req ChaosRequest) (*ChaosResponse, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	return c.chaos(ctx, http.MethodPut, body)
+}
+
+// ResetChaos removes the override of SetChaos, returning to the configured
+// faults. It requires an admin token.
+func (c *Client) ResetChaos(ctx context.Context) (*ChaosResponse, error) {
+	return c.chaos(ctx, http.MethodDelete, nil)
+}
+
+func (c *Client) chaos(ctx context.Context, method string, body []byte) (*ChaosResponse, error) {
+	// PUT and DELETE set a state rather than change it, so all are safe to retry.
+	req := request{method: method, path: "/admin/chaos", idempotent: true, admin: true}
+	if body != nil {
+		req.body, req.contentType = body, "application/json"
+	}
+	var out ChaosResponse
+	if err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// LogLevel returns the server's log level and whether it's overridden. It
+// requires an admin token.
+func (c *Client) LogLevel(ctx context.Context) (*LogLevelResponse, error) {
+	return c.logLevel(ctx, http.MethodGet, nil)
+}
+
+// SetLogLevel overrides the configured log level with debug, info, warn or
+// error until ResetLogLevel. It requires an admin token.
+func (c *Client) SetLogLevel(ctx context.Context, level string) (*LogLevelResponse, error) {
+	body, err := json.Marshal(LogLevelRequest{Level: level})
+	if err != nil {
+		return nil, err
+	}
+	return c.logLevel(ctx, http.MethodPut, body)
+}
+
+// ResetLogLevel removes the override of SetLogLevel, returning to the
+// configured level. It requires an admin token.
+func (c *Client) ResetLogLevel(ctx context.Context) (*LogLevelResponse, error) {
+	return c.logLevel(ctx, http.MethodDelete, nil)
+}
+
+func (c *Client) logLevel(ctx context.Context, method string, body []byte) (*LogLevelResponse, error) {
+	req := request{method: method, path: "/admin/loglevel", idempotent: true, admin: true}
+	if body != nil {
+		req.body, req.contentType = body, "application/json"
+	}
+	var out LogLevelResponse
+	if err := c.do(ctx, req, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func get[T any](ctx context.Context, c *Client, path string) (*T, error) {
+	var out T
+	if err := c.do(ctx, request{path: path, idempotent: true}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+type request struct {
+	method      string
+	path        string
+	body        []byte
+	contentType string
+	// idempotent requests are retried
+	idempotent bool
+	// anyStatus decodes the body whatever the status
+	anyStatus bool
+	// alsoOK is a non-2xx status whose body is decoded like a 2xx one
+	alsoOK int
+	admin  bool
+	// apiVersion overrides the client's API version
+	apiVersion int
+}
+
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	retries := 0
+	if req.idempotent {
+		retries = c.retries
+	}
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		err := c.once(ctx, req, out)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+func (c *Client) once(ctx context.Context, req request, out any) error {
+	method := req.method
+	if method == "" {
+		method = http.MethodGet
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, c.baseURL+req.path, body)
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	httpReq.Header.Set("User-Agent", c.userAgent)
+	version := c.apiVersion
+	if req.apiVersion != 0 {
+		version = req.apiVersion
+	}
+	if version != 0 {
+		httpReq.Header.Set(apiversion.RequestHeader, strconv.Itoa(version))
+	}
+	if req.contentType != "" {
+		httpReq.Header.Set("Content-Type", req.contentType)
+	}
+	if req.admin && c.adminToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.adminToken)
+	} else if !req.admin && c.bearerToken != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+
+	resp, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == problem.ContentType {
+		apiErr := &Error{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+		var p Problem
+		if json.Unmarshal(data, &p) == nil {
+			apiErr.Problem = &p
+		}
+		return apiErr
+	}
+	jsonBody := strings.Contains(mediaType, "json")
+	ok := resp.StatusCode >= 200 && resp.StatusCode <= 299 ||
+		(req.anyStatus || resp.StatusCode == req.alsoOK) && jsonBody
+	if !ok {
+		return &Error{StatusCode: resp.StatusCode, Body: strings.TrimSpace(string(data))}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("decoding %s response: %w", req.path, err)
+	}
+	return nil
+}
+
+// retryable reports whether a failed request may succeed when repeated:
+// transport errors and gateway/unavailable responses, not cancellation or
+// undecodable responses.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
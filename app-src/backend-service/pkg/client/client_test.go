@@ -0,0 +1,372 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/server"
+)
+
+func newTestClient(t *testing.T, opts ...Option) *Client {
+	t.Helper()
+	return newConfiguredTestClient(t, nil, opts...)
+}
+
+// newConfiguredTestClient is newTestClient with mutate adjusting the
+// configuration of the server.
+func newConfiguredTestClient(t *testing.T, mutate func(*config.Config), opts ...Option) *Client {
+	t.Helper()
+	called := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"message":"hello"}`))
+	}))
+	t.Cleanup(called.Close)
+	cfg := config.Config{
+		Build:            config.BuildInfo{Version: "v0.0.0-test"},
+		Port:             "8080",
+		ServiceName:      "backend-service",
+		Environment:      "test",
+		Hostname:         "test-host",
+		LogFormat:        "text",
+		LogLevel:         "info",
+		PodNamespace:     "default",
+		PodIP:            "127.0.0.1",
+		JobWorkers:       1,
+		JobQueueCapacity: 3,
+		DelayMax:         time.Second,
+		PrestopTimeout:   time.Second,
+		AdminToken:       "admin-token",
+
+		LoadMaxMillicores:  100,
+		LoadMaxMemoryBytes: 1 << 20,
+		LoadMaxDuration:    time.Second,
+
+		UploadDir:          t.TempDir(),
+		UploadMaxBytes:     1 << 10,
+		UploadMaxTotal:     1 << 20,
+		UploadAllowedTypes: []string{"text/plain"},
+
+		DownstreamURL:       called.URL,
+		DownstreamChainURLs: []string{called.URL, called.URL},
+
+		GitOpsRepoProvider: "github",
+	}
+	if mutate != nil {
+		mutate(&cfg)
+	}
+	s, err := server.NewServer(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	return New(ts.URL, opts...)
+}
+
+// testToken returns an HS256 JWT of the JSON claims signed with secret.
+func testToken(secret, claims string) string {
+	enc := base64.RawURLEncoding.EncodeToString
+	input := enc([]byte(`{"alg":"HS256"}`)) + "." + enc([]byte(claims))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + enc(mac.Sum(nil))
+}
+
+// TestEndpoints calls every method against a real server handler.
+func TestEndpoints(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, WithAdminToken("admin-token"))
+
+	calls := map[string]func() (any, error){
+		"Health":       func() (any, error) { return c.Health(ctx) },
+		"Ready":        func() (any, error) { return c.Ready(ctx) },
+		"Version":      func() (any, error) { return c.Version(ctx) },
+		"Info":         func() (any, error) { return c.Info(ctx) },
+		"InfoV2":       func() (any, error) { return c.InfoV2(ctx) },
+		"Echo":         func() (any, error) { return c.Echo(ctx, http.MethodPost, "text/plain", []byte("hi")) },
+		"Delay":        func() (any, error) { return c.Delay(ctx, time.Millisecond) },
+		"StatusCode":   func() (any, error) { return c.StatusCode(ctx, http.StatusTeapot) },
+		"Leader":       func() (any, error) { return c.Leader(ctx) },
+		"Deployment":   func() (any, error) { return c.Deployment(ctx) },
+		"Dependencies": func() (any, error) { return c.Dependencies(ctx) },
+		"Resources":    func() (any, error) { return c.Resources(ctx) },
+		"Disruptions":  func() (any, error) { return c.Disruptions(ctx) },
+		"Drift":        func() (any, error) { return c.Drift(ctx) },
+		"GitOpsStatus": func() (any, error) {
+			argo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"spec":{"source":{"targetRevision":"main"}},"status":{"sync":{"status":"Synced"}}}`))
+			}))
+			defer argo.Close()
+			c := newConfiguredTestClient(t, func(cfg *config.Config) {
+				cfg.ArgoCDURL, cfg.ArgoCDApplication = argo.URL, "dev-backend-service"
+			})
+			return c.GitOpsStatus(ctx)
+		},
+		"Deployments": func() (any, error) { return c.Deployments(ctx, "Application/argocd/dev-backend-service", 10) },
+		"GitCommits":  func() (any, error) { return c.GitCommits(ctx) },
+		"Peers": func() (any, error) {
+			peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"version":"1.2.0","git_commit":"4f1c2a9"}`))
+			}))
+			defer peer.Close()
+			c := newConfiguredTestClient(t, func(cfg *config.Config) {
+				cfg.PeersService, cfg.PeersPort = "127.0.0.1", peer.URL[strings.LastIndex(peer.URL, ":")+1:]
+			})
+			return c.Peers(ctx)
+		},
+		"GitOpsDrift": func() (any, error) {
+			c := newConfiguredTestClient(t, func(cfg *config.Config) { cfg.GitOpsManifestURL = "http://127.0.0.1:1/kustomization.yaml" })
+			return c.GitOpsDrift(ctx)
+		},
+		"Promote": func() (any, error) {
+			github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/contents/"):
+					w.Write([]byte(`{"encoding":"base64","sha":"abc","content":"` +
+						base64.StdEncoding.EncodeToString([]byte("images:\n- name: ghcr.io/anasadan/gitops-demo\n  newTag: 1.2.0\n")) + `"}`))
+				case strings.HasSuffix(r.URL.Path, "/pulls"):
+					w.Write([]byte(`{"number":42,"html_url":"https://github.com/anasadan/gitops/pull/42"}`))
+				default:
+					w.Write([]byte(`{"object":{"sha":"4f1c2a9"}}`))
+				}
+			}))
+			defer github.Close()
+			c := newConfiguredTestClient(t, func(cfg *config.Config) {
+				cfg.GitOpsRepoProvider, cfg.GitOpsRepoAPIURL, cfg.GitOpsRepo = "github", github.URL, "anasadan/gitops"
+				cfg.GitOpsRepoBranch, cfg.GitOpsPromoteToken, cfg.GitOpsImage = "main", "promote-token", "ghcr.io/anasadan/gitops-demo"
+				cfg.GitOpsPromotePath, cfg.GitOpsPromoteEnvironments = "overlays/{environment}/kustomization.yaml", []string{"dev"}
+			}, WithAdminToken("admin-token"))
+			return c.Promote(ctx, PromoteRequest{Environment: "dev", Tag: "1.3.0"})
+		},
+		"Kubernetes": func() (any, error) { return c.Kubernetes(ctx) },
+		"Repos":      func() (any, error) { return c.Repos(ctx) },
+		"LiveConfig": func() (any, error) { return c.LiveConfig(ctx) },
+		"Flags":      func() (any, error) { return c.Flags(ctx) },
+		"Me": func() (any, error) {
+			c := newConfiguredTestClient(t, func(cfg *config.Config) { cfg.JWTSecret = "jwt-secret" },
+				WithBearerToken(testToken("jwt-secret", `{"sub":"alice"}`)))
+			return c.Me(ctx)
+		},
+		"ScalingMetrics":  func() (any, error) { return c.ScalingMetrics(ctx) },
+		"QueueMetrics":    func() (any, error) { return c.QueueMetrics(ctx) },
+		"Stats":           func() (any, error) { return c.Stats(ctx) },
+		"LifecycleEvents": func() (any, error) { return c.LifecycleEvents(ctx) },
+		"EnqueueJobs":     func() (any, error) { return c.EnqueueJobs(ctx, EnqueueJobsRequest{Count: 1, DurationMs: 10}) },
+		"LoadCPU": func() (any, error) {
+			return c.LoadCPU(ctx, CPULoadRequest{Millicores: 10, DurationSeconds: 1})
+		},
+		"LoadMemory": func() (any, error) {
+			return c.LoadMemory(ctx, MemoryLoadRequest{Megabytes: 1, DurationSeconds: 1})
+		},
+		"CreateTask": func() (any, error) { return c.CreateTask(ctx, CreateTaskRequest{DurationMs: 10}) },
+		"Task": func() (any, error) {
+			task, err := c.CreateTask(ctx, CreateTaskRequest{DurationMs: 10})
+			if err != nil {
+				return nil, err
+			}
+			return c.Task(ctx, task.ID)
+		},
+		"Upload": func() (any, error) {
+			return c.Upload(ctx, "notes.txt", "text/plain", strings.NewReader("hello"))
+		},
+		"LoadStatus": func() (any, error) { return c.LoadStatus(ctx) },
+		"Call":       func() (any, error) { return c.Call(ctx) },
+		"Chain":      func() (any, error) { return c.Chain(ctx) },
+		"Items":      func() (any, error) { return c.Items(ctx, 10, 0) },
+		"CreateItem": func() (any, error) { return c.CreateItem(ctx, ItemRequest{Name: "widget"}) },
+		"Item": func() (any, error) {
+			item, err := c.CreateItem(ctx, ItemRequest{Name: "widget"})
+			if err != nil {
+				return nil, err
+			}
+			return c.Item(ctx, item.ID)
+		},
+		"UpdateItem": func() (any, error) {
+			item, err := c.CreateItem(ctx, ItemRequest{Name: "widget"})
+			if err != nil {
+				return nil, err
+			}
+			return c.UpdateItem(ctx, item.ID, ItemRequest{Name: "gadget"})
+		},
+		"DeleteItem": func() (any, error) {
+			item, err := c.CreateItem(ctx, ItemRequest{Name: "widget"})
+			if err != nil {
+				return nil, err
+			}
+			return item, c.DeleteItem(ctx, item.ID)
+		},
+		"APIVersions": func() (any, error) { return c.APIVersions(ctx) },
+		"Schemas":     func() (any, error) { return c.Schemas(ctx) },
+		"OpenAPI":     func() (any, error) { return c.OpenAPI(ctx) },
+		"Schema":      func() (any, error) { return c.Schema(ctx, "HealthResponse") },
+		"AdminConfig": func() (any, error) { return c.AdminConfig(ctx) },
+		"AdminEnv":    func() (any, error) { return c.AdminEnv(ctx) },
+		"AdminRoutes": func() (any, error) { return c.AdminRoutes(ctx) },
+		"AdminAudit":  func() (any, error) { return c.AdminAudit(ctx, "item.", 0) },
+		"Selftest":    func() (any, error) { return c.Selftest(ctx) },
+		"Recordings":  func() (any, error) { return c.Recordings(ctx) },
+		"Drain":       func() (any, error) { return c.Drain(ctx) },
+		"Undrain":     func() (any, error) { return c.Undrain(ctx) },
+		"Chaos":       func() (any, error) { return c.Chaos(ctx) },
+		"SetChaos": func() (any, error) {
+			// A 0% error rate leaves the other calls alone.
+			var none int64
+			return c.SetChaos(ctx, ChaosRequest{ErrorPercent: &none})
+		},
+		"ResetChaos": func() (any, error) { return c.ResetChaos(ctx) },
+		"LogLevel":   func() (any, error) { return c.LogLevel(ctx) },
+		"SetLogLevel": func() (any, error) {
+			resp, err := c.SetLogLevel(ctx, "info")
+			if err == nil {
+				_, err = c.ResetLogLevel(ctx)
+			}
+			return resp, err
+		},
+		"ResetLogLevel": func() (any, error) { return c.ResetLogLevel(ctx) },
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			out, err := call()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if out == nil {
+				t.Fatalf("%s returned nil", name)
+			}
+		})
+	}
+}
+
+func TestResponses(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	if v, err := c.Version(ctx); err != nil || v.Version != "v0.0.0-test" {
+		t.Errorf("Version() = %+v, %v", v, err)
+	}
+	// Not ready yet: the 503 body is the answer, not an error.
+	if r, err := c.Ready(ctx); err != nil || r.Status != "not_ready" {
+		t.Errorf("Ready() = %+v, %v, want not_ready", r, err)
+	}
+	if s, err := c.StatusCode(ctx, http.StatusNoContent); err != nil || s.Status != http.StatusNoContent {
+		t.Errorf("StatusCode(204) = %+v, %v", s, err)
+	}
+	if e, err := c.Echo(ctx, http.MethodPut, "application/json", []byte(`{"a":1}`)); err != nil || e.Method != http.MethodPut || e.JSON == nil {
+		t.Errorf("Echo() = %+v, %v", e, err)
+	}
+	var doc map[string]any
+	if raw, err := c.Schema(ctx, "VersionResponse"); err != nil || json.Unmarshal(raw, &doc) != nil || doc["title"] != "VersionResponse" {
+		t.Errorf("Schema() = %s, %v", raw, err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t)
+
+	var apiErr *Error
+	if _, err := c.AdminConfig(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("AdminConfig() without token = %v, want 401", err)
+	}
+	if _, err := c.Schema(ctx, "Missing"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Schema(Missing) = %v, want 404", err)
+	}
+	if _, err := c.EnqueueJobs(ctx, EnqueueJobsRequest{Count: 0}); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("EnqueueJobs(0) = %v, want 400", err)
+	} else if apiErr.Problem == nil || len(apiErr.Problem.InvalidParams) != 1 || apiErr.Problem.InvalidParams[0].Name != "count" {
+		t.Errorf("EnqueueJobs(0) problem = %+v, want an invalid count", apiErr.Problem)
+	}
+
+	// Capacity is 3 and workers aren't running: a partial enqueue returns
+	// both the response and an error.
+	resp, err := c.EnqueueJobs(ctx, EnqueueJobsRequest{Count: 5, DurationMs: 10})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || resp == nil || resp.Enqueued != 3 {
+		t.Errorf("EnqueueJobs(5) = %+v, %v, want 3 enqueued and 503", resp, err)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int32
+		status    int
+		call      func(ctx context.Context, c *Client) error
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name: "GET recovers after 503s", failures: 2, status: http.StatusServiceUnavailable,
+			call:      func(ctx context.Context, c *Client) error { _, err := c.Health(ctx); return err },
+			wantCalls: 3,
+		},
+		{
+			name: "GET gives up", failures: 10, status: http.StatusBadGateway,
+			call:      func(ctx context.Context, c *Client) error { _, err := c.Health(ctx); return err },
+			wantCalls: 3, wantErr: true,
+		},
+		{
+			name: "client errors are not retried", failures: 10, status: http.StatusNotFound,
+			call:      func(ctx context.Context, c *Client) error { _, err := c.Health(ctx); return err },
+			wantCalls: 1, wantErr: true,
+		},
+		{
+			name: "POST is not retried", failures: 10, status: http.StatusServiceUnavailable,
+			call: func(ctx context.Context, c *Client) error {
+				_, err := c.Prestop(ctx, 0)
+				return err
+			},
+			wantCalls: 1, wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					http.Error(w, "unavailable", tt.status)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"status":"healthy","timestamp":"now"}`))
+			}))
+			defer ts.Close()
+
+			c := New(ts.URL, WithRetries(2, time.Millisecond))
+			err := tt.call(context.Background(), c)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("err = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestContextCancelsRetries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c := New(ts.URL, WithRetries(100, time.Second))
+	start := time.Now()
+	if _, err := c.Health(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("retries continued for %s after the context ended", elapsed)
+	}
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"github.com/anasadan/gitops-demo/backend-service/internal/audit"
+	"github.com/anasadan/gitops-demo/backend-service/internal/config"
+	"github.com/anasadan/gitops-demo/backend-service/internal/handlers"
+	"github.com/anasadan/gitops-demo/backend-service/internal/k8sclient"
+	"github.com/anasadan/gitops-demo/backend-service/internal/problem"
+	"github.com/anasadan/gitops-demo/backend-service/internal/recording"
+	"github.com/anasadan/gitops-demo/backend-service/internal/server"
+)
+
+// The API types are aliases of the types the handlers encode, so the client
+// can't drift from the server.
+type (
+	HealthResponse     = handlers.HealthResponse
+	VersionResponse    = handlers.VersionResponse
+	InfoResponse       = handlers.InfoResponse
+	InfoResponseV2     = handlers.InfoResponseV2
+	InfoBuild          = handlers.InfoBuild
+	InfoPod            = handlers.InfoPod
+	Topology           = handlers.Topology
+	EchoResponse       = handlers.EchoResponse
+	DelayResponse      = handlers.DelayResponse
+	StatusCodeResponse = handlers.StatusCodeResponse
+	ConfigResponse     = handlers.ConfigResponse
+	EnvResponse        = handlers.EnvResponse
+	ConfigEntry        = config.Entry
+
+	LeaderResponse           = server.LeaderResponse
+	DeploymentStatusResponse = server.DeploymentStatusResponse
+	DeploymentCondition      = server.DeploymentCondition
+	ReplicaSetStatus         = server.ReplicaSetStatus
+	DependenciesResponse     = server.DependenciesResponse
+	ServiceDependency        = server.ServiceDependency
+	ServiceEndpoint          = server.ServiceEndpoint
+	VolumeStatus             = server.VolumeStatus
+	EphemeralStorageStatus   = server.EphemeralStorageStatus
+	ResourcesResponse        = server.ResourcesResponse
+	CPUResources             = server.CPUResources
+	MemoryResources          = server.MemoryResources
+	RuntimeResources         = server.RuntimeResources
+	DisruptionsResponse      = server.DisruptionsResponse
+	TerminationInfo          = server.TerminationInfo
+	DisruptionInfo           = server.DisruptionInfo
+	DriftResponse            = server.DriftResponse
+	GitOpsStatusResponse     = server.GitOpsStatusResponse
+	DeploymentsResponse      = server.DeploymentsResponse
+	DeploymentEvent          = server.DeploymentEvent
+	GitCommitsResponse       = server.GitCommitsResponse
+	GitEvent                 = server.GitEvent
+	GitCommit                = server.GitCommit
+	PeersResponse            = server.PeersResponse
+	Peer                     = server.Peer
+	ServingVersion           = server.ServingVersion
+	GitOpsDriftResponse      = server.GitOpsDriftResponse
+	PromoteRequest           = server.PromoteRequest
+	PromoteResponse          = server.PromoteResponse
+	KubernetesClientResponse = server.KubernetesClientResponse
+	KubernetesClientStats    = k8sclient.Stats
+	ReposResponse            = server.ReposResponse
+	RepoStatus               = server.RepoStatus
+	ScalingMetricsResponse   = server.ScalingMetricsResponse
+	QueueMetricsResponse     = server.QueueMetricsResponse
+	StatsFrame               = server.StatsFrame
+	LifecycleEventsResponse  = server.LifecycleEventsResponse
+	LifecycleEvent           = server.LifecycleEvent
+	EnqueueJobsRequest       = server.EnqueueJobsRequest
+	EnqueueJobsResponse      = server.EnqueueJobsResponse
+	CreateTaskRequest        = server.CreateTaskRequest
+	TaskResponse             = server.TaskResponse
+	UploadResponse           = server.UploadResponse
+	CPULoadRequest           = server.CPULoadRequest
+	MemoryLoadRequest        = server.MemoryLoadRequest
+	LoadResponse             = server.LoadResponse
+	LoadStatusResponse       = server.LoadStatusResponse
+	LiveConfigResponse       = server.LiveConfigResponse
+	FlagsResponse            = server.FlagsResponse
+	FlagState                = server.FlagState
+	ClaimsResponse           = server.ClaimsResponse
+	ReadinessResponse        = server.ReadinessResponse
+	ReadinessCheck           = server.ReadinessCheck
+	APIVersionsResponse      = server.APIVersionsResponse
+	SchemaIndexResponse      = server.SchemaIndexResponse
+	SchemaInfo               = server.SchemaInfo
+	PrestopResponse          = server.PrestopResponse
+	DrainResponse            = server.DrainResponse
+	ChaosRequest             = server.ChaosRequest
+	ChaosResponse            = server.ChaosResponse
+	CallResponse             = server.CallResponse
+	ChainResponse            = server.ChainResponse
+	ChainHop                 = server.ChainHop
+	ItemRequest              = server.ItemRequest
+	ItemResponse             = server.ItemResponse
+	ItemsResponse            = server.ItemsResponse
+	RoutesResponse           = server.RoutesResponse
+	RouteInfo                = server.RouteInfo
+	SelftestResponse         = server.SelftestResponse
+	SelftestCheck            = server.SelftestCheck
+	RecordingsResponse       = server.RecordingsResponse
+	RecordingFile            = recording.File
+	AuditResponse            = server.AuditResponse
+	LogLevelRequest          = server.LogLevelRequest
+	LogLevelResponse         = server.LogLevelResponse
+	AuditEntry               = audit.Entry
+
+	Problem      = problem.Problem
+	InvalidParam = problem.InvalidParam
+)
@@ -100,6 +100,10 @@ build_and_push_image() {
         --build-arg VERSION=dev \
         --build-arg BUILD_TIME="$(date -u +%Y-%m-%dT%H:%M:%SZ)" \
         --build-arg GIT_COMMIT="$(git rev-parse --short HEAD 2>/dev/null || echo 'unknown')" \
+        --build-arg GIT_BRANCH="$(git rev-parse --abbrev-ref HEAD 2>/dev/null)" \
+        --build-arg GIT_TAG="$(git describe --tags --exact-match 2>/dev/null)" \
+        --build-arg GIT_DIRTY="$([ -n "$(git status --porcelain 2>/dev/null)" ] && echo true || echo false)" \
+        --build-arg BUILD_USER="$(whoami)" \
         "$PROJECT_ROOT/app-src/backend-service"
     
     log_info "Pushing image to local registry..."